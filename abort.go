@@ -0,0 +1,119 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// AbortRequest records a command which requested that the work it is part
+// of be aborted, by exiting with a designated exit code, or by printing a
+// designated marker. It is the cause passed to the cancellation function
+// given to AbortOnExitCode or AbortOnOutput.
+type AbortRequest struct {
+	// Path is the path of the command which was executed.
+	Path string
+
+	// Args holds command line arguments.
+	Args []string
+
+	// ExitCode is the exit code of the process.
+	ExitCode int
+
+	// Marker is the line of output which contained the marker, if the
+	// request was made using a marker.
+	Marker string
+}
+
+// Cmdline returns the concatenation of filepath.Base(e.Path) and e.Args,
+// separated by spaces. See func Cmdline.
+func (e *AbortRequest) Cmdline() string {
+	return cmdline(e.Path, e.Args)
+}
+
+func (e *AbortRequest) Error() string {
+	if e.Marker != "" {
+		return fmt.Sprintf("execx: %s requested abort: %q", e.Cmdline(), e.Marker)
+	}
+	return fmt.Sprintf("execx: %s requested abort (exit status %d)", e.Cmdline(), e.ExitCode)
+}
+
+// abortTrigger is a condition under which a command requests an abort.
+type abortTrigger struct {
+	cancel func(cause error)
+	codes  []int
+	marker []byte
+}
+
+// AbortOnExitCode calls cancel with an *AbortRequest if the command exits
+// with any of the specified codes, such that a command can abort the work
+// it is part of, such as a preflight check which rejects the whole batch.
+// cancel is typically the cancellation function of the context of that
+// work, as returned by context.WithCancelCause, or the cancellation
+// function of a group of commands. cancel is called before Wait returns.
+//
+// The exit code need not denote a failure: commands which are allowed to
+// exit with the code, using WithAllowedExitCodes, also request an abort.
+// If the command fails, the *ExitError carries the request as a detail
+// named "abort_requested".
+func AbortOnExitCode(cancel func(cause error), codes ...int) Option {
+	return func(cfg *config) {
+		cfg.aborts = append(cfg.aborts, abortTrigger{cancel: cancel, codes: codes})
+	}
+}
+
+// AbortOnOutput is like AbortOnExitCode, but the command requests an abort
+// by printing marker on its captured standard output or standard error,
+// regardless of its exit status. Only output which is captured, as
+// described by Start, is considered.
+func AbortOnOutput(cancel func(cause error), marker string) Option {
+	return func(cfg *config) {
+		cfg.aborts = append(cfg.aborts, abortTrigger{cancel: cancel, marker: []byte(marker)})
+	}
+}
+
+// match returns the abort request made by the run described by res, if
+// any.
+func (t *abortTrigger) match(res *Result) *AbortRequest {
+	req := &AbortRequest{Path: res.Path, Args: res.Args, ExitCode: res.ExitCode}
+	for _, code := range t.codes {
+		if res.ExitCode == code {
+			return req
+		}
+	}
+	if len(t.marker) == 0 {
+		return nil
+	}
+	for _, out := range [][]byte{res.Stderr, res.Stdout} {
+		if i := bytes.Index(out, t.marker); i >= 0 {
+			req.Marker = string(lineAround(out, i, i+len(t.marker)))
+			return req
+		}
+	}
+	return nil
+}
+
+// abortRequests returns the abort requests made by the run described by
+// res, along with the triggers they match.
+func (h *Handle) abortRequests(res *Result) (triggers []abortTrigger, reqs []*AbortRequest) {
+	for _, t := range h.cfg.aborts {
+		if req := t.match(res); req != nil {
+			triggers = append(triggers, t)
+			reqs = append(reqs, req)
+		}
+	}
+	return triggers, reqs
+}
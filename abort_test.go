@@ -0,0 +1,78 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+// cancelWithCause returns a context, and a function which cancels it,
+// recording the cause.
+func cancelWithCause() (context.Context, func(error), *error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cause := new(error)
+	return ctx, func(err error) {
+		*cause = err
+		cancel()
+	}, cause
+}
+
+func TestAbortOnExitCode(t *testing.T) {
+	ctx, cancel, cause := cancelWithCause()
+	_, err := execx.Run(context.Background(), selfCmd("on"), execx.AbortOnExitCode(cancel, 1))
+	if ctx.Err() == nil {
+		t.Fatal("context not canceled")
+	}
+	var req *execx.AbortRequest
+	if !errors.As(*cause, &req) || req.ExitCode != 1 {
+		t.Fatalf("got cause %v, want *AbortRequest with exit code 1", *cause)
+	}
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want *ExitError", err)
+	}
+	found := false
+	for _, d := range ee.Details {
+		found = found || d.Key == "abort_requested"
+	}
+	if !found {
+		t.Errorf("no abort_requested detail")
+	}
+
+	ctx, cancel, _ = cancelWithCause()
+	execx.Run(context.Background(), selfCmd("on"), execx.AbortOnExitCode(cancel, 2, 3))
+	if ctx.Err() != nil {
+		t.Errorf("context canceled for other exit code")
+	}
+}
+
+func TestAbortOnOutput(t *testing.T) {
+	ctx, cancel, cause := cancelWithCause()
+	_, err := execx.Run(context.Background(), selfCmd("echo"), execx.AbortOnOutput(cancel, "echo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("context not canceled")
+	}
+	req, ok := (*cause).(*execx.AbortRequest)
+	if !ok || req.Marker != "echoed" {
+		t.Fatalf("got cause %v, want *AbortRequest with marker line %q", *cause, "echoed")
+	}
+}
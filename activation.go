@@ -0,0 +1,213 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Environment variables of the systemd socket activation protocol. See
+// sd_listen_fds(3).
+const (
+	listenPIDEnv     = "LISTEN_PID"
+	listenFDsEnv     = "LISTEN_FDS"
+	listenFDNamesEnv = "LISTEN_FDNAMES"
+)
+
+// listenFDsStart is the first file descriptor passed using socket
+// activation.
+const listenFDsStart = 3
+
+// WithActivationSocket passes f, typically a listening socket bound by
+// the current process, to the command using the systemd socket activation
+// protocol, such that servers which support socket activation can be run
+// under a supervisor other than systemd, which keeps their sockets bound
+// across restarts. name is passed in LISTEN_FDNAMES. If it is empty, the
+// socket is named "unknown", as systemd does.
+//
+// Activation sockets become file descriptors 3 and up, in the order of the
+// calls to WithActivationSocket. Files in cmd.ExtraFiles, and files passed
+// using WithExtraFiles or WithNamedFile, are renumbered to follow them.
+// LISTEN_FDS and LISTEN_FDNAMES are set in the environment of the command,
+// replacing inherited values. Since LISTEN_PID must be the process ID of
+// the command, which is not known before it starts, the command runs
+// under a shell shim which sets LISTEN_PID, and executes the command in
+// its place, as for WithUmask.
+//
+// If a name contains ':', or f is nil or closed, Start returns a
+// *StartError which wraps a *FileMappingError. The sockets are recorded
+// as a detail named "listen_fds" in errors produced by the command.
+// WithActivationSocket is not supported on Windows.
+func WithActivationSocket(name string, f *os.File) Option {
+	return func(cfg *config) {
+		cfg.activation = append(cfg.activation, namedFile{name: name, f: f})
+	}
+}
+
+// applyActivation passes the activation sockets to h.cmd.
+func (h *Handle) applyActivation() error {
+	cmd := h.cmd
+	if runtime.GOOS == "windows" {
+		return wrapStart(errors.New("execx: WithActivationSocket is not supported on windows"), cmd, h.cfg.collectors)
+	}
+	var (
+		files  []*os.File
+		names  []string
+		passed []PassedFile
+	)
+	for i, nf := range h.cfg.activation {
+		name := nf.name
+		if name == "" {
+			name = "unknown"
+		}
+		var err error
+		switch {
+		case strings.Contains(name, ":"):
+			err = errors.New("name contains ':'")
+		case nf.f == nil:
+			err = errors.New("nil file")
+		case nf.f.Fd() == ^uintptr(0):
+			err = os.ErrClosed
+		}
+		if err != nil {
+			return wrapStart(&FileMappingError{Name: name, Err: err}, cmd, h.cfg.collectors)
+		}
+		files = append(files, nf.f)
+		names = append(names, name)
+		passed = append(passed, PassedFile{Name: name, FD: listenFDsStart + i, Kind: fileKind(nf.f)})
+	}
+	cmd.ExtraFiles = append(files, cmd.ExtraFiles...)
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	var child []string
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if key != listenPIDEnv && key != listenFDsEnv && key != listenFDNamesEnv {
+			child = append(child, kv)
+		}
+	}
+	cmd.Env = append(child,
+		listenFDsEnv+"="+strconv.Itoa(len(files)),
+		listenFDNamesEnv+"="+strings.Join(names, ":"))
+	args := []string{"sh", "-c", listenPIDEnv + `=$$; export ` + listenPIDEnv + `; exec "$0" "$@"`, cmd.Path}
+	if len(cmd.Args) > 1 {
+		args = append(args, cmd.Args[1:]...)
+	}
+	cmd.Path = umaskShell
+	cmd.Args = args
+	h.cfg.collectors = append(h.cfg.collectors, CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "listen_fds", passed
+	}))
+	return nil
+}
+
+// activated holds the files passed to the current process using socket
+// activation, parsed once, such that every file descriptor is owned by a
+// single *os.File.
+var activated struct {
+	once  sync.Once
+	files []*os.File
+	err   error
+}
+
+// ActivationFiles returns the files passed to the current process using
+// the systemd socket activation protocol, by systemd, or by a parent which
+// used WithActivationSocket, in order. The name of each file, as reported
+// by its Name method, is its name in LISTEN_FDNAMES. If the current
+// process was not socket-activated, ActivationFiles returns nil and a nil
+// error.
+//
+// The files are marked close-on-exec, and the LISTEN_* variables are
+// removed from the environment, such that they are not passed on to the
+// children of the current process. The same files are returned by every
+// call.
+func ActivationFiles() ([]*os.File, error) {
+	activated.once.Do(func() {
+		activated.files, activated.err = parseActivation()
+		for _, key := range []string{listenPIDEnv, listenFDsEnv, listenFDNamesEnv} {
+			os.Unsetenv(key)
+		}
+	})
+	return append([]*os.File(nil), activated.files...), activated.err
+}
+
+// ActivationListeners returns listeners for the sockets passed to the
+// current process using socket activation, as per ActivationFiles, in
+// order. If a file is not a listening socket, ActivationListeners returns
+// a *FileMappingError. The listeners are independent of the files, which
+// remain open.
+func ActivationListeners() ([]net.Listener, error) {
+	files, err := ActivationFiles()
+	if err != nil {
+		return nil, err
+	}
+	var listeners []net.Listener
+	for _, f := range files {
+		ln, err := net.FileListener(f)
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil, &FileMappingError{Name: f.Name(), Err: err}
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// parseActivation parses the LISTEN_* variables.
+func parseActivation() ([]*os.File, error) {
+	pidstr := os.Getenv(listenPIDEnv)
+	if pidstr == "" {
+		return nil, nil
+	}
+	pid, err := strconv.Atoi(pidstr)
+	if err != nil {
+		return nil, &FileMappingError{Err: fmt.Errorf("malformed %s %q", listenPIDEnv, pidstr)}
+	}
+	if pid != os.Getpid() {
+		// The variables were meant for another process.
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv(listenFDsEnv))
+	if err != nil || n < 0 {
+		return nil, &FileMappingError{Err: fmt.Errorf("malformed %s %q", listenFDsEnv, os.Getenv(listenFDsEnv))}
+	}
+	var names []string
+	if s := os.Getenv(listenFDNamesEnv); s != "" {
+		names = strings.Split(s, ":")
+	}
+	files := make([]*os.File, 0, n)
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		name := "unknown"
+		if i < len(names) {
+			name = names[i]
+		}
+		closeOnExec(fd)
+		files = append(files, os.NewFile(uintptr(fd), name))
+	}
+	return files, nil
+}
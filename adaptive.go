@@ -0,0 +1,165 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+// Defaults for TimeoutAdvisor.
+const (
+	defaultAdvisorPercentile = 0.99
+	defaultAdvisorFactor     = 2
+	defaultAdvisorMinRuns    = 10
+	defaultAdvisorWindow     = 100
+)
+
+// A TimeoutAdvisor suggests timeouts for commands, based on the durations
+// of their successful runs, as recorded by a History. The suggested
+// timeout for a command is a percentile of the durations of its recent
+// successful runs, multiplied by a factor. Runs are matched by their
+// Fingerprint.
+//
+// A TimeoutAdvisor is safe for concurrent use by multiple goroutines.
+type TimeoutAdvisor struct {
+	// History provides the recorded runs. It must not be nil.
+	History *History
+
+	// Percentile is the percentile of durations to use, between 0 and
+	// 1. If Percentile is zero, 0.99 is used.
+	Percentile float64
+
+	// Factor multiplies the percentile. If Factor is zero, 2 is used.
+	Factor float64
+
+	// MinRuns is the number of successful runs needed for a suggestion.
+	// If MinRuns is zero, 10 is used.
+	MinRuns int
+
+	// Window is the number of most recent successful runs considered.
+	// If Window is zero, 100 is used.
+	Window int
+
+	// Floor is the shortest timeout suggested.
+	Floor time.Duration
+}
+
+// A TimeoutAdvice is a timeout suggested by a TimeoutAdvisor.
+type TimeoutAdvice struct {
+	// Timeout is the suggested timeout.
+	Timeout time.Duration
+
+	// Percentile is the percentile of the durations of the runs the
+	// suggestion is based on, before it is multiplied by the factor.
+	Percentile time.Duration
+
+	// Runs is the number of runs the suggestion is based on.
+	Runs int
+}
+
+// Suggest suggests a timeout for the command with the specified
+// fingerprint. It reports false if there are not enough recorded
+// successful runs of the command.
+func (a *TimeoutAdvisor) Suggest(ctx context.Context, fingerprint string) (TimeoutAdvice, bool, error) {
+	window := a.Window
+	if window == 0 {
+		window = defaultAdvisorWindow
+	}
+	minRuns := a.MinRuns
+	if minRuns == 0 {
+		minRuns = defaultAdvisorMinRuns
+	}
+	ds, err := a.History.durations(ctx, fingerprint, window)
+	if err != nil || len(ds) < minRuns {
+		return TimeoutAdvice{}, false, err
+	}
+	p := a.Percentile
+	if p == 0 {
+		p = defaultAdvisorPercentile
+	}
+	factor := a.Factor
+	if factor == 0 {
+		factor = defaultAdvisorFactor
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	// Nearest rank.
+	rank := int(math.Ceil(p*float64(len(ds)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(ds) {
+		rank = len(ds) - 1
+	}
+	adv := TimeoutAdvice{
+		Percentile: ds[rank],
+		Timeout:    time.Duration(float64(ds[rank]) * factor),
+		Runs:       len(ds),
+	}
+	if adv.Timeout < a.Floor {
+		adv.Timeout = a.Floor
+	}
+	return adv, true, nil
+}
+
+// WithAdaptiveTimeout is like WithTimeout, but uses the timeout suggested
+// by a for the command, if any, capped at ceiling. If a cannot suggest a
+// timeout for the command, such as because it has not run successfully
+// often enough, ceiling is used. If ceiling is zero, the command runs
+// without a timeout in that case.
+//
+// If the command fails, the timeout it ran with is recorded as a string
+// detail named "adaptive_timeout" in the *ExitError, describing how the
+// timeout was chosen.
+func WithAdaptiveTimeout(a *TimeoutAdvisor, ceiling time.Duration) Option {
+	return func(cfg *config) {
+		cfg.adaptiveTimeout = &adaptiveTimeout{advisor: a, ceiling: ceiling}
+	}
+}
+
+type adaptiveTimeout struct {
+	advisor *TimeoutAdvisor
+	ceiling time.Duration
+}
+
+// applyAdaptiveTimeout chooses the timeout for h, as per
+// WithAdaptiveTimeout.
+func (h *Handle) applyAdaptiveTimeout(ctx context.Context) {
+	at := h.cfg.adaptiveTimeout
+	adv, ok, err := at.advisor.Suggest(ctx, Fingerprint(h.cmd))
+	var desc string
+	switch {
+	case err != nil:
+		h.cfg.timeout = at.ceiling
+		desc = fmt.Sprintf("%v (ceiling; history unavailable: %v)", at.ceiling, err)
+	case !ok:
+		h.cfg.timeout = at.ceiling
+		desc = fmt.Sprintf("%v (ceiling; not enough history)", at.ceiling)
+	case at.ceiling > 0 && adv.Timeout > at.ceiling:
+		h.cfg.timeout = at.ceiling
+		desc = fmt.Sprintf("%v (ceiling; suggested %v from %d runs)", at.ceiling, adv.Timeout, adv.Runs)
+	default:
+		h.cfg.timeout = adv.Timeout
+		desc = fmt.Sprintf("%v (percentile %v from %d runs)", adv.Timeout, adv.Percentile, adv.Runs)
+	}
+	h.cfg.collectors = append(h.cfg.collectors, CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "adaptive_timeout", desc
+	}))
+}
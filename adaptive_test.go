@@ -0,0 +1,114 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+// addRuns records successful runs with the specified fingerprint and
+// durations in db.
+func (db *historyDB) addRuns(fingerprint string, ds ...time.Duration) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for i, d := range ds {
+		db.rows = append(db.rows, []driver.Value{
+			fingerprint, "tool", `["tool"]`, "/", int64(i), int64(d), int64(0), "",
+		})
+	}
+}
+
+func TestTimeoutAdvisorSuggest(t *testing.T) {
+	hdb := new(historyDB)
+	db := sql.OpenDB(hdb)
+	defer db.Close()
+	h, err := execx.NewHistory(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &execx.TimeoutAdvisor{History: h, Percentile: 0.9, Factor: 3, MinRuns: 5}
+
+	ctx := context.Background()
+	if _, ok, err := a.Suggest(ctx, "fp"); ok || err != nil {
+		t.Fatalf("got suggestion without history (%v)", err)
+	}
+	var ds []time.Duration
+	for i := 1; i <= 10; i++ {
+		ds = append(ds, time.Duration(i)*time.Second)
+	}
+	hdb.addRuns("fp", ds...)
+	adv, ok, err := a.Suggest(ctx, "fp")
+	if !ok || err != nil {
+		t.Fatalf("no suggestion (%v)", err)
+	}
+	if adv.Percentile != 9*time.Second || adv.Timeout != 27*time.Second || adv.Runs != 10 {
+		t.Errorf("got %+v, want 9s percentile, 27s timeout, 10 runs", adv)
+	}
+
+	a.Floor = time.Minute
+	if adv, _, _ := a.Suggest(ctx, "fp"); adv.Timeout != time.Minute {
+		t.Errorf("got timeout %v, want floor of 1m", adv.Timeout)
+	}
+}
+
+func TestWithAdaptiveTimeout(t *testing.T) {
+	hdb := new(historyDB)
+	db := sql.OpenDB(hdb)
+	defer db.Close()
+	h, err := execx.NewHistory(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &execx.TimeoutAdvisor{History: h}
+
+	t.Run("Suggested", func(t *testing.T) {
+		fp := execx.Fingerprint(selfCmd("nap"))
+		var ds []time.Duration
+		for i := 0; i < 10; i++ {
+			ds = append(ds, 50*time.Millisecond)
+		}
+		hdb.addRuns(fp, ds...)
+		defer func() { hdb.rows = nil }()
+		testAdaptiveTimeout(t, a, "100ms (percentile 50ms from 10 runs)")
+	})
+	t.Run("Ceiling", func(t *testing.T) {
+		testAdaptiveTimeout(t, a, "200ms (ceiling; not enough history)")
+	})
+}
+
+func testAdaptiveTimeout(t *testing.T, a *execx.TimeoutAdvisor, want string) {
+	t.Helper()
+	start := time.Now()
+	_, err := execx.Run(context.Background(), selfCmd("nap"), execx.WithAdaptiveTimeout(a, 200*time.Millisecond))
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("command ran for %v, want it to time out", d)
+	}
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	got, _ := ee.Detail("adaptive_timeout")
+	if s, _ := got.(string); !strings.HasPrefix(s, want) {
+		t.Errorf("got adaptive_timeout %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"acln.ro/env"
+)
+
+// An AdoptedProcess is a running process which was not started by the
+// current program, such as a process started by a previous instance of a
+// supervisor, adopted using Adopt, such that it can be managed much like
+// a command started by Start.
+type AdoptedProcess struct {
+	// PID is the process ID of the process.
+	PID int
+
+	// Path, Args, Dir and Env describe the process at the time it was
+	// adopted, where the platform allows it. On Linux, they are read
+	// from /proc, and Env is nil if the environment of the process
+	// is not readable by the current user. Elsewhere, they are empty.
+	Path string
+	Args []string
+	Dir  string
+	Env  env.Map
+
+	// Adopted is the time the process was adopted.
+	Adopted time.Time
+
+	process *os.Process
+	done    chan struct{}
+	exit    *ProcessExit
+	err     error
+}
+
+// Adopt adopts the running process with the specified pid. The process
+// is waited for as per WaitPID, from a goroutine which runs until the
+// process exits. If the process does not exist, Adopt returns an error
+// which wraps os.ErrProcessDone.
+func Adopt(pid int) (*AdoptedProcess, error) {
+	if pid <= 0 || !processAlive(pid) {
+		return nil, fmt.Errorf("execx: pid %d: %w", pid, os.ErrProcessDone)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("execx: pid %d: %w", pid, err)
+	}
+	desc := &ProcessExit{PID: pid}
+	describeProcess(desc)
+	p := &AdoptedProcess{
+		PID:     pid,
+		Path:    desc.Path,
+		Args:    desc.Args,
+		Dir:     desc.Dir,
+		Env:     processEnv(pid),
+		Adopted: SystemClock.Now(),
+		process: process,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		// The process was found alive above, but may have exited
+		// since, so do not check again, as WaitPID does.
+		p.exit, p.err = waitPID(context.Background(), SystemClock, pid)
+		if p.err == nil {
+			p.exit.Path, p.exit.Args, p.exit.Dir = p.Path, p.Args, p.Dir
+			p.exit.Adopted = p.Adopted
+		}
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Cmdline returns the concatenation of filepath.Base(p.Path) and p.Args,
+// separated by spaces. See func Cmdline.
+func (p *AdoptedProcess) Cmdline() string {
+	return cmdline(p.Path, p.Args)
+}
+
+// Signal sends sig to the process. If the process has exited, Signal
+// returns os.ErrProcessDone, rather than signal a process which may have
+// reused its process ID.
+func (p *AdoptedProcess) Signal(sig os.Signal) error {
+	if p.exited() {
+		return os.ErrProcessDone
+	}
+	return p.process.Signal(sig)
+}
+
+// Terminate asks the process to exit gracefully, as per the function
+// Terminate. If the process does not exit within the grace period, or if
+// it cannot be asked to exit gracefully, Terminate kills it. Terminate
+// returns once the process has exited.
+func (p *AdoptedProcess) Terminate(grace time.Duration) error {
+	if p.exited() {
+		return nil
+	}
+	if err := Terminate(&exec.Cmd{Process: p.process}); err == nil {
+		t := SystemClock.NewTimer(grace)
+		defer t.Stop()
+		select {
+		case <-p.done:
+			return nil
+		case <-t.C():
+		}
+	}
+	if err := p.process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) && !p.exited() {
+		return fmt.Errorf("execx: pid %d: %w", p.PID, err)
+	}
+	<-p.done
+	return nil
+}
+
+// Wait waits for the process to exit, and describes its exit. If ctx is
+// done before the process exits, Wait returns ctx.Err(), and the process
+// continues to be waited for.
+func (p *AdoptedProcess) Wait(ctx context.Context) (*ProcessExit, error) {
+	select {
+	case <-p.done:
+		return p.exit, p.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Done returns a channel which is closed when the process has exited.
+func (p *AdoptedProcess) Done() <-chan struct{} {
+	return p.done
+}
+
+// exited reports whether the process has exited.
+func (p *AdoptedProcess) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestAdopt(t *testing.T) {
+	t.Run("Signal", func(t *testing.T) {
+		cmd := selfCmd("sigterm")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		go cmd.Wait()
+		p, err := execx.Adopt(cmd.Process.Pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS == "linux" {
+			if p.Path == "" || p.Dir == "" || len(p.Args) != 1 {
+				t.Errorf("got path %q, dir %q, args %q", p.Path, p.Dir, p.Args)
+			}
+			if p.Env["EXECX_TEST"] != "sigterm" {
+				t.Errorf("EXECX_TEST = %q, want %q", p.Env["EXECX_TEST"], "sigterm")
+			}
+		}
+		if err := p.Signal(syscall.SIGTERM); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		pe, err := p.Wait(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pe.PID != cmd.Process.Pid || pe.Adopted != p.Adopted {
+			t.Errorf("got %+v", pe)
+		}
+		if err := p.Signal(syscall.SIGTERM); err != os.ErrProcessDone {
+			t.Errorf("Signal after exit: got %v, want %v", err, os.ErrProcessDone)
+		}
+	})
+	t.Run("Terminate", func(t *testing.T) {
+		cmd := selfCmd("hang")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		go cmd.Wait()
+		p, err := execx.Adopt(cmd.Process.Pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The process ignores SIGTERM, so it is killed after the grace
+		// period.
+		if err := p.Terminate(timeout); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-p.Done():
+		default:
+			t.Fatal("Terminate returned before the process exited")
+		}
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultAnnotationPatterns are the patterns used by WithAnnotations and
+// Annotations if no patterns are specified. They recognize diagnostics of
+// the form
+//
+//	file:line:col: message
+//	file:line: warning: message
+//
+// as emitted by the Go toolchain, and by many compilers and linters.
+var DefaultAnnotationPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?P<file>[^\s:]+):(?P<line>\d+):(?:(?P<col>\d+):)?\s*(?:(?P<severity>error|warning|note):\s*)?(?P<message>.+)$`),
+}
+
+// An Annotation is a diagnostic derived from the output of a failed
+// command, rendered as a GitHub Actions workflow command, such that it
+// is displayed inline in the files it refers to.
+type Annotation struct {
+	// Level is "error", "warning" or "notice".
+	Level string
+
+	// File, Line and Col locate the diagnostic. File is empty, and Line
+	// and Col are zero, if not known.
+	File string
+	Line int
+	Col  int
+
+	// Title is the title of the annotation.
+	Title string
+
+	// Message is the text of the annotation.
+	Message string
+}
+
+// String returns a as a workflow command, such as
+//
+//	::error file=main.go,line=3,col=8,title=go build::undefined: foo
+func (a Annotation) String() string {
+	var props []string
+	if a.File != "" {
+		props = append(props, "file="+escapeAnnotationProperty(a.File))
+	}
+	if a.Line > 0 {
+		props = append(props, "line="+strconv.Itoa(a.Line))
+	}
+	if a.Col > 0 {
+		props = append(props, "col="+strconv.Itoa(a.Col))
+	}
+	if a.Title != "" {
+		props = append(props, "title="+escapeAnnotationProperty(a.Title))
+	}
+	cmd := "::" + a.Level
+	if len(props) > 0 {
+		cmd += " " + strings.Join(props, ",")
+	}
+	return cmd + "::" + escapeAnnotationData(a.Message)
+}
+
+// WithAnnotations writes annotations for the command to w, if it fails
+// with an *ExitError, as per Annotations, such that failures of commands
+// run in GitHub Actions workflows are displayed inline, in the files they
+// refer to. If w is nil, annotations are written to os.Stdout, where the
+// runner picks them up.
+func WithAnnotations(w io.Writer, patterns ...*regexp.Regexp) Option {
+	return func(cfg *config) {
+		cfg.annotations = &annotationConfig{w: w, patterns: patterns}
+	}
+}
+
+type annotationConfig struct {
+	w        io.Writer
+	patterns []*regexp.Regexp
+}
+
+// annotate writes the annotations for err, if any.
+func (ac *annotationConfig) annotate(err error) {
+	if ac == nil {
+		return
+	}
+	ee, ok := err.(*ExitError)
+	if !ok {
+		return
+	}
+	w := ac.w
+	if w == nil {
+		w = os.Stdout
+	}
+	bw := bufio.NewWriter(w)
+	for _, a := range ee.Annotations(ac.patterns...) {
+		fmt.Fprintln(bw, a)
+	}
+	bw.Flush()
+}
+
+// Annotations derives annotations from the standard error output of the
+// command, using the specified patterns, or DefaultAnnotationPatterns if
+// none are specified. Each line of output which matches a pattern produces
+// an annotation, populated from the named groups "file", "line", "col",
+// "severity", "title" and "message" of the pattern. If there is no group
+// named "message", the whole line is used. Lines whose severity is
+// "warning" or "note" produce warnings and notices, respectively, and all
+// other lines produce errors.
+//
+// If no line matches, Annotations returns a single error annotation
+// holding e.Summary(), such that the failure is reported nevertheless.
+// The title of each annotation is the command line.
+func (e *ExitError) Annotations(patterns ...*regexp.Regexp) []Annotation {
+	if len(patterns) == 0 {
+		patterns = DefaultAnnotationPatterns
+	}
+	title := quoteArgs(e.Args)
+	var as []Annotation
+	for _, line := range bytes.Split(e.stderr(), []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		for _, re := range patterns {
+			if a, ok := matchAnnotation(re, line); ok {
+				if a.Title == "" {
+					a.Title = title
+				}
+				as = append(as, a)
+				break
+			}
+		}
+	}
+	if len(as) == 0 {
+		as = append(as, Annotation{Level: "error", Title: title, Message: e.SummaryWidth(0)})
+	}
+	return as
+}
+
+// matchAnnotation derives an annotation from line, if it matches re.
+func matchAnnotation(re *regexp.Regexp, line []byte) (Annotation, bool) {
+	m := re.FindSubmatch(line)
+	if m == nil {
+		return Annotation{}, false
+	}
+	a := Annotation{Level: "error", Message: string(line)}
+	for i, name := range re.SubexpNames() {
+		if m[i] == nil {
+			continue
+		}
+		v := string(m[i])
+		switch name {
+		case "file":
+			a.File = v
+		case "line":
+			a.Line, _ = strconv.Atoi(v)
+		case "col":
+			a.Col, _ = strconv.Atoi(v)
+		case "title":
+			a.Title = v
+		case "message":
+			a.Message = v
+		case "severity":
+			switch strings.ToLower(v) {
+			case "warning":
+				a.Level = "warning"
+			case "note", "notice", "info":
+				a.Level = "notice"
+			}
+		}
+	}
+	return a, true
+}
+
+var (
+	annotationDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	annotationPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+func escapeAnnotationData(s string) string {
+	return annotationDataEscaper.Replace(s)
+}
+
+func escapeAnnotationProperty(s string) string {
+	return annotationPropertyEscaper.Replace(s)
+}
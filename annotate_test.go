@@ -0,0 +1,85 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithAnnotations(t *testing.T) {
+	script := `printf 'main.go:3:8: undefined: foo\nlint.go:10: warning: unused, really\nbuilding...\n' >&2; exit 2`
+	buf := new(bytes.Buffer)
+	_, err := execx.Run(context.Background(), exec.Command("sh", "-c", script), execx.WithAnnotations(buf))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Skipf("cannot run sh: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d annotations, want 2:\n%s", len(lines), buf)
+	}
+	if want := "::error file=main.go,line=3,col=8,title=sh -c "; !strings.HasPrefix(lines[0], want) {
+		t.Errorf("got %q, want prefix %q", lines[0], want)
+	}
+	if want := "::undefined: foo"; !strings.HasSuffix(lines[0], want) {
+		t.Errorf("got %q, want suffix %q", lines[0], want)
+	}
+	if want := "::warning file=lint.go,line=10,title="; !strings.HasPrefix(lines[1], want) {
+		t.Errorf("got %q, want prefix %q", lines[1], want)
+	}
+	if want := "::unused, really"; !strings.HasSuffix(lines[1], want) {
+		t.Errorf("got %q, want suffix %q", lines[1], want)
+	}
+}
+
+func TestAnnotationsFallback(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	as := ee.Annotations()
+	if len(as) != 1 || as[0].Level != "error" || !strings.HasSuffix(as[0].Message, ": whoops") {
+		t.Fatalf("got %+v, want a single error holding the summary", as)
+	}
+
+	re := regexp.MustCompile(`^(?P<title>who)(?P<message>ops)$`)
+	as = ee.Annotations(re)
+	if len(as) != 1 || as[0].Title != "who" || as[0].Message != "ops" {
+		t.Errorf("got %+v, want title %q and message %q", as, "who", "ops")
+	}
+}
+
+func TestAnnotationString(t *testing.T) {
+	a := execx.Annotation{
+		Level:   "error",
+		File:    "a,b:c.go",
+		Line:    1,
+		Title:   "100%",
+		Message: "first\nsecond",
+	}
+	want := "::error file=a%2Cb%3Ac.go,line=1,title=100%25::first%0Asecond"
+	if got := a.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ArgKind describes what an argument is expected to be, for the purposes
+// of CheckArg and CheckArgs.
+type ArgKind int
+
+// Argument kinds.
+const (
+	// ArgText is an arbitrary argument, such as a commit message. Only
+	// NUL bytes, which cannot be passed to a process, are rejected.
+	ArgText ArgKind = iota
+
+	// ArgFlag is a flag, a flag value, or a program name. NUL bytes
+	// and line breaks are rejected.
+	ArgFlag
+
+	// ArgPath is a file name. NUL bytes and line breaks are rejected,
+	// as are leading dashes, which the program would interpret as a
+	// flag, unless the argument follows a "--" argument.
+	ArgPath
+)
+
+// An ArgError describes an invalid argument.
+type ArgError struct {
+	// Index is the index of the argument in the argument list, or -1
+	// if the argument was checked on its own, by CheckArg.
+	Index int
+
+	// Arg is the invalid argument.
+	Arg string
+
+	// Kind is the kind the argument was expected to be.
+	Kind ArgKind
+
+	// Problem describes what is wrong with the argument.
+	Problem string
+
+	// Suggestion, if not empty, describes how to fix the problem.
+	Suggestion string
+}
+
+func (e *ArgError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("execx: ")
+	if e.Index >= 0 {
+		fmt.Fprintf(&sb, "argument %d ", e.Index)
+	} else {
+		sb.WriteString("argument ")
+	}
+	fmt.Fprintf(&sb, "%q: %s", e.Arg, e.Problem)
+	if e.Suggestion != "" {
+		fmt.Fprintf(&sb, " (%s)", e.Suggestion)
+	}
+	return sb.String()
+}
+
+// ArgsError records the invalid arguments found by CheckArgs.
+type ArgsError struct {
+	// Errs holds an error for each invalid argument, in order.
+	Errs []*ArgError
+}
+
+func (e *ArgsError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// CheckArg checks that arg is valid for the specified kind. If it is not,
+// CheckArg returns an *ArgError whose Index is -1.
+func CheckArg(arg string, kind ArgKind) error {
+	if err := checkArg(-1, arg, kind, false); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckArgs checks args, the arguments of a command, including the program
+// name, before the command is run, such as args built from untrusted
+// input. kinds[i] is the kind of args[i]. Arguments beyond the end of kinds
+// are checked as ArgText, except for the program name, args[0], which is
+// always checked as ArgFlag. If any arguments are invalid, CheckArgs
+// returns an *ArgsError.
+func CheckArgs(args []string, kinds ...ArgKind) error {
+	var errs []*ArgError
+	afterDashes := false
+	for i, arg := range args {
+		kind := ArgText
+		if i < len(kinds) {
+			kind = kinds[i]
+		}
+		if i == 0 && kind == ArgText {
+			kind = ArgFlag
+		}
+		if err := checkArg(i, arg, kind, afterDashes); err != nil {
+			errs = append(errs, err)
+		}
+		if i > 0 && arg == "--" {
+			afterDashes = true
+		}
+	}
+	if len(errs) > 0 {
+		return &ArgsError{Errs: errs}
+	}
+	return nil
+}
+
+// checkArg checks a single argument. afterDashes reports whether the
+// argument follows a "--" argument.
+func checkArg(index int, arg string, kind ArgKind, afterDashes bool) *ArgError {
+	fail := func(problem, suggestion string) *ArgError {
+		return &ArgError{Index: index, Arg: arg, Kind: kind, Problem: problem, Suggestion: suggestion}
+	}
+	if strings.IndexByte(arg, 0) >= 0 {
+		return fail("contains a NUL byte", "")
+	}
+	if kind == ArgText {
+		return nil
+	}
+	if strings.ContainsAny(arg, "\r\n") {
+		return fail("contains a line break", "")
+	}
+	if kind == ArgPath && strings.HasPrefix(arg, "-") && !afterDashes {
+		return fail("looks like a flag, but a path is expected",
+			fmt.Sprintf(`insert "--" before the path arguments, or use "./%s"`, arg))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestCheckArg(t *testing.T) {
+	tests := []struct {
+		arg     string
+		kind    execx.ArgKind
+		problem string
+	}{
+		{"hello\nworld", execx.ArgText, ""},
+		{"nul\x00byte", execx.ArgText, "NUL byte"},
+		{"--message=a\nb", execx.ArgFlag, "line break"},
+		{"-rf", execx.ArgFlag, ""},
+		{"-rf", execx.ArgPath, "looks like a flag"},
+		{"dir/file\r", execx.ArgPath, "line break"},
+		{"./-rf", execx.ArgPath, ""},
+	}
+	for _, tt := range tests {
+		err := execx.CheckArg(tt.arg, tt.kind)
+		if tt.problem == "" {
+			if err != nil {
+				t.Errorf("CheckArg(%q, %v): %v", tt.arg, tt.kind, err)
+			}
+			continue
+		}
+		var ae *execx.ArgError
+		if !errors.As(err, &ae) || !strings.Contains(ae.Problem, tt.problem) || ae.Index != -1 {
+			t.Errorf("CheckArg(%q, %v): got %v, want problem %q", tt.arg, tt.kind, err, tt.problem)
+		}
+	}
+}
+
+func TestCheckArgs(t *testing.T) {
+	args := []string{"rm", "-f", "-rf", "--", "-also-a-path", "bad\nname"}
+	err := execx.CheckArgs(args, execx.ArgFlag, execx.ArgFlag, execx.ArgPath, execx.ArgFlag, execx.ArgPath, execx.ArgPath)
+	var ae *execx.ArgsError
+	if !errors.As(err, &ae) {
+		t.Fatalf("got %v, want *ArgsError", err)
+	}
+	if len(ae.Errs) != 2 || ae.Errs[0].Index != 2 || ae.Errs[1].Index != 5 {
+		t.Fatalf("got %v", err)
+	}
+	if want := `insert "--" before the path arguments, or use "./-rf"`; ae.Errs[0].Suggestion != want {
+		t.Errorf("got suggestion %q, want %q", ae.Errs[0].Suggestion, want)
+	}
+	if err := execx.CheckArgs([]string{"prog\n"}); err == nil {
+		t.Errorf("newline in program name accepted")
+	}
+	if err := execx.CheckArgs([]string{"git", "commit", "-m", "multi\nline"}); err != nil {
+		t.Errorf("text argument rejected: %v", err)
+	}
+}
+
+func FuzzCheckArg(f *testing.F) {
+	for _, seed := range []string{"", "-", "--", "-rf", "a\nb", "a\x00b", "./-x"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, arg string) {
+		if execx.CheckArg(arg, execx.ArgText) != nil && !strings.Contains(arg, "\x00") {
+			t.Errorf("text %q rejected", arg)
+		}
+		if execx.CheckArg(arg, execx.ArgPath) == nil {
+			if strings.ContainsAny(arg, "\x00\r\n") || strings.HasPrefix(arg, "-") {
+				t.Errorf("path %q accepted", arg)
+			}
+		}
+		if execx.CheckArgs([]string{"prog", "--", arg}, execx.ArgFlag, execx.ArgFlag, execx.ArgPath) == nil {
+			if strings.ContainsAny(arg, "\x00\r\n") {
+				t.Errorf("path %q accepted after --", arg)
+			}
+		}
+	})
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+// WithArgv0 presents name to the program as its argv[0], rather than the
+// name the program was invoked by, by setting cmd.Args[0] before the
+// command starts. Multiplexers such as busybox behave according to
+// argv[0]. The executable is still located using the original name, such
+// that WithResolver and $PATH lookups are unaffected.
+//
+// Errors produced by the command describe both the invoked path and the
+// presented argv[0], as in "busybox (as ls) -l".
+func WithArgv0(name string) Option {
+	return func(cfg *config) {
+		cfg.argv0 = name
+	}
+}
+
+// applyArgv0 sets the argv[0] of h.cmd to the configured name.
+func (h *Handle) applyArgv0() {
+	cmd := h.cmd
+	if len(cmd.Args) == 0 {
+		cmd.Args = []string{h.cfg.argv0}
+		return
+	}
+	cmd.Args = append([]string{h.cfg.argv0}, cmd.Args[1:]...)
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithArgv0(t *testing.T) {
+	cmd := selfCmd("on")
+	_, err := execx.Run(context.Background(), cmd, execx.WithArgv0("multiplexed"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Args[0] != "multiplexed" {
+		t.Errorf("got argv[0] %q, want %q", ee.Args[0], "multiplexed")
+	}
+	want := filepath.Base(cmd.Path) + " (as multiplexed)"
+	if got := ee.Cmdline(); got != want {
+		t.Errorf("got cmdline %q, want %q", got, want)
+	}
+}
+
+func TestCmdlineArgv0(t *testing.T) {
+	tests := []struct {
+		path string
+		args []string
+		want string
+	}{
+		{"/usr/bin/go", []string{"go", "test"}, "go test"},
+		{"/usr/bin/go", []string{"/usr/bin/go", "test"}, "go test"},
+		{"/bin/busybox", []string{"ls", "-l"}, "busybox (as ls) -l"},
+		{"/bin/busybox", nil, "busybox"},
+	}
+	for _, tt := range tests {
+		cmd := &exec.Cmd{Path: tt.path, Args: tt.args}
+		if got := execx.Cmdline(cmd); got != tt.want {
+			t.Errorf("Cmdline(%q, %q): got %q, want %q", tt.path, tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An AskpassFunc answers a prompt for credentials, such as "Password for
+// 'https://user@example.com': ", printed by a command run using
+// WithAskpass. If it returns an error, the prompt is declined.
+type AskpassFunc func(ctx context.Context, prompt string) (string, error)
+
+// An AskpassPrompt records a prompt which was answered by the AskpassFunc
+// passed to WithAskpass. The answer itself is never recorded.
+type AskpassPrompt struct {
+	// Prompt is the prompt, with newlines replaced by spaces.
+	Prompt string
+
+	// Time is the time the prompt was received.
+	Time time.Time
+
+	// Answered reports whether the prompt was answered, as opposed to
+	// declined.
+	Answered bool
+}
+
+func (p AskpassPrompt) String() string {
+	if p.Answered {
+		return fmt.Sprintf("%q answered", p.Prompt)
+	}
+	return fmt.Sprintf("%q declined", p.Prompt)
+}
+
+// askpassVars lists the variables which name the askpass helper of
+// programs which use one: OpenSSH, Git and sudo -A, respectively.
+var askpassVars = []string{"SSH_ASKPASS", "GIT_ASKPASS", "SUDO_ASKPASS"}
+
+// WithAskpass answers the prompts for credentials of the command using
+// fn, such that the command never needs a terminal. WithAskpass generates
+// a one-shot askpass helper, which forwards its prompt to fn, and prints
+// the answer, and points SSH_ASKPASS, GIT_ASKPASS and SUDO_ASKPASS at it.
+// It also sets SSH_ASKPASS_REQUIRE to "force", such that OpenSSH uses the
+// helper even if a terminal is available. The helper is removed once the
+// command completes.
+//
+// fn is called with the context passed to Start, one prompt at a time.
+// Answers must not contain newlines. The prompts, but not the answers,
+// are recorded in Result.AskpassPrompts, in the transcripts written by
+// Recorder, and as a []AskpassPrompt detail named "askpass_prompts" in
+// errors produced by the command.
+//
+// WithAskpass requires named pipes and a POSIX shell, and fails to start
+// the command on other platforms.
+func WithAskpass(fn AskpassFunc) Option {
+	src := envCaller(EnvExplicit)
+	return func(cfg *config) {
+		cfg.askpass = fn
+		cfg.askpassSrc = src
+	}
+}
+
+// askpassServer answers the prompts of an askpass helper.
+type askpassServer struct {
+	fn     AskpassFunc
+	clock  Clock
+	prompt *os.File // prompts written by the helper
+	answer *os.File // answers read by the helper
+	res    *Tracked // the directory holding the helper and the pipes
+	done   chan struct{}
+
+	mu      sync.Mutex
+	prompts []AskpassPrompt
+}
+
+// askpassScript is the askpass helper. The helpers started concurrently
+// take turns, since they share the pipes. The parent holds both pipes
+// open for reading and writing, such that opening them never blocks.
+const askpassScript = `#!/bin/sh
+# Generated by execx.WithAskpass.
+dir=%s
+until mkdir "$dir/lock" 2>/dev/null; do sleep 0.1; done
+trap 'rmdir "$dir/lock"' EXIT
+exec 3<"$dir/answer"
+{ printf '%%s' "$*" | tr '\n' ' '; echo; } >"$dir/prompt"
+IFS= read -r reply <&3 || exit 1
+case $reply in
++*) printf '%%s\n' "${reply#+}" ;;
+*) exit 1 ;;
+esac
+`
+
+// openAskpass creates the askpass helper for WithAskpass, starts serving
+// its prompts, and points the environment of the command at it.
+func (h *Handle) openAskpass(ctx context.Context) error {
+	dir, err := ioutil.TempDir("", "execx-askpass-")
+	if err != nil {
+		return wrapStart(err, h.cmd, h.cfg.collectors)
+	}
+	a := &askpassServer{
+		fn:    h.cfg.askpass,
+		clock: h.clock,
+		res:   h.tracker.Track("askpass", dir, func() error { return os.RemoveAll(dir) }),
+		done:  make(chan struct{}),
+	}
+	fail := func(err error) error {
+		close(a.done)
+		a.close()
+		return wrapStart(err, h.cmd, h.cfg.collectors)
+	}
+	for _, name := range []string{"prompt", "answer"} {
+		path := filepath.Join(dir, name)
+		if err := mkfifo(path); err != nil {
+			return fail(err)
+		}
+		f, err := openNonblock(path, os.O_RDWR)
+		if err != nil {
+			return fail(err)
+		}
+		if name == "prompt" {
+			a.prompt = f
+		} else {
+			a.answer = f
+		}
+	}
+	helper := filepath.Join(dir, "askpass")
+	script := fmt.Sprintf(askpassScript, shellQuote(dir))
+	if err := ioutil.WriteFile(helper, []byte(script), 0700); err != nil {
+		return fail(err)
+	}
+	go a.serve(ctx, h.internal)
+	h.askpass = a
+	settings := []envSetting{{key: "SSH_ASKPASS_REQUIRE", value: "force", src: h.cfg.askpassSrc}}
+	for _, key := range askpassVars {
+		settings = append(settings, envSetting{key: key, value: helper, src: h.cfg.askpassSrc})
+	}
+	h.cfg.env = append(settings, h.cfg.env...)
+	return nil
+}
+
+// serve answers prompts until the prompt pipe is closed.
+func (a *askpassServer) serve(ctx context.Context, ie *internalErrors) {
+	defer close(a.done)
+	defer ie.catch("serve askpass")
+	sc := bufio.NewScanner(a.prompt)
+	for sc.Scan() {
+		p := AskpassPrompt{Prompt: strings.TrimSpace(sc.Text()), Time: a.clock.Now()}
+		reply := "-"
+		answer, err := a.fn(ctx, p.Prompt)
+		if err == nil && !strings.ContainsAny(answer, "\r\n") {
+			reply = "+" + answer
+			p.Answered = true
+		}
+		a.mu.Lock()
+		a.prompts = append(a.prompts, p)
+		a.mu.Unlock()
+		io.WriteString(a.answer, reply+"\n")
+	}
+}
+
+// close stops serving prompts, and removes the helper.
+func (a *askpassServer) close() {
+	if a.prompt != nil {
+		a.prompt.Close()
+	}
+	<-a.done
+	if a.answer != nil {
+		a.answer.Close()
+	}
+	a.res.Release()
+}
+
+// closeAskpass stops serving the prompts of the askpass helper, if any,
+// and returns the prompts which were answered.
+func (h *Handle) closeAskpass() []AskpassPrompt {
+	if h.askpass == nil {
+		return nil
+	}
+	h.askpass.close()
+	h.askpass.mu.Lock()
+	defer h.askpass.mu.Unlock()
+	return h.askpass.prompts
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithAskpass(t *testing.T) {
+	answers := map[string]string{
+		"Password for 'https://example.com':":  "hunter2",
+		"Enter passphrase for key id_ed25519:": "correct horse",
+	}
+	askpass := func(ctx context.Context, prompt string) (string, error) {
+		if a, ok := answers[prompt]; ok {
+			return a, nil
+		}
+		return "", errors.New("unknown prompt")
+	}
+	script := `echo "$SSH_ASKPASS_REQUIRE"
+"$GIT_ASKPASS" "Password for 'https://example.com': "
+"$SSH_ASKPASS" "Enter passphrase
+for key id_ed25519:"
+"$SUDO_ASKPASS" "[sudo] password:" || echo declined`
+	tr := new(execx.ResourceTracker)
+	ctx := execx.WithResourceTracker(context.Background(), tr)
+	rec := new(execx.Recorder)
+	res, err := rec.Run(ctx, exec.Command("sh", "-c", script), execx.WithAskpass(askpass))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "force\nhunter2\ncorrect horse\ndeclined\n"; string(res.Stdout) != want {
+		t.Errorf("got stdout %q, want %q", res.Stdout, want)
+	}
+	want := []struct {
+		prompt   string
+		answered bool
+	}{
+		{"Password for 'https://example.com':", true},
+		{"Enter passphrase for key id_ed25519:", true},
+		{"[sudo] password:", false},
+	}
+	if len(res.AskpassPrompts) != len(want) {
+		t.Fatalf("got prompts %v, want %d", res.AskpassPrompts, len(want))
+	}
+	for i, p := range res.AskpassPrompts {
+		if p.Prompt != want[i].prompt || p.Answered != want[i].answered {
+			t.Errorf("prompt %d: got %v, want %q (answered %t)", i, p, want[i].prompt, want[i].answered)
+		}
+	}
+	if live := tr.Live(); len(live) != 0 {
+		t.Errorf("askpass helper not removed: %v", live)
+	}
+	var buf bytes.Buffer
+	if err := rec.WriteShell(&buf); err != nil {
+		t.Fatal(err)
+	}
+	transcript := buf.String()
+	if !strings.Contains(transcript, `# askpass prompt "[sudo] password:" declined`) {
+		t.Errorf("prompts missing from transcript:\n%s", transcript)
+	}
+	for _, a := range answers {
+		if strings.Contains(transcript, a) {
+			t.Errorf("answer %q recorded in transcript:\n%s", a, transcript)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// AsUser runs the command as the specified user, dropping the privileges
+// of the parent process. At start, the user ID, the primary group ID and
+// the supplementary groups of the user are resolved, and applied using
+// SysProcAttr.Credential, and HOME, USER and LOGNAME are set in the
+// environment of the command, unless they are set by WithEnv. If the user
+// cannot be resolved, the command fails to start, with a *StartError
+// wrapping a *UserError.
+//
+// If the command fails, the identity it ran as is recorded as an
+// *Identity detail named "identity" in the *ExitError.
+//
+// Changing the identity of a process usually requires privileges, such as
+// those of root. AsUser is not supported on Windows.
+func AsUser(username string) Option {
+	src := envCaller(EnvUser)
+	return func(cfg *config) {
+		cfg.asUser = username
+		cfg.asUserSrc = src
+	}
+}
+
+// An Identity is the identity a command runs as.
+type Identity struct {
+	// Username is the name of the user.
+	Username string
+
+	// UID and GID are the user ID and the primary group ID.
+	UID uint32
+	GID uint32
+
+	// Groups holds the IDs of the supplementary groups.
+	Groups []uint32
+
+	// Home is the home directory of the user.
+	Home string
+}
+
+// String returns a description of id, such as
+//
+//	alice (uid=1000 gid=1000 groups=1000,27)
+func (id *Identity) String() string {
+	groups := make([]string, 0, len(id.Groups))
+	for _, g := range id.Groups {
+		groups = append(groups, strconv.FormatUint(uint64(g), 10))
+	}
+	return fmt.Sprintf("%s (uid=%d gid=%d groups=%s)", id.Username, id.UID, id.GID, strings.Join(groups, ","))
+}
+
+// UserError records a failure to resolve the identity of a user for
+// AsUser.
+type UserError struct {
+	// Username is the name of the user.
+	Username string
+
+	// Op is the operation which failed, such as "lookup user", or
+	// "lookup groups".
+	Op string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *UserError) Error() string {
+	return fmt.Sprintf("execx: AsUser %q: %s: %v", e.Username, e.Op, e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *UserError) Unwrap() error {
+	return e.Err
+}
+
+// lookupIdentity resolves the identity of the user with the specified
+// name.
+func lookupIdentity(username string) (*Identity, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil, &UserError{Username: username, Op: "lookup user", Err: err}
+	}
+	id := &Identity{Username: u.Username, Home: u.HomeDir}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, &UserError{Username: username, Op: "parse uid", Err: err}
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, &UserError{Username: username, Op: "parse gid", Err: err}
+	}
+	id.UID, id.GID = uint32(uid), uint32(gid)
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, &UserError{Username: username, Op: "lookup groups", Err: err}
+	}
+	for _, g := range gids {
+		n, err := strconv.ParseUint(g, 10, 32)
+		if err != nil {
+			return nil, &UserError{Username: username, Op: "parse groups", Err: err}
+		}
+		id.Groups = append(id.Groups, uint32(n))
+	}
+	return id, nil
+}
+
+// applyUser resolves the identity configured by AsUser, and applies it to
+// h.cmd.
+func (h *Handle) applyUser() error {
+	id, err := lookupIdentity(h.cfg.asUser)
+	if err == nil {
+		err = applyCredential(h.cmd, id)
+	}
+	if err != nil {
+		return wrapStart(err, h.cmd, h.cfg.collectors)
+	}
+	src := h.cfg.asUserSrc
+	settings := []envSetting{
+		{key: "HOME", value: id.Home, src: src},
+		{key: "USER", value: id.Username, src: src},
+		{key: "LOGNAME", value: id.Username, src: src},
+	}
+	// Settings made using WithEnv come later, and take precedence.
+	h.cfg.env = append(settings, h.cfg.env...)
+	h.identity = id
+	return nil
+}
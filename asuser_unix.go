@@ -0,0 +1,38 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// applyCredential configures cmd to run as id.
+func applyCredential(cmd *exec.Cmd, id *Identity) error {
+	attr := new(syscall.SysProcAttr)
+	if cmd.SysProcAttr != nil {
+		attr = copySysProcAttr(cmd.SysProcAttr)
+	}
+	attr.Credential = &syscall.Credential{
+		Uid:    id.UID,
+		Gid:    id.GID,
+		Groups: append([]uint32(nil), id.Groups...),
+	}
+	cmd.SysProcAttr = attr
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestAsUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing identity requires root")
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skipf("no unprivileged user: %v", err)
+	}
+	cmd := exec.Command("/bin/sh", "-c", `echo "$(id -u) $HOME $USER $LOGNAME"; exit 1`)
+	cmd.Dir = "/"
+	_, err = execx.Run(context.Background(), cmd, execx.AsUser("nobody"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	want := fmt.Sprintf("%s %s nobody nobody\n", u.Uid, u.HomeDir)
+	if got := string(ee.Result.Stdout); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	v, ok := ee.Detail("identity")
+	if !ok {
+		t.Fatal("identity not recorded")
+	}
+	id := v.(*execx.Identity)
+	if fmt.Sprint(id.UID) != u.Uid || fmt.Sprint(id.GID) != u.Gid {
+		t.Errorf("got identity %v", id)
+	}
+	if src := ee.EnvSources["HOME"]; src.Origin != execx.EnvUser || !strings.HasSuffix(src.File, "asuser_unix_test.go") {
+		t.Errorf("got HOME source %v", src)
+	}
+}
+
+func TestAsUserWithEnv(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing identity requires root")
+	}
+	cmd := exec.Command("/bin/sh", "-c", `echo "$HOME"`)
+	cmd.Dir = "/"
+	res, err := execx.Run(context.Background(), cmd, execx.AsUser("nobody"), execx.WithEnv("HOME", "/tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Stdout); got != "/tmp\n" {
+		t.Errorf("got HOME %q, want %q", got, "/tmp\n")
+	}
+}
+
+func TestAsUserUnknown(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("echo"), execx.AsUser("execx-nonexistent-user"))
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+	var ue *execx.UserError
+	if !errors.As(err, &ue) {
+		t.Fatalf("got %v, want *UserError", err)
+	}
+	if ue.Username != "execx-nonexistent-user" || ue.Op != "lookup user" {
+		t.Errorf("got %+v", ue)
+	}
+}
+
+func TestAsUserWorkDir(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing identity requires root")
+	}
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skipf("no unprivileged user: %v", err)
+	}
+	dir := tempDir(t)
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("/bin/true")
+	cmd.Dir = dir
+	_, err = execx.Run(context.Background(), cmd, execx.AsUser("nobody"))
+	var wde *execx.WorkDirError
+	if !errors.As(err, &wde) || wde.Problem != "is not accessible" {
+		t.Fatalf("got %v, want inaccessible *WorkDirError", err)
+	}
+	if fmt.Sprint(wde.UID) != u.Uid {
+		t.Errorf("got uid %d, want %s", wde.UID, u.Uid)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// attachBacklog is the amount of recent output kept for Attach.
+const attachBacklog = 64 << 10
+
+// Attach returns a reader of the combined standard output and standard
+// error of the command: the most recent output written so far, up to
+// 64KB, followed by the output written from then on, as it is written.
+// Reads block until more output is available. The reader returns io.EOF
+// once the output of the command has been read to the end, or ctx.Err()
+// once ctx is done. If the reader falls behind the command by more than
+// the backlog, the output it missed is skipped.
+//
+// Attach allows observing commands which are already running, such as
+// from a debug HTTP endpoint. Only output which flows through pipes
+// serviced by execx can be observed: output written directly to files,
+// or moved using splice(2), is not.
+func (h *Handle) Attach(ctx context.Context) io.Reader {
+	return h.attach.reader(ctx)
+}
+
+// attachLog records the recent output of a command for Attach.
+type attachLog struct {
+	mu     sync.Mutex
+	buf    []byte        // holds bytes [off-len(buf), off) of the output
+	off    int64         // number of bytes written so far
+	closed bool          // the output has been read to the end
+	wake   chan struct{} // closed when more output arrives, or on close
+}
+
+func newAttachLog() *attachLog {
+	return &attachLog{wake: make(chan struct{})}
+}
+
+// Write records p. It never fails.
+func (l *attachLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	l.off += int64(len(p))
+	if len(l.buf) > 2*attachBacklog {
+		// Keep the backlog, and let the rest be collected.
+		l.buf = append([]byte(nil), l.buf[len(l.buf)-attachBacklog:]...)
+	}
+	close(l.wake)
+	l.wake = make(chan struct{})
+	return len(p), nil
+}
+
+// close marks the end of the output.
+func (l *attachLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.wake)
+	}
+}
+
+func (l *attachLog) reader(ctx context.Context) io.Reader {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	start := l.off - int64(len(l.buf))
+	if backlog := l.off - attachBacklog; backlog > start {
+		start = backlog
+	}
+	return &attachReader{l: l, ctx: ctx, pos: start}
+}
+
+// attachReader reads from an attachLog, starting at pos.
+type attachReader struct {
+	l   *attachLog
+	ctx context.Context
+	pos int64
+}
+
+func (r *attachReader) Read(p []byte) (int, error) {
+	for {
+		r.l.mu.Lock()
+		first := r.l.off - int64(len(r.l.buf))
+		if r.pos < first {
+			r.pos = first
+		}
+		if r.pos < r.l.off {
+			n := copy(p, r.l.buf[r.pos-first:])
+			r.pos += int64(n)
+			r.l.mu.Unlock()
+			return n, nil
+		}
+		closed, wake := r.l.closed, r.l.wake
+		r.l.mu.Unlock()
+		if closed {
+			return 0, io.EOF
+		}
+		select {
+		case <-wake:
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		}
+	}
+}
+
+// recent returns a copy of the last n bytes of output, at most.
+func (l *attachLog) recent(n int) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.buf
+	if len(b) > n {
+		b = b[len(b)-n:]
+	}
+	return append([]byte(nil), b...)
+}
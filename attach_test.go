@@ -0,0 +1,88 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestAttach(t *testing.T) {
+	t.Run("Live", testAttachLive)
+	t.Run("Canceled", testAttachCanceled)
+}
+
+func testAttachLive(t *testing.T) {
+	pr, pw := io.Pipe()
+	cmd := selfCmd("echo")
+	cmd.Stdin = pr
+	h, err := execx.Start(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Write([]byte("before\n"))
+	// Wait for the output to be seen, such that it is in the backlog.
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(readAvailable(h), "before") {
+		if time.Now().After(deadline) {
+			t.Fatal("output not observed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	r := h.Attach(context.Background())
+	pw.Write([]byte("after\n"))
+	pw.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Standard output and standard error are interleaved.
+	for _, want := range []string{"before\n", "after\n", "echoed"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("got %q, want it to contain %q", got, want)
+		}
+	}
+	h.Wait()
+}
+
+// readAvailable returns the output of h available without blocking.
+func readAvailable(h *execx.Handle) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b, _ := ioutil.ReadAll(h.Attach(ctx))
+	return string(b)
+}
+
+func testAttachCanceled(t *testing.T) {
+	h, err := execx.Start(context.Background(), selfCmd("hang"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Wait()
+	defer h.Stop(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = ioutil.ReadAll(h.Attach(ctx))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
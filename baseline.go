@@ -0,0 +1,121 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"acln.ro/env"
+)
+
+// baselineAny is the value which matches any value of a variable in a
+// baseline environment.
+const baselineAny = "*"
+
+// An EnvDiff describes how the environment of a command differs from a
+// baseline environment. Only the names of the variables are recorded,
+// since their values may be sensitive.
+type EnvDiff struct {
+	// Baseline is the path of the baseline file.
+	Baseline string
+
+	// Unexpected holds the variables set for the command, which are
+	// not in the baseline, sorted.
+	Unexpected []string
+
+	// Missing holds the variables in the baseline, which are not set
+	// for the command, sorted.
+	Missing []string
+
+	// Changed holds the variables whose values differ from the values
+	// in the baseline, sorted.
+	Changed []string
+
+	// Err is the error encountered while reading the baseline, if any.
+	// In that case, the other fields are empty.
+	Err error
+}
+
+// Empty reports whether the environment matched the baseline.
+func (d *EnvDiff) Empty() bool {
+	return d.Err == nil && len(d.Unexpected) == 0 && len(d.Missing) == 0 && len(d.Changed) == 0
+}
+
+func (d *EnvDiff) String() string {
+	if d.Err != nil {
+		return fmt.Sprintf("%s: %v", d.Baseline, d.Err)
+	}
+	if d.Empty() {
+		return fmt.Sprintf("%s: no differences", d.Baseline)
+	}
+	var parts []string
+	add := func(label string, keys []string) {
+		if len(keys) > 0 {
+			parts = append(parts, label+" "+strings.Join(keys, ", "))
+		}
+	}
+	add("unexpected", d.Unexpected)
+	add("missing", d.Missing)
+	add("changed", d.Changed)
+	return fmt.Sprintf("%s: %s", d.Baseline, strings.Join(parts, "; "))
+}
+
+// BaselineEnv compares the environment of the command to the baseline
+// environment in the dotenv file at path, such as an env.lock file
+// committed alongside the code, rather than to the environment of the
+// current process, which may be noisy, such as on CI machines. If the
+// command fails, the differences are recorded as an *EnvDiff detail
+// named "env_baseline" in the *ExitError.
+//
+// The baseline is read, as per ReadEnvFile, only if the command fails.
+// A variable whose value in the baseline is "*" matches any value, such
+// that variables which must be set, but whose values vary, such as HOME,
+// are not reported as changed.
+func BaselineEnv(path string) Option {
+	return func(cfg *config) {
+		cfg.envBaseline = path
+	}
+}
+
+// diffBaseline compares child to the baseline environment in the file at
+// path.
+func diffBaseline(path string, child env.Map) *EnvDiff {
+	d := &EnvDiff{Baseline: path}
+	baseline, err := ReadEnvFile(path)
+	if err != nil {
+		d.Err = err
+		return d
+	}
+	for k, v := range child {
+		bv, ok := baseline[k]
+		switch {
+		case !ok:
+			d.Unexpected = append(d.Unexpected, k)
+		case bv != v && bv != baselineAny:
+			d.Changed = append(d.Changed, k)
+		}
+	}
+	for k := range baseline {
+		if _, ok := child[k]; !ok {
+			d.Missing = append(d.Missing, k)
+		}
+	}
+	sort.Strings(d.Unexpected)
+	sort.Strings(d.Missing)
+	sort.Strings(d.Changed)
+	return d
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestBaselineEnv(t *testing.T) {
+	path := filepath.Join(tempDir(t), "env.lock")
+	lock := "# expected environment\nEXECX_TEST=on\nEXECX_LEVEL=info\nEXECX_HOME=*\nEXECX_GONE=1\n"
+	if err := ioutil.WriteFile(path, []byte(lock), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := selfCmd("on")
+	cmd.Env = []string{"EXECX_TEST=on", "EXECX_LEVEL=debug", "EXECX_HOME=/home/ci", "EXECX_NOISE=1"}
+	_, err := execx.Run(context.Background(), cmd, execx.BaselineEnv(path))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	v, ok := ee.Detail("env_baseline")
+	if !ok {
+		t.Fatal("no env_baseline detail")
+	}
+	d := v.(*execx.EnvDiff)
+	got := fmt.Sprint(d.Unexpected, d.Missing, d.Changed)
+	if want := "[EXECX_NOISE] [EXECX_GONE] [EXECX_LEVEL]"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	want := "env_baseline: " + path + ": unexpected EXECX_NOISE; missing EXECX_GONE; changed EXECX_LEVEL\n"
+	if detail := fmt.Sprintf("%+v", ee); !strings.Contains(detail, want) {
+		t.Errorf("%%+v does not contain %q:\n%s", want, detail)
+	}
+}
+
+func TestBaselineEnvMissingFile(t *testing.T) {
+	path := filepath.Join(tempDir(t), "missing.lock")
+	_, err := execx.Run(context.Background(), selfCmd("on"), execx.BaselineEnv(path))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	v, _ := ee.Detail("env_baseline")
+	if d, ok := v.(*execx.EnvDiff); !ok || !errors.Is(d.Err, os.ErrNotExist) {
+		t.Errorf("got env_baseline detail %v", v)
+	}
+}
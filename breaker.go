@@ -0,0 +1,182 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Defaults for CircuitBreaker.
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// A CircuitBreaker is a Runner which stops running commands which fail
+// repeatedly. After Threshold consecutive failures of commands with the
+// same Fingerprint, the circuit for that fingerprint opens: further
+// attempts fail immediately with a *CircuitOpenError, without starting
+// a process, until Cooldown elapses. Then, a single trial run is allowed.
+// If it succeeds, the circuit closes; if it fails, the circuit opens
+// again for another Cooldown.
+//
+// Only failures reported as an *ExitError count towards the threshold.
+// Commands which fail to start, or which are canceled, do not.
+//
+// A CircuitBreaker is safe for concurrent use by multiple goroutines.
+type CircuitBreaker struct {
+	// Runner runs the commands. If Runner is nil, Local is used.
+	Runner Runner
+
+	// Threshold is the number of consecutive failures which opens
+	// a circuit. If Threshold is zero, 5 is used.
+	Threshold int
+
+	// Cooldown is the time a circuit stays open. If Cooldown is zero,
+	// 30 seconds is used.
+	Cooldown time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of the circuit for a command fingerprint.
+type circuit struct {
+	failures int
+	last     *ExitError
+	until    time.Time // while open
+	trial    bool      // a trial run is in progress
+}
+
+// Run runs cmd, unless its circuit is open.
+func (b *CircuitBreaker) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	r := b.Runner
+	if r == nil {
+		r = Local
+	}
+	key := Fingerprint(cmd)
+	clock := ClockFrom(ctx)
+	c, trial, err := b.admit(key, cmd, clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.Run(ctx, cmd, opts...)
+	b.settle(c, trial, err, clock.Now())
+	return res, err
+}
+
+// admit returns the circuit for key, and reports whether the run is a
+// trial run, or returns a *CircuitOpenError if the circuit is open.
+func (b *CircuitBreaker) admit(key string, cmd *exec.Cmd, now time.Time) (*circuit, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.circuits == nil {
+		b.circuits = make(map[string]*circuit)
+	}
+	c, ok := b.circuits[key]
+	if !ok {
+		c = new(circuit)
+		b.circuits[key] = c
+	}
+	if c.failures < b.threshold() {
+		return c, false, nil
+	}
+	if c.trial || now.Before(c.until) {
+		return nil, false, &CircuitOpenError{
+			Cmdline:  Cmdline(cmd),
+			Failures: c.failures,
+			Until:    c.until,
+			Last:     c.last,
+		}
+	}
+	c.trial = true
+	return c, true, nil
+}
+
+// settle records the outcome of a run in c, which completed at now.
+func (b *CircuitBreaker) settle(c *circuit, trial bool, err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if trial {
+		c.trial = false
+	}
+	var ee *ExitError
+	switch {
+	case err == nil:
+		c.failures = 0
+		c.last = nil
+	case errors.As(err, &ee):
+		c.failures++
+		c.last = ee
+		if c.failures >= b.threshold() {
+			c.until = now.Add(b.cooldown())
+		}
+	}
+}
+
+// Reset closes all circuits, and forgets their failures.
+func (b *CircuitBreaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.circuits = nil
+}
+
+func (b *CircuitBreaker) threshold() int {
+	if b.Threshold <= 0 {
+		return defaultBreakerThreshold
+	}
+	return b.Threshold
+}
+
+func (b *CircuitBreaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return defaultBreakerCooldown
+	}
+	return b.Cooldown
+}
+
+// CircuitOpenError is returned by CircuitBreaker.Run if the circuit for
+// a command is open. It unwraps to the *ExitError of the last failure.
+type CircuitOpenError struct {
+	// Cmdline is the command line of the command, as per Cmdline.
+	Cmdline string
+
+	// Failures is the number of consecutive failures of the command.
+	Failures int
+
+	// Until is the time at which the circuit admits a trial run.
+	Until time.Time
+
+	// Last is the error of the last failure of the command.
+	Last *ExitError
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("execx: circuit open for %s after %d consecutive failures, until %s: last failure: %v",
+		e.Cmdline, e.Failures, e.Until.Format(time.RFC3339), e.Last)
+}
+
+// Unwrap returns e.Last.
+func (e *CircuitOpenError) Unwrap() error {
+	if e.Last == nil {
+		return nil
+	}
+	return e.Last
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := &execx.CircuitBreaker{Threshold: 2, Cooldown: 200 * time.Millisecond}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := b.Run(ctx, selfCmd("on"))
+		var ee *execx.ExitError
+		if !errors.As(err, &ee) {
+			t.Fatalf("run %d: got %v, want *ExitError", i, err)
+		}
+	}
+	_, err := b.Run(ctx, selfCmd("on"))
+	var coe *execx.CircuitOpenError
+	if !errors.As(err, &coe) {
+		t.Fatalf("got %v, want *CircuitOpenError", err)
+	}
+	if coe.Failures != 2 {
+		t.Errorf("got %d failures, want 2", coe.Failures)
+	}
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) || string(ee.Stderr) != "whoops" {
+		t.Errorf("last ExitError not embedded: %v", err)
+	}
+
+	// Other commands are not affected.
+	if _, err := b.Run(ctx, selfCmd("echo")); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// After the cooldown, a failed trial run opens the circuit again.
+	time.Sleep(200 * time.Millisecond)
+	if _, err := b.Run(ctx, selfCmd("on")); errors.As(err, &coe) {
+		t.Fatalf("trial run not admitted: %v", err)
+	}
+	if _, err := b.Run(ctx, selfCmd("on")); !errors.As(err, &coe) {
+		t.Fatalf("got %v, want *CircuitOpenError", err)
+	}
+
+	b.Reset()
+	if _, err := b.Run(ctx, selfCmd("on")); errors.As(err, &coe) {
+		t.Fatalf("circuit open after Reset: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package broker runs commands on behalf of a program from a small helper
+// process, started early, when the program is still small.
+//
+// Starting a command forks the parent process. For parents with a large
+// memory footprint, or with many open files, forking is slow, and the
+// memory of the parent may be charged twice until the child calls exec.
+// A broker is a copy of the program, started by Start before it grows,
+// which starts commands on its behalf, and relays their output and exit
+// status back to it, using the protocol implemented by package remote,
+// over a Unix domain socket.
+//
+// The broker is a copy of the executable of the program, which must call
+// Main at the beginning of its main function:
+//
+//	func main() {
+//		broker.Main()
+//		...
+//	}
+//
+// In the broker, Main serves requests, and never returns. In the program
+// itself, Main returns immediately.
+package broker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"acln.ro/execx"
+	"acln.ro/execx/remote"
+)
+
+// envSocket names the environment variable which carries the path of the
+// socket to the broker.
+const envSocket = "EXECX_BROKER_SOCKET"
+
+// readyLine is written by the broker to its standard output once it
+// serves requests.
+const readyLine = "ready"
+
+// Main serves requests, and exits, if the process was started as a broker
+// by Start. Otherwise, Main returns immediately.
+func Main() {
+	path := os.Getenv(envSocket)
+	if path == "" {
+		return
+	}
+	os.Unsetenv(envSocket)
+	if err := serve(path); err != nil {
+		fmt.Fprintf(os.Stderr, "execx/broker: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// serve serves requests on a socket at path, until its standard input,
+// which is connected to the parent, is closed, and the commands which
+// are running complete.
+func serve(path string) error {
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: new(remote.Server)}
+	done := make(chan error, 1)
+	go func() {
+		io.Copy(ioutil.Discard, os.Stdin)
+		done <- srv.Shutdown(context.Background())
+	}()
+	if _, err := fmt.Println(readyLine); err != nil {
+		return err
+	}
+	if err := srv.Serve(ln); err != http.ErrServerClosed {
+		return err
+	}
+	return <-done
+}
+
+// A Broker is an execx.Runner which runs commands in a broker process.
+//
+// Commands are run as per remote.Client: the path, the arguments, the
+// environment, the working directory and the standard input of commands
+// are sent to the broker, and output is written to cmd.Stdout and
+// cmd.Stderr, or captured if they are nil. Commands with a nil Env run
+// with the environment of the program at the time Run is called, and
+// commands with an empty Dir run in the working directory of the program
+// at that time, as if they had been started by the program. Failures are
+// reported using *execx.ExitError and *execx.StartError, as usual.
+// Options passed to Run are ignored.
+//
+// A Broker is safe for concurrent use by multiple goroutines.
+type Broker struct {
+	client *remote.Client
+	cmd    *exec.Cmd
+	stdin  io.Closer
+	dir    string
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Start starts a broker. If ctx is done before the broker is ready, the
+// broker is killed.
+func Start(ctx context.Context) (*Broker, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("execx/broker: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "execx-broker")
+	if err != nil {
+		return nil, fmt.Errorf("execx/broker: %v", err)
+	}
+	path := filepath.Join(dir, "broker.sock")
+	b := &Broker{dir: dir}
+	b.cmd = exec.Command(exe)
+	b.cmd.Env = append(os.Environ(), envSocket+"="+path)
+	b.cmd.Stderr = os.Stderr
+	stdin, err := b.cmd.StdinPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("execx/broker: %v", err)
+	}
+	b.stdin = stdin
+	stdout, err := b.cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("execx/broker: %v", err)
+	}
+	if err := b.cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, execx.Wrap(err, b.cmd)
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		line, err := bufio.NewReader(stdout).ReadString('\n')
+		if err == nil && strings.TrimSpace(line) != readyLine {
+			err = fmt.Errorf("unexpected output %q", line)
+		}
+		if err != nil {
+			err = fmt.Errorf("execx/broker: broker failed to start (is Main called?): %v", err)
+		}
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		b.cmd.Process.Kill()
+		b.Close()
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+	b.client = &remote.Client{
+		URL:        "http://broker/",
+		HTTPClient: &http.Client{Transport: transport},
+	}
+	return b, nil
+}
+
+// Run runs cmd in the broker.
+func (b *Broker) Run(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+	proxy := &exec.Cmd{
+		Path:   cmd.Path,
+		Args:   cmd.Args,
+		Env:    cmd.Env,
+		Dir:    cmd.Dir,
+		Stdin:  cmd.Stdin,
+		Stdout: cmd.Stdout,
+		Stderr: cmd.Stderr,
+	}
+	if proxy.Env == nil {
+		proxy.Env = os.Environ()
+	}
+	if proxy.Dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, &execx.StartError{Err: err, Path: cmd.Path, Args: cmd.Args}
+		}
+		proxy.Dir = wd
+	}
+	res, err := b.client.Run(ctx, proxy, opts...)
+	execx.WithDetail(err, "broker", b.cmd.Process.Pid)
+	return res, err
+}
+
+// Close stops the broker, and waits for it to exit. The broker exits once
+// the commands running in it complete.
+func (b *Broker) Close() error {
+	b.closeOnce.Do(func() {
+		b.stdin.Close()
+		if err := b.cmd.Wait(); err != nil {
+			b.closeErr = execx.Wrap(err, b.cmd)
+		}
+		os.RemoveAll(b.dir)
+	})
+	return b.closeErr
+}
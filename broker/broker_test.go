@@ -0,0 +1,104 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+	"acln.ro/execx/broker"
+)
+
+func TestMain(m *testing.M) {
+	broker.Main()
+	os.Exit(m.Run())
+}
+
+func TestBroker(t *testing.T) {
+	ctx := context.Background()
+	b, err := broker.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := b.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+
+	t.Setenv("BROKER_TEST", "from parent")
+	res, err := b.Run(ctx, exec.Command("sh", "-c", `echo "$BROKER_TEST"; pwd`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if got, want := string(res.Stdout), "from parent\n"+wd+"\n"; got != want {
+		t.Errorf("got stdout %q, want %q", got, want)
+	}
+
+	_, err = b.Run(ctx, exec.Command("sh", "-c", "echo whoops >&2; exit 3"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.ExitCode() != 3 || strings.TrimSpace(string(ee.Stderr)) != "whoops" {
+		t.Errorf("got exit code %d, stderr %q, want 3, %q", ee.ExitCode(), ee.Stderr, "whoops")
+	}
+	if _, ok := ee.Detail("broker"); !ok {
+		t.Errorf("missing broker detail")
+	}
+
+	_, err = b.Run(ctx, exec.Command("/nonexistent/command"))
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Errorf("got %v, want *StartError", err)
+	}
+}
+
+// BenchmarkRun compares running commands locally, and in a broker. The
+// difference is most visible in large parent processes.
+func BenchmarkRun(b *testing.B) {
+	path, err := exec.LookPath("true")
+	if err != nil {
+		b.Skip("no true")
+	}
+	b.Run("Local", func(b *testing.B) {
+		benchmarkRun(b, execx.Local, path)
+	})
+	b.Run("Broker", func(b *testing.B) {
+		br, err := broker.Start(context.Background())
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer br.Close()
+		benchmarkRun(b, br, path)
+	})
+}
+
+func benchmarkRun(b *testing.B, r execx.Runner, path string) {
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Run(context.Background(), exec.Command(path)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Budget limits the cost of the commands started using a context, or
+// contexts derived from it. Commands debit the budget as they start, and
+// as they complete. Once a limit is reached, further commands fail to
+// start, with a *StartError wrapping a *BudgetExceededError.
+//
+// Running commands are not interrupted when the budget is exhausted. To
+// bound individual commands, use WithTimeout.
+//
+// A Budget must not be copied after first use. It is safe for concurrent
+// use by multiple goroutines.
+type Budget struct {
+	// CPU is the total CPU time, user and system, the commands may
+	// consume. Zero means no limit.
+	CPU time.Duration
+
+	// Invocations is the number of commands which may be started.
+	// Zero means no limit.
+	Invocations int
+
+	// Wall is the total wall time the commands may take, summed over
+	// all commands. Zero means no limit.
+	Wall time.Duration
+
+	mu          sync.Mutex
+	invocations int
+	charges     []BudgetCharge
+}
+
+// A BudgetCharge records the cost of a command debited from a Budget.
+type BudgetCharge struct {
+	// Cmdline is the command line of the command.
+	Cmdline string
+
+	// CPU is the CPU time, user and system, the command consumed.
+	CPU time.Duration
+
+	// Wall is the wall time the command took.
+	Wall time.Duration
+}
+
+// String returns a description of c, such as
+//
+//	make -j8 (cpu 12.1s, wall 2.3s)
+func (c BudgetCharge) String() string {
+	return fmt.Sprintf("%s (cpu %v, wall %v)", c.Cmdline, c.CPU, c.Wall)
+}
+
+type budgetKey struct{}
+
+// WithBudget returns a copy of ctx carrying b. Commands started using the
+// returned context, or contexts derived from it, debit b.
+func WithBudget(ctx context.Context, b *Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// budgetFrom returns the budget carried by ctx, if any.
+func budgetFrom(ctx context.Context) *Budget {
+	b, _ := ctx.Value(budgetKey{}).(*Budget)
+	return b
+}
+
+// Charges returns the charges debited from b so far, in the order in
+// which the commands completed.
+func (b *Budget) Charges() []BudgetCharge {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]BudgetCharge(nil), b.charges...)
+}
+
+// Spent returns the number of commands started, and the total CPU and
+// wall time debited from b so far.
+func (b *Budget) Spent() (invocations int, cpu, wall time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cpu, wall = b.spent()
+	return b.invocations, cpu, wall
+}
+
+func (b *Budget) spent() (cpu, wall time.Duration) {
+	for _, c := range b.charges {
+		cpu += c.CPU
+		wall += c.Wall
+	}
+	return cpu, wall
+}
+
+// reserve debits an invocation from b, for the command described by
+// cmdline, or returns a *BudgetExceededError if b is exhausted.
+func (b *Budget) reserve(cmdline string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cpu, wall := b.spent()
+	var resource string
+	var limit, spent interface{}
+	switch {
+	case b.Invocations > 0 && b.invocations >= b.Invocations:
+		resource, limit, spent = "invocations", b.Invocations, b.invocations
+	case b.CPU > 0 && cpu >= b.CPU:
+		resource, limit, spent = "cpu", b.CPU, cpu
+	case b.Wall > 0 && wall >= b.Wall:
+		resource, limit, spent = "wall", b.Wall, wall
+	default:
+		b.invocations++
+		return nil
+	}
+	return &BudgetExceededError{
+		Cmdline:  cmdline,
+		Resource: resource,
+		Limit:    fmt.Sprint(limit),
+		Spent:    fmt.Sprint(spent),
+		Charges:  append([]BudgetCharge(nil), b.charges...),
+	}
+}
+
+// debit debits c from b.
+func (b *Budget) debit(c BudgetCharge) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.charges = append(b.charges, c)
+}
+
+// BudgetExceededError is returned, wrapped in a *StartError, for commands
+// which would start after their Budget was exhausted.
+type BudgetExceededError struct {
+	// Cmdline is the command line of the command which was not started.
+	Cmdline string
+
+	// Resource names the exhausted resource: "invocations", "cpu" or
+	// "wall".
+	Resource string
+
+	// Limit and Spent describe the limit on the resource, and the
+	// amount spent.
+	Limit string
+	Spent string
+
+	// Charges lists the commands which consumed the budget.
+	Charges []BudgetCharge
+}
+
+func (e *BudgetExceededError) Error() string {
+	consumers := make([]string, 0, len(e.Charges))
+	for _, c := range e.Charges {
+		consumers = append(consumers, c.String())
+	}
+	msg := fmt.Sprintf("execx: %s budget exceeded: spent %s of %s", e.Resource, e.Spent, e.Limit)
+	if len(consumers) > 0 {
+		msg += "; consumed by " + strings.Join(consumers, ", ")
+	}
+	return msg
+}
+
+// reserveBudget debits an invocation from the budget carried by ctx, if
+// any.
+func (h *Handle) reserveBudget(ctx context.Context) error {
+	b := budgetFrom(ctx)
+	if b == nil || h.cfg.auxiliary {
+		return nil
+	}
+	if err := b.reserve(Cmdline(h.cmd)); err != nil {
+		return wrapStart(err, h.cmd, h.cfg.collectors)
+	}
+	h.budget = b
+	return nil
+}
+
+// debitBudget debits the cost of the completed command described by res
+// from its budget, if any.
+func (h *Handle) debitBudget(res *Result) {
+	if h.budget == nil {
+		return
+	}
+	c := BudgetCharge{Cmdline: Cmdline(h.cmd), Wall: res.Duration()}
+	if ps := res.ProcessState; ps != nil {
+		c.CPU = ps.UserTime() + ps.SystemTime()
+	}
+	h.budget.debit(c)
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestBudgetInvocations(t *testing.T) {
+	b := &execx.Budget{Invocations: 2}
+	ctx := execx.WithBudget(context.Background(), b)
+	for i := 0; i < 2; i++ {
+		if _, err := execx.Run(ctx, selfCmd("echo")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := execx.Run(ctx, selfCmd("echo"))
+	var bee *execx.BudgetExceededError
+	if !errors.As(err, &bee) {
+		t.Fatalf("got %v, want *BudgetExceededError", err)
+	}
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Errorf("got %T, want *StartError", err)
+	}
+	if bee.Resource != "invocations" || bee.Limit != "2" || bee.Spent != "2" {
+		t.Errorf("got resource %q, limit %s, spent %s", bee.Resource, bee.Limit, bee.Spent)
+	}
+	if len(bee.Charges) != 2 {
+		t.Errorf("got %d charges, want 2", len(bee.Charges))
+	}
+	if !strings.Contains(bee.Error(), "consumed by") {
+		t.Errorf("error does not list the commands which consumed the budget: %v", bee)
+	}
+	if n, _, _ := b.Spent(); n != 2 {
+		t.Errorf("got %d invocations, want 2", n)
+	}
+}
+
+func TestBudgetWall(t *testing.T) {
+	b := &execx.Budget{Wall: time.Nanosecond}
+	ctx := execx.WithBudget(context.Background(), b)
+	if _, err := execx.Run(ctx, selfCmd("echo")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := execx.Run(ctx, selfCmd("echo"))
+	var bee *execx.BudgetExceededError
+	if !errors.As(err, &bee) {
+		t.Fatalf("got %v, want *BudgetExceededError", err)
+	}
+	if bee.Resource != "wall" {
+		t.Errorf("got resource %q, want wall", bee.Resource)
+	}
+	charges := b.Charges()
+	if len(charges) != 1 || charges[0].Wall <= 0 {
+		t.Fatalf("got charges %v", charges)
+	}
+	if charges[0].Cmdline == "" {
+		t.Errorf("charge %v does not identify the command", charges[0])
+	}
+}
+
+func TestBudgetUnlimited(t *testing.T) {
+	b := new(execx.Budget)
+	ctx := execx.WithBudget(context.Background(), b)
+	for i := 0; i < 3; i++ {
+		execx.Run(ctx, selfCmd("on"))
+	}
+	n, cpu, wall := b.Spent()
+	if n != 3 || len(b.Charges()) != 3 {
+		t.Errorf("got %d invocations, %d charges, want 3", n, len(b.Charges()))
+	}
+	if cpu < 0 || wall <= 0 {
+		t.Errorf("got cpu %v, wall %v", cpu, wall)
+	}
+}
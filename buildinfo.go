@@ -0,0 +1,120 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// BuildInfo identifies the build of the current program, the parent of
+// the commands it runs, such that failures reported from the field can be
+// traced back to the build which produced them.
+type BuildInfo struct {
+	// GoVersion is the version of Go the program was built with.
+	GoVersion string
+
+	// Path is the module path of the main package, and Version is the
+	// version of its module, such as "v1.2.3" or "(devel)".
+	Path    string
+	Version string
+
+	// Revision is the VCS revision the program was built from, and
+	// Modified reports whether the working tree had local changes.
+	// Revision is empty if the VCS information is not available.
+	Revision string
+	Modified bool
+
+	// Time is the time of the revision, in RFC 3339 format.
+	Time string
+}
+
+// String returns a description of b, such as
+//
+//	example.com/tool@v1.2.3 (rev 0123456789ab, modified)
+func (b *BuildInfo) String() string {
+	var sb strings.Builder
+	sb.WriteString(b.Path)
+	if b.Version != "" {
+		sb.WriteString("@" + b.Version)
+	}
+	if b.Revision != "" {
+		rev := b.Revision
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		sb.WriteString(" (rev " + rev)
+		if b.Modified {
+			sb.WriteString(", modified")
+		}
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
+var parentBuild struct {
+	once sync.Once
+	b    *BuildInfo
+}
+
+// ParentBuild returns the BuildInfo of the current program, as per
+// debug.ReadBuildInfo, or nil if the program was built without module
+// support. The result is computed once, and shared.
+func ParentBuild() *BuildInfo {
+	parentBuild.once.Do(func() {
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		b := &BuildInfo{
+			GoVersion: bi.GoVersion,
+			Path:      bi.Main.Path,
+			Version:   bi.Main.Version,
+		}
+		if b.Path == "" {
+			b.Path = bi.Path
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Revision = s.Value
+			case "vcs.time":
+				b.Time = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			}
+		}
+		parentBuild.b = b
+	})
+	return parentBuild.b
+}
+
+// BuildInfoCollector is a Collector which attaches the BuildInfo of the
+// current program, as per ParentBuild, as a *BuildInfo detail named
+// "build_info". Register it using RegisterCollector, or use it with
+// WithCollectors, in order to stamp errors with the build of the program
+// which ran the failing command.
+var BuildInfoCollector Collector = CollectorFunc(collectBuildInfo)
+
+func collectBuildInfo(cmd *exec.Cmd, ps *os.ProcessState) (string, interface{}) {
+	b := ParentBuild()
+	if b == nil {
+		return "", nil
+	}
+	return "build_info", b
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestBuildInfoCollector(t *testing.T) {
+	want := execx.ParentBuild()
+	if want == nil {
+		t.Skip("build info not available")
+	}
+	_, err := execx.Run(context.Background(), selfCmd("on"), execx.WithCollectors(execx.BuildInfoCollector))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	got, ok := ee.Detail("build_info")
+	if !ok {
+		t.Fatal("build_info detail not attached")
+	}
+	if got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBuildInfoString(t *testing.T) {
+	b := &execx.BuildInfo{
+		Path:     "example.com/tool",
+		Version:  "v1.2.3",
+		Revision: "0123456789abcdef",
+		Modified: true,
+	}
+	if got, want := b.String(), "example.com/tool@v1.2.3 (rev 0123456789ab, modified)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+)
+
+// maxCallers is the maximum depth of recorded call stacks.
+const maxCallers = 32
+
+// callFrames is the number of frames printed by %+v.
+const callFrames = 5
+
+// callers is a call stack, recorded as program counters, and symbolized
+// only when needed.
+type callers []uintptr
+
+// captureCallers records the call stack of its caller's caller.
+func captureCallers() callers {
+	var pcs [maxCallers]uintptr
+	n := runtime.Callers(3, pcs[:])
+	return append(callers(nil), pcs[:n]...)
+}
+
+// frames symbolizes c, omitting frames inside package execx, such that
+// the first frame is the call site which launched the command.
+func (c callers) frames() []runtime.Frame {
+	if len(c) == 0 {
+		return nil
+	}
+	var frames []runtime.Frame
+	iter := runtime.CallersFrames(c)
+	for {
+		f, more := iter.Next()
+		if !strings.HasPrefix(f.Function, "acln.ro/execx.") {
+			frames = append(frames, f)
+		}
+		if !more {
+			return frames
+		}
+	}
+}
+
+// format writes the top frames of c to w.
+func (c callers) format(w io.Writer, p printer) {
+	frames := c.frames()
+	if len(frames) == 0 {
+		return
+	}
+	if len(frames) > callFrames {
+		frames = frames[:callFrames]
+	}
+	fmt.Fprintf(w, "%s\n", p.sprintf("called from:"))
+	for _, f := range frames {
+		fmt.Fprintf(w, "\t%s\n\t\t%s:%d\n", f.Function, f.File, f.Line)
+	}
+}
+
+// CallSite returns the Go call stack of the call which launched the
+// command, starting at the first frame outside package execx. CallSite
+// returns nil if the call stack was not recorded, such as for errors
+// created by WrapMinimal.
+func (e *ExitError) CallSite() []runtime.Frame {
+	return e.callers.frames()
+}
+
+// CallSite returns the Go call stack of the call which attempted to start
+// the command. See (*ExitError).CallSite.
+func (e *StartError) CallSite() []runtime.Frame {
+	return e.callers.frames()
+}
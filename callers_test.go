@@ -0,0 +1,84 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestCallSite(t *testing.T) {
+	t.Run("Run", testCallSiteRun)
+	t.Run("Wrap", testCallSiteWrap)
+	t.Run("StartError", testCallSiteStartError)
+}
+
+func runFailing() error {
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	return err
+}
+
+func testCallSiteRun(t *testing.T) {
+	ee, ok := runFailing().(*execx.ExitError)
+	if !ok {
+		t.Fatal("command did not fail with *ExitError")
+	}
+	checkCallSite(t, ee.CallSite(), "execx_test.runFailing")
+	if s := fmt.Sprintf("%+v", ee); !strings.Contains(s, "called from:\n\tacln.ro/execx_test.runFailing\n") {
+		t.Errorf("call site missing from %%+v output:\n%s", s)
+	}
+}
+
+func testCallSiteWrap(t *testing.T) {
+	self := selfCmd("on")
+	err := execx.Wrap(self.Run(), self)
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	checkCallSite(t, ee.CallSite(), "execx_test.testCallSiteWrap")
+
+	self = selfCmd("on")
+	ee = execx.WrapMinimal(self.Run(), self).(*execx.ExitError)
+	if frames := ee.CallSite(); frames != nil {
+		t.Errorf("WrapMinimal recorded call site %v", frames)
+	}
+}
+
+func testCallSiteStartError(t *testing.T) {
+	_, err := execx.Run(context.Background(), exec.Command("execx-no-such-command"))
+	se, ok := err.(*execx.StartError)
+	if !ok {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+	checkCallSite(t, se.CallSite(), "execx_test.testCallSiteStartError")
+}
+
+func checkCallSite(t *testing.T, frames []runtime.Frame, want string) {
+	t.Helper()
+
+	if len(frames) == 0 {
+		t.Fatal("no call site recorded")
+	}
+	if !strings.HasSuffix(frames[0].Function, want) {
+		t.Errorf("got call site %s, want %s", frames[0].Function, want)
+	}
+}
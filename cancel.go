@@ -0,0 +1,147 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os/exec"
+	"time"
+
+	"acln.ro/execx/errcode"
+)
+
+// ErrWaitDelay is returned by Wait if the process exits successfully, but
+// its output pipes are not closed before the WaitDelay expires, such as
+// because the process left behind children which hold them open. It is
+// the analogue of exec.ErrWaitDelay. See WithWaitDelay.
+var ErrWaitDelay = newCodedError("execx: WaitDelay expired before I/O complete", errcode.Leaked)
+
+// WithCancel configures the function called to stop the command when its
+// context is done, or when it times out, in place of killing it, as per
+// exec.Cmd.Cancel. For example, WithCancel(Terminate) asks the process to
+// exit gracefully. If cancel returns an error, the process is killed.
+// Otherwise, if a grace period or a WaitDelay is configured, the process
+// is killed if it does not exit within that time.
+//
+// If WithCancel is not used, and cmd.Cancel is set, cmd.Cancel is used.
+// WithCancel takes precedence over WithGracePeriod.
+func WithCancel(cancel func(cmd *exec.Cmd) error) Option {
+	return func(cfg *config) {
+		cfg.cancel = cancel
+	}
+}
+
+// WithWaitDelay bounds the time Wait spends waiting for the output pipes
+// of the command to be closed, after the process exits, as per
+// exec.Cmd.WaitDelay. Once d elapses, the pipes are closed, and the output
+// which processes left behind by the command may still write to them is
+// abandoned. The names of the abandoned streams are recorded in
+// Result.Abandoned and, if the command fails, in a detail named
+// "wait_delay_expired". If the command succeeds, Wait returns
+// ErrWaitDelay.
+//
+// WithWaitDelay also bounds the time the process is given to exit after
+// the cancel function configured by WithCancel returns, if no grace
+// period is configured.
+//
+// If WithWaitDelay is not used, cmd.WaitDelay is used. If d is zero, Wait
+// waits for the pipes indefinitely.
+func WithWaitDelay(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.waitDelay = d
+		cfg.waitDelaySet = true
+	}
+}
+
+// waitDelay returns the WaitDelay configured for the command.
+func (h *Handle) waitDelay() time.Duration {
+	if h.cfg.waitDelaySet {
+		return h.cfg.waitDelay
+	}
+	return cmdWaitDelay(h.cmd)
+}
+
+// cancel stops the process, once its context is done, using the cancel
+// function configured by WithCancel, the grace period configured by
+// WithGracePeriod, or by killing it.
+func (h *Handle) cancel() {
+	cancel := h.cfg.cancel
+	if cancel == nil {
+		cancel = cmdCancel(h.cmd)
+	}
+	if cancel == nil {
+		if h.cfg.grace > 0 {
+			h.Stop(h.cfg.grace)
+		} else {
+			h.kill()
+		}
+		return
+	}
+	if err := cancel(h.cmd); err != nil {
+		h.kill()
+		return
+	}
+	grace := h.cfg.grace
+	if grace <= 0 {
+		grace = h.waitDelay()
+	}
+	if grace <= 0 {
+		return
+	}
+	t := h.clock.NewTimer(grace)
+	defer t.Stop()
+	select {
+	case <-h.exited:
+	case <-t.C():
+		h.kill()
+	}
+}
+
+// awaitOutputs waits for the output streams of the process to be read
+// to the end. If the WaitDelay expires first, awaitOutputs closes the
+// streams which are still open, and returns their names.
+func (h *Handle) awaitOutputs() []string {
+	delay := h.waitDelay()
+	if delay <= 0 {
+		for _, s := range h.outputs {
+			<-s.done
+		}
+		return nil
+	}
+	t := h.clock.NewTimer(delay)
+	defer t.Stop()
+	var abandoned []string
+	expired := false
+	for _, s := range h.outputs {
+		if !expired {
+			select {
+			case <-s.done:
+				continue
+			case <-t.C():
+				expired = true
+			}
+		}
+		select {
+		case <-s.done:
+			continue
+		default:
+		}
+		// Closing the read end unblocks the copying goroutine, as the
+		// pipe is serviced by the runtime poller.
+		s.r.Close()
+		<-s.done
+		abandoned = append(abandoned, s.name)
+	}
+	return abandoned
+}
@@ -0,0 +1,37 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build go1.20
+// +build go1.20
+
+package execx
+
+import (
+	"os/exec"
+	"time"
+)
+
+// cmdCancel returns cmd.Cancel as a cancel function, or nil if it is not
+// set.
+func cmdCancel(cmd *exec.Cmd) func(*exec.Cmd) error {
+	if cmd.Cancel == nil {
+		return nil
+	}
+	return func(*exec.Cmd) error { return cmd.Cancel() }
+}
+
+// cmdWaitDelay returns cmd.WaitDelay.
+func cmdWaitDelay(cmd *exec.Cmd) time.Duration {
+	return cmd.WaitDelay
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWithCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on SIGTERM")
+	}
+	t.Run("Terminate", testWithCancelTerminate)
+	t.Run("Escalate", testWithCancelEscalate)
+}
+
+func testWithCancelTerminate(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("sigterm"),
+		execx.WithTimeout(300*time.Millisecond),
+		execx.WithCancel(execx.Terminate))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	if ee.ExitCode() != 3 || string(ee.Stderr) != "terminated" {
+		t.Fatalf("process didn't exit gracefully: %v", ee)
+	}
+}
+
+func testWithCancelEscalate(t *testing.T) {
+	var called int32
+	_, err := execx.Run(context.Background(), selfCmd("hang"),
+		execx.WithTimeout(100*time.Millisecond),
+		execx.WithWaitDelay(100*time.Millisecond),
+		execx.WithCancel(func(cmd *exec.Cmd) error {
+			atomic.StoreInt32(&called, 1)
+			return execx.Terminate(cmd)
+		}))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	if atomic.LoadInt32(&called) == 0 {
+		t.Error("cancel function not called")
+	}
+	if ee.ExitCode() != -1 {
+		t.Fatalf("process wasn't killed: %v", ee)
+	}
+}
+
+func TestWithWaitDelay(t *testing.T) {
+	res, err := execx.Run(context.Background(), selfCmd("leak-stdout"),
+		execx.WithWaitDelay(100*time.Millisecond))
+	if err != execx.ErrWaitDelay {
+		t.Fatalf("got %v, want ErrWaitDelay", err)
+	}
+	if want := []string{"stdout"}; !reflect.DeepEqual(res.Abandoned, want) {
+		t.Errorf("Abandoned = %q, want %q", res.Abandoned, want)
+	}
+}
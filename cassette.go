@@ -0,0 +1,261 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"sync"
+	"unicode/utf8"
+
+	"acln.ro/execx/errcode"
+)
+
+// CassetteMode is the mode of a Cassette.
+type CassetteMode int
+
+// Cassette modes.
+const (
+	// CassetteRecord runs commands, and records their outputs and exit
+	// codes in the cassette file.
+	CassetteRecord CassetteMode = iota
+
+	// CassetteReplay serves results recorded in the cassette file,
+	// without running commands.
+	CassetteReplay
+)
+
+// ErrNotRecorded is returned, wrapped in a *StartError, by a Cassette in
+// replay mode, for commands which were not recorded.
+var ErrNotRecorded = newCodedError("execx: command not recorded in cassette", errcode.StartFailure)
+
+// A Cassette is a Runner which records command interactions to a file, or
+// replays them from it, such that tests of code which runs commands can be
+// fast and deterministic. Use it with WithRunner or SetDefault.
+//
+// Interactions are keyed by the arguments of the command, cmd.Args. If a
+// command is run multiple times, the recorded interactions are replayed in
+// order, and the last one is replayed once the others are exhausted.
+//
+// In replay mode, the recorded standard output and standard error are
+// written to cmd.Stdout and cmd.Stderr, or returned in the Result if
+// those are nil. Standard input is not recorded, and is not read. If the
+// recorded command failed, Run returns an *ExitError whose Result holds
+// the recorded exit code, but whose process state is not available. Options
+// are ignored.
+type Cassette struct {
+	// Runner runs commands in record mode. If Runner is nil, Local is
+	// used.
+	Runner Runner
+
+	path   string
+	mode   CassetteMode
+	sealer *Sealer
+
+	mu           sync.Mutex
+	interactions []*interaction
+	replayed     map[int]bool
+}
+
+// interaction is a recorded command.
+type interaction struct {
+	Args     []string
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// jsonInteraction is the JSON representation of an interaction. Outputs
+// are stored as strings if they are valid UTF-8, so that cassettes remain
+// readable and reviewable. Otherwise, they are stored base64-encoded.
+type jsonInteraction struct {
+	Args         []string `json:"args"`
+	Stdout       string   `json:"stdout,omitempty"`
+	StdoutBase64 []byte   `json:"stdout_base64,omitempty"`
+	Stderr       string   `json:"stderr,omitempty"`
+	StderrBase64 []byte   `json:"stderr_base64,omitempty"`
+	ExitCode     int      `json:"exit_code"`
+}
+
+// NewCassette returns a Cassette backed by the file at path. In record
+// mode, the file is created, or truncated, when the first command is
+// recorded, and rewritten after every command. In replay mode, the file
+// is read immediately.
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	return NewSealedCassette(path, mode, nil)
+}
+
+// NewSealedCassette is like NewCassette, but the cassette file is sealed
+// using s, such that the recorded outputs, which may hold secrets, are not
+// stored in plaintext. If s is nil, NewSealedCassette is equivalent to
+// NewCassette.
+func NewSealedCassette(path string, mode CassetteMode, s *Sealer) (*Cassette, error) {
+	c := &Cassette{path: path, mode: mode, sealer: s, replayed: make(map[int]bool)}
+	if mode != CassetteReplay {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		if data, err = s.Open(data); err != nil {
+			return nil, fmt.Errorf("execx: cassette %s: %w", path, err)
+		}
+	}
+	var file struct {
+		Interactions []jsonInteraction `json:"interactions"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("execx: cassette %s: %v", path, err)
+	}
+	for _, ji := range file.Interactions {
+		in := &interaction{Args: ji.Args, ExitCode: ji.ExitCode}
+		in.Stdout = decodeOutput(ji.Stdout, ji.StdoutBase64)
+		in.Stderr = decodeOutput(ji.Stderr, ji.StderrBase64)
+		c.interactions = append(c.interactions, in)
+	}
+	return c, nil
+}
+
+// Run records or replays cmd, depending on the mode of c.
+func (c *Cassette) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	if c.mode == CassetteReplay {
+		return c.replay(cmd)
+	}
+	return c.record(ctx, cmd, opts)
+}
+
+// record runs cmd, and records its outputs and exit code.
+func (c *Cassette) record(ctx context.Context, cmd *exec.Cmd, opts []Option) (*Result, error) {
+	r := c.Runner
+	if r == nil {
+		r = Local
+	}
+	var stdout, stderr bytes.Buffer
+	opts = append(opts[:len(opts):len(opts)], WithStdoutWriters(&stdout), WithStderrWriters(&stderr))
+	args := copyStrings(cmd.Args)
+	res, err := r.Run(ctx, cmd, opts...)
+	if res == nil {
+		return res, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, &interaction{
+		Args:     args,
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		ExitCode: res.ExitCode,
+	})
+	if serr := c.save(); serr != nil && err == nil {
+		err = serr
+	}
+	return res, err
+}
+
+// save writes the recorded interactions to the cassette file.
+func (c *Cassette) save() error {
+	var file struct {
+		Interactions []jsonInteraction `json:"interactions"`
+	}
+	for _, in := range c.interactions {
+		ji := jsonInteraction{Args: in.Args, ExitCode: in.ExitCode}
+		ji.Stdout, ji.StdoutBase64 = encodeOutput(in.Stdout)
+		ji.Stderr, ji.StderrBase64 = encodeOutput(in.Stderr)
+		file.Interactions = append(file.Interactions, ji)
+	}
+	data, err := json.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if c.sealer != nil {
+		data = c.sealer.Seal(data)
+	}
+	return ioutil.WriteFile(c.path, data, 0644)
+}
+
+// replay serves the next recorded interaction matching cmd.
+func (c *Cassette) replay(cmd *exec.Cmd) (*Result, error) {
+	in := c.next(cmd.Args)
+	if in == nil {
+		return nil, wrapStart(fmt.Errorf("%w: %s", ErrNotRecorded, c.path), cmd, nil)
+	}
+	res := &Result{Path: cmd.Path, Args: cmd.Args, Dir: cmd.Dir, ExitCode: in.ExitCode}
+	if cmd.Stdout != nil {
+		cmd.Stdout.Write(in.Stdout)
+	} else {
+		res.Stdout = in.Stdout
+	}
+	if cmd.Stderr != nil {
+		cmd.Stderr.Write(in.Stderr)
+	} else {
+		res.Stderr = in.Stderr
+	}
+	if in.ExitCode == 0 {
+		return res, nil
+	}
+	ee := &ExitError{
+		ExitError: &exec.ExitError{Stderr: res.Stderr},
+		Path:      cmd.Path,
+		Args:      cmd.Args,
+		Result:    res,
+	}
+	ee.Dir, ee.ParentEnv, ee.ChildEnv = describe(cmd)
+	return res, ee
+}
+
+// next returns the next interaction recorded for args, or nil if there
+// is none.
+func (c *Cassette) next(args []string) *interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := -1
+	for i, in := range c.interactions {
+		if !equalStrings(in.Args, args) {
+			continue
+		}
+		if !c.replayed[i] {
+			c.replayed[i] = true
+			return in
+		}
+		last = i
+	}
+	if last < 0 {
+		return nil
+	}
+	return c.interactions[last]
+}
+
+func encodeOutput(b []byte) (string, []byte) {
+	if utf8.Valid(b) {
+		return string(b), nil
+	}
+	return "", b
+}
+
+func decodeOutput(s string, b64 []byte) []byte {
+	if b64 != nil {
+		return b64
+	}
+	if s == "" {
+		return nil
+	}
+	return []byte(s)
+}
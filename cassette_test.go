@@ -0,0 +1,104 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestCassette(t *testing.T) {
+	path := filepath.Join(tempDir(t), "cassette.json")
+
+	rec, err := execx.NewCassette(path, execx.CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := execx.WithRunner(context.Background(), rec)
+	echo := cassetteCmd("echo")
+	echo.Stdin = strings.NewReader("recorded")
+	if _, err := execx.Run(ctx, echo); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	echo = cassetteCmd("echo")
+	echo.Stdin = strings.NewReader("second")
+	echo.Stdout = &stdout
+	if _, err := execx.Run(ctx, echo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execx.Run(ctx, cassetteCmd("on")); err == nil {
+		t.Fatal("failing command succeeded")
+	}
+
+	play, err := execx.NewCassette(path, execx.CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = execx.WithRunner(context.Background(), play)
+
+	for _, want := range []string{"recorded", "second", "second"} {
+		res, err := execx.Run(ctx, cassetteCmd("echo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res.Stdout) != want || string(res.Stderr) != "echoed" {
+			t.Errorf("got stdout %q, stderr %q, want %q, %q", res.Stdout, res.Stderr, want, "echoed")
+		}
+	}
+
+	_, err = execx.Run(ctx, cassetteCmd("on"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.ExitCode() != 1 || string(ee.Stderr) != "whoops" {
+		t.Errorf("got exit code %d, stderr %q", ee.ExitCode(), ee.Stderr)
+	}
+	if got := fmt.Sprintf("%v", ee); !strings.Contains(got, "exit status 1: whoops") {
+		t.Errorf("got %q", got)
+	}
+	if got := fmt.Sprintf("%+v", ee); !strings.Contains(got, "user time: 0s") {
+		t.Errorf("got %q", got)
+	}
+
+	_, err = execx.Run(ctx, cassetteCmd("never-recorded"))
+	if !errors.Is(err, execx.ErrNotRecorded) {
+		t.Errorf("got %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestCassetteMissingFile(t *testing.T) {
+	if _, err := execx.NewCassette(filepath.Join(tempDir(t), "missing.json"), execx.CassetteReplay); err == nil {
+		t.Fatal("opened missing cassette")
+	}
+}
+
+// cassetteCmd returns a command which runs the test binary in the specified
+// mode, with the mode also passed as an argument, such that commands in
+// different modes are recorded separately.
+func cassetteCmd(mode string) *exec.Cmd {
+	cmd := selfCmd(mode)
+	cmd.Args = append(cmd.Args, mode)
+	return cmd
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A Clock tells the time, and measures durations. Commands, and the
+// Scheduler, CircuitBreaker, Recorder, History and ProcessScope, use the
+// Clock carried by their context, such that tests of code which uses them
+// can control the passage of time. See WithClock.
+//
+// Implementations must be safe for concurrent use.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a Timer which fires once d has elapsed.
+	NewTimer(d time.Duration) Timer
+}
+
+// A Timer fires once, after a duration measured by a Clock.
+type Timer interface {
+	// C returns the channel on which the time is delivered when the
+	// Timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the Timer from firing. It reports whether the
+	// Timer was stopped before it fired.
+	Stop() bool
+}
+
+// SystemClock is the Clock provided by package time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.t.C }
+
+func (t systemTimer) Stop() bool { return t.t.Stop() }
+
+type clockKey struct{}
+
+// WithClock returns a copy of ctx carrying c. Commands run using the
+// returned context, or contexts derived from it, use c for their
+// timestamps, for WithTimeout, WithGracePeriod and WithLockTimeout, and
+// for the wait which follows WithStackDump, and for the timestamps of
+// Lines, Progress reports and Confirmations. Scheduler, CircuitBreaker,
+// Recorder, History and the timeout of ProcessScope.Close use c in the
+// same way.
+func WithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// ClockFrom returns the clock carried by ctx, or SystemClock if ctx
+// carries none.
+func ClockFrom(ctx context.Context) Clock {
+	if c, ok := ctx.Value(clockKey{}).(Clock); ok && c != nil {
+		return c
+	}
+	return SystemClock
+}
+
+type randKey struct{}
+
+// WithRand returns a copy of ctx carrying src. The Scheduler uses src for
+// the jitter of Jobs run using the returned context, such that it is
+// reproducible.
+//
+// src need not be safe for concurrent use.
+func WithRand(ctx context.Context, src rand.Source) context.Context {
+	return context.WithValue(ctx, randKey{}, &lockedRand{r: rand.New(src)})
+}
+
+// lockedRand is a rand.Rand which is safe for concurrent use.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// randInt63n returns a random number in [0, n), using the source
+// carried by ctx, or the default source if ctx carries none.
+func randInt63n(ctx context.Context, n int64) int64 {
+	lr, ok := ctx.Value(randKey{}).(*lockedRand)
+	if !ok {
+		return rand.Int63n(n)
+	}
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.r.Int63n(n)
+}
+
+// withClockTimeout is like context.WithTimeout, but measures d using c.
+func withClockTimeout(ctx context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := c.(systemClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	tc := &timeoutCtx{
+		Context:  ctx,
+		deadline: c.Now().Add(d),
+		done:     make(chan struct{}),
+		cancel:   make(chan struct{}),
+	}
+	t := c.NewTimer(d)
+	go func() {
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			tc.finish(ctx.Err())
+		case <-t.C():
+			tc.finish(context.DeadlineExceeded)
+		case <-tc.cancel:
+			tc.finish(context.Canceled)
+		}
+	}()
+	var once sync.Once
+	return tc, func() { once.Do(func() { close(tc.cancel) }) }
+}
+
+// timeoutCtx is a context which is done once a Clock's timer fires.
+type timeoutCtx struct {
+	context.Context
+	deadline time.Time
+	done     chan struct{}
+	cancel   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (tc *timeoutCtx) finish(err error) {
+	tc.mu.Lock()
+	tc.err = err
+	tc.mu.Unlock()
+	close(tc.done)
+}
+
+func (tc *timeoutCtx) Deadline() (time.Time, bool) {
+	if d, ok := tc.Context.Deadline(); ok && d.Before(tc.deadline) {
+		return d, true
+	}
+	return tc.deadline, true
+}
+
+func (tc *timeoutCtx) Done() <-chan struct{} { return tc.done }
+
+func (tc *timeoutCtx) Err() error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.err
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os/exec"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+	"acln.ro/execx/exectest"
+)
+
+var epoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestClockTimeout(t *testing.T) {
+	clock := exectest.NewFakeClock(epoch)
+	ctx := execx.WithClock(context.Background(), clock)
+	h, err := execx.Start(ctx, selfCmd("hang"), execx.WithTimeout(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+
+	res, err := h.Wait()
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if got := res.Timeline.Created; !got.Equal(epoch) {
+		t.Errorf("Timeline.Created = %v, want %v", got, epoch)
+	}
+	if got, want := res.Timeline.Exited, epoch.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("Timeline.Exited = %v, want %v", got, want)
+	}
+}
+
+func TestClockCircuitBreaker(t *testing.T) {
+	clock := exectest.NewFakeClock(epoch)
+	ctx := execx.WithClock(context.Background(), clock)
+	b := &execx.CircuitBreaker{Threshold: 1, Cooldown: time.Minute}
+
+	if _, err := b.Run(ctx, selfCmd("on")); err == nil {
+		t.Fatal("first run succeeded")
+	}
+	_, err := b.Run(ctx, selfCmd("on"))
+	var coe *execx.CircuitOpenError
+	if !errors.As(err, &coe) {
+		t.Fatalf("got %v, want *CircuitOpenError", err)
+	}
+	if want := epoch.Add(time.Minute); !coe.Until.Equal(want) {
+		t.Errorf("Until = %v, want %v", coe.Until, want)
+	}
+
+	clock.Advance(time.Minute)
+	_, err = b.Run(ctx, selfCmd("on"))
+	if errors.As(err, &coe) {
+		t.Fatalf("trial run not admitted after cooldown: %v", err)
+	}
+}
+
+func TestClockSchedulerJitter(t *testing.T) {
+	const jitter = 10 * time.Minute
+	clock := exectest.NewFakeClock(epoch)
+	ctx := execx.WithClock(context.Background(), clock)
+	ctx = execx.WithRand(ctx, rand.NewSource(1))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ran := make(chan struct{}, 1)
+	s := &execx.Scheduler{
+		Runner: execx.RunnerFunc(func(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+			ran <- struct{}{}
+			return nil, nil
+		}),
+	}
+	job := execx.Job{Name: "job", Cmd: exec.Command("true"), Schedule: execx.Every(time.Hour), Jitter: jitter}
+	if err := s.Add(job); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	offset := time.Duration(rand.New(rand.NewSource(1)).Int63n(int64(jitter)))
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour + offset - 1)
+	select {
+	case <-ran:
+		t.Fatal("job ran before its jittered activation time")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Advance(1)
+	select {
+	case <-ran:
+	case <-time.After(10 * time.Second):
+		t.Fatal("job did not run")
+	}
+	cancel()
+	<-done
+
+	runs := s.History("job")
+	if len(runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(runs))
+	}
+	if want := epoch.Add(time.Hour); !runs[0].Scheduled.Equal(want) {
+		t.Errorf("Scheduled = %v, want %v", runs[0].Scheduled, want)
+	}
+	if want := epoch.Add(time.Hour + offset); !runs[0].Start.Equal(want) {
+		t.Errorf("Start = %v, want %v", runs[0].Start, want)
+	}
+}
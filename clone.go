@@ -0,0 +1,70 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os/exec"
+
+	"acln.ro/env"
+)
+
+// Clone returns a fresh, unstarted copy of cmd, which can be run even if
+// cmd has already been run. Clone copies the path, the arguments, the
+// environment, the working directory, and the system-specific process
+// attributes. Standard I/O, extra files, and the state of the process,
+// if any, are not copied.
+func Clone(cmd *exec.Cmd) *exec.Cmd {
+	clone := &exec.Cmd{
+		Path: cmd.Path,
+		Args: copyStrings(cmd.Args),
+		Env:  copyStrings(cmd.Env),
+		Dir:  cmd.Dir,
+		Err:  cmd.Err,
+	}
+	if cmd.SysProcAttr != nil {
+		clone.SysProcAttr = copySysProcAttr(cmd.SysProcAttr)
+	}
+	return clone
+}
+
+// Command returns a fresh, unstarted command equivalent to the one which
+// failed, such that it can be retried. If e was produced by Wrap, the
+// command is a Clone of the original command. Otherwise, it is built from
+// e.Path, e.Args, e.Dir and e.ChildEnv.
+func (e *ExitError) Command() *exec.Cmd {
+	if e.cmd != nil {
+		return Clone(e.cmd)
+	}
+	return commandFrom(e.Path, e.Args, e.Dir, e.ChildEnv)
+}
+
+func commandFrom(path string, args []string, dir string, childEnv env.Map) *exec.Cmd {
+	cmd := &exec.Cmd{
+		Path: path,
+		Args: copyStrings(args),
+		Dir:  dir,
+	}
+	if childEnv != nil {
+		cmd.Env = childEnv.Encode()
+	}
+	return cmd
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s...)
+}
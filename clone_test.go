@@ -0,0 +1,63 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"acln.ro/execx"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClone(t *testing.T) {
+	cmd := exec.Command("git", "status")
+	cmd.Env = []string{"A=b"}
+	cmd.Dir = "/tmp"
+	cmd.SysProcAttr = new(syscall.SysProcAttr)
+	clone := execx.Clone(cmd)
+
+	if clone.SysProcAttr == cmd.SysProcAttr {
+		t.Errorf("SysProcAttr is shared")
+	}
+	clone.Args[1] = "log"
+	clone.Env[0] = "A=c"
+	if cmd.Args[1] != "status" || cmd.Env[0] != "A=b" {
+		t.Errorf("clone shares arguments or environment with original")
+	}
+	if clone.Path != cmd.Path || clone.Dir != cmd.Dir {
+		t.Errorf("path or directory not copied")
+	}
+}
+
+func TestExitErrorCommand(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	ee := err.(*execx.ExitError)
+	retry := ee.Command()
+	if diff := cmp.Diff(retry.Args, ee.Args); diff != "" {
+		t.Fatal(diff)
+	}
+	if retry.Stdout != nil || retry.Stderr != nil || retry.ProcessState != nil {
+		t.Fatalf("clone copied standard I/O or process state")
+	}
+	if _, err := execx.Run(context.Background(), retry); err == nil {
+		t.Fatalf("retry succeeded")
+	} else if _, ok := err.(*execx.ExitError); !ok {
+		t.Fatalf("retry failed with %T, want %T", err, (*execx.ExitError)(nil))
+	}
+}
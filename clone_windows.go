@@ -0,0 +1,33 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import "syscall"
+
+// copySysProcAttr returns a deep copy of attr. Handles and security
+// descriptors are shared between attr and the copy.
+func copySysProcAttr(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	c := *attr
+	if attr.ProcessAttributes != nil {
+		pa := *attr.ProcessAttributes
+		c.ProcessAttributes = &pa
+	}
+	if attr.ThreadAttributes != nil {
+		ta := *attr.ThreadAttributes
+		c.ThreadAttributes = &ta
+	}
+	c.AdditionalInheritedHandles = append([]syscall.Handle(nil), attr.AdditionalInheritedHandles...)
+	return &c
+}
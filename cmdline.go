@@ -0,0 +1,165 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CmdlineQuoted returns the command line invocation equivalent to cmd,
+// as cmd.Args joined by spaces, with arguments quoted such that a POSIX
+// shell, or ParseCmdline, splits the command line back into cmd.Args.
+// Unlike Cmdline, CmdlineQuoted uses cmd.Args[0] rather than cmd.Path.
+// Environment variables and the working directory are not included.
+func CmdlineQuoted(cmd *exec.Cmd) string {
+	return quoteArgs(cmd.Args)
+}
+
+// ParseCmdline splits s into words as per the rules of the POSIX shell,
+// and returns a command which runs the program named by the first word,
+// with the remaining words as arguments, as per exec.Command. It is the
+// inverse of CmdlineQuoted, and is useful for specifying commands as
+// strings in configuration files.
+//
+// Single quotes, double quotes and backslash escapes are interpreted,
+// and words beginning with '#' start a comment. No expansion of any kind
+// is performed: "$HOME" and "*.go" are passed to the program literally.
+// Since ParseCmdline does not implement pipelines, redirections, or
+// command lists, unquoted shell operators, such as '|' or '>', are
+// rejected with an error, rather than passed as arguments.
+func ParseCmdline(s string) (*exec.Cmd, error) {
+	words, err := splitWords(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, errors.New("execx: empty command line")
+	}
+	return exec.Command(words[0], words[1:]...), nil
+}
+
+// shellOperators holds the characters which, unquoted, are shell operators.
+const shellOperators = "|&;<>()`"
+
+// splitWords splits s into words as per the rules of the POSIX shell.
+func splitWords(s string) ([]string, error) {
+	stages, err := splitStages(s, false)
+	if err != nil {
+		return nil, err
+	}
+	return stages[0], nil
+}
+
+// splitStages splits s into words as per the rules of the POSIX shell. If
+// pipes is true, unquoted '|' characters separate the stages of a pipeline,
+// which must not be empty. Otherwise, s holds a single stage.
+func splitStages(s string, pipes bool) ([][]string, error) {
+	var (
+		stages [][]string
+		words  []string
+		word   strings.Builder
+		inWord bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '|' && pipes && !strings.HasPrefix(s[i+1:], "|"):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			if len(words) == 0 {
+				return nil, fmt.Errorf("execx: pipeline %q: empty command", s)
+			}
+			stages = append(stages, words)
+			words = nil
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '#' && !inWord:
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '\\':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("execx: command line %q: trailing backslash", s)
+			}
+			i++
+			if s[i] != '\n' {
+				word.WriteByte(s[i])
+				inWord = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("execx: command line %q: unterminated single quote", s)
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += 1 + end
+			inWord = true
+		case c == '"':
+			n, err := readDoubleQuoted(&word, s[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("execx: command line %q: %v", s, err)
+			}
+			i += n
+			inWord = true
+		case strings.IndexByte(shellOperators, c) >= 0:
+			return nil, fmt.Errorf("execx: command line %q: unsupported shell operator %q", s, c)
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(stages) > 0 && len(words) == 0 {
+		return nil, fmt.Errorf("execx: pipeline %q: empty command", s)
+	}
+	return append(stages, words), nil
+}
+
+// readDoubleQuoted reads the contents of a double-quoted string from s,
+// which follows the opening quote, into word. Within double quotes,
+// backslash only escapes '$', '`', '"', '\' and newline. readDoubleQuoted
+// returns the number of bytes consumed, including the closing quote.
+func readDoubleQuoted(word *strings.Builder, s string) (int, error) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return i + 1, nil
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+				i++
+				if s[i] != '\n' {
+					word.WriteByte(s[i])
+				}
+				continue
+			}
+			word.WriteByte(c)
+		default:
+			word.WriteByte(c)
+		}
+	}
+	return 0, errors.New("unterminated double quote")
+}
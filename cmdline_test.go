@@ -0,0 +1,98 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestParseCmdline(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "go test ./...", want: []string{"go", "test", "./..."}},
+		{in: "  go\ttest \n -v  ", want: []string{"go", "test", "-v"}},
+		{in: `echo 'hello world'`, want: []string{"echo", "hello world"}},
+		{in: `echo "hello  world"`, want: []string{"echo", "hello  world"}},
+		{in: `echo hello\ world`, want: []string{"echo", "hello world"}},
+		{in: `echo "a \"b\" \$c \\ \d"`, want: []string{"echo", `a "b" $c \ \d`}},
+		{in: `echo 'a\b' "it's"`, want: []string{"echo", `a\b`, "it's"}},
+		{in: `echo '' ""`, want: []string{"echo", "", ""}},
+		{in: `echo a'b'"c"d`, want: []string{"echo", "abcd"}},
+		{in: `echo $HOME *.go ~`, want: []string{"echo", "$HOME", "*.go", "~"}},
+		{in: "echo a \\\n b", want: []string{"echo", "a", "b"}},
+		{in: "echo a#b # comment\n c", want: []string{"echo", "a#b", "c"}},
+		{in: `echo "a | b" 'c > d' e\;`, want: []string{"echo", "a | b", "c > d", "e;"}},
+	}
+	for _, tt := range tests {
+		cmd, err := execx.ParseCmdline(tt.in)
+		if err != nil {
+			t.Errorf("ParseCmdline(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(cmd.Args, tt.want) {
+			t.Errorf("ParseCmdline(%q): got %q, want %q", tt.in, cmd.Args, tt.want)
+		}
+	}
+}
+
+func TestParseCmdlineErrors(t *testing.T) {
+	tests := []struct {
+		in      string
+		message string
+	}{
+		{in: "", message: "empty command line"},
+		{in: "  # just a comment", message: "empty command line"},
+		{in: `echo 'oops`, message: "unterminated single quote"},
+		{in: `echo "oops`, message: "unterminated double quote"},
+		{in: `echo oops\`, message: "trailing backslash"},
+		{in: `ls | wc -l`, message: "unsupported shell operator '|'"},
+		{in: `make > log`, message: "unsupported shell operator '>'"},
+		{in: "echo `date`", message: "unsupported shell operator '`'"},
+	}
+	for _, tt := range tests {
+		_, err := execx.ParseCmdline(tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("ParseCmdline(%q): got error %v, want %q", tt.in, err, tt.message)
+		}
+	}
+}
+
+func TestCmdlineQuotedRoundTrip(t *testing.T) {
+	args := [][]string{
+		{"go", "test", "./..."},
+		{"echo", "hello world", "it's", `"quoted"`, `back\slash`, ""},
+		{"sh", "-c", "ls | wc -l > out; echo $HOME `date` #not a comment"},
+		{"printf", "tab\there", "new\nline"},
+	}
+	for _, a := range args {
+		cmd := exec.Command(a[0], a[1:]...)
+		s := execx.CmdlineQuoted(cmd)
+		parsed, err := execx.ParseCmdline(s)
+		if err != nil {
+			t.Errorf("ParseCmdline(%q): %v", s, err)
+			continue
+		}
+		if !reflect.DeepEqual(parsed.Args, a) {
+			t.Errorf("round trip of %q through %q: got %q", a, s, parsed.Args)
+		}
+	}
+}
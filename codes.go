@@ -0,0 +1,220 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import "acln.ro/execx/errcode"
+
+// codedError is an error which carries a fixed code, for sentinel errors.
+type codedError struct {
+	msg  string
+	code errcode.Code
+}
+
+func newCodedError(msg string, code errcode.Code) error {
+	return &codedError{msg: msg, code: code}
+}
+
+func (e *codedError) Error() string      { return e.msg }
+func (e *codedError) Code() errcode.Code { return e.code }
+
+// Code returns the code of the failure, as per the Reason the process
+// exited for, or as per how it exited: errcode.Signaled if it was
+// terminated by a signal, or errcode.NonZeroExit otherwise.
+func (e *ExitError) Code() errcode.Code {
+	switch e.Reason {
+	case ReasonOOMKilled:
+		return errcode.OOMKilled
+	case ReasonOutputMatched:
+		return errcode.OutputMismatch
+	case ReasonExitedBeforeReady:
+		return errcode.StartFailure
+	case ReasonCanceledByCaller:
+		return errcode.Canceled
+	case ReasonTimedOut:
+		return errcode.Timeout
+	}
+	if e.hasState() && e.ExitCode() == -1 {
+		return errcode.Signaled
+	}
+	return errcode.NonZeroExit
+}
+
+// Code returns the code of e.Err, if it carries one, such as
+// errcode.PolicyDenied for ErrNotAllowed, or errcode.StartFailure.
+func (e *StartError) Code() errcode.Code {
+	if code := errcode.Of(e.Err); code != errcode.Unknown {
+		return code
+	}
+	return errcode.StartFailure
+}
+
+// Code returns the code of the error of the reported stage.
+func (e *PipelineError) Code() errcode.Code {
+	if e.Stage < 0 || e.Stage >= len(e.Errs) {
+		return errcode.Unknown
+	}
+	return errcode.Of(e.Errs[e.Stage])
+}
+
+// Code returns the code of e.Err, or that of the last alternative which
+// was tried, if the context was not done.
+func (e *FirstOfError) Code() errcode.Code {
+	if e.Err != nil || len(e.Errs) == 0 {
+		return errcode.Of(e.Err)
+	}
+	return errcode.Of(e.Errs[len(e.Errs)-1])
+}
+
+// Code returns the code shared by the errors of all hosts, or
+// errcode.Mixed if they failed in different ways.
+func (e *FanOutError) Code() errcode.Code {
+	return commonCode(e.Errs)
+}
+
+// Code returns the code shared by the errors of all tasks which failed,
+// or errcode.Mixed if they failed in different ways.
+func (e *PlanError) Code() errcode.Code {
+	errs := make([]error, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		errs = append(errs, err)
+	}
+	return commonCode(errs)
+}
+
+// commonCode returns the code shared by errs, or errcode.Mixed.
+func commonCode(errs []error) errcode.Code {
+	code := errcode.Unknown
+	for i, err := range errs {
+		c := errcode.Of(err)
+		if i > 0 && c != code {
+			return errcode.Mixed
+		}
+		code = c
+	}
+	return code
+}
+
+// Code returns the code of e.Err.
+func (e *SelfError) Code() errcode.Code { return errcode.Of(e.Err) }
+
+// Code returns the code of e.Err.
+func (e *StepsError) Code() errcode.Code { return errcode.Of(e.Err) }
+
+// Code returns the code of e.Err.
+func (e *FeatureError) Code() errcode.Code { return errcode.Of(e.Err) }
+
+// Code returns the code of e.Err.
+func (e *ToolVersionError) Code() errcode.Code { return errcode.Of(e.Err) }
+
+// Code returns the code of e.Err, or errcode.StartFailure if it carries
+// none.
+func (e *DaemonError) Code() errcode.Code {
+	if code := errcode.Of(e.Err); code != errcode.Unknown {
+		return code
+	}
+	return errcode.StartFailure
+}
+
+// Code returns the code of e.Err if the worker crashed, or
+// errcode.NonZeroExit if it reported a failure.
+func (e *WorkError) Code() errcode.Code {
+	if e.Err != nil {
+		return errcode.Of(e.Err)
+	}
+	return errcode.NonZeroExit
+}
+
+// Code returns errcode.OutputOverflow.
+func (e *OutputOverflowError) Code() errcode.Code { return errcode.OutputOverflow }
+
+// Code returns errcode.OutputMismatch.
+func (e *ContractError) Code() errcode.Code { return errcode.OutputMismatch }
+
+// Code returns errcode.Deadlock.
+func (e *DeadlockError) Code() errcode.Code { return errcode.Deadlock }
+
+// Code returns errcode.PolicyDenied.
+func (e *HermeticError) Code() errcode.Code { return errcode.PolicyDenied }
+
+// Code returns errcode.InvalidArgument.
+func (e *ArgError) Code() errcode.Code { return errcode.InvalidArgument }
+
+// Code returns errcode.InvalidArgument.
+func (e *ArgsError) Code() errcode.Code { return errcode.InvalidArgument }
+
+// Code returns errcode.InvalidArgument.
+func (e *FileMappingError) Code() errcode.Code { return errcode.InvalidArgument }
+
+// Code returns errcode.InvalidArgument.
+func (e *UserError) Code() errcode.Code { return errcode.InvalidArgument }
+
+// Code returns errcode.ResourceExhausted.
+func (e *BudgetExceededError) Code() errcode.Code { return errcode.ResourceExhausted }
+
+// Code returns errcode.Aborted.
+func (e *AbortRequest) Code() errcode.Code { return errcode.Aborted }
+
+// Code returns errcode.Unavailable.
+func (e *CircuitOpenError) Code() errcode.Code { return errcode.Unavailable }
+
+// Code returns errcode.Unavailable.
+func (e *LockError) Code() errcode.Code { return errcode.Unavailable }
+
+// Code returns errcode.Unavailable.
+func (e *QuotaTimeoutError) Code() errcode.Code { return errcode.Unavailable }
+
+// Code returns errcode.Timeout if no peer connected within e.Timeout, or
+// errcode.Unavailable if no peer connected before the command exited.
+func (e *EndpointError) Code() errcode.Code {
+	if e.Timeout > 0 {
+		return errcode.Timeout
+	}
+	return errcode.Unavailable
+}
+
+// Code returns errcode.StartFailure.
+func (e *MountError) Code() errcode.Code { return errcode.StartFailure }
+
+// Code returns errcode.StartFailure.
+func (e *NotExecutableError) Code() errcode.Code { return errcode.StartFailure }
+
+// Code returns errcode.StartFailure.
+func (e *ResolveError) Code() errcode.Code { return errcode.StartFailure }
+
+// Code returns errcode.StartFailure.
+func (e *WorkDirError) Code() errcode.Code { return errcode.StartFailure }
+
+// Code returns errcode.Leaked.
+func (e *ScopeError) Code() errcode.Code { return errcode.Leaked }
+
+// Code returns errcode.Leaked.
+func (e *FDLeakError) Code() errcode.Code { return errcode.Leaked }
+
+// Code returns the code of the exit status of the process, if it was
+// reaped by the active Reaper and did not exit successfully, or
+// errcode.Internal if its exit status is lost.
+func (e *ReapedError) Code() errcode.Code {
+	switch {
+	case e.Orphan == nil || e.Orphan.ExitCode == 0:
+		return errcode.Internal
+	case e.Orphan.Signal != nil:
+		return errcode.Signaled
+	default:
+		return errcode.NonZeroExit
+	}
+}
+
+// Code returns errcode.Internal.
+func (e *InternalError) Code() errcode.Code { return errcode.Internal }
@@ -0,0 +1,153 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+	"acln.ro/execx/errcode"
+)
+
+func TestCodes(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T) error
+		want errcode.Code
+	}{
+		{
+			name: "NonZeroExit",
+			run: func(t *testing.T) error {
+				_, err := execx.Run(context.Background(), selfCmd("on"))
+				return err
+			},
+			want: errcode.NonZeroExit,
+		},
+		{
+			name: "Timeout",
+			run: func(t *testing.T) error {
+				_, err := execx.Run(context.Background(), selfCmd("hang"), execx.WithTimeout(50*time.Millisecond))
+				return err
+			},
+			want: errcode.Timeout,
+		},
+		{
+			name: "Canceled",
+			run: func(t *testing.T) error {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				h, err := execx.Start(ctx, selfCmd("hang"))
+				if err != nil {
+					return err
+				}
+				time.AfterFunc(50*time.Millisecond, cancel)
+				_, err = h.Wait()
+				return err
+			},
+			want: errcode.Canceled,
+		},
+		{
+			name: "StartFailure",
+			run: func(t *testing.T) error {
+				_, err := execx.Run(context.Background(), exec.Command("/nonexistent/execx-test"))
+				return err
+			},
+			want: errcode.StartFailure,
+		},
+		{
+			name: "PolicyDenied",
+			run: func(t *testing.T) error {
+				storeConfig(t, execx.Config{AllowedPrograms: []string{"true"}})
+				_, err := execx.Run(context.Background(), exec.Command("false"))
+				return err
+			},
+			want: errcode.PolicyDenied,
+		},
+		{
+			name: "OutputOverflow",
+			run: func(t *testing.T) error {
+				_, err := execx.OutputLimited(context.Background(), selfCmd("flood"), 4096)
+				return err
+			},
+			want: errcode.OutputOverflow,
+		},
+		{
+			name: "Pipeline",
+			run: func(t *testing.T) error {
+				p := &execx.Pipeline{Cmds: []*exec.Cmd{selfCmd("on"), selfCmd("echo")}}
+				_, err := p.Run(context.Background())
+				return err
+			},
+			want: errcode.NonZeroExit,
+		},
+		{
+			name: "Aborted",
+			run: func(t *testing.T) error {
+				var cause error
+				execx.Run(context.Background(), selfCmd("on"), execx.AbortOnExitCode(func(err error) { cause = err }, 1))
+				return cause
+			},
+			want: errcode.Aborted,
+		},
+		{
+			name: "ContextDone",
+			run: func(t *testing.T) error {
+				_, err := execx.Run(canceled, selfCmd("echo"))
+				return err
+			},
+			want: errcode.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(t)
+			if got := errcode.Of(err); got != tt.want {
+				t.Errorf("code of %v = %q, want %q", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeRecorded(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("hang"), execx.WithTimeout(50*time.Millisecond))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if got := ee.Fields()["code"]; got != string(errcode.Timeout) {
+		t.Errorf("code field = %v, want %q", got, errcode.Timeout)
+	}
+	b, jerr := json.Marshal(err)
+	if jerr != nil {
+		t.Fatal(jerr)
+	}
+	var got struct {
+		Code errcode.Code `json:"code"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != errcode.Timeout {
+		t.Errorf("code = %q in %s, want %q", got.Code, b, errcode.Timeout)
+	}
+}
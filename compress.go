@@ -0,0 +1,139 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+)
+
+// WithCompressedCapture keeps the captured standard output and standard
+// error of the command gzip-compressed in memory, as they are read, which
+// reduces the memory held by programs which supervise many verbose
+// commands at once. Limits set by WithOutputLimit and WithStderrLimit
+// apply to the output before it is compressed.
+//
+// The compressed output is held in Result.CompressedStdout and
+// Result.CompressedStderr, and decompressed on demand by the StdoutBytes
+// and StderrBytes methods of Result. Result.Stdout and Result.Stderr are
+// nil, unless the output must be inspected: if the command fails, if it
+// is inspected by FailIf, AbortOnOutput or WithContract, or if it exceeds
+// the limit set by WithOutputLimit, the output is decompressed into them,
+// such that errors are formatted as usual.
+// The standard library does not provide zstd, so gzip is used.
+func WithCompressedCapture() Option {
+	return func(cfg *config) {
+		cfg.compress = true
+	}
+}
+
+// captureWriter is the destination of captured output: a *bytes.Buffer,
+// or a *gzipCapture.
+type captureWriter interface {
+	io.Writer
+
+	// Len returns the number of bytes written so far.
+	Len() int
+}
+
+// gzipCapture compresses captured output into a buffer.
+type gzipCapture struct {
+	zw *gzip.Writer
+	n  int
+}
+
+func newGzipCapture(buf *bytes.Buffer) *gzipCapture {
+	zw, _ := gzip.NewWriterLevel(buf, gzip.BestSpeed)
+	return &gzipCapture{zw: zw}
+}
+
+func (gc *gzipCapture) Write(p []byte) (int, error) {
+	n, err := gc.zw.Write(p)
+	gc.n += n
+	return n, err
+}
+
+// Len returns the number of uncompressed bytes written to gc.
+func (gc *gzipCapture) Len() int {
+	return gc.n
+}
+
+// close completes the compressed stream, once the stream is done.
+func (gc *gzipCapture) close() {
+	if gc != nil {
+		gc.zw.Close()
+	}
+}
+
+// StdoutBytes returns the captured standard output of the command:
+// r.Stdout, or, if r.Stdout is nil and the output was compressed using
+// WithCompressedCapture, the decompressed contents of r.CompressedStdout.
+// The decompressed output is not retained by r.
+func (r *Result) StdoutBytes() []byte {
+	if r.Stdout != nil || r.CompressedStdout == nil {
+		return r.Stdout
+	}
+	return decode(r.decoder, gunzip(r.CompressedStdout))
+}
+
+// StderrBytes is like StdoutBytes, but for standard error.
+func (r *Result) StderrBytes() []byte {
+	if r.Stderr != nil || r.CompressedStderr == nil {
+		return r.Stderr
+	}
+	return decode(r.decoder, gunzip(r.CompressedStderr))
+}
+
+// inflate decompresses the captured output of the command, if it was
+// compressed, into r.Stdout and r.Stderr.
+func (r *Result) inflate() {
+	r.Stdout = r.StdoutBytes()
+	r.Stderr = r.StderrBytes()
+}
+
+// gunzip returns the decompressed contents of b, which is known to be
+// a valid gzip stream.
+func gunzip(b []byte) []byte {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil
+	}
+	out, _ := ioutil.ReadAll(zr)
+	if out == nil {
+		out = []byte{}
+	}
+	return out
+}
+
+// inspectsOutput reports whether the captured output of a command which
+// was compressed must be decompressed even if the command succeeded.
+func (h *Handle) inspectsOutput() bool {
+	if len(h.cfg.failIf) > 0 || len(h.cfg.contracts) > 0 {
+		return true
+	}
+	for _, t := range h.cfg.aborts {
+		if len(t.marker) > 0 {
+			return true
+		}
+	}
+	for _, s := range h.outputs {
+		if lw, ok := s.limiter().(*limitWriter); ok && lw.overflow {
+			return true
+		}
+	}
+	return false
+}
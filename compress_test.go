@@ -0,0 +1,64 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithCompressedCapture(t *testing.T) {
+	res, err := execx.Run(context.Background(), selfCmd("flood"), execx.WithCompressedCapture())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stdout != nil {
+		t.Errorf("got %d bytes of uncompressed stdout, want none", len(res.Stdout))
+	}
+	if n := len(res.CompressedStdout); n == 0 || n > 64<<10 {
+		t.Errorf("got %d bytes of compressed stdout", n)
+	}
+	if got := res.StdoutBytes(); !bytes.Equal(got, make([]byte, 1<<20)) {
+		t.Errorf("got %d bytes of stdout, want %d zero bytes", len(got), 1<<20)
+	}
+	if res.Stdout != nil {
+		t.Errorf("decompressed stdout retained")
+	}
+}
+
+func TestWithCompressedCaptureFailure(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("stderr-flood"), execx.WithCompressedCapture(), execx.WithStderrLimit(1000))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	stderr := ee.Result.Stderr
+	if !bytes.HasPrefix(stderr, []byte("begin")) || !bytes.HasSuffix(stderr, []byte("end")) {
+		t.Errorf("stderr of the failed command not decompressed: %.20q", stderr)
+	}
+	if !bytes.Equal(ee.Stderr, stderr) {
+		t.Errorf("*ExitError does not carry the decompressed stderr")
+	}
+	if want := int64(len("begin") + 100000 + len("end") - 1000); ee.StderrDropped != want {
+		t.Errorf("got %d bytes dropped, want %d", ee.StderrDropped, want)
+	}
+	if len(ee.Result.CompressedStderr) == 0 {
+		t.Errorf("compressed stderr missing")
+	}
+}
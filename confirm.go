@@ -0,0 +1,181 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"acln.ro/execx/errcode"
+)
+
+// ErrNotConfirmed is returned, wrapped in a *StartError, by a
+// ConfirmPolicy for commands whose execution was declined.
+var ErrNotConfirmed = newCodedError("execx: command not confirmed", errcode.PolicyDenied)
+
+// A Confirmation records the decision to run, or not to run, a command
+// which required confirmation.
+type Confirmation struct {
+	// Pattern is the pattern the command matched.
+	Pattern string
+
+	// Prompt is the question which was asked.
+	Prompt string
+
+	// Response is the answer typed on the terminal, or empty if the
+	// decision was made by a callback.
+	Response string
+
+	// Confirmed reports whether the command was allowed to run.
+	Confirmed bool
+
+	// Time is the time the decision was made.
+	Time time.Time
+}
+
+// String returns a description of c, such as
+//
+//	confirmed (matched "rm -rf"): Run rm -rf build? [y/N] y
+func (c *Confirmation) String() string {
+	decision := "declined"
+	if c.Confirmed {
+		decision = "confirmed"
+	}
+	return fmt.Sprintf("%s (matched %q): %s%s", decision, c.Pattern, c.Prompt, c.Response)
+}
+
+// A ConfirmPolicy is a Runner which asks for confirmation before running
+// dangerous commands. Commands which do not match any of the patterns run
+// without confirmation. Declined commands are not run: Run returns a
+// *StartError which wraps ErrNotConfirmed, and carries the *Confirmation
+// as a detail named "confirmation".
+//
+// If the policy runs under a Recorder, for example as its Runner, the
+// decision, and the prompt transcript, are recorded in the Confirmation
+// field of the Step.
+type ConfirmPolicy struct {
+	// Runner runs the commands. If Runner is nil, Local is used.
+	Runner Runner
+
+	// Patterns lists the commands which require confirmation, such as
+	// "rm -rf" or "terraform destroy". A command matches a pattern if
+	// its program name is the first word of the pattern, and each
+	// remaining word is one of its arguments, in any order.
+	Patterns []string
+
+	// Ask, if not nil, is called to decide whether the command should
+	// run, instead of prompting on the terminal. It is called with the
+	// prompt which would have been shown on the terminal.
+	Ask func(ctx context.Context, cmd *exec.Cmd, prompt string) (bool, error)
+}
+
+// Run runs cmd, asking for confirmation first if cmd matches one of the
+// patterns of p.
+func (p *ConfirmPolicy) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	runner := p.Runner
+	if runner == nil {
+		runner = Local
+	}
+	pattern, ok := p.match(cmd)
+	if !ok {
+		return runner.Run(ctx, cmd, opts...)
+	}
+	conf := &Confirmation{
+		Pattern: pattern,
+		Prompt:  fmt.Sprintf("Run %s? [y/N] ", CmdlineQuoted(cmd)),
+	}
+	var err error
+	if p.Ask != nil {
+		conf.Confirmed, err = p.Ask(ctx, cmd, conf.Prompt)
+	} else {
+		conf.Response, err = promptTerminal(conf.Prompt)
+		switch strings.ToLower(strings.TrimSpace(conf.Response)) {
+		case "y", "yes":
+			conf.Confirmed = true
+		}
+	}
+	conf.Time = ClockFrom(ctx).Now()
+	recordConfirmation(ctx, conf)
+	if err == nil && !conf.Confirmed {
+		err = ErrNotConfirmed
+	}
+	if err != nil {
+		se := wrapStart(err, cmd, nil)
+		se.Details = append(se.Details, Detail{Key: "confirmation", Value: conf})
+		return nil, se
+	}
+	return runner.Run(ctx, cmd, opts...)
+}
+
+// match returns the first pattern cmd matches.
+func (p *ConfirmPolicy) match(cmd *exec.Cmd) (string, bool) {
+	if len(cmd.Args) == 0 {
+		return "", false
+	}
+	name := filepath.Base(cmd.Args[0])
+	args := make(map[string]bool, len(cmd.Args))
+	for _, arg := range cmd.Args[1:] {
+		args[arg] = true
+	}
+	for _, pattern := range p.Patterns {
+		words := strings.Fields(pattern)
+		if len(words) == 0 || !sameProgram(words[0], name) {
+			continue
+		}
+		matched := true
+		for _, w := range words[1:] {
+			matched = matched && args[w]
+		}
+		if matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// promptTerminal writes prompt to the controlling terminal, and reads a
+// line of response from it. If there is no terminal, the command is not
+// confirmed.
+func promptTerminal(prompt string) (string, error) {
+	in, out := "/dev/tty", "/dev/tty"
+	if runtime.GOOS == "windows" {
+		in, out = "CONIN$", "CONOUT$"
+	}
+	r, err := os.Open(in)
+	if err != nil {
+		return "", fmt.Errorf("execx: confirmation: no terminal: %v", err)
+	}
+	defer r.Close()
+	w, err := os.OpenFile(out, os.O_WRONLY, 0)
+	if err != nil {
+		return "", fmt.Errorf("execx: confirmation: no terminal: %v", err)
+	}
+	defer w.Close()
+	if _, err := w.WriteString(prompt); err != nil {
+		return "", err
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("execx: confirmation: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
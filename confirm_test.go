@@ -0,0 +1,109 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestConfirmPolicy(t *testing.T) {
+	var prompts []string
+	answer := false
+	policy := &execx.ConfirmPolicy{
+		Patterns: []string{"rm -rf", "terraform destroy"},
+		Ask: func(ctx context.Context, cmd *exec.Cmd, prompt string) (bool, error) {
+			prompts = append(prompts, prompt)
+			return answer, nil
+		},
+	}
+	rec := &execx.Recorder{Runner: policy}
+	ctx := context.Background()
+
+	// Does not match: rm without -rf.
+	if _, err := rec.Run(ctx, exec.Command("rm", "-f", "/nonexistent/execx-confirm")); err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 0 {
+		t.Fatalf("asked for confirmation of a command matching no pattern: %q", prompts)
+	}
+
+	_, err := rec.Run(ctx, exec.Command("rm", "-rf", "/nonexistent/execx-confirm"))
+	if !errors.Is(err, execx.ErrNotConfirmed) {
+		t.Fatalf("got %v, want ErrNotConfirmed", err)
+	}
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %T, want *StartError", err)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "rm -rf /nonexistent/execx-confirm") {
+		t.Fatalf("got prompts %q", prompts)
+	}
+
+	answer = true
+	if _, err := rec.Run(ctx, exec.Command("rm", "/nonexistent/execx-confirm", "-rf")); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := rec.Steps()
+	if len(steps) != 3 {
+		t.Fatalf("recorded %d steps, want 3", len(steps))
+	}
+	if steps[0].Confirmation != nil {
+		t.Errorf("step 1: unexpected confirmation %v", steps[0].Confirmation)
+	}
+	for i, want := range []bool{false, true} {
+		c := steps[i+1].Confirmation
+		if c == nil {
+			t.Fatalf("step %d: confirmation not recorded", i+2)
+		}
+		if c.Confirmed != want || c.Pattern != "rm -rf" || c.Time.IsZero() {
+			t.Errorf("step %d: got %+v", i+2, c)
+		}
+	}
+
+	sh := new(bytes.Buffer)
+	if err := rec.WriteShell(sh); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`# declined (matched "rm -rf"): Run rm`, `# confirmed (matched "rm -rf"): Run rm`} {
+		if !strings.Contains(sh.String(), want) {
+			t.Errorf("shell transcript missing %q:\n%s", want, sh)
+		}
+	}
+}
+
+func TestConfirmPolicyAskError(t *testing.T) {
+	policy := &execx.ConfirmPolicy{
+		Patterns: []string{"terraform destroy"},
+		Ask: func(ctx context.Context, cmd *exec.Cmd, prompt string) (bool, error) {
+			return true, errors.New("no operator available")
+		},
+	}
+	_, err := policy.Run(context.Background(), exec.Command("/usr/bin/terraform", "destroy", "-auto-approve"))
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+	if !strings.Contains(err.Error(), "no operator available") {
+		t.Errorf("got %v, want the error from Ask", err)
+	}
+}
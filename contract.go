@@ -0,0 +1,163 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A Contract declares expectations about the output of a command, which
+// are checked once the command has exited successfully, such that bad
+// output is caught where the command is run, rather than wherever it is
+// consumed. The zero Contract expects nothing.
+type Contract struct {
+	// StdoutJSON requires the standard output to be a valid JSON value.
+	StdoutJSON bool
+
+	// StdoutNonEmpty requires the standard output not to be empty.
+	StdoutNonEmpty bool
+
+	// StdoutMatch, if not nil, must match the standard output.
+	StdoutMatch *regexp.Regexp
+
+	// StderrEmpty requires the standard error to be empty.
+	StderrEmpty bool
+}
+
+// WithContract checks that the output of the command honors c, once the
+// command has exited successfully. Only output which is captured, as
+// described by Start, is checked: expectations about a stream written to
+// cmd.Stdout or cmd.Stderr are ignored. If the output violates c, the run
+// fails with a *ContractError.
+func WithContract(c Contract) Option {
+	return func(cfg *config) {
+		cfg.contracts = append(cfg.contracts, c)
+	}
+}
+
+// A ContractViolation describes an expectation of a Contract which the
+// output of a command did not meet.
+type ContractViolation struct {
+	// Stream is the name of the stream, "stdout" or "stderr".
+	Stream string
+
+	// Rule names the expectation: "json", "non-empty", "match" or
+	// "empty".
+	Rule string
+
+	// Detail explains the violation, such as the error of the JSON
+	// decoder, or the first line of unexpected output.
+	Detail string
+}
+
+func (v ContractViolation) String() string {
+	var s string
+	switch v.Rule {
+	case "json":
+		s = v.Stream + " is not valid JSON"
+	case "non-empty":
+		s = v.Stream + " is empty"
+	case "match":
+		return v.Stream + " does not match " + v.Detail
+	case "empty":
+		s = v.Stream + " is not empty"
+	default:
+		s = v.Stream + " violates " + v.Rule
+	}
+	if v.Detail != "" {
+		s += ": " + v.Detail
+	}
+	return s
+}
+
+// ContractError records that the output of a command which exited
+// successfully violated a Contract.
+type ContractError struct {
+	// Path, Args and Dir describe the command.
+	Path string
+	Args []string
+	Dir  string
+
+	// Violations describes the expectations which were not met.
+	Violations []ContractViolation
+
+	// Result describes the run, and holds its output.
+	Result *Result
+}
+
+// Cmdline returns the concatenation of filepath.Base(e.Path) and e.Args,
+// separated by spaces. See func Cmdline.
+func (e *ContractError) Cmdline() string {
+	return cmdline(e.Path, e.Args)
+}
+
+func (e *ContractError) Error() string {
+	vs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		vs = append(vs, v.String())
+	}
+	return fmt.Sprintf("execx: %s: output violates contract: %s", e.Cmdline(), strings.Join(vs, "; "))
+}
+
+// checkContracts checks the output of a command which exited successfully
+// against the contracts set by WithContract, and returns a *ContractError
+// if they are violated.
+func (h *Handle) checkContracts(res *Result) error {
+	captured := make(map[string]bool)
+	for _, s := range h.outputs {
+		captured[s.name] = s.capture != nil
+	}
+	var violations []ContractViolation
+	for _, c := range h.cfg.contracts {
+		violations = append(violations, c.check(res.Stdout, res.Stderr, captured)...)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ContractError{
+		Path:       h.cmd.Path,
+		Args:       h.cmd.Args,
+		Dir:        res.Dir,
+		Violations: violations,
+		Result:     res,
+	}
+}
+
+// check returns the violations of c by stdout and stderr. Expectations
+// about streams which were not captured are ignored.
+func (c *Contract) check(stdout, stderr []byte, captured map[string]bool) []ContractViolation {
+	var vs []ContractViolation
+	if captured["stdout"] {
+		if c.StdoutNonEmpty && len(stdout) == 0 {
+			vs = append(vs, ContractViolation{Stream: "stdout", Rule: "non-empty"})
+		}
+		if c.StdoutJSON {
+			var v interface{}
+			if err := json.Unmarshal(stdout, &v); err != nil {
+				vs = append(vs, ContractViolation{Stream: "stdout", Rule: "json", Detail: err.Error()})
+			}
+		}
+		if c.StdoutMatch != nil && !c.StdoutMatch.Match(stdout) {
+			vs = append(vs, ContractViolation{Stream: "stdout", Rule: "match", Detail: c.StdoutMatch.String()})
+		}
+	}
+	if captured["stderr"] && c.StderrEmpty && len(stderr) > 0 {
+		vs = append(vs, ContractViolation{Stream: "stderr", Rule: "empty", Detail: firstLine(stderr)})
+	}
+	return vs
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithContract(t *testing.T) {
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader(`{"a": 1}`)
+	c := execx.Contract{
+		StdoutJSON:     true,
+		StdoutNonEmpty: true,
+		StdoutMatch:    regexp.MustCompile(`"a"`),
+	}
+	if _, err := execx.Run(context.Background(), cmd, execx.WithContract(c)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithContractViolated(t *testing.T) {
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("not json")
+	c := execx.Contract{StdoutJSON: true, StderrEmpty: true}
+	_, err := execx.Run(context.Background(), cmd, execx.WithContract(c))
+	var ce *execx.ContractError
+	if !errors.As(err, &ce) {
+		t.Fatalf("got %v, want *ContractError", err)
+	}
+	if len(ce.Violations) != 2 {
+		t.Fatalf("got violations %v, want 2", ce.Violations)
+	}
+	if v := ce.Violations[0]; v.Stream != "stdout" || v.Rule != "json" {
+		t.Errorf("got %+v, want a json violation on stdout", v)
+	}
+	if v := ce.Violations[1]; v.Stream != "stderr" || v.Rule != "empty" || v.Detail != "echoed" {
+		t.Errorf("got %+v, want an empty violation on stderr", v)
+	}
+	if string(ce.Result.Stdout) != "not json" {
+		t.Errorf("got stdout %q", ce.Result.Stdout)
+	}
+	if !strings.Contains(err.Error(), "output violates contract") {
+		t.Errorf("got %q", err)
+	}
+}
+
+func TestWithContractUncaptured(t *testing.T) {
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("")
+	cmd.Stderr = new(strings.Builder)
+	c := execx.Contract{StderrEmpty: true}
+	if _, err := execx.Run(context.Background(), cmd, execx.WithContract(c)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2021, time.March, 15, 10, 17, 30, 0, time.UTC) // a Monday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.March, 15, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.March, 15, 10, 30, 0, 0, time.UTC)},
+		{"5 * * * *", time.Date(2021, time.March, 15, 11, 5, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2021, time.March, 15, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2021, time.March, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, time.March, 21, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,20 * *", time.Date(2021, time.March, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * fri", time.Date(2021, time.March, 19, 0, 0, 0, 0, time.UTC)},
+		{"30 4 29 feb *", time.Date(2024, time.February, 29, 4, 30, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		sched, err := execx.ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got := sched.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := execx.ParseCron(expr); err == nil {
+			t.Errorf("%q: no error", expr)
+		}
+	}
+}
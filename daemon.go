@@ -0,0 +1,329 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DaemonOptions configures Daemonize.
+type DaemonOptions struct {
+	// PidFile is the path of the file which records the process ID of
+	// the daemon. If PidFile is empty, no pidfile is written.
+	PidFile string
+
+	// LogFile is the file the standard output and the standard error of
+	// the daemon are appended to. If LogFile is empty, they are
+	// discarded.
+	LogFile string
+
+	// Umask is the file mode creation mask of the daemon, as per
+	// WithUmask. If Umask is zero, the daemon inherits the umask of
+	// the current process. Umask is not supported on Windows.
+	Umask os.FileMode
+}
+
+// Errors reported by Daemonize and Daemon methods, wrapped in a
+// *DaemonError.
+var (
+	ErrDaemonRunning    = errors.New("daemon is already running")
+	ErrDaemonNotRunning = errors.New("daemon is not running")
+)
+
+// A DaemonError records a failure to start, or to control, a daemon.
+type DaemonError struct {
+	// Op is the operation which failed, such as "start" or "stop".
+	Op string
+
+	// PidFile is the path of the pidfile of the daemon, if any.
+	PidFile string
+
+	// PID is the process ID of the daemon, or 0 if it is not known.
+	PID int
+
+	// Err is the underlying error, such as ErrDaemonRunning.
+	Err error
+}
+
+func (e *DaemonError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("execx: daemon " + e.Op)
+	if e.PidFile != "" {
+		sb.WriteString(" " + e.PidFile)
+	}
+	if e.PID != 0 {
+		fmt.Fprintf(&sb, " (pid %d)", e.PID)
+	}
+	sb.WriteString(": " + e.Err.Error())
+	return sb.String()
+}
+
+// Unwrap returns e.Err.
+func (e *DaemonError) Unwrap() error {
+	return e.Err
+}
+
+// A Daemon is a process started by Daemonize, or found by OpenDaemon.
+type Daemon struct {
+	// PID is the process ID of the daemon.
+	PID int
+
+	// PidFile is the path of the pidfile of the daemon, if any.
+	PidFile string
+
+	// Clock measures the grace period of Stop, and the intervals at
+	// which Stop checks whether the daemon has exited. If Clock is nil,
+	// SystemClock is used.
+	Clock Clock
+
+	exited chan struct{} // closed when the daemon exits, if it is our child
+}
+
+// Daemonize starts cmd as a daemon: detached from the terminal and the
+// session of the current process, as per the Detached spawn flag, with
+// its standard input connected to the null device, its standard output
+// and standard error appended to opts.LogFile, and running in the root
+// directory, unless cmd.Dir is set.
+//
+// If opts.PidFile is set, Daemonize refuses to start the daemon if the
+// pidfile names a running process, reporting ErrDaemonRunning. Stale
+// pidfiles are replaced. Once the daemon has started, its process ID is
+// written to the pidfile.
+//
+// The daemon keeps running after the current process exits. Failures are
+// reported as a *DaemonError, which wraps a *StartError if the daemon
+// could not be started.
+func Daemonize(cmd *exec.Cmd, opts DaemonOptions) (*Daemon, error) {
+	fail := func(pid int, err error) (*Daemon, error) {
+		return nil, &DaemonError{Op: "start", PidFile: opts.PidFile, PID: pid, Err: err}
+	}
+	if opts.PidFile != "" {
+		pid, err := readPidFile(opts.PidFile)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return fail(0, err)
+		case processAlive(pid):
+			return fail(pid, ErrDaemonRunning)
+		}
+	}
+	if opts.Umask != 0 {
+		if runtime.GOOS == "windows" {
+			return fail(0, errors.New("umask is not supported on windows"))
+		}
+		shimUmask(cmd, opts.Umask)
+	}
+	if cmd.Dir == "" {
+		cmd.Dir = string(filepath.Separator)
+	}
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		return fail(0, err)
+	}
+	defer null.Close()
+	cmd.Stdin = null
+	logPath := opts.LogFile
+	if logPath == "" {
+		logPath = os.DevNull
+	}
+	log, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fail(0, err)
+	}
+	defer log.Close()
+	cmd.Stdout = log
+	cmd.Stderr = log
+	if err := applySpawnFlags(cmd, Detached|HideWindow); err != nil {
+		return fail(0, wrapStart(err, cmd, nil))
+	}
+	if err := cmd.Start(); err != nil {
+		return fail(0, Wrap(err, cmd))
+	}
+	d := &Daemon{PID: cmd.Process.Pid, PidFile: opts.PidFile, exited: make(chan struct{})}
+	go func() {
+		// Reap the daemon, should it exit while we are running.
+		cmd.Wait()
+		close(d.exited)
+	}()
+	if opts.PidFile != "" {
+		if err := writePidFile(opts.PidFile, d.PID); err != nil {
+			cmd.Process.Kill()
+			return fail(d.PID, err)
+		}
+	}
+	return d, nil
+}
+
+// OpenDaemon returns the Daemon whose process ID is recorded in pidFile,
+// such that a daemon started by an earlier invocation of a program can be
+// controlled. The daemon need not be running.
+func OpenDaemon(pidFile string) (*Daemon, error) {
+	pid, err := readPidFile(pidFile)
+	if err != nil {
+		return nil, &DaemonError{Op: "open", PidFile: pidFile, Err: err}
+	}
+	return &Daemon{PID: pid, PidFile: pidFile}, nil
+}
+
+// DaemonStatus describes the state of a Daemon.
+type DaemonStatus struct {
+	// PID is the process ID of the daemon.
+	PID int
+
+	// Running reports whether the daemon is running.
+	Running bool
+}
+
+// Status returns the status of the daemon.
+func (d *Daemon) Status() DaemonStatus {
+	return DaemonStatus{PID: d.PID, Running: d.running()}
+}
+
+// Signal sends sig to the daemon. If the daemon is not running, Signal
+// returns a *DaemonError wrapping ErrDaemonNotRunning.
+func (d *Daemon) Signal(sig os.Signal) error {
+	if !d.running() {
+		return d.error("signal", ErrDaemonNotRunning)
+	}
+	p, err := os.FindProcess(d.PID)
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		return d.error("signal", err)
+	}
+	return nil
+}
+
+// daemonPollInterval is the interval at which Stop checks whether a
+// daemon which is not a child of the current process has exited.
+const daemonPollInterval = 50 * time.Millisecond
+
+// Stop asks the daemon to exit gracefully, using Terminate, and kills it
+// if it does not exit within the grace period. Once the daemon has
+// exited, its pidfile is removed. If the daemon is not running, Stop
+// removes its pidfile, and returns a *DaemonError wrapping
+// ErrDaemonNotRunning.
+func (d *Daemon) Stop(grace time.Duration) error {
+	if !d.running() {
+		d.removePidFile()
+		return d.error("stop", ErrDaemonNotRunning)
+	}
+	p, err := os.FindProcess(d.PID)
+	if err != nil {
+		return d.error("stop", err)
+	}
+	if err := Terminate(&exec.Cmd{Process: p}); err != nil || !d.await(grace) {
+		p.Kill()
+		if !d.await(grace + time.Second) {
+			return d.error("stop", errors.New("daemon did not exit after being killed"))
+		}
+	}
+	d.removePidFile()
+	return nil
+}
+
+// running reports whether the daemon is running.
+func (d *Daemon) running() bool {
+	if d.exited != nil {
+		select {
+		case <-d.exited:
+			return false
+		default:
+		}
+	}
+	return processAlive(d.PID)
+}
+
+// await waits up to timeout for the daemon to exit, and reports whether
+// it did.
+func (d *Daemon) await(timeout time.Duration) bool {
+	clock := d.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	deadline := clock.Now().Add(timeout)
+	for d.running() {
+		if !clock.Now().Before(deadline) {
+			return false
+		}
+		// If the daemon is not our child, d.exited is nil, and we
+		// only poll.
+		t := clock.NewTimer(daemonPollInterval)
+		select {
+		case <-d.exited:
+		case <-t.C():
+		}
+		t.Stop()
+	}
+	return true
+}
+
+func (d *Daemon) removePidFile() {
+	if d.PidFile == "" {
+		return
+	}
+	if pid, err := readPidFile(d.PidFile); err == nil && pid == d.PID {
+		os.Remove(d.PidFile)
+	}
+}
+
+func (d *Daemon) error(op string, err error) *DaemonError {
+	return &DaemonError{Op: op, PidFile: d.PidFile, PID: d.PID, Err: err}
+}
+
+// readPidFile returns the process ID recorded in the pidfile at path.
+func readPidFile(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("malformed pidfile: %q", b)
+	}
+	return pid, nil
+}
+
+// writePidFile records pid in the pidfile at path, atomically.
+func writePidFile(path string, pid int) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(strconv.Itoa(pid) + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
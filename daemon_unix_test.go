@@ -0,0 +1,138 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+	"acln.ro/execx/exectest"
+)
+
+func TestDaemonize(t *testing.T) {
+	dir := t.TempDir()
+	opts := execx.DaemonOptions{
+		PidFile: filepath.Join(dir, "daemon.pid"),
+		LogFile: filepath.Join(dir, "daemon.log"),
+	}
+	d, err := execx.Daemonize(selfCmd("sigterm"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := d.Status(); !st.Running || st.PID != d.PID {
+		t.Fatalf("got status %+v, want running with PID %d", st, d.PID)
+	}
+
+	_, err = execx.Daemonize(selfCmd("sigterm"), opts)
+	var de *execx.DaemonError
+	if !errors.As(err, &de) || !errors.Is(err, execx.ErrDaemonRunning) || de.PID != d.PID {
+		t.Fatalf("second Daemonize: got %v, want ErrDaemonRunning for PID %d", err, d.PID)
+	}
+
+	opened, err := execx.OpenDaemon(opts.PidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.PID != d.PID {
+		t.Fatalf("OpenDaemon: got PID %d, want %d", opened.PID, d.PID)
+	}
+	// Give the daemon time to install its signal handler.
+	time.Sleep(100 * time.Millisecond)
+	if err := opened.Stop(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(opts.PidFile); !os.IsNotExist(err) {
+		t.Errorf("pidfile not removed: %v", err)
+	}
+	if err := d.Stop(time.Second); !errors.Is(err, execx.ErrDaemonNotRunning) {
+		t.Errorf("Stop on stopped daemon: got %v, want ErrDaemonNotRunning", err)
+	}
+	log, err := ioutil.ReadFile(opts.LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(log), "terminated") {
+		t.Errorf("got log %q, want it to contain %q", log, "terminated")
+	}
+}
+
+func TestDaemonStopClock(t *testing.T) {
+	// The daemon ignores SIGTERM, so Stop kills it once the grace
+	// period, as measured by the fake clock, elapses.
+	d, err := execx.Daemonize(selfCmd("hang"), execx.DaemonOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := exectest.NewFakeClock(epoch)
+	d.Clock = clock
+	time.Sleep(100 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() { done <- d.Stop(time.Hour) }()
+
+	clock.BlockUntil(1)
+	select {
+	case err := <-done:
+		t.Fatalf("Stop returned %v before the grace period elapsed", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	clock.Advance(time.Hour)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stop did not kill the daemon once the grace period elapsed")
+	}
+	if d.Status().Running {
+		t.Error("daemon still running after Stop")
+	}
+}
+
+func TestDaemonizeStalePidFile(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "daemon.pid")
+	// The PID of a process which has exited, and has been reaped.
+	res, err := execx.Run(context.Background(), selfCmd("echo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := res.ProcessState.Pid()
+	if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(stale)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := execx.Daemonize(selfCmd("sigterm"), execx.DaemonOptions{PidFile: pidFile})
+	if err != nil {
+		t.Fatalf("stale pidfile not replaced: %v", err)
+	}
+	defer d.Stop(time.Second)
+	opened, err := execx.OpenDaemon(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.PID != d.PID {
+		t.Errorf("pidfile records %d, want %d", opened.PID, d.PID)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// minBlocked is the minimum amount of time a stream must have been blocked
+// writing to its destination before it is considered stuck, if the state
+// of the underlying pipe cannot be determined.
+const minBlocked = time.Second
+
+// directOutput is an output of the child process which is an *os.File
+// supplied by the caller, and not serviced by the Handle.
+type directOutput struct {
+	name string
+	f    *os.File
+}
+
+// diagnose looks for output pipes which the child process may be blocked
+// on, because nobody is reading from them, and for reads from stdin which
+// may never complete, and records hints to that effect. diagnose must be
+// called before the process is killed.
+func (h *Handle) diagnose() {
+	now := time.Now()
+	for _, s := range h.outputs {
+		since := s.blockedSince()
+		if since.IsZero() {
+			continue
+		}
+		unread := now.Sub(since)
+		buffered, capacity, ok := pipeState(s.r)
+		switch {
+		case ok && buffered >= capacity:
+			h.hint("%s pipe full (%s) and unread for %v; likely missing reader",
+				s.name, formatSize(capacity), unread.Round(time.Millisecond))
+		case !ok && unread >= minBlocked:
+			h.hint("%s unread for %v; likely missing reader",
+				s.name, unread.Round(time.Millisecond))
+		}
+	}
+	for _, d := range h.direct {
+		buffered, capacity, ok := pipeState(d.f)
+		if ok && buffered >= capacity {
+			h.hint("%s pipe full (%s); likely missing reader",
+				d.name, formatSize(capacity))
+		}
+	}
+	h.diagnoseStdin()
+}
+
+// hint records a hint which explains the failure of the command.
+func (h *Handle) hint(format string, args ...interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hints = append(h.hints, fmt.Sprintf(format, args...))
+	h.hintMsgs = append(h.hintMsgs, message{key: format, args: args})
+}
+
+func formatSize(n int) string {
+	if n%1024 == 0 {
+		return fmt.Sprintf("%dKB", n/1024)
+	}
+	return fmt.Sprintf("%dB", n)
+}
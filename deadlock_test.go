@@ -0,0 +1,57 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestDeadlockHint(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("pipe state is only available on Linux")
+	}
+	self := selfCmd("flood")
+	self.Stdout = &slowWriter{delay: time.Second}
+	_, err := execx.Run(context.Background(), self, execx.WithTimeout(200*time.Millisecond))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	if len(ee.Hints) != 1 {
+		t.Fatalf("got hints %q, want 1 hint", ee.Hints)
+	}
+	if got := fmt.Sprintf("%v", ee); !strings.Contains(got, "stdout pipe full") {
+		t.Errorf("error %q doesn't mention full pipe", got)
+	}
+}
+
+// slowWriter blocks for a while on the first call to Write.
+type slowWriter struct {
+	once  sync.Once
+	delay time.Duration
+}
+
+func (sw *slowWriter) Write(p []byte) (int, error) {
+	sw.once.Do(func() { time.Sleep(sw.delay) })
+	return len(p), nil
+}
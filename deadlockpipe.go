@@ -0,0 +1,126 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A BlockedStage is a stage of a Pipeline which was blocked on a pipe.
+type BlockedStage struct {
+	// Stage is the index of the stage in the pipeline.
+	Stage int
+
+	// Cmdline is the command line of the stage, as per Cmdline.
+	Cmdline string
+
+	// Blocked describes what the stage was blocked on, such as
+	// "writing stdout (pipe full)" or "reading stdin (pipe empty)".
+	Blocked string
+}
+
+// A DeadlockError reports that the stages of a Pipeline which were still
+// running were all blocked on pipes, without making progress, for the
+// DeadlockTimeout of the pipeline, and that the pipeline was killed.
+type DeadlockError struct {
+	// Stages describes the blocked stages.
+	Stages []BlockedStage
+
+	// Stalled is the time for which no progress was observed.
+	Stalled time.Duration
+
+	// Err holds the errors the stages failed with, once killed.
+	Err *PipelineError
+}
+
+func (e *DeadlockError) Error() string {
+	stages := make([]string, len(e.Stages))
+	for i, s := range e.Stages {
+		stages[i] = fmt.Sprintf("stage %d (%s) %s", s.Stage+1, s.Cmdline, s.Blocked)
+	}
+	return fmt.Sprintf("execx: pipeline deadlocked, no progress for %v: %s",
+		e.Stalled.Round(time.Millisecond), strings.Join(stages, "; "))
+}
+
+// Unwrap returns the errors the stages failed with.
+func (e *DeadlockError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// deadlockSampleInterval is the interval at which the stages of a pipeline
+// are sampled, if it has a DeadlockTimeout.
+const deadlockSampleInterval = 100 * time.Millisecond
+
+// stageSample is a sample of the state of a stage of a pipeline.
+type stageSample struct {
+	blocked string // what the stage is blocked on, if it is blocked on a pipe
+	io      uint64 // bytes read and written by the processes of the stage
+}
+
+// watchDeadlock samples the stages of a pipeline until they all exit, or
+// until all the stages which are still running are blocked on pipes for
+// at least timeout, with no progress in the meantime, in which case it
+// returns the blocked stages, and the time for which they were stalled.
+func watchDeadlock(handles []*Handle, timeout time.Duration) ([]BlockedStage, time.Duration) {
+	if !deadlockDetectionSupported {
+		return nil, 0
+	}
+	tick := time.NewTicker(deadlockSampleInterval)
+	defer tick.Stop()
+	var (
+		since time.Time // when the current stall was first observed
+		last  []stageSample
+	)
+	for {
+		samples := make([]stageSample, len(handles))
+		running, stalled := 0, true
+		for i, h := range handles {
+			select {
+			case <-h.Done():
+				continue
+			default:
+			}
+			running++
+			samples[i] = sampleStage(h.cmd.Process.Pid)
+			if samples[i].blocked == "" || last == nil || samples[i] != last[i] {
+				stalled = false
+			}
+		}
+		if running == 0 {
+			return nil, 0
+		}
+		switch {
+		case !stalled:
+			since = time.Time{}
+		case since.IsZero():
+			since = time.Now()
+		case time.Since(since) >= timeout:
+			var blocked []BlockedStage
+			for i, s := range samples {
+				if s.blocked != "" {
+					blocked = append(blocked, BlockedStage{Stage: i, Cmdline: Cmdline(handles[i].cmd), Blocked: s.blocked})
+				}
+			}
+			return blocked, time.Since(since)
+		}
+		last = samples
+		<-tick.C
+	}
+}
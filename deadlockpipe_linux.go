@@ -0,0 +1,86 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+const deadlockDetectionSupported = true
+
+// sampleStage samples the state of the tree of processes rooted at pid. The
+// stage is blocked if a process in the tree is blocked on a pipe, and all
+// others are either blocked on pipes as well, or waiting for their
+// children.
+func sampleStage(pid int) stageSample {
+	var s stageSample
+	busy := false
+	var visit func(n *ProcNode)
+	visit = func(n *ProcNode) {
+		var st ProcStats
+		if readProcIO(n.PID, &st) == nil {
+			s.io += st.ReadChars + st.WriteChars
+		}
+		switch blocked, waiting := pipeWait(n.PID); {
+		case blocked != "":
+			if s.blocked == "" {
+				s.blocked = blocked
+			}
+		case !waiting:
+			busy = true
+		}
+		for _, c := range n.Children {
+			visit(c)
+		}
+	}
+	if root := procTree(pid); root != nil {
+		visit(root)
+	}
+	if busy {
+		s.blocked = ""
+	}
+	return s
+}
+
+// pipeWait describes the pipe the process with the specified pid is blocked
+// on, if any, or reports whether it is waiting for a child to exit.
+func pipeWait(pid int) (blocked string, waiting bool) {
+	nr, args, ok := readSyscall(pid)
+	if !ok {
+		return "", false
+	}
+	switch nr {
+	case syscall.SYS_WAIT4, syscall.SYS_WAITID:
+		return "", true
+	case syscall.SYS_READ, syscall.SYS_WRITE:
+	default:
+		return "", false
+	}
+	target, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", pid, args[0]))
+	if err != nil || !strings.HasPrefix(target, "pipe:") {
+		return "", false
+	}
+	fd := fmt.Sprintf("fd %d", args[0])
+	if args[0] < 3 {
+		fd = [...]string{"stdin", "stdout", "stderr"}[args[0]]
+	}
+	if nr == syscall.SYS_READ {
+		return "reading " + fd + " (pipe empty)", false
+	}
+	return "writing " + fd + " (pipe full)", false
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestPipelineDeadlock(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("deadlocks are only detected on Linux")
+	}
+	tests := []struct {
+		name    string
+		cmds    []*exec.Cmd
+		opts    []execx.Option
+		blocked []string
+	}{
+		{
+			name: "EmptyPipes",
+			cmds: []*exec.Cmd{exec.Command("cat"), exec.Command("cat")},
+			opts: []execx.Option{execx.WithStdinHeldOpen()},
+			blocked: []string{
+				"reading stdin (pipe empty)",
+				"reading stdin (pipe empty)",
+			},
+		},
+		{
+			name: "FullPipes",
+			cmds: []*exec.Cmd{exec.Command("yes"), exec.Command("cat")},
+			blocked: []string{
+				"writing stdout (pipe full)",
+				"writing stdout (pipe full)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last := tt.cmds[len(tt.cmds)-1]
+			last.Stdout = &slowWriter{delay: time.Second}
+			p := &execx.Pipeline{Cmds: tt.cmds, DeadlockTimeout: 200 * time.Millisecond}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			start := time.Now()
+			_, err := p.Run(ctx, tt.opts...)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("deadlock detected after %v", elapsed)
+			}
+			var derr *execx.DeadlockError
+			if !errors.As(err, &derr) {
+				t.Fatalf("got %v, want *DeadlockError", err)
+			}
+			if len(derr.Stages) != len(tt.blocked) {
+				t.Fatalf("got blocked stages %+v, want %d", derr.Stages, len(tt.blocked))
+			}
+			for i, s := range derr.Stages {
+				if s.Stage != i || s.Blocked != tt.blocked[i] {
+					t.Errorf("stage %d: got %d %s, want %s", i, s.Stage, s.Blocked, tt.blocked[i])
+				}
+			}
+			if !strings.Contains(err.Error(), "pipeline deadlocked") {
+				t.Errorf("unexpected error message %q", err)
+			}
+		})
+	}
+}
+
+func TestPipelineDeadlockProgress(t *testing.T) {
+	p := &execx.Pipeline{
+		Cmds:            []*exec.Cmd{exec.Command("sh", "-c", "for i in 1 2 3 4 5; do echo $i; sleep 0.1; done"), exec.Command("cat")},
+		DeadlockTimeout: 50 * time.Millisecond,
+	}
+	res, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Stdout); got != "1\n2\n3\n4\n5\n" {
+		t.Errorf("got output %q", got)
+	}
+}
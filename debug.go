@@ -0,0 +1,114 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"runtime"
+)
+
+// DebugOptions configures Debug.
+type DebugOptions struct {
+	// Syscalls enables tracing of the system calls made by the
+	// command and its children.
+	Syscalls bool
+
+	// TraceFile is the file the trace is written to. If TraceFile is
+	// empty, the trace is written to a temporary file, which is removed
+	// if the command succeeds.
+	TraceFile string
+
+	// TailLines is the number of trailing lines of the trace attached
+	// to errors. If TailLines is zero, 50 lines are attached.
+	TailLines int
+}
+
+// Debug runs cmd as per Run, under a system call tracer if opts.Syscalls
+// is set, for diagnosing failures which are otherwise hard to explain.
+// On Linux, the tracer is strace. Tracing is not supported on other
+// platforms.
+//
+// If the command fails, the *ExitError carries the path of the trace file,
+// as a detail named "trace_file", and the last lines of the trace, as a
+// detail named "trace_tail". If no tracer is available, the command runs
+// untraced, and the reason is recorded as a detail named "trace".
+func Debug(ctx context.Context, cmd *exec.Cmd, opts DebugOptions, runOpts ...Option) (*Result, error) {
+	if !opts.Syscalls {
+		return Run(ctx, cmd, runOpts...)
+	}
+	tr, terr := tracer()
+	if terr != nil {
+		res, err := Run(ctx, cmd, runOpts...)
+		if ee, ok := err.(*ExitError); ok {
+			ee.Details = append(ee.Details, Detail{Key: "trace", Value: fmt.Sprintf("unavailable: %v", terr)})
+		}
+		return res, err
+	}
+	file := opts.TraceFile
+	var trace *Tracked
+	if file == "" {
+		f, err := ioutil.TempFile("", "execx-trace-")
+		if err != nil {
+			return nil, wrapStart(err, cmd, nil)
+		}
+		f.Close()
+		file = f.Name()
+		trace = ResourceTrackerFrom(ctx).Track("trace", file, removeFunc(file))
+		defer trace.Release()
+	}
+	runOpts = append(runOpts, WithWrappers(tr(file)))
+	res, err := Run(ctx, cmd, runOpts...)
+	ee, ok := err.(*ExitError)
+	if !ok {
+		return res, err
+	}
+	// The trace of a failed command is kept for inspection.
+	trace.Keep()
+	n := opts.TailLines
+	if n == 0 {
+		n = 50
+	}
+	ee.Details = append(ee.Details, Detail{Key: "trace_file", Value: file})
+	if trace, rerr := ioutil.ReadFile(file); rerr == nil {
+		ee.Details = append(ee.Details, Detail{Key: "trace_tail", Value: string(tail(trace, n))})
+	}
+	return res, err
+}
+
+// tracer returns a function which returns a Wrapper tracing the system
+// calls of commands into the specified file.
+func tracer() (func(file string) Wrapper, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("system call tracing is not supported on %s", runtime.GOOS)
+	}
+	if _, err := exec.LookPath("strace"); err != nil {
+		return nil, err
+	}
+	return StraceWrapper, nil
+}
+
+// tail returns the last n lines of b.
+func tail(b []byte, n int) []byte {
+	b = bytes.TrimRight(b, "\n")
+	i := len(b)
+	for ; n > 0 && i >= 0; n-- {
+		i = bytes.LastIndexByte(b[:i], '\n')
+	}
+	return b[i+1:]
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestDebug(t *testing.T) {
+	t.Run("Disabled", testDebugDisabled)
+	t.Run("Syscalls", testDebugSyscalls)
+	t.Run("Unavailable", testDebugUnavailable)
+}
+
+func testDebugDisabled(t *testing.T) {
+	_, err := execx.Debug(context.Background(), selfCmd("on"), execx.DebugOptions{})
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	for _, key := range []string{"trace", "trace_file", "trace_tail"} {
+		if _, ok := ee.Fields()[key]; ok {
+			t.Errorf("unexpected %s detail", key)
+		}
+	}
+}
+
+// fakeStrace installs a fake strace in $PATH, which writes 100 lines to
+// the trace file, then runs the command.
+func fakeStrace(t *testing.T) {
+	t.Helper()
+
+	dir := tempDir(t)
+	writeExecutable(t, filepath.Join(dir, "strace"), `#!/bin/sh
+# usage: strace -f -o file cmd args...
+out=$3
+shift 3
+i=1
+while [ $i -le 100 ]; do
+	echo "syscall $i" >> "$out"
+	i=$((i+1))
+done
+exec "$@"
+`)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func testDebugSyscalls(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("system call tracing is only supported on Linux")
+	}
+	fakeStrace(t)
+	file := filepath.Join(tempDir(t), "trace")
+	opts := execx.DebugOptions{Syscalls: true, TraceFile: file, TailLines: 3}
+	_, err := execx.Debug(context.Background(), selfCmd("on"), opts)
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	fields := ee.Fields()
+	if fields["trace_file"] != file {
+		t.Errorf("got trace file %v, want %q", fields["trace_file"], file)
+	}
+	if got, want := fields["trace_tail"], "syscall 98\nsyscall 99\nsyscall 100"; got != want {
+		t.Errorf("got trace tail %q, want %q", got, want)
+	}
+	if string(ee.Stderr) != "whoops" {
+		t.Errorf("got stderr %q, want %q", ee.Stderr, "whoops")
+	}
+}
+
+func testDebugUnavailable(t *testing.T) {
+	t.Setenv("PATH", tempDir(t))
+	_, err := execx.Debug(context.Background(), selfCmd("on"), execx.DebugOptions{Syscalls: true})
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	got := fmt.Sprint(ee.Fields()["trace"])
+	if !strings.HasPrefix(got, "unavailable: ") {
+		t.Errorf("got trace detail %q, want unavailable", got)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// debugOutputBytes is the amount of recent output shown by DebugHandler.
+const debugOutputBytes = 4 << 10
+
+// DebugHandler is an http.Handler which lists the commands started by
+// Start which are still running, in the spirit of net/http/pprof: their
+// command lines, process IDs, running times, and recent output, as per
+// Attach.
+//
+// GET requests return the list as plain text, or as JSON if the "format"
+// query parameter is "json". If the "view" query parameter is "latency",
+// GET requests return the latencies of the commands which completed, as
+// per Latencies, instead. If AllowSignals is set, POST requests with
+// the form values "pid" and "action", which is "terminate" or "kill",
+// stop the command with that PID, using Terminate or by killing it.
+//
+// The handler exposes command lines and output, which may be sensitive.
+// Like net/http/pprof, it should only be served on internal endpoints,
+// such as
+//
+//	http.Handle("/debug/execx", &execx.DebugHandler{})
+type DebugHandler struct {
+	// AllowSignals enables POST requests which stop commands.
+	AllowSignals bool
+}
+
+// DebugCommand describes a running command, as listed by DebugHandler.
+type DebugCommand struct {
+	Cmdline string        `json:"cmdline"`
+	PID     int           `json:"pid"`
+	Started time.Time     `json:"started"`
+	Running time.Duration `json:"running"`
+	Output  string        `json:"output"`
+}
+
+// RunningCommands returns descriptions of the commands started by Start
+// which are still running, ordered by PID.
+func RunningCommands() []DebugCommand {
+	children.Lock()
+	hs := make([]*Handle, 0, len(children.m))
+	for _, h := range children.m {
+		hs = append(hs, h)
+	}
+	children.Unlock()
+	cmds := make([]DebugCommand, 0, len(hs))
+	for _, h := range hs {
+		started := h.snapshot().Running
+		cmds = append(cmds, DebugCommand{
+			Cmdline: Cmdline(h.cmd),
+			PID:     h.cmd.Process.Pid,
+			Started: started,
+			Running: h.clock.Now().Sub(started),
+			Output:  string(h.attach.recent(debugOutputBytes)),
+		})
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].PID < cmds[j].PID })
+	return cmds
+}
+
+func (dh *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		dh.list(w, r)
+	case http.MethodPost:
+		if !dh.AllowSignals {
+			http.Error(w, "signals are not allowed", http.StatusForbidden)
+			return
+		}
+		dh.signal(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (dh *DebugHandler) list(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("view") == "latency" {
+		dh.latency(w, r)
+		return
+	}
+	cmds := RunningCommands()
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cmds)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%d running commands\n\n", len(cmds))
+	for _, c := range cmds {
+		tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+		fmt.Fprintf(tw, "pid\t%d\n", c.PID)
+		fmt.Fprintf(tw, "cmdline\t%s\n", c.Cmdline)
+		fmt.Fprintf(tw, "running\t%v (since %s)\n", c.Running.Round(time.Millisecond), c.Started.Format(time.RFC3339))
+		tw.Flush()
+		if c.Output != "" {
+			fmt.Fprintf(w, "recent output:\n%s\n", c.Output)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func (dh *DebugHandler) latency(w http.ResponseWriter, r *http.Request) {
+	snaps := Latencies()
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snaps)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "total\tcount\terrors\tp50\tp95\tp99\tmax\tcmdline\n")
+	round := func(d time.Duration) time.Duration { return d.Round(time.Microsecond) }
+	for _, s := range snaps {
+		fmt.Fprintf(tw, "%v\t%d\t%.1f%%\t%v\t%v\t%v\t%v\t%s\n", round(s.Total), s.Count, 100*s.ErrorRate(), round(s.P50), round(s.P95), round(s.P99), round(s.Max), s.Cmdline)
+	}
+	tw.Flush()
+}
+
+func (dh *DebugHandler) signal(w http.ResponseWriter, r *http.Request) {
+	pid, err := strconv.Atoi(r.FormValue("pid"))
+	if err != nil {
+		http.Error(w, "bad pid", http.StatusBadRequest)
+		return
+	}
+	children.Lock()
+	h := children.m[pid]
+	children.Unlock()
+	if h == nil {
+		http.Error(w, fmt.Sprintf("no running command with pid %d", pid), http.StatusNotFound)
+		return
+	}
+	switch action := r.FormValue("action"); action {
+	case "terminate":
+		err = h.terminate()
+	case "kill":
+		err = h.kill()
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %q", action), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s: %s\n", r.FormValue("action"), Cmdline(h.cmd))
+}
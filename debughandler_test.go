@@ -0,0 +1,91 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestDebugHandler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on SIGTERM")
+	}
+	cmd := selfCmd("sigterm")
+	h, err := execx.Start(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := cmd.Process.Pid
+	srv := httptest.NewServer(&execx.DebugHandler{})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cmds []execx.DebugCommand
+	err = json.NewDecoder(resp.Body).Decode(&cmds)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, c := range cmds {
+		if c.PID == pid {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("pid %d not listed in %+v", pid, cmds)
+	}
+
+	form := url.Values{"pid": {strconv.Itoa(pid)}, "action": {"terminate"}}
+	resp, err = http.PostForm(srv.URL, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("signal without AllowSignals: got status %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	// Give the command time to install its signal handler.
+	time.Sleep(100 * time.Millisecond)
+	admin := httptest.NewServer(&execx.DebugHandler{AllowSignals: true})
+	defer admin.Close()
+	resp, err = http.PostForm(admin.URL, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	_, err = h.Wait()
+	if ee, ok := err.(*execx.ExitError); !ok || !strings.Contains(string(ee.Stderr), "terminated") {
+		t.Fatalf("command not terminated: %v", err)
+	}
+}
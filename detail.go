@@ -0,0 +1,159 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// A Detail is a named piece of additional information about a command.
+type Detail struct {
+	Key   string
+	Value interface{}
+}
+
+// A Collector gathers a detail about a command which has exited, such as
+// the name of the CI job or Kubernetes pod it ran in. If the command failed
+// to start, ps is nil. If the returned key is empty, the detail is discarded.
+type Collector interface {
+	Collect(cmd *exec.Cmd, ps *os.ProcessState) (key string, value interface{})
+}
+
+// CollectorFunc is an adapter to allow the use of ordinary functions as
+// collectors.
+type CollectorFunc func(cmd *exec.Cmd, ps *os.ProcessState) (key string, value interface{})
+
+// Collect returns f(cmd, ps).
+func (f CollectorFunc) Collect(cmd *exec.Cmd, ps *os.ProcessState) (key string, value interface{}) {
+	return f(cmd, ps)
+}
+
+var collectors struct {
+	sync.Mutex
+	list []*registeredCollector
+}
+
+// registeredCollector is a collector registered using RegisterCollector.
+// Collectors are registered by pointer, since they need not be comparable.
+type registeredCollector struct {
+	c Collector
+}
+
+// RegisterCollector registers a collector which gathers details for every
+// *ExitError produced by this package. The returned function unregisters
+// the collector. It is safe to call more than once. RegisterCollector is
+// safe to call from multiple goroutines concurrently.
+func RegisterCollector(c Collector) (unregister func()) {
+	collectors.Lock()
+	defer collectors.Unlock()
+	rc := &registeredCollector{c: c}
+	collectors.list = append(collectors.list, rc)
+	return func() {
+		collectors.Lock()
+		defer collectors.Unlock()
+		for i, other := range collectors.list {
+			if other == rc {
+				collectors.list = append(collectors.list[:i:i], collectors.list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// collect gathers details from registered collectors, followed by extra.
+func collect(cmd *exec.Cmd, ps *os.ProcessState, extra []Collector) []Detail {
+	collectors.Lock()
+	all := make([]Collector, 0, len(collectors.list)+len(extra))
+	for _, rc := range collectors.list {
+		all = append(all, rc.c)
+	}
+	collectors.Unlock()
+	all = append(all, extra...)
+
+	var details []Detail
+	for _, c := range all {
+		key, value := c.Collect(cmd, ps)
+		if key == "" {
+			continue
+		}
+		details = append(details, Detail{Key: key, Value: value})
+	}
+	return details
+}
+
+// detailMap returns details as a map, or nil if there are no details.
+func detailMap(details []Detail) map[string]interface{} {
+	if len(details) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(details))
+	for _, d := range details {
+		m[d.Key] = d.Value
+	}
+	return m
+}
+
+// WithDetail annotates the first *ExitError or *StartError in the chain of
+// err with the detail named key, replacing any previous detail of the same
+// name, and returns err. It allows intermediate layers to add context, such
+// as the repository or attempt number, to a propagating error. Details are
+// shown by %+v, and included in JSON and Fields output. If err carries
+// neither an *ExitError nor a *StartError, WithDetail returns err unchanged.
+func WithDetail(err error, key string, value interface{}) error {
+	var ee *ExitError
+	var se *StartError
+	switch {
+	case errors.As(err, &ee):
+		ee.Details = setDetail(ee.Details, key, value)
+		ee.invalidate()
+	case errors.As(err, &se):
+		se.Details = setDetail(se.Details, key, value)
+	}
+	return err
+}
+
+// Detail returns the value of the detail named key, and reports whether
+// it is present.
+func (e *ExitError) Detail(key string) (interface{}, bool) {
+	return lookupDetail(e.Details, key)
+}
+
+// Detail returns the value of the detail named key, and reports whether
+// it is present.
+func (e *StartError) Detail(key string) (interface{}, bool) {
+	return lookupDetail(e.Details, key)
+}
+
+func setDetail(details []Detail, key string, value interface{}) []Detail {
+	for i := range details {
+		if details[i].Key == key {
+			details[i].Value = value
+			return details
+		}
+	}
+	return append(details, Detail{Key: key, Value: value})
+}
+
+func lookupDetail(details []Detail, key string) (interface{}, bool) {
+	for _, d := range details {
+		if d.Key == key {
+			return d.Value, true
+		}
+	}
+	return nil, false
+}
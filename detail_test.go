@@ -0,0 +1,121 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestCollectors(t *testing.T) {
+	t.Run("PerCall", testCollectorsPerCall)
+	t.Run("Registered", testCollectorsRegistered)
+}
+
+func testCollectorsPerCall(t *testing.T) {
+	err, self := execSelf()
+	sha := execx.CollectorFunc(func(cmd *exec.Cmd, ps *os.ProcessState) (string, interface{}) {
+		return "git_sha", "abc123"
+	})
+	ee := execx.WrapWith(err, self, sha).(*execx.ExitError)
+	checkDetail(t, ee, "git_sha", "abc123")
+}
+
+func testCollectorsRegistered(t *testing.T) {
+	unregister := execx.RegisterCollector(execx.CollectorFunc(func(cmd *exec.Cmd, ps *os.ProcessState) (string, interface{}) {
+		for _, kv := range cmd.Env {
+			if kv == "EXECX_COLLECT=on" {
+				return "ci_job", 42
+			}
+		}
+		return "", nil
+	}))
+	t.Cleanup(unregister)
+	err, self := execSelf()
+	ee := execx.Wrap(err, self).(*execx.ExitError)
+	if len(ee.Details) != 0 {
+		t.Fatalf("got details %v for uninteresting command", ee.Details)
+	}
+
+	self = exec.Command(os.Args[0])
+	self.Env = append(os.Environ(), "EXECX_TEST=on", "EXECX_COLLECT=on")
+	err = self.Run()
+	ee = execx.Wrap(err, self).(*execx.ExitError)
+	checkDetail(t, ee, "ci_job", 42)
+
+	unregister()
+	if ee = execx.Wrap(err, self).(*execx.ExitError); len(ee.Details) != 0 {
+		t.Errorf("got details %v after unregistering the collector", ee.Details)
+	}
+}
+
+func checkDetail(t *testing.T, ee *execx.ExitError, key string, value interface{}) {
+	t.Helper()
+
+	if len(ee.Details) != 1 {
+		t.Fatalf("got %d details, want 1", len(ee.Details))
+	}
+	if d := ee.Details[0]; d.Key != key || d.Value != value {
+		t.Fatalf("got detail %v, want {%s %v}", d, key, value)
+	}
+	if got := ee.Fields()[key]; got != value {
+		t.Errorf("Fields()[%q] = %v, want %v", key, got, value)
+	}
+	if !strings.Contains(fmt.Sprintf("%+v", ee), fmt.Sprintf("%s: %v", key, value)) {
+		t.Errorf("detail missing from %%+v output")
+	}
+	b, err := json.Marshal(ee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), fmt.Sprintf("%q:", key)) {
+		t.Errorf("detail missing from JSON output: %s", b)
+	}
+}
+
+func TestWithDetail(t *testing.T) {
+	err, self := execSelf()
+	ee := execx.Wrap(err, self).(*execx.ExitError)
+	wrapped := fmt.Errorf("syncing repo: %w", ee)
+
+	if got := execx.WithDetail(wrapped, "attempt", 1); got != wrapped {
+		t.Fatalf("WithDetail returned %v, want the original error", got)
+	}
+	execx.WithDetail(wrapped, "attempt", 3)
+	checkDetail(t, ee, "attempt", 3)
+	if v, ok := ee.Detail("attempt"); !ok || v != 3 {
+		t.Errorf("Detail(%q) = %v, %t, want 3, true", "attempt", v, ok)
+	}
+	if _, ok := ee.Detail("repo"); ok {
+		t.Errorf("Detail(%q) found a detail which was never set", "repo")
+	}
+
+	se := &execx.StartError{Err: os.ErrNotExist}
+	execx.WithDetail(se, "repo", "execx")
+	if v, ok := se.Detail("repo"); !ok || v != "execx" {
+		t.Errorf("StartError.Detail(%q) = %v, %t, want execx, true", "repo", v, ok)
+	}
+
+	plain := os.ErrNotExist
+	if got := execx.WithDetail(plain, "repo", "execx"); got != plain {
+		t.Errorf("WithDetail changed an error carrying no *ExitError: %v", got)
+	}
+}
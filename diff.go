@@ -0,0 +1,188 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DiffErrors returns a human-readable description of the differences
+// between two failures: the path and arguments of the commands, their
+// working directories, exit codes, environments, and standard error
+// output. It is useful for comparing a failure on a CI machine with a
+// failure of the same command on a developer machine. If the failures
+// do not differ in any of these respects, DiffErrors returns the empty
+// string.
+//
+// Lines prefixed with "-" describe a, and lines prefixed with "+"
+// describe b. Standard error output is compared line by line. The values
+// of sensitive environment variables are redacted, as per RedactEnv.
+func DiffErrors(a, b *ExitError) string {
+	var d errorDiff
+	d.field("path", a.Path, b.Path)
+	d.field("args", quoteArgs(a.Args), quoteArgs(b.Args))
+	d.field("dir", a.Dir, b.Dir)
+	d.field("exit code", exitCodeString(a), exitCodeString(b))
+	d.env(RedactEnv(a.ChildEnv), RedactEnv(b.ChildEnv))
+	d.lines("stderr", stderrLines(a), stderrLines(b))
+	return d.String()
+}
+
+// errorDiff accumulates the differences between two failures.
+type errorDiff struct {
+	sb strings.Builder
+}
+
+// field records the difference between two values of a single-line field.
+func (d *errorDiff) field(name, a, b string) {
+	if a == b {
+		return
+	}
+	fmt.Fprintf(&d.sb, "%s:\n\t- %s\n\t+ %s\n", name, a, b)
+}
+
+// env records the variables which are set in only one of the two
+// environments, or set to different values.
+func (d *errorDiff) env(a, b map[string]string) {
+	keys := make(map[string]bool)
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	var lines []string
+	for _, k := range sorted {
+		va, oka := a[k]
+		vb, okb := b[k]
+		if oka == okb && va == vb {
+			continue
+		}
+		if oka {
+			lines = append(lines, fmt.Sprintf("\t- %s=%s", k, quoteEnvValue(va)))
+		}
+		if okb {
+			lines = append(lines, fmt.Sprintf("\t+ %s=%s", k, quoteEnvValue(vb)))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(&d.sb, "env:\n%s\n", strings.Join(lines, "\n"))
+}
+
+// lines records a line by line diff of a and b. Lines common to both
+// are printed as context.
+func (d *errorDiff) lines(name string, a, b []string) {
+	if equalStrings(a, b) {
+		return
+	}
+	fmt.Fprintf(&d.sb, "%s:\n", name)
+	for _, l := range diffLines(a, b) {
+		fmt.Fprintf(&d.sb, "\t%c %s\n", l.op, l.text)
+	}
+}
+
+func (d *errorDiff) String() string {
+	return d.sb.String()
+}
+
+// diffLine is a line in a diff: op is '-', '+' or ' '.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines computes a minimal line diff of a and b, using the longest
+// common subsequence. Standard error output is usually short, so the
+// quadratic cost is acceptable.
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, diffLine{'-', a[i]})
+			i++
+		default:
+			out = append(out, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, diffLine{'+', b[j]})
+	}
+	return out
+}
+
+// exitCodeString returns the exit code of e, as a string. If e does not
+// wrap an *exec.ExitError, such as when it was built from a serialized
+// failure, the exit code is unknown.
+func exitCodeString(e *ExitError) string {
+	if e.ExitError == nil {
+		return "unknown"
+	}
+	return strconv.Itoa(e.ExitCode())
+}
+
+// stderrLines returns the standard error output of e, split into lines.
+func stderrLines(e *ExitError) []string {
+	if e.ExitError == nil || len(e.ExitError.Stderr) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(e.ExitError.Stderr), "\n"), "\n")
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
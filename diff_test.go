@@ -0,0 +1,97 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strconv"
+	"testing"
+
+	"acln.ro/env"
+	"acln.ro/execx"
+)
+
+func TestDiffErrors(t *testing.T) {
+	t.Run("Same", testDiffErrorsSame)
+	t.Run("Different", testDiffErrorsDifferent)
+	t.Run("Stderr", testDiffErrorsStderr)
+}
+
+func testDiffErrorsSame(t *testing.T) {
+	a := failure(t, selfCmd("on"))
+	b := failure(t, selfCmd("on"))
+	if diff := execx.DiffErrors(a, b); diff != "" {
+		t.Errorf("got diff for identical failures:\n%s", diff)
+	}
+}
+
+func testDiffErrorsDifferent(t *testing.T) {
+	a := failure(t, selfCmd("on"))
+	cmd := selfCmd("on")
+	cmd.Args = append(cmd.Args, "-v", "two words")
+	cmd.Dir = tempDir(t)
+	cmd.Env = append(cmd.Env, "EXECX_CI=true", "EXECX_TOKEN=hunter2")
+	b := failure(t, cmd)
+
+	diff := execx.DiffErrors(a, b)
+	want := "args:\n" +
+		"\t- " + a.Args[0] + "\n" +
+		"\t+ " + a.Args[0] + " -v 'two words'\n" +
+		"dir:\n" +
+		"\t- " + a.Dir + "\n" +
+		"\t+ " + b.Dir + "\n" +
+		"env:\n" +
+		"\t+ EXECX_CI=true\n" +
+		"\t+ EXECX_TOKEN=" + strconv.Quote(execx.Redacted) + "\n"
+	if diff != want {
+		t.Errorf("got diff\n%s\nwant\n%s", diff, want)
+	}
+}
+
+func testDiffErrorsStderr(t *testing.T) {
+	a := &execx.ExitError{
+		ExitError: &exec.ExitError{Stderr: []byte("compiling\nerror: old\ndone\n")},
+		ChildEnv:  env.Map{"GOFLAGS": "-mod=mod"},
+	}
+	b := &execx.ExitError{
+		ExitError: &exec.ExitError{Stderr: []byte("compiling\nerror: new\ndone\n")},
+		ChildEnv:  env.Map{"GOFLAGS": "-mod=readonly"},
+	}
+	diff := execx.DiffErrors(a, b)
+	want := "env:\n" +
+		"\t- GOFLAGS=-mod=mod\n" +
+		"\t+ GOFLAGS=-mod=readonly\n" +
+		"stderr:\n" +
+		"\t  compiling\n" +
+		"\t- error: old\n" +
+		"\t+ error: new\n" +
+		"\t  done\n"
+	if diff != want {
+		t.Errorf("got diff\n%s\nwant\n%s", diff, want)
+	}
+}
+
+// failure runs cmd, which is expected to fail, and returns the error.
+func failure(t *testing.T, cmd *exec.Cmd) *execx.ExitError {
+	t.Helper()
+	_, err := execx.Run(context.Background(), cmd)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	return ee
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// InDir runs the command in the specified working directory, overriding
+// cmd.Dir.
+func InDir(dir string) Option {
+	return func(cfg *config) {
+		cfg.dir = dir
+	}
+}
+
+// WithStep records the logical name of the step the command performs, such
+// as "generate" or "vet", as a detail named "step" in errors produced by
+// the command.
+func WithStep(name string) Option {
+	return WithCollectors(CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "step", name
+	}))
+}
+
+// A DirStack runs sequences of commands across directories, with the
+// semantics of the pushd and popd shell builtins. The zero value is a
+// stack holding the working directory of the current process.
+//
+// Errors produced by commands run by a DirStack carry both the logical
+// name of the step, as per WithStep, and the directory the command ran in.
+//
+// A DirStack is not safe for concurrent use.
+type DirStack struct {
+	base string   // initial directory
+	dirs []string // pushed directories
+}
+
+// NewDirStack returns a stack holding dir.
+func NewDirStack(dir string) *DirStack {
+	return &DirStack{base: dir}
+}
+
+// Dir returns the directory at the top of the stack. An empty string
+// refers to the working directory of the current process.
+func (s *DirStack) Dir() string {
+	if len(s.dirs) == 0 {
+		return s.base
+	}
+	return s.dirs[len(s.dirs)-1]
+}
+
+// Push pushes dir onto the stack. If dir is relative, it is interpreted
+// relative to the directory at the top of the stack.
+func (s *DirStack) Push(dir string) {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(s.Dir(), dir)
+	}
+	s.dirs = append(s.dirs, dir)
+}
+
+// Pop removes the directory at the top of the stack, and returns the
+// directory which is now at the top. Pop panics if the stack holds only
+// its initial directory.
+func (s *DirStack) Pop() string {
+	if len(s.dirs) == 0 {
+		panic("execx: DirStack: Pop of initial directory")
+	}
+	s.dirs = s.dirs[:len(s.dirs)-1]
+	return s.Dir()
+}
+
+// Run runs cmd in the directory at the top of the stack, as per Run,
+// and records step as the logical name of the step cmd performs. Options
+// in opts are applied after those set by Run.
+func (s *DirStack) Run(ctx context.Context, step string, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	opts = append([]Option{InDir(s.Dir()), WithStep(step)}, opts...)
+	return Run(ctx, cmd, opts...)
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestInDir(t *testing.T) {
+	dir := tempDir(t)
+	self := selfCmd("on")
+	_, err := execx.Run(context.Background(), self, execx.InDir(dir))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Dir != dir {
+		t.Fatalf("Dir = %q, want %q", ee.Dir, dir)
+	}
+}
+
+func TestDirStack(t *testing.T) {
+	root := tempDir(t)
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s := execx.NewDirStack(root)
+	s.Push("sub")
+	if got := s.Dir(); got != sub {
+		t.Fatalf("after Push: Dir() = %q, want %q", got, sub)
+	}
+
+	_, err := s.Run(context.Background(), "fail", selfCmd("on"))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Dir != sub {
+		t.Errorf("Dir = %q, want %q", ee.Dir, sub)
+	}
+	if got := ee.Fields()["step"]; got != "fail" {
+		t.Errorf("step = %v, want %q", got, "fail")
+	}
+
+	if got := s.Pop(); got != root {
+		t.Fatalf("Pop() = %q, want %q", got, root)
+	}
+	if _, err := s.Run(context.Background(), "echo", selfCmd("echo")); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Pop of initial directory did not panic")
+		}
+	}()
+	s.Pop()
+}
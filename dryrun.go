@@ -0,0 +1,256 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"acln.ro/env"
+)
+
+// A DryRun describes the commands a Plan or Steps would run, in order,
+// without running them, such that tools can show users what is about to
+// happen before asking them to confirm.
+type DryRun struct {
+	Commands []PlannedCommand
+}
+
+// A PlannedCommand describes a command which would run.
+type PlannedCommand struct {
+	// Name is the name of the task or of the step.
+	Name string
+
+	// Argv holds the command line arguments, starting with the name
+	// of the program.
+	Argv []string
+
+	// Dir is the working directory of the command, if it differs from
+	// the working directory of the current process.
+	Dir string
+
+	// Env holds the variables which the command sets or overrides,
+	// relative to the environment of the current process.
+	Env map[string]string
+
+	// After holds the names of the commands which must complete
+	// successfully before the command runs.
+	After []string
+
+	// Timeout bounds the running time of the command, if positive.
+	Timeout time.Duration
+
+	// Retries is the number of times the command is re-run if it fails.
+	Retries int
+
+	// OnFailure is the step policy of the command, for Steps.
+	OnFailure string
+}
+
+// jsonPlannedCommand is the JSON representation of a PlannedCommand.
+type jsonPlannedCommand struct {
+	Name      string            `json:"name"`
+	Argv      []string          `json:"argv"`
+	Dir       string            `json:"dir,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	After     []string          `json:"after,omitempty"`
+	Timeout   string            `json:"timeout,omitempty"`
+	Retries   int               `json:"retries,omitempty"`
+	OnFailure string            `json:"on_failure,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler for *DryRun. Timeouts are written
+// in the format accepted by time.ParseDuration, as in manifests.
+func (d *DryRun) MarshalJSON() ([]byte, error) {
+	commands := make([]jsonPlannedCommand, 0, len(d.Commands))
+	for _, c := range d.Commands {
+		jc := jsonPlannedCommand{
+			Name:      c.Name,
+			Argv:      c.Argv,
+			Dir:       c.Dir,
+			Env:       c.Env,
+			After:     c.After,
+			Retries:   c.Retries,
+			OnFailure: c.OnFailure,
+		}
+		if c.Timeout > 0 {
+			jc.Timeout = c.Timeout.String()
+		}
+		commands = append(commands, jc)
+	}
+	return json.Marshal(struct {
+		Commands []jsonPlannedCommand `json:"commands"`
+	}{commands})
+}
+
+// WriteText writes d to w in the style of make -n: a shell script, in
+// which each command is preceded by a comment naming it, and describing
+// how it is run. Commands which run in a different directory run in a
+// subshell.
+func (d *DryRun) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range d.Commands {
+		if i > 0 {
+			fmt.Fprintf(bw, "\n")
+		}
+		fmt.Fprintf(bw, "# %d: %s%s\n", i+1, c.Name, c.annotations())
+		line := quoteArgs(c.Argv)
+		keys := make([]string, 0, len(c.Env))
+		for k := range c.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for j := len(keys) - 1; j >= 0; j-- {
+			line = keys[j] + "=" + shellQuote(c.Env[keys[j]]) + " " + line
+		}
+		if c.Dir != "" {
+			line = fmt.Sprintf("(cd %s && %s)", shellQuote(c.Dir), line)
+		}
+		fmt.Fprintf(bw, "%s\n", line)
+	}
+	return bw.Flush()
+}
+
+// String returns the text written by WriteText.
+func (d *DryRun) String() string {
+	var sb strings.Builder
+	d.WriteText(&sb)
+	return sb.String()
+}
+
+// annotations returns a parenthesized description of the way c is run,
+// or the empty string if c is run in the default way.
+func (c *PlannedCommand) annotations() string {
+	var notes []string
+	if len(c.After) > 0 {
+		notes = append(notes, "after "+strings.Join(c.After, ", "))
+	}
+	if c.Timeout > 0 {
+		notes = append(notes, "timeout "+c.Timeout.String())
+	}
+	if c.Retries > 0 {
+		notes = append(notes, fmt.Sprintf("retries %d", c.Retries))
+	}
+	if c.OnFailure != "" && c.OnFailure != StepAbort.String() {
+		notes = append(notes, "on failure "+c.OnFailure)
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(notes, "; ") + ")"
+}
+
+// DryRun describes the tasks in p, in an order in which they could run
+// sequentially: every task follows its dependencies, and tasks are
+// otherwise in the order they were declared. Run may run independent
+// tasks concurrently.
+func (p *Plan) DryRun() *DryRun {
+	d := new(DryRun)
+	seen := make(map[string]bool)
+	var visit func(t *Task)
+	visit = func(t *Task) {
+		if seen[t.Name] {
+			return
+		}
+		seen[t.Name] = true
+		for _, dep := range t.Deps {
+			visit(p.byName[dep])
+		}
+		d.Commands = append(d.Commands, PlannedCommand{
+			Name:    t.Name,
+			Argv:    t.Argv,
+			Dir:     t.Dir,
+			Env:     t.Env,
+			After:   t.Deps,
+			Timeout: t.Timeout,
+			Retries: t.Retries,
+		})
+	}
+	for _, t := range p.Tasks {
+		visit(t)
+	}
+	return d
+}
+
+// DryRunSteps describes the commands Steps would run. Working directories
+// and environment variables set using InDir, WithEnv and WithDefaultEnv
+// in the options of the steps are taken into account, as are timeouts
+// set using WithTimeout.
+func DryRunSteps(steps ...ScriptStep) *DryRun {
+	d := new(DryRun)
+	parent := env.Variables()
+	for i := range steps {
+		s := &steps[i]
+		cfg := newConfig(s.Opts)
+		c := PlannedCommand{
+			Name:      s.name(),
+			Argv:      s.Cmd.Args,
+			Dir:       s.Cmd.Dir,
+			Env:       envOverrides(parent, s.Cmd, cfg),
+			Timeout:   cfg.timeout,
+			OnFailure: s.OnFailure.String(),
+		}
+		if cfg.dir != "" {
+			c.Dir = cfg.dir
+		}
+		if len(c.Argv) == 0 {
+			c.Argv = []string{s.Cmd.Path}
+		}
+		d.Commands = append(d.Commands, c)
+	}
+	return d
+}
+
+// envOverrides returns the variables which cmd, configured by cfg, sets
+// or overrides relative to parent, or nil if there are none.
+func envOverrides(parent env.Map, cmd *exec.Cmd, cfg *config) map[string]string {
+	child := parent
+	if cmd.Env != nil {
+		child = env.Parse(cmd.Env...)
+	}
+	overrides := make(map[string]string)
+	for k, v := range child {
+		if pv, ok := parent[k]; !ok || pv != v {
+			overrides[k] = v
+		}
+	}
+	// Unknown profiles are reported when the command starts.
+	settings, _ := cfg.envSettings()
+	for _, s := range settings {
+		if !s.dflt {
+			continue
+		}
+		if _, ok := child[s.key]; !ok {
+			overrides[s.key] = s.value
+		}
+	}
+	for _, origin := range []EnvOrigin{EnvProfile, EnvExplicit} {
+		for _, s := range settings {
+			if s.src.Origin == origin && !s.dflt {
+				overrides[s.key] = s.value
+			}
+		}
+	}
+	if len(overrides) == 0 {
+		return nil
+	}
+	return overrides
+}
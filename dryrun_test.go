@@ -0,0 +1,70 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"encoding/json"
+	"os/exec"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestPlanDryRun(t *testing.T) {
+	plan, err := execx.NewPlan(
+		&execx.Task{Name: "test", Argv: []string{"go", "test", "./..."}, Deps: []string{"generate"}, Dir: "src", Env: map[string]string{"GOFLAGS": "-mod=readonly"}, Timeout: 5 * time.Minute},
+		&execx.Task{Name: "generate", Argv: []string{"go", "generate", "./..."}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := plan.DryRun()
+	want := `# 1: generate
+go generate ./...
+
+# 2: test (after generate; timeout 5m0s)
+(cd src && GOFLAGS=-mod=readonly go test ./...)
+`
+	if got := d.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON := `{"commands":[{"name":"generate","argv":["go","generate","./..."]},{"name":"test","argv":["go","test","./..."],"dir":"src","env":{"GOFLAGS":"-mod=readonly"},"after":["generate"],"timeout":"5m0s"}]}`
+	if string(b) != wantJSON {
+		t.Errorf("got %s, want %s", b, wantJSON)
+	}
+}
+
+func TestDryRunSteps(t *testing.T) {
+	build := exec.Command("make", "all")
+	build.Dir = "/src"
+	d := execx.DryRunSteps(
+		execx.ScriptStep{Name: "build", Cmd: build, Opts: []execx.Option{execx.WithEnv("CC", "clang")}},
+		execx.ScriptStep{Name: "lint", Cmd: exec.Command("golint", "it's"), OnFailure: execx.StepContinue},
+	)
+	want := `# 1: build
+(cd /src && CC=clang make all)
+
+# 2: lint (on failure continue)
+golint 'it'\''s'
+`
+	if got := d.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
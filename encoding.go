@@ -0,0 +1,168 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// A Decoder transcodes text from some encoding to UTF-8. The decoders
+// produced by golang.org/x/text/encoding.Encoding.NewDecoder implement
+// Decoder, so any encoding supported by golang.org/x/text, such as
+// Shift-JIS, can be used.
+type Decoder interface {
+	Bytes(b []byte) ([]byte, error)
+}
+
+// Built-in decoders.
+var (
+	// Latin1 decodes ISO 8859-1.
+	Latin1 Decoder = singleByteDecoder(func(b byte) rune {
+		return rune(b)
+	})
+
+	// Windows1252 decodes Windows code page 1252.
+	Windows1252 Decoder = singleByteDecoder(func(b byte) rune {
+		if 0x80 <= b && b <= 0x9f {
+			return cp1252[b-0x80]
+		}
+		return rune(b)
+	})
+
+	// UTF16LE decodes little endian UTF-16.
+	UTF16LE Decoder = utf16Decoder{binary.LittleEndian}
+
+	// UTF16BE decodes big endian UTF-16.
+	UTF16BE Decoder = utf16Decoder{binary.BigEndian}
+
+	// AutoDetect guesses the encoding of the text. Text which starts
+	// with a byte order mark is decoded accordingly. Text which is
+	// valid UTF-8 is left unchanged. Text which looks like UTF-16
+	// without a byte order mark is decoded as such. Otherwise, the
+	// text is decoded as Windows code page 1252.
+	AutoDetect Decoder = autoDecoder{}
+)
+
+// WithOutputEncoding transcodes captured standard output and standard
+// error of the command from the encoding decoded by d to UTF-8, before
+// storing them in the Result and *ExitError. If transcoding fails, the
+// output is stored unchanged.
+func WithOutputEncoding(d Decoder) Option {
+	return func(cfg *config) {
+		cfg.decoder = d
+	}
+}
+
+// decode transcodes b using d. If d is nil or fails, decode returns b.
+func decode(d Decoder, b []byte) []byte {
+	if d == nil || b == nil {
+		return b
+	}
+	decoded, err := d.Bytes(b)
+	if err != nil {
+		return b
+	}
+	return decoded
+}
+
+// cp1252 maps bytes 0x80 through 0x9f in Windows code page 1252. Bytes
+// which are undefined in the code page map to the corresponding C1 control
+// characters.
+var cp1252 = [32]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+}
+
+// singleByteDecoder decodes single byte encodings.
+type singleByteDecoder func(b byte) rune
+
+func (d singleByteDecoder) Bytes(b []byte) ([]byte, error) {
+	buf := make([]byte, 0, len(b))
+	for _, c := range b {
+		buf = appendRune(buf, d(c))
+	}
+	return buf, nil
+}
+
+// utf16Decoder decodes UTF-16 text, skipping a leading byte order mark.
+type utf16Decoder struct {
+	order binary.ByteOrder
+}
+
+func (d utf16Decoder) Bytes(b []byte) ([]byte, error) {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, d.order.Uint16(b[i:]))
+	}
+	if len(units) > 0 && units[0] == 0xfeff {
+		units = units[1:]
+	}
+	buf := make([]byte, 0, len(b))
+	for _, r := range utf16.Decode(units) {
+		buf = appendRune(buf, r)
+	}
+	if len(b)%2 != 0 {
+		buf = appendRune(buf, utf8.RuneError)
+	}
+	return buf, nil
+}
+
+// autoDecoder implements AutoDetect.
+type autoDecoder struct{}
+
+func (autoDecoder) Bytes(b []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return b[3:], nil
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return UTF16LE.Bytes(b)
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		return UTF16BE.Bytes(b)
+	case looksLikeUTF16(b, 1):
+		return UTF16LE.Bytes(b)
+	case looksLikeUTF16(b, 0):
+		return UTF16BE.Bytes(b)
+	case utf8.Valid(b):
+		return b, nil
+	default:
+		return Windows1252.Bytes(b)
+	}
+}
+
+// looksLikeUTF16 reports whether b looks like mostly-ASCII UTF-16 text,
+// by checking that most bytes at the specified parity are zero.
+func looksLikeUTF16(b []byte, parity int) bool {
+	if len(b) < 2 || len(b)%2 != 0 {
+		return false
+	}
+	zeros := 0
+	for i := parity; i < len(b); i += 2 {
+		if b[i] == 0 {
+			zeros++
+		}
+	}
+	return zeros*4 >= len(b)/2*3
+}
+
+func appendRune(buf []byte, r rune) []byte {
+	var tmp [utf8.UTFMax]byte
+	n := utf8.EncodeRune(tmp[:], r)
+	return append(buf, tmp[:n]...)
+}
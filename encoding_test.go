@@ -0,0 +1,63 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		name string
+		d    execx.Decoder
+		in   []byte
+		want string
+	}{
+		{"Latin1", execx.Latin1, []byte("caf\xe9"), "café"},
+		{"Windows1252", execx.Windows1252, []byte("\x93quoted\x94 \x80"), "“quoted” €"},
+		{"UTF16LE", execx.UTF16LE, []byte("h\x00i\x00"), "hi"},
+		{"UTF16BE", execx.UTF16BE, []byte("\xfe\xff\x00h\x00i"), "hi"},
+		{"AutoUTF8", execx.AutoDetect, []byte("café"), "café"},
+		{"AutoBOM", execx.AutoDetect, []byte("\xff\xfeh\x00i\x00"), "hi"},
+		{"AutoUTF16", execx.AutoDetect, []byte("e\x00r\x00r\x00"), "err"},
+		{"Auto1252", execx.AutoDetect, []byte("caf\xe9"), "café"},
+	}
+	for _, tt := range tests {
+		got, err := tt.d.Bytes(tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithOutputEncoding(t *testing.T) {
+	self := selfCmd("echo")
+	self.Stdin = bytes.NewReader([]byte("caf\xe9"))
+	res, err := execx.Run(context.Background(), self, execx.WithOutputEncoding(execx.Windows1252))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Stdout); got != "café" {
+		t.Errorf("got stdout %q, want %q", got, "café")
+	}
+}
@@ -0,0 +1,422 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// An EndpointKind is a kind of file system endpoint to which a standard
+// stream of a command can be connected.
+type EndpointKind int
+
+// Endpoint kinds.
+const (
+	// UnixSocket is a UNIX domain stream socket, created by
+	// WithUnixSocket.
+	UnixSocket EndpointKind = iota
+
+	// NamedPipe is a named pipe, or FIFO, created by WithNamedPipe.
+	NamedPipe
+)
+
+func (k EndpointKind) String() string {
+	switch k {
+	case UnixSocket:
+		return "UNIX socket"
+	case NamedPipe:
+		return "named pipe"
+	default:
+		return fmt.Sprintf("EndpointKind(%d)", int(k))
+	}
+}
+
+// An EndpointState is a state of an endpoint created by WithUnixSocket or
+// WithNamedPipe.
+type EndpointState int
+
+// Endpoint states, in the order in which endpoints go through them.
+const (
+	// EndpointListening means the endpoint was created, and waits for
+	// a peer to connect.
+	EndpointListening EndpointState = iota
+
+	// EndpointConnected means a peer connected to the endpoint.
+	EndpointConnected
+
+	// EndpointAbandoned means no peer connected to the endpoint in
+	// time.
+	EndpointAbandoned
+
+	// EndpointClosed means the connection to the peer was closed.
+	EndpointClosed
+)
+
+func (s EndpointState) String() string {
+	switch s {
+	case EndpointListening:
+		return "listening"
+	case EndpointConnected:
+		return "connected"
+	case EndpointAbandoned:
+		return "abandoned"
+	case EndpointClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("EndpointState(%d)", int(s))
+	}
+}
+
+// An EndpointEvent records a state transition of an endpoint, in a
+// Timeline.
+type EndpointEvent struct {
+	Stream string // "stdin", "stdout" or "stderr"
+	State  EndpointState
+	Time   time.Time
+}
+
+// WithUnixSocket connects the standard stream of the command named by
+// stream, which must be "stdin", "stdout" or "stderr", to the first peer
+// which connects to a UNIX domain socket which Start creates at path. The
+// command reads its standard input from the peer, or writes its output to
+// the peer. The corresponding field of the exec.Cmd must not be set.
+//
+// Start does not wait for the peer to connect. Until it does, the input
+// of the command blocks, and so does its output, once the pipe buffer is
+// full. If timeout is positive, the peer must connect within timeout of
+// the start of the command. Otherwise, it must connect before the command
+// exits. If no peer connects in time, or if the context passed to Start
+// is done before one does, the endpoint is abandoned: the command reads
+// the end of its input, or its output is discarded, and the command fails
+// with an *EndpointError, unless it fails otherwise, in which case the
+// *ExitError carries the *EndpointError as a detail named
+// "endpoint_errors".
+//
+// The socket is removed once a peer connects, or once the endpoint is
+// abandoned. The transitions of the endpoint are recorded in the
+// Endpoints field of the Timeline of the command.
+func WithUnixSocket(stream, path string, timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.endpoints = append(cfg.endpoints, endpointSpec{stream: stream, kind: UnixSocket, path: path, timeout: timeout})
+	}
+}
+
+// WithNamedPipe is like WithUnixSocket, but creates a named pipe at path,
+// such that the peer opens path for writing, to send input to the command,
+// or for reading, to receive its output. Named pipes are not supported on
+// Windows and Plan 9.
+func WithNamedPipe(stream, path string, timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.endpoints = append(cfg.endpoints, endpointSpec{stream: stream, kind: NamedPipe, path: path, timeout: timeout})
+	}
+}
+
+// An EndpointError records that no peer connected to an endpoint created
+// by WithUnixSocket or WithNamedPipe.
+type EndpointError struct {
+	Stream  string // "stdin", "stdout" or "stderr"
+	Kind    EndpointKind
+	Path    string
+	Timeout time.Duration // as passed to WithUnixSocket or WithNamedPipe
+}
+
+func (e *EndpointError) Error() string {
+	role := "read the " + e.Stream + " of the command"
+	if e.Stream == "stdin" {
+		role = "write the stdin of the command"
+	}
+	when := "before the command exited"
+	if e.Timeout > 0 {
+		when = fmt.Sprintf("within %v", e.Timeout)
+	}
+	return fmt.Sprintf("execx: %s: no peer connected to the %v at %s to %s %s", e.Stream, e.Kind, e.Path, role, when)
+}
+
+// endpointSpec describes an endpoint requested by WithUnixSocket or
+// WithNamedPipe.
+type endpointSpec struct {
+	stream  string
+	kind    EndpointKind
+	path    string
+	timeout time.Duration
+}
+
+// endpoint is an endpoint to which a standard stream of a command is
+// connected.
+type endpoint struct {
+	endpointSpec
+	h   *Handle
+	ln  net.Listener // for UnixSocket
+	res *Tracked     // tracks the socket or the pipe
+
+	ready chan struct{} // closed once connected or abandoned
+
+	mu     sync.Mutex // protects the fields below
+	conn   io.ReadWriteCloser
+	done   bool // connected or abandoned
+	closed bool
+}
+
+// openEndpoints creates the endpoints requested by WithUnixSocket and
+// WithNamedPipe, and connects the standard streams of the command to them.
+func (h *Handle) openEndpoints() error {
+	cmd := h.cmd
+	for _, spec := range h.cfg.endpoints {
+		var set bool
+		switch spec.stream {
+		case "stdin":
+			set = cmd.Stdin != nil
+		case "stdout":
+			set = cmd.Stdout != nil
+		case "stderr":
+			set = cmd.Stderr != nil
+		default:
+			return wrapStart(fmt.Errorf("execx: %v %s: invalid stream %q", spec.kind, spec.path, spec.stream), cmd, h.cfg.collectors)
+		}
+		if set {
+			return wrapStart(fmt.Errorf("execx: %v %s: cmd.%s is already set", spec.kind, spec.path, streamField(spec.stream)), cmd, h.cfg.collectors)
+		}
+		e := &endpoint{endpointSpec: spec, h: h, ready: make(chan struct{})}
+		var err error
+		switch spec.kind {
+		case UnixSocket:
+			e.ln, err = net.Listen("unix", spec.path)
+		case NamedPipe:
+			err = mkfifo(spec.path)
+		default:
+			err = fmt.Errorf("execx: invalid endpoint kind %v", spec.kind)
+		}
+		if err != nil {
+			return wrapStart(err, cmd, h.cfg.collectors)
+		}
+		e.res = h.tracker.Track(spec.kind.String(), spec.path, removeFunc(spec.path))
+		h.endpoints = append(h.endpoints, e)
+		h.markEndpoint(e.stream, EndpointListening)
+		switch spec.stream {
+		case "stdin":
+			cmd.Stdin = endpointReader{e}
+		case "stdout":
+			cmd.Stdout = endpointWriter{e}
+		case "stderr":
+			cmd.Stderr = endpointWriter{e}
+		}
+	}
+	return nil
+}
+
+// streamField returns the name of the field of exec.Cmd which holds the
+// standard stream named stream.
+func streamField(stream string) string {
+	switch stream {
+	case "stdin":
+		return "Stdin"
+	case "stdout":
+		return "Stdout"
+	default:
+		return "Stderr"
+	}
+}
+
+// markEndpoint records a state transition of the endpoint of stream.
+func (h *Handle) markEndpoint(stream string, state EndpointState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.timeline.Endpoints = append(h.timeline.Endpoints, EndpointEvent{Stream: stream, State: state, Time: h.clock.Now()})
+}
+
+// connectEndpoints waits for peers to connect to the endpoints, once the
+// process has started, until ctx is done, or until the deadline of each
+// endpoint.
+func (h *Handle) connectEndpoints(ctx context.Context) {
+	for _, e := range h.endpoints {
+		go e.accept()
+		go e.watch(ctx)
+	}
+}
+
+// accept waits for a peer to connect.
+func (e *endpoint) accept() {
+	defer e.h.internal.catch(e.stream + " " + e.kind.String())
+	var (
+		conn io.ReadWriteCloser
+		err  error
+	)
+	switch e.kind {
+	case UnixSocket:
+		conn, err = e.ln.Accept()
+	case NamedPipe:
+		flag := os.O_WRONLY
+		if e.stream == "stdin" {
+			flag = os.O_RDONLY
+		}
+		conn, err = os.OpenFile(e.path, flag, 0)
+	}
+	if err != nil {
+		// The endpoint was abandoned.
+		return
+	}
+	e.finish(conn)
+}
+
+// watch abandons the endpoint if no peer connects in time.
+func (e *endpoint) watch(ctx context.Context) {
+	var deadline <-chan time.Time
+	exited := e.h.exited
+	if e.timeout > 0 {
+		t := e.h.clock.NewTimer(e.timeout)
+		defer t.Stop()
+		deadline, exited = t.C(), nil
+	}
+	select {
+	case <-e.ready:
+		return
+	case <-ctx.Done():
+	case <-deadline:
+	case <-exited:
+	}
+	e.finish(nil)
+}
+
+// finish records that a peer connected using conn, or that the endpoint
+// was abandoned, if conn is nil, and removes the endpoint from the file
+// system. If the endpoint was already connected or abandoned, finish
+// closes conn.
+func (e *endpoint) finish(conn io.ReadWriteCloser) {
+	e.mu.Lock()
+	if e.done {
+		e.mu.Unlock()
+		if conn != nil {
+			conn.Close()
+		}
+		return
+	}
+	e.done = true
+	e.conn = conn
+	e.mu.Unlock()
+
+	state := EndpointConnected
+	if conn == nil {
+		state = EndpointAbandoned
+	}
+	e.h.markEndpoint(e.stream, state)
+	e.remove(conn == nil)
+	close(e.ready)
+}
+
+// remove removes the endpoint from the file system. If unblock is true,
+// the goroutine blocked in accept is woken up, and gives up.
+func (e *endpoint) remove(unblock bool) {
+	switch e.kind {
+	case UnixSocket:
+		// Closing the listener removes the socket.
+		e.ln.Close()
+		e.res.Release()
+	case NamedPipe:
+		if unblock {
+			// Opening the other end of the pipe completes the
+			// blocked open, which then finds the endpoint done.
+			flag := os.O_RDONLY
+			if e.stream == "stdin" {
+				flag = os.O_WRONLY
+			}
+			if f, err := openNonblock(e.path, flag); err == nil {
+				f.Close()
+			}
+		}
+		e.res.Release()
+	}
+}
+
+// close closes the connection to the peer, if any.
+func (e *endpoint) close() {
+	e.mu.Lock()
+	if e.conn == nil || e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	e.conn.Close()
+	e.mu.Unlock()
+	e.h.markEndpoint(e.stream, EndpointClosed)
+}
+
+// wait waits until a peer connects, or the endpoint is abandoned, and
+// returns the connection, or nil if the endpoint was abandoned.
+func (e *endpoint) wait() io.ReadWriteCloser {
+	<-e.ready
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.conn
+}
+
+// endpointReader reads the input of a command from the peer of an endpoint.
+type endpointReader struct {
+	e *endpoint
+}
+
+func (r endpointReader) Read(p []byte) (int, error) {
+	conn := r.e.wait()
+	if conn == nil {
+		return 0, io.EOF
+	}
+	n, err := conn.Read(p)
+	if err != nil {
+		r.e.close()
+		err = io.EOF
+	}
+	return n, err
+}
+
+// endpointWriter writes the output of a command to the peer of an
+// endpoint. Output is discarded if the endpoint was abandoned.
+type endpointWriter struct {
+	e *endpoint
+}
+
+func (w endpointWriter) Write(p []byte) (int, error) {
+	conn := w.e.wait()
+	if conn == nil {
+		return len(p), nil
+	}
+	return conn.Write(p)
+}
+
+// closeEndpoints abandons the endpoints to which no peer connected, and
+// closes the connections to the others.
+func (h *Handle) closeEndpoints() {
+	for _, e := range h.endpoints {
+		e.finish(nil)
+		e.close()
+	}
+}
+
+// endpointErrors returns errors describing the endpoints which were
+// abandoned.
+func (h *Handle) endpointErrors() []*EndpointError {
+	var errs []*EndpointError
+	for _, e := range h.endpoints {
+		if e.wait() != nil {
+			continue
+		}
+		errs = append(errs, &EndpointError{Stream: e.stream, Kind: e.kind, Path: e.path, Timeout: e.timeout})
+	}
+	return errs
+}
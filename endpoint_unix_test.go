@@ -0,0 +1,130 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWithUnixSocket(t *testing.T) {
+	path := filepath.Join(tempDir(t), "stdout.sock")
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("hello")
+	h, err := execx.Start(context.Background(), cmd, execx.WithUnixSocket("stdout", path, 5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	got, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("got %q, want %q", got, "hello")
+	}
+	res, err := h.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket not removed: %v", err)
+	}
+	var states []execx.EndpointState
+	for _, ev := range res.Timeline.Endpoints {
+		if ev.Stream != "stdout" {
+			t.Errorf("got event for %q, want %q", ev.Stream, "stdout")
+		}
+		states = append(states, ev.State)
+	}
+	want := []execx.EndpointState{execx.EndpointListening, execx.EndpointConnected, execx.EndpointClosed}
+	if len(states) != len(want) || states[0] != want[0] || states[1] != want[1] || states[2] != want[2] {
+		t.Errorf("got transitions %v, want %v", states, want)
+	}
+}
+
+func TestWithNamedPipe(t *testing.T) {
+	path := filepath.Join(tempDir(t), "stdin.fifo")
+	h, err := execx.Start(context.Background(), selfCmd("echo"), execx.WithNamedPipe("stdin", path, 5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello")
+	f.Close()
+	res, err := h.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "hello" {
+		t.Errorf("got %q, want %q", res.Stdout, "hello")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("named pipe not removed: %v", err)
+	}
+}
+
+func TestEndpointNoPeer(t *testing.T) {
+	path := filepath.Join(tempDir(t), "stdout.fifo")
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("hello")
+	_, err := execx.Run(context.Background(), cmd, execx.WithNamedPipe("stdout", path, 0))
+	var epe *execx.EndpointError
+	if !errors.As(err, &epe) {
+		t.Fatalf("got %v, want *EndpointError", err)
+	}
+	if epe.Stream != "stdout" || epe.Kind != execx.NamedPipe || epe.Path != path {
+		t.Errorf("got %+v", epe)
+	}
+	if !strings.Contains(err.Error(), "no peer connected to the named pipe") {
+		t.Errorf("got %q, which does not explain that no peer connected", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("named pipe not removed: %v", err)
+	}
+}
+
+func TestEndpointStreamSet(t *testing.T) {
+	path := filepath.Join(tempDir(t), "stdout.sock")
+	cmd := selfCmd("echo")
+	cmd.Stdout = ioutil.Discard
+	_, err := execx.Run(context.Background(), cmd, execx.WithUnixSocket("stdout", path, 0))
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket created: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"acln.ro/env"
+)
+
+// WriteEnvFile writes e.ChildEnv to the file at path, in dotenv format,
+// one KEY=value pair per line, sorted by key. The values of sensitive
+// variables are redacted, as per RedactEnv. The file is created with
+// mode 0600, since the environment may nonetheless contain secrets.
+//
+// Values which consist only of characters that are safe to pass to a
+// shell unquoted are written as-is, so that the command can be re-run
+// using
+//
+//	env -i $(cat failure.env) cmd ...
+//
+// Values which contain other characters, such as whitespace, are
+// written in double quotes, using Go escape sequences. Files containing
+// such values should be loaded using ReadEnvFile, or a dotenv-aware tool.
+func (e *ExitError) WriteEnvFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writeEnv(f, RedactEnv(e.ChildEnv)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadEnvFile reads an environment from a dotenv file, such as one
+// produced by (*ExitError).WriteEnvFile. Empty lines and lines starting
+// with '#' are ignored.
+func ReadEnvFile(path string) (env.Map, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readEnv(f)
+}
+
+func writeEnv(w io.Writer, m env.Map) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	bw := bufio.NewWriter(w)
+	for _, k := range keys {
+		fmt.Fprintf(bw, "%s=%s\n", k, quoteEnvValue(m[k]))
+	}
+	return bw.Flush()
+}
+
+func readEnv(r io.Reader) (env.Map, error) {
+	m := make(env.Map)
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("execx: env file line %d: missing '='", n)
+		}
+		key, value := line[:eq], line[eq+1:]
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("execx: env file line %d: %v", n, err)
+			}
+			value = unquoted
+		}
+		m[key] = value
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// quoteEnvValue quotes v, unless it consists entirely of characters which
+// are safe to pass to a shell unquoted.
+func quoteEnvValue(v string) string {
+	for _, r := range v {
+		if !isShellSafe(r) {
+			return strconv.Quote(v)
+		}
+	}
+	return v
+}
+
+func isShellSafe(r rune) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("@%+=:,./-_", r)
+}
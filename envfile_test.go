@@ -0,0 +1,80 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"acln.ro/env"
+	"acln.ro/execx"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteEnvFile(t *testing.T) {
+	err := execx.Wrap(execSelf())
+	ee := err.(*execx.ExitError)
+	ee.ChildEnv = env.Map{
+		"PLAIN":        "value",
+		"SPACES":       "a b\tc",
+		"QUOTES":       `say "hi"`,
+		"GITHUB_TOKEN": "hunter2",
+	}
+
+	dir, err := ioutil.TempDir("", "execx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "failure.env")
+
+	if err := ee.WriteEnvFile(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := execx.ReadEnvFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := env.Map{
+		"PLAIN":        "value",
+		"SPACES":       "a b\tc",
+		"QUOTES":       `say "hi"`,
+		"GITHUB_TOKEN": execx.Redacted,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestIsSensitive(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"HOME", false},
+		{"PATH", false},
+		{"AWS_SECRET_ACCESS_KEY", true},
+		{"github_token", true},
+		{"DB_PASSWORD", true},
+	}
+	for _, tt := range tests {
+		if got := execx.IsSensitive(tt.name); got != tt.want {
+			t.Errorf("IsSensitive(%q) = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
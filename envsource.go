@@ -0,0 +1,246 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+
+	"acln.ro/env"
+)
+
+// EnvOrigin describes where a variable in the environment of a child
+// process came from.
+type EnvOrigin int
+
+// Known origins.
+const (
+	// EnvInherited marks variables inherited from the parent process.
+	EnvInherited EnvOrigin = iota
+
+	// EnvCommand marks variables set directly in exec.Cmd.Env, which
+	// differ from the environment of the parent process.
+	EnvCommand
+
+	// EnvDefault marks variables set by WithDefaultEnv.
+	EnvDefault
+
+	// EnvExplicit marks variables set by WithEnv.
+	EnvExplicit
+
+	// EnvUser marks variables set by AsUser.
+	EnvUser
+
+	// EnvIsolated marks variables set by IsolatedHome.
+	EnvIsolated
+
+	// EnvProfile marks variables set by WithProfile.
+	EnvProfile
+)
+
+// String returns a short description of o.
+func (o EnvOrigin) String() string {
+	switch o {
+	case EnvInherited:
+		return "inherited"
+	case EnvCommand:
+		return "cmd.Env"
+	case EnvDefault:
+		return "WithDefaultEnv"
+	case EnvExplicit:
+		return "WithEnv"
+	case EnvUser:
+		return "AsUser"
+	case EnvIsolated:
+		return "IsolatedHome"
+	case EnvProfile:
+		return "WithProfile"
+	default:
+		return fmt.Sprintf("EnvOrigin(%d)", int(o))
+	}
+}
+
+// An EnvSource records where a variable in the environment of a child
+// process came from.
+type EnvSource struct {
+	// Origin is the origin of the variable.
+	Origin EnvOrigin
+
+	// Profile is the name of the profile which set the variable, if
+	// it was set by WithProfile.
+	Profile string
+
+	// File and Line identify the call to WithEnv, WithDefaultEnv,
+	// WithProfile, AsUser or IsolatedHome which set the variable, if
+	// any.
+	File string
+	Line int
+}
+
+// String returns a description of s, such as
+//
+//	WithEnv at /home/user/src/project/build.go:42
+func (s EnvSource) String() string {
+	origin := s.Origin.String()
+	if s.Profile != "" {
+		origin = fmt.Sprintf("%v(%q)", s.Origin, s.Profile)
+	}
+	if s.File == "" {
+		return origin
+	}
+	return fmt.Sprintf("%s at %s:%d", origin, s.File, s.Line)
+}
+
+// WithEnv sets the environment variable key to value in the environment
+// of the command, overriding inherited variables, variables set in
+// cmd.Env, and defaults set by WithDefaultEnv. If WithEnv is specified
+// multiple times for the same key, the last one wins.
+//
+// If the command fails, the *ExitError records the file and line of the
+// call to WithEnv, as well as the origins of other variables, in
+// EnvSources.
+func WithEnv(key, value string) Option {
+	src := envCaller(EnvExplicit)
+	return func(cfg *config) {
+		cfg.env = append(cfg.env, envSetting{key: key, value: value, src: src})
+	}
+}
+
+// WithDefaultEnv sets the environment variable key to value in the
+// environment of the command, unless the variable is already set, either
+// by inheritance from the parent process, or in cmd.Env. It is useful for
+// policy defaults, such as GOFLAGS=-mod=readonly, which callers and users
+// may override. The origin of the variable is recorded as per WithEnv.
+func WithDefaultEnv(key, value string) Option {
+	src := envCaller(EnvDefault)
+	return func(cfg *config) {
+		cfg.env = append(cfg.env, envSetting{key: key, value: value, src: src, dflt: true})
+	}
+}
+
+// envSetting is a variable set by WithEnv or WithDefaultEnv.
+type envSetting struct {
+	key   string
+	value string
+	src   EnvSource
+	dflt  bool // set only if not already set, as per WithDefaultEnv
+}
+
+// envSettings returns the variables set by cfg, including the variables
+// set by the profiles requested using WithProfile.
+func (cfg *config) envSettings() ([]envSetting, error) {
+	if len(cfg.profiles) == 0 {
+		return cfg.env, nil
+	}
+	settings, err := profileEnv(cfg.profiles)
+	if err != nil {
+		return nil, err
+	}
+	return append(settings, cfg.env...), nil
+}
+
+// envCaller returns an EnvSource identifying the caller of the caller
+// of envCaller.
+func envCaller(origin EnvOrigin) EnvSource {
+	src := EnvSource{Origin: origin}
+	if _, file, line, ok := runtime.Caller(2); ok {
+		src.File, src.Line = file, line
+	}
+	return src
+}
+
+// applyEnv builds the environment of h.cmd from its inherited environment,
+// cmd.Env, and the variables set by WithEnv, WithDefaultEnv and
+// WithProfile, recording the origin of each variable. In hermetic mode,
+// only the variables kept by Hermetic are inherited.
+func (h *Handle) applyEnv() error {
+	settings, err := h.cfg.envSettings()
+	if err != nil {
+		return wrapStart(err, h.cmd, h.cfg.collectors)
+	}
+	parent := env.Variables()
+	child := parent
+	if h.cfg.hermetic != nil {
+		child = hermeticEnv(parent, h.cfg.hermetic)
+	}
+	if h.cmd.Env != nil {
+		child = env.Parse(h.cmd.Env...)
+		if h.cfg.hermetic != nil {
+			if err := checkHermetic(child, parent, h.cfg.hermetic); err != nil {
+				return wrapStart(err, h.cmd, h.cfg.collectors)
+			}
+		}
+	}
+	sources := make(map[string]EnvSource, len(child))
+	for k, v := range child {
+		if pv, ok := parent[k]; ok && pv == v {
+			sources[k] = EnvSource{Origin: EnvInherited}
+		} else {
+			sources[k] = EnvSource{Origin: EnvCommand}
+		}
+	}
+	merged := make(env.Map, len(child))
+	for k, v := range child {
+		merged[k] = v
+	}
+	for _, s := range settings {
+		if !s.dflt {
+			continue
+		}
+		if _, ok := child[s.key]; !ok {
+			merged[s.key] = s.value
+			sources[s.key] = s.src
+		}
+	}
+	// Variables set by IsolatedHome take precedence over those set by
+	// AsUser, variables set by WithProfile take precedence over both,
+	// and variables set by WithEnv take precedence over all of them.
+	for _, origin := range []EnvOrigin{EnvUser, EnvIsolated, EnvProfile, EnvExplicit} {
+		for _, s := range settings {
+			if s.src.Origin == origin && !s.dflt {
+				merged[s.key] = s.value
+				sources[s.key] = s.src
+			}
+		}
+	}
+	h.cmd.Env = merged.Encode()
+	if h.cmd.Env == nil {
+		// A nil cmd.Env inherits the parent environment.
+		h.cmd.Env = []string{}
+	}
+	h.envSources = sources
+	return nil
+}
+
+// formatEnvSources writes the origins of the variables in m which were
+// not inherited from the parent process to w.
+func formatEnvSources(w io.Writer, m map[string]EnvSource, p printer) {
+	var keys []string
+	for k, src := range m {
+		if src.Origin != EnvInherited {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "%s\n", p.sprintf("env sources:"))
+	for _, k := range keys {
+		fmt.Fprintf(w, "\t%s: %v\n", k, m[k])
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestEnvSources(t *testing.T) {
+	if _, ok := os.LookupEnv("PATH"); !ok {
+		t.Skip("PATH not set")
+	}
+	_, file, line, _ := runtime.Caller(0)
+	_, err := execx.Run(context.Background(), selfCmd("on"),
+		execx.WithEnv("EXECX_EXPLICIT", "1"),
+		execx.WithDefaultEnv("EXECX_DEFAULT", "2"),
+		execx.WithDefaultEnv("EXECX_TEST", "off"),
+	)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	want := map[string]execx.EnvSource{
+		"EXECX_EXPLICIT": {Origin: execx.EnvExplicit, File: file, Line: line + 2},
+		"EXECX_DEFAULT":  {Origin: execx.EnvDefault, File: file, Line: line + 3},
+		"EXECX_TEST":     {Origin: execx.EnvCommand},
+		"PATH":           {Origin: execx.EnvInherited},
+	}
+	for k, src := range want {
+		if got := ee.EnvSources[k]; got != src {
+			t.Errorf("%s: got source %v, want %v", k, got, src)
+		}
+	}
+	if got := ee.ChildEnv["EXECX_TEST"]; got != "on" {
+		t.Errorf("EXECX_TEST: default overrode value from cmd.Env: got %q", got)
+	}
+	if got := ee.ChildEnv["EXECX_DEFAULT"]; got != "2" {
+		t.Errorf("EXECX_DEFAULT: got %q, want %q", got, "2")
+	}
+	detail := fmt.Sprintf("%+v", ee)
+	wantLine := fmt.Sprintf("\tEXECX_EXPLICIT: WithEnv at %s:%d\n", file, line+2)
+	if !strings.Contains(detail, wantLine) {
+		t.Errorf("%%+v does not contain %q:\n%s", wantLine, detail)
+	}
+	if strings.Contains(detail, "\tPATH: inherited") {
+		t.Errorf("%%+v lists inherited variables:\n%s", detail)
+	}
+}
+
+func TestEnvOverride(t *testing.T) {
+	cmd := selfCmd("on")
+	execx.Run(context.Background(), cmd,
+		execx.WithDefaultEnv("EXECX_OVERRIDE", "default"),
+		execx.WithEnv("EXECX_OVERRIDE", "first"),
+		execx.WithEnv("EXECX_OVERRIDE", "last"),
+	)
+	var got []string
+	for _, kv := range cmd.Env {
+		if strings.HasPrefix(kv, "EXECX_OVERRIDE=") {
+			got = append(got, kv)
+		}
+	}
+	if len(got) != 1 || got[0] != "EXECX_OVERRIDE=last" {
+		t.Errorf("got %q, want [EXECX_OVERRIDE=last]", got)
+	}
+}
+
+func TestEnvSourcesUntracked(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.EnvSources != nil {
+		t.Errorf("got EnvSources %v without WithEnv", ee.EnvSources)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package errcode defines a small taxonomy of the ways in which commands
+// fail, with stable, machine-readable codes, such that monitoring and
+// alerting systems can route on the category of a failure rather than on
+// the text of error messages, which changes between versions.
+//
+// All error types of package execx implement Coder. Use Of to find the
+// code of an arbitrary error:
+//
+//	switch errcode.Of(err) {
+//	case errcode.Timeout, errcode.Canceled:
+//		// retry later
+//	case errcode.OOMKilled:
+//		// page someone
+//	}
+//
+// The string values of the codes are part of the API: they are never
+// changed or reused, such that they can be stored, and compared against
+// by programs built against other versions of this package.
+package errcode
+
+import (
+	"context"
+	"errors"
+)
+
+// A Code identifies a category of failure.
+type Code string
+
+// Codes.
+const (
+	// None is the code of a nil error.
+	None Code = ""
+
+	// Unknown is the code of errors which do not carry a code.
+	Unknown Code = "unknown"
+
+	// StartFailure means the program could not be started, because
+	// it was not found, was not executable, its working directory was
+	// missing, or the process could not be set up as requested.
+	StartFailure Code = "start_failure"
+
+	// InvalidArgument means the command, or the options it was run
+	// with, were malformed.
+	InvalidArgument Code = "invalid_argument"
+
+	// PolicyDenied means the command was refused by a policy, such as
+	// an allow list, a hermeticity check or a confirmation prompt.
+	PolicyDenied Code = "policy_denied"
+
+	// Unavailable means the command was not run because a resource it
+	// depends on, such as a lock, a quota or a circuit breaker, was
+	// not available. Retrying later may succeed.
+	Unavailable Code = "unavailable"
+
+	// ResourceExhausted means the command exceeded a budget of time or
+	// resources it was allotted.
+	ResourceExhausted Code = "resource_exhausted"
+
+	// Timeout means the command was stopped because a deadline or a
+	// timeout expired.
+	Timeout Code = "timeout"
+
+	// Canceled means the command was stopped because its caller
+	// canceled it.
+	Canceled Code = "canceled"
+
+	// Aborted means a command requested that the work it is part of be
+	// abandoned, by exiting with a designated exit code, or by printing
+	// a designated marker.
+	Aborted Code = "aborted"
+
+	// NonZeroExit means the process exited with a non-zero status.
+	NonZeroExit Code = "nonzero_exit"
+
+	// Signaled means the process was terminated by a signal it was not
+	// sent on behalf of the caller.
+	Signaled Code = "signaled"
+
+	// OOMKilled means the process was killed by the kernel because the
+	// system or its cgroup ran out of memory.
+	OOMKilled Code = "oom_killed"
+
+	// OutputOverflow means the process produced more output than it
+	// was allowed to.
+	OutputOverflow Code = "output_overflow"
+
+	// OutputMismatch means the output of the process did not meet
+	// expectations, as for output contracts and golden files.
+	OutputMismatch Code = "output_mismatch"
+
+	// Deadlock means the process was stopped because it, and the
+	// processes it communicates with, could make no progress.
+	Deadlock Code = "deadlock"
+
+	// Leaked means the process left resources behind, such as
+	// processes which outlived it, or open file descriptors.
+	Leaked Code = "leaked"
+
+	// Internal means a bug in package execx, or that it lost track of
+	// the process, such that how it exited is unknown.
+	Internal Code = "internal"
+
+	// Mixed means a group of commands failed in different ways.
+	Mixed Code = "mixed"
+)
+
+// A Coder is an error which carries a Code.
+type Coder interface {
+	error
+	Code() Code
+}
+
+// Of returns the code of err: None if err is nil, the code of the first
+// error in the chain of err which implements Coder, Timeout or Canceled if
+// err is or wraps the error of a context, or Unknown otherwise.
+func Of(err error) Code {
+	if err == nil {
+		return None
+	}
+	var c Coder
+	if errors.As(err, &c) {
+		return c.Code()
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	}
+	return Unknown
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package errcode_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"acln.ro/execx/errcode"
+)
+
+type codedError struct{}
+
+func (codedError) Error() string      { return "coded" }
+func (codedError) Code() errcode.Code { return errcode.OOMKilled }
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want errcode.Code
+	}{
+		{nil, errcode.None},
+		{errors.New("plain"), errcode.Unknown},
+		{codedError{}, errcode.OOMKilled},
+		{fmt.Errorf("wrapped: %w", codedError{}), errcode.OOMKilled},
+		{context.DeadlineExceeded, errcode.Timeout},
+		{fmt.Errorf("wrapped: %w", context.Canceled), errcode.Canceled},
+	}
+	for _, tt := range tests {
+		if got := errcode.Of(tt.err); got != tt.want {
+			t.Errorf("Of(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
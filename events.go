@@ -0,0 +1,175 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// An Event describes activity of commands started by Start. Its dynamic
+// type is one of *CommandStarted, *CommandExited or *CommandFailed.
+type Event interface {
+	event()
+}
+
+// CommandStarted is sent once the process of a command has started.
+type CommandStarted struct {
+	Time time.Time
+
+	// Ctx is the context the command was started with.
+	Ctx context.Context
+
+	// Cmdline is the command line of the command, as per Cmdline.
+	Cmdline string
+
+	Path string
+	Args []string
+	Dir  string
+
+	// PID is the process ID of the command.
+	PID int
+}
+
+// CommandExited is sent once a command has completed successfully.
+type CommandExited struct {
+	Time    time.Time
+	Ctx     context.Context
+	Cmdline string
+	PID     int
+
+	// Result describes the run.
+	Result *Result
+}
+
+// CommandFailed is sent once a command has completed with an error, or
+// has failed to start. For commands which failed to start, PID is zero,
+// and Result is nil.
+type CommandFailed struct {
+	Time    time.Time
+	Ctx     context.Context
+	Cmdline string
+	PID     int
+	Result  *Result
+
+	// Err is the error returned by Wait, or by Start.
+	Err error
+}
+
+func (*CommandStarted) event() {}
+func (*CommandExited) event()  {}
+func (*CommandFailed) event()  {}
+
+var subscribers struct {
+	sync.Mutex
+	m map[chan<- Event]struct{}
+}
+
+// Subscribe causes events describing the activity of all commands started
+// by Start to be sent on ch. Every command produces a CommandStarted event
+// followed by a CommandExited or a CommandFailed event, or a single
+// CommandFailed event if it fails to start.
+//
+// As with signal.Notify, events are sent on ch without blocking: if ch is
+// not ready to receive, the event is dropped. The caller must ensure that
+// ch has sufficient buffer space to keep up with the expected rate of
+// events. The returned function stops delivery to ch. It is safe to call
+// more than once.
+func Subscribe(ch chan<- Event) (cancel func()) {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	if subscribers.m == nil {
+		subscribers.m = make(map[chan<- Event]struct{})
+	}
+	subscribers.m[ch] = struct{}{}
+	return func() {
+		subscribers.Lock()
+		defer subscribers.Unlock()
+		delete(subscribers.m, ch)
+	}
+}
+
+// publish sends ev to the subscribers which are ready to receive it, and
+// passes it to Config.OnEvent.
+func publish(ev Event) {
+	if f := currentConfig().OnEvent; f != nil {
+		f(ev)
+	}
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	for ch := range subscribers.m {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// publishStart publishes a CommandStarted event for h.
+func (h *Handle) publishStart(ctx context.Context) {
+	if h.cfg.auxiliary {
+		return
+	}
+	publish(&CommandStarted{
+		Time:    h.timeline.Running,
+		Ctx:     ctx,
+		Cmdline: Cmdline(h.cmd),
+		Path:    h.cmd.Path,
+		Args:    h.cmd.Args,
+		Dir:     h.cmd.Dir,
+		PID:     h.cmd.Process.Pid,
+	})
+}
+
+// publishExit publishes a CommandExited or a CommandFailed event for h,
+// which produced res and err.
+func (h *Handle) publishExit(res *Result, err error) {
+	if h.cfg.auxiliary {
+		return
+	}
+	if err != nil {
+		publish(&CommandFailed{
+			Time:    res.Timeline.WaitReturned,
+			Ctx:     h.logCtx,
+			Cmdline: Cmdline(h.cmd),
+			PID:     h.cmd.Process.Pid,
+			Result:  res,
+			Err:     err,
+		})
+		return
+	}
+	publish(&CommandExited{
+		Time:    res.Timeline.WaitReturned,
+		Ctx:     h.logCtx,
+		Cmdline: Cmdline(h.cmd),
+		PID:     h.cmd.Process.Pid,
+		Result:  res,
+	})
+}
+
+// publishStartFailure publishes a CommandFailed event for h, which failed
+// to start with err.
+func (h *Handle) publishStartFailure(ctx context.Context, err error) {
+	if h.cfg.auxiliary {
+		return
+	}
+	publish(&CommandFailed{
+		Time:    h.clock.Now(),
+		Ctx:     ctx,
+		Cmdline: Cmdline(h.cmd),
+		Err:     err,
+	})
+}
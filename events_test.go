@@ -0,0 +1,117 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestSubscribe(t *testing.T) {
+	ch := make(chan execx.Event, 64)
+	cancel := execx.Subscribe(ch)
+	defer cancel()
+
+	// Other tests may run commands concurrently, so events are matched
+	// by process ID, or by command line.
+	next := func(match func(execx.Event) bool) execx.Event {
+		t.Helper()
+		deadline := time.After(timeout)
+		for {
+			select {
+			case ev := <-ch:
+				if match(ev) {
+					return ev
+				}
+			case <-deadline:
+				t.Fatal("timed out waiting for event")
+			}
+		}
+	}
+
+	t.Run("Exited", func(t *testing.T) {
+		cmd := selfCmd("echo")
+		h, err := execx.Start(context.Background(), cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pid := cmd.Process.Pid
+		res, err := h.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev := next(func(ev execx.Event) bool {
+			started, ok := ev.(*execx.CommandStarted)
+			return ok && started.PID == pid
+		})
+		if ev.(*execx.CommandStarted).Ctx == nil {
+			t.Errorf("CommandStarted without context")
+		}
+		ev = next(func(ev execx.Event) bool {
+			exited, ok := ev.(*execx.CommandExited)
+			return ok && exited.PID == pid
+		})
+		if ev.(*execx.CommandExited).Result != res {
+			t.Errorf("CommandExited carries the wrong result")
+		}
+	})
+	t.Run("Failed", func(t *testing.T) {
+		cmd := selfCmd("on")
+		h, err := execx.Start(context.Background(), cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pid := cmd.Process.Pid
+		_, err = h.Wait()
+		ev := next(func(ev execx.Event) bool {
+			failed, ok := ev.(*execx.CommandFailed)
+			return ok && failed.PID == pid
+		})
+		if got := ev.(*execx.CommandFailed).Err; got != err {
+			t.Errorf("got error %v, want %v", got, err)
+		}
+	})
+	t.Run("StartFailure", func(t *testing.T) {
+		cmd := exec.Command("/nonexistent/execx-subscribe")
+		_, err := execx.Start(context.Background(), cmd)
+		if err == nil {
+			t.Fatal("Start succeeded")
+		}
+		ev := next(func(ev execx.Event) bool {
+			failed, ok := ev.(*execx.CommandFailed)
+			return ok && failed.Cmdline == execx.Cmdline(cmd)
+		})
+		if failed := ev.(*execx.CommandFailed); failed.Err != err || failed.Result != nil {
+			t.Errorf("got %+v", failed)
+		}
+	})
+	t.Run("Cancel", func(t *testing.T) {
+		ch := make(chan execx.Event, 64)
+		cancel := execx.Subscribe(ch)
+		cancel()
+		cancel()
+		cmd := exec.Command("/nonexistent/execx-subscribe-cancel")
+		execx.Run(context.Background(), cmd)
+		for len(ch) > 0 {
+			if failed, ok := (<-ch).(*execx.CommandFailed); ok && failed.Cmdline == execx.Cmdline(cmd) {
+				t.Errorf("got event after cancel")
+			}
+		}
+	})
+}
@@ -0,0 +1,198 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An ExecImage is a program image executed by a process.
+type ExecImage struct {
+	// Path is the path of the executable, or the empty string if only
+	// the name of the image is known.
+	Path string
+
+	// Name is the name of the image, as reported by the kernel, which
+	// truncates it to 15 bytes.
+	Name string
+
+	// Args holds the command line arguments of the image, if known.
+	Args []string
+
+	// Seen is the time the image was first observed.
+	Seen time.Time
+}
+
+// An ExecChain records the images executed, in turn, by a process which
+// re-executes itself, such as a version manager shim which executes the
+// real tool, oldest first.
+type ExecChain []ExecImage
+
+// Final returns the last image observed, which is the image the process
+// exited from, or the zero ExecImage if c is empty.
+func (c ExecChain) Final() ExecImage {
+	if len(c) == 0 {
+		return ExecImage{}
+	}
+	return c[len(c)-1]
+}
+
+func (c ExecChain) String() string {
+	names := make([]string, len(c))
+	for i, img := range c {
+		names[i] = img.Name
+		if img.Path != "" {
+			names[i] = img.Path
+		}
+	}
+	return strings.Join(names, " -> ")
+}
+
+// execSampleInterval is the interval at which WithExecChain samples the
+// image of the process.
+const execSampleInterval = 10 * time.Millisecond
+
+// WithExecChain tracks the images executed by the process, for commands
+// such as shims and wrappers, which execute other programs in place of
+// themselves, such that the PID and the resource usage of the process
+// describe a different program than the one which was started. The image
+// is sampled while the process runs, and its name is read once more just
+// before the process is reaped, such that short-lived final images are
+// detected too, although a process which renames itself is indistinct
+// from one which executes another image at that point.
+//
+// The images are recorded in Result.ExecChain. If the process executed
+// more than one image, the chain is also recorded as an ExecChain detail
+// named "exec_chain" in errors produced by the command. WithExecChain is
+// supported on Linux only, and does nothing on other platforms.
+func WithExecChain() Option {
+	return func(cfg *config) {
+		cfg.execChain = true
+	}
+}
+
+// execTracker tracks the images executed by a process.
+type execTracker struct {
+	pid int
+
+	mu      sync.Mutex
+	chain   ExecChain
+	stopped bool // the process is about to be reaped
+}
+
+// trackExecs tracks the images executed by the process started by cmd
+// until exited is closed, recording panics in ie. trackExecs returns nil
+// if images cannot be tracked on this platform.
+func trackExecs(cmd *exec.Cmd, started time.Time, exited <-chan struct{}, ie *internalErrors) *execTracker {
+	if !execChainSupported {
+		return nil
+	}
+	// The process may execute another image before it can be sampled,
+	// so start the chain with the image Start executed.
+	path := cmd.Path
+	if resolved := resolvePath(cmd.Path, cmd.Dir); resolved != "" {
+		path = resolved
+	}
+	t := &execTracker{pid: cmd.Process.Pid}
+	t.chain = ExecChain{{
+		Path: path,
+		Name: commName(filepath.Base(path)),
+		Args: copyStrings(cmd.Args),
+		Seen: started,
+	}}
+	t.sample()
+	go func() {
+		defer ie.catch("track executed images")
+		tick := time.NewTicker(execSampleInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+			case <-exited:
+				return
+			}
+			t.sample()
+		}
+	}()
+	return t
+}
+
+// sample records the current image of the process, if it changed.
+func (t *execTracker) sample() {
+	path, args, err := readExecImage(t.pid)
+	if err != nil {
+		// The process exited, or is in the middle of execve.
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		// The process may have been reaped while it was being
+		// sampled, and the sample may be bogus.
+		return
+	}
+	if len(t.chain) > 0 && t.chain.Final().Path == path && equalStrings(t.chain.Final().Args, args) {
+		return
+	}
+	t.chain = append(t.chain, ExecImage{
+		Path: path,
+		Name: commName(filepath.Base(path)),
+		Args: args,
+		Seen: time.Now(),
+	})
+}
+
+// stop stops tracking, before the process is reaped. If zombie is true,
+// the process has exited, but has not been reaped yet, and stop records
+// the name of its final image, if it differs from the last image sampled.
+func (t *execTracker) stop(zombie bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	if !zombie {
+		return
+	}
+	name, err := readExecName(t.pid)
+	if err != nil || len(t.chain) > 0 && t.chain.Final().Name == name {
+		return
+	}
+	t.chain = append(t.chain, ExecImage{Name: name, Seen: time.Now()})
+}
+
+// result returns the images recorded.
+func (t *execTracker) result() ExecChain {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append(ExecChain(nil), t.chain...)
+}
+
+// commName returns name, truncated as the kernel does for the names of
+// processes.
+func commName(name string) string {
+	if len(name) > 15 {
+		return name[:15]
+	}
+	return name
+}
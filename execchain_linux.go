@@ -0,0 +1,59 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const execChainSupported = true
+
+// readExecImage reads the path of the executable image of the process
+// with the specified pid, and its command line, from /proc.
+func readExecImage(pid int) (path string, args []string, err error) {
+	proc := fmt.Sprintf("/proc/%d/", pid)
+	path, err = os.Readlink(proc + "exe")
+	if err != nil {
+		return "", nil, err
+	}
+	b, err := ioutil.ReadFile(proc + "cmdline")
+	if err != nil {
+		return "", nil, err
+	}
+	if len(b) == 0 {
+		// The process is exiting, or in the middle of execve.
+		return "", nil, errProcExiting
+	}
+	return path, strings.Split(strings.TrimSuffix(string(b), "\x00"), "\x00"), nil
+}
+
+// readExecName reads the name of the image of the process with the
+// specified pid from /proc/<pid>/comm, which remains readable until the
+// process is reaped.
+func readExecName(pid int) (string, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(string(b), "\n")
+	if name == "" {
+		return "", errors.New("execx: empty process name")
+	}
+	return name, nil
+}
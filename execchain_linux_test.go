@@ -0,0 +1,72 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithExecChain(t *testing.T) {
+	for _, script := range []string{
+		"sleep 0.2; exit 3", // sampled while running
+		"exit 3",            // seen only before the process is reaped
+	} {
+		t.Run(script, func(t *testing.T) {
+			cmd := selfCmd("reexec")
+			cmd.Env = append(cmd.Env, "EXECX_REEXEC="+script)
+			_, err := execx.Run(context.Background(), cmd, execx.WithExecChain())
+			var ee *execx.ExitError
+			if !errors.As(err, &ee) || ee.ExitCode() != 3 {
+				t.Fatalf("got %v, want *ExitError with exit code 3", err)
+			}
+			chain := ee.Result.ExecChain
+			if len(chain) < 2 {
+				t.Fatalf("got exec chain %v, want at least 2 images", chain)
+			}
+			self, _ := filepath.EvalSymlinks(os.Args[0])
+			if chain[0].Path != self {
+				t.Errorf("got first image %q, want %q", chain[0].Path, self)
+			}
+			if final := chain.Final(); final.Name == chain[0].Name || final.Name == "" {
+				t.Errorf("got final image %+v", final)
+			}
+			v, ok := ee.Detail("exec_chain")
+			if !ok || !strings.Contains(v.(execx.ExecChain).String(), " -> ") {
+				t.Errorf("got exec_chain detail %v", v)
+			}
+		})
+	}
+}
+
+func TestWithExecChainSingleImage(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"), execx.WithExecChain())
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if len(ee.Result.ExecChain) != 1 {
+		t.Errorf("got exec chain %v, want one image", ee.Result.ExecChain)
+	}
+	if _, ok := ee.Detail("exec_chain"); ok {
+		t.Error("exec_chain detail recorded for a single image")
+	}
+}
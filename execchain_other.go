@@ -0,0 +1,34 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build !linux
+// +build !linux
+
+package execx
+
+import "errors"
+
+const execChainSupported = false
+
+var errNoExecChain = errors.New("execx: exec chains not available on this platform")
+
+// readExecImage reports that images cannot be tracked on this platform.
+func readExecImage(pid int) (string, []string, error) {
+	return "", nil, errNoExecChain
+}
+
+// readExecName reports that images cannot be tracked on this platform.
+func readExecName(pid int) (string, error) {
+	return "", errNoExecChain
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package exectest_test
+
+import (
+	"testing"
+	"time"
+
+	"acln.ro/execx/exectest"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c := exectest.NewFakeClock(start)
+	t1 := c.NewTimer(time.Second)
+	t2 := c.NewTimer(2 * time.Second)
+	t3 := c.NewTimer(3 * time.Second)
+	if n := c.Timers(); n != 3 {
+		t.Fatalf("got %d timers, want 3", n)
+	}
+	if !t3.Stop() {
+		t.Error("Stop on pending timer returned false")
+	}
+
+	c.Advance(1500 * time.Millisecond)
+	select {
+	case got := <-t1.C():
+		if want := start.Add(1500 * time.Millisecond); !got.Equal(want) {
+			t.Errorf("fired at %v, want %v", got, want)
+		}
+	default:
+		t.Fatal("due timer did not fire")
+	}
+	select {
+	case <-t2.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+	if t1.Stop() {
+		t.Error("Stop on fired timer returned true")
+	}
+
+	c.Advance(time.Hour)
+	select {
+	case <-t2.C():
+	default:
+		t.Fatal("due timer did not fire")
+	}
+	select {
+	case <-t3.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+	if n := c.Timers(); n != 0 {
+		t.Errorf("got %d timers, want 0", n)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package exectest provides utilities for testing code which uses
+// package execx.
+package exectest
+
+import (
+	"errors"
+
+	"acln.ro/env"
+	"acln.ro/execx"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Comparer is a cmp.Option which compares *execx.ExitError values by the
+// fields which are stable across runs of the same command: the path, the
+// arguments, the working directory, the environment of the child process,
+// the exit code, standard error, details, and hints. Volatile fields, such
+// as CPU times, process IDs, timelines, and the environment of the parent
+// process, are ignored.
+var Comparer = cmp.Transformer("execx.ExitError", func(e *execx.ExitError) *exitError {
+	return normalize(e, true)
+})
+
+// exitError is the normalized form of an *execx.ExitError.
+type exitError struct {
+	Path     string
+	Args     []string
+	Dir      string
+	ChildEnv env.Map
+	ExitCode int
+	Stderr   string
+	Details  []execx.Detail
+	Hints    []string
+}
+
+// normalize returns the normalized form of e. If status is false, the exit
+// code and standard error are not included.
+func normalize(e *execx.ExitError, status bool) *exitError {
+	if e == nil {
+		return nil
+	}
+	n := &exitError{
+		Path:     e.Path,
+		Args:     e.Args,
+		Dir:      e.Dir,
+		ChildEnv: e.ChildEnv,
+		Details:  e.Details,
+		Hints:    e.Hints,
+	}
+	if status && e.ExitError != nil {
+		n.ExitCode = e.ExitCode()
+		n.Stderr = string(e.ExitError.Stderr)
+	}
+	return n
+}
+
+// TB is the subset of testing.TB used by this package.
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+// AssertExitError asserts that err is, or wraps, an *execx.ExitError equal
+// to want, as per Comparer. If want.ExitError is nil, the exit code and
+// standard error are not compared. Fields of want which are left unset are
+// compared nonetheless: use nil or empty values where the expected value
+// is nil or empty.
+func AssertExitError(t TB, err error, want *execx.ExitError) {
+	t.Helper()
+
+	var got *execx.ExitError
+	if !errors.As(err, &got) {
+		t.Fatalf("got error %v (%T), want *execx.ExitError", err, err)
+		return
+	}
+	status := want.ExitError != nil
+	if diff := cmp.Diff(normalize(want, status), normalize(got, status)); diff != "" {
+		t.Fatalf("*execx.ExitError mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package exectest_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+
+	"acln.ro/execx"
+	"acln.ro/execx/exectest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("EXECX_TEST") == "on" {
+		os.Stderr.WriteString("whoops")
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestComparer(t *testing.T) {
+	a := runSelf(t)
+	b := runSelf(t)
+	if diff := cmp.Diff(a, b, exectest.Comparer); diff != "" {
+		t.Fatalf("identical runs compare unequal:\n%s", diff)
+	}
+	b.Args = append(b.Args, "extra")
+	if cmp.Equal(a, b, exectest.Comparer) {
+		t.Fatalf("different runs compare equal")
+	}
+}
+
+func TestAssertExitError(t *testing.T) {
+	got := runSelf(t)
+	want := &execx.ExitError{
+		Path:     got.Path,
+		Args:     got.Args,
+		Dir:      got.Dir,
+		ChildEnv: got.ChildEnv,
+	}
+	exectest.AssertExitError(t, fmt.Errorf("wrapped: %w", got), want)
+
+	ft := new(fakeTB)
+	want.Dir = "/elsewhere"
+	exectest.AssertExitError(ft, got, want)
+	if !ft.failed {
+		t.Fatalf("mismatch not reported")
+	}
+}
+
+func runSelf(t *testing.T) *execx.ExitError {
+	t.Helper()
+
+	self := exec.Command(os.Args[0])
+	self.Env = append(os.Environ(), "EXECX_TEST=on")
+	_, err := execx.Run(context.Background(), self)
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	return ee
+}
+
+type fakeTB struct {
+	failed bool
+	msg    string
+}
+
+func (ft *fakeTB) Helper() {}
+
+func (ft *fakeTB) Fatalf(format string, args ...interface{}) {
+	ft.failed = true
+	ft.msg = fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,377 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package exectest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"acln.ro/env"
+	"acln.ro/execx"
+)
+
+// ErrUnexpectedCommand is returned by a FakeRunner for commands which do
+// not match any of its expectations.
+var ErrUnexpectedCommand = errors.New("exectest: unexpected command")
+
+// A FakeRunner is an execx.Runner which does not run commands. Instead,
+// it matches them against the expectations added using Expect and
+// ExpectMatch, in the order in which they were added, and replies as
+// configured by the first expectation which matches and which was not
+// met yet. Options passed to Run are ignored. Install a FakeRunner using
+// execx.WithRunner, and call Verify once the code under test returns:
+//
+//	fake := new(exectest.FakeRunner)
+//	fake.Expect("git", "status", "--porcelain").Returns(" M go.mod\n", "", 0)
+//	ctx := execx.WithRunner(context.Background(), fake)
+//	// ...
+//	fake.Verify(t)
+//
+// A FakeRunner is safe for concurrent use by multiple goroutines.
+type FakeRunner struct {
+	mu         sync.Mutex
+	exps       []*Expectation
+	unexpected []Invocation
+}
+
+// An Invocation is a command run using a FakeRunner.
+type Invocation struct {
+	// Args holds the command line arguments, including the name of
+	// the command.
+	Args []string
+
+	// Dir is the working directory of the command.
+	Dir string
+
+	// Env is the environment of the command.
+	Env env.Map
+}
+
+func (inv Invocation) String() string {
+	return quoteArgs(inv.Args)
+}
+
+// An Expectation describes a command expected by a FakeRunner, and the
+// way the FakeRunner replies to it. The methods of an Expectation refine
+// it, and return it, such that they can be chained.
+type Expectation struct {
+	args     []string         // exact arguments, if not nil
+	patterns []*regexp.Regexp // patterns matching each argument, if not nil
+	env      map[string]string
+	dir      string
+	dirSet   bool
+	times    int
+
+	stdout, stderr []byte
+	exitCode       int
+	err            error
+
+	calls int
+}
+
+// Expect adds an expectation for a command whose arguments, including the
+// name of the command, are exactly args. The command is expected once,
+// and succeeds without output, unless configured otherwise.
+func (f *FakeRunner) Expect(args ...string) *Expectation {
+	return f.add(&Expectation{args: append([]string(nil), args...)})
+}
+
+// ExpectMatch adds an expectation for a command which has as many
+// arguments as patterns, including the name of the command, each of which
+// matches the corresponding regular expression in full. ExpectMatch panics
+// if a pattern does not compile.
+func (f *FakeRunner) ExpectMatch(patterns ...string) *Expectation {
+	e := new(Expectation)
+	for _, p := range patterns {
+		e.patterns = append(e.patterns, regexp.MustCompile("^(?:"+p+")$"))
+	}
+	return f.add(e)
+}
+
+func (f *FakeRunner) add(e *Expectation) *Expectation {
+	e.times = 1
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.exps = append(f.exps, e)
+	return e
+}
+
+// WithEnv requires the environment of the command to hold key, set to
+// value. Other variables are not checked.
+func (e *Expectation) WithEnv(key, value string) *Expectation {
+	if e.env == nil {
+		e.env = make(map[string]string)
+	}
+	e.env[key] = value
+	return e
+}
+
+// InDir requires the working directory of the command to be dir. The
+// working directory of commands whose Dir is empty is the working
+// directory of the test.
+func (e *Expectation) InDir(dir string) *Expectation {
+	e.dir = dir
+	e.dirSet = true
+	return e
+}
+
+// Times sets the number of times the command is expected.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Returns configures the output of the command, and the code it exits
+// with. If exitCode is not zero, Run returns an *execx.ExitError.
+func (e *Expectation) Returns(stdout, stderr string, exitCode int) *Expectation {
+	e.stdout, e.stderr, e.exitCode = []byte(stdout), []byte(stderr), exitCode
+	return e
+}
+
+// Fails makes Run return err, as if the command failed to start.
+func (e *Expectation) Fails(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+func (e *Expectation) String() string {
+	if e.args != nil {
+		return quoteArgs(e.args)
+	}
+	pats := make([]string, len(e.patterns))
+	for i, p := range e.patterns {
+		if lit, complete := p.LiteralPrefix(); complete {
+			pats[i] = lit
+			continue
+		}
+		pats[i] = "/" + unanchor(p) + "/"
+	}
+	return strings.Join(pats, " ")
+}
+
+// unanchor returns the pattern passed to ExpectMatch which compiled to p.
+func unanchor(p *regexp.Regexp) string {
+	return strings.TrimSuffix(strings.TrimPrefix(p.String(), "^(?:"), ")$")
+}
+
+// arity returns the number of arguments e expects.
+func (e *Expectation) arity() int {
+	if e.args == nil {
+		return len(e.patterns)
+	}
+	return len(e.args)
+}
+
+// sortedEnv returns the variables e requires, as sorted key=value pairs.
+func (e *Expectation) sortedEnv() []string {
+	kvs := make([]string, 0, len(e.env))
+	for k, v := range e.env {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return kvs
+}
+
+// mismatches describes the ways in which inv does not match e.
+func (e *Expectation) mismatches(inv Invocation) []string {
+	var m []string
+	if want := e.arity(); len(inv.Args) != want {
+		m = append(m, fmt.Sprintf("got %d arguments, want %d", len(inv.Args), want))
+	} else {
+		for i, arg := range inv.Args {
+			switch {
+			case e.args != nil && arg != e.args[i]:
+				m = append(m, fmt.Sprintf("arg %d: got %q, want %q", i, arg, e.args[i]))
+			case e.args == nil && !e.patterns[i].MatchString(arg):
+				m = append(m, fmt.Sprintf("arg %d: got %q, want match for /%s/", i, arg, unanchor(e.patterns[i])))
+			}
+		}
+	}
+	keys := make([]string, 0, len(e.env))
+	for k := range e.env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := inv.Env[k]; !ok {
+			m = append(m, fmt.Sprintf("env %s: unset, want %q", k, e.env[k]))
+		} else if v != e.env[k] {
+			m = append(m, fmt.Sprintf("env %s: got %q, want %q", k, v, e.env[k]))
+		}
+	}
+	if e.dirSet && inv.Dir != e.dir {
+		m = append(m, fmt.Sprintf("dir: got %s, want %s", inv.Dir, e.dir))
+	}
+	return m
+}
+
+// Run matches cmd against the expectations of f, and replies as per the
+// expectation which matches it. If no expectation matches, Run returns an
+// error which wraps ErrUnexpectedCommand.
+func (f *FakeRunner) Run(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+	inv := invocation(cmd)
+	f.mu.Lock()
+	var match *Expectation
+	for _, e := range f.exps {
+		if e.calls < e.times && len(e.mismatches(inv)) == 0 {
+			match = e
+			break
+		}
+	}
+	if match == nil {
+		f.unexpected = append(f.unexpected, inv)
+		f.mu.Unlock()
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedCommand, inv)
+	}
+	match.calls++
+	f.mu.Unlock()
+
+	if match.err != nil {
+		return nil, match.err
+	}
+	res := &execx.Result{Path: cmd.Path, Args: cmd.Args, Dir: inv.Dir, ExitCode: match.exitCode}
+	if cmd.Stdout != nil {
+		cmd.Stdout.Write(match.stdout)
+	} else {
+		res.Stdout = append([]byte(nil), match.stdout...)
+	}
+	if cmd.Stderr != nil {
+		cmd.Stderr.Write(match.stderr)
+	} else {
+		res.Stderr = append([]byte(nil), match.stderr...)
+	}
+	if match.exitCode == 0 {
+		return res, nil
+	}
+	return res, &execx.ExitError{
+		ExitError: &exec.ExitError{Stderr: res.Stderr},
+		Path:      cmd.Path,
+		Args:      cmd.Args,
+		Dir:       inv.Dir,
+		ChildEnv:  inv.Env,
+		Result:    res,
+	}
+}
+
+// invocation describes cmd.
+func invocation(cmd *exec.Cmd) Invocation {
+	inv := Invocation{Args: append([]string(nil), cmd.Args...), Dir: cmd.Dir}
+	if len(inv.Args) == 0 {
+		inv.Args = []string{cmd.Path}
+	}
+	if inv.Dir == "" {
+		inv.Dir, _ = os.Getwd()
+	}
+	if cmd.Env == nil {
+		inv.Env = env.Variables()
+	} else {
+		inv.Env = env.Parse(cmd.Env...)
+	}
+	return inv
+}
+
+// Unexpected returns the commands which matched no expectation so far.
+func (f *FakeRunner) Unexpected() []Invocation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Invocation(nil), f.unexpected...)
+}
+
+// Verify fails the test if an expectation of f was not met, or if f ran
+// a command which matched no expectation. The report lists the unmet
+// expectations, and the unexpected commands, along with the expectation
+// which is closest to each of them, and the ways in which they differ.
+func (f *FakeRunner) Verify(t TB) {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var unmet []*Expectation
+	for _, e := range f.exps {
+		if e.calls < e.times {
+			unmet = append(unmet, e)
+		}
+	}
+	if len(unmet) == 0 && len(f.unexpected) == 0 {
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d unmet expectations, %d unexpected commands", len(unmet), len(f.unexpected))
+	for _, e := range unmet {
+		fmt.Fprintf(&sb, "\nunmet: %v", e)
+		fmt.Fprintf(&sb, "\n\tcalls: %d of %d", e.calls, e.times)
+		if len(e.env) > 0 {
+			fmt.Fprintf(&sb, "\n\tenv: %s", strings.Join(e.sortedEnv(), " "))
+		}
+		if e.dirSet {
+			fmt.Fprintf(&sb, "\n\tdir: %s", e.dir)
+		}
+	}
+	for _, inv := range f.unexpected {
+		fmt.Fprintf(&sb, "\nunexpected: %v", inv)
+		fmt.Fprintf(&sb, "\n\tdir: %s", inv.Dir)
+		if e, m := f.closest(inv); e != nil {
+			fmt.Fprintf(&sb, "\n\tclosest: %v", e)
+			for _, s := range m {
+				fmt.Fprintf(&sb, "\n\tmismatch: %s", s)
+			}
+			if len(m) == 0 {
+				fmt.Fprintf(&sb, "\n\tmismatch: expected %d times, already met", e.times)
+			}
+		}
+	}
+	t.Fatalf("%s", sb.String())
+}
+
+// closest returns the expectation which is closest to matching inv, and
+// the ways in which they differ, or nil if f has no expectations. The
+// expectations with the same number of arguments as inv are preferred.
+func (f *FakeRunner) closest(inv Invocation) (*Expectation, []string) {
+	var (
+		best       *Expectation
+		mismatches []string
+		bestScore  int
+	)
+	for _, e := range f.exps {
+		m := e.mismatches(inv)
+		score := len(m)
+		if e.arity() != len(inv.Args) {
+			score += len(inv.Args) + e.arity() + len(e.env) + 1
+		}
+		if best == nil || score < bestScore {
+			best, mismatches, bestScore = e, m, score
+		}
+	}
+	return best, mismatches
+}
+
+// quoteArgs joins args by spaces, quoting those which need quoting.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			quoted[i] = fmt.Sprintf("%q", arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package exectest_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+	"acln.ro/execx/exectest"
+)
+
+func TestFakeRunner(t *testing.T) {
+	fake := new(exectest.FakeRunner)
+	fake.Expect("git", "status", "--porcelain").Returns(" M go.mod\n", "", 0)
+	fake.ExpectMatch("git", "commit", "-m", `.+`).WithEnv("GIT_AUTHOR_NAME", "gopher").InDir("/src").Times(2)
+	fake.Expect("git", "push").Returns("", "rejected\n", 1)
+	ctx := execx.WithRunner(context.Background(), fake)
+
+	res, err := execx.Run(ctx, exec.Command("git", "status", "--porcelain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != " M go.mod\n" {
+		t.Errorf("got stdout %q", res.Stdout)
+	}
+	for _, msg := range []string{"first", "second"} {
+		cmd := exec.Command("git", "commit", "-m", msg)
+		cmd.Dir = "/src"
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=gopher")
+		if _, err := execx.Run(ctx, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = execx.Run(ctx, exec.Command("git", "push"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) || ee.ExitCode() != 1 || string(ee.Stderr) != "rejected\n" {
+		t.Fatalf("got %v, want exit status 1 with stderr", err)
+	}
+	fake.Verify(t)
+}
+
+func TestFakeRunnerReport(t *testing.T) {
+	fake := new(exectest.FakeRunner)
+	fake.Expect("make", "test")
+	fake.ExpectMatch("go", "build", `\./\.\.\.`).WithEnv("CGO_ENABLED", "0")
+	ctx := execx.WithRunner(context.Background(), fake)
+
+	cmd := exec.Command("go", "build", "./cmd/...")
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=1")
+	_, err := execx.Run(ctx, cmd)
+	if !errors.Is(err, exectest.ErrUnexpectedCommand) {
+		t.Fatalf("got %v, want ErrUnexpectedCommand", err)
+	}
+	if got := fake.Unexpected(); len(got) != 1 || got[0].String() != "go build ./cmd/..." {
+		t.Errorf("got unexpected commands %v", got)
+	}
+	ft := new(fakeTB)
+	fake.Verify(ft)
+	if !ft.failed {
+		t.Fatal("failures not reported")
+	}
+	for _, want := range []string{
+		"2 unmet expectations, 1 unexpected commands",
+		"unmet: make test\n\tcalls: 0 of 1",
+		"unexpected: go build ./cmd/...",
+		"closest: go build ./...",
+		`mismatch: arg 2: got "./cmd/...", want match for /\./\.\.\./`,
+		`mismatch: env CGO_ENABLED: got "1", want "0"`,
+	} {
+		if !strings.Contains(ft.msg, want) {
+			t.Errorf("report does not contain %q:\n%s", want, ft.msg)
+		}
+	}
+}
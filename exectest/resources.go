@@ -0,0 +1,57 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package exectest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"acln.ro/execx"
+)
+
+// VerifyResources fails the test if tr, or execx.DefaultTracker if tr is
+// nil, tracks temporary resources which were neither released nor kept,
+// such as the scripts written by execx.RunScript, and cleans them up, such
+// that leaks are reported where they happen, rather than accumulating on
+// the machine running the tests. Use it as
+//
+//	defer exectest.VerifyResources(t, nil)
+//
+// Since execx.DefaultTracker is shared by all the tests of a package,
+// tests which run in parallel should track their resources using their own
+// tracker, carried by the context of their commands, as per
+// execx.WithResourceTracker.
+func VerifyResources(t TB, tr *execx.ResourceTracker) {
+	t.Helper()
+
+	if tr == nil {
+		tr = execx.DefaultTracker
+	}
+	live := tr.Live()
+	if len(live) == 0 {
+		return
+	}
+	err := tr.Cleanup()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d temporary resources leaked:", len(live))
+	for _, r := range live {
+		fmt.Fprintf(&sb, "\n\t%s %s, created at %s", r.Kind, r.Path, r.Created.Format(time.RFC3339Nano))
+	}
+	if err != nil {
+		fmt.Fprintf(&sb, "\ncleaning up: %v", err)
+	}
+	t.Fatalf("%s", sb.String())
+}
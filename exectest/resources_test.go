@@ -0,0 +1,49 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package exectest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"acln.ro/execx"
+	"acln.ro/execx/exectest"
+)
+
+func TestVerifyResources(t *testing.T) {
+	tr := new(execx.ResourceTracker)
+	exectest.VerifyResources(t, tr)
+
+	dir, err := ioutil.TempDir("", "exectest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "leaked")
+	tr.Track("test", dir, func() error { return os.RemoveAll(dir) })
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ft := new(fakeTB)
+	exectest.VerifyResources(ft, tr)
+	if !ft.failed {
+		t.Fatalf("leak not reported")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("leaked resource not cleaned up: %v", err)
+	}
+	exectest.VerifyResources(t, tr)
+}
@@ -17,23 +17,33 @@
 package execx
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 
 	"acln.ro/env"
+	"acln.ro/execx/errcode"
 )
 
 // Cmdline returns an approximation of the command line invocation equivalent
 // to cmd. The returned string is the concatenation of filepath.Base(cmd.Path)
 // and cmd.Args, separated by spaces.
 //
+// If cmd.Args[0] names a different program than cmd.Path, as is the case
+// for multiplexers such as busybox, which behave according to argv[0], both
+// are included, as in "busybox (as ls) -l". See WithArgv0.
+//
 // Note that Cmdline does not produce shell-safe output, and does not account
 // for environment variables. Cmdline should be used for strictly informative
-// purposes, such as logging or debugging.
+// purposes, such as logging or debugging. See CmdlineQuoted for shell-safe
+// output.
 func Cmdline(cmd *exec.Cmd) string {
 	return cmdline(cmd.Path, cmd.Args)
 }
@@ -44,13 +54,29 @@ func Cmdline(cmd *exec.Cmd) string {
 //
 // If err is nil, Wrap returns nil.
 //
+// If err was returned because cmd failed to start, Wrap returns a
+// *StartError.
+//
 // If err is not of type *exec.ExitError, it is returned unchanged.
 //
 // If err is of type *exec.ExitError, but did not originate from cmd, it is
 // returned unchanged.
+//
+// Details from collectors registered using RegisterCollector are attached
+// to the returned *ExitError or *StartError.
 func Wrap(err error, cmd *exec.Cmd) error {
-	if err == nil {
-		return nil
+	return WrapWith(err, cmd)
+}
+
+// WrapWith is like Wrap, but also attaches details gathered by the
+// specified collectors, following those gathered by collectors registered
+// using RegisterCollector.
+func WrapWith(err error, cmd *exec.Cmd, collectors ...Collector) error {
+	if err == nil || cmd == nil {
+		return err
+	}
+	if isStartError(err) && cmd.Process == nil {
+		return wrapStart(err, cmd, collectors)
 	}
 	ee, ok := err.(*exec.ExitError)
 	if !ok {
@@ -60,24 +86,108 @@ func Wrap(err error, cmd *exec.Cmd) error {
 		return ee
 	}
 	newee := &ExitError{
+		ExitError: ee,
+		Path:      cmd.Path,
+		Args:      cmd.Args,
+		PID:       ee.Pid(),
+		PPID:      os.Getpid(),
+		PGID:      pgidOf(cmd, ee.Pid()),
+	}
+	newee.Dir, newee.ParentEnv, newee.ChildEnv = describe(cmd)
+	newee.ResolvedPath = resolvePath(cmd.Path, newee.Dir)
+	newee.StderrDropped = omittedBytes(ee.Stderr)
+	newee.Details = collect(cmd, ee.ProcessState, collectors)
+	newee.cmd = Clone(cmd)
+	newee.callers = captureCallers()
+	return newee
+}
+
+// WrapMinimal is like Wrap, but does as little work as possible, for use
+// on hot paths which wrap many errors. WrapMinimal does not consult
+// collectors, and does not capture the environment or the working
+// directory: the returned *ExitError has nil ParentEnv and ChildEnv, and
+// its Dir field is cmd.Dir, which may be empty. Call CaptureEnv to capture
+// the environment at a later time, if needed.
+//
+// Unlike Wrap, WrapMinimal returns errors from commands which failed to
+// start unchanged.
+func WrapMinimal(err error, cmd *exec.Cmd) error {
+	if err == nil || cmd == nil {
+		return err
+	}
+	ee, ok := err.(*exec.ExitError)
+	if !ok || ee.ProcessState != cmd.ProcessState {
+		return err
+	}
+	return &ExitError{
 		ExitError: ee,
 		Path:      cmd.Path,
 		Args:      cmd.Args,
 		Dir:       cmd.Dir,
-		ParentEnv: env.Variables(),
+		rawEnv:    cmd.Env,
+	}
+}
+
+// CaptureEnv populates e.ParentEnv and e.ChildEnv, if they were not
+// captured when e was created, such as when e was created by WrapMinimal.
+// In that case, ParentEnv reflects the environment of the parent process
+// at the time of the call to CaptureEnv. Otherwise, CaptureEnv does nothing.
+func (e *ExitError) CaptureEnv() {
+	if e.ParentEnv != nil {
+		return
+	}
+	e.ParentEnv = env.Variables()
+	if e.rawEnv == nil {
+		e.ChildEnv = e.ParentEnv
+	} else {
+		e.ChildEnv = env.Parse(e.rawEnv...)
+	}
+}
+
+// resolvePath returns path, relative to dir if it is not absolute, with
+// symbolic links evaluated, or the empty string if it cannot be resolved.
+func resolvePath(path, dir string) string {
+	if path == "" {
+		return ""
 	}
-	if newee.Dir == "" {
+	if !filepath.IsAbs(path) && dir != "" {
+		path = filepath.Join(dir, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	return resolved
+}
+
+// symlinked reports whether path, relative to dir, resolved to a different
+// file named resolved.
+func symlinked(path, resolved, dir string) bool {
+	if path == "" || resolved == "" {
+		return false
+	}
+	if !filepath.IsAbs(path) && dir != "" {
+		path = filepath.Join(dir, path)
+	}
+	return filepath.Clean(path) != resolved
+}
+
+// describe returns the working directory and environment cmd runs with.
+func describe(cmd *exec.Cmd) (dir string, parentEnv, childEnv env.Map) {
+	dir = cmd.Dir
+	if dir == "" {
 		wd, err := os.Getwd()
 		if err == nil {
-			newee.Dir = wd
+			dir = wd
 		}
 	}
+	parentEnv = env.Variables()
 	if cmd.Env == nil {
-		newee.ChildEnv = newee.ParentEnv
+		childEnv = parentEnv
 	} else {
-		newee.ChildEnv = env.Parse(cmd.Env...)
+		childEnv = env.Parse(cmd.Env...)
 	}
-	return newee
+	return dir, parentEnv, childEnv
 }
 
 // ExitError wraps an *os/exec.ExitError with additional details.
@@ -88,6 +198,13 @@ type ExitError struct {
 	// Path is the path of the command which was executed.
 	Path string
 
+	// ResolvedPath is Path, with symbolic links evaluated, as per
+	// filepath.EvalSymlinks, or the empty string if Path could not be
+	// resolved. ResolvedPath differs from Path if the command was run
+	// through a symbolic link, such as a shim installed by a version
+	// manager. See Symlinked.
+	ResolvedPath string
+
 	// Args holds command line arguments.
 	Args []string
 
@@ -99,6 +216,63 @@ type ExitError struct {
 
 	// ChildEnv is the environment of the child process.
 	ChildEnv env.Map
+
+	// EnvSources records the origin of each variable in ChildEnv, if
+	// the environment was built using WithEnv or WithDefaultEnv.
+	// Otherwise, EnvSources is nil.
+	EnvSources map[string]EnvSource
+
+	// Profiles holds the names of the environment profiles applied to
+	// the command using WithProfile, in order.
+	Profiles []string
+
+	// PID is the process ID of the child process.
+	PID int
+
+	// PPID is the process ID of its parent, the current process.
+	PPID int
+
+	// PGID is the process group ID of the child process, or 0 if
+	// process groups are not supported on this platform.
+	PGID int
+
+	// StderrDropped is the number of bytes dropped from the middle of
+	// the captured standard error, by exec.Cmd.Output, which caps it at
+	// 32KB, or by WithStderrLimit. If StderrDropped is zero, the standard
+	// error was not truncated.
+	StderrDropped int64
+
+	// Details holds additional details gathered by collectors.
+	Details []Detail
+
+	// Reason explains why the process exited, if a reason beyond the
+	// exit status is known, such as the process being killed by the
+	// out-of-memory killer.
+	Reason Reason
+
+	// Hints holds explanations for the failure of the command, such as
+	// the process being blocked on a pipe nobody was reading from.
+	Hints []string
+
+	// Result describes the failed run, if the command was run by
+	// Run or Start. Otherwise, Result is nil.
+	Result *Result
+
+	// State describes how the command exited, if it was run by a
+	// backend other than os/exec, and wrapped using WrapState. If State
+	// is nil, the state is e.ProcessState.
+	State StateProvider
+
+	cmd     *exec.Cmd // clone of the original command, for Command
+	rawEnv  []string  // cmd.Env, for CaptureEnv
+	callers callers   // call stack which launched the command
+
+	hintMsgs []message // untranslated Hints, if known
+
+	schema  int                        // schema version, if decoded by UnmarshalJSON
+	unknown map[string]json.RawMessage // unknown fields preserved by UnmarshalJSON
+
+	fmtCache *formatCache // cached representations, created on demand
 }
 
 // Cmdline returns the concatenation of filepath.Base(e.Path) and e.Args,
@@ -107,14 +281,65 @@ func (e *ExitError) Cmdline() string {
 	return cmdline(e.Path, e.Args)
 }
 
+// Symlinked reports whether e.Path names a symbolic link, or a path
+// through one, such that the executable which ran is e.ResolvedPath.
+func (e *ExitError) Symlinked() bool {
+	return symlinked(e.Path, e.ResolvedPath, e.Dir)
+}
+
 // Unwrap returns e.ExitError.
 func (e *ExitError) Unwrap() error {
 	return e.ExitError
 }
 
-// Error returns e.ExitError.Error().
+// Error describes how the process exited, as per e.State, or
+// e.ExitError.Error(). If the state of the process is not available,
+// such as for failures replayed from a Cassette, Error returns a message
+// which describes the exit code instead.
 func (e *ExitError) Error() string {
-	return e.ExitError.Error()
+	if !e.hasState() {
+		if e.Reason == ReasonCanceledByCaller && e.Result == nil {
+			return "canceled by caller"
+		}
+		return fmt.Sprintf("exit status %d", e.ExitCode())
+	}
+	return e.state().String()
+}
+
+// ExitCode returns the exit code of the process, or -1 if the process was
+// terminated by a signal. If the state of the process is not available,
+// ExitCode returns e.Result.ExitCode, or -1 if e.Result is nil.
+func (e *ExitError) ExitCode() int {
+	if !e.hasState() {
+		if e.Result != nil {
+			return e.Result.ExitCode
+		}
+		return -1
+	}
+	return e.state().ExitCode()
+}
+
+// UserTime returns the user CPU time of the process, or zero if the state
+// of the process is not available.
+func (e *ExitError) UserTime() time.Duration {
+	if !e.hasState() {
+		return 0
+	}
+	return e.state().UserTime()
+}
+
+// SystemTime returns the system CPU time of the process, or zero if the
+// state of the process is not available.
+func (e *ExitError) SystemTime() time.Duration {
+	if !e.hasState() {
+		return 0
+	}
+	return e.state().SystemTime()
+}
+
+// hasState reports whether the state of the exited process is available.
+func (e *ExitError) hasState() bool {
+	return e.state() != nil
 }
 
 // Format implements fmt.Formatter for *ExitError as follows:
@@ -126,38 +351,240 @@ func (e *ExitError) Error() string {
 //
 // For "%+v", Format emits everything "%v" emits, and some additional details
 // about the child process: its working directory, its user and system CPU
-// time, its environment, etc.
+// time, the top frames of the Go call stack which launched it, its
+// environment and the origins of the variables in it, etc.
+//
+// Unless Config.Catalog is set, the output is cached, such that an error
+// which is formatted repeatedly, such as for logs and for error reporting
+// services, is formatted once. The cache is invalidated when details are
+// set using WithDetail, when the fields of e change, and when the Config
+// is replaced, such that redaction follows Config.SensitiveNames. Callers
+// which modify existing elements of the slices or maps of an *ExitError
+// after formatting it must call Invalidate.
 func (e *ExitError) Format(s fmt.State, verb rune) {
 	if verb != 'v' {
 		return
 	}
+	p := defaultPrinter()
+	if p.c != nil {
+		e.format(s, p)
+		return
+	}
+	key := "%v"
 	if s.Flag('+') {
-		e.formatDetail(s)
+		key = "%+v"
+	}
+	b, _ := e.cached(key, func() ([]byte, error) {
+		var buf bytes.Buffer
+		if s.Flag('+') {
+			e.formatDetail(&buf, p)
+		} else {
+			e.formatBasic(&buf, p)
+		}
+		return buf.Bytes(), nil
+	})
+	s.Write(b)
+}
+
+// format formats e for "%v" or "%+v", as requested by s, translating
+// fixed messages using p.
+func (e *ExitError) format(s fmt.State, p printer) {
+	if s.Flag('+') {
+		e.formatDetail(s, p)
 	} else {
-		e.formatBasic(s)
+		e.formatBasic(s, p)
 	}
 }
 
-func (e *ExitError) formatDetail(w io.Writer) {
-	e.formatBasic(w)
+func (e *ExitError) formatDetail(w io.Writer, p printer) {
+	e.formatBasic(w, p)
 	fmt.Fprintf(w, "\n")
-	fmt.Fprintf(w, "workdir: %s\n", e.Dir)
-	fmt.Fprintf(w, "user time: %v\n", e.UserTime())
-	fmt.Fprintf(w, "system time: %v\n", e.SystemTime())
+	if e.Symlinked() {
+		fmt.Fprintf(w, "%s\n", p.sprintf("resolved path: %s", e.ResolvedPath))
+	}
+	fmt.Fprintf(w, "%s\n", p.sprintf("workdir: %s", e.Dir))
+	if e.PID != 0 {
+		fmt.Fprintf(w, "%s\n", p.sprintf("pid: %d ppid: %d pgid: %d", e.PID, e.PPID, e.PGID))
+	}
+	fmt.Fprintf(w, "%s\n", p.sprintf("user time: %v", e.UserTime()))
+	fmt.Fprintf(w, "%s\n", p.sprintf("system time: %v", e.SystemTime()))
+	if e.StderrDropped > 0 {
+		fmt.Fprintf(w, "%s\n", p.sprintf("stderr truncated: dropped %d bytes", e.StderrDropped))
+	}
+	for _, d := range e.Details {
+		fmt.Fprintf(w, "%s: %v\n", d.Key, d.Value)
+	}
+	if e.Result != nil {
+		if e.Result.Scheduling != nil {
+			fmt.Fprintf(w, "%s\n", p.sprintf("scheduling: %v", e.Result.Scheduling))
+		}
+		e.Result.Timeline.format(w, p)
+	}
+	e.callers.format(w, p)
+	if len(e.Profiles) > 0 {
+		fmt.Fprintf(w, "%s\n", p.sprintf("profiles: %s", strings.Join(e.Profiles, ", ")))
+	}
+	formatEnvSources(w, e.EnvSources, p)
 	fmt.Fprintf(w, "\n")
 	fmt.Fprintf(w, "%+v", e.ChildEnv)
 }
 
-func (e *ExitError) formatBasic(w io.Writer) {
-	fmt.Fprintf(w, "%s: %s", e.Cmdline(), e.ExitError.Error())
+func (e *ExitError) formatBasic(w io.Writer, p printer) {
+	fmt.Fprintf(w, "%s: %s", e.Cmdline(), e.Error())
+	if e.Reason != ReasonNone {
+		fmt.Fprintf(w, " (%s)", e.Reason)
+	}
 	if e.ExitError.Stderr != nil {
 		fmt.Fprintf(w, ": %s", e.ExitError.Stderr)
 	}
+	for _, hint := range e.localizedHints(p) {
+		fmt.Fprintf(w, " (%s)", hint)
+	}
+}
+
+// localizedHints returns e.Hints, translated using p, if possible.
+func (e *ExitError) localizedHints(p printer) []string {
+	if p.c == nil || len(e.hintMsgs) != len(e.Hints) {
+		return e.Hints
+	}
+	hints := make([]string, 0, len(e.hintMsgs))
+	for _, m := range e.hintMsgs {
+		hints = append(hints, p.sprintf(m.key, m.args...))
+	}
+	return hints
+}
+
+// Fields returns a flat representation of e, suitable for use with
+// structured logging packages. The environment is not included. Keys
+// of details gathered by collectors do not override built-in keys.
+func (e *ExitError) Fields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, d := range e.Details {
+		fields[d.Key] = d.Value
+	}
+	fields["cmdline"] = e.Cmdline()
+	fields["path"] = e.Path
+	if e.Symlinked() {
+		fields["resolved_path"] = e.ResolvedPath
+	}
+	fields["args"] = e.Args
+	fields["dir"] = e.Dir
+	fields["exit_code"] = e.ExitCode()
+	if e.PID != 0 {
+		fields["pid"] = e.PID
+		fields["ppid"] = e.PPID
+		fields["pgid"] = e.PGID
+	}
+	fields["user_time"] = e.UserTime()
+	fields["system_time"] = e.SystemTime()
+	if e.ExitError.Stderr != nil {
+		fields["stderr"] = string(e.ExitError.Stderr)
+	}
+	if e.StderrDropped > 0 {
+		fields["stderr_dropped"] = e.StderrDropped
+	}
+	if e.Reason != ReasonNone {
+		fields["reason"] = string(e.Reason)
+	}
+	fields["code"] = string(e.Code())
+	if len(e.Hints) > 0 {
+		fields["hints"] = e.Hints
+	}
+	if len(e.Profiles) > 0 {
+		fields["profiles"] = e.Profiles
+	}
+	return fields
+}
+
+// jsonExitError is the JSON representation of an ExitError.
+type jsonExitError struct {
+	Schema     int                    `json:"schema"`
+	Path       string                 `json:"path"`
+	Resolved   string                 `json:"resolved_path,omitempty"`
+	Symlinked  bool                   `json:"symlinked,omitempty"`
+	Args       []string               `json:"args"`
+	Dir        string                 `json:"dir"`
+	ExitCode   int                    `json:"exit_code"`
+	PID        int                    `json:"pid,omitempty"`
+	PPID       int                    `json:"ppid,omitempty"`
+	PGID       int                    `json:"pgid,omitempty"`
+	Error      string                 `json:"error"`
+	Stderr     string                 `json:"stderr,omitempty"`
+	StderrDrop int64                  `json:"stderr_dropped,omitempty"`
+	UserTime   time.Duration          `json:"user_time"`
+	SystemTime time.Duration          `json:"system_time"`
+	ChildEnv   env.Map                `json:"env"`
+	Profiles   []string               `json:"profiles,omitempty"`
+	Reason     Reason                 `json:"reason,omitempty"`
+	Code       errcode.Code           `json:"code"`
+	Hints      []string               `json:"hints,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler for *ExitError. The values of
+// sensitive environment variables are redacted, as per RedactEnv. The
+// representation records its version in a field named "schema". See
+// ExitErrorSchema and UnmarshalJSON. The representation is cached, as
+// described by Format.
+func (e *ExitError) MarshalJSON() ([]byte, error) {
+	b, err := e.cached("json", e.marshalJSON)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// marshalJSON returns the JSON representation of e, bypassing the cache.
+func (e *ExitError) marshalJSON() ([]byte, error) {
+	je := jsonExitError{
+		Schema:     ExitErrorSchema,
+		Path:       e.Path,
+		Resolved:   e.ResolvedPath,
+		Symlinked:  e.Symlinked(),
+		Args:       e.Args,
+		Dir:        e.Dir,
+		ExitCode:   e.ExitCode(),
+		PID:        e.PID,
+		PPID:       e.PPID,
+		PGID:       e.PGID,
+		Error:      e.Error(),
+		Stderr:     string(e.ExitError.Stderr),
+		StderrDrop: e.StderrDropped,
+		UserTime:   e.UserTime(),
+		SystemTime: e.SystemTime(),
+		ChildEnv:   RedactEnv(e.ChildEnv),
+		Profiles:   e.Profiles,
+		Reason:     e.Reason,
+		Code:       e.Code(),
+		Hints:      e.Hints,
+		Details:    detailMap(e.Details),
+	}
+	b, err := json.Marshal(je)
+	if err != nil {
+		return nil, err
+	}
+	return e.withUnknown(b)
 }
 
 func cmdline(path string, args []string) string {
-	var cmdline []string
-	cmdline = append(cmdline, filepath.Base(path))
-	cmdline = append(cmdline, args[1:]...)
+	name := filepath.Base(path)
+	if len(args) == 0 {
+		return name
+	}
+	if !sameProgram(name, filepath.Base(args[0])) {
+		name += " (as " + args[0] + ")"
+	}
+	cmdline := append([]string{name}, args[1:]...)
 	return strings.Join(cmdline, " ")
 }
+
+// sameProgram reports whether the base names a and b name the same
+// program, ignoring extensions, such as .exe on Windows.
+func sameProgram(a, b string) bool {
+	a = strings.TrimSuffix(a, filepath.Ext(a))
+	b = strings.TrimSuffix(b, filepath.Ext(b))
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
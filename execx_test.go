@@ -15,12 +15,21 @@
 package execx_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -32,9 +41,181 @@ import (
 )
 
 func TestMain(m *testing.M) {
-	if os.Getenv("EXECX_TEST") == "on" {
+	execx.StatusMain()
+	switch os.Getenv("EXECX_TEST") {
+	case "on":
 		os.Stderr.WriteString("whoops")
 		os.Exit(1)
+	case "echo":
+		io.Copy(os.Stdout, os.Stdin)
+		os.Stderr.WriteString("echoed")
+		os.Exit(0)
+	case "sigterm":
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGTERM)
+		<-c
+		os.Stderr.WriteString("terminated")
+		os.Exit(3)
+	case "hang":
+		signal.Ignore(syscall.SIGTERM)
+		time.Sleep(time.Hour)
+		os.Exit(0)
+	case "listen":
+		if _, err := net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			os.Stderr.WriteString(err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "dial":
+		if _, err := net.DialTimeout("tcp", "192.0.2.1:9", time.Second); err != nil {
+			os.Stderr.WriteString(err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "create":
+		f, err := os.Create(os.Getenv("EXECX_TEST_PATH"))
+		if err != nil {
+			os.Stderr.WriteString(err.Error())
+			os.Exit(1)
+		}
+		f.Close()
+		os.Exit(0)
+	case "worker":
+		dec := json.NewDecoder(os.Stdin)
+		enc := json.NewEncoder(os.Stdout)
+		for {
+			var req execx.WorkRequest
+			if err := dec.Decode(&req); err != nil {
+				os.Exit(0)
+			}
+			resp := execx.WorkResponse{RequestID: req.RequestID}
+			switch req.Arguments[0] {
+			case "fail":
+				resp.ExitCode = 1
+				resp.Output = "failed"
+			case "crash":
+				os.Stderr.WriteString("crashing")
+				os.Exit(2)
+			default:
+				resp.Output = fmt.Sprintf("%d: %s", os.Getpid(), strings.Join(req.Arguments, " "))
+			}
+			enc.Encode(resp)
+		}
+	case "serve":
+		addr := os.Getenv("EXECX_TEST_ADDR")
+		if addr == "" {
+			addr = "127.0.0.1:0"
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			os.Stderr.WriteString(err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "listening on %s\n", ln.Addr())
+		http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		os.Exit(1)
+	case "pwd":
+		wd, _ := os.Getwd()
+		os.Stdout.WriteString(wd)
+		os.Exit(0)
+	case "args":
+		os.Stderr.WriteString(strings.Join(os.Args[1:], " "))
+		os.Exit(1)
+	case "spawn-orphan":
+		middle := exec.Command(os.Args[0])
+		middle.Env = append(os.Environ(), "EXECX_TEST=middle")
+		if err := middle.Run(); err != nil {
+			os.Exit(1)
+		}
+		io.Copy(ioutil.Discard, os.Stdin)
+		os.Exit(0)
+	case "middle":
+		orphan := exec.Command(os.Args[0])
+		orphan.Env = append(os.Environ(), "EXECX_TEST=orphan")
+		if err := orphan.Start(); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "orphan":
+		time.Sleep(200 * time.Millisecond)
+		os.Exit(7)
+	case "flood":
+		os.Stdout.Write(make([]byte, 1<<20))
+		os.Exit(0)
+	case "hang-tree":
+		nap := exec.Command(os.Args[0])
+		nap.Env = append(os.Environ(), "EXECX_TEST=nap")
+		nap.Run()
+		os.Exit(0)
+	case "leak-stdout":
+		nap := exec.Command(os.Args[0])
+		nap.Env = append(os.Environ(), "EXECX_TEST=nap")
+		nap.Stdout = os.Stdout
+		nap.Start()
+		os.Exit(0)
+	case "self":
+		if !execx.IsSelf() {
+			os.Exit(2)
+		}
+		if f := execx.SelfFile(0, "handoff"); f != nil {
+			f.WriteString(strings.Join(os.Args[1:], " "))
+		}
+		if len(os.Args) > 1 && os.Args[1] == "fail" {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "activated":
+		files, err := execx.ActivationFiles()
+		if err != nil || len(files) != 1 || os.Getenv("LISTEN_PID") != "" {
+			os.Exit(2)
+		}
+		lns, err := execx.ActivationListeners()
+		if err != nil {
+			os.Exit(3)
+		}
+		conn, err := lns[0].Accept()
+		if err != nil {
+			os.Exit(4)
+		}
+		conn.Write([]byte(files[0].Name()))
+		conn.Close()
+		os.Exit(0)
+	case "named-file":
+		f := execx.InheritedFile("out")
+		if f == nil {
+			os.Exit(2)
+		}
+		f.WriteString("hello")
+		os.Exit(0)
+	case "reexec":
+		err := syscall.Exec("/bin/sh", []string{"sh", "-c", os.Getenv("EXECX_REEXEC")}, os.Environ())
+		os.Stderr.WriteString(err.Error())
+		os.Exit(2)
+	case "nap":
+		time.Sleep(2 * time.Second)
+		os.Exit(0)
+	case "stderr-flood":
+		os.Stderr.WriteString("begin")
+		os.Stderr.Write(bytes.Repeat([]byte("x"), 100000))
+		os.Stderr.WriteString("end")
+		os.Exit(1)
+	case "balloon":
+		b := make([]byte, 64<<20)
+		for i := range b {
+			b[i] = 1
+		}
+		time.Sleep(300 * time.Millisecond)
+		os.Stdout.Write(b[:1])
+		os.Exit(1)
+	case "home":
+		dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "tool")
+		os.MkdirAll(dir, 0755)
+		ioutil.WriteFile(filepath.Join(dir, "config.toml"), []byte("x = 1\n"), 0644)
+		fmt.Print(os.Getenv("HOME"))
+		os.Exit(1)
+	case "progress":
+		os.Stderr.WriteString("downloading  10%\rdownloading  50%\rdownloading  75%")
+		os.Exit(1)
 	}
 	os.Exit(m.Run())
 }
@@ -48,7 +229,10 @@ func TestCmdline(t *testing.T) {
 	}
 }
 
-var ignoreExitError = cmpopts.IgnoreFields(execx.ExitError{}, "ExitError")
+var ignoreExitError = cmp.Options{
+	cmpopts.IgnoreFields(execx.ExitError{}, "ExitError"),
+	cmpopts.IgnoreUnexported(execx.ExitError{}),
+}
 
 const timeout = 100 * time.Millisecond
 
@@ -142,6 +326,14 @@ func checkExitError(t *testing.T, err error, cmd *exec.Cmd, want *execx.ExitErro
 		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
 	}
 
+	want.PID = cmd.ProcessState.Pid()
+	want.PPID = os.Getpid()
+	want.PGID = ee.PGID
+	resolved, rerr := filepath.EvalSymlinks(cmd.Path)
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	want.ResolvedPath = resolved
 	if diff := cmp.Diff(ee, want, ignoreExitError); diff != "" {
 		t.Fatalf(diff)
 	}
@@ -151,6 +343,9 @@ func TestExitError(t *testing.T) {
 	t.Run("ErrorMethod", testExitErrorErrorMethod)
 	t.Run("Print", testExitErrorPrint)
 	t.Run("Unwrap", testExitErrorUnwrap)
+	t.Run("Fields", testExitErrorFields)
+	t.Run("JSON", testExitErrorJSON)
+	t.Run("Symlink", testExitErrorSymlink)
 }
 
 func testExitErrorErrorMethod(t *testing.T) {
@@ -217,6 +412,83 @@ func testExitErrorUnwrap(t *testing.T) {
 	}
 }
 
+func testExitErrorFields(t *testing.T) {
+	fields := execx.Wrap(execSelf()).(*execx.ExitError).Fields()
+	if got := fields["exit_code"]; got != 1 {
+		t.Errorf("exit_code = %v, want 1", got)
+	}
+	if got := fields["stderr"]; got != "whoops" {
+		t.Errorf("stderr = %v, want %q", got, "whoops")
+	}
+}
+
+func testExitErrorJSON(t *testing.T) {
+	err := execx.Wrap(execSelf())
+	err.(*execx.ExitError).ChildEnv["EXECX_TOKEN"] = "hunter2"
+	b, jerr := json.Marshal(err)
+	if jerr != nil {
+		t.Fatal(jerr)
+	}
+	var got struct {
+		ExitCode int               `json:"exit_code"`
+		Stderr   string            `json:"stderr"`
+		Env      map[string]string `json:"env"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ExitCode != 1 || got.Stderr != "whoops" {
+		t.Errorf("got exit code %d, stderr %q", got.ExitCode, got.Stderr)
+	}
+	if got.Env["EXECX_TOKEN"] != execx.Redacted {
+		t.Errorf("sensitive variable not redacted")
+	}
+}
+
+func testExitErrorSymlink(t *testing.T) {
+	exe, err := filepath.EvalSymlinks(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("Direct", func(t *testing.T) {
+		ee := execx.Wrap(execSelf()).(*execx.ExitError)
+		if ee.ResolvedPath == "" {
+			t.Fatalf("ResolvedPath not set")
+		}
+		if ee.Symlinked() {
+			t.Errorf("Symlinked() = true for %q → %q", ee.Path, ee.ResolvedPath)
+		}
+	})
+	t.Run("Shim", func(t *testing.T) {
+		shim := filepath.Join(t.TempDir(), "shim")
+		if err := os.Symlink(exe, shim); err != nil {
+			t.Skip(err)
+		}
+		cmd := exec.Command(shim)
+		cmd.Env = append(os.Environ(), "EXECX_TEST=on")
+		ee := execx.Wrap(cmd.Run(), cmd).(*execx.ExitError)
+		if ee.Path != shim {
+			t.Errorf("Path = %q, want %q", ee.Path, shim)
+		}
+		if ee.ResolvedPath != exe {
+			t.Errorf("ResolvedPath = %q, want %q", ee.ResolvedPath, exe)
+		}
+		if !ee.Symlinked() {
+			t.Errorf("Symlinked() = false")
+		}
+		if got := ee.Fields()["resolved_path"]; got != exe {
+			t.Errorf("resolved_path = %v, want %q", got, exe)
+		}
+		if got := fmt.Sprintf("%+v", ee); !strings.Contains(got, "resolved path: "+exe) {
+			t.Errorf("%%+v doesn't contain resolved path")
+		}
+	})
+}
+
 func execSelf() (error, *exec.Cmd) {
 	parentEnv := env.Variables()
 	childEnv := env.Merge(parentEnv, env.Map{"EXECX_TEST": "on"})
@@ -231,6 +503,60 @@ func execSelf() (error, *exec.Cmd) {
 	return err, self
 }
 
+func TestWrapMinimal(t *testing.T) {
+	err, self := execSelf()
+	ee, ok := execx.WrapMinimal(err, self).(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	if ee.ParentEnv != nil || ee.ChildEnv != nil {
+		t.Fatalf("WrapMinimal captured environment")
+	}
+	ee.CaptureEnv()
+	if ee.ChildEnv["EXECX_TEST"] != "on" {
+		t.Fatalf("CaptureEnv didn't capture child environment")
+	}
+}
+
+func BenchmarkWrap(b *testing.B) {
+	benchmarkWrap(b, execx.Wrap)
+}
+
+func BenchmarkWrapMinimal(b *testing.B) {
+	benchmarkWrap(b, execx.WrapMinimal)
+}
+
+func benchmarkWrap(b *testing.B, wrap func(error, *exec.Cmd) error) {
+	err, self := execSelf()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wrap(err, self)
+	}
+}
+
+// BenchmarkSpawn measures the latency of starting a process. See also
+// BenchmarkRun in package broker.
+func BenchmarkSpawn(b *testing.B) {
+	var total time.Duration
+	for i := 0; i < b.N; i++ {
+		res, err := execx.Run(context.Background(), selfCmd("echo"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		total += res.Timeline.SpawnLatency()
+	}
+	b.ReportMetric(float64(total.Microseconds())/float64(b.N), "spawn-µs/op")
+}
+
+// selfCmd returns a command which runs the test binary in the specified
+// mode. See TestMain.
+func selfCmd(mode string) *exec.Cmd {
+	self := exec.Command(os.Args[0])
+	self.Env = append(os.Environ(), "EXECX_TEST="+mode)
+	return self
+}
+
 func mustGetwd(t *testing.T) string {
 	wd, err := os.Getwd()
 	if err != nil {
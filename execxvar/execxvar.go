@@ -0,0 +1,48 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package execxvar publishes the counters of package execx using package
+// expvar, as a map named "execx", such that dashboards which scrape
+// /debug/vars pick up subprocess activity. It is imported for its side
+// effects:
+//
+//	import _ "acln.ro/execx/execxvar"
+//
+// As with package expvar itself, importing it registers the /debug/vars
+// handler with http.DefaultServeMux. The map holds the following counters,
+// as per execx.Stats:
+//
+//	started       commands started by Start
+//	running       commands started by Start which have not exited
+//	failed        commands which completed with an error
+//	cpu_seconds   user and system CPU time of the commands which exited
+//	tool_hits     resolutions and versions served by a ToolCache
+//	tool_misses   resolutions and versions a ToolCache had not cached
+package execxvar
+
+import (
+	"expvar"
+
+	"acln.ro/execx"
+)
+
+func init() {
+	m := expvar.NewMap("execx")
+	m.Set("started", expvar.Func(func() interface{} { return execx.ReadStats().Started }))
+	m.Set("running", expvar.Func(func() interface{} { return execx.ReadStats().Running }))
+	m.Set("failed", expvar.Func(func() interface{} { return execx.ReadStats().Failed }))
+	m.Set("cpu_seconds", expvar.Func(func() interface{} { return execx.ReadStats().CPU.Seconds() }))
+	m.Set("tool_hits", expvar.Func(func() interface{} { return execx.ReadStats().ToolHits }))
+	m.Set("tool_misses", expvar.Func(func() interface{} { return execx.ReadStats().ToolMisses }))
+}
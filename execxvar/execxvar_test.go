@@ -0,0 +1,56 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execxvar_test
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"os/exec"
+	"testing"
+
+	"acln.ro/execx"
+	_ "acln.ro/execx/execxvar"
+)
+
+type execxVars struct {
+	Started int64 `json:"started"`
+	Running int64 `json:"running"`
+	Failed  int64 `json:"failed"`
+}
+
+func readExecxVars(t *testing.T) execxVars {
+	v := expvar.Get("execx")
+	if v == nil {
+		t.Fatal("execx not published")
+	}
+	var vars execxVars
+	if err := json.Unmarshal([]byte(v.String()), &vars); err != nil {
+		t.Fatal(err)
+	}
+	return vars
+}
+
+func TestPublished(t *testing.T) {
+	before := readExecxVars(t)
+	execx.Run(context.Background(), exec.Command("false"))
+	after := readExecxVars(t)
+	if after.Started-before.Started != 1 {
+		t.Errorf("started: got %d more, want 1", after.Started-before.Started)
+	}
+	if after.Failed-before.Failed != 1 {
+		t.Errorf("failed: got %d more, want 1", after.Failed-before.Failed)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+// AllExitErrors returns the *ExitError values in the tree of errors
+// rooted at err, in the order errors.As visits them: err itself, followed
+// by the errors it wraps, depth first. Errors which wrap several errors,
+// such as those returned by errors.Join, are traversed through their
+// Unwrap() []error method, such that aggregation layers which run many
+// commands can still extract the details of each failure. An *ExitError
+// reachable through multiple paths is returned once.
+func AllExitErrors(err error) []*ExitError {
+	var all []*ExitError
+	walkExitErrors(err, func(ee *ExitError) bool {
+		for _, seen := range all {
+			if seen == ee {
+				return true
+			}
+		}
+		all = append(all, ee)
+		return true
+	})
+	return all
+}
+
+// FirstExitError returns the first *ExitError in the tree of errors rooted
+// at err, in the order of AllExitErrors, or nil if there is none.
+func FirstExitError(err error) *ExitError {
+	var first *ExitError
+	walkExitErrors(err, func(ee *ExitError) bool {
+		first = ee
+		return false
+	})
+	return first
+}
+
+// walkExitErrors calls fn for each *ExitError in the tree rooted at err,
+// until fn returns false. It reports whether the walk should continue.
+func walkExitErrors(err error, fn func(*ExitError) bool) bool {
+	for err != nil {
+		if ee, ok := err.(*ExitError); ok {
+			return fn(ee)
+		}
+		switch u := err.(type) {
+		case interface{ Unwrap() error }:
+			err = u.Unwrap()
+		case interface{ Unwrap() []error }:
+			for _, err := range u.Unwrap() {
+				if !walkExitErrors(err, fn) {
+					return false
+				}
+			}
+			return true
+		default:
+			return true
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+// joinedError is a minimal errors.Join, which requires Go 1.20.
+type joinedError []error
+
+func (e joinedError) Error() string   { return fmt.Sprint([]error(e)) }
+func (e joinedError) Unwrap() []error { return e }
+
+func TestAllExitErrors(t *testing.T) {
+	_, err1 := execx.Run(context.Background(), selfCmd("on"))
+	_, err2 := execx.Run(context.Background(), selfCmd("on"))
+	ee1, ok1 := err1.(*execx.ExitError)
+	ee2, ok2 := err2.(*execx.ExitError)
+	if !ok1 || !ok2 {
+		t.Fatalf("got %v, %v, want *ExitError", err1, err2)
+	}
+	err := fmt.Errorf("build: %w", joinedError{
+		errors.New("unrelated"),
+		fmt.Errorf("step 1: %w", err1),
+		joinedError{err2, err1},
+	})
+
+	all := execx.AllExitErrors(err)
+	if len(all) != 2 || all[0] != ee1 || all[1] != ee2 {
+		t.Errorf("AllExitErrors = %v, want [%v %v]", all, ee1, ee2)
+	}
+	if got := execx.FirstExitError(err); got != ee1 {
+		t.Errorf("FirstExitError = %v, want %v", got, ee1)
+	}
+	if got := execx.AllExitErrors(errors.New("plain")); got != nil {
+		t.Errorf("AllExitErrors(plain) = %v, want nil", got)
+	}
+	if got := execx.FirstExitError(nil); got != nil {
+		t.Errorf("FirstExitError(nil) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultSummaryWidth is the width used by Summary if the width of the
+// terminal is not known.
+const defaultSummaryWidth = 80
+
+// Summary returns a single line describing e, suitable for status lines
+// and shell prompts, such as
+//
+//	go: exit 1 after 2.31s: main.go:3:8: no required module provides package foo
+//
+// The line holds the base name of the command, its exit code, or the
+// signal which terminated it, its duration, if known, and the first
+// non-empty line of its standard error output, if any. Unlike the output
+// of "%v", it never spans multiple lines. The line is truncated to the
+// width of the terminal, as per the COLUMNS environment variable, or to 80
+// columns if COLUMNS is not set. See SummaryWidth.
+func (e *ExitError) Summary() string {
+	width := defaultSummaryWidth
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		width = n
+	}
+	return e.SummaryWidth(width)
+}
+
+// SummaryWidth is like Summary, but truncates the line to at most width
+// characters, or does not truncate it if width is not positive. Truncated
+// lines end in an ellipsis.
+func (e *ExitError) SummaryWidth(width int) string {
+	var sb strings.Builder
+	sb.WriteString(filepath.Base(e.Path))
+	sb.WriteString(": ")
+	if code := e.ExitCode(); code >= 0 || !e.hasState() {
+		sb.WriteString("exit ")
+		sb.WriteString(strconv.Itoa(code))
+	} else {
+		sb.WriteString(e.Error())
+	}
+	if d := e.duration(); d > 0 {
+		sb.WriteString(" after ")
+		sb.WriteString(roundDuration(d).String())
+	}
+	if line := firstLine(e.stderr()); line != "" {
+		sb.WriteString(": ")
+		sb.WriteString(line)
+	}
+	return truncateLine(sb.String(), width)
+}
+
+// duration returns the time the process ran for, or zero if not known.
+func (e *ExitError) duration() time.Duration {
+	if e.Result == nil {
+		return 0
+	}
+	t := e.Result.Timeline
+	start := t.Running
+	if start.IsZero() {
+		start = t.Start
+	}
+	if start.IsZero() || t.Exited.IsZero() {
+		return 0
+	}
+	return t.Exited.Sub(start)
+}
+
+// stderr returns the captured standard error output of the process.
+func (e *ExitError) stderr() []byte {
+	if e.ExitError != nil && len(e.ExitError.Stderr) > 0 {
+		return e.ExitError.Stderr
+	}
+	if e.Result != nil {
+		return e.Result.Stderr
+	}
+	return nil
+}
+
+// roundDuration rounds d to three significant digits, or to the
+// millisecond, if it is shorter than a second.
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond)
+	case d < time.Minute:
+		return d.Round(10 * time.Millisecond)
+	default:
+		return d.Round(time.Second)
+	}
+}
+
+// firstLine returns the first line of b which is not blank, with control
+// characters replaced by spaces, and surrounding space trimmed.
+func firstLine(b []byte) string {
+	for len(b) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, b = b[:i], b[i+1:]
+		} else {
+			line, b = b, nil
+		}
+		s := strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) {
+				return ' '
+			}
+			return r
+		}, string(line))
+		if s = strings.TrimSpace(s); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// truncateLine truncates s to at most width characters, replacing the
+// tail by an ellipsis, if needed.
+func truncateLine(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimRightFunc(string(runes[:width-1]), unicode.IsSpace) + "…"
+}
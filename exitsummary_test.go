@@ -0,0 +1,59 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"acln.ro/execx"
+)
+
+func TestExitErrorSummary(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	got := ee.SummaryWidth(0)
+	want := regexp.MustCompile(`^execx\.test(\.exe)?: exit 1 after [0-9.]+m?s: whoops$`)
+	if !want.MatchString(got) {
+		t.Errorf("got %q, want match for %v", got, want)
+	}
+
+	t.Setenv("COLUMNS", "20")
+	got = ee.Summary()
+	if n := utf8.RuneCountInString(got); n > 20 || !strings.HasSuffix(got, "…") {
+		t.Errorf("got %q (%d characters), want at most 20 characters, ending in an ellipsis", got, n)
+	}
+}
+
+func TestExitErrorSummaryFirstLine(t *testing.T) {
+	cmd := exec.Command("sh", "-c", `printf '\n  \n\tfirst\tline \nsecond\n' >&2; exit 3`)
+	_, err := execx.Run(context.Background(), cmd)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Skipf("cannot run sh: %v", err)
+	}
+	got := ee.SummaryWidth(0)
+	if !strings.HasPrefix(got, "sh: exit 3 after ") || !strings.HasSuffix(got, ": first line") {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// FailIf treats a run which would otherwise succeed as a failure if re
+// matches its captured standard error or standard output, for tools which
+// report errors on their output, but exit with a zero status. Only output
+// which is captured, as described by Start, is considered.
+//
+// Such a run produces an *ExitError whose Reason is ReasonOutputMatched,
+// and which carries the line of output which matched, as a detail named
+// "failure_match".
+func FailIf(re *regexp.Regexp) Option {
+	return FailIfFunc(func(stdout, stderr []byte) (string, bool) {
+		for _, out := range [][]byte{stderr, stdout} {
+			if loc := re.FindIndex(out); loc != nil {
+				return string(lineAround(out, loc[0], loc[1])), true
+			}
+		}
+		return "", false
+	})
+}
+
+// FailIfFunc is like FailIf, but uses an arbitrary predicate over the
+// captured output. If the predicate reports a failure, it also returns
+// the output which caused the failure.
+func FailIfFunc(pred func(stdout, stderr []byte) (matched string, fail bool)) Option {
+	return func(cfg *config) {
+		cfg.failIf = append(cfg.failIf, pred)
+	}
+}
+
+// matchFailure reports whether the output matches any failure condition
+// in cfg, and returns the matching output.
+func (cfg *config) matchFailure(stdout, stderr []byte) (string, bool) {
+	for _, pred := range cfg.failIf {
+		if matched, fail := pred(stdout, stderr); fail {
+			return matched, true
+		}
+	}
+	return "", false
+}
+
+// lineAround returns the lines of b which contain b[start:end].
+func lineAround(b []byte, start, end int) []byte {
+	start = bytes.LastIndexByte(b[:start], '\n') + 1
+	if i := bytes.IndexByte(b[end:], '\n'); i >= 0 {
+		end += i
+	} else {
+		end = len(b)
+	}
+	return bytes.TrimSuffix(b[start:end], []byte("\r"))
+}
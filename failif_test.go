@@ -0,0 +1,73 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestFailIf(t *testing.T) {
+	t.Run("Match", testFailIfMatch)
+	t.Run("NoMatch", testFailIfNoMatch)
+	t.Run("Func", testFailIfFunc)
+}
+
+func testFailIfMatch(t *testing.T) {
+	self := selfCmd("echo")
+	self.Stdin = strings.NewReader("ok\nERROR: disk full\nok\n")
+	res, err := execx.Run(context.Background(), self, execx.FailIf(regexp.MustCompile(`ERROR:`)))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Reason != execx.ReasonOutputMatched {
+		t.Errorf("got reason %q, want %q", ee.Reason, execx.ReasonOutputMatched)
+	}
+	if got := ee.Fields()["failure_match"]; got != "ERROR: disk full" {
+		t.Errorf("got failure_match %q, want %q", got, "ERROR: disk full")
+	}
+	if ee.Result != res || res.ExitCode != 0 {
+		t.Errorf("got result %+v, want the run's result with exit code 0", ee.Result)
+	}
+}
+
+func testFailIfNoMatch(t *testing.T) {
+	self := selfCmd("echo")
+	self.Stdin = strings.NewReader("all good")
+	_, err := execx.Run(context.Background(), self, execx.FailIf(regexp.MustCompile(`ERROR:`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testFailIfFunc(t *testing.T) {
+	pred := func(stdout, stderr []byte) (string, bool) {
+		return "echoed", bytes.Equal(stderr, []byte("echoed"))
+	}
+	_, err := execx.Run(context.Background(), selfCmd("echo"), execx.FailIfFunc(pred))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if got := ee.Fields()["failure_match"]; got != "echoed" {
+		t.Errorf("got failure_match %q, want %q", got, "echoed")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// WithStdoutWriters copies the standard output of the command to each of
+// the specified writers, in addition to cmd.Stdout, or to the capture
+// buffer if cmd.Stdout is nil. Errors are isolated: a writer which fails
+// is not written to again, but output continues to flow to the other
+// writers, and the command is unaffected. Writers which panic fail with
+// an *InternalError. Such errors are recorded in
+// Result.WriterErrors, and as a detail named "writer_errors" in errors
+// produced by the command.
+//
+// Writers which are also passed to WithStderrWriters are written to from
+// different goroutines, and must be safe for concurrent use.
+func WithStdoutWriters(ws ...io.Writer) Option {
+	return func(cfg *config) {
+		cfg.stdoutWriters = append(cfg.stdoutWriters, ws...)
+	}
+}
+
+// WithStderrWriters is like WithStdoutWriters, but for standard error.
+func WithStderrWriters(ws ...io.Writer) Option {
+	return func(cfg *config) {
+		cfg.stderrWriters = append(cfg.stderrWriters, ws...)
+	}
+}
+
+// fanout writes to multiple writers, isolating their errors.
+type fanout struct {
+	name string
+	ws   []io.Writer
+	ie   *internalErrors // reports panics in writers
+
+	mu   sync.Mutex // protects errs
+	errs []error    // by writer
+}
+
+func newFanout(name string, ws []io.Writer, ie *internalErrors) *fanout {
+	return &fanout{name: name, ws: ws, ie: ie, errs: make([]error, len(ws))}
+}
+
+// Write writes p to all writers which have not failed. It never fails.
+func (f *fanout) Write(p []byte) (int, error) {
+	for i, w := range f.ws {
+		if f.failed(i) {
+			continue
+		}
+		if err := f.write(i, w, p); err != nil {
+			f.mu.Lock()
+			f.errs[i] = err
+			f.mu.Unlock()
+		}
+	}
+	return len(p), nil
+}
+
+// write writes p to w, the writer at index i, recovering from panics.
+func (f *fanout) write(i int, w io.Writer, p []byte) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = f.ie.report(fmt.Sprintf("%s writer %d", f.name, i), v)
+		}
+	}()
+	n, err := w.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
+
+func (f *fanout) failed(i int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.errs[i] != nil
+}
+
+// errors returns the errors encountered by the writers.
+func (f *fanout) errors() []error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var errs []error
+	for i, err := range f.errs {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s writer %d: %w", f.name, i, err))
+		}
+	}
+	return errs
+}
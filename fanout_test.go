@@ -0,0 +1,75 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestWithWriters(t *testing.T) {
+	t.Run("FanOut", testWithWritersFanOut)
+	t.Run("Failure", testWithWritersFailure)
+}
+
+func testWithWritersFanOut(t *testing.T) {
+	self := selfCmd("echo")
+	self.Stdin = strings.NewReader("hello")
+	out1, out2, errw := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	res, err := execx.Run(context.Background(), self,
+		execx.WithStdoutWriters(out1, failingWriter{}, out2),
+		execx.WithStderrWriters(errw),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "hello" {
+		t.Errorf("got captured stdout %q, want %q", res.Stdout, "hello")
+	}
+	if out1.String() != "hello" || out2.String() != "hello" {
+		t.Errorf("got stdout writers %q and %q, want %q", out1, out2, "hello")
+	}
+	if errw.String() != "echoed" {
+		t.Errorf("got stderr writer %q, want %q", errw, "echoed")
+	}
+	if len(res.WriterErrors) != 1 || !strings.Contains(res.WriterErrors[0].Error(), "stdout writer 1: disk full") {
+		t.Errorf("got writer errors %v", res.WriterErrors)
+	}
+}
+
+func testWithWritersFailure(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"), execx.WithStderrWriters(failingWriter{}))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if string(ee.Stderr) != "whoops" {
+		t.Errorf("got stderr %q, want %q", ee.Stderr, "whoops")
+	}
+	if _, ok := ee.Fields()["writer_errors"]; !ok {
+		t.Error("writer errors not recorded")
+	}
+}
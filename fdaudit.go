@@ -0,0 +1,123 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// An FDAudit is a policy for file descriptors which would leak into a
+// child process.
+type FDAudit int
+
+// File descriptor audit policies.
+const (
+	// FDAuditReport records leaked file descriptors as a detail named
+	// "leaked_fds" in errors produced by the command.
+	FDAuditReport FDAudit = iota + 1
+
+	// FDAuditFail prevents the command from starting if file
+	// descriptors would leak into it: Start returns a *StartError
+	// which wraps an *FDLeakError.
+	FDAuditFail
+)
+
+// WithFDAudit checks, before the command starts, whether file descriptors
+// of the current process other than standard input, standard output and
+// standard error lack the close-on-exec flag, and would therefore leak
+// into the child process, and handles them as per policy. Leaked file
+// descriptors keep sockets bound and files locked for as long as the child
+// lives, which often surfaces as "address already in use" errors, or as
+// locks which are mysteriously held. File descriptors passed to the
+// command explicitly, in cmd.ExtraFiles, are not reported.
+//
+// File descriptors created by the Go runtime and standard library have the
+// close-on-exec flag set. Leaks usually originate in C libraries, in file
+// descriptors inherited by the current process, or in raw system calls.
+//
+// WithFDAudit is supported on Linux only, and does nothing on other
+// platforms.
+func WithFDAudit(policy FDAudit) Option {
+	return func(cfg *config) {
+		cfg.fdAudit = policy
+	}
+}
+
+// A LeakedFD is a file descriptor which lacks the close-on-exec flag.
+type LeakedFD struct {
+	// FD is the file descriptor.
+	FD int
+
+	// Target is what the file descriptor refers to, such as the path
+	// of a file, or "socket:[12345]".
+	Target string
+}
+
+func (fd LeakedFD) String() string {
+	return fmt.Sprintf("%d -> %s", fd.FD, fd.Target)
+}
+
+// FDLeakError records file descriptors which would leak into a child
+// process.
+type FDLeakError struct {
+	FDs []LeakedFD
+}
+
+func (e *FDLeakError) Error() string {
+	return fmt.Sprintf("execx: file descriptors without close-on-exec would leak into the child: %s", leakedList(e.FDs))
+}
+
+// leakedList formats fds as a comma separated list.
+func leakedList(fds []LeakedFD) string {
+	s := make([]string, 0, len(fds))
+	for _, fd := range fds {
+		s = append(s, fd.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+// auditFDs checks for file descriptors which would leak into h.cmd.
+func (h *Handle) auditFDs() error {
+	fds, err := leakedFDs()
+	if err != nil || len(fds) == 0 {
+		return nil
+	}
+	passed := make(map[int]bool)
+	for _, f := range h.cmd.ExtraFiles {
+		if f != nil {
+			passed[int(f.Fd())] = true
+		}
+	}
+	leaked := fds[:0]
+	for _, fd := range fds {
+		if !passed[fd.FD] {
+			leaked = append(leaked, fd)
+		}
+	}
+	if len(leaked) == 0 {
+		return nil
+	}
+	if h.cfg.fdAudit == FDAuditFail {
+		return wrapStart(&FDLeakError{FDs: leaked}, h.cmd, h.cfg.collectors)
+	}
+	desc := leakedList(leaked)
+	h.cfg.collectors = append(h.cfg.collectors, CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "leaked_fds", desc
+	}))
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// leakedFDs returns the file descriptors of the current process, other
+// than 0, 1 and 2, which lack the close-on-exec flag, as reported by
+// /proc/self/fdinfo.
+func leakedFDs() ([]LeakedFD, error) {
+	d, err := os.Open("/proc/self/fdinfo")
+	if err != nil {
+		return nil, err
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return nil, err
+	}
+	var fds []LeakedFD
+	for _, name := range names {
+		fd, err := strconv.Atoi(name)
+		if err != nil || fd <= 2 {
+			continue
+		}
+		flags, err := fdFlags(fd)
+		if err != nil || flags&syscall.O_CLOEXEC != 0 {
+			// The file descriptor was closed in the meantime, or
+			// it does not leak.
+			continue
+		}
+		target, err := fdTarget(fd)
+		if err != nil {
+			continue
+		}
+		fds = append(fds, LeakedFD{FD: fd, Target: target})
+	}
+	sort.Slice(fds, func(i, j int) bool { return fds[i].FD < fds[j].FD })
+	return fds, nil
+}
+
+// fdFlags returns the flags of the file descriptor fd.
+func fdFlags(fd int) (int, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/self/fdinfo/%d", fd))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v := strings.TrimPrefix(sc.Text(), "flags:"); v != sc.Text() {
+			flags, err := strconv.ParseInt(strings.TrimSpace(v), 8, 64)
+			return int(flags), err
+		}
+	}
+	return 0, fmt.Errorf("execx: no flags for file descriptor %d", fd)
+}
+
+// fdTarget returns what the file descriptor fd refers to.
+func fdTarget(fd int) (string, error) {
+	return os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithFDAudit(t *testing.T) {
+	path := filepath.Join(tempDir(t), "leaky")
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_CREAT, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := os.NewFile(uintptr(fd), path)
+	defer f.Close()
+
+	t.Run("Report", func(t *testing.T) {
+		_, err := execx.Run(context.Background(), selfCmd("on"), execx.WithFDAudit(execx.FDAuditReport))
+		var ee *execx.ExitError
+		if !errors.As(err, &ee) {
+			t.Fatalf("got %v, want *ExitError", err)
+		}
+		v, ok := ee.Detail("leaked_fds")
+		if !ok || !strings.Contains(v.(string), path) {
+			t.Errorf("got leaked_fds detail %v, want it to mention %s", v, path)
+		}
+	})
+	t.Run("Fail", func(t *testing.T) {
+		_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithFDAudit(execx.FDAuditFail))
+		var le *execx.FDLeakError
+		if !errors.As(err, &le) {
+			t.Fatalf("got %v, want *FDLeakError", err)
+		}
+		found := false
+		for _, leaked := range le.FDs {
+			if leaked.FD == fd && leaked.Target == path {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("fd %d not reported: %v", fd, le.FDs)
+		}
+	})
+	t.Run("ExtraFiles", func(t *testing.T) {
+		cmd := selfCmd("echo")
+		cmd.ExtraFiles = []*os.File{f}
+		_, err := execx.Run(context.Background(), cmd, execx.WithFDAudit(execx.FDAuditFail))
+		var le *execx.FDLeakError
+		if errors.As(err, &le) {
+			for _, leaked := range le.FDs {
+				if leaked.FD == fd {
+					t.Errorf("fd %d passed in ExtraFiles reported as leaked", fd)
+				}
+			}
+		}
+	})
+}
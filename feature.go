@@ -0,0 +1,182 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+// A Feature describes how to find out whether a tool supports a feature,
+// such as an option which only recent versions of the tool support, by
+// running a cheap probe command.
+type Feature struct {
+	// Args holds the arguments of the probe command, excluding the
+	// name of the tool, such as "--help".
+	Args []string
+
+	// Want is a string whose presence in the standard output or the
+	// standard error of the probe command means the feature is
+	// supported, such as "--zstd". If Want is empty, the feature is
+	// supported if the probe command succeeds.
+	Want string
+
+	// ExitCodes holds exit codes other than zero with which the probe
+	// command may exit if Want is set, such as 129 for git, which exits
+	// with that code when asked for help.
+	ExitCodes []int
+}
+
+// FeatureError records the failure of a probe command run by Supports.
+type FeatureError struct {
+	// Tool and Feature identify the probe.
+	Tool    string
+	Feature string
+
+	// Err is the error the probe command failed with, such as an
+	// *ExitError or a *StartError.
+	Err error
+}
+
+func (e *FeatureError) Error() string {
+	return fmt.Sprintf("execx: probing %s for %s: %v", e.Tool, e.Feature, e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *FeatureError) Unwrap() error {
+	return e.Err
+}
+
+// featureKey identifies a feature of a tool.
+type featureKey struct {
+	tool    string
+	feature string
+}
+
+// featureProbe is the outcome of a probe, shared by concurrent callers.
+type featureProbe struct {
+	done      chan struct{} // closed when the probe completes
+	supported bool
+	err       error
+}
+
+var features = struct {
+	sync.Mutex
+	m     map[featureKey]Feature
+	cache map[featureKey]*featureProbe // by path of the tool
+}{
+	m: map[featureKey]Feature{
+		{"tar", "zstd"}:   {Args: []string{"--help"}, Want: "--zstd"},
+		{"git", "filter"}: {Args: []string{"clone", "-h"}, Want: "--filter", ExitCodes: []int{129}},
+	},
+	cache: make(map[featureKey]*featureProbe),
+}
+
+// RegisterFeature registers f as the way to probe tool for feature, for
+// use by Supports, replacing the probe previously registered for the
+// feature, if any, and forgetting its cached results. The features
+// registered by default are "zstd" for "tar" and "filter" for "git".
+// RegisterFeature is safe to call from multiple goroutines concurrently.
+func RegisterFeature(tool, feature string, f Feature) {
+	features.Lock()
+	defer features.Unlock()
+	features.m[featureKey{tool, feature}] = Feature{
+		Args:      copyStrings(f.Args),
+		Want:      f.Want,
+		ExitCodes: append([]int(nil), f.ExitCodes...),
+	}
+	for k := range features.cache {
+		if k.feature == feature {
+			delete(features.cache, k)
+		}
+	}
+}
+
+// Supports reports whether tool supports feature, by running the probe
+// command registered for the feature using RegisterFeature, using Run,
+// and thus the runner carried by ctx. Results are cached by the path tool
+// resolves to, such that the probe command runs once per program, even
+// when Supports is called concurrently.
+//
+// If the probe command cannot tell whether the feature is supported,
+// such as if the tool is not installed, or if it exits with an unexpected
+// exit code, Supports returns a *FeatureError, which wraps the error the
+// probe command failed with, and carries its context. Such errors are
+// cached too, except for the errors of the context.
+func Supports(ctx context.Context, tool, feature string) (bool, error) {
+	features.Lock()
+	f, ok := features.m[featureKey{tool, feature}]
+	features.Unlock()
+	if !ok {
+		return false, fmt.Errorf("execx: no probe registered for feature %s of %s", feature, tool)
+	}
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return false, &FeatureError{Tool: tool, Feature: feature, Err: err}
+	}
+	key := featureKey{path, feature}
+	features.Lock()
+	p, ok := features.cache[key]
+	if !ok {
+		p = &featureProbe{done: make(chan struct{})}
+		features.cache[key] = p
+	}
+	features.Unlock()
+	if !ok {
+		p.supported, p.err = probeFeature(ctx, tool, path, feature, f)
+		if p.err != nil && ctx.Err() != nil {
+			// Let the next caller try again.
+			features.Lock()
+			if features.cache[key] == p {
+				delete(features.cache, key)
+			}
+			features.Unlock()
+		}
+		close(p.done)
+	}
+	select {
+	case <-p.done:
+		return p.supported, p.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// probeFeature runs the probe command described by f.
+func probeFeature(ctx context.Context, tool, path, feature string, f Feature) (bool, error) {
+	cmd := exec.Command(path, f.Args...)
+	if f.Want == "" {
+		_, err := Run(ctx, cmd)
+		var ee *ExitError
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.As(err, &ee) && ctx.Err() == nil:
+			return false, nil
+		default:
+			return false, &FeatureError{Tool: tool, Feature: feature, Err: err}
+		}
+	}
+	res, err := Run(ctx, cmd, WithAllowedExitCodes(f.ExitCodes...))
+	if err != nil {
+		return false, &FeatureError{Tool: tool, Feature: feature, Err: err}
+	}
+	want := []byte(f.Want)
+	return bytes.Contains(res.Stdout, want) || bytes.Contains(res.Stderr, want), nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestSupports(t *testing.T) {
+	var runs int32
+	ctx := execx.WithRunner(context.Background(), execx.RunnerFunc(func(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+		atomic.AddInt32(&runs, 1)
+		return execx.Local.Run(ctx, cmd, opts...)
+	}))
+	execx.RegisterFeature("sh", "test-help", execx.Feature{Args: []string{"-c", "echo usage: --fancy; exit 2"}, Want: "--fancy", ExitCodes: []int{2}})
+	execx.RegisterFeature("sh", "test-missing", execx.Feature{Args: []string{"-c", "echo usage: --plain"}, Want: "--fancy"})
+	execx.RegisterFeature("sh", "test-exit", execx.Feature{Args: []string{"-c", "exit 1"}})
+	execx.RegisterFeature("sh", "test-broken", execx.Feature{Args: []string{"-c", "echo oops >&2; exit 3"}, Want: "--fancy"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := execx.Supports(ctx, "sh", "test-help"); !ok || err != nil {
+				t.Errorf("test-help: got %v, %v, want true", ok, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if runs != 1 {
+		t.Errorf("probe ran %d times, want once", runs)
+	}
+	for _, feature := range []string{"test-missing", "test-exit"} {
+		if ok, err := execx.Supports(ctx, "sh", feature); ok || err != nil {
+			t.Errorf("%s: got %v, %v, want false", feature, ok, err)
+		}
+	}
+
+	_, err := execx.Supports(ctx, "sh", "test-broken")
+	var fe *execx.FeatureError
+	var ee *execx.ExitError
+	if !errors.As(err, &fe) || !errors.As(err, &ee) || string(ee.Stderr) != "oops\n" {
+		t.Fatalf("got %v, want *FeatureError wrapping *ExitError", err)
+	}
+	if _, err2 := execx.Supports(ctx, "sh", "test-broken"); err2 != err {
+		t.Errorf("error not cached: got %v", err2)
+	}
+	if runs != 4 {
+		t.Errorf("probes ran %d times, want 4", runs)
+	}
+
+	if _, err := execx.Supports(ctx, "execx-no-such-tool", "test-help"); err == nil {
+		t.Error("probed a feature which was not registered")
+	}
+}
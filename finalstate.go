@@ -0,0 +1,211 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"acln.ro/env"
+)
+
+// WithFinalState samples the working directory of the process while it
+// runs, along with the values of the environment variables named by keys,
+// such that the state in which a long-running process which changes its
+// working directory or its environment exited is known. The last sample,
+// taken shortly before the process exits, is recorded in Result.FinalState.
+// If it differs from the state the process was started in, it is also
+// recorded as a *FinalState detail named "final_state" in errors produced
+// by the command, and thus shown by %+v.
+//
+// Sampling is best-effort. The environment of a process, as reported by
+// the system, only reflects changes the process makes to its initial
+// environment in place, or the environment of the images it executes.
+// WithFinalState is supported on Linux only, using /proc, and does nothing
+// on other platforms.
+func WithFinalState(keys ...string) Option {
+	return func(cfg *config) {
+		cfg.finalState = true
+		cfg.finalStateKeys = append(cfg.finalStateKeys, keys...)
+	}
+}
+
+// FinalState describes the state of a process shortly before it exited,
+// as sampled by WithFinalState, along with the state it was started in.
+type FinalState struct {
+	// Dir is the working directory of the process.
+	Dir string
+
+	// Env holds the values of the variables requested, which were set.
+	Env map[string]string
+
+	// Sampled is the time at which the state was sampled.
+	Sampled time.Time
+
+	// LaunchDir and LaunchEnv describe the state the process was
+	// started in, as Dir and Env do.
+	LaunchDir string
+	LaunchEnv map[string]string
+}
+
+// Changed reports whether the state differs from the state the process
+// was started in.
+func (s *FinalState) Changed() bool {
+	return s.Dir != s.LaunchDir || len(s.envChanges()) > 0
+}
+
+// String describes the differences between the final state and the state
+// the process was started in, such as
+//
+//	dir /src -> /src/build; GOFLAGS: unset -> -mod=mod
+func (s *FinalState) String() string {
+	var parts []string
+	if s.Dir != s.LaunchDir {
+		parts = append(parts, fmt.Sprintf("dir %s -> %s", s.LaunchDir, s.Dir))
+	}
+	parts = append(parts, s.envChanges()...)
+	if len(parts) == 0 {
+		return "unchanged"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// envChanges describes the variables whose values changed, sorted by name.
+func (s *FinalState) envChanges() []string {
+	keys := make(map[string]bool)
+	for k := range s.Env {
+		keys[k] = true
+	}
+	for k := range s.LaunchEnv {
+		keys[k] = true
+	}
+	var changes []string
+	for k := range keys {
+		before, wasSet := s.LaunchEnv[k]
+		after, isSet := s.Env[k]
+		if wasSet == isSet && before == after {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", k, valueOrUnset(before, wasSet), valueOrUnset(after, isSet)))
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// valueOrUnset returns v if the variable is set, or "unset".
+func valueOrUnset(v string, set bool) string {
+	if !set {
+		return "unset"
+	}
+	return v
+}
+
+// stateSampler periodically samples the state of a process.
+type stateSampler struct {
+	launchDir string
+	launchEnv map[string]string
+
+	mu   sync.Mutex
+	last *FinalState
+}
+
+// sampleFinalState samples the state of the process started by cmd until
+// exited is closed, recording panics in ie. keys names the variables to
+// sample. sampleFinalState returns nil if the state of processes is not
+// available on this platform.
+func sampleFinalState(cmd *exec.Cmd, keys []string, exited <-chan struct{}, ie *internalErrors) *stateSampler {
+	if !finalStateSupported {
+		return nil
+	}
+	s := &stateSampler{launchDir: cmd.Dir}
+	if s.launchDir == "" {
+		s.launchDir, _ = os.Getwd()
+	} else if abs, err := filepath.Abs(s.launchDir); err == nil {
+		s.launchDir = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(s.launchDir); err == nil {
+		s.launchDir = resolved
+	}
+	launch := env.Variables()
+	if cmd.Env != nil {
+		launch = env.Parse(cmd.Env...)
+	}
+	s.launchEnv = selectEnv(launch, keys)
+	pid := cmd.Process.Pid
+	go func() {
+		defer ie.catch("sample final state")
+		t := time.NewTicker(procSampleInterval)
+		defer t.Stop()
+		for {
+			dir, environ, err := readProcState(pid)
+			select {
+			case <-exited:
+				// The process may have been reaped while it was
+				// being sampled, and the sample may be bogus.
+				return
+			default:
+			}
+			if err == nil {
+				st := &FinalState{
+					Dir:       dir,
+					Env:       selectEnv(env.Parse(environ...), keys),
+					Sampled:   time.Now(),
+					LaunchDir: s.launchDir,
+					LaunchEnv: s.launchEnv,
+				}
+				s.mu.Lock()
+				s.last = st
+				s.mu.Unlock()
+			}
+			select {
+			case <-t.C:
+			case <-exited:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// selectEnv returns the variables of m named by keys, which are set, with
+// the values of sensitive variables redacted, as per RedactEnv.
+func selectEnv(m env.Map, keys []string) map[string]string {
+	selected := make(map[string]string)
+	for _, k := range keys {
+		if v, ok := m[k]; ok {
+			if IsSensitive(k) {
+				v = Redacted
+			}
+			selected[k] = v
+		}
+	}
+	return selected
+}
+
+// result returns the last sample, or nil if there is none.
+func (s *stateSampler) result() *FinalState {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
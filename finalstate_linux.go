@@ -0,0 +1,44 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const finalStateSupported = true
+
+// readProcState reads the working directory and the environment of the
+// process with the specified pid from /proc.
+func readProcState(pid int) (dir string, environ []string, err error) {
+	proc := fmt.Sprintf("/proc/%d/", pid)
+	dir, err = os.Readlink(proc + "cwd")
+	if err != nil {
+		return "", nil, err
+	}
+	b, err := ioutil.ReadFile(proc + "environ")
+	if err != nil {
+		return "", nil, err
+	}
+	if len(b) == 0 {
+		// The process is exiting, or has an empty environment,
+		// which cannot be told apart.
+		return "", nil, errProcExiting
+	}
+	return dir, strings.Split(strings.TrimSuffix(string(b), "\x00"), "\x00"), nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithFinalState(t *testing.T) {
+	dir := tempDir(t)
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sh", "-c", "cd sub && exec env EXECX_STATE=changed EXECX_TOKEN=new sh -c 'sleep 0.5; exit 3'")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "EXECX_STATE=orig", "EXECX_TOKEN=old")
+	_, err = execx.Run(context.Background(), cmd, execx.WithFinalState("EXECX_STATE", "EXECX_TOKEN", "EXECX_UNSET"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	st := ee.Result.FinalState
+	if st == nil {
+		t.Fatal("final state not sampled")
+	}
+	if want := filepath.Join(dir, "sub"); st.Dir != want || st.LaunchDir != dir {
+		t.Errorf("got dir %s (launched in %s), want %s (launched in %s)", st.Dir, st.LaunchDir, want, dir)
+	}
+	if st.Env["EXECX_STATE"] != "changed" || st.LaunchEnv["EXECX_STATE"] != "orig" {
+		t.Errorf("got env %v (launched with %v)", st.Env, st.LaunchEnv)
+	}
+	if st.Env["EXECX_TOKEN"] != execx.Redacted {
+		t.Errorf("sensitive variable not redacted: %v", st.Env)
+	}
+	if _, ok := st.Env["EXECX_UNSET"]; ok {
+		t.Errorf("unset variable recorded: %v", st.Env)
+	}
+	if _, ok := ee.Detail("final_state"); !ok {
+		t.Fatal("final_state detail missing")
+	}
+	out := fmt.Sprintf("%+v", ee)
+	if !strings.Contains(out, "final_state: dir "+dir+" -> "+filepath.Join(dir, "sub")+"; EXECX_STATE: orig -> changed") {
+		t.Errorf("changes not shown by %%+v:\n%s", out)
+	}
+}
+
+func TestWithFinalStateUnchanged(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 0.3; exit 3")
+	_, err := execx.Run(context.Background(), cmd, execx.WithFinalState("HOME"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if st := ee.Result.FinalState; st == nil || st.Changed() {
+		t.Fatalf("got final state %v, want unchanged", st)
+	}
+	if _, ok := ee.Detail("final_state"); ok {
+		t.Errorf("final_state detail recorded for an unchanged state")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// FirstOfError records the failures of the alternatives tried by FirstOf.
+type FirstOfError struct {
+	// Cmdlines holds the command lines of the alternatives which were
+	// tried, in order, as per Cmdline.
+	Cmdlines []string
+
+	// Errs holds the error each alternative failed with, in order, such
+	// as an *ExitError, or a *StartError if the program was not found.
+	Errs []error
+
+	// Skipped is the number of alternatives which were not tried,
+	// because the context was done, in which case Err is the error of
+	// the context.
+	Skipped int
+	Err     error
+}
+
+func (e *FirstOfError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("execx: no alternative succeeded")
+	for i, err := range e.Errs {
+		fmt.Fprintf(&sb, "; %s: %v", e.Cmdlines[i], err)
+	}
+	if e.Skipped > 0 {
+		fmt.Fprintf(&sb, "; %d not tried: %v", e.Skipped, e.Err)
+	}
+	return sb.String()
+}
+
+// Unwrap returns e.Errs, followed by e.Err, if set, such that errors.Is,
+// errors.As and AllExitErrors can inspect the failure of each alternative.
+func (e *FirstOfError) Unwrap() []error {
+	if e.Err != nil {
+		return append(e.Errs[:len(e.Errs):len(e.Errs)], e.Err)
+	}
+	return e.Errs
+}
+
+// FirstOf runs cmds in order, using Run, and thus the runner carried by
+// ctx, until one succeeds, and returns its Result. It is useful for
+// commands which have portable alternatives, such as fd and find, or gtar
+// and tar: an alternative which is not installed fails to start, and the
+// next one is tried.
+//
+// Alternatives are tried sequentially, and their outputs are not reset
+// between attempts: if cmd.Stdout or cmd.Stderr are shared between
+// alternatives, they may hold the output of those which failed. Outputs
+// which were captured belong to the Result of the alternative which
+// succeeded only.
+//
+// If all alternatives fail, or if ctx is done before one succeeds, FirstOf
+// returns a *FirstOfError, which holds the error of each alternative which
+// was tried, along with a nil Result. If cmds is empty, FirstOf returns
+// an error.
+func FirstOf(ctx context.Context, cmds ...*exec.Cmd) (*Result, error) {
+	if len(cmds) == 0 {
+		return nil, errors.New("execx: FirstOf: no alternatives")
+	}
+	ferr := new(FirstOfError)
+	for i, cmd := range cmds {
+		if ctx.Err() != nil {
+			ferr.Skipped, ferr.Err = len(cmds)-i, ctx.Err()
+			break
+		}
+		cmdline := Cmdline(cmd)
+		res, err := Run(ctx, cmd)
+		if err == nil {
+			return res, nil
+		}
+		ferr.Cmdlines = append(ferr.Cmdlines, cmdline)
+		ferr.Errs = append(ferr.Errs, err)
+	}
+	return nil, ferr
+}
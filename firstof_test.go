@@ -0,0 +1,76 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestFirstOf(t *testing.T) {
+	echo := selfCmd("echo")
+	echo.Stdin = strings.NewReader("fallback")
+	res, err := execx.FirstOf(context.Background(),
+		exec.Command("execx-no-such-program"),
+		selfCmd("on"),
+		echo,
+		selfCmd("never"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "fallback" {
+		t.Errorf("got stdout %q, want %q", res.Stdout, "fallback")
+	}
+}
+
+func TestFirstOfAllFail(t *testing.T) {
+	_, err := execx.FirstOf(context.Background(),
+		exec.Command("execx-no-such-program"),
+		selfCmd("on"),
+	)
+	var ferr *execx.FirstOfError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("got %v, want *FirstOfError", err)
+	}
+	if len(ferr.Errs) != 2 || ferr.Skipped != 0 {
+		t.Fatalf("got %d errors, %d skipped", len(ferr.Errs), ferr.Skipped)
+	}
+	var se *execx.StartError
+	if !errors.As(ferr.Errs[0], &se) {
+		t.Errorf("got %v for missing program, want *StartError", ferr.Errs[0])
+	}
+	if ees := execx.AllExitErrors(err); len(ees) != 1 || string(ees[0].Stderr) != "whoops" {
+		t.Errorf("got exit errors %v", ees)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "execx-no-such-program") || !strings.Contains(msg, "whoops") {
+		t.Errorf("got %q", msg)
+	}
+}
+
+func TestFirstOfCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := execx.FirstOf(ctx, selfCmd("echo"), selfCmd("echo"))
+	var ferr *execx.FirstOfError
+	if !errors.As(err, &ferr) || ferr.Skipped != 2 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v", err)
+	}
+}
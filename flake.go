@@ -0,0 +1,255 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"os/exec"
+	"sort"
+	"sync"
+)
+
+// Defaults for FlakeDetector.
+const (
+	defaultFlakeWindow    = 20
+	defaultFlakeThreshold = 0.2
+	defaultFlakeMinRuns   = 5
+	defaultFlakeRetries   = 2
+)
+
+// A FlakeDetector is a Runner which finds flaky commands: commands whose
+// identical invocations, as identified by Fingerprint, alternate between
+// success and failure. It uses the runs recorded by a History to compute
+// flake rates, and quarantines the commands whose flake rate reaches the
+// threshold. Quarantined commands are retried if they fail.
+//
+// The flake rate of a command is the fraction of consecutive pairs of
+// its most recent runs whose outcomes differ. A command which always
+// fails, or always succeeds, is not flaky.
+//
+// Quarantine status is computed from the History each time a command is
+// run. A FlakeDetector is safe for concurrent use by multiple goroutines.
+type FlakeDetector struct {
+	// History provides the recorded runs. It must not be nil.
+	History *History
+
+	// Runner runs the commands. If Runner is nil, History is used,
+	// such that the runs are recorded.
+	Runner Runner
+
+	// Window is the number of most recent runs of a command which are
+	// considered. If Window is zero, 20 is used.
+	Window int
+
+	// Threshold is the flake rate at which a command is quarantined.
+	// If Threshold is zero, 0.2 is used.
+	Threshold float64
+
+	// MinRuns is the number of runs a command needs before it can be
+	// quarantined. If MinRuns is zero, 5 is used.
+	MinRuns int
+
+	// Retries is the number of times a quarantined command is re-run
+	// if it fails. If Retries is zero, 2 is used.
+	Retries int
+
+	mu     sync.Mutex
+	manual map[string]bool
+}
+
+// FlakeStats describes the recent runs of a command.
+type FlakeStats struct {
+	// Fingerprint is the fingerprint of the command.
+	Fingerprint string
+
+	// Args holds the arguments of the most recent run of the command.
+	Args []string
+
+	// Runs is the number of runs considered.
+	Runs int
+
+	// Failures is the number of runs which failed.
+	Failures int
+
+	// Flips is the number of times the outcome changed between
+	// consecutive runs.
+	Flips int
+
+	// Quarantined reports whether the command is quarantined.
+	Quarantined bool
+}
+
+// Rate returns the flake rate of the command: the fraction of consecutive
+// pairs of runs whose outcomes differ.
+func (s FlakeStats) Rate() float64 {
+	if s.Runs < 2 {
+		return 0
+	}
+	return float64(s.Flips) / float64(s.Runs-1)
+}
+
+// Run runs cmd, retrying it if it fails, and it is quarantined. If all
+// attempts fail, the error of the last attempt carries the statistics of
+// the command as a FlakeStats detail named "flake", and the timing of
+// all the attempts, as per TimingOf, as a Timing detail named "timing".
+func (fd *FlakeDetector) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	r := fd.Runner
+	if r == nil {
+		r = fd.History
+	}
+	stats, err := fd.Stats(ctx, Fingerprint(cmd))
+	if err != nil || !stats.Quarantined {
+		// If the statistics are not available, run the command as is.
+		return r.Run(ctx, cmd, opts...)
+	}
+	retries := fd.Retries
+	if retries == 0 {
+		retries = defaultFlakeRetries
+	}
+	var results []*Result
+	for attempt := 0; ; attempt++ {
+		next := Clone(cmd)
+		res, err := r.Run(ctx, cmd, opts...)
+		results = append(results, res)
+		if err == nil || ctx.Err() != nil {
+			return res, withTiming(err, results...)
+		}
+		if attempt >= retries {
+			return res, withTiming(WithDetail(err, "flake", stats), results...)
+		}
+		cmd = next
+	}
+}
+
+// Quarantine quarantines the command with the specified fingerprint,
+// regardless of its flake rate.
+func (fd *FlakeDetector) Quarantine(fingerprint string) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.manual == nil {
+		fd.manual = make(map[string]bool)
+	}
+	fd.manual[fingerprint] = true
+}
+
+// Release undoes the effect of Quarantine for the specified fingerprint.
+// Commands whose flake rate reaches the threshold remain quarantined.
+func (fd *FlakeDetector) Release(fingerprint string) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	delete(fd.manual, fingerprint)
+}
+
+// Stats returns the statistics of the command with the specified
+// fingerprint.
+func (fd *FlakeDetector) Stats(ctx context.Context, fingerprint string) (FlakeStats, error) {
+	outcomes, err := fd.History.outcomes(ctx, fingerprint)
+	if err != nil {
+		return FlakeStats{}, err
+	}
+	all := fd.stats(outcomes)
+	if len(all) == 0 {
+		return FlakeStats{Fingerprint: fingerprint, Quarantined: fd.isManual(fingerprint)}, nil
+	}
+	return all[0], nil
+}
+
+// Flaky returns the statistics of all recorded commands whose flake rate
+// is not zero, or which are quarantined, flakiest first.
+func (fd *FlakeDetector) Flaky(ctx context.Context) ([]FlakeStats, error) {
+	outcomes, err := fd.History.outcomes(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var flaky []FlakeStats
+	for _, s := range fd.stats(outcomes) {
+		if s.Flips > 0 || s.Quarantined {
+			flaky = append(flaky, s)
+		}
+	}
+	sort.SliceStable(flaky, func(i, j int) bool {
+		return flaky[i].Rate() > flaky[j].Rate()
+	})
+	return flaky, nil
+}
+
+// Quarantined returns the statistics of the quarantined commands,
+// flakiest first.
+func (fd *FlakeDetector) Quarantined(ctx context.Context) ([]FlakeStats, error) {
+	flaky, err := fd.Flaky(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var quarantined []FlakeStats
+	for _, s := range flaky {
+		if s.Quarantined {
+			quarantined = append(quarantined, s)
+		}
+	}
+	return quarantined, nil
+}
+
+// stats computes statistics from outcomes, as returned by
+// History.outcomes.
+func (fd *FlakeDetector) stats(outcomes []historyOutcome) []FlakeStats {
+	window := fd.Window
+	if window == 0 {
+		window = defaultFlakeWindow
+	}
+	var all []FlakeStats
+	var cur *FlakeStats
+	var prev bool
+	for _, o := range outcomes {
+		if cur == nil || o.fingerprint != cur.Fingerprint {
+			all = append(all, FlakeStats{Fingerprint: o.fingerprint, Args: o.args})
+			cur = &all[len(all)-1]
+		} else if cur.Runs >= window {
+			continue
+		} else if o.failed != prev {
+			cur.Flips++
+		}
+		cur.Runs++
+		if o.failed {
+			cur.Failures++
+		}
+		prev = o.failed
+	}
+	for i := range all {
+		all[i].Quarantined = fd.quarantined(all[i])
+	}
+	return all
+}
+
+// quarantined reports whether the command described by s is quarantined.
+func (fd *FlakeDetector) quarantined(s FlakeStats) bool {
+	if fd.isManual(s.Fingerprint) {
+		return true
+	}
+	threshold := fd.Threshold
+	if threshold == 0 {
+		threshold = defaultFlakeThreshold
+	}
+	minRuns := fd.MinRuns
+	if minRuns == 0 {
+		minRuns = defaultFlakeMinRuns
+	}
+	return s.Runs >= minRuns && s.Rate() >= threshold
+}
+
+func (fd *FlakeDetector) isManual(fingerprint string) bool {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return fd.manual[fingerprint]
+}
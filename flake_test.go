@@ -0,0 +1,106 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os/exec"
+	"sync"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestFlakeDetector(t *testing.T) {
+	db := sql.OpenDB(new(historyDB))
+	defer db.Close()
+	h, err := execx.NewHistory(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]int)
+	)
+	h.Runner = execx.RunnerFunc(func(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		name := cmd.Args[1]
+		calls[name]++
+		switch {
+		case name == "broken", name == "flaky" && calls[name]%2 == 1:
+			return nil, errors.New("failed")
+		}
+		return &execx.Result{}, nil
+	})
+	fd := &execx.FlakeDetector{History: h}
+
+	command := func(name string) *exec.Cmd {
+		return &exec.Cmd{Path: "/bin/tool", Args: []string{"tool", name}}
+	}
+	ctx := context.Background()
+	for i := 0; i < 6; i++ {
+		for _, name := range []string{"flaky", "broken", "fine"} {
+			h.Run(ctx, command(name))
+		}
+	}
+
+	stats, err := fd.Stats(ctx, execx.Fingerprint(command("flaky")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Runs != 6 || stats.Failures != 3 || stats.Flips != 5 || !stats.Quarantined {
+		t.Errorf("got flaky stats %+v, want 6 runs, 3 failures, 5 flips, quarantined", stats)
+	}
+	if stats.Rate() != 1 {
+		t.Errorf("got rate %v, want 1", stats.Rate())
+	}
+	stats, err = fd.Stats(ctx, execx.Fingerprint(command("broken")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Failures != 6 || stats.Flips != 0 || stats.Quarantined {
+		t.Errorf("got broken stats %+v, want 6 failures, not flaky", stats)
+	}
+
+	quarantined, err := fd.Quarantined(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 1 || quarantined[0].Args[1] != "flaky" {
+		t.Fatalf("got quarantined %+v, want only flaky", quarantined)
+	}
+
+	// The next run of flaky fails, and is retried.
+	if _, err := fd.Run(ctx, command("flaky")); err != nil {
+		t.Errorf("quarantined command not retried: %v", err)
+	}
+	if calls["flaky"] != 8 {
+		t.Errorf("flaky ran %d times, want 8", calls["flaky"])
+	}
+
+	// Broken commands are not retried, unless quarantined manually.
+	fd.Run(ctx, command("broken"))
+	if calls["broken"] != 7 {
+		t.Errorf("broken ran %d times, want 7", calls["broken"])
+	}
+	fd.Quarantine(execx.Fingerprint(command("broken")))
+	fd.Run(ctx, command("broken"))
+	if calls["broken"] != 10 {
+		t.Errorf("broken ran %d times, want 10", calls["broken"])
+	}
+}
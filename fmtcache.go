@@ -0,0 +1,146 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"reflect"
+	"sync"
+)
+
+// formatCacheMu serializes the creation of format caches.
+var formatCacheMu sync.Mutex
+
+// A formatCache caches the representations of an *ExitError produced by
+// Format and MarshalJSON, which are expensive to compute for errors which
+// carry large environments and many details, and which are typically
+// computed several times, such as for logs, metrics, and error reporting
+// services. The representations are computed after redaction, so caching
+// them does not retain secrets the error would not otherwise show.
+//
+// Cached representations are discarded when details are set using
+// WithDetail, when Invalidate is called, when the stamp of the error
+// changes, as described by formatStamp, and when the Config is replaced,
+// since Config.SensitiveNames determines what is redacted.
+type formatCache struct {
+	mu    sync.Mutex
+	gen   uint64 // incremented by invalidate
+	stamp formatStamp
+	m     map[string][]byte // by representation, such as "%+v" or "json"
+}
+
+// formatStamp summarizes the exported fields of an *ExitError, such that
+// assigning to a field, or adding elements to a slice or a map, changes
+// the stamp. Modifying existing elements of slices and maps in place does
+// not.
+type formatStamp struct {
+	path     string
+	resolved string
+	dir      string
+	args     int
+	argv     *string // first element of Args, to detect a new slice
+	env      int
+	envp     uintptr // identity of ChildEnv, to detect a new map
+	details  int
+	hints    int
+	profiles int
+	stderr   int
+	dropped  int64
+	reason   Reason
+	config   uint64 // generation of the Config, which determines redaction
+}
+
+// stamp returns the stamp of e.
+func (e *ExitError) stamp() formatStamp {
+	s := formatStamp{
+		path:     e.Path,
+		resolved: e.ResolvedPath,
+		dir:      e.Dir,
+		args:     len(e.Args),
+		env:      len(e.ChildEnv),
+		envp:     reflect.ValueOf(e.ChildEnv).Pointer(),
+		details:  len(e.Details),
+		hints:    len(e.Hints),
+		profiles: len(e.Profiles),
+		dropped:  e.StderrDropped,
+		reason:   e.Reason,
+		config:   currentConfig().gen,
+	}
+	if len(e.Args) > 0 {
+		s.argv = &e.Args[0]
+	}
+	if e.ExitError != nil {
+		s.stderr = len(e.ExitError.Stderr)
+	}
+	return s
+}
+
+// formatCache returns the format cache of e, creating it if needed.
+func (e *ExitError) formatCache() *formatCache {
+	formatCacheMu.Lock()
+	defer formatCacheMu.Unlock()
+	if e.fmtCache == nil {
+		e.fmtCache = new(formatCache)
+	}
+	return e.fmtCache
+}
+
+// cached returns the representation of e named key, computing it using
+// compute if it is not cached, or if e changed since it was cached. The
+// returned slice must not be modified.
+func (e *ExitError) cached(key string, compute func() ([]byte, error)) ([]byte, error) {
+	c := e.formatCache()
+	stamp := e.stamp()
+	c.mu.Lock()
+	if c.stamp != stamp {
+		c.stamp, c.m = stamp, nil
+	}
+	b, ok := c.m[key]
+	gen := c.gen
+	c.mu.Unlock()
+	if ok {
+		return b, nil
+	}
+	b, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen == gen && c.stamp == stamp {
+		if c.m == nil {
+			c.m = make(map[string][]byte)
+		}
+		c.m[key] = b
+	}
+	return b, nil
+}
+
+// Invalidate discards the representations of e cached by Format and
+// MarshalJSON. Changes to the fields of e are detected automatically,
+// except for modifications of existing elements of its slices and maps,
+// such as e.Args[1] = "x" or e.ChildEnv["HOME"] = "/", after which
+// Invalidate must be called, if e was formatted before.
+func (e *ExitError) Invalidate() {
+	e.invalidate()
+}
+
+// invalidate discards the representations of e cached so far.
+func (e *ExitError) invalidate() {
+	c := e.formatCache()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.m = nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+// countingValue is a detail value which counts how many times it is
+// formatted.
+type countingValue struct {
+	n int32
+}
+
+func (v *countingValue) String() string {
+	atomic.AddInt32(&v.n, 1)
+	return "counted"
+}
+
+func (v *countingValue) MarshalJSON() ([]byte, error) {
+	atomic.AddInt32(&v.n, 1)
+	return []byte(`"counted"`), nil
+}
+
+func TestExitErrorFormatCache(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	v := new(countingValue)
+	execx.WithDetail(ee, "counter", v)
+
+	var wg sync.WaitGroup
+	outs := make([]string, 8)
+	for i := range outs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outs[i] = fmt.Sprintf("%+v", ee)
+		}(i)
+	}
+	wg.Wait()
+	for _, out := range outs[1:] {
+		if out != outs[0] {
+			t.Fatalf("concurrent formatting produced different output")
+		}
+	}
+	if n := atomic.LoadInt32(&v.n); n < 1 || n > int32(len(outs)) {
+		t.Fatalf("detail formatted %d times", n)
+	}
+	before := atomic.LoadInt32(&v.n)
+	fmt.Fprintf(ioutil.Discard, "%+v", ee)
+	if n := atomic.LoadInt32(&v.n); n != before {
+		t.Errorf("cached representation not reused: detail formatted %d more times", n-before)
+	}
+
+	// Setting a detail invalidates the cache.
+	execx.WithDetail(ee, "attempt", 2)
+	if out := fmt.Sprintf("%+v", ee); !strings.Contains(out, "attempt: 2") {
+		t.Errorf("new detail missing from cached output:\n%s", out)
+	}
+	execx.WithDetail(ee, "attempt", 3)
+	if out := fmt.Sprintf("%+v", ee); !strings.Contains(out, "attempt: 3") {
+		t.Errorf("replaced detail missing from cached output:\n%s", out)
+	}
+
+	// So does adding a hint.
+	ee.Hints = append(ee.Hints, "try again")
+	if out := fmt.Sprintf("%v", ee); !strings.Contains(out, "(try again)") {
+		t.Errorf("new hint missing from cached output: %s", out)
+	}
+
+	// The JSON representation is cached too.
+	before = atomic.LoadInt32(&v.n)
+	b1, err := json.Marshal(ee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, _ := json.Marshal(ee)
+	if string(b1) != string(b2) {
+		t.Errorf("JSON representations differ")
+	}
+	if n := atomic.LoadInt32(&v.n); n != before+1 {
+		t.Errorf("detail marshaled %d times, want once", n-before)
+	}
+}
+
+func TestExitErrorFormatCacheFields(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	json.Marshal(ee)
+	ee.Dir = "/changed"
+	if b, _ := json.Marshal(ee); !strings.Contains(string(b), `"dir":"/changed"`) {
+		t.Errorf("new Dir missing from cached representation: %s", b)
+	}
+	ee.Args = append([]string{"replaced"}, ee.Args[1:]...)
+	if out := fmt.Sprintf("%v", ee); !strings.Contains(out, "(as replaced)") {
+		t.Errorf("new Args missing from cached output: %s", out)
+	}
+
+	// Modifications in place require Invalidate.
+	ee.Args[0] = "modified"
+	ee.Invalidate()
+	if out := fmt.Sprintf("%v", ee); !strings.Contains(out, "(as modified)") {
+		t.Errorf("modified Args missing after Invalidate: %s", out)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WithFSChanges records the files which the command creates, modifies or
+// deletes within dirs, by comparing snapshots of the trees rooted at dirs
+// taken just before the process starts, and once it has exited, such that
+// callers can tell what a step, such as a code generator, actually
+// touched. Relative paths are interpreted relative to the working
+// directory of the command. Directories which do not exist when the
+// command starts are treated as empty.
+//
+// Files are compared by size, mode and modification time: changes which
+// preserve all three are not detected. Directories are reported when they
+// are created or deleted, but not when their contents change. Symbolic
+// links are not followed.
+//
+// The changes are recorded in Result.FSChanges. If the command fails,
+// they are also recorded as an *FSChanges detail named "fs_changes" in
+// the *ExitError. Since the trees are walked twice, WithFSChanges is best
+// suited to trees of modest size.
+func WithFSChanges(dirs ...string) Option {
+	return func(cfg *config) {
+		cfg.fsChanges = append(cfg.fsChanges, dirs...)
+	}
+}
+
+// FSChanges records the files changed by a command, as per WithFSChanges.
+// Paths are the directories passed to WithFSChanges, joined with the paths
+// of the files relative to them, and are sorted.
+type FSChanges struct {
+	Created  []string
+	Modified []string
+	Deleted  []string
+
+	// Err is the first error encountered while walking the trees, if
+	// any, in which case the changes may be incomplete.
+	Err error
+}
+
+// Empty reports whether c records no changes.
+func (c *FSChanges) Empty() bool {
+	return len(c.Created) == 0 && len(c.Modified) == 0 && len(c.Deleted) == 0
+}
+
+// String returns a description of the changes, such as
+//
+//	created gen/a.go, gen/b.go; modified go.sum; deleted gen/old.go
+func (c *FSChanges) String() string {
+	var parts []string
+	for _, l := range []struct {
+		verb  string
+		paths []string
+	}{
+		{"created", c.Created},
+		{"modified", c.Modified},
+		{"deleted", c.Deleted},
+	} {
+		if len(l.paths) > 0 {
+			parts = append(parts, l.verb+" "+strings.Join(l.paths, ", "))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "no changes")
+	}
+	if c.Err != nil {
+		parts = append(parts, "incomplete: "+c.Err.Error())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// fileState is the state of a file in a snapshot.
+type fileState struct {
+	size  int64
+	mode  os.FileMode
+	mtime time.Time
+}
+
+// fsSnapshot is a snapshot of the trees watched by WithFSChanges.
+type fsSnapshot struct {
+	files map[string]fileState // by path, as reported
+	err   error
+}
+
+// snapshotTrees takes a snapshot of the trees rooted at dirs, relative to
+// wd.
+func snapshotTrees(dirs []string, wd string) *fsSnapshot {
+	s := &fsSnapshot{files: make(map[string]fileState)}
+	for _, dir := range dirs {
+		root := dir
+		if !filepath.IsAbs(root) && wd != "" {
+			root = filepath.Join(wd, root)
+		}
+		err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				if s.err == nil {
+					s.err = err
+				}
+				if fi != nil && fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if path == root {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return nil
+			}
+			s.files[filepath.Join(dir, rel)] = fileState{
+				size:  fi.Size(),
+				mode:  fi.Mode(),
+				mtime: fi.ModTime(),
+			}
+			return nil
+		})
+		if err != nil && s.err == nil {
+			s.err = err
+		}
+	}
+	return s
+}
+
+// diffSnapshots returns the changes between before and after.
+func diffSnapshots(before, after *fsSnapshot) *FSChanges {
+	c := new(FSChanges)
+	for path, a := range after.files {
+		b, ok := before.files[path]
+		switch {
+		case !ok:
+			c.Created = append(c.Created, path)
+		case a.mode.Type() != b.mode.Type():
+			c.Modified = append(c.Modified, path)
+		case a.mode.IsDir():
+		case a.size != b.size || a.mode != b.mode || !a.mtime.Equal(b.mtime):
+			c.Modified = append(c.Modified, path)
+		}
+	}
+	for path := range before.files {
+		if _, ok := after.files[path]; !ok {
+			c.Deleted = append(c.Deleted, path)
+		}
+	}
+	sort.Strings(c.Created)
+	sort.Strings(c.Modified)
+	sort.Strings(c.Deleted)
+	c.Err = before.err
+	if c.Err == nil {
+		c.Err = after.err
+	}
+	return c
+}
+
+// snapshotFS takes the snapshot of the trees watched by WithFSChanges
+// before the process starts.
+func (h *Handle) snapshotFS() {
+	h.fsBefore = snapshotTrees(h.cfg.fsChanges, h.cmd.Dir)
+}
+
+// fsChanges returns the changes to the trees watched by WithFSChanges, or
+// nil if they are not watched.
+func (h *Handle) fsChanges() *FSChanges {
+	if h.fsBefore == nil {
+		return nil
+	}
+	return diffSnapshots(h.fsBefore, snapshotTrees(h.cfg.fsChanges, h.cmd.Dir))
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWithFSChanges(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	writeFile(t, filepath.Join(dir, "b.txt"), "b\n")
+	writeFile(t, filepath.Join(dir, "same.txt"), "same\n")
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), past, past); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(tempDir(t), "gen")
+	writeExecutable(t, script, "#!/bin/sh\necho x >> a.txt\nrm b.txt\nmkdir out\necho y >> out/c.txt\nexit \"$1\"\n")
+
+	cmd := exec.Command(script, "0")
+	cmd.Dir = dir
+	res, err := execx.Run(context.Background(), cmd, execx.WithFSChanges("."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &execx.FSChanges{
+		Created:  []string{"out", filepath.Join("out", "c.txt")},
+		Modified: []string{"a.txt"},
+		Deleted:  []string{"b.txt"},
+	}
+	if !reflect.DeepEqual(res.FSChanges, want) {
+		t.Errorf("got %v, want %v", res.FSChanges, want)
+	}
+
+	// A failure records the changes in the error.
+	cmd = exec.Command(script, "3")
+	cmd.Dir = dir
+	_, err = execx.Run(context.Background(), cmd, execx.WithFSChanges("missing", "out"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	v, ok := ee.Detail("fs_changes")
+	if !ok {
+		t.Fatal("fs_changes detail missing")
+	}
+	want = &execx.FSChanges{Modified: []string{filepath.Join("out", "c.txt")}}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("got %v, want %v", v, want)
+	}
+}
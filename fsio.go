@@ -0,0 +1,117 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// WithStdinFS feeds the file named name in fsys to the standard input of
+// the command. It is useful for replaying recorded inputs, such as files
+// embedded using package embed, or held in an fstest.MapFS, without
+// touching the real file system. If the file cannot be opened, or if
+// cmd.Stdin is also set, Start returns a *StartError.
+func WithStdinFS(fsys fs.FS, name string) Option {
+	return func(cfg *config) {
+		cfg.stdinFS = fsys
+		cfg.stdinName = name
+	}
+}
+
+// An OutputSink stores the outputs collected by WithOutputFS, as files.
+// An in-memory file system, such as an fstest.MapFS, can serve as an
+// OutputSink by way of a small adapter, such that the outputs can be
+// inspected or replayed using fs.FS APIs.
+type OutputSink interface {
+	// WriteOutput stores data as the contents of the file named name,
+	// last modified at modTime.
+	WriteOutput(name string, data []byte, modTime time.Time)
+}
+
+// WithOutputFS collects the standard output and standard error of the
+// command into files named stdout and stderr in sink, once the command
+// exits, such that command interactions can be captured in memory. If
+// either name is empty, the respective output is not collected. Output is
+// collected in addition to cmd.Stdout, cmd.Stderr or the capture buffers,
+// as per WithStdoutWriters. The modification time of the files is the
+// time at which the command exited, as per the Clock of the command.
+//
+// The files are stored by the goroutine which waits for the command. sink
+// must not be accessed concurrently until Wait returns.
+func WithOutputFS(sink OutputSink, stdout, stderr string) Option {
+	return func(cfg *config) {
+		cfg.outputFS = sink
+		cfg.outputNames = [2]string{stdout, stderr}
+	}
+}
+
+// outputFS holds the buffers which collect outputs for WithOutputFS.
+type outputFS struct {
+	stdin  io.Closer
+	stdout *bytes.Buffer
+	stderr *bytes.Buffer
+}
+
+// openFS opens the standard input file configured by WithStdinFS, and sets
+// up the buffers for WithOutputFS.
+func (h *Handle) openFS() error {
+	cmd := h.cmd
+	if h.cfg.stdinFS != nil {
+		if cmd.Stdin != nil {
+			return wrapStart(errors.New("execx: WithStdinFS: cmd.Stdin is already set"), cmd, h.cfg.collectors)
+		}
+		f, err := h.cfg.stdinFS.Open(h.cfg.stdinName)
+		if err != nil {
+			return wrapStart(err, cmd, h.cfg.collectors)
+		}
+		cmd.Stdin = f
+		h.fs.stdin = f
+	}
+	if h.cfg.outputFS != nil {
+		if h.cfg.outputNames[0] != "" {
+			h.fs.stdout = new(bytes.Buffer)
+			h.cfg.stdoutWriters = append(h.cfg.stdoutWriters, h.fs.stdout)
+		}
+		if h.cfg.outputNames[1] != "" {
+			h.fs.stderr = new(bytes.Buffer)
+			h.cfg.stderrWriters = append(h.cfg.stderrWriters, h.fs.stderr)
+		}
+	}
+	return nil
+}
+
+// closeFS closes the standard input file, if any.
+func (h *Handle) closeFS() {
+	if h.fs.stdin != nil {
+		h.fs.stdin.Close()
+	}
+}
+
+// collectFS closes the standard input file, if any, and stores collected
+// outputs, if any. It is called once the outputs have been consumed.
+func (h *Handle) collectFS() {
+	h.closeFS()
+	now := h.clock.Now()
+	if h.fs.stdout != nil {
+		h.cfg.outputFS.WriteOutput(h.cfg.outputNames[0], h.fs.stdout.Bytes(), now)
+	}
+	if h.fs.stderr != nil {
+		h.cfg.outputFS.WriteOutput(h.cfg.outputNames[1], h.fs.stderr.Bytes(), now)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"acln.ro/execx"
+	"acln.ro/execx/exectest"
+)
+
+// mapFSSink stores the outputs collected by WithOutputFS in an
+// fstest.MapFS.
+type mapFSSink fstest.MapFS
+
+func (m mapFSSink) WriteOutput(name string, data []byte, modTime time.Time) {
+	m[name] = &fstest.MapFile{Data: data, Mode: 0644, ModTime: modTime}
+}
+
+func TestFS(t *testing.T) {
+	in := fstest.MapFS{
+		"inputs/greeting.txt": &fstest.MapFile{Data: []byte("hello from fs")},
+	}
+	out := fstest.MapFS{}
+	res, err := execx.Run(context.Background(), selfCmd("echo"),
+		execx.WithStdinFS(in, "inputs/greeting.txt"),
+		execx.WithOutputFS(mapFSSink(out), "run/stdout", "run/stderr"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "hello from fs" {
+		t.Errorf("got stdout %q, want %q", res.Stdout, "hello from fs")
+	}
+	for name, want := range map[string]string{
+		"run/stdout": "hello from fs",
+		"run/stderr": "echoed",
+	} {
+		got, err := fs.ReadFile(out, name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if err := fstest.TestFS(out, "run/stdout", "run/stderr"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFSOnlyStderr(t *testing.T) {
+	out := fstest.MapFS{}
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("ignored")
+	ctx := execx.WithClock(context.Background(), exectest.NewFakeClock(epoch))
+	if _, err := execx.Run(ctx, cmd, execx.WithOutputFS(mapFSSink(out), "", "stderr")); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out["stderr"] == nil {
+		t.Fatalf("got files %v, want only stderr", out)
+	}
+	if got := out["stderr"].ModTime; !got.Equal(epoch) {
+		t.Errorf("ModTime = %v, want %v, as per the clock", got, epoch)
+	}
+}
+
+func TestStdinFSErrors(t *testing.T) {
+	in := fstest.MapFS{"a": &fstest.MapFile{Data: []byte("a")}}
+
+	_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithStdinFS(in, "missing"))
+	var se *execx.StartError
+	if !errors.As(err, &se) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v, want *StartError wrapping fs.ErrNotExist", err)
+	}
+
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("conflict")
+	_, err = execx.Run(context.Background(), cmd, execx.WithStdinFS(in, "a"))
+	if !errors.As(err, &se) {
+		t.Errorf("got %v, want *StartError", err)
+	}
+}
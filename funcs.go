@@ -0,0 +1,69 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"os/exec"
+)
+
+// RunFunc returns a function which runs cmd, configured by opts, as per
+// Run, and returns the error of the run, such that commands slot directly
+// into the Go method of golang.org/x/sync/errgroup.Group:
+//
+//	g, ctx := errgroup.WithContext(ctx)
+//	g.Go(execx.RunFunc(ctx, exec.Command("make", "frontend")))
+//	g.Go(execx.RunFunc(ctx, exec.Command("make", "backend")))
+//	err := g.Wait()
+//
+// Errors are returned as Run returns them, without further wrapping, so
+// the error returned by Wait is the *ExitError, or other error, of the
+// first command which failed, and errors.As finds it as usual. Commands
+// killed because the context of the group was canceled by that failure
+// report their own errors, which the group discards.
+//
+// The returned function must be called at most once, since cmd can only
+// run once.
+func RunFunc(ctx context.Context, cmd *exec.Cmd, opts ...Option) func() error {
+	return func() error {
+		_, err := Run(ctx, cmd, opts...)
+		return err
+	}
+}
+
+// ResultFunc is like RunFunc, but the returned function also stores the
+// Result of the run in *res, even if the run fails, such that callers can
+// inspect the outputs of the commands once the group completes.
+func ResultFunc(ctx context.Context, cmd *exec.Cmd, res **Result, opts ...Option) func() error {
+	return func() error {
+		var err error
+		*res, err = Run(ctx, cmd, opts...)
+		return err
+	}
+}
+
+// OutputFunc is like RunFunc, but the returned function also stores the
+// standard output of the command in *stdout, if the command succeeds. The
+// standard output must be captured, as described by Start.
+func OutputFunc(ctx context.Context, cmd *exec.Cmd, stdout *[]byte, opts ...Option) func() error {
+	return func() error {
+		res, err := Run(ctx, cmd, opts...)
+		if err != nil {
+			return err
+		}
+		*stdout = res.Stdout
+		return nil
+	}
+}
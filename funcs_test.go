@@ -0,0 +1,77 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+// group is a minimal errgroup.Group, which returns the first error.
+type group struct {
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+}
+
+func (g *group) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.once.Do(func() { g.err = err })
+		}
+	}()
+}
+
+func (g *group) Wait() error {
+	g.wg.Wait()
+	return g.err
+}
+
+func TestRunFunc(t *testing.T) {
+	ctx := context.Background()
+	echo := selfCmd("echo")
+	echo.Stdin = strings.NewReader("out")
+	var (
+		g      group
+		stdout []byte
+		res    *execx.Result
+	)
+	g.Go(execx.OutputFunc(ctx, echo, &stdout))
+	g.Go(execx.ResultFunc(ctx, selfCmd("on"), &res))
+	err := g.Wait()
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Result != res {
+		t.Errorf("the Result of the failed command is not the Result of its *ExitError")
+	}
+	if string(stdout) != "out" {
+		t.Errorf("got stdout %q, want %q", stdout, "out")
+	}
+
+	g = group{}
+	g.Go(execx.RunFunc(ctx, selfCmd("echo")))
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
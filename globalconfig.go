@@ -0,0 +1,177 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"acln.ro/execx/errcode"
+)
+
+// ErrNotAllowed is returned, wrapped in a *StartError, by Start for
+// commands whose program is not listed in Config.AllowedPrograms.
+var ErrNotAllowed = newCodedError("execx: program not allowed", errcode.PolicyDenied)
+
+// A Config holds settings which apply to all commands started by Start.
+// The current Config is loaded and stored as a whole, using LoadConfig
+// and StoreConfig, such that long-running programs can replace it while
+// commands run, for example to tighten policies, without restarting.
+//
+// Commands use the Config current at the time they are started, except
+// for SpawnLogger and OnEvent, which apply to all records and events
+// produced after the Config is stored, and Catalog, which applies to all
+// errors formatted after the Config is stored. The zero Config holds the
+// defaults.
+type Config struct {
+	// SensitiveNames lists substrings which, if present in the name of
+	// an environment variable, mark the variable as likely to hold a
+	// secret, as per IsSensitive. If SensitiveNames is nil, a default
+	// list, including "PASSWORD", "TOKEN" and "SECRET", is used.
+	SensitiveNames []string
+
+	// OutputLimit, if positive, limits the captured output of commands
+	// which are not configured using WithOutputLimit, as if by
+	// WithOutputLimit(OutputLimit, OverflowAction).
+	OutputLimit    int
+	OverflowAction OverflowAction
+
+	// SpawnLogger and SpawnLogLevel configure the logger which records
+	// the start and the exit of every command, as per SetSpawnLogger.
+	SpawnLogger   SpawnLogger
+	SpawnLogLevel LogLevel
+
+	// OnEvent, if not nil, is called with every event published to the
+	// subscribers registered using Subscribe, such as in order to
+	// maintain metrics. It is called synchronously, and must not block.
+	OnEvent func(Event)
+
+	// AllowedPrograms, if not nil, lists the programs which may be
+	// started, by base name, such as "git", or by path. Start fails
+	// with a *StartError which wraps ErrNotAllowed for other programs.
+	// Programs which execute in place of the requested program, such as
+	// those chosen by a Resolver, or the interpreters used by
+	// WithShebangFallback, the programs of WithWrappers, and the shell
+	// which runs the shim of WithUmask, must be allowed too.
+	AllowedPrograms []string
+
+	// Catalog, if not nil, translates the messages used when formatting
+	// *ExitError and *StartError values, unless another Catalog is
+	// selected using Localize.
+	Catalog Catalog
+
+	gen uint64 // incremented every time a Config is stored
+}
+
+// copy returns a deep copy of c.
+func (c Config) copy() *Config {
+	if c.SensitiveNames != nil {
+		c.SensitiveNames = append([]string{}, c.SensitiveNames...)
+	}
+	if c.AllowedPrograms != nil {
+		c.AllowedPrograms = append([]string{}, c.AllowedPrograms...)
+	}
+	return &c
+}
+
+// sensitive returns the substrings which mark variables as sensitive.
+func (c *Config) sensitive() []string {
+	if c.SensitiveNames == nil {
+		return sensitiveNames
+	}
+	return c.SensitiveNames
+}
+
+// allows returns an error if c does not allow the program at path to be
+// started.
+func (c *Config) allows(path string) error {
+	if c.AllowedPrograms == nil {
+		return nil
+	}
+	for _, p := range c.AllowedPrograms {
+		if p == path || p == filepath.Base(path) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotAllowed, path)
+}
+
+var (
+	globalConfig atomic.Value // *Config
+	configMu     sync.Mutex   // serializes UpdateConfig
+)
+
+func init() {
+	globalConfig.Store(new(Config))
+}
+
+// LoadConfig returns a copy of the current Config.
+func LoadConfig() Config {
+	return *currentConfig().copy()
+}
+
+// StoreConfig replaces the current Config with a copy of c. StoreConfig
+// is safe to call from multiple goroutines concurrently.
+func StoreConfig(c Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	c.gen = currentConfig().gen + 1
+	globalConfig.Store(c.copy())
+}
+
+// UpdateConfig calls f with a copy of the current Config, and replaces
+// the current Config with it once f returns. Concurrent calls to
+// UpdateConfig and StoreConfig do not lose each other's updates.
+func UpdateConfig(f func(*Config)) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	c := currentConfig().copy()
+	f(c)
+	c.gen = currentConfig().gen + 1
+	globalConfig.Store(c.copy())
+}
+
+// currentConfig returns the current Config, which must not be modified.
+func currentConfig() *Config {
+	return globalConfig.Load().(*Config)
+}
+
+// applyConfig applies the current Config to h, and checks that it allows
+// the program requested by the caller.
+func (h *Handle) applyConfig() error {
+	c := currentConfig()
+	h.conf = c
+	if err := c.allows(h.cmd.Path); err != nil {
+		return wrapStart(err, h.cmd, h.cfg.collectors)
+	}
+	if c.OutputLimit > 0 && h.cfg.limit == 0 {
+		h.cfg.limit, h.cfg.overflow = c.OutputLimit, c.OverflowAction
+	}
+	return nil
+}
+
+// checkPrograms checks that the Config applied to h allows the programs
+// which execute in place of, or around, the program requested by the
+// caller, such as an interpreter or a wrapper.
+func (h *Handle) checkPrograms() error {
+	for _, path := range h.programs {
+		if err := h.conf.allows(path); err != nil {
+			return wrapStart(err, h.cmd, h.cfg.collectors)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+// storeConfig stores c for the duration of the test.
+func storeConfig(t *testing.T, c execx.Config) {
+	old := execx.LoadConfig()
+	execx.StoreConfig(c)
+	t.Cleanup(func() { execx.StoreConfig(old) })
+}
+
+func TestConfig(t *testing.T) {
+	t.Run("AllowedPrograms", testConfigAllowedPrograms)
+	t.Run("SensitiveNames", testConfigSensitiveNames)
+	t.Run("OutputLimit", testConfigOutputLimit)
+	t.Run("OnEvent", testConfigOnEvent)
+	t.Run("Copy", testConfigCopy)
+}
+
+func testConfigAllowedPrograms(t *testing.T) {
+	storeConfig(t, execx.Config{AllowedPrograms: []string{"true"}})
+	if _, err := execx.Run(context.Background(), exec.Command("true")); err != nil {
+		t.Fatalf("allowed program: %v", err)
+	}
+	_, err := execx.Run(context.Background(), exec.Command("false"))
+	var se *execx.StartError
+	if !errors.As(err, &se) || !errors.Is(err, execx.ErrNotAllowed) {
+		t.Fatalf("got %v, want *StartError wrapping ErrNotAllowed", err)
+	}
+
+	// Tighten the policy at run time.
+	execx.UpdateConfig(func(c *execx.Config) { c.AllowedPrograms = []string{} })
+	if _, err := execx.Run(context.Background(), exec.Command("true")); !errors.Is(err, execx.ErrNotAllowed) {
+		t.Fatalf("got %v after tightening the policy, want ErrNotAllowed", err)
+	}
+
+	// Wrappers must be allowed too.
+	execx.UpdateConfig(func(c *execx.Config) { c.AllowedPrograms = []string{"true"} })
+	wrap := execx.WithWrappers(execx.NiceWrapper(19))
+	if _, err := execx.Run(context.Background(), exec.Command("true"), wrap); !errors.Is(err, execx.ErrNotAllowed) {
+		t.Fatalf("got %v for a wrapper which is not allowed, want ErrNotAllowed", err)
+	}
+	execx.UpdateConfig(func(c *execx.Config) { c.AllowedPrograms = []string{"true", "nice"} })
+	if _, err := execx.Run(context.Background(), exec.Command("true"), wrap); err != nil {
+		t.Fatalf("allowed wrapper: %v", err)
+	}
+}
+
+func testConfigSensitiveNames(t *testing.T) {
+	if !execx.IsSensitive("GITHUB_TOKEN") || execx.IsSensitive("BUILD_ID") {
+		t.Fatal("unexpected default sensitivity")
+	}
+	storeConfig(t, execx.Config{SensitiveNames: []string{"BUILD"}})
+	if execx.IsSensitive("GITHUB_TOKEN") || !execx.IsSensitive("BUILD_ID") {
+		t.Fatal("SensitiveNames not applied")
+	}
+
+	// Errors formatted before the Config changed are redacted anew.
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	ee.ChildEnv["MYCRED"] = "hunter2"
+	if b, _ := json.Marshal(ee); !strings.Contains(string(b), "hunter2") {
+		t.Fatalf("MYCRED redacted before it was marked sensitive: %s", b)
+	}
+	execx.UpdateConfig(func(c *execx.Config) { c.SensitiveNames = append(c.SensitiveNames, "MYCRED") })
+	if b, _ := json.Marshal(ee); strings.Contains(string(b), "hunter2") {
+		t.Errorf("MYCRED not redacted after UpdateConfig: %s", b)
+	}
+}
+
+func testConfigOutputLimit(t *testing.T) {
+	storeConfig(t, execx.Config{OutputLimit: 4, OverflowAction: execx.OverflowTruncate})
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("0123456789")
+	_, err := execx.Run(context.Background(), cmd)
+	var oe *execx.OutputOverflowError
+	if !errors.As(err, &oe) {
+		t.Fatalf("got %v, want *OutputOverflowError", err)
+	}
+
+	// Options take precedence over the Config.
+	cmd = selfCmd("echo")
+	cmd.Stdin = strings.NewReader("0123456789")
+	res, err := execx.Run(context.Background(), cmd, execx.WithOutputLimit(100, execx.OverflowTruncate))
+	if err != nil || string(res.Stdout) != "0123456789" {
+		t.Fatalf("got %q, %v", res.Stdout, err)
+	}
+}
+
+func testConfigOnEvent(t *testing.T) {
+	var started, exited int32
+	storeConfig(t, execx.Config{OnEvent: func(ev execx.Event) {
+		switch ev.(type) {
+		case *execx.CommandStarted:
+			atomic.AddInt32(&started, 1)
+		case *execx.CommandExited:
+			atomic.AddInt32(&exited, 1)
+		}
+	}})
+	if _, err := execx.Run(context.Background(), exec.Command("true")); err != nil {
+		t.Fatal(err)
+	}
+	if started != 1 || exited != 1 {
+		t.Errorf("got %d starts and %d exits, want 1 each", started, exited)
+	}
+}
+
+func testConfigCopy(t *testing.T) {
+	allowed := []string{"true"}
+	storeConfig(t, execx.Config{AllowedPrograms: allowed})
+	allowed[0] = "false"
+	if got := execx.LoadConfig().AllowedPrograms[0]; got != "true" {
+		t.Errorf("stored Config changed with the caller's slice: %q", got)
+	}
+}
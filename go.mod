@@ -1,6 +1,6 @@
 module acln.ro/execx
 
-go 1.12
+go 1.19
 
 require (
 	acln.ro/env v0.1.0
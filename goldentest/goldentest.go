@@ -0,0 +1,262 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package goldentest provides utilities for testing the output of commands
+// against golden files.
+//
+// Golden files are updated, rather than compared against, when tests are
+// run with the -update flag:
+//
+//	go test -run TestGenerate -update
+package goldentest
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"acln.ro/execx"
+	"acln.ro/execx/errcode"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// A Normalizer rewrites volatile parts of the output of a command, such as
+// timestamps or temporary paths, into stable placeholders, before it is
+// compared against a golden file.
+type Normalizer func(output []byte) []byte
+
+// ReplaceAll returns a Normalizer which replaces matches of re by repl,
+// as per (*regexp.Regexp).ReplaceAll.
+func ReplaceAll(re *regexp.Regexp, repl string) Normalizer {
+	return func(output []byte) []byte {
+		return re.ReplaceAll(output, []byte(repl))
+	}
+}
+
+// timestampRE matches RFC 3339 timestamps, and timestamps in the format
+// used by package log, such as 2009/11/10 23:00:00.
+var timestampRE = regexp.MustCompile(`\d{4}[-/]\d{2}[-/]\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`)
+
+// Timestamps replaces timestamps by <TIME>.
+var Timestamps Normalizer = ReplaceAll(timestampRE, "<TIME>")
+
+// Path returns a Normalizer which replaces occurrences of path, such as
+// a temporary directory created by the test, by placeholder. If path is
+// a symbolic link, occurrences of its target are replaced as well.
+func Path(path, placeholder string) Normalizer {
+	paths := []string{path}
+	if real, err := filepath.EvalSymlinks(path); err == nil && real != path {
+		// Replace the longer path first.
+		paths = append([]string{real}, paths...)
+		if len(real) < len(path) {
+			paths[0], paths[1] = paths[1], paths[0]
+		}
+	}
+	return func(output []byte) []byte {
+		s := string(output)
+		for _, p := range paths {
+			s = strings.ReplaceAll(s, p, placeholder)
+		}
+		return []byte(s)
+	}
+}
+
+// TempDirs replaces paths of files and directories under os.TempDir by
+// <TMP>, such that paths of directories created by testing.T.TempDir,
+// os.MkdirTemp and the like, which vary across runs, become stable.
+var TempDirs Normalizer = func(output []byte) []byte {
+	dir := filepath.Clean(os.TempDir())
+	re := regexp.MustCompile(regexp.QuoteMeta(dir) + `(` + regexp.QuoteMeta(string(filepath.Separator)) + `[^\s'"]*)?`)
+	return re.ReplaceAll(output, []byte("<TMP>"))
+}
+
+// TB is the subset of testing.TB used by this package.
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+// Run runs cmd using execx.Run, normalizes its standard output using the
+// specified normalizers, in order, and compares it against the contents of
+// the golden file at path. If the output does not match, Run fails the test
+// with a *MismatchError. If the command fails, Run fails the test with
+// the *execx.ExitError, formatted using "%+v".
+//
+// If the -update flag is set, Run writes the normalized output to the
+// golden file instead, creating it and its parent directories if needed.
+func Run(t TB, cmd *exec.Cmd, path string, norms ...Normalizer) *execx.Result {
+	t.Helper()
+
+	res, err := execx.Run(context.Background(), cmd)
+	if err != nil {
+		t.Fatalf("%+v", err)
+		return res
+	}
+	got := res.Stdout
+	for _, norm := range norms {
+		got = norm(got)
+	}
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("goldentest: %v", err)
+			return res
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("goldentest: %v", err)
+		}
+		return res
+	}
+	want, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("goldentest: golden file %s does not exist; run with -update to create it", path)
+		return res
+	}
+	if err != nil {
+		t.Fatalf("goldentest: %v", err)
+		return res
+	}
+	if diff := diff(string(want), string(got)); diff != "" {
+		t.Fatalf("%+v", &MismatchError{
+			Cmdline:  execx.Cmdline(cmd),
+			Dir:      cmd.Dir,
+			ExitCode: res.ExitCode,
+			Stderr:   string(res.Stderr),
+			Golden:   path,
+			Diff:     diff,
+		})
+	}
+	return res
+}
+
+// MismatchError records a mismatch between the output of a command and
+// a golden file.
+type MismatchError struct {
+	// Cmdline is the command line of the command, as per execx.Cmdline.
+	Cmdline string
+
+	// Dir is the working directory of the command.
+	Dir string
+
+	// ExitCode is the exit code of the command.
+	ExitCode int
+
+	// Stderr holds the standard error output of the command.
+	Stderr string
+
+	// Golden is the path of the golden file.
+	Golden string
+
+	// Diff is a line by line diff of the contents of the golden file and
+	// the normalized output of the command (-want +got).
+	Diff string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("goldentest: output of %s does not match %s", e.Cmdline, e.Golden)
+}
+
+// Code returns errcode.OutputMismatch.
+func (e *MismatchError) Code() errcode.Code {
+	return errcode.OutputMismatch
+}
+
+// Format implements fmt.Formatter for *MismatchError. For "%v", Format
+// emits e.Error(). For "%+v", Format also emits the context of the
+// command, and the diff.
+func (e *MismatchError) Format(s fmt.State, verb rune) {
+	if verb != 'v' {
+		return
+	}
+	fmt.Fprint(s, e.Error())
+	if !s.Flag('+') {
+		return
+	}
+	dir := e.Dir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	fmt.Fprintf(s, "\nworkdir: %s\n", dir)
+	fmt.Fprintf(s, "exit code: %d\n", e.ExitCode)
+	if e.Stderr != "" {
+		fmt.Fprintf(s, "stderr:\n%s\n", strings.TrimSuffix(e.Stderr, "\n"))
+	}
+	fmt.Fprintf(s, "diff (-want +got):\n%s", e.Diff)
+}
+
+// diff returns a line by line diff of want and got, or the empty string if
+// they are equal. Lines only in want are prefixed with "-", lines only in
+// got with "+", and common lines with " ".
+func diff(want, got string) string {
+	if want == got {
+		return ""
+	}
+	a := strings.SplitAfter(want, "\n")
+	b := strings.SplitAfter(got, "\n")
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var sb strings.Builder
+	line := func(op byte, text string) {
+		if text == "" {
+			return
+		}
+		sb.WriteByte(op)
+		sb.WriteString(text)
+		if !strings.HasSuffix(text, "\n") {
+			sb.WriteString("\n\\ no newline at end\n")
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			line(' ', a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			line('-', a[i])
+			i++
+		default:
+			line('+', b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		line('-', a[i])
+	}
+	for ; j < len(b); j++ {
+		line('+', b[j])
+	}
+	return sb.String()
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package goldentest_test
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx/goldentest"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("EXECX_TEST") == "golden" {
+		fmt.Printf("started at %s\n", time.Now().Format(time.RFC3339Nano))
+		fmt.Printf("wrote %s\n", os.Getenv("EXECX_TEST_PATH"))
+		fmt.Printf("greeting: %s\n", os.Getenv("EXECX_TEST_GREETING"))
+		os.Stderr.WriteString("some warning\n")
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	golden := filepath.Join(dir, "testdata", "out.golden")
+	norms := []goldentest.Normalizer{goldentest.Timestamps, goldentest.Path(dir, "<DIR>")}
+
+	setUpdate(t, true)
+	goldentest.Run(t, goldenCmd(dir, "hello"), golden, norms...)
+	contents, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "started at <TIME>\nwrote <DIR>/file\ngreeting: hello\n"
+	if string(contents) != want {
+		t.Fatalf("got golden file %q, want %q", contents, want)
+	}
+
+	setUpdate(t, false)
+	goldentest.Run(t, goldenCmd(dir, "hello"), golden, norms...)
+
+	ft := new(fakeTB)
+	goldentest.Run(ft, goldenCmd(dir, "goodbye"), golden, norms...)
+	for _, want := range []string{"does not match", "exit code: 0", "some warning", "-greeting: hello", "+greeting: goodbye"} {
+		if !strings.Contains(ft.msg, want) {
+			t.Errorf("mismatch message does not contain %q:\n%s", want, ft.msg)
+		}
+	}
+}
+
+func TestRunMissing(t *testing.T) {
+	ft := new(fakeTB)
+	goldentest.Run(ft, goldenCmd(t.TempDir(), "hello"), filepath.Join(t.TempDir(), "missing.golden"))
+	if !strings.Contains(ft.msg, "run with -update") {
+		t.Errorf("got %q", ft.msg)
+	}
+}
+
+func TestTempDirs(t *testing.T) {
+	tmp := filepath.Join(os.TempDir(), "TestX123", "001", "file")
+	got := goldentest.TempDirs([]byte("created " + tmp + " ok"))
+	if want := "created <TMP> ok"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func goldenCmd(dir, greeting string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(),
+		"EXECX_TEST=golden",
+		"EXECX_TEST_PATH="+filepath.Join(dir, "file"),
+		"EXECX_TEST_GREETING="+greeting,
+	)
+	return cmd
+}
+
+func setUpdate(t *testing.T, update bool) {
+	t.Helper()
+
+	old := flag.Lookup("update").Value.String()
+	if err := flag.Set("update", fmt.Sprint(update)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flag.Set("update", old) })
+}
+
+type fakeTB struct {
+	msg string
+}
+
+func (ft *fakeTB) Helper() {}
+
+func (ft *fakeTB) Fatalf(format string, args ...interface{}) {
+	ft.msg = fmt.Sprintf(format, args...)
+}
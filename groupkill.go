@@ -0,0 +1,47 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+// WithGroupKill starts the process in a new process group, as per the
+// NewProcessGroup spawn flag, and directs the signals which stop the
+// command to the whole group, rather than to the process alone, such that
+// children which the process started do not outlive it. This applies when
+// the context of the command is done, when it times out, when Stop is
+// called, and when it is killed because of its output, as per
+// OverflowKill. On platforms without process groups, only the process is
+// signalled.
+func WithGroupKill() Option {
+	return func(cfg *config) {
+		cfg.groupKill = true
+		cfg.spawn |= NewProcessGroup
+	}
+}
+
+// kill kills the process, and its process group, if WithGroupKill is used.
+func (h *Handle) kill() error {
+	if h.cfg.groupKill && killGroup(h.cmd.Process.Pid) == nil {
+		return nil
+	}
+	return h.cmd.Process.Kill()
+}
+
+// terminate asks the process, and its process group, if WithGroupKill is
+// used, to exit gracefully, as per Terminate.
+func (h *Handle) terminate() error {
+	if h.cfg.groupKill && terminateGroup(h.cmd.Process.Pid) == nil {
+		return nil
+	}
+	return Terminate(h.cmd)
+}
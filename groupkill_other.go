@@ -0,0 +1,34 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build !unix
+// +build !unix
+
+package execx
+
+import "errors"
+
+var errNoGroups = errors.New("execx: process groups cannot be signalled on this platform")
+
+// killGroup reports that process groups cannot be signalled on this
+// platform.
+func killGroup(pid int) error {
+	return errNoGroups
+}
+
+// terminateGroup reports that process groups cannot be signalled on this
+// platform. On Windows, Terminate reaches the whole process group anyway.
+func terminateGroup(pid int) error {
+	return errNoGroups
+}
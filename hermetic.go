@@ -0,0 +1,94 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"acln.ro/env"
+)
+
+// DefaultHermeticEnv lists the variables Hermetic keeps by default.
+var DefaultHermeticEnv = []string{"PATH", "HOME", "TMPDIR"}
+
+// Hermetic runs the command in hermetic mode, with a minimal environment,
+// like env -i does. Only the specified variables are inherited from the
+// environment of the current process, or those in DefaultHermeticEnv, if
+// none are specified. Variables which are not set in the current process
+// are omitted. Other variables must be set explicitly, using WithEnv or
+// WithDefaultEnv.
+//
+// Hermetic mode fails loudly if the command relies on the environment of
+// the current process in other ways: if cmd.Env is set, and holds
+// variables which are not kept, but have the same values as in the current
+// process, such as when cmd.Env is built from os.Environ, Start returns a
+// *StartError which wraps a *HermeticError.
+//
+// Hermetic mode, and the variables it keeps, are recorded as a detail
+// named "hermetic" in errors produced by the command.
+func Hermetic(keep ...string) Option {
+	if len(keep) == 0 {
+		keep = DefaultHermeticEnv
+	}
+	keep = copyStrings(keep)
+	return func(cfg *config) {
+		cfg.hermetic = keep
+	}
+}
+
+// HermeticError records an attempt to inherit variables from the
+// environment of the current process into the environment of a command
+// running in hermetic mode.
+type HermeticError struct {
+	// Inherited holds the names of the inherited variables, sorted.
+	Inherited []string
+}
+
+func (e *HermeticError) Error() string {
+	return fmt.Sprintf("execx: hermetic: cmd.Env inherits %s from the parent environment; set them using WithEnv, or keep them using Hermetic", strings.Join(e.Inherited, ", "))
+}
+
+// hermeticEnv returns the variables of parent which are kept.
+func hermeticEnv(parent env.Map, keep []string) env.Map {
+	m := make(env.Map)
+	for _, k := range keep {
+		if v, ok := parent[k]; ok {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// checkHermetic returns a *HermeticError if child holds variables which
+// are not kept, and have the same values in parent.
+func checkHermetic(child, parent env.Map, keep []string) error {
+	kept := make(map[string]bool, len(keep))
+	for _, k := range keep {
+		kept[k] = true
+	}
+	var inherited []string
+	for k, v := range child {
+		if pv, ok := parent[k]; ok && pv == v && !kept[k] {
+			inherited = append(inherited, k)
+		}
+	}
+	if len(inherited) == 0 {
+		return nil
+	}
+	sort.Strings(inherited)
+	return &HermeticError{Inherited: inherited}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestHermetic(t *testing.T) {
+	t.Setenv("EXECX_LEAK", "leaked")
+	t.Setenv("HOME", "/nonexistent/home")
+
+	cmd := exec.Command(os.Args[0])
+	_, err := execx.Run(context.Background(), cmd,
+		execx.Hermetic("HOME", "EXECX_UNSET"),
+		execx.WithEnv("EXECX_TEST", "on"),
+	)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	want := map[string]string{"HOME": "/nonexistent/home", "EXECX_TEST": "on"}
+	if !reflect.DeepEqual(map[string]string(ee.ChildEnv), want) {
+		t.Errorf("got env %v, want %v", ee.ChildEnv, want)
+	}
+	if got := ee.Fields()["hermetic"]; !reflect.DeepEqual(got, []string{"HOME", "EXECX_UNSET"}) {
+		t.Errorf("got hermetic detail %v", got)
+	}
+}
+
+func TestHermeticDefault(t *testing.T) {
+	t.Setenv("EXECX_LEAK", "leaked")
+
+	_, err := execx.Run(context.Background(), exec.Command(os.Args[0]),
+		execx.Hermetic(),
+		execx.WithEnv("EXECX_TEST", "on"),
+	)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	for k := range ee.ChildEnv {
+		switch k {
+		case "PATH", "HOME", "TMPDIR", "EXECX_TEST":
+		default:
+			t.Errorf("%s inherited in hermetic mode", k)
+		}
+	}
+}
+
+func TestHermeticInherited(t *testing.T) {
+	t.Setenv("EXECX_LEAK", "leaked")
+
+	_, err := execx.Run(context.Background(), selfCmd("on"), execx.Hermetic())
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+	var he *execx.HermeticError
+	if !errors.As(err, &he) {
+		t.Fatalf("got %v, want *HermeticError", err)
+	}
+	found := false
+	for _, k := range he.Inherited {
+		found = found || k == "EXECX_LEAK"
+		if k == "PATH" || k == "EXECX_TEST" {
+			t.Errorf("%s reported as inherited", k)
+		}
+	}
+	if !found {
+		t.Errorf("EXECX_LEAK not reported: got %q", he.Inherited)
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// historySchema creates the table used by History. The statements are
+// written for SQLite, but also work with most other SQL databases.
+var historySchema = []string{
+	`CREATE TABLE IF NOT EXISTS execx_history (
+		fingerprint TEXT NOT NULL,
+		tool        TEXT NOT NULL,
+		argv        TEXT NOT NULL,
+		dir         TEXT NOT NULL,
+		started_at  INTEGER NOT NULL,
+		duration    INTEGER NOT NULL,
+		exit_code   INTEGER NOT NULL,
+		error       TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS execx_history_tool ON execx_history (tool, started_at)`,
+	`CREATE INDEX IF NOT EXISTS execx_history_fingerprint ON execx_history (fingerprint, started_at)`,
+}
+
+// A History is a Runner which records every command it runs in a SQL
+// database, such that long-running programs which run commands frequently
+// can find out which commands are slow, or fail often. Each run is recorded
+// as a row holding its Fingerprint, its arguments, its working directory,
+// the time it started, its duration, its exit code, and its error, if any.
+//
+// History is designed for SQLite, but execx does not import a database
+// driver: the database is opened by the caller, using a driver of their
+// choice, such as
+//
+//	db, err := sql.Open("sqlite", "history.db")
+//	...
+//	h, err := execx.NewHistory(ctx, db)
+//	...
+//	ctx = execx.WithRunner(ctx, h)
+//
+// A History is safe for concurrent use by multiple goroutines, to the
+// extent the database is.
+type History struct {
+	// Runner runs the commands. If Runner is nil, Local is used.
+	Runner Runner
+
+	// OnError, if not nil, is called with errors encountered while
+	// recording runs. Such errors do not affect the outcome of the
+	// runs themselves.
+	OnError func(error)
+
+	// Sealer, if not nil, seals the arguments and the errors of the
+	// runs recorded, which may hold secrets. Fingerprints, tools and
+	// working directories are stored in plaintext, since the queries
+	// use them. Runs recorded without a Sealer can still be read.
+	Sealer *Sealer
+
+	db *sql.DB
+}
+
+// NewHistory returns a History which records runs in db, creating the
+// table it uses, named execx_history, if it does not exist.
+func NewHistory(ctx context.Context, db *sql.DB) (*History, error) {
+	for _, stmt := range historySchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &History{db: db}, nil
+}
+
+// A HistoryRun is a run recorded by a History.
+type HistoryRun struct {
+	// Fingerprint is the fingerprint of the command, as per Fingerprint.
+	Fingerprint string
+
+	// Tool is the base name of the command, such as "git".
+	Tool string
+
+	// Args holds the command line arguments, including the name of the
+	// command.
+	Args []string
+
+	// Dir is the working directory of the command.
+	Dir string
+
+	// Start is the time the command was started.
+	Start time.Time
+
+	// Duration is the time it took the command to complete.
+	Duration time.Duration
+
+	// ExitCode is the exit code of the command, or -1 if it was
+	// terminated by a signal, or failed to start.
+	ExitCode int
+
+	// Err is the message of the error the command failed with, or the
+	// empty string if it succeeded.
+	Err string
+}
+
+// Run runs cmd, and records it.
+func (h *History) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	r := h.Runner
+	if r == nil {
+		r = Local
+	}
+	run := HistoryRun{
+		Fingerprint: Fingerprint(cmd),
+		Tool:        filepath.Base(cmd.Path),
+		Args:        copyStrings(cmd.Args),
+		Start:       ClockFrom(ctx).Now(),
+		ExitCode:    -1,
+	}
+	run.Dir, _, _ = describe(cmd)
+	res, err := r.Run(ctx, cmd, opts...)
+	run.Duration = ClockFrom(ctx).Now().Sub(run.Start)
+	if res != nil {
+		run.ExitCode = res.ExitCode
+		if res.Dir != "" {
+			run.Dir = res.Dir
+		}
+	}
+	if err != nil {
+		run.Err = err.Error()
+	}
+	// Record the run even if ctx is done, since the run is most
+	// interesting then.
+	if rerr := h.record(context.Background(), &run); rerr != nil && h.OnError != nil {
+		h.OnError(rerr)
+	}
+	return res, err
+}
+
+// record inserts run into the database.
+func (h *History) record(ctx context.Context, run *HistoryRun) error {
+	argv, err := json.Marshal(run.Args)
+	if err != nil {
+		return err
+	}
+	_, err = h.db.ExecContext(ctx,
+		`INSERT INTO execx_history (fingerprint, tool, argv, dir, started_at, duration, exit_code, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.Fingerprint, run.Tool, h.seal(string(argv)), run.Dir, run.Start.UnixNano(), int64(run.Duration), run.ExitCode, h.seal(run.Err),
+	)
+	return err
+}
+
+// Slowest returns the n slowest runs recorded, slowest first.
+func (h *History) Slowest(ctx context.Context, n int) ([]HistoryRun, error) {
+	rows, err := h.db.QueryContext(ctx,
+		`SELECT fingerprint, tool, argv, dir, started_at, duration, exit_code, error FROM execx_history ORDER BY duration DESC LIMIT ?`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var runs []HistoryRun
+	for rows.Next() {
+		var (
+			run      HistoryRun
+			argv     string
+			start, d int64
+		)
+		if err := rows.Scan(&run.Fingerprint, &run.Tool, &argv, &run.Dir, &start, &d, &run.ExitCode, &run.Err); err != nil {
+			return nil, err
+		}
+		if argv, err = h.open(argv); err != nil {
+			return nil, err
+		}
+		if run.Err, err = h.open(run.Err); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(argv), &run.Args); err != nil {
+			return nil, err
+		}
+		run.Start = time.Unix(0, start)
+		run.Duration = time.Duration(d)
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// A FailureRate describes how often the runs of a tool failed.
+type FailureRate struct {
+	// Tool is the base name of the command, such as "git".
+	Tool string
+
+	// Runs is the number of recorded runs of the tool.
+	Runs int
+
+	// Failures is the number of runs which failed.
+	Failures int
+}
+
+// Rate returns the fraction of runs which failed.
+func (fr FailureRate) Rate() float64 {
+	if fr.Runs == 0 {
+		return 0
+	}
+	return float64(fr.Failures) / float64(fr.Runs)
+}
+
+// FailureRates returns the failure rates of the tools for which runs were
+// recorded since the specified time, or for all recorded runs if since is
+// the zero time, ordered by tool.
+func (h *History) FailureRates(ctx context.Context, since time.Time) ([]FailureRate, error) {
+	var after int64
+	if !since.IsZero() {
+		after = since.UnixNano()
+	}
+	rows, err := h.db.QueryContext(ctx,
+		`SELECT tool, COUNT(*), SUM(CASE WHEN error <> '' THEN 1 ELSE 0 END) FROM execx_history WHERE started_at >= ? GROUP BY tool ORDER BY tool`, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rates []FailureRate
+	for rows.Next() {
+		var fr FailureRate
+		if err := rows.Scan(&fr.Tool, &fr.Runs, &fr.Failures); err != nil {
+			return nil, err
+		}
+		rates = append(rates, fr)
+	}
+	return rates, rows.Err()
+}
+
+// LastSuccess returns the time the last successful run of the specified
+// tool started, or the zero time if no run of the tool succeeded.
+func (h *History) LastSuccess(ctx context.Context, tool string) (time.Time, error) {
+	var start sql.NullInt64
+	err := h.db.QueryRowContext(ctx,
+		`SELECT MAX(started_at) FROM execx_history WHERE tool = ? AND error = ''`, tool).Scan(&start)
+	if err != nil || !start.Valid {
+		return time.Time{}, err
+	}
+	return time.Unix(0, start.Int64), nil
+}
+
+// historyOutcome is the outcome of a recorded run.
+type historyOutcome struct {
+	fingerprint string
+	args        []string
+	failed      bool
+}
+
+// outcomes returns the outcomes of the runs with the specified fingerprint,
+// or of all runs, if fingerprint is empty, ordered by fingerprint, and most
+// recent first.
+func (h *History) outcomes(ctx context.Context, fingerprint string) ([]historyOutcome, error) {
+	query := `SELECT fingerprint, argv, error FROM execx_history ORDER BY fingerprint, started_at DESC`
+	var args []interface{}
+	if fingerprint != "" {
+		query = `SELECT fingerprint, argv, error FROM execx_history WHERE fingerprint = ? ORDER BY fingerprint, started_at DESC`
+		args = append(args, fingerprint)
+	}
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var outcomes []historyOutcome
+	for rows.Next() {
+		var (
+			o          historyOutcome
+			argv, rerr string
+		)
+		if err := rows.Scan(&o.fingerprint, &argv, &rerr); err != nil {
+			return nil, err
+		}
+		if argv, err = h.open(argv); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(argv), &o.args); err != nil {
+			return nil, err
+		}
+		o.failed = rerr != ""
+		outcomes = append(outcomes, o)
+	}
+	return outcomes, rows.Err()
+}
+
+// durations returns the durations of the n most recent successful runs
+// with the specified fingerprint.
+func (h *History) durations(ctx context.Context, fingerprint string, n int) ([]time.Duration, error) {
+	rows, err := h.db.QueryContext(ctx,
+		`SELECT duration FROM execx_history WHERE fingerprint = ? AND error = '' ORDER BY started_at DESC LIMIT ?`, fingerprint, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ds []time.Duration
+	for rows.Next() {
+		var d int64
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		ds = append(ds, time.Duration(d))
+	}
+	return ds, rows.Err()
+}
+
+// sealedPrefix marks sealed column values, which are stored as text.
+const sealedPrefix = "sealed:"
+
+// seal seals the value of a column, if h has a Sealer. Empty values are
+// not sealed, such that the queries can tell successful runs apart.
+func (h *History) seal(v string) string {
+	if h.Sealer == nil || v == "" {
+		return v
+	}
+	return sealedPrefix + base64.StdEncoding.EncodeToString(h.Sealer.Seal([]byte(v)))
+}
+
+// open opens a column value sealed by seal. Values which were not sealed
+// are returned as they are.
+func (h *History) open(v string) (string, error) {
+	if !strings.HasPrefix(v, sealedPrefix) {
+		return v, nil
+	}
+	if h.Sealer == nil {
+		return "", fmt.Errorf("%w: history: no Sealer configured", ErrSealed)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(v, sealedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("%w: history: %v", ErrSealed, err)
+	}
+	plaintext, err := h.Sealer.Open(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestHistory(t *testing.T) {
+	db := sql.OpenDB(new(historyDB))
+	defer db.Close()
+	h, err := execx.NewHistory(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.OnError = func(err error) { t.Error(err) }
+	ctx := execx.WithRunner(context.Background(), h)
+
+	before := time.Now()
+	if _, err := execx.Run(ctx, selfCmd("echo")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execx.Run(ctx, selfCmd("nap")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execx.Run(ctx, selfCmd("on")); err == nil {
+		t.Fatal("command did not fail")
+	}
+
+	slowest, err := h.Slowest(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slowest) != 1 || slowest[0].Fingerprint != execx.Fingerprint(selfCmd("nap")) {
+		t.Fatalf("got slowest %+v, want the nap", slowest)
+	}
+	run := slowest[0]
+	if run.ExitCode != 0 || run.Err != "" || run.Dir != mustGetwd(t) || run.Start.Before(before) || run.Duration < time.Second {
+		t.Errorf("got %+v", run)
+	}
+
+	rates, err := h.FailureRates(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 1 || rates[0].Runs != 3 || rates[0].Failures != 1 {
+		t.Fatalf("got failure rates %+v, want 1 of 3 runs failed", rates)
+	}
+	if rate := rates[0].Rate(); rate < 0.33 || rate > 0.34 {
+		t.Errorf("got rate %v, want 1/3", rate)
+	}
+
+	last, err := h.LastSuccess(context.Background(), rates[0].Tool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.Equal(run.Start) {
+		t.Errorf("got last success at %v, want %v", last, run.Start)
+	}
+	if last, err := h.LastSuccess(context.Background(), "nonexistent"); err != nil || !last.IsZero() {
+		t.Errorf("got %v, %v for unknown tool, want zero time", last, err)
+	}
+}
+
+// historyDB is a database/sql driver which understands just enough SQL
+// for History: it stores the rows inserted into execx_history, and
+// answers the queries History makes.
+type historyDB struct {
+	mu   sync.Mutex
+	rows [][]driver.Value
+}
+
+func (db *historyDB) Connect(context.Context) (driver.Conn, error) { return historyConn{db}, nil }
+func (db *historyDB) Driver() driver.Driver                        { return nil }
+
+type historyConn struct{ db *historyDB }
+
+func (c historyConn) Prepare(query string) (driver.Stmt, error) {
+	return historyStmt{db: c.db, query: query}, nil
+}
+func (c historyConn) Close() error              { return nil }
+func (c historyConn) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+type historyStmt struct {
+	db    *historyDB
+	query string
+}
+
+func (s historyStmt) Close() error  { return nil }
+func (s historyStmt) NumInput() int { return -1 }
+
+func (s historyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE"):
+	case strings.HasPrefix(s.query, "INSERT"):
+		s.db.rows = append(s.db.rows, args)
+	default:
+		return nil, errors.New("unsupported statement: " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// Columns of execx_history.
+const (
+	colFingerprint = 0
+	colTool        = 1
+	colArgv        = 2
+	colStarted     = 4
+	colDuration    = 5
+	colError       = 7
+)
+
+func (s historyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	// Most recent first.
+	var rows [][]driver.Value
+	for i := len(s.db.rows) - 1; i >= 0; i-- {
+		rows = append(rows, s.db.rows[i])
+	}
+	switch {
+	case strings.HasPrefix(s.query, "SELECT fingerprint, tool"):
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i][colDuration].(int64) > rows[j][colDuration].(int64)
+		})
+		if n := int(args[0].(int64)); len(rows) > n {
+			rows = rows[:n]
+		}
+		return &historyRows{rows: rows}, nil
+	case strings.HasPrefix(s.query, "SELECT tool, COUNT"):
+		counts := make(map[string][]driver.Value)
+		for _, row := range rows {
+			if row[colStarted].(int64) < args[0].(int64) {
+				continue
+			}
+			tool := row[colTool].(string)
+			c, ok := counts[tool]
+			if !ok {
+				c = []driver.Value{tool, int64(0), int64(0)}
+				counts[tool] = c
+			}
+			c[1] = c[1].(int64) + 1
+			if row[colError].(string) != "" {
+				c[2] = c[2].(int64) + 1
+			}
+		}
+		var out [][]driver.Value
+		for _, c := range counts {
+			out = append(out, c)
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i][0].(string) < out[j][0].(string) })
+		return &historyRows{rows: out}, nil
+	case strings.HasPrefix(s.query, "SELECT fingerprint, argv, error"):
+		var out [][]driver.Value
+		for _, row := range rows {
+			if len(args) == 0 || row[colFingerprint] == args[0] {
+				out = append(out, []driver.Value{row[colFingerprint], row[colArgv], row[colError]})
+			}
+		}
+		sort.SliceStable(out, func(i, j int) bool { return out[i][0].(string) < out[j][0].(string) })
+		return &historyRows{rows: out}, nil
+	case strings.HasPrefix(s.query, "SELECT duration"):
+		var out [][]driver.Value
+		for _, row := range rows {
+			if row[colFingerprint] == args[0] && row[colError] == "" && len(out) < int(args[1].(int64)) {
+				out = append(out, []driver.Value{row[colDuration]})
+			}
+		}
+		return &historyRows{rows: out}, nil
+	case strings.HasPrefix(s.query, "SELECT MAX"):
+		var max driver.Value
+		for _, row := range rows {
+			if row[colTool] != args[0] || row[colError].(string) != "" {
+				continue
+			}
+			if max == nil || row[colStarted].(int64) > max.(int64) {
+				max = row[colStarted]
+			}
+		}
+		return &historyRows{rows: [][]driver.Value{{max}}}, nil
+	}
+	return nil, errors.New("unsupported query: " + s.query)
+}
+
+type historyRows struct {
+	rows [][]driver.Value
+}
+
+func (r *historyRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return make([]string, 8)
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *historyRows) Close() error { return nil }
+
+func (r *historyRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
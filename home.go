@@ -0,0 +1,212 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// HomeCleanup is a policy for removing the home directory created by
+// IsolatedHome.
+type HomeCleanup int
+
+// Cleanup policies.
+const (
+	// CleanupAlways removes the home directory once the command
+	// completes.
+	CleanupAlways HomeCleanup = iota
+
+	// CleanupOnSuccess removes the home directory if the command
+	// succeeds, and keeps it for inspection if the command fails.
+	CleanupOnSuccess
+
+	// CleanupNever keeps the home directory. Callers are responsible
+	// for removing it.
+	CleanupNever
+)
+
+// isolatedDirs lists the variables pointed at the isolated home directory
+// by IsolatedHome, and the paths relative to it.
+var isolatedDirs = []struct {
+	key, dir string
+}{
+	{"HOME", "."},
+	{"XDG_CONFIG_HOME", ".config"},
+	{"XDG_CACHE_HOME", ".cache"},
+	{"XDG_DATA_HOME", filepath.Join(".local", "share")},
+	{"XDG_STATE_HOME", filepath.Join(".local", "state")},
+}
+
+// isolatedDirsWindows lists the additional variables used on Windows.
+var isolatedDirsWindows = []struct {
+	key, dir string
+}{
+	{"USERPROFILE", "."},
+	{"APPDATA", filepath.Join("AppData", "Roaming")},
+	{"LOCALAPPDATA", filepath.Join("AppData", "Local")},
+}
+
+// IsolatedHome runs the command with a fresh, empty home directory, such
+// that it cannot read, or modify, the configuration and caches of the
+// user running the current process. HOME, XDG_CONFIG_HOME, XDG_CACHE_HOME,
+// XDG_DATA_HOME and XDG_STATE_HOME, as well as USERPROFILE, APPDATA and
+// LOCALAPPDATA on Windows, point into a new temporary directory. Variables
+// set using WithEnv take precedence.
+//
+// By default, the directory is removed once the command completes. Use
+// WithHomeCleanup to keep it. The directory, and the files the command
+// created in it, are recorded in Result.Home, and as a detail named
+// "isolated_home" in errors produced by the command.
+func IsolatedHome() Option {
+	src := envCaller(EnvIsolated)
+	return func(cfg *config) {
+		cfg.isolatedHome = true
+		cfg.isolatedHomeSrc = src
+	}
+}
+
+// WithHomeCleanup sets the policy for removing the home directory created
+// by IsolatedHome.
+func WithHomeCleanup(c HomeCleanup) Option {
+	return func(cfg *config) {
+		cfg.homeCleanup = c
+	}
+}
+
+// A HomeDir describes the home directory created by IsolatedHome.
+type HomeDir struct {
+	// Path is the path of the directory.
+	Path string
+
+	// Files holds the paths of the files and directories created by
+	// the command, relative to Path, and using forward slashes.
+	// Directories end in a slash.
+	Files []string
+
+	// Removed is true if the directory was removed.
+	Removed bool
+}
+
+// String returns a description of d, such as
+//
+//	/tmp/execx-home-123 (removed), files: .config/tool/config.toml
+func (d *HomeDir) String() string {
+	var sb strings.Builder
+	sb.WriteString(d.Path)
+	if d.Removed {
+		sb.WriteString(" (removed)")
+	}
+	if len(d.Files) == 0 {
+		sb.WriteString(", no files created")
+	} else {
+		fmt.Fprintf(&sb, ", files: %s", strings.Join(d.Files, " "))
+	}
+	return sb.String()
+}
+
+// isolateHome creates the home directory for IsolatedHome, and points the
+// environment of the command at it.
+func (h *Handle) isolateHome() error {
+	root, err := ioutil.TempDir("", "execx-home-")
+	if err != nil {
+		return wrapStart(err, h.cmd, h.cfg.collectors)
+	}
+	h.home = &HomeDir{Path: root}
+	h.homeRes = h.tracker.Track("home", root, func() error { return os.RemoveAll(root) })
+	dirs := isolatedDirs
+	if runtime.GOOS == "windows" {
+		dirs = append(dirs[:len(dirs):len(dirs)], isolatedDirsWindows...)
+	}
+	src := h.cfg.isolatedHomeSrc
+	for _, d := range dirs {
+		path := filepath.Join(root, d.dir)
+		if err := os.MkdirAll(path, 0700); err != nil {
+			h.removeHome()
+			return wrapStart(err, h.cmd, h.cfg.collectors)
+		}
+		h.cfg.env = append([]envSetting{{key: d.key, value: path, src: src}}, h.cfg.env...)
+	}
+	if id := h.identity; id != nil {
+		// The command runs as another user, who must own the directory.
+		err := filepath.Walk(root, func(path string, _ os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Chown(path, int(id.UID), int(id.GID))
+		})
+		if err != nil {
+			h.removeHome()
+			return wrapStart(err, h.cmd, h.cfg.collectors)
+		}
+	}
+	return nil
+}
+
+// collectHome lists the files created in the isolated home directory, if
+// any, and removes it, as per the cleanup policy. It is called once the
+// command has completed.
+func (h *Handle) collectHome(failed bool) *HomeDir {
+	if h.home == nil {
+		return nil
+	}
+	created := make(map[string]bool)
+	for _, d := range isolatedDirs {
+		created[d.dir] = true
+	}
+	for _, d := range isolatedDirsWindows {
+		created[d.dir] = true
+	}
+	created[".local"], created["AppData"] = true, true
+	root := h.home.Path
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || created[rel] {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			rel += "/"
+		}
+		h.home.Files = append(h.home.Files, rel)
+		return nil
+	})
+	switch {
+	case h.cfg.homeCleanup == CleanupAlways:
+		h.removeHome()
+	case h.cfg.homeCleanup == CleanupOnSuccess && !failed:
+		h.removeHome()
+	default:
+		h.homeRes.Keep()
+	}
+	return h.home
+}
+
+// removeHome removes the isolated home directory, if any.
+func (h *Handle) removeHome() {
+	if h.home == nil {
+		return
+	}
+	if h.homeRes.Release() == nil {
+		h.home.Removed = true
+	}
+}
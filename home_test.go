@@ -0,0 +1,83 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestIsolatedHome(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("home"), execx.IsolatedHome())
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	home := ee.Result.Home
+	if home == nil {
+		t.Fatal("no home directory in Result")
+	}
+	if got := string(ee.Result.Stdout); got != home.Path {
+		t.Errorf("child saw HOME=%q, want %q", got, home.Path)
+	}
+	if got, want := strings.Join(home.Files, " "), ".config/tool/ .config/tool/config.toml"; got != want {
+		t.Errorf("got files %q, want %q", got, want)
+	}
+	if !home.Removed {
+		t.Error("home directory not removed")
+	}
+	if _, err := os.Stat(home.Path); !os.IsNotExist(err) {
+		t.Errorf("home directory still exists: %v", err)
+	}
+	if src := ee.EnvSources["HOME"]; src.Origin != execx.EnvIsolated {
+		t.Errorf("got HOME origin %v", src)
+	}
+	if s := fmt.Sprintf("%+v", err); !strings.Contains(s, "isolated_home: ") || !strings.Contains(s, "config.toml") {
+		t.Errorf("%%+v does not list created files:\n%s", s)
+	}
+}
+
+func TestIsolatedHomeCleanup(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("home"), execx.IsolatedHome(), execx.WithHomeCleanup(execx.CleanupOnSuccess))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	home := ee.Result.Home
+	defer os.RemoveAll(home.Path)
+	if home.Removed {
+		t.Error("home directory removed after failure")
+	}
+	if _, err := os.Stat(home.Path); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsolatedHomeWithEnv(t *testing.T) {
+	dir := tempDir(t)
+	res, err := execx.Run(context.Background(), selfCmd("home"), execx.IsolatedHome(), execx.WithEnv("HOME", dir), execx.WithAllowedExitCodes(1))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if got := string(res.Stdout); got != dir {
+		t.Errorf("child saw HOME=%q, want %q", got, dir)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Host is a machine on which FanOut runs commands.
+type Host struct {
+	// Name identifies the host in HostResults. It replaces occurrences
+	// of "{host}" in the arguments of the commands run on the host.
+	Name string
+
+	// Runner runs commands on the host, such as a *remote.Client from
+	// package acln.ro/execx/remote. If Runner is nil, commands are run
+	// using the runner carried by the context passed to FanOut.
+	Runner Runner
+
+	// MaxConcurrent, if positive, bounds the number of commands which
+	// run on the host at once, across all calls to FanOut which use the
+	// same *Host. Commands wait for a slot, or for the context to be
+	// done.
+	MaxConcurrent int
+
+	once sync.Once
+	sem  chan struct{}
+}
+
+// acquire waits for a slot to run a command on h, or for ctx to be done.
+func (h *Host) acquire(ctx context.Context) error {
+	if h.MaxConcurrent <= 0 {
+		return nil
+	}
+	h.once.Do(func() { h.sem = make(chan struct{}, h.MaxConcurrent) })
+	select {
+	case h.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release releases a slot acquired using acquire.
+func (h *Host) release() {
+	if h.MaxConcurrent > 0 {
+		<-h.sem
+	}
+}
+
+// A HostResult is the outcome of a command run on a host by FanOut.
+type HostResult struct {
+	// Result describes the run, as returned by the runner of the host.
+	// It is nil if the command did not run to completion.
+	Result *Result
+
+	// Err is the error the command failed with, if any, such as an
+	// *ExitError.
+	Err error
+}
+
+// HostResults holds the outcomes of a command run by FanOut, by host name.
+type HostResults map[string]HostResult
+
+// Failed returns the names of the hosts on which the command failed, in
+// lexical order.
+func (hr HostResults) Failed() []string {
+	var failed []string
+	for name, r := range hr {
+		if r.Err != nil {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// FailuresByCause groups the hosts on which the command failed by the
+// cause of the failure: the exit code, or the signal which terminated the
+// command, followed by the first line of its standard error, for an
+// *ExitError, as per ExitError.Summary, or the error message otherwise.
+// Hosts are listed in lexical order.
+func (hr HostResults) FailuresByCause() map[string][]string {
+	causes := make(map[string][]string)
+	for _, name := range hr.Failed() {
+		cause := failureCause(hr[name].Err)
+		causes[cause] = append(causes[cause], name)
+	}
+	return causes
+}
+
+// Summary describes the failures of the command, grouped by cause, such
+// as
+//
+//	2 of 5 hosts failed:
+//		exit 1: disk full: db1, db2
+//
+// Causes shared by more hosts are listed first. If the command succeeded
+// on every host, Summary returns a line saying so.
+func (hr HostResults) Summary() string {
+	failed := hr.Failed()
+	if len(failed) == 0 {
+		return fmt.Sprintf("all %d hosts succeeded", len(hr))
+	}
+	causes := hr.FailuresByCause()
+	keys := make([]string, 0, len(causes))
+	for cause := range causes {
+		keys = append(keys, cause)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ni, nj := len(causes[keys[i]]), len(causes[keys[j]]); ni != nj {
+			return ni > nj
+		}
+		return keys[i] < keys[j]
+	})
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d of %d hosts failed:", len(failed), len(hr))
+	for _, cause := range keys {
+		fmt.Fprintf(&sb, "\n\t%s: %s", cause, strings.Join(causes[cause], ", "))
+	}
+	return sb.String()
+}
+
+// Err returns nil if the command succeeded on every host, or a
+// *FanOutError describing the failures otherwise.
+func (hr HostResults) Err() error {
+	failed := hr.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	e := &FanOutError{Hosts: failed, Results: hr}
+	for _, name := range failed {
+		e.Errs = append(e.Errs, hr[name].Err)
+	}
+	return e
+}
+
+// failureCause describes the cause of err, for FailuresByCause.
+func failureCause(err error) string {
+	var ee *ExitError
+	if !errors.As(err, &ee) {
+		return err.Error()
+	}
+	var sb strings.Builder
+	if code := ee.ExitCode(); code >= 0 || !ee.hasState() {
+		sb.WriteString("exit ")
+		sb.WriteString(strconv.Itoa(code))
+	} else {
+		sb.WriteString(ee.Error())
+	}
+	if line := firstLine(ee.stderr()); line != "" {
+		sb.WriteString(": ")
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// FanOutError records the failures of a command run by FanOut.
+type FanOutError struct {
+	// Hosts holds the names of the hosts on which the command failed,
+	// in lexical order.
+	Hosts []string
+
+	// Errs holds the error the command failed with on each host, in
+	// the same order.
+	Errs []error
+
+	// Results holds the outcomes on all hosts.
+	Results HostResults
+}
+
+func (e *FanOutError) Error() string {
+	return "execx: " + e.Results.Summary()
+}
+
+// Unwrap returns e.Errs, such that errors.Is, errors.As and AllExitErrors
+// can inspect the failure on each host.
+func (e *FanOutError) Unwrap() []error {
+	return e.Errs
+}
+
+// FanOut runs a clone of tmpl on each of hosts concurrently, using the
+// runner of each host, and returns the outcome on each host, by name.
+// Occurrences of "{host}" in the arguments of tmpl are replaced by the
+// name of the host. opts apply to every command. Standard I/O of tmpl is
+// not copied, as per Clone: output is captured into the Result of each
+// host.
+//
+// Commands wait for a slot on hosts which limit the number of commands
+// they run at once. If ctx is done before a command starts, its host
+// fails with the error of the context. FanOut returns once the command
+// completed on every host. Use HostResults.Err to check for failures.
+//
+// Host names must be unique. FanOut panics otherwise.
+func FanOut(ctx context.Context, hosts []*Host, tmpl *exec.Cmd, opts ...Option) HostResults {
+	results := make(HostResults, len(hosts))
+	for _, h := range hosts {
+		if _, ok := results[h.Name]; ok {
+			panic("execx: FanOut: duplicate host " + strconv.Quote(h.Name))
+		}
+		results[h.Name] = HostResult{}
+	}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, h := range hosts {
+		wg.Add(1)
+		go func(h *Host) {
+			defer wg.Done()
+			res, err := h.run(ctx, tmpl, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			results[h.Name] = HostResult{Result: res, Err: err}
+		}(h)
+	}
+	wg.Wait()
+	return results
+}
+
+// run runs a clone of tmpl on h.
+func (h *Host) run(ctx context.Context, tmpl *exec.Cmd, opts []Option) (*Result, error) {
+	if err := h.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer h.release()
+	cmd := Clone(tmpl)
+	for i, arg := range cmd.Args {
+		cmd.Args[i] = strings.ReplaceAll(arg, "{host}", h.Name)
+	}
+	r := h.Runner
+	if r == nil {
+		r = RunnerFrom(ctx)
+	}
+	return r.Run(ctx, cmd, opts...)
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestFanOut(t *testing.T) {
+	var got []string
+	fake := execx.RunnerFunc(func(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+		got = cmd.Args
+		return &execx.Result{Args: cmd.Args}, nil
+	})
+	hosts := []*execx.Host{{Name: "a"}, {Name: "b"}, {Name: "c", Runner: fake}}
+	tmpl := selfCmd("on")
+	tmpl.Args = append(tmpl.Args, "--host={host}")
+	results := execx.FanOut(context.Background(), hosts, tmpl)
+
+	if want := []string{tmpl.Args[0], "--host=c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("host c ran %q, want %q", got, want)
+	}
+	if tmpl.Args[1] != "--host={host}" {
+		t.Errorf("template modified: %q", tmpl.Args)
+	}
+	if failed := results.Failed(); !reflect.DeepEqual(failed, []string{"a", "b"}) {
+		t.Errorf("Failed() = %q, want %q", failed, []string{"a", "b"})
+	}
+	want := map[string][]string{"exit 1: whoops": {"a", "b"}}
+	if causes := results.FailuresByCause(); !reflect.DeepEqual(causes, want) {
+		t.Errorf("FailuresByCause() = %q, want %q", causes, want)
+	}
+	if got, want := results.Summary(), "2 of 3 hosts failed:\n\texit 1: whoops: a, b"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+	err := results.Err()
+	var foe *execx.FanOutError
+	if !errors.As(err, &foe) {
+		t.Fatalf("got %v, want *FanOutError", err)
+	}
+	if n := len(execx.AllExitErrors(err)); n != 2 {
+		t.Errorf("got %d exit errors, want 2", n)
+	}
+}
+
+func TestFanOutMaxConcurrent(t *testing.T) {
+	var running, peak int32
+	slow := execx.RunnerFunc(func(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return &execx.Result{}, nil
+	})
+	host := &execx.Host{Name: "a", Runner: slow, MaxConcurrent: 1}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := execx.FanOut(context.Background(), []*execx.Host{host}, exec.Command("true")).Err(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak != 1 {
+		t.Errorf("got %d concurrent commands, want 1", peak)
+	}
+}
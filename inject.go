@@ -0,0 +1,175 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// An Injection is a flag which a wrapper tool injects into the arguments
+// it passes through to the tool it wraps.
+type Injection struct {
+	// Args holds the flag, such as "--no-pager", followed by its values,
+	// if any. Flags of the form "--flag=value" are also accepted.
+	Args []string
+
+	// Override, if true, removes occurrences of the flag from the user's
+	// arguments, so that the injected value takes effect. Otherwise,
+	// the flag is not injected if the user specified it.
+	Override bool
+
+	// Repeatable marks flags which may be specified multiple times, such
+	// as git's -c. Repeatable flags are only considered to be specified
+	// by the user if the user specified the same flag and values. They
+	// are never removed by Override.
+	Repeatable bool
+
+	// First, if true, inserts the flag before the user's arguments, as
+	// is needed for global flags, which precede a subcommand. Otherwise,
+	// the flag is inserted after the user's flags, before the first "--"
+	// argument, if any.
+	First bool
+}
+
+// flag returns the name of the injected flag, without its value.
+func (inj Injection) flag() string {
+	name, _, _ := strings.Cut(inj.Args[0], "=")
+	return name
+}
+
+// matches reports whether args[i] specifies the injected flag, and if so,
+// how many arguments the occurrence spans.
+func (inj Injection) matches(args []string, i int) (n int, ok bool) {
+	if inj.Repeatable {
+		if i+len(inj.Args) > len(args) {
+			return 0, false
+		}
+		for j, arg := range inj.Args {
+			if args[i+j] != arg {
+				return 0, false
+			}
+		}
+		return len(inj.Args), true
+	}
+	name := inj.flag()
+	switch {
+	case args[i] == name:
+		n = len(inj.Args)
+		if strings.Contains(inj.Args[0], "=") {
+			n = 1
+		}
+		if i+n > len(args) {
+			n = len(args) - i
+		}
+		return n, true
+	case strings.HasPrefix(args[i], name+"="):
+		return 1, true
+	}
+	return 0, false
+}
+
+// InjectArgs injects flags into args, the arguments of a command which
+// are passed through from the user, not including the name of the program,
+// and returns the resulting arguments, as well as the arguments which were
+// injected. Only the user's arguments which precede the first "--" are
+// considered to be flags: arguments following "--" are never inspected
+// or removed, and flags are never inserted after it.
+//
+// For example, a git wrapper could use
+//
+//	InjectArgs(userArgs,
+//		Injection{Args: []string{"--no-pager"}, First: true},
+//		Injection{Args: []string{"-c", "color.ui=never"}, Repeatable: true, First: true},
+//	)
+//
+// to disable the pager and colors, unless the user asks for colors.
+func InjectArgs(args []string, injections ...Injection) (result, injected []string) {
+	end := len(args)
+	for i, arg := range args {
+		if arg == "--" {
+			end = i
+			break
+		}
+	}
+	flags, rest := copyStrings(args[:end]), args[end:]
+	var first, last []string
+	for _, inj := range injections {
+		if len(inj.Args) == 0 {
+			continue
+		}
+		specified := false
+		kept := flags[:0:0]
+		for i := 0; i < len(flags); {
+			n, ok := inj.matches(flags, i)
+			if !ok {
+				kept = append(kept, flags[i])
+				i++
+				continue
+			}
+			specified = true
+			if inj.Override && !inj.Repeatable {
+				i += n
+				continue
+			}
+			kept = append(kept, flags[i:i+n]...)
+			i += n
+		}
+		flags = kept
+		if specified && !(inj.Override && !inj.Repeatable) {
+			continue
+		}
+		if inj.First {
+			first = append(first, inj.Args...)
+		} else {
+			last = append(last, inj.Args...)
+		}
+		injected = append(injected, inj.Args...)
+	}
+	result = append(result, first...)
+	result = append(result, flags...)
+	result = append(result, last...)
+	result = append(result, rest...)
+	return result, injected
+}
+
+// WithInjectedArgs injects flags into the arguments of the command before
+// it starts, as per InjectArgs, treating cmd.Args[1:] as the arguments
+// passed through from the user. It is intended for tools which wrap other
+// tools. The injected arguments are recorded as a detail named
+// "injected_args" in errors produced by the command, such that they can
+// be told apart from the arguments the user specified.
+func WithInjectedArgs(injections ...Injection) Option {
+	return func(cfg *config) {
+		cfg.injections = append(cfg.injections, injections...)
+	}
+}
+
+// applyInjections injects the configured flags into the arguments of h.cmd.
+func (h *Handle) applyInjections() {
+	cmd := h.cmd
+	if len(cmd.Args) == 0 {
+		return
+	}
+	args, injected := InjectArgs(cmd.Args[1:], h.cfg.injections...)
+	cmd.Args = append(cmd.Args[:1:1], args...)
+	if len(injected) == 0 {
+		return
+	}
+	h.cfg.collectors = append(h.cfg.collectors, CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "injected_args", injected
+	}))
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestInjectArgs(t *testing.T) {
+	noPager := execx.Injection{Args: []string{"--no-pager"}, First: true}
+	color := execx.Injection{Args: []string{"-c", "color.ui=never"}, Repeatable: true, First: true}
+	format := execx.Injection{Args: []string{"--format", "json"}, Override: true}
+	level := execx.Injection{Args: []string{"--level=info"}}
+
+	tests := []struct {
+		name         string
+		args         []string
+		injections   []execx.Injection
+		want         []string
+		wantInjected []string
+	}{
+		{
+			name:         "First",
+			args:         []string{"log", "-n", "1"},
+			injections:   []execx.Injection{noPager, color},
+			want:         []string{"--no-pager", "-c", "color.ui=never", "log", "-n", "1"},
+			wantInjected: []string{"--no-pager", "-c", "color.ui=never"},
+		},
+		{
+			name:         "Dedup",
+			args:         []string{"--no-pager", "-c", "color.ui=never", "log"},
+			injections:   []execx.Injection{noPager, color},
+			want:         []string{"--no-pager", "-c", "color.ui=never", "log"},
+			wantInjected: nil,
+		},
+		{
+			name:         "Repeatable",
+			args:         []string{"-c", "user.name=x", "log"},
+			injections:   []execx.Injection{color},
+			want:         []string{"-c", "color.ui=never", "-c", "user.name=x", "log"},
+			wantInjected: []string{"-c", "color.ui=never"},
+		},
+		{
+			name:         "BeforeSeparator",
+			args:         []string{"run", "-v", "--", "--format", "text"},
+			injections:   []execx.Injection{format, level},
+			want:         []string{"run", "-v", "--format", "json", "--level=info", "--", "--format", "text"},
+			wantInjected: []string{"--format", "json", "--level=info"},
+		},
+		{
+			name:         "Override",
+			args:         []string{"--format", "text", "run", "--format=yaml"},
+			injections:   []execx.Injection{format},
+			want:         []string{"run", "--format", "json"},
+			wantInjected: []string{"--format", "json"},
+		},
+		{
+			name:         "UserWins",
+			args:         []string{"run", "--level", "debug"},
+			injections:   []execx.Injection{level},
+			want:         []string{"run", "--level", "debug"},
+			wantInjected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, injected := execx.InjectArgs(tt.args, tt.injections...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got args %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(injected, tt.wantInjected) {
+				t.Errorf("got injected %q, want %q", injected, tt.wantInjected)
+			}
+		})
+	}
+}
+
+func TestWithInjectedArgs(t *testing.T) {
+	cmd := selfCmd("on")
+	cmd.Args = append(cmd.Args, "-user")
+	_, err := execx.Run(context.Background(), cmd,
+		execx.WithInjectedArgs(execx.Injection{Args: []string{"-injected"}}),
+	)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if want := []string{cmd.Args[0], "-user", "-injected"}; !reflect.DeepEqual(ee.Args, want) {
+		t.Errorf("got args %q, want %q", ee.Args, want)
+	}
+	var injected interface{}
+	for _, d := range ee.Details {
+		if d.Key == "injected_args" {
+			injected = d.Value
+		}
+	}
+	if want := []string{"-injected"}; !reflect.DeepEqual(injected, want) {
+		t.Errorf("got injected_args %v, want %q", injected, want)
+	}
+}
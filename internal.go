@@ -0,0 +1,121 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// An InternalError describes a panic in a goroutine which this package
+// runs on behalf of a command, such as the goroutines which copy the
+// output of the command to the writers of the caller, or which watch its
+// context. Such panics are recovered, rather than crash the program.
+//
+// They are recorded in Result.InternalErrors, and the command fails with
+// the first *InternalError, unless it failed otherwise, in which case the
+// *ExitError carries them as a detail named "internal_errors". Panics in
+// writers passed to WithStdoutWriters or WithStderrWriters are isolated
+// like other writer errors instead, and recorded in Result.WriterErrors.
+type InternalError struct {
+	// Op describes what the goroutine was doing, such as "copy stdout".
+	Op string
+
+	// Cmdline is the command line of the command, as per Cmdline.
+	Cmdline string
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine which panicked.
+	Stack string
+}
+
+func (e *InternalError) Error() string {
+	return fmt.Sprintf("execx: %s: %s: panic: %v", e.Cmdline, e.Op, e.Value)
+}
+
+// Unwrap returns e.Value, if it is an error.
+func (e *InternalError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+var internalErrorHandler atomic.Value // func(*InternalError)
+
+func init() {
+	internalErrorHandler.Store((func(*InternalError))(nil))
+}
+
+// SetInternalErrorHandler sets a function which is called with every
+// *InternalError from then on, such that programs can log or count such
+// failures as they occur, rather than when the command completes. f is
+// called from the goroutine which panicked, once the panic is recovered,
+// and must not block. If f is nil, internal errors are only reported
+// as part of the results of commands, which is the default.
+// SetInternalErrorHandler is safe to call from multiple goroutines
+// concurrently.
+func SetInternalErrorHandler(f func(*InternalError)) {
+	internalErrorHandler.Store(f)
+}
+
+// internalErrors collects the internal errors of a command.
+type internalErrors struct {
+	cmdline string
+
+	mu   sync.Mutex
+	errs []*InternalError
+}
+
+func newInternalErrors(cmdline string) *internalErrors {
+	return &internalErrors{cmdline: cmdline}
+}
+
+// catch recovers a panic in a goroutine doing op, and records it. catch
+// must be deferred directly.
+func (ie *internalErrors) catch(op string) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	err := ie.report(op, v)
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+	ie.errs = append(ie.errs, err)
+}
+
+// report describes the panic of a goroutine doing op with v, and passes
+// the description to the handler set by SetInternalErrorHandler.
+func (ie *internalErrors) report(op string, v interface{}) *InternalError {
+	err := &InternalError{
+		Op:      op,
+		Cmdline: ie.cmdline,
+		Value:   v,
+		Stack:   string(debug.Stack()),
+	}
+	if f := internalErrorHandler.Load().(func(*InternalError)); f != nil {
+		f(err)
+	}
+	return err
+}
+
+// list returns the internal errors recorded so far.
+func (ie *internalErrors) list() []*InternalError {
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+	return append([]*InternalError(nil), ie.errs...)
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+type panicWriter struct{}
+
+func (panicWriter) Write(p []byte) (int, error) {
+	panic("boom")
+}
+
+func TestInternalErrorStdout(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		observed []*execx.InternalError
+	)
+	execx.SetInternalErrorHandler(func(err *execx.InternalError) {
+		mu.Lock()
+		defer mu.Unlock()
+		observed = append(observed, err)
+	})
+	defer execx.SetInternalErrorHandler(nil)
+
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("hello")
+	cmd.Stdout = panicWriter{}
+	res, err := execx.Run(context.Background(), cmd)
+	var ie *execx.InternalError
+	if !errors.As(err, &ie) {
+		t.Fatalf("got %v, want *InternalError", err)
+	}
+	if ie.Op != "copy stdout" || ie.Value != "boom" || !strings.Contains(ie.Stack, "panicWriter") {
+		t.Errorf("got %q, %v, want %q, %q, with a stack trace", ie.Op, ie.Value, "copy stdout", "boom")
+	}
+	if len(res.InternalErrors) != 1 || res.InternalErrors[0] != ie {
+		t.Errorf("Result.InternalErrors = %v", res.InternalErrors)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(observed) != 1 || observed[0] != ie {
+		t.Errorf("handler observed %v, want %v", observed, ie)
+	}
+}
+
+func TestInternalErrorDetail(t *testing.T) {
+	cmd := selfCmd("on")
+	cmd.Stderr = panicWriter{}
+	_, err := execx.Run(context.Background(), cmd)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	v, _ := ee.Detail("internal_errors")
+	if errs, _ := v.([]*execx.InternalError); len(errs) != 1 || errs[0].Op != "copy stderr" {
+		t.Errorf("internal_errors = %v", v)
+	}
+}
+
+func TestInternalErrorWriter(t *testing.T) {
+	var buf bytes.Buffer
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("hello")
+	cmd.Stdout = &buf
+	res, err := execx.Run(context.Background(), cmd, execx.WithStdoutWriters(panicWriter{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "hello" {
+		t.Errorf("got %q, want %q", buf.String(), "hello")
+	}
+	var ie *execx.InternalError
+	if len(res.WriterErrors) != 1 || !errors.As(res.WriterErrors[0], &ie) || ie.Op != "stdout writer 0" {
+		t.Errorf("WriterErrors = %v", res.WriterErrors)
+	}
+}
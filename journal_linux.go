@@ -0,0 +1,86 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// journalSink forwards output to journald, using its native protocol.
+type journalSink struct {
+	conn *net.UnixConn
+	r    *JournalRange
+}
+
+func dialJournal(socket string, r *JournalRange) (logSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalSink{conn: conn, r: r}, nil
+}
+
+func (s *journalSink) log(stream string, line []byte) error {
+	priority := "6"
+	if stream == "stderr" {
+		priority = "4"
+	}
+	buf := new(bytes.Buffer)
+	field := func(key, value string) {
+		buf.WriteString(key + "=" + value + "\n")
+	}
+	field("PRIORITY", priority)
+	field("SYSLOG_IDENTIFIER", s.r.Identifier)
+	field("EXECX_INVOCATION_ID", s.r.InvocationID)
+	field("EXECX_STREAM", stream)
+	// The message may contain arbitrary bytes, so it is written in the
+	// binary-safe form: the key, a newline, the length of the value as
+	// a little endian uint64, the value, and a newline.
+	buf.WriteString("MESSAGE\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(line)))
+	buf.Write(line)
+	buf.WriteByte('\n')
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+func (s *journalSink) Close() error {
+	return s.conn.Close()
+}
+
+// journalCursor returns the cursor of the last entry in the journal, or
+// the empty string if it cannot be determined.
+func journalCursor() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "journalctl", "--quiet", "--no-pager", "--lines=1", "--output=export").Output()
+	if err != nil {
+		return ""
+	}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if cursor := strings.TrimPrefix(sc.Text(), "__CURSOR="); cursor != sc.Text() {
+			return cursor
+		}
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWithJournal(t *testing.T) {
+	addr := filepath.Join(tempDir(t), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer conn.Close()
+
+	cmd := selfCmd("on")
+	_, err = execx.Run(context.Background(), cmd, execx.WithJournal(addr))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	r := ee.Result.Journal
+	if r == nil {
+		t.Fatal("journal range not recorded")
+	}
+	if r.Identifier != filepath.Base(cmd.Path) || len(r.InvocationID) != 32 {
+		t.Errorf("got %+v", r)
+	}
+	if r.After != "" || r.Until != "" {
+		t.Errorf("cursors recorded for a custom socket: %+v", r)
+	}
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := parseJournalEntry(t, buf[:n])
+	want := map[string]string{
+		"PRIORITY":            "4",
+		"SYSLOG_IDENTIFIER":   r.Identifier,
+		"EXECX_INVOCATION_ID": r.InvocationID,
+		"EXECX_STREAM":        "stderr",
+		"MESSAGE":             "whoops",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %q, want %q", k, fields[k], v)
+		}
+	}
+	args := strings.Join(r.Args(), " ")
+	if !strings.Contains(args, "EXECX_INVOCATION_ID="+r.InvocationID) {
+		t.Errorf("journalctl arguments %q do not select the invocation", args)
+	}
+}
+
+// parseJournalEntry parses a datagram in the native journald protocol.
+func parseJournalEntry(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		i := bytes.IndexAny(b, "=\n")
+		if i < 0 {
+			t.Fatalf("malformed entry %q", b)
+		}
+		key := string(b[:i])
+		if b[i] == '=' {
+			j := bytes.IndexByte(b, '\n')
+			fields[key] = string(b[i+1 : j])
+			b = b[j+1:]
+			continue
+		}
+		b = b[i+1:]
+		n := binary.LittleEndian.Uint64(b)
+		fields[key] = string(b[8 : 8+n])
+		b = b[8+n+1:]
+	}
+	return fields
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WriteJUnit writes the steps recorded by r to w as a JUnit XML report,
+// with a single test suite named suite, in which each command is a test
+// case. Commands which fail with an *ExitError are reported as failures,
+// and commands which fail otherwise, such as those which could not be
+// started, are reported as errors. Captured standard output and standard
+// error are reported as system-out and system-err.
+//
+// Reports in this format are understood by most CI systems, which display
+// the commands run by a pipeline, and their failures.
+func (r *Recorder) WriteJUnit(w io.Writer, suite string) error {
+	ts := &junitSuite{Name: suite}
+	for _, s := range r.Steps() {
+		tc := newJUnitCase(quoteArgs(s.Args), s.Result, s.Err)
+		tc.ClassName = suite
+		ts.add(tc, s.Start, s.Duration)
+	}
+	return writeJUnit(w, ts)
+}
+
+// WriteJUnit writes the outcome of a run of p, as returned by p.Run, to w
+// as a JUnit XML report, with a single test suite named suite, in which
+// each task is a test case, in the order in which tasks were declared.
+// Tasks are reported as per Recorder.WriteJUnit. Tasks which were skipped
+// because their dependencies failed are reported as skipped.
+func (p *Plan) WriteJUnit(w io.Writer, suite string, results map[string]*Result, err error) error {
+	var perr *PlanError
+	errors.As(err, &perr)
+	skipped := make(map[string]bool)
+	if perr != nil {
+		for _, name := range perr.Skipped {
+			skipped[name] = true
+		}
+	}
+	ts := &junitSuite{Name: suite}
+	for _, t := range p.Tasks {
+		var terr error
+		if perr != nil {
+			terr = perr.Errs[t.Name]
+		}
+		res := results[t.Name]
+		tc := newJUnitCase(t.Name, res, terr)
+		tc.ClassName = suite
+		var (
+			start time.Time
+			d     time.Duration
+		)
+		if res != nil {
+			start = res.Timeline.Created
+			d = res.Timeline.WaitReturned.Sub(start)
+		}
+		if skipped[t.Name] {
+			tc.Skipped = &junitMessage{Message: "dependencies failed"}
+		}
+		ts.add(tc, start, d)
+	}
+	return writeJUnit(w, ts)
+}
+
+type junitSuites struct {
+	XMLName xml.Name      `xml:"testsuites"`
+	Suites  []*junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string       `xml:"name,attr"`
+	Tests     int          `xml:"tests,attr"`
+	Failures  int          `xml:"failures,attr"`
+	Errors    int          `xml:"errors,attr"`
+	Skipped   int          `xml:"skipped,attr"`
+	Time      string       `xml:"time,attr"`
+	Timestamp string       `xml:"timestamp,attr,omitempty"`
+	Cases     []*junitCase `xml:"testcase"`
+
+	start, end time.Time
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// newJUnitCase returns a test case describing a command which produced
+// res and err.
+func newJUnitCase(name string, res *Result, err error) *junitCase {
+	tc := &junitCase{Name: name}
+	if res != nil {
+		tc.SystemOut = string(res.Stdout)
+		tc.SystemErr = string(res.Stderr)
+	}
+	var ee *ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &ee):
+		tc.Failure = &junitMessage{
+			Message: ee.Error(),
+			Type:    fmt.Sprintf("exit code %d", ee.ExitCode()),
+			Body:    fmt.Sprintf("%v", err),
+		}
+		if res == nil && ee.Result != nil {
+			tc.SystemOut = string(ee.Result.Stdout)
+			tc.SystemErr = string(ee.Result.Stderr)
+		}
+	default:
+		tc.Error = &junitMessage{
+			Message: err.Error(),
+			Type:    fmt.Sprintf("%T", errors.Unwrap(err)),
+			Body:    fmt.Sprintf("%v", err),
+		}
+		if tc.Error.Type == "<nil>" {
+			tc.Error.Type = fmt.Sprintf("%T", err)
+		}
+	}
+	return tc
+}
+
+// add adds tc, which started at the specified time and ran for d, to ts.
+func (ts *junitSuite) add(tc *junitCase, start time.Time, d time.Duration) {
+	tc.Time = junitSeconds(d)
+	ts.Cases = append(ts.Cases, tc)
+	ts.Tests++
+	switch {
+	case tc.Skipped != nil:
+		ts.Skipped++
+	case tc.Failure != nil:
+		ts.Failures++
+	case tc.Error != nil:
+		ts.Errors++
+	}
+	if start.IsZero() {
+		return
+	}
+	if ts.start.IsZero() || start.Before(ts.start) {
+		ts.start = start
+	}
+	if end := start.Add(d); end.After(ts.end) {
+		ts.end = end
+	}
+}
+
+func writeJUnit(w io.Writer, ts *junitSuite) error {
+	ts.Time = "0"
+	if !ts.start.IsZero() {
+		ts.Timestamp = ts.start.UTC().Format("2006-01-02T15:04:05")
+		ts.Time = junitSeconds(ts.end.Sub(ts.start))
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(&junitSuites{Suites: []*junitSuite{ts}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitSeconds formats d in seconds, with millisecond precision.
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
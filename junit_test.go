@@ -0,0 +1,150 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+type junitReport struct {
+	Suites []struct {
+		Name     string `xml:"name,attr"`
+		Tests    int    `xml:"tests,attr"`
+		Failures int    `xml:"failures,attr"`
+		Errors   int    `xml:"errors,attr"`
+		Skipped  int    `xml:"skipped,attr"`
+		Cases    []struct {
+			Name    string `xml:"name,attr"`
+			Time    string `xml:"time,attr"`
+			Failure *struct {
+				Message string `xml:"message,attr"`
+				Type    string `xml:"type,attr"`
+			} `xml:"failure"`
+			Error *struct {
+				Message string `xml:"message,attr"`
+			} `xml:"error"`
+			Skipped   *struct{} `xml:"skipped"`
+			SystemOut string    `xml:"system-out"`
+			SystemErr string    `xml:"system-err"`
+		} `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
+func TestRecorderWriteJUnit(t *testing.T) {
+	rec := new(execx.Recorder)
+	ctx := execx.WithRunner(context.Background(), rec)
+
+	echo := selfCmd("echo")
+	echo.Stdin = strings.NewReader("hello <world>")
+	if _, err := execx.Run(ctx, echo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execx.Run(ctx, selfCmd("on")); err == nil {
+		t.Fatal("command did not fail")
+	}
+	if _, err := execx.Run(ctx, exec.Command("/nonexistent/command")); err == nil {
+		t.Fatal("command started")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := rec.WriteJUnit(buf, "build"); err != nil {
+		t.Fatal(err)
+	}
+	var report junitReport
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("%v:\n%s", err, buf)
+	}
+	if len(report.Suites) != 1 {
+		t.Fatalf("got %d suites, want 1", len(report.Suites))
+	}
+	suite := report.Suites[0]
+	if suite.Name != "build" || suite.Tests != 3 || suite.Failures != 1 || suite.Errors != 1 {
+		t.Errorf("got suite %q with %d tests, %d failures, %d errors, want build with 3, 1, 1",
+			suite.Name, suite.Tests, suite.Failures, suite.Errors)
+	}
+	if len(suite.Cases) != 3 {
+		t.Fatalf("got %d cases, want 3:\n%s", len(suite.Cases), buf)
+	}
+	ok, failed, broken := suite.Cases[0], suite.Cases[1], suite.Cases[2]
+	if ok.Failure != nil || ok.Error != nil {
+		t.Errorf("successful command reported as failed")
+	}
+	if ok.SystemOut != "hello <world>" || ok.SystemErr != "echoed" {
+		t.Errorf("got output %q, %q, want %q, %q", ok.SystemOut, ok.SystemErr, "hello <world>", "echoed")
+	}
+	if ok.Time == "" {
+		t.Errorf("missing time")
+	}
+	if failed.Failure == nil || failed.Failure.Type != "exit code 1" {
+		t.Errorf("got failure %+v, want exit code 1", failed.Failure)
+	}
+	if failed.SystemErr != "whoops" {
+		t.Errorf("got stderr %q, want %q", failed.SystemErr, "whoops")
+	}
+	if broken.Error == nil || broken.Failure != nil {
+		t.Errorf("command which failed to start not reported as error")
+	}
+}
+
+func TestPlanWriteJUnit(t *testing.T) {
+	r := execx.RunnerFunc(func(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+		if cmd.Args[1] == "broken" {
+			return nil, errors.New("broke")
+		}
+		return &execx.Result{Stdout: []byte(cmd.Args[1])}, nil
+	})
+	plan, err := execx.NewPlan(
+		&execx.Task{Name: "fetch", Argv: []string{"run", "fetch"}},
+		&execx.Task{Name: "broken", Argv: []string{"run", "broken"}, Deps: []string{"fetch"}},
+		&execx.Task{Name: "deploy", Argv: []string{"run", "deploy"}, Deps: []string{"broken"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := plan.Run(execx.WithRunner(context.Background(), r))
+	buf := new(bytes.Buffer)
+	if err := plan.WriteJUnit(buf, "plan", results, err); err != nil {
+		t.Fatal(err)
+	}
+	var report junitReport
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("%v:\n%s", err, buf)
+	}
+	suite := report.Suites[0]
+	if suite.Tests != 3 || suite.Errors != 1 || suite.Skipped != 1 {
+		t.Errorf("got %d tests, %d errors, %d skipped, want 3, 1, 1", suite.Tests, suite.Errors, suite.Skipped)
+	}
+	var names []string
+	for _, tc := range suite.Cases {
+		names = append(names, tc.Name)
+	}
+	if got, want := strings.Join(names, " "), "fetch broken deploy"; got != want {
+		t.Errorf("got cases %q, want %q", got, want)
+	}
+	if suite.Cases[0].SystemOut != "fetch" {
+		t.Errorf("got stdout %q, want %q", suite.Cases[0].SystemOut, "fetch")
+	}
+	if suite.Cases[2].Skipped == nil {
+		t.Errorf("deploy not reported as skipped")
+	}
+}
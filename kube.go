@@ -0,0 +1,125 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// KubeRunner is a Runner which runs commands in a container of a
+// Kubernetes pod, using the exec subresource, by way of kubectl exec.
+// kubectl streams the standard I/O of the remote command, which can be
+// captured as usual, and exits with its exit status.
+//
+// The command runs in the container, not on the local machine:
+// cmd.Args[0], or cmd.Path if cmd.Args is empty, must name a program in
+// the container, which need not exist locally. cmd.Env and cmd.Dir, if set, are
+// applied in the container, using env and sh respectively, which must be
+// available there. kubectl itself runs with the environment of the
+// caller, so that it finds its configuration.
+//
+// If the command fails, the namespace, pod and container are recorded as
+// details named "namespace", "pod" and "container" in the *ExitError.
+type KubeRunner struct {
+	// Pod is the name of the pod.
+	Pod string
+
+	// Namespace is the namespace of the pod. If Namespace is empty,
+	// the namespace of the current kubectl context is used.
+	Namespace string
+
+	// Container is the name of the container. If Container is empty,
+	// the default container of the pod is used.
+	Container string
+
+	// Context is the kubectl context to use. If Context is empty, the
+	// current context is used.
+	Context string
+}
+
+// Run runs cmd in the pod, as per Run.
+func (r *KubeRunner) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	if r.Pod == "" {
+		return nil, wrapStart(errors.New("execx: KubeRunner: no pod specified"), cmd, nil)
+	}
+	path, err := exec.LookPath("kubectl")
+	if err != nil {
+		return nil, wrapStart(err, cmd, nil)
+	}
+	args := r.args(cmd)
+	if len(cmd.Args) > 1 {
+		args = append(args, cmd.Args[1:]...)
+	}
+	cmd.Args = args
+	cmd.Path = path
+	cmd.Env = nil
+	cmd.Dir = ""
+	// The program need not exist locally.
+	cmd.Err = nil
+
+	res, err := Local.Run(ctx, cmd, opts...)
+	var ee *ExitError
+	if errors.As(err, &ee) {
+		if r.Namespace != "" {
+			ee.Details = append(ee.Details, Detail{Key: "namespace", Value: r.Namespace})
+		}
+		ee.Details = append(ee.Details, Detail{Key: "pod", Value: r.Pod})
+		if r.Container != "" {
+			ee.Details = append(ee.Details, Detail{Key: "container", Value: r.Container})
+		}
+	}
+	return res, err
+}
+
+// args returns the arguments to kubectl which run cmd in the pod,
+// followed by the name of the program, as given in cmd.Args[0], rather
+// than the path of the local program it was resolved to, if any.
+func (r *KubeRunner) args(cmd *exec.Cmd) []string {
+	args := []string{"kubectl"}
+	if r.Context != "" {
+		args = append(args, "--context="+r.Context)
+	}
+	if r.Namespace != "" {
+		args = append(args, "--namespace="+r.Namespace)
+	}
+	args = append(args, "exec")
+	if cmd.Stdin != nil {
+		args = append(args, "--stdin")
+	}
+	if r.Container != "" {
+		args = append(args, "--container="+r.Container)
+	}
+	args = append(args, r.Pod, "--")
+	if cmd.Dir != "" {
+		args = append(args, "sh", "-c", `cd "$1" && shift && exec "$@"`, "sh", cmd.Dir)
+	}
+	if len(cmd.Env) > 0 {
+		args = append(args, "env")
+		for _, kv := range cmd.Env {
+			// env treats arguments which do not contain '=' as the
+			// name of the command, so those are skipped.
+			if strings.Contains(kv, "=") {
+				args = append(args, kv)
+			}
+		}
+	}
+	if len(cmd.Args) > 0 {
+		return append(args, cmd.Args[0])
+	}
+	return append(args, cmd.Path)
+}
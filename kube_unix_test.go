@@ -0,0 +1,135 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+// fakeKubectl installs a fake kubectl program in PATH, which logs its
+// arguments to the returned file, and runs the command following "--"
+// locally.
+func fakeKubectl(t *testing.T) (log string) {
+	dir := tempDir(t)
+	log = filepath.Join(dir, "log")
+	writeFile(t, filepath.Join(dir, "kubectl"), `#!/bin/sh
+echo "kubectl $*" >> `+log+`
+while [ "$1" != "--" ]; do shift; done
+shift
+exec "$@"
+`)
+	if err := os.Chmod(filepath.Join(dir, "kubectl"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestKubeRunner(t *testing.T) {
+	log := fakeKubectl(t)
+
+	r := &execx.KubeRunner{Namespace: "ci", Pod: "builder-0", Container: "go"}
+	cmd := selfCmd("on")
+	dir := tempDir(t)
+	cmd.Dir = dir
+	_, err := r.Run(context.Background(), cmd)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.ExitCode() != 1 || string(ee.Result.Stderr) != "whoops" {
+		t.Errorf("got exit code %d, stderr %q", ee.ExitCode(), ee.Result.Stderr)
+	}
+	for key, want := range map[string]string{"namespace": "ci", "pod": "builder-0", "container": "go"} {
+		if v, _ := ee.Detail(key); v != want {
+			t.Errorf("detail %s = %v, want %s", key, v, want)
+		}
+	}
+
+	b, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := string(b)
+	for _, want := range []string{
+		"kubectl --namespace=ci exec --container=go builder-0 -- sh -c ",
+		" sh " + dir + " env ",
+		"EXECX_TEST=on",
+	} {
+		if !strings.Contains(calls, want) {
+			t.Errorf("calls do not contain %q:\n%s", want, calls)
+		}
+	}
+}
+
+func TestKubeRunnerStdin(t *testing.T) {
+	fakeKubectl(t)
+
+	r := &execx.KubeRunner{Pod: "builder-0"}
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("hello")
+	res, err := r.Run(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "hello" {
+		t.Errorf("got %q, want %q", res.Stdout, "hello")
+	}
+}
+
+func TestKubeRunnerProgramName(t *testing.T) {
+	log := fakeKubectl(t)
+
+	r := &execx.KubeRunner{Pod: "builder-0"}
+	if _, err := r.Run(context.Background(), exec.Command("true")); err != nil {
+		t.Fatal(err)
+	}
+	// A program which exists only in the pod is not looked up locally.
+	_, err := r.Run(context.Background(), exec.Command("execx-only-in-pod"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError from the pod", err)
+	}
+
+	b, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := string(b)
+	for _, want := range []string{"builder-0 -- true\n", "builder-0 -- execx-only-in-pod\n"} {
+		if !strings.Contains(calls, want) {
+			t.Errorf("calls do not contain %q:\n%s", want, calls)
+		}
+	}
+}
+
+func TestKubeRunnerNoPod(t *testing.T) {
+	_, err := new(execx.KubeRunner).Run(context.Background(), selfCmd("echo"))
+	if _, ok := err.(*execx.StartError); !ok {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+}
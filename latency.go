@@ -0,0 +1,213 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latency histograms bucket durations in microseconds, with
+// latencySubBuckets linear buckets per power of two, in the style of HDR
+// histograms, such that percentiles are accurate to within 1 part in
+// latencySubBuckets, using little memory.
+const latencySubBuckets = 16
+
+// maxLatencyFingerprints bounds the number of fingerprints for which
+// latencies are recorded.
+const maxLatencyFingerprints = 1000
+
+// A LatencySnapshot summarizes the latencies of the commands which share a
+// fingerprint, as per Fingerprint. Latencies are measured from the time
+// the process started running to the time Wait returned, as per
+// Result.Duration.
+type LatencySnapshot struct {
+	// Fingerprint is the fingerprint of the commands.
+	Fingerprint string `json:"fingerprint"`
+
+	// Cmdline is the command line of the most recent command with the
+	// fingerprint, as per Cmdline.
+	Cmdline string `json:"cmdline"`
+
+	// Count is the number of commands which completed, and Errors the
+	// number of those which completed with an error.
+	Count  int64 `json:"count"`
+	Errors int64 `json:"errors"`
+
+	// P50, P95 and P99 are percentiles of the latencies, and Max the
+	// highest latency.
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+
+	// Total is the sum of the latencies.
+	Total time.Duration `json:"total"`
+}
+
+// ErrorRate returns the fraction of the commands which completed with an
+// error.
+func (s *LatencySnapshot) ErrorRate() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Count)
+}
+
+// Latencies returns snapshots of the latency histograms maintained for the
+// commands started by Start, by fingerprint, in decreasing order of total
+// latency, such that the commands which account for the most time spent
+// waiting on subprocesses come first. Latencies are recorded for up to
+// 1000 fingerprints: commands with other fingerprints are not recorded,
+// until ResetLatencies is called. DebugHandler serves the snapshots too.
+func Latencies() []LatencySnapshot {
+	latencies.Lock()
+	defer latencies.Unlock()
+	snaps := make([]LatencySnapshot, 0, len(latencies.m))
+	for fp, l := range latencies.m {
+		snaps = append(snaps, LatencySnapshot{
+			Fingerprint: fp,
+			Cmdline:     l.cmdline,
+			Count:       int64(l.hist.count),
+			Errors:      int64(l.errors),
+			P50:         l.hist.percentile(0.50),
+			P95:         l.hist.percentile(0.95),
+			P99:         l.hist.percentile(0.99),
+			Max:         l.hist.max,
+			Total:       l.hist.total,
+		})
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		if snaps[i].Total != snaps[j].Total {
+			return snaps[i].Total > snaps[j].Total
+		}
+		return snaps[i].Fingerprint < snaps[j].Fingerprint
+	})
+	return snaps
+}
+
+// ResetLatencies discards the latencies recorded so far.
+func ResetLatencies() {
+	latencies.Lock()
+	defer latencies.Unlock()
+	latencies.m = make(map[string]*latencyStats)
+}
+
+var latencies = struct {
+	sync.Mutex
+	m map[string]*latencyStats // by fingerprint
+}{
+	m: make(map[string]*latencyStats),
+}
+
+// latencyStats holds the latencies of the commands with a fingerprint.
+type latencyStats struct {
+	cmdline string
+	hist    histogram
+	errors  uint64
+}
+
+// recordLatency records the latency d of a command with the specified
+// fingerprint and command line, which completed with err.
+func recordLatency(fingerprint, cmdline string, d time.Duration, err error) {
+	latencies.Lock()
+	defer latencies.Unlock()
+	l, ok := latencies.m[fingerprint]
+	if !ok {
+		if len(latencies.m) >= maxLatencyFingerprints {
+			return
+		}
+		l = new(latencyStats)
+		latencies.m[fingerprint] = l
+	}
+	l.cmdline = cmdline
+	l.hist.record(d)
+	if err != nil {
+		l.errors++
+	}
+}
+
+// histogram is a latency histogram.
+type histogram struct {
+	counts []uint64 // by bucket, as per latencyBucket
+	count  uint64
+	total  time.Duration
+	max    time.Duration
+}
+
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := latencyBucket(d)
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]uint64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	h.count++
+	h.total += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// percentile returns the q-th quantile of the recorded latencies, as the
+// upper bound of the bucket which holds it, or h.max, if lower.
+func (h *histogram) percentile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			if d := latencyBucketMax(i); d < h.max {
+				return d
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// latencyBucket returns the index of the bucket which holds d. Durations
+// under latencySubBuckets microseconds have a bucket each. Longer
+// durations are bucketed by their most significant bits, into
+// latencySubBuckets buckets per power of two.
+func latencyBucket(d time.Duration) int {
+	us := uint64(d / time.Microsecond)
+	if us < latencySubBuckets {
+		return int(us)
+	}
+	shift := bits.Len64(us) - bits.Len64(latencySubBuckets)
+	return shift*latencySubBuckets + int(us>>uint(shift))
+}
+
+// latencyBucketMax returns the highest duration held by bucket i.
+func latencyBucketMax(i int) time.Duration {
+	if i < latencySubBuckets {
+		return time.Duration(i+1)*time.Microsecond - 1
+	}
+	shift := i/latencySubBuckets - 1
+	top := uint64(i%latencySubBuckets + latencySubBuckets)
+	return time.Duration((top+1)<<uint(shift))*time.Microsecond - 1
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestLatencies(t *testing.T) {
+	execx.ResetLatencies()
+	defer execx.ResetLatencies()
+	for i := 0; i < 3; i++ {
+		if _, err := execx.Run(context.Background(), selfCmd("echo")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	execx.Run(context.Background(), selfCmd("on"))
+
+	snaps := make(map[string]execx.LatencySnapshot)
+	for _, s := range execx.Latencies() {
+		snaps[s.Fingerprint] = s
+	}
+	echo, ok := snaps[execx.Fingerprint(selfCmd("echo"))]
+	if !ok {
+		t.Fatalf("no latencies recorded for echo: %+v", snaps)
+	}
+	if echo.Count != 3 || echo.Errors != 0 {
+		t.Errorf("echo: got count %d, errors %d, want 3, 0", echo.Count, echo.Errors)
+	}
+	if echo.P50 <= 0 || echo.P50 > echo.P95 || echo.P95 > echo.P99 || echo.P99 > echo.Max || echo.Max > echo.Total {
+		t.Errorf("echo: inconsistent latencies %+v", echo)
+	}
+	if echo.Cmdline != execx.Cmdline(selfCmd("echo")) {
+		t.Errorf("echo: got command line %q", echo.Cmdline)
+	}
+	on := snaps[execx.Fingerprint(selfCmd("on"))]
+	if on.Count != 1 || on.ErrorRate() != 1 {
+		t.Errorf("on: got count %d, error rate %v, want 1, 1", on.Count, on.ErrorRate())
+	}
+
+	srv := httptest.NewServer(&execx.DebugHandler{})
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "?view=latency&format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var served []execx.LatencySnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&served); err != nil {
+		t.Fatal(err)
+	}
+	if len(served) < 2 {
+		t.Errorf("got %d snapshots from DebugHandler, want at least 2", len(served))
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+// An OverflowAction determines what happens when a command exceeds its
+// output budget.
+type OverflowAction int
+
+// Overflow actions.
+const (
+	// OverflowKill kills the process as soon as it exceeds its
+	// output budget.
+	OverflowKill OverflowAction = iota
+
+	// OverflowTruncate lets the process run to completion, but
+	// discards output beyond the budget.
+	OverflowTruncate
+)
+
+func (a OverflowAction) String() string {
+	switch a {
+	case OverflowKill:
+		return "kill"
+	case OverflowTruncate:
+		return "truncate"
+	default:
+		return fmt.Sprintf("OverflowAction(%d)", int(a))
+	}
+}
+
+// WithOutputLimit limits the captured standard output and standard error
+// of the command to max bytes each, such that a runaway process cannot
+// exhaust the memory of the parent. Output written to non-nil cmd.Stdout
+// or cmd.Stderr is not limited. If the process exceeds the limit, action
+// is taken, and Run and Wait return an *OutputOverflowError.
+func WithOutputLimit(max int, action OverflowAction) Option {
+	return func(cfg *config) {
+		cfg.limit = max
+		cfg.overflow = action
+	}
+}
+
+// OutputLimited runs cmd as per Run, capturing at most maxBytes of its
+// standard output and standard error, and killing it if it exceeds that
+// budget. It is shorthand for Run with WithOutputLimit(maxBytes,
+// OverflowKill), which a WithOutputLimit option in opts overrides.
+func OutputLimited(ctx context.Context, cmd *exec.Cmd, maxBytes int, opts ...Option) (*Result, error) {
+	opts = append([]Option{WithOutputLimit(maxBytes, OverflowKill)}, opts...)
+	return Run(ctx, cmd, opts...)
+}
+
+// OutputOverflowError records a command which exceeded its output budget.
+type OutputOverflowError struct {
+	// Path is the path of the command which was executed.
+	Path string
+
+	// Args holds command line arguments.
+	Args []string
+
+	// Stream is the name of the stream which overflowed, "stdout"
+	// or "stderr".
+	Stream string
+
+	// Limit is the output budget, in bytes.
+	Limit int
+
+	// Action is the action taken when the budget was exceeded.
+	Action OverflowAction
+
+	// Partial holds the output captured before the budget was
+	// exceeded.
+	Partial []byte
+
+	// Err is the error the command failed with, such as an *ExitError
+	// if the command was killed. If the command exited successfully
+	// after its output was truncated, Err is nil.
+	Err error
+}
+
+// Cmdline returns the concatenation of filepath.Base(e.Path) and e.Args,
+// separated by spaces. See func Cmdline.
+func (e *OutputOverflowError) Cmdline() string {
+	return cmdline(e.Path, e.Args)
+}
+
+// Unwrap returns e.Err.
+func (e *OutputOverflowError) Unwrap() error {
+	return e.Err
+}
+
+func (e *OutputOverflowError) Error() string {
+	s := fmt.Sprintf("%s: %s exceeded %s output limit (%s)", e.Cmdline(), e.Stream, formatSize(e.Limit), e.Action)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// limitWriter captures at most max bytes, and takes action when more
+// output arrives.
+type limitWriter struct {
+	buf      captureWriter
+	max      int
+	onExceed func()
+
+	once     sync.Once
+	overflow bool // accessed only by the copying goroutine, and after it is done
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if room := lw.max - lw.buf.Len(); len(p) > room {
+		lw.buf.Write(p[:room])
+		lw.overflow = true
+		lw.once.Do(lw.onExceed)
+		// Keep draining the pipe, such that the process does not
+		// block writing to it.
+		return len(p), nil
+	}
+	return lw.buf.Write(p)
+}
+
+// exceeded is called when an output stream of h exceeds its budget.
+func (h *Handle) exceeded() {
+	if h.cfg.overflow == OverflowKill {
+		h.kill()
+	}
+}
+
+// overflowError returns an *OutputOverflowError if an output stream of h
+// overflowed, or nil otherwise.
+func (h *Handle) overflowError(res *Result, err error) error {
+	for _, s := range h.outputs {
+		lw, ok := s.limiter().(*limitWriter)
+		if !ok || !lw.overflow {
+			continue
+		}
+		partial := res.Stdout
+		if s.name == "stderr" {
+			partial = res.Stderr
+		}
+		return &OutputOverflowError{
+			Path:    h.cmd.Path,
+			Args:    h.cmd.Args,
+			Stream:  s.name,
+			Limit:   h.cfg.limit,
+			Action:  h.cfg.overflow,
+			Partial: partial,
+			Err:     err,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestOutputLimited(t *testing.T) {
+	t.Run("Kill", testOutputLimitedKill)
+	t.Run("Truncate", testOutputLimitedTruncate)
+	t.Run("WithinLimit", testOutputLimitedWithinLimit)
+}
+
+func testOutputLimitedKill(t *testing.T) {
+	res, err := execx.OutputLimited(context.Background(), selfCmd("flood"), 4096)
+	var oe *execx.OutputOverflowError
+	if !errors.As(err, &oe) {
+		t.Fatalf("got %v, want *OutputOverflowError", err)
+	}
+	if oe.Stream != "stdout" || oe.Action != execx.OverflowKill {
+		t.Errorf("got stream %q, action %v", oe.Stream, oe.Action)
+	}
+	if len(oe.Partial) != 4096 || len(res.Stdout) != 4096 {
+		t.Errorf("got %d bytes of partial output, want 4096", len(oe.Partial))
+	}
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want to wrap *ExitError of killed process", err)
+	}
+	if ee.ExitCode() != -1 {
+		t.Errorf("got exit code %d, want -1", ee.ExitCode())
+	}
+}
+
+func testOutputLimitedTruncate(t *testing.T) {
+	res, err := execx.OutputLimited(context.Background(), selfCmd("flood"), 4096,
+		execx.WithOutputLimit(4096, execx.OverflowTruncate))
+	var oe *execx.OutputOverflowError
+	if !errors.As(err, &oe) {
+		t.Fatalf("got %v, want *OutputOverflowError", err)
+	}
+	if oe.Err != nil {
+		t.Errorf("truncated command failed: %v", oe.Err)
+	}
+	if res.ExitCode != 0 || len(res.Stdout) != 4096 {
+		t.Errorf("got exit code %d, %d bytes of output", res.ExitCode, len(res.Stdout))
+	}
+}
+
+func testOutputLimitedWithinLimit(t *testing.T) {
+	res, err := execx.OutputLimited(context.Background(), selfCmd("echo"), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stderr) != "echoed" {
+		t.Errorf("got stderr %q, want %q", res.Stderr, "echoed")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// A Line is a line of output of a command, as sent by Lines.
+type Line struct {
+	// Stream is the name of the stream the line was written to:
+	// "stdout" or "stderr".
+	Stream string
+
+	// Text is the contents of the line, without the trailing newline.
+	Text string
+
+	// Time is the time the line was read.
+	Time time.Time
+}
+
+// Lines starts cmd as per Start, and sends the lines written by cmd to its
+// standard output and standard error on the returned Line channel, in the
+// order in which they are read. Lines from the same stream are sent in
+// order. If cmd.Stdout or cmd.Stderr are set, output is written to them
+// as well.
+//
+// The Line channel is unbuffered, and the output of cmd is not read
+// further while a line is waiting to be received, such that a slow
+// consumer applies backpressure to cmd. Callers must receive from the
+// Line channel until it is closed, or cancel ctx.
+//
+// The Line channel is closed once the command has completed and all its
+// output has been sent. Then, the error returned by Wait, or the error
+// which prevented cmd from starting, is sent on the error channel, which
+// is then closed.
+func Lines(ctx context.Context, cmd *exec.Cmd, opts ...Option) (<-chan Line, <-chan error) {
+	linec := make(chan Line)
+	errc := make(chan error, 1)
+
+	stdout := lineStream(ctx, "stdout", linec)
+	stderr := lineStream(ctx, "stderr", linec)
+	cmd.Stdout = teeWriter(cmd.Stdout, stdout)
+	cmd.Stderr = teeWriter(cmd.Stderr, stderr)
+
+	h, err := Start(ctx, cmd, opts...)
+	if err != nil {
+		close(linec)
+		errc <- err
+		close(errc)
+		return linec, errc
+	}
+	go func() {
+		_, err := h.Wait()
+		stdout.flush()
+		stderr.flush()
+		close(linec)
+		errc <- err
+		close(errc)
+	}()
+	return linec, errc
+}
+
+// lineStream returns a lineWriter which sends lines to c, until ctx is
+// done.
+func lineStream(ctx context.Context, stream string, c chan<- Line) *lineWriter {
+	clock := ClockFrom(ctx)
+	return &lineWriter{emit: func(line []byte) error {
+		select {
+		case c <- Line{Stream: stream, Text: string(line), Time: clock.Now()}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}
+}
+
+// teeWriter returns a writer which writes to both w and lw, or to lw
+// alone if w is nil.
+func teeWriter(w io.Writer, lw *lineWriter) io.Writer {
+	if w == nil {
+		return lw
+	}
+	return io.MultiWriter(w, lw)
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestLines(t *testing.T) {
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("one\ntwo\r\nthree")
+	lines, errc := execx.Lines(context.Background(), cmd)
+
+	got := make(map[string][]string)
+	for line := range lines {
+		if line.Time.IsZero() {
+			t.Errorf("line %q has no timestamp", line.Text)
+		}
+		got[line.Stream] = append(got[line.Stream], line.Text)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if want := []string{"one", "two", "three"}; strings.Join(got["stdout"], ",") != strings.Join(want, ",") {
+		t.Errorf("got stdout lines %q, want %q", got["stdout"], want)
+	}
+	if want := []string{"echoed"}; strings.Join(got["stderr"], ",") != strings.Join(want, ",") {
+		t.Errorf("got stderr lines %q, want %q", got["stderr"], want)
+	}
+	if _, ok := <-errc; ok {
+		t.Error("error channel not closed")
+	}
+}
+
+func TestLinesExitError(t *testing.T) {
+	lines, errc := execx.Lines(context.Background(), selfCmd("on"))
+	for range lines {
+	}
+	var ee *execx.ExitError
+	if err := <-errc; !errors.As(err, &ee) || ee.ExitCode() != 1 {
+		t.Fatalf("got %v, want exit code 1", err)
+	}
+}
+
+func TestLinesCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, errc := execx.Lines(ctx, selfCmd("hang"))
+	cancel()
+	for range lines {
+	}
+	if err := <-errc; err == nil {
+		t.Fatal("no error after cancellation")
+	}
+}
+
+func TestLinesStartError(t *testing.T) {
+	lines, errc := execx.Lines(context.Background(), exec.Command("/nonexistent/command"))
+	if _, ok := <-lines; ok {
+		t.Error("got line from command which did not start")
+	}
+	var se *execx.StartError
+	if err := <-errc; !errors.As(err, &se) {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+}
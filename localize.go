@@ -0,0 +1,117 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Catalog translates the fixed messages used when formatting errors,
+// such as "workdir: %s" or "user time: %v", and hints, such as
+// "%s pipe full (%s); likely missing reader". Messages are identified by
+// their English format strings, which are used as keys.
+//
+// Catalogs are typically backed by golang.org/x/text/message. For example,
+// given a *message.Printer p:
+//
+//	execx.UpdateConfig(func(c *execx.Config) {
+//		c.Catalog = execx.CatalogFunc(func(key string, args ...interface{}) string {
+//			return p.Sprintf(key, args...)
+//		})
+//	})
+type Catalog interface {
+	// Sprintf formats the message identified by key, with the
+	// specified arguments, as per fmt.Sprintf.
+	Sprintf(key string, args ...interface{}) string
+}
+
+// CatalogFunc is an adapter which allows the use of ordinary functions
+// as Catalogs.
+type CatalogFunc func(key string, args ...interface{}) string
+
+// Sprintf returns f(key, args...).
+func (f CatalogFunc) Sprintf(key string, args ...interface{}) string {
+	return f(key, args...)
+}
+
+// Localize returns an error which wraps err, and which formats the first
+// *ExitError or *StartError in its chain using c, rather than
+// Config.Catalog, for "%v" and "%+v". The Error method of the returned
+// error returns err.Error().
+func Localize(err error, c Catalog) error {
+	if err == nil {
+		return nil
+	}
+	return &localizedError{err: err, c: c}
+}
+
+type localizedError struct {
+	err error
+	c   Catalog
+}
+
+func (e *localizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *localizedError) Unwrap() error {
+	return e.err
+}
+
+func (e *localizedError) Format(s fmt.State, verb rune) {
+	if verb != 'v' {
+		return
+	}
+	p := printer{c: e.c}
+	var ee *ExitError
+	var se *StartError
+	switch {
+	case errors.As(e.err, &ee):
+		ee.format(s, p)
+	case errors.As(e.err, &se):
+		se.format(s, p)
+	case s.Flag('+'):
+		fmt.Fprintf(s, "%+v", e.err)
+	default:
+		fmt.Fprintf(s, "%v", e.err)
+	}
+}
+
+// printer formats messages using a Catalog, or in English if the
+// Catalog is nil.
+type printer struct {
+	c Catalog
+}
+
+// defaultPrinter returns a printer which uses the Catalog of the current
+// Config.
+func defaultPrinter() printer {
+	return printer{c: currentConfig().Catalog}
+}
+
+func (p printer) sprintf(key string, args ...interface{}) string {
+	if p.c == nil {
+		return fmt.Sprintf(key, args...)
+	}
+	return p.c.Sprintf(key, args...)
+}
+
+// message is a message which can be translated by a Catalog, such as
+// a hint.
+type message struct {
+	key  string
+	args []interface{}
+}
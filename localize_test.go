@@ -0,0 +1,73 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+// frenchCatalog translates some messages into French.
+var frenchCatalog = execx.CatalogFunc(func(key string, args ...interface{}) string {
+	translations := map[string]string{
+		"workdir: %s":         "répertoire de travail : %s",
+		"user time: %v":       "temps utilisateur : %v",
+		"timeline:":           "chronologie :",
+		"exited":              "terminé",
+		"failed to start: %v": "échec du démarrage : %v",
+	}
+	if t, ok := translations[key]; ok {
+		key = t
+	}
+	return fmt.Sprintf(key, args...)
+})
+
+func TestLocalize(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	if err == nil {
+		t.Fatal("command succeeded")
+	}
+	got := fmt.Sprintf("%+v", execx.Localize(err, frenchCatalog))
+	for _, want := range []string{"répertoire de travail : ", "temps utilisateur : ", "chronologie :", "\tterminé:", "system time: "} {
+		if !strings.Contains(got, want) {
+			t.Errorf("localized output does not contain %q:\n%s", want, got)
+		}
+	}
+	if english := fmt.Sprintf("%+v", err); !strings.Contains(english, "workdir: ") {
+		t.Errorf("unlocalized output does not contain %q:\n%s", "workdir: ", english)
+	}
+	var ee *execx.ExitError
+	if !errors.As(execx.Localize(err, frenchCatalog), &ee) {
+		t.Error("localized error does not unwrap to *ExitError")
+	}
+	if execx.Localize(nil, frenchCatalog) != nil {
+		t.Error("Localize(nil) != nil")
+	}
+}
+
+func TestConfigCatalog(t *testing.T) {
+	storeConfig(t, execx.Config{Catalog: frenchCatalog})
+
+	_, err := execx.Run(context.Background(), exec.Command("/nonexistent/command"))
+	if got := fmt.Sprintf("%v", err); !strings.Contains(got, "échec du démarrage : ") {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockPollInterval is the interval at which Exclusive retries acquiring
+// a lock held by another process.
+const lockPollInterval = 50 * time.Millisecond
+
+// errLocked is returned by tryLock if the lock is held by someone else.
+var errLocked = errors.New("execx: lock is held")
+
+// Exclusive runs cmd as per Run, while holding an exclusive advisory lock
+// on the file at lockPath, which is created if it does not exist, such
+// that commands which must not run concurrently, even across processes,
+// are serialized. The lock is taken using flock on Unix systems, and
+// LockFileEx on Windows. While it holds the lock, Exclusive writes the
+// process ID of the current process to the file.
+//
+// By default, Exclusive waits for the lock until ctx is done. Use
+// WithLockTimeout to bound the wait, or to fail fast. If the lock cannot
+// be acquired, Exclusive returns a *StartError which wraps a *LockError.
+// The time spent waiting for the lock is recorded in Result.LockWait.
+func Exclusive(ctx context.Context, lockPath string, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	cfg := newConfig(opts)
+	clock := ClockFrom(ctx)
+	start := clock.Now()
+	f, err := acquireLock(ctx, lockPath, cfg)
+	if err != nil {
+		return nil, wrapStart(err, cmd, cfg.collectors)
+	}
+	defer f.Close()
+	wait := clock.Now().Sub(start)
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+
+	res, err := Run(ctx, cmd, opts...)
+	if res != nil {
+		res.LockWait = wait
+	}
+	return res, err
+}
+
+// WithLockTimeout bounds the time Exclusive waits for its lock. If d is
+// zero, Exclusive fails immediately if the lock is held by someone else.
+func WithLockTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.lockTimeout = d
+		cfg.lockTimeoutSet = true
+	}
+}
+
+// LockError records a failure to acquire the lock for Exclusive.
+type LockError struct {
+	// Path is the path of the lock file.
+	Path string
+
+	// HolderPID is the process ID recorded in the lock file by the
+	// holder of the lock, or 0 if it is not known.
+	HolderPID int
+
+	// Waited is the time spent waiting for the lock.
+	Waited time.Duration
+
+	// Err is the underlying error, such as context.DeadlineExceeded
+	// if the wait timed out.
+	Err error
+}
+
+func (e *LockError) Error() string {
+	holder := ""
+	if e.HolderPID != 0 {
+		holder = fmt.Sprintf(" (held by pid %d)", e.HolderPID)
+	}
+	return fmt.Sprintf("execx: cannot lock %s%s after %v: %v", e.Path, holder, e.Waited.Round(time.Millisecond), e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// acquireLock opens the lock file at path, and locks it, waiting as
+// configured by cfg.
+func acquireLock(ctx context.Context, path string, cfg *config) (*os.File, error) {
+	clock := ClockFrom(ctx)
+	start := clock.Now()
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, &LockError{Path: path, Err: err}
+	}
+	if cfg.lockTimeoutSet {
+		var cancel context.CancelFunc
+		ctx, cancel = withClockTimeout(ctx, clock, cfg.lockTimeout)
+		defer cancel()
+	}
+	for {
+		err := tryLock(f)
+		if err == nil {
+			return f, nil
+		}
+		if err == errLocked {
+			if cfg.lockTimeoutSet && cfg.lockTimeout <= 0 {
+				err = errLocked
+			} else {
+				t := clock.NewTimer(lockPollInterval)
+				select {
+				case <-t.C():
+					continue
+				case <-ctx.Done():
+					t.Stop()
+					err = ctx.Err()
+				}
+			}
+		}
+		f.Close()
+		return nil, &LockError{Path: path, HolderPID: lockHolder(path), Waited: clock.Now().Sub(start), Err: err}
+	}
+}
+
+// lockHolder returns the process ID recorded in the lock file at path, or
+// 0 if there is none.
+func lockHolder(path string) int {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return pid
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestExclusive(t *testing.T) {
+	path := filepath.Join(tempDir(t), "lock")
+	res, err := execx.Exclusive(context.Background(), path, selfCmd("echo"))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if res.LockWait <= 0 {
+		t.Errorf("got LockWait %v", res.LockWait)
+	}
+}
+
+func TestExclusiveHeld(t *testing.T) {
+	path := filepath.Join(tempDir(t), "lock")
+	f := holdLock(t, path, "4242\n")
+
+	t.Run("FailFast", func(t *testing.T) {
+		_, err := execx.Exclusive(context.Background(), path, selfCmd("echo"), execx.WithLockTimeout(0))
+		var le *execx.LockError
+		if !errors.As(err, &le) {
+			t.Fatalf("got %v, want *LockError", err)
+		}
+		if le.HolderPID != 4242 {
+			t.Errorf("got HolderPID %d, want 4242", le.HolderPID)
+		}
+		var se *execx.StartError
+		if !errors.As(err, &se) {
+			t.Errorf("got %T, want *StartError", err)
+		}
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		_, err := execx.Exclusive(context.Background(), path, selfCmd("echo"), execx.WithLockTimeout(200*time.Millisecond))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want context.DeadlineExceeded", err)
+		}
+		var le *execx.LockError
+		if errors.As(err, &le) && le.Waited < 200*time.Millisecond {
+			t.Errorf("waited %v, want at least 200ms", le.Waited)
+		}
+	})
+	t.Run("Wait", func(t *testing.T) {
+		time.AfterFunc(200*time.Millisecond, func() { f.Close() })
+		res, err := execx.Exclusive(context.Background(), path, selfCmd("echo"))
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if res.LockWait < 200*time.Millisecond {
+			t.Errorf("got LockWait %v, want at least 200ms", res.LockWait)
+		}
+	})
+}
+
+// holdLock locks the file at path, writing contents to it. The lock is
+// released when the returned file is closed.
+func holdLock(t *testing.T, path, contents string) *os.File {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"path/filepath"
+)
+
+// WithSyslog forwards the standard output and the standard error of the
+// command to the syslog server at raddr, one message per line, in
+// addition to capturing them, or writing them to cmd.Stdout and
+// cmd.Stderr, as usual. Standard output is logged at LOG_INFO priority,
+// and standard error at LOG_WARNING, with the LOG_USER facility. The name
+// of the command is used as the tag. If network is empty, WithSyslog
+// connects to the local syslog server, as per syslog.Dial.
+//
+// WithSyslog is not supported on Windows.
+func WithSyslog(network, raddr string) Option {
+	return func(cfg *config) {
+		cfg.syslog = &syslogAddr{network: network, raddr: raddr}
+	}
+}
+
+// WithJournal forwards the standard output and the standard error of the
+// command to systemd-journald, using its native protocol, one entry per
+// line, in addition to capturing them, or writing them to cmd.Stdout and
+// cmd.Stderr, as usual. Standard output is logged with priority 6 (info),
+// and standard error with priority 4 (warning). The name of the command
+// is used as SYSLOG_IDENTIFIER, and each entry carries an
+// EXECX_INVOCATION_ID field which identifies the run.
+//
+// The range of journal entries written by the command is recorded in
+// Result.Journal, such that operators can retrieve the full logs later.
+//
+// If socket is empty, the default journald socket is used.
+// WithJournal is supported on Linux only.
+func WithJournal(socket string) Option {
+	return func(cfg *config) {
+		if socket == "" {
+			socket = defaultJournalSocket
+		}
+		cfg.journal = socket
+	}
+}
+
+// defaultJournalSocket is the path of the native journald socket.
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+type syslogAddr struct {
+	network string
+	raddr   string
+}
+
+// A JournalRange identifies the journal entries written by a command run
+// using WithJournal.
+type JournalRange struct {
+	// Identifier is the SYSLOG_IDENTIFIER of the entries.
+	Identifier string
+
+	// InvocationID is the value of the EXECX_INVOCATION_ID field of
+	// the entries.
+	InvocationID string
+
+	// After is the cursor of the last entry in the journal before the
+	// command started, and Until is the cursor of the last entry after
+	// it completed. The cursors are recorded on a best-effort basis,
+	// only if the default journald socket is used, and journalctl can
+	// read the journal. Otherwise, they are empty.
+	After string
+	Until string
+}
+
+// Args returns the arguments to journalctl which select the entries
+// written by the command.
+func (r *JournalRange) Args() []string {
+	args := []string{
+		"SYSLOG_IDENTIFIER=" + r.Identifier,
+		"EXECX_INVOCATION_ID=" + r.InvocationID,
+	}
+	if r.After != "" {
+		args = append(args, "--after-cursor="+r.After)
+	}
+	return args
+}
+
+// A logSink forwards lines of output to a logging system.
+type logSink interface {
+	log(stream string, line []byte) error
+	Close() error
+}
+
+// logs holds the sinks configured by WithSyslog and WithJournal.
+type logs struct {
+	sinks   []logSink
+	writers []*lineWriter
+	journal *JournalRange
+}
+
+// openLogs connects to the logging systems configured by WithSyslog and
+// WithJournal, and sets up writers which forward output to them.
+func (h *Handle) openLogs() error {
+	tag := filepath.Base(h.cmd.Path)
+	if h.cfg.syslog != nil {
+		s, err := dialSyslog(h.cfg.syslog.network, h.cfg.syslog.raddr, tag)
+		if err != nil {
+			h.closeLogs()
+			return wrapStart(err, h.cmd, h.cfg.collectors)
+		}
+		h.addLogSink(s)
+	}
+	if h.cfg.journal != "" {
+		var id [16]byte
+		rand.Read(id[:])
+		r := &JournalRange{Identifier: tag, InvocationID: hex.EncodeToString(id[:])}
+		s, err := dialJournal(h.cfg.journal, r)
+		if err != nil {
+			h.closeLogs()
+			return wrapStart(err, h.cmd, h.cfg.collectors)
+		}
+		if h.cfg.journal == defaultJournalSocket {
+			r.After = journalCursor()
+		}
+		h.logs.journal = r
+		h.addLogSink(s)
+	}
+	return nil
+}
+
+func (h *Handle) addLogSink(s logSink) {
+	h.logs.sinks = append(h.logs.sinks, s)
+	stdout := &lineWriter{emit: func(line []byte) error { return s.log("stdout", line) }}
+	stderr := &lineWriter{emit: func(line []byte) error { return s.log("stderr", line) }}
+	h.logs.writers = append(h.logs.writers, stdout, stderr)
+	h.cfg.stdoutWriters = append(h.cfg.stdoutWriters, stdout)
+	h.cfg.stderrWriters = append(h.cfg.stderrWriters, stderr)
+}
+
+// closeLogs forwards incomplete last lines, and closes the sinks. It is
+// called once the outputs have been consumed, or if the command fails to
+// start.
+func (h *Handle) closeLogs() {
+	for _, w := range h.logs.writers {
+		w.flush()
+	}
+	for _, s := range h.logs.sinks {
+		s.Close()
+	}
+	if r := h.logs.journal; r != nil && h.cfg.journal == defaultJournalSocket {
+		r.Until = journalCursor()
+	}
+}
+
+// lineWriter splits output into lines, and emits each line separately,
+// without the trailing newline.
+type lineWriter struct {
+	emit    func(line []byte) error
+	partial []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			lw.partial = append(lw.partial, p...)
+			break
+		}
+		line := p[:i]
+		if len(lw.partial) > 0 {
+			line = append(lw.partial, line...)
+			lw.partial = lw.partial[:0]
+		}
+		if err := lw.emit(bytes.TrimSuffix(line, []byte("\r"))); err != nil {
+			return n - len(p), err
+		}
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// flush emits the incomplete last line, if any.
+func (lw *lineWriter) flush() {
+	if len(lw.partial) > 0 {
+		lw.emit(lw.partial)
+		lw.partial = nil
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Task is a command described by a manifest.
+type Task struct {
+	// Name identifies the task within the plan.
+	Name string
+
+	// Argv holds the command line arguments of the command, starting
+	// with the name of the program.
+	Argv []string
+
+	// Env holds variables which are added to the environment inherited
+	// from the current process.
+	Env map[string]string
+
+	// Dir is the working directory of the command. If empty, the
+	// command runs in the working directory of the current process.
+	Dir string
+
+	// Timeout, if positive, bounds the running time of each attempt
+	// to run the command, as per WithTimeout.
+	Timeout time.Duration
+
+	// Retries is the number of times the command is re-run if it fails.
+	Retries int
+
+	// Deps holds the names of the tasks which must complete successfully
+	// before the task is run.
+	Deps []string
+}
+
+// jsonTask is the JSON representation of a Task.
+type jsonTask struct {
+	Name    string            `json:"name"`
+	Argv    []string          `json:"argv"`
+	Env     map[string]string `json:"env,omitempty"`
+	Dir     string            `json:"dir,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+	Retries int               `json:"retries,omitempty"`
+	Deps    []string          `json:"deps,omitempty"`
+}
+
+// A Plan is a set of tasks, ordered by their dependencies.
+type Plan struct {
+	// Tasks holds the tasks in the plan, in the order they were
+	// declared.
+	Tasks []*Task
+
+	byName map[string]*Task
+}
+
+// LoadManifest reads a manifest from the JSON file at path, and returns
+// the plan it describes. Relative working directories of tasks are
+// interpreted relative to the directory containing the file.
+//
+// A manifest looks like this:
+//
+//	{
+//		"tasks": [
+//			{"name": "generate", "argv": ["go", "generate", "./..."]},
+//			{
+//				"name": "test",
+//				"argv": ["go", "test", "./..."],
+//				"env": {"GOFLAGS": "-mod=readonly"},
+//				"dir": "src",
+//				"timeout": "5m",
+//				"retries": 1,
+//				"deps": ["generate"]
+//			}
+//		]
+//	}
+//
+// Timeouts are written in the format accepted by time.ParseDuration.
+func LoadManifest(path string) (*Plan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	plan, err := parseManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("execx: manifest %s: %w", path, err)
+	}
+	base := filepath.Dir(path)
+	for _, t := range plan.Tasks {
+		if t.Dir != "" && !filepath.IsAbs(t.Dir) {
+			t.Dir = filepath.Join(base, t.Dir)
+		}
+	}
+	return plan, nil
+}
+
+// ParseManifest reads a manifest in the format described by LoadManifest
+// from r, and returns the plan it describes. Relative working directories
+// are left as-is.
+func ParseManifest(r io.Reader) (*Plan, error) {
+	plan, err := parseManifest(r)
+	if err != nil {
+		return nil, fmt.Errorf("execx: manifest: %w", err)
+	}
+	return plan, nil
+}
+
+func parseManifest(r io.Reader) (*Plan, error) {
+	var manifest struct {
+		Tasks []jsonTask `json:"tasks"`
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&manifest); err != nil {
+		return nil, err
+	}
+	var tasks []*Task
+	for _, jt := range manifest.Tasks {
+		t := &Task{
+			Name:    jt.Name,
+			Argv:    jt.Argv,
+			Env:     jt.Env,
+			Dir:     jt.Dir,
+			Retries: jt.Retries,
+			Deps:    jt.Deps,
+		}
+		if jt.Timeout != "" {
+			d, err := time.ParseDuration(jt.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("task %q: %v", jt.Name, err)
+			}
+			t.Timeout = d
+		}
+		tasks = append(tasks, t)
+	}
+	return newPlan(tasks)
+}
+
+// NewPlan returns a plan consisting of the specified tasks. NewPlan returns
+// an error if task names are empty or not unique, if a task has no
+// command line, or depends on an unknown task, or if the dependencies form
+// a cycle.
+func NewPlan(tasks ...*Task) (*Plan, error) {
+	plan, err := newPlan(tasks)
+	if err != nil {
+		return nil, fmt.Errorf("execx: plan: %w", err)
+	}
+	return plan, nil
+}
+
+func newPlan(tasks []*Task) (*Plan, error) {
+	p := &Plan{Tasks: tasks, byName: make(map[string]*Task)}
+	for _, t := range tasks {
+		if t.Name == "" {
+			return nil, errors.New("task with empty name")
+		}
+		if _, ok := p.byName[t.Name]; ok {
+			return nil, fmt.Errorf("duplicate task %q", t.Name)
+		}
+		if len(t.Argv) == 0 {
+			return nil, fmt.Errorf("task %q: empty argv", t.Name)
+		}
+		p.byName[t.Name] = t
+	}
+	for _, t := range tasks {
+		for _, dep := range t.Deps {
+			if _, ok := p.byName[dep]; !ok {
+				return nil, fmt.Errorf("task %q: unknown dependency %q", t.Name, dep)
+			}
+		}
+	}
+	if cycle := p.cycle(); cycle != nil {
+		return nil, fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " → "))
+	}
+	return p, nil
+}
+
+// cycle returns a dependency cycle in p, if there is one.
+func (p *Plan) cycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var stack []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, n := range stack {
+				if n == name {
+					return append(stack[i:len(stack):len(stack)], name)
+				}
+			}
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range p.byName[name].Deps {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, t := range p.Tasks {
+		if cycle := visit(t.Name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// PlanError records the failure of a plan.
+type PlanError struct {
+	// Errs maps the names of the tasks which failed to their errors.
+	Errs map[string]error
+
+	// Skipped holds the names of the tasks which were not run, because
+	// some of their dependencies failed, sorted by name.
+	Skipped []string
+}
+
+func (e *PlanError) Error() string {
+	names := make([]string, 0, len(e.Errs))
+	for name := range e.Errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var msgs []string
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("task %q: %v", name, e.Errs[name]))
+	}
+	msg := "execx: " + strings.Join(msgs, "; ")
+	if len(e.Skipped) > 0 {
+		msg += fmt.Sprintf(" (skipped %s)", strings.Join(e.Skipped, ", "))
+	}
+	return msg
+}
+
+// Run runs the tasks in p using Run, and thus the runner carried by ctx.
+// Each task starts as soon as all of its dependencies have completed
+// successfully, so independent tasks run concurrently. The options are
+// applied to every task.
+//
+// If a task fails, it is retried up to Retries times. If it still fails
+// after being retried, its error carries the timing of all the attempts,
+// as per TimingOf, as a Timing detail named "timing", and tasks which
+// depend on it are skipped, but independent tasks run to completion. In
+// that case, Run returns a *PlanError. Run returns the results of the
+// last attempt to run each task which was run, keyed by task name.
+func (p *Plan) Run(ctx context.Context, opts ...Option) (map[string]*Result, error) {
+	var (
+		mu      sync.Mutex
+		results = make(map[string]*Result)
+		perr    = &PlanError{Errs: make(map[string]error)}
+		done    = make(map[string]chan struct{})
+		failed  = make(map[string]bool)
+		wg      sync.WaitGroup
+	)
+	for _, t := range p.Tasks {
+		done[t.Name] = make(chan struct{})
+	}
+	for _, t := range p.Tasks {
+		t := t
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[t.Name])
+			for _, dep := range t.Deps {
+				<-done[dep]
+			}
+			mu.Lock()
+			skip := false
+			for _, dep := range t.Deps {
+				skip = skip || failed[dep]
+			}
+			if skip {
+				failed[t.Name] = true
+				perr.Skipped = append(perr.Skipped, t.Name)
+			}
+			mu.Unlock()
+			if skip {
+				return
+			}
+			res, err := t.run(ctx, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			if res != nil {
+				results[t.Name] = res
+			}
+			if err != nil {
+				failed[t.Name] = true
+				perr.Errs[t.Name] = err
+			}
+		}()
+	}
+	wg.Wait()
+	if len(perr.Errs) == 0 {
+		return results, nil
+	}
+	sort.Strings(perr.Skipped)
+	return results, perr
+}
+
+// run runs t, retrying it if it fails.
+func (t *Task) run(ctx context.Context, opts []Option) (*Result, error) {
+	if t.Timeout > 0 {
+		opts = append(opts[:len(opts):len(opts)], WithTimeout(t.Timeout))
+	}
+	cmd := t.command()
+	var results []*Result
+	for attempt := 0; ; attempt++ {
+		res, err := Run(ctx, cmd, opts...)
+		results = append(results, res)
+		if err == nil || attempt >= t.Retries || ctx.Err() != nil {
+			if len(results) > 1 {
+				err = withTiming(err, results...)
+			}
+			return res, err
+		}
+		cmd = t.command()
+	}
+}
+
+// command returns a fresh command for t.
+func (t *Task) command() *exec.Cmd {
+	cmd := exec.Command(t.Argv[0], t.Argv[1:]...)
+	cmd.Dir = t.Dir
+	if len(t.Env) > 0 {
+		keys := make([]string, 0, len(t.Env))
+		for k := range t.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		cmd.Env = os.Environ()
+		for _, k := range keys {
+			cmd.Env = append(cmd.Env, k+"="+t.Env[k])
+		}
+	}
+	return cmd
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir := tempDir(t)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	self := strconv.Quote(os.Args[0])
+	writeFile(t, filepath.Join(dir, "tasks.json"), `{
+		"tasks": [
+			{"name": "first", "argv": [`+self+`], "env": {"EXECX_TEST": "echo"}},
+			{
+				"name": "second",
+				"argv": [`+self+`, "-x"],
+				"env": {"EXECX_TEST": "echo"},
+				"dir": "sub",
+				"timeout": "1m",
+				"retries": 2,
+				"deps": ["first"]
+			}
+		]
+	}`)
+	plan, err := execx.LoadManifest(filepath.Join(dir, "tasks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := plan.Tasks[1]
+	if second.Dir != filepath.Join(dir, "sub") {
+		t.Errorf("got dir %q, want %q", second.Dir, filepath.Join(dir, "sub"))
+	}
+	if second.Timeout != time.Minute || second.Retries != 2 {
+		t.Errorf("got timeout %v, retries %d", second.Timeout, second.Retries)
+	}
+	results, err := plan.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"first", "second"} {
+		if res := results[name]; res == nil || string(res.Stderr) != "echoed" {
+			t.Errorf("%s: got result %+v", name, res)
+		}
+	}
+	if !results["first"].Timeline.Exited.Before(results["second"].Timeline.Start) {
+		t.Errorf("second started before first exited")
+	}
+}
+
+func TestParseManifestErrors(t *testing.T) {
+	tests := []struct {
+		manifest string
+		message  string
+	}{
+		{`{"tasks": [{"name": "a"}]}`, `task "a": empty argv`},
+		{`{"tasks": [{"argv": ["true"]}]}`, "task with empty name"},
+		{`{"tasks": [{"name": "a", "argv": ["true"]}, {"name": "a", "argv": ["true"]}]}`, `duplicate task "a"`},
+		{`{"tasks": [{"name": "a", "argv": ["true"], "deps": ["b"]}]}`, `unknown dependency "b"`},
+		{`{"tasks": [{"name": "a", "argv": ["true"], "timeout": "soon"}]}`, `task "a": time: invalid duration`},
+		{`{"tasks": [{"name": "a", "argv": ["true"], "retry": 1}]}`, `unknown field "retry"`},
+		{`{"tasks": [
+			{"name": "a", "argv": ["true"], "deps": ["c"]},
+			{"name": "b", "argv": ["true"], "deps": ["a"]},
+			{"name": "c", "argv": ["true"], "deps": ["b"]}
+		]}`, "dependency cycle: a → c → b → a"},
+	}
+	for _, tt := range tests {
+		_, err := execx.ParseManifest(strings.NewReader(tt.manifest))
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("got error %v, want %q", err, tt.message)
+		}
+	}
+}
+
+func TestPlanFailure(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]int)
+	)
+	r := execx.RunnerFunc(func(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		name := cmd.Args[1]
+		calls[name]++
+		if name == "flaky" && calls[name] < 3 {
+			return nil, errors.New("flaked")
+		}
+		if name == "broken" {
+			return nil, errors.New("broke")
+		}
+		return &execx.Result{}, nil
+	})
+	plan, err := execx.NewPlan(
+		&execx.Task{Name: "flaky", Argv: []string{"run", "flaky"}, Retries: 2},
+		&execx.Task{Name: "broken", Argv: []string{"run", "broken"}, Retries: 1},
+		&execx.Task{Name: "after-flaky", Argv: []string{"run", "after-flaky"}, Deps: []string{"flaky"}},
+		&execx.Task{Name: "after-broken", Argv: []string{"run", "after-broken"}, Deps: []string{"broken"}},
+		&execx.Task{Name: "transitive", Argv: []string{"run", "transitive"}, Deps: []string{"after-broken", "flaky"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := plan.Run(execx.WithRunner(context.Background(), r))
+	var perr *execx.PlanError
+	if !errors.As(err, &perr) {
+		t.Fatalf("got %v, want *PlanError", err)
+	}
+	if len(perr.Errs) != 1 || perr.Errs["broken"] == nil {
+		t.Errorf("got errors %v, want only broken to fail", perr.Errs)
+	}
+	if want := []string{"after-broken", "transitive"}; !reflect.DeepEqual(perr.Skipped, want) {
+		t.Errorf("got skipped %q, want %q", perr.Skipped, want)
+	}
+	want := map[string]int{"flaky": 3, "broken": 2, "after-flaky": 1}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls %v, want %v", calls, want)
+	}
+	if results["after-flaky"] == nil {
+		t.Errorf("missing result for after-flaky")
+	}
+}
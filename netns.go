@@ -0,0 +1,31 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+// WithoutNetwork runs the command without access to the network.
+//
+// On Linux, the command runs in a new network namespace, which holds
+// nothing but a loopback interface that is down. If the calling process
+// is not privileged, the command also runs in a new user namespace, in
+// which it keeps its user and group IDs. The isolation mode is recorded
+// as a detail named "network" in errors produced by the command.
+//
+// On other platforms, network isolation is not supported, and the command
+// fails to start with a *StartError.
+func WithoutNetwork() Option {
+	return func(cfg *config) {
+		cfg.noNetwork = true
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// isolateNetwork configures cmd to run in a new network namespace, and
+// returns the isolation mode.
+func isolateNetwork(cmd *exec.Cmd) (string, error) {
+	attr := new(syscall.SysProcAttr)
+	if cmd.SysProcAttr != nil {
+		attr = copySysProcAttr(cmd.SysProcAttr)
+	}
+	attr.Cloneflags |= syscall.CLONE_NEWNET
+	mode := "netns"
+	if os.Geteuid() != 0 && attr.Cloneflags&syscall.CLONE_NEWUSER == 0 {
+		// Unprivileged processes may only create network namespaces
+		// inside user namespaces they own.
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{
+			{ContainerID: os.Geteuid(), HostID: os.Geteuid(), Size: 1},
+		}
+		attr.GidMappings = []syscall.SysProcIDMap{
+			{ContainerID: os.Getegid(), HostID: os.Getegid(), Size: 1},
+		}
+		attr.GidMappingsEnableSetgroups = false
+		mode = "netns+userns"
+	}
+	cmd.SysProcAttr = attr
+	return mode, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithoutNetwork(t *testing.T) {
+	self := selfCmd("dial")
+	_, err := execx.Run(context.Background(), self, execx.WithoutNetwork())
+	if runtime.GOOS != "linux" {
+		se, ok := err.(*execx.StartError)
+		if !ok {
+			t.Fatalf("got %v, want *StartError on %s", err, runtime.GOOS)
+		}
+		if got := se.Fields()["network"]; got != "unsupported" {
+			t.Fatalf("network = %v, want unsupported", got)
+		}
+		return
+	}
+	if se, ok := err.(*execx.StartError); ok {
+		t.Skipf("network namespaces not supported: %v", se)
+	}
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	switch mode := ee.Fields()["network"]; mode {
+	case "netns", "netns+userns":
+	default:
+		t.Fatalf("network = %v, want netns or netns+userns", mode)
+	}
+	if !strings.Contains(string(ee.Stderr), "unreachable") {
+		t.Fatalf("dial did not fail with an unreachable network: %s", ee.Stderr)
+	}
+}
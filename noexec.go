@@ -0,0 +1,117 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// WithShebangFallback runs scripts which lack the execute permission using
+// the interpreter named by their shebang line, as if by
+//
+//	interpreter [args] script [args]
+//
+// rather than failing to start them. Files without a shebang line are
+// not affected. WithShebangFallback has no effect on Windows, where files
+// have no execute permission.
+func WithShebangFallback() Option {
+	return func(cfg *config) {
+		cfg.shebangFallback = true
+	}
+}
+
+// A NotExecutableError reports that a command could not be started,
+// because its file lacks the execute permission. It is the Err of the
+// *StartError returned by Start, and wraps the underlying error, such as
+// EACCES.
+type NotExecutableError struct {
+	// Path is the path of the file.
+	Path string
+
+	// Mode is the mode of the file.
+	Mode os.FileMode
+
+	// Interpreter is the interpreter named by the shebang line of the
+	// file, if it is a script.
+	Interpreter string
+
+	Err error
+}
+
+func (e *NotExecutableError) Error() string {
+	msg := fmt.Sprintf("%s is not executable (mode %v): run chmod +x %s", e.Path, e.Mode.Perm(), e.Path)
+	if e.Interpreter != "" {
+		msg += fmt.Sprintf(", or run it using %s, such as by WithShebangFallback", e.Interpreter)
+	}
+	return msg
+}
+
+// Unwrap returns e.Err.
+func (e *NotExecutableError) Unwrap() error {
+	return e.Err
+}
+
+// maxShebang is the maximum length of a shebang line read by readShebang.
+const maxShebang = 256
+
+// notExecutable returns a *NotExecutableError describing the file at path,
+// if it is a regular file which lacks the execute permission, or nil.
+func notExecutable(path string, err error) *NotExecutableError {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	fi, serr := os.Stat(path)
+	if serr != nil || !fi.Mode().IsRegular() || fi.Mode()&0111 != 0 {
+		return nil
+	}
+	interp, _, _ := readShebang(path)
+	return &NotExecutableError{Path: path, Mode: fi.Mode(), Interpreter: interp, Err: err}
+}
+
+// readShebang parses the shebang line of the file at path, if any.
+func readShebang(path string) (interp string, args []string, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, false
+	}
+	defer f.Close()
+	buf := make([]byte, maxShebang)
+	n, _ := io.ReadFull(f, buf)
+	return parseShebang(string(buf[:n]))
+}
+
+// applyShebangFallback runs h.cmd using the interpreter named by its
+// shebang line, if it lacks the execute permission.
+func (h *Handle) applyShebangFallback() {
+	cmd := h.cmd
+	if nee := notExecutable(cmd.Path, nil); nee == nil || nee.Interpreter == "" {
+		return
+	}
+	interp, iargs, _ := readShebang(cmd.Path)
+	args := append([]string{interp}, iargs...)
+	args = append(args, cmd.Path)
+	if len(cmd.Args) > 1 {
+		args = append(args, cmd.Args[1:]...)
+	}
+	cmd.Path = interp
+	cmd.Args = args
+	h.cfg.collectors = append(h.cfg.collectors, CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "shebang_fallback", interp
+	}))
+}
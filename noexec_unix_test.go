@@ -0,0 +1,60 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestNotExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.sh")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\necho \"$@\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := execx.Run(context.Background(), exec.Command(path, "hello"))
+	var nee *execx.NotExecutableError
+	if !errors.As(err, &nee) {
+		t.Fatalf("got %v, want *NotExecutableError", err)
+	}
+	if nee.Path != path || nee.Interpreter != "/bin/sh" {
+		t.Errorf("got path %q, interpreter %q, want %q, %q", nee.Path, nee.Interpreter, path, "/bin/sh")
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("%v does not wrap os.ErrPermission", err)
+	}
+	if _, ok := err.(*execx.StartError); !ok {
+		t.Errorf("got %T, want *StartError", err)
+	}
+
+	res, err := execx.Run(context.Background(), exec.Command(path, "hello"), execx.WithShebangFallback())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "hello\n" {
+		t.Errorf("got %q, want %q", res.Stdout, "hello\n")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// oomWatch records the number of OOM kills in the cgroup of a process,
+// such that OOM kills can be detected after the process has exited.
+type oomWatch struct {
+	events string // path to memory.events
+	kills  int    // oom_kill count when the process started
+}
+
+// watchOOM starts watching for OOM kills in the cgroup of the process
+// with the specified pid. watchOOM returns nil if the cgroup of the process
+// cannot be determined, or if it does not expose memory.events, as is the
+// case with cgroup v1.
+func watchOOM(pid int) *oomWatch {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if !strings.HasPrefix(line, "0::") {
+			continue
+		}
+		events := filepath.Join("/sys/fs/cgroup", line[len("0::"):], "memory.events")
+		kills, ok := oomKills(events)
+		if !ok {
+			return nil
+		}
+		return &oomWatch{events: events, kills: kills}
+	}
+	return nil
+}
+
+// oomKilled reports whether a process which exited with the specified
+// state was likely killed by the OOM killer.
+func (w *oomWatch) oomKilled(ps *os.ProcessState) bool {
+	if w == nil {
+		return false
+	}
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() || ws.Signal() != syscall.SIGKILL {
+		return false
+	}
+	kills, ok := oomKills(w.events)
+	return ok && kills > w.kills
+}
+
+// oomKills returns the oom_kill counter from the memory.events file at
+// the specified path.
+func oomKills(path string) (int, bool) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, err := strconv.Atoi(fields[1])
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,234 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FilesEnv is the name of the environment variable which describes the
+// files handed off to a command using WithNamedFile, as a comma-separated
+// list of name=fd pairs, such as "http=3,admin=4". It serves the same
+// purpose as LISTEN_FDS and LISTEN_FDNAMES in systemd socket activation,
+// which cannot be used by a parent which is not PID 1 of the child, since
+// LISTEN_PID must be set to the PID of the child before it is known.
+const FilesEnv = "EXECX_FDS"
+
+// A namedFile is a file handed off to a command using WithNamedFile.
+type namedFile struct {
+	name string
+	f    *os.File
+}
+
+// WithNamedFile hands off f, such as a listening socket or the end of a
+// pipe, to the command, under name. The files are passed after those in
+// cmd.ExtraFiles, and after those passed using WithExtraFiles, in the
+// order of the calls to WithNamedFile. The mapping of names to file
+// descriptors is described to the child by the FilesEnv environment
+// variable, which InheritedFile reads.
+//
+// Names must be non-empty, unique, and must not contain '=' or ','. If a
+// name is invalid, or f is nil or closed, Start returns a *StartError
+// which wraps a *FileMappingError. The mapping is recorded as a detail
+// named "files" in errors produced by the command. It is not supported
+// on Windows.
+func WithNamedFile(name string, f *os.File) Option {
+	return func(cfg *config) {
+		cfg.namedFiles = append(cfg.namedFiles, namedFile{name: name, f: f})
+	}
+}
+
+// FileMappingError records an invalid file passed using WithNamedFile,
+// or an invalid FilesEnv variable.
+type FileMappingError struct {
+	// Name is the name of the file, if known.
+	Name string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *FileMappingError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("execx: file mapping: %v", e.Err)
+	}
+	return fmt.Sprintf("execx: file %q: %v", e.Name, e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *FileMappingError) Unwrap() error {
+	return e.Err
+}
+
+// A PassedFile describes a file handed off to a command using
+// WithNamedFile.
+type PassedFile struct {
+	// Name is the name of the file.
+	Name string `json:"name"`
+
+	// FD is the file descriptor of the file in the child process.
+	FD int `json:"fd"`
+
+	// Kind describes the file, such as "socket", "pipe" or "file".
+	Kind string `json:"kind"`
+}
+
+func (f PassedFile) String() string {
+	return fmt.Sprintf("%s=%d (%s)", f.Name, f.FD, f.Kind)
+}
+
+// fileKind returns a short description of the kind of f.
+func fileKind(f *os.File) string {
+	fi, err := f.Stat()
+	if err != nil {
+		return "unknown"
+	}
+	switch mode := fi.Mode(); {
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeNamedPipe != 0:
+		return "pipe"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	case mode.IsDir():
+		return "directory"
+	default:
+		return "file"
+	}
+}
+
+// validFileName reports whether name may be used with WithNamedFile.
+func validFileName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("empty name")
+	case strings.ContainsAny(name, "=,"):
+		return errors.New("name contains '=' or ','")
+	default:
+		return nil
+	}
+}
+
+// applyNamedFiles validates the files passed using WithNamedFile, adds
+// them to h.cmd.ExtraFiles, and describes them in the environment of the
+// command.
+func (h *Handle) applyNamedFiles() error {
+	cmd := h.cmd
+	seen := make(map[string]bool)
+	var passed []PassedFile
+	var pairs []string
+	for _, nf := range h.cfg.namedFiles {
+		err := validFileName(nf.name)
+		switch {
+		case err != nil:
+		case seen[nf.name]:
+			err = errors.New("duplicate name")
+		case nf.f == nil:
+			err = errors.New("nil file")
+		case nf.f.Fd() == ^uintptr(0):
+			err = os.ErrClosed
+		}
+		if err != nil {
+			return wrapStart(&FileMappingError{Name: nf.name, Err: err}, cmd, h.cfg.collectors)
+		}
+		seen[nf.name] = true
+		fd := 3 + len(cmd.ExtraFiles)
+		cmd.ExtraFiles = append(cmd.ExtraFiles, nf.f)
+		passed = append(passed, PassedFile{Name: nf.name, FD: fd, Kind: fileKind(nf.f)})
+		pairs = append(pairs, nf.name+"="+strconv.Itoa(fd))
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env[:len(env):len(env)], FilesEnv+"="+strings.Join(pairs, ","))
+	h.cfg.collectors = append(h.cfg.collectors, CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "files", passed
+	}))
+	return nil
+}
+
+// inherited holds the files described by FilesEnv, parsed once, such that
+// every file descriptor is owned by a single *os.File.
+var inherited struct {
+	once  sync.Once
+	files map[string]*os.File
+	err   error
+}
+
+// InheritedFiles returns the files handed off to the current process by
+// its parent, using WithNamedFile, by name. If the current process was not
+// started that way, InheritedFiles returns nil and a nil error. If the
+// FilesEnv variable is malformed, or names a file descriptor which is not
+// open, InheritedFiles returns a *FileMappingError.
+//
+// The files are created once, and the same files are returned by every
+// call. Closing a file closes the file descriptor.
+func InheritedFiles() (map[string]*os.File, error) {
+	inherited.once.Do(func() {
+		inherited.files, inherited.err = parseInheritedFiles(os.Getenv(FilesEnv))
+	})
+	if inherited.err != nil {
+		return nil, inherited.err
+	}
+	files := make(map[string]*os.File, len(inherited.files))
+	for name, f := range inherited.files {
+		files[name] = f
+	}
+	return files, nil
+}
+
+// InheritedFile returns the file handed off to the current process by its
+// parent under name, or nil if there is no such file. See InheritedFiles.
+func InheritedFile(name string) *os.File {
+	files, _ := InheritedFiles()
+	return files[name]
+}
+
+// parseInheritedFiles parses the value of FilesEnv.
+func parseInheritedFiles(s string) (map[string]*os.File, error) {
+	if s == "" {
+		return nil, nil
+	}
+	files := make(map[string]*os.File)
+	for _, pair := range strings.Split(s, ",") {
+		name, fdstr, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, &FileMappingError{Err: fmt.Errorf("malformed %s entry %q", FilesEnv, pair)}
+		}
+		fd, err := strconv.Atoi(fdstr)
+		if err != nil || fd < 3 {
+			return nil, &FileMappingError{Name: name, Err: fmt.Errorf("invalid file descriptor %q", fdstr)}
+		}
+		if _, ok := files[name]; ok {
+			return nil, &FileMappingError{Name: name, Err: errors.New("duplicate name")}
+		}
+		f := os.NewFile(uintptr(fd), name)
+		if f == nil {
+			return nil, &FileMappingError{Name: name, Err: fmt.Errorf("invalid file descriptor %d", fd)}
+		}
+		if _, err := f.Stat(); err != nil {
+			return nil, &FileMappingError{Name: name, Err: fmt.Errorf("file descriptor %d: %v", fd, err)}
+		}
+		files[name] = f
+	}
+	return files, nil
+}
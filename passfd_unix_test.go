@@ -0,0 +1,105 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithNamedFile(t *testing.T) {
+	t.Run("Handoff", func(t *testing.T) {
+		devnull, err := os.Open(os.DevNull)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer devnull.Close()
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		_, err = execx.Run(context.Background(), selfCmd("named-file"),
+			execx.WithExtraFiles(devnull),
+			execx.WithNamedFile("out", w))
+		w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "hello" {
+			t.Errorf("got %q, want %q", b, "hello")
+		}
+	})
+	t.Run("Detail", func(t *testing.T) {
+		_, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		_, err = execx.Run(context.Background(), selfCmd("on"), execx.WithNamedFile("out", w))
+		ee, ok := err.(*execx.ExitError)
+		if !ok {
+			t.Fatalf("got %v, want *ExitError", err)
+		}
+		var files []execx.PassedFile
+		for _, d := range ee.Details {
+			if d.Key == "files" {
+				files, _ = d.Value.([]execx.PassedFile)
+			}
+		}
+		want := execx.PassedFile{Name: "out", FD: 3, Kind: "pipe"}
+		if len(files) != 1 || files[0] != want {
+			t.Errorf("got files %v, want [%v]", files, want)
+		}
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		tests := []struct {
+			name string
+			opts []execx.Option
+		}{
+			{"empty", []execx.Option{execx.WithNamedFile("", os.Stdout)}},
+			{"separator", []execx.Option{execx.WithNamedFile("a,b", os.Stdout)}},
+			{"duplicate", []execx.Option{execx.WithNamedFile("out", os.Stdout), execx.WithNamedFile("out", os.Stderr)}},
+			{"closed", []execx.Option{execx.WithNamedFile("out", w)}},
+		}
+		for _, tt := range tests {
+			_, err := execx.Run(context.Background(), selfCmd("echo"), tt.opts...)
+			var ferr *execx.FileMappingError
+			if !errors.As(err, &ferr) {
+				t.Errorf("%s: got %v, want *FileMappingError", tt.name, err)
+			}
+			if _, ok := err.(*execx.StartError); !ok {
+				t.Errorf("%s: got %T, want *StartError", tt.name, err)
+			}
+		}
+	})
+}
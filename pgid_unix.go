@@ -0,0 +1,44 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// pgidOf returns the process group ID of the process started by cmd,
+// which has the specified pid.
+func pgidOf(cmd *exec.Cmd, pid int) int {
+	attr := cmd.SysProcAttr
+	if attr != nil && (attr.Setpgid || attr.Foreground) {
+		if attr.Pgid != 0 {
+			return attr.Pgid
+		}
+		return pid
+	}
+	if attr != nil && attr.Setsid {
+		return pid
+	}
+	return ownPGID()
+}
+
+// ownPGID returns the process group ID of the current process.
+func ownPGID() int {
+	return syscall.Getpgrp()
+}
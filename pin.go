@@ -0,0 +1,177 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// A PinnedResolver resolves each executable once, using another Resolver,
+// and pins the resolution for the life of the process, such that hot loops
+// which run the same commands repeatedly avoid repeated searches of $PATH,
+// and such that changes to $PATH made after the first resolution do not
+// change which executables run. Failures to resolve are pinned as well.
+//
+// When $PATH changes, the PinnedResolver resolves pinned names again, the
+// first time they are requested, to detect whether the change would alter
+// their resolution. If it would, the pinned resolution is kept, but the
+// drift is reported to OnDrift, counted in the statistics, and noted in
+// the Via field of the resolution.
+//
+// A PinnedResolver is safe for concurrent use by multiple goroutines.
+type PinnedResolver struct {
+	// Resolver locates executables. If Resolver is nil, PathResolver
+	// is used.
+	Resolver Resolver
+
+	// OnDrift, if not nil, is called when a change to $PATH would alter
+	// the resolution of a pinned executable.
+	OnDrift func(d *Drift)
+
+	mu    sync.Mutex
+	pins  map[string]*pin
+	stats ResolverStats
+}
+
+// PinnedPath is a PinnedResolver which locates executables in $PATH. To
+// resolve executables once per process, use WithResolver(PinnedPath).
+var PinnedPath = &PinnedResolver{Resolver: PathResolver}
+
+// A Drift records a change to $PATH which would alter the resolution of
+// a pinned executable.
+type Drift struct {
+	// Name is the name of the executable.
+	Name string
+
+	// Pinned is the pinned path of the executable, or the empty string
+	// if it was not found.
+	Pinned string
+
+	// Current is the path the executable resolves to using the current
+	// value of $PATH, or the empty string if it is not found.
+	Current string
+}
+
+func (d *Drift) String() string {
+	return fmt.Sprintf("%q pinned to %s, but $PATH now resolves it to %s", d.Name, orNotFound(d.Pinned), orNotFound(d.Current))
+}
+
+func orNotFound(path string) string {
+	if path == "" {
+		return "nothing"
+	}
+	return path
+}
+
+// ResolverStats holds statistics about a PinnedResolver.
+type ResolverStats struct {
+	// Hits is the number of resolutions served from the cache.
+	Hits int64
+
+	// Misses is the number of resolutions which were not cached.
+	Misses int64
+
+	// Rechecks is the number of resolutions which were repeated
+	// because $PATH changed.
+	Rechecks int64
+
+	// Drifts is the number of rechecks which found a different
+	// resolution.
+	Drifts int64
+}
+
+// pin is a pinned resolution.
+type pin struct {
+	orig    *Resolution // resolution, as pinned
+	res     *Resolution // resolution, with a note about drift, if any
+	err     error
+	pathEnv string // value of $PATH when the resolution was last checked
+}
+
+// Resolve returns the pinned resolution of name, resolving it first if
+// needed.
+func (p *PinnedResolver) Resolve(name string) (*Resolution, error) {
+	pathEnv := os.Getenv("PATH")
+	p.mu.Lock()
+	pn, ok := p.pins[name]
+	switch {
+	case !ok:
+		p.stats.Misses++
+	case pn.pathEnv == pathEnv:
+		p.stats.Hits++
+		p.mu.Unlock()
+		return pn.res, pn.err
+	default:
+		p.stats.Rechecks++
+	}
+	p.mu.Unlock()
+
+	r := p.Resolver
+	if r == nil {
+		r = PathResolver
+	}
+	res, err := r.Resolve(name)
+
+	p.mu.Lock()
+	if p.pins == nil {
+		p.pins = make(map[string]*pin)
+	}
+	if !ok {
+		pn = &pin{orig: res, res: res, err: err, pathEnv: pathEnv}
+		if existing, raced := p.pins[name]; raced {
+			pn = existing
+		} else {
+			p.pins[name] = pn
+		}
+		p.mu.Unlock()
+		return pn.res, pn.err
+	}
+	pn.pathEnv = pathEnv
+	pn.res = pn.orig
+	pinned, current := resolvedPath(pn.orig), resolvedPath(res)
+	var drift *Drift
+	if pinned != current {
+		p.stats.Drifts++
+		drift = &Drift{Name: name, Pinned: pinned, Current: current}
+		if pn.orig != nil {
+			noted := *pn.orig
+			noted.Via = append(noted.Via[:len(noted.Via):len(noted.Via)], "pinned; "+drift.String())
+			pn.res = &noted
+		}
+	}
+	res, err = pn.res, pn.err
+	p.mu.Unlock()
+	if drift != nil && p.OnDrift != nil {
+		p.OnDrift(drift)
+	}
+	return res, err
+}
+
+// Stats returns statistics about p.
+func (p *PinnedResolver) Stats() ResolverStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// resolvedPath returns the path of res, or the empty string if res is nil.
+func resolvedPath(res *Resolution) string {
+	if res == nil {
+		return ""
+	}
+	return res.Path
+}
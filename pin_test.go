@@ -0,0 +1,94 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestPinnedResolver(t *testing.T) {
+	dir1, dir2 := tempDir(t), tempDir(t)
+	writeExecutable(t, filepath.Join(dir1, "tool"), "#!/bin/sh\n")
+	writeExecutable(t, filepath.Join(dir2, "tool"), "#!/bin/sh\n")
+
+	var drifts []*execx.Drift
+	p := &execx.PinnedResolver{
+		Resolver: execx.DirResolver(dir1),
+		OnDrift:  func(d *execx.Drift) { drifts = append(drifts, d) },
+	}
+	t.Setenv("PATH", dir1)
+
+	pinned := filepath.Join(dir1, "tool")
+	for i := 0; i < 3; i++ {
+		res, err := p.Resolve("tool")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Path != pinned {
+			t.Fatalf("got %s, want %s", res.Path, pinned)
+		}
+	}
+	if _, err := p.Resolve("missing"); err == nil {
+		t.Fatal("resolved a missing executable")
+	}
+	if _, err := p.Resolve("missing"); err == nil {
+		t.Fatal("resolved a missing executable")
+	}
+	if got, want := p.Stats(), (execx.ResolverStats{Hits: 3, Misses: 2}); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+
+	// Changing $PATH such that the resolution would change keeps the
+	// pinned resolution, but reports the drift.
+	p.Resolver = execx.DirResolver(dir2, dir1)
+	t.Setenv("PATH", dir2+string(filepath.ListSeparator)+dir1)
+	res, err := p.Resolve("tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Path != pinned {
+		t.Errorf("got %s after changing $PATH, want pinned %s", res.Path, pinned)
+	}
+	if len(drifts) != 1 || drifts[0].Current != filepath.Join(dir2, "tool") || drifts[0].Pinned != pinned {
+		t.Fatalf("got drifts %v", drifts)
+	}
+	if !strings.Contains(res.String(), "$PATH now resolves it to "+filepath.Join(dir2, "tool")) {
+		t.Errorf("drift not noted in resolution: %v", res)
+	}
+	if _, err := p.Resolve("tool"); err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 1 {
+		t.Errorf("drift reported again without a change to $PATH")
+	}
+
+	// Changing $PATH back clears the note.
+	p.Resolver = execx.DirResolver(dir1)
+	t.Setenv("PATH", dir1)
+	res, err = p.Resolve("tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(res.String(), "pinned;") {
+		t.Errorf("drift still noted: %v", res)
+	}
+	if got, want := p.Stats(), (execx.ResolverStats{Hits: 4, Misses: 2, Rechecks: 2, Drifts: 1}); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// fGetPipeSize is F_GETPIPE_SZ, which package syscall does not define.
+const fGetPipeSize = 1032
+
+// pipeState returns the number of bytes buffered in the pipe f refers to,
+// and the capacity of the pipe. If f is not a pipe, or if its state cannot
+// be determined, ok is false.
+func pipeState(f *os.File) (buffered, capacity int, ok bool) {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeNamedPipe == 0 {
+		return 0, 0, false
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, 0, false
+	}
+	var errno syscall.Errno
+	rc.Control(func(fd uintptr) {
+		var n int32
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCINQ, uintptr(unsafe.Pointer(&n)))
+		if errno != 0 {
+			return
+		}
+		buffered = int(n)
+		var size uintptr
+		size, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, fGetPipeSize, 0)
+		capacity = int(size)
+	})
+	if errno != 0 {
+		return 0, 0, false
+	}
+	return buffered, capacity, true
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// A Pipeline is a sequence of commands, in which the standard output of
+// each command is connected to the standard input of the next, as in a
+// shell pipeline.
+type Pipeline struct {
+	// Cmds holds the commands of the pipeline, in order. The standard
+	// input of the first command and the standard output of the last
+	// command are handled as per Start. The standard input of the other
+	// commands and the standard output of all but the last command are
+	// replaced by the pipes which connect the commands.
+	Cmds []*exec.Cmd
+
+	// DeadlockTimeout, if positive, makes Run watch the commands while
+	// they run. If all the commands which are still running are blocked
+	// reading from empty pipes or writing to full pipes, and none of
+	// them makes any progress for DeadlockTimeout, Run kills them and
+	// returns a *DeadlockError which names the blocked commands,
+	// rather than hanging until the context is done. A command waiting
+	// for input from outside the pipeline counts as blocked as well.
+	// Deadlocks are detected on Linux only.
+	DeadlockTimeout time.Duration
+}
+
+// PipelineFromString parses s as a pipeline of commands separated by '|',
+// such as "grep -v '^#' | sort | uniq -c", and returns a Pipeline which
+// runs them without invoking a shell. It is useful for specifying
+// pipelines as strings in configuration files.
+//
+// Each command is split into words as per ParseCmdline: quotes and
+// backslash escapes are interpreted, and no expansion of any kind is
+// performed. Shell operators other than '|', such as "||", '&' or '>',
+// are rejected with an error, as are empty commands.
+func PipelineFromString(s string) (*Pipeline, error) {
+	stages, err := splitStages(s, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(stages[0]) == 0 {
+		return nil, errors.New("execx: empty pipeline")
+	}
+	p := new(Pipeline)
+	for _, words := range stages {
+		p.Cmds = append(p.Cmds, exec.Command(words[0], words[1:]...))
+	}
+	return p, nil
+}
+
+// String returns the commands of p, as per CmdlineQuoted, separated by
+// " | ", such that PipelineFromString parses the string back into p.
+func (p *Pipeline) String() string {
+	cmdlines := make([]string, 0, len(p.Cmds))
+	for _, cmd := range p.Cmds {
+		cmdlines = append(cmdlines, CmdlineQuoted(cmd))
+	}
+	return strings.Join(cmdlines, " | ")
+}
+
+// PipelineError records the failure of a Pipeline.
+type PipelineError struct {
+	// Stage is the index of the stage whose error is reported: as with
+	// the pipefail option of the shell, it is the last stage which
+	// failed.
+	Stage int
+
+	// Cmdlines holds the command lines of the stages, as per Cmdline.
+	Cmdlines []string
+
+	// Errs holds the error each stage failed with, such as an
+	// *ExitError, or nil if the stage succeeded.
+	Errs []error
+
+	// Results describes the run of each stage.
+	Results []*Result
+}
+
+func (e *PipelineError) Error() string {
+	msg := fmt.Sprintf("execx: pipeline stage %d (%s) failed: %v", e.Stage+1, e.Cmdlines[e.Stage], e.Errs[e.Stage])
+	failed := 0
+	for _, err := range e.Errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 1 {
+		msg += fmt.Sprintf(" (and %d more)", failed-1)
+	}
+	return msg
+}
+
+// Unwrap returns the error of the stage reported by e.
+func (e *PipelineError) Unwrap() error {
+	return e.Errs[e.Stage]
+}
+
+// ExitCode returns the exit code of the stage reported by e, as per the
+// pipefail option of the shell, or -1 if the stage did not exit, or if it
+// failed to start.
+func (e *PipelineError) ExitCode() int {
+	var ee *ExitError
+	if errors.As(e.Errs[e.Stage], &ee) {
+		return ee.ExitCode()
+	}
+	return -1
+}
+
+// Run starts the commands of p, configured by opts, and waits for all of
+// them to complete. It returns the Result of the last command, which holds
+// the output of the pipeline, if it was captured. Since the commands are
+// connected to one another, they are started using Start, rather than the
+// runner carried by ctx.
+//
+// If a command fails to start, the commands started before it are killed,
+// and Run returns the error Start failed with. If any command fails, Run
+// returns a *PipelineError, which holds the error of each command, and
+// reports the error of the last command which failed, as with the pipefail
+// option of the shell. Like with pipefail, a command killed by SIGPIPE,
+// because a command after it exited without reading all its input, counts
+// as failed. The timing of the pipeline as a whole, as per TimingOf, is
+// recorded as a Timing detail named "timing" in the error of the reported
+// command.
+func (p *Pipeline) Run(ctx context.Context, opts ...Option) (*Result, error) {
+	if len(p.Cmds) == 0 {
+		return nil, errors.New("execx: empty pipeline")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	handles := make([]*Handle, 0, len(p.Cmds))
+	var next *os.File // read end of the pipe to the next command
+	for i, cmd := range p.Cmds {
+		if next != nil {
+			cmd.Stdin = next
+		}
+		var r, w *os.File
+		var err error
+		if i < len(p.Cmds)-1 {
+			r, w, err = os.Pipe()
+			if err == nil {
+				cmd.Stdout = w
+			}
+		}
+		var h *Handle
+		if err == nil {
+			h, err = Start(ctx, cmd, opts...)
+		}
+		// The children hold their own copies of the pipes.
+		if next != nil {
+			next.Close()
+		}
+		if w != nil {
+			w.Close()
+		}
+		next = r
+		if err != nil {
+			if next != nil {
+				next.Close()
+			}
+			cancel()
+			for _, h := range handles {
+				h.Wait()
+			}
+			return nil, err
+		}
+		handles = append(handles, h)
+	}
+	var (
+		blocked []BlockedStage
+		stalled time.Duration
+	)
+	watched := make(chan struct{})
+	if p.DeadlockTimeout > 0 {
+		go func() {
+			defer close(watched)
+			blocked, stalled = watchDeadlock(handles, p.DeadlockTimeout)
+			if blocked != nil {
+				cancel()
+			}
+		}()
+	} else {
+		close(watched)
+	}
+	perr := &PipelineError{
+		Stage:    -1,
+		Cmdlines: make([]string, len(p.Cmds)),
+		Errs:     make([]error, len(p.Cmds)),
+		Results:  make([]*Result, len(p.Cmds)),
+	}
+	for i, h := range handles {
+		perr.Results[i], perr.Errs[i] = h.Wait()
+		perr.Cmdlines[i] = Cmdline(p.Cmds[i])
+		if perr.Errs[i] != nil {
+			perr.Stage = i
+		}
+	}
+	<-watched
+	res := perr.Results[len(p.Cmds)-1]
+	if blocked != nil {
+		derr := &DeadlockError{Stages: blocked, Stalled: stalled}
+		if perr.Stage >= 0 {
+			derr.Err = perr
+		}
+		return res, withTiming(derr, perr.Results...)
+	}
+	if perr.Stage < 0 {
+		return res, nil
+	}
+	return res, withTiming(perr, perr.Results...)
+}
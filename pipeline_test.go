@@ -0,0 +1,97 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestPipelineFromString(t *testing.T) {
+	p, err := execx.PipelineFromString(`grep -v '^#' | sort -k "2" |uniq -c 'a|b'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"grep", "-v", "^#"},
+		{"sort", "-k", "2"},
+		{"uniq", "-c", "a|b"},
+	}
+	if len(p.Cmds) != len(want) {
+		t.Fatalf("got %d commands, want %d", len(p.Cmds), len(want))
+	}
+	for i, cmd := range p.Cmds {
+		if !reflect.DeepEqual(cmd.Args, want[i]) {
+			t.Errorf("command %d: got %q, want %q", i, cmd.Args, want[i])
+		}
+	}
+	if got := p.String(); got != `grep -v '^#' | sort -k 2 | uniq -c 'a|b'` {
+		t.Errorf("got %s", got)
+	}
+	for _, s := range []string{"", "a |", "| b", "a | | b", "a || b", "a | b > c", "a |& b"} {
+		if _, err := execx.PipelineFromString(s); err == nil {
+			t.Errorf("%q: parsed", s)
+		}
+	}
+	if _, err := execx.ParseCmdline("a | b"); err == nil {
+		t.Errorf("ParseCmdline accepted a pipeline")
+	}
+}
+
+func TestPipelineRun(t *testing.T) {
+	first := selfCmd("echo")
+	first.Stdin = strings.NewReader("hello")
+	p := &execx.Pipeline{Cmds: []*exec.Cmd{first, selfCmd("echo"), selfCmd("echo")}}
+	res, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "hello" {
+		t.Errorf("got stdout %q, want %q", res.Stdout, "hello")
+	}
+}
+
+func TestPipelineRunPipefail(t *testing.T) {
+	p := &execx.Pipeline{Cmds: []*exec.Cmd{selfCmd("on"), selfCmd("on"), selfCmd("echo")}}
+	_, err := p.Run(context.Background())
+	var perr *execx.PipelineError
+	if !errors.As(err, &perr) {
+		t.Fatalf("got %v, want *PipelineError", err)
+	}
+	if perr.Stage != 1 {
+		t.Errorf("got stage %d, want 1", perr.Stage)
+	}
+	if perr.ExitCode() != 1 {
+		t.Errorf("got exit code %d, want 1", perr.ExitCode())
+	}
+	for i, err := range perr.Errs[:2] {
+		var ee *execx.ExitError
+		if !errors.As(err, &ee) {
+			t.Errorf("stage %d: got %v, want *ExitError", i, err)
+		}
+	}
+	if perr.Errs[2] != nil {
+		t.Errorf("stage 2: got %v, want success", perr.Errs[2])
+	}
+	if !strings.Contains(err.Error(), "(and 1 more)") {
+		t.Errorf("got %q", err)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which capture buffers are not
+// reused, such that a single large output does not stay in memory.
+const maxPooledBuffer = 4 << 20
+
+// copyBufferSize is the size of the buffers used to copy output.
+const copyBufferSize = 32 * 1024
+
+var (
+	capturePool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	copyPool    = sync.Pool{New: func() interface{} { return new([copyBufferSize]byte) }}
+)
+
+// getCapture returns an empty capture buffer.
+func getCapture() *bytes.Buffer {
+	return capturePool.Get().(*bytes.Buffer)
+}
+
+// putCapture makes b available for reuse.
+func putCapture(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	b.Reset()
+	capturePool.Put(b)
+}
+
+// Release makes the memory holding the captured output of the command
+// available for reuse by subsequent commands, reducing the load on the
+// garbage collector in programs which run many commands.
+//
+// Calling Release is optional. If it is not called, the memory is
+// reclaimed by the garbage collector, as usual. Release should only be
+// called once r, and the error returned along with it, are no longer
+// used: r.Stdout and r.Stderr, as well as the captured output referred
+// to by errors, such as the Stderr field of an *ExitError, or the Partial
+// field of an *OutputOverflowError, share that memory, and are
+// overwritten by subsequent commands. Release sets r.Stdout, r.Stderr,
+// r.CompressedStdout and r.CompressedStderr to nil. Calling Release more
+// than once has no effect. Results shared by a Group must not be
+// released.
+func (r *Result) Release() {
+	for _, b := range r.buffers {
+		putCapture(b)
+	}
+	r.buffers = nil
+	r.Stdout = nil
+	r.Stderr = nil
+	r.CompressedStdout = nil
+	r.CompressedStderr = nil
+}
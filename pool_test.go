@@ -0,0 +1,65 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestResultRelease(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		self := selfCmd("echo")
+		self.Stdin = strings.NewReader("hello")
+		res, err := execx.Run(context.Background(), self)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res.Stdout) != "hello" || string(res.Stderr) != "echoed" {
+			t.Fatalf("run %d: got output %q, %q, want %q, %q", i, res.Stdout, res.Stderr, "hello", "echoed")
+		}
+		res.Release()
+		if res.Stdout != nil || res.Stderr != nil {
+			t.Fatalf("run %d: output not cleared by Release", i)
+		}
+		res.Release()
+	}
+}
+
+func BenchmarkRunCapture(b *testing.B) {
+	for _, release := range []bool{false, true} {
+		name := "NoRelease"
+		if release {
+			name = "Release"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				self := selfCmd("echo")
+				self.Stdin = strings.NewReader(strings.Repeat("x", 64*1024))
+				res, err := execx.Run(context.Background(), self)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if release {
+					res.Release()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FreePort returns a TCP port on the loopback interface which is free at
+// the time of the call. Another process may claim the port before the
+// caller uses it, but that is unlikely, since the kernel allocates
+// ephemeral ports in sequence.
+func FreePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// WithFreePort allocates a free TCP port using FreePort, and substitutes
+// it for every occurrence of placeholder, such as "{port}", in the command
+// line arguments and the environment of the command. If cmd.Env is nil,
+// the environment is not altered. Ports are recorded in Result.Ports, by
+// placeholder, and as a detail named "ports" in errors produced by the
+// command.
+//
+// If no port can be allocated, the command fails to start with a
+// *StartError.
+func WithFreePort(placeholder string) Option {
+	return func(cfg *config) {
+		cfg.ports = append(cfg.ports, placeholder)
+	}
+}
+
+// allocatePorts allocates the ports requested by WithFreePort, and
+// injects them into h.cmd.
+func (h *Handle) allocatePorts() error {
+	h.ports = make(map[string]int)
+	for _, placeholder := range h.cfg.ports {
+		port, err := FreePort()
+		if err != nil {
+			return wrapStart(err, h.cmd, h.cfg.collectors)
+		}
+		h.ports[placeholder] = port
+		r := strings.NewReplacer(placeholder, strconv.Itoa(port))
+		for i := 1; i < len(h.cmd.Args); i++ {
+			h.cmd.Args[i] = r.Replace(h.cmd.Args[i])
+		}
+		for i, kv := range h.cmd.Env {
+			h.cmd.Env[i] = r.Replace(kv)
+		}
+	}
+	return nil
+}
+
+// Port returns the port allocated for placeholder by WithFreePort, or 0
+// if there is none.
+func (h *Handle) Port(placeholder string) int {
+	return h.ports[placeholder]
+}
+
+// portList describes ports, sorted by placeholder.
+type portList map[string]int
+
+func (pl portList) String() string {
+	names := make([]string, 0, len(pl))
+	for name := range pl {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, name+"="+strconv.Itoa(pl[name]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestFreePort(t *testing.T) {
+	port, err := execx.FreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("port %d not free: %v", port, err)
+	}
+	ln.Close()
+}
+
+func TestWithFreePort(t *testing.T) {
+	t.Run("Server", testWithFreePortServer)
+	t.Run("Failure", testWithFreePortFailure)
+}
+
+func testWithFreePortServer(t *testing.T) {
+	self := selfCmd("serve")
+	self.Env = append(self.Env, "EXECX_TEST_ADDR=127.0.0.1:{port}")
+	probe := execx.LogLine(regexp.MustCompile(`^listening on`))
+	h, err := execx.StartAndWaitReady(context.Background(), self, probe, execx.WithFreePort("{port}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Stop(time.Second)
+
+	port := h.Port("{port}")
+	if port == 0 {
+		t.Fatal("no port allocated")
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func testWithFreePortFailure(t *testing.T) {
+	self := selfCmd("on")
+	self.Args = append(self.Args, "-listen=:{port}")
+	_, err := execx.Run(context.Background(), self, execx.WithFreePort("{port}"))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	port := ee.Result.Ports["{port}"]
+	if port == 0 {
+		t.Fatal("port not recorded in Result")
+	}
+	if want := fmt.Sprintf("-listen=:%d", port); ee.Args[len(ee.Args)-1] != want {
+		t.Errorf("got argument %q, want %q", ee.Args[len(ee.Args)-1], want)
+	}
+	if got := fmt.Sprint(ee.Fields()["ports"]); got != fmt.Sprintf("{port}=%d", port) {
+		t.Errorf("got ports detail %q", got)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProcStats holds the I/O and scheduler statistics of a process, as
+// reported by /proc/<pid>/io and /proc/<pid>/schedstat on Linux, read
+// just before the process is reaped. Comparing RunDelay to OnCPU tells a
+// command which was slow because it was starved of CPU apart from one
+// which was slow because it was waiting for I/O.
+type ProcStats struct {
+	// ReadBytes and WriteBytes are the number of bytes the process
+	// caused to be fetched from, and sent to, the storage layer.
+	ReadBytes  uint64
+	WriteBytes uint64
+
+	// ReadChars and WriteChars are the number of bytes the process
+	// read and wrote using system calls, including from and to pipes,
+	// sockets and the page cache.
+	ReadChars  uint64
+	WriteChars uint64
+
+	// ReadSyscalls and WriteSyscalls are the number of read and write
+	// system calls the process made.
+	ReadSyscalls  uint64
+	WriteSyscalls uint64
+
+	// OnCPU is the time the main thread of the process spent running.
+	OnCPU time.Duration
+
+	// RunDelay is the time the main thread of the process spent
+	// runnable, but waiting on a run queue.
+	RunDelay time.Duration
+
+	// Timeslices is the number of timeslices the main thread of the
+	// process ran for.
+	Timeslices uint64
+}
+
+func (s *ProcStats) String() string {
+	return fmt.Sprintf("read %s (%s in syscalls), wrote %s (%s in syscalls), on cpu %v, run delay %v",
+		formatBytes(s.ReadBytes), formatBytes(s.ReadChars),
+		formatBytes(s.WriteBytes), formatBytes(s.WriteChars),
+		s.OnCPU.Round(time.Microsecond), s.RunDelay.Round(time.Microsecond))
+}
+
+// WithProcStats captures the I/O and scheduler statistics of the process
+// just before it is reaped, in Result.ProcStats, and as a *ProcStats
+// detail named "proc_stats" in errors produced by the command.
+// WithProcStats is supported on Linux only, and does nothing on other
+// platforms.
+func WithProcStats() Option {
+	return func(cfg *config) {
+		cfg.procStats = true
+	}
+}
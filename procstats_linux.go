@@ -0,0 +1,105 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// awaitZombie waits for the child process with the specified pid to
+// exit, without reaping it, such that its entries in /proc can still be
+// read. awaitZombie reports false if the process cannot be waited for,
+// such as if it was reaped by someone else.
+func awaitZombie(pid int) bool {
+	var info [128]byte // siginfo_t
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, uintptr(pPID), uintptr(pid), uintptr(unsafe.Pointer(&info[0])), syscall.WEXITED|wNowait, 0, 0)
+		if errno != syscall.EINTR {
+			return errno == 0
+		}
+	}
+}
+
+// readProcStats reads the statistics of the process with the specified
+// pid, or returns nil if they are not available.
+func readProcStats(pid int) *ProcStats {
+	st := new(ProcStats)
+	if err := readProcIO(pid, st); err != nil {
+		return nil
+	}
+	readSchedstat(pid, st)
+	return st
+}
+
+// readProcIO reads /proc/<pid>/io into st.
+func readProcIO(pid int, st *ProcStats) error {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/io", pid))
+	if err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "rchar":
+			st.ReadChars = n
+		case "wchar":
+			st.WriteChars = n
+		case "syscr":
+			st.ReadSyscalls = n
+		case "syscw":
+			st.WriteSyscalls = n
+		case "read_bytes":
+			st.ReadBytes = n
+		case "write_bytes":
+			st.WriteBytes = n
+		}
+	}
+	return nil
+}
+
+// readSchedstat reads /proc/<pid>/schedstat into st. It holds the time
+// spent on the CPU and on a run queue, in nanoseconds, and the number of
+// timeslices.
+func readSchedstat(pid int, st *ProcStats) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/schedstat", pid))
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 3 {
+		return
+	}
+	oncpu, _ := strconv.ParseInt(fields[0], 10, 64)
+	delay, _ := strconv.ParseInt(fields[1], 10, 64)
+	st.OnCPU = time.Duration(oncpu)
+	st.RunDelay = time.Duration(delay)
+	st.Timeslices, _ = strconv.ParseUint(fields[2], 10, 64)
+}
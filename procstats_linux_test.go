@@ -0,0 +1,66 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithProcStats(t *testing.T) {
+	res, err := execx.Run(context.Background(), selfCmd("flood"), execx.WithProcStats())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	st := res.ProcStats
+	if st == nil {
+		t.Fatal("no process statistics in Result")
+	}
+	if st.WriteChars < 1<<20 || st.WriteSyscalls == 0 {
+		t.Errorf("got %d bytes written in %d syscalls, want at least 1MiB", st.WriteChars, st.WriteSyscalls)
+	}
+	if st.OnCPU == 0 {
+		t.Errorf("got no time on CPU: %v", st)
+	}
+
+	_, err = execx.Run(context.Background(), selfCmd("on"), execx.WithProcStats())
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	v, ok := ee.Detail("proc_stats")
+	if !ok || v.(*execx.ProcStats) != ee.Result.ProcStats {
+		t.Fatalf("got proc_stats detail %v", v)
+	}
+	if s := v.(*execx.ProcStats).String(); !strings.Contains(s, "run delay") {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestWithProcStatsCentral(t *testing.T) {
+	execx.SetWaitStrategy(execx.WaitCentral)
+	defer execx.SetWaitStrategy(execx.WaitPerChild)
+	res, err := execx.Run(context.Background(), selfCmd("flood"), execx.WithProcStats())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if res.ProcStats == nil || res.ProcStats.WriteChars < 1<<20 {
+		t.Errorf("got %v", res.ProcStats)
+	}
+}
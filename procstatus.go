@@ -0,0 +1,112 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ProcStatus holds highlights of the status of a process, as reported by
+// /proc/<pid>/status on Linux.
+type ProcStatus struct {
+	// Threads is the number of threads.
+	Threads int
+
+	// FDs is the number of open file descriptors.
+	FDs int
+
+	// VMPeak is the peak virtual memory size, in bytes.
+	VMPeak uint64
+
+	// VMHWM is the peak resident set size, in bytes.
+	VMHWM uint64
+
+	// Sampled is the time at which the status was sampled.
+	Sampled time.Time
+}
+
+func (s *ProcStatus) String() string {
+	return fmt.Sprintf("threads=%d fds=%d vm_peak=%dkB vm_hwm=%dkB", s.Threads, s.FDs, s.VMPeak/1024, s.VMHWM/1024)
+}
+
+// procSampleInterval is the interval at which WithProcStatus samples the
+// status of the process.
+const procSampleInterval = 100 * time.Millisecond
+
+// WithProcStatus samples highlights of the status of the process while
+// it runs, such as its number of threads and open file descriptors, and
+// its peak memory usage. The last sample, taken shortly before the process
+// is reaped, is recorded as a *ProcStatus detail named "proc_status" in
+// errors produced by the command. WithProcStatus is supported on Linux
+// only, and does nothing on other platforms.
+func WithProcStatus() Option {
+	return func(cfg *config) {
+		cfg.procStatus = true
+	}
+}
+
+// procSampler periodically samples the status of a process.
+type procSampler struct {
+	mu   sync.Mutex
+	last *ProcStatus
+}
+
+// sampleProc samples the status of the process with the specified pid
+// until exited is closed, recording panics in ie. sampleProc returns nil
+// if process status is not available on this platform.
+func sampleProc(pid int, exited <-chan struct{}, ie *internalErrors) *procSampler {
+	if !procStatusSupported {
+		return nil
+	}
+	s := new(procSampler)
+	go func() {
+		defer ie.catch("sample process status")
+		t := time.NewTicker(procSampleInterval)
+		defer t.Stop()
+		for {
+			st, err := readProcStatus(pid)
+			select {
+			case <-exited:
+				// The process may have been reaped while it was
+				// being sampled, and the sample may be bogus.
+				return
+			default:
+			}
+			if err == nil {
+				s.mu.Lock()
+				s.last = st
+				s.mu.Unlock()
+			}
+			select {
+			case <-t.C:
+			case <-exited:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// status returns the last sample, or nil if there is none.
+func (s *procSampler) status() *ProcStatus {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
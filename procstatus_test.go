@@ -0,0 +1,69 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestProcessIDs(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.PID != ee.Pid() || ee.PID == 0 {
+		t.Errorf("got PID %d, want %d", ee.PID, ee.Pid())
+	}
+	if ee.PPID != os.Getpid() {
+		t.Errorf("got PPID %d, want %d", ee.PPID, os.Getpid())
+	}
+	if runtime.GOOS != "windows" && ee.PGID == 0 {
+		t.Error("PGID not recorded")
+	}
+	want := fmt.Sprintf("pid: %d ppid: %d pgid: %d\n", ee.PID, ee.PPID, ee.PGID)
+	if s := fmt.Sprintf("%+v", ee); !strings.Contains(s, want) {
+		t.Errorf("%%+v output missing %q:\n%s", want, s)
+	}
+}
+
+func TestWithProcStatus(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("hang"), execx.WithProcStatus(), execx.WithTimeout(300*time.Millisecond))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	st, ok := ee.Fields()["proc_status"].(*execx.ProcStatus)
+	if runtime.GOOS != "linux" {
+		if ok {
+			t.Errorf("got process status %v on %s", st, runtime.GOOS)
+		}
+		return
+	}
+	if !ok {
+		t.Fatal("process status not recorded")
+	}
+	if st.Threads < 1 || st.FDs < 3 || st.VMPeak == 0 || st.VMHWM == 0 {
+		t.Errorf("implausible process status %v", st)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A ProcNode describes a process in a snapshot of a process tree.
+type ProcNode struct {
+	// PID is the process ID of the process.
+	PID int `json:"pid"`
+
+	// Name is the name of the command the process is running.
+	Name string `json:"name"`
+
+	// State is the state of the process, as reported by the operating
+	// system, such as "S" for sleeping, or "R" for running, on Linux.
+	State string `json:"state"`
+
+	// CPU is the CPU time, user and system, the process consumed.
+	CPU time.Duration `json:"cpu"`
+
+	// Children holds the children of the process.
+	Children []*ProcNode `json:"children,omitempty"`
+}
+
+// String returns a description of the tree rooted at n, one process per
+// line, indented by depth, such as
+//
+//	4242 make (S, cpu 1.2s)
+//		4250 sh (S, cpu 10ms)
+//			4251 curl (S, cpu 30ms)
+func (n *ProcNode) String() string {
+	sb := new(strings.Builder)
+	n.format(sb, 0)
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func (n *ProcNode) format(sb *strings.Builder, depth int) {
+	fmt.Fprintf(sb, "%s%d %s (%s, cpu %v)\n", strings.Repeat("\t", depth), n.PID, n.Name, n.State, n.CPU)
+	for _, c := range n.Children {
+		c.format(sb, depth+1)
+	}
+}
+
+// snapshotTree records a snapshot of the process tree of h, if the
+// platform supports it, before the process is killed because it timed
+// out. The snapshot is attached to the *ExitError as a *ProcNode detail
+// named "process_tree".
+func (h *Handle) snapshotTree() {
+	tree := procTree(h.cmd.Process.Pid)
+	if tree == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tree = tree
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the number of clock ticks per second, in which CPU times
+// are reported in /proc/<pid>/stat. It is 100 on all supported
+// architectures.
+const clockTicks = 100
+
+// procTree returns a snapshot of the tree of processes rooted at pid, read
+// from /proc, or nil if the process cannot be found.
+func procTree(pid int) *ProcNode {
+	d, err := os.Open("/proc")
+	if err != nil {
+		return nil
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return nil
+	}
+	nodes := make(map[int]*ProcNode)
+	children := make(map[int][]int)
+	for _, name := range names {
+		p, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		node, ppid, ok := readProcStat(p)
+		if !ok {
+			continue
+		}
+		nodes[p] = node
+		children[ppid] = append(children[ppid], p)
+	}
+	root := nodes[pid]
+	if root == nil {
+		return nil
+	}
+	var link func(n *ProcNode)
+	link = func(n *ProcNode) {
+		kids := children[n.PID]
+		sort.Ints(kids)
+		for _, k := range kids {
+			if c := nodes[k]; c != nil && k != n.PID {
+				n.Children = append(n.Children, c)
+				link(c)
+			}
+		}
+	}
+	link(root)
+	return root
+}
+
+// readProcStat reads the name, state, CPU time and parent PID of the
+// process with the specified pid from /proc/<pid>/stat.
+func readProcStat(pid int) (node *ProcNode, ppid int, ok bool) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, 0, false
+	}
+	// The command name, in parentheses, may contain spaces. The state,
+	// and the parent PID follow it. User and system time are the 12th
+	// and 13th fields after the name.
+	s := string(b)
+	lp, rp := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if lp < 0 || rp < lp {
+		return nil, 0, false
+	}
+	fields := strings.Fields(s[rp+1:])
+	if len(fields) < 13 {
+		return nil, 0, false
+	}
+	ppid, _ = strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	node = &ProcNode{
+		PID:   pid,
+		Name:  s[lp+1 : rp],
+		State: fields[0],
+		CPU:   time.Duration(utime+stime) * time.Second / clockTicks,
+	}
+	return node, ppid, true
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestProcessTreeOnTimeout(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("hang-tree"), execx.WithTimeout(500*time.Millisecond))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	v, ok := ee.Detail("process_tree")
+	if !ok {
+		t.Fatal("process tree not attached to error")
+	}
+	tree := v.(*execx.ProcNode)
+	if tree.PID != ee.PID {
+		t.Errorf("got root pid %d, want %d", tree.PID, ee.PID)
+	}
+	if len(tree.Children) != 1 {
+		t.Fatalf("got %d children, want 1:\n%v", len(tree.Children), tree)
+	}
+	if tree.Children[0].State == "" || tree.Children[0].Name == "" {
+		t.Errorf("incomplete child %+v", tree.Children[0])
+	}
+	if !strings.Contains(fmt.Sprintf("%+v", ee), fmt.Sprintf("\n\t%d ", tree.Children[0].PID)) {
+		t.Errorf("process tree missing from %%+v output:\n%+v", ee)
+	}
+}
+
+func TestProcessTreeNotOnFailure(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"), execx.WithTimeout(time.Minute))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if _, ok := ee.Detail("process_tree"); ok {
+		t.Errorf("process tree attached to error from a command which did not time out")
+	}
+}
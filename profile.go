@@ -0,0 +1,141 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"acln.ro/execx/errcode"
+)
+
+// A Profile is a named group of environment variables, such as the
+// variables which make Go builds hermetic, or which select a version of
+// Node.js, registered using RegisterProfile, and applied to commands using
+// WithProfile.
+type Profile struct {
+	// Env holds variables set as if by WithEnv.
+	Env map[string]string
+
+	// DefaultEnv holds variables set as if by WithDefaultEnv.
+	DefaultEnv map[string]string
+}
+
+// ErrUnknownProfile is returned, wrapped in a *StartError, by Start, if
+// a profile requested using WithProfile was not registered.
+var ErrUnknownProfile = newCodedError("execx: unknown environment profile", errcode.InvalidArgument)
+
+var profiles struct {
+	sync.Mutex
+	m map[string]Profile
+}
+
+// RegisterProfile registers p under name, replacing the profile previously
+// registered under name, if any. Profiles are typically registered at
+// startup, such as from configuration files. RegisterProfile is safe to
+// call from multiple goroutines concurrently.
+func RegisterProfile(name string, p Profile) {
+	profiles.Lock()
+	defer profiles.Unlock()
+	if profiles.m == nil {
+		profiles.m = make(map[string]Profile)
+	}
+	profiles.m[name] = Profile{Env: copyMap(p.Env), DefaultEnv: copyMap(p.DefaultEnv)}
+}
+
+// lookupProfile returns the profile registered under name.
+func lookupProfile(name string) (Profile, bool) {
+	profiles.Lock()
+	defer profiles.Unlock()
+	p, ok := profiles.m[name]
+	return p, ok
+}
+
+// WithProfile applies the profile registered under name using
+// RegisterProfile to the environment of the command. Variables in Env
+// override inherited variables, variables set in cmd.Env, and variables
+// set by AsUser and IsolatedHome, but not variables set by WithEnv. If
+// multiple profiles are applied, later profiles win. The profile is
+// looked up when the command starts: if it was not registered, Start
+// fails with an error which wraps ErrUnknownProfile.
+//
+// If the command fails, the *ExitError records the names of the profiles
+// applied in Profiles, and the origin of each variable in EnvSources.
+func WithProfile(name string) Option {
+	src := envCaller(EnvProfile)
+	src.Profile = name
+	return func(cfg *config) {
+		cfg.profiles = append(cfg.profiles, profileRef{name: name, src: src})
+	}
+}
+
+// profileRef is a profile requested by WithProfile.
+type profileRef struct {
+	name string
+	src  EnvSource
+}
+
+// profileEnv returns the settings made by the profiles in refs.
+func profileEnv(refs []profileRef) ([]envSetting, error) {
+	var settings []envSetting
+	for _, ref := range refs {
+		p, ok := lookupProfile(ref.name)
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownProfile, ref.name)
+		}
+		for _, k := range sortedKeys(p.DefaultEnv) {
+			settings = append(settings, envSetting{key: k, value: p.DefaultEnv[k], src: ref.src, dflt: true})
+		}
+		for _, k := range sortedKeys(p.Env) {
+			settings = append(settings, envSetting{key: k, value: p.Env[k], src: ref.src})
+		}
+	}
+	return settings, nil
+}
+
+// profileNames returns the names of the profiles in refs.
+func profileNames(refs []profileRef) []string {
+	if len(refs) == 0 {
+		return nil
+	}
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.name
+	}
+	return names
+}
+
+// copyMap returns a copy of m, or nil if m is empty.
+func copyMap(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// sortedKeys returns the keys of m, sorted.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithProfile(t *testing.T) {
+	execx.RegisterProfile("test-ci", execx.Profile{
+		Env:        map[string]string{"EXECX_CI": "true", "EXECX_SHARED": "ci"},
+		DefaultEnv: map[string]string{"EXECX_TEST": "off", "EXECX_LEVEL": "debug"},
+	})
+	execx.RegisterProfile("test-node", execx.Profile{
+		Env: map[string]string{"EXECX_SHARED": "node", "EXECX_EXPLICIT": "profile"},
+	})
+	_, file, line, _ := runtime.Caller(0)
+	_, err := execx.Run(context.Background(), selfCmd("on"),
+		execx.WithProfile("test-ci"),
+		execx.WithProfile("test-node"),
+		execx.WithEnv("EXECX_EXPLICIT", "explicit"),
+	)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	wantEnv := map[string]string{
+		"EXECX_CI":       "true",
+		"EXECX_SHARED":   "node",     // later profiles win
+		"EXECX_TEST":     "on",       // defaults do not override cmd.Env
+		"EXECX_LEVEL":    "debug",    // but apply otherwise
+		"EXECX_EXPLICIT": "explicit", // WithEnv wins over profiles
+	}
+	for k, v := range wantEnv {
+		if got := ee.ChildEnv[k]; got != v {
+			t.Errorf("%s: got %q, want %q", k, got, v)
+		}
+	}
+	want := execx.EnvSource{Origin: execx.EnvProfile, Profile: "test-node", File: file, Line: line + 3}
+	if got := ee.EnvSources["EXECX_SHARED"]; got != want {
+		t.Errorf("EXECX_SHARED: got source %v, want %v", got, want)
+	}
+	if got := fmt.Sprint(ee.Profiles); got != "[test-ci test-node]" {
+		t.Errorf("got profiles %s", got)
+	}
+	detail := fmt.Sprintf("%+v", ee)
+	for _, s := range []string{
+		"profiles: test-ci, test-node\n",
+		fmt.Sprintf("\tEXECX_CI: WithProfile(%q) at %s:%d\n", "test-ci", file, line+2),
+	} {
+		if !strings.Contains(detail, s) {
+			t.Errorf("%%+v does not contain %q:\n%s", s, detail)
+		}
+	}
+}
+
+func TestWithProfileUnknown(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithProfile("test-missing"))
+	var se *execx.StartError
+	if !errors.As(err, &se) || !errors.Is(err, execx.ErrUnknownProfile) {
+		t.Fatalf("got %v, want *StartError wrapping ErrUnknownProfile", err)
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress describes the progress of a command, as reported in its output.
+type Progress struct {
+	// Fraction is the fraction of the work completed, between 0 and 1,
+	// or -1 if it is not known.
+	Fraction float64
+
+	// Rate is the rate at which work is done, in units specific to the
+	// tool: bytes per second for curl and rsync, and the ratio of media
+	// time to wall time for ffmpeg. It is 0 if not known.
+	Rate float64
+
+	// ETA is the estimated time until the work completes, or 0 if it
+	// is not known.
+	ETA time.Duration
+
+	// Line is the line of output the progress was parsed from.
+	Line string
+
+	// Time is the time the line was read.
+	Time time.Time
+}
+
+func (p Progress) String() string {
+	var parts []string
+	if p.Fraction >= 0 {
+		parts = append(parts, strconv.FormatFloat(p.Fraction*100, 'f', 1, 64)+"%")
+	} else {
+		parts = append(parts, "unknown progress")
+	}
+	if p.Rate > 0 {
+		parts = append(parts, "rate "+strconv.FormatFloat(p.Rate, 'g', 4, 64)+"/s")
+	}
+	if p.ETA > 0 {
+		parts = append(parts, "ETA "+p.ETA.Round(time.Second).String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// A ProgressParser parses a line of output of a command into a Progress.
+// It reports false if the line does not describe progress. The Time field
+// of the Progress is set by the caller.
+//
+// Lines are delimited by carriage returns, as well as newlines, since
+// tools which draw progress bars on terminals typically rewrite the
+// current line in place.
+type ProgressParser func(line string) (Progress, bool)
+
+// WithProgress parses the standard output and standard error of the
+// command using parser, and calls fn with each Progress it reports.
+// Calls to fn are serialized, and made from the goroutines which copy
+// the output of the command, so fn should return quickly: output is not
+// read further while fn runs.
+//
+// If the command fails, the last Progress reported is recorded as
+// a detail named "progress" of the *ExitError.
+func WithProgress(parser ProgressParser, fn func(Progress)) Option {
+	return func(cfg *config) {
+		cfg.progress = &progressConfig{parser: parser, fn: fn}
+	}
+}
+
+type progressConfig struct {
+	parser ProgressParser
+	fn     func(Progress)
+}
+
+// progressTracker tracks the progress of a command, as configured by
+// WithProgress.
+type progressTracker struct {
+	cfg     *progressConfig
+	clock   Clock
+	writers []*progressWriter
+
+	mu   sync.Mutex // protects last, and serializes calls to cfg.fn
+	last *Progress
+}
+
+// trackProgress sets up writers which parse the output of the command
+// into progress reports, if configured.
+func (h *Handle) trackProgress() {
+	if h.cfg.progress == nil {
+		return
+	}
+	pt := &progressTracker{cfg: h.cfg.progress, clock: h.clock}
+	stdout, stderr := &progressWriter{pt: pt}, &progressWriter{pt: pt}
+	pt.writers = []*progressWriter{stdout, stderr}
+	h.progress = pt
+	h.cfg.stdoutWriters = append(h.cfg.stdoutWriters, stdout)
+	h.cfg.stderrWriters = append(h.cfg.stderrWriters, stderr)
+}
+
+// report parses line, and reports the progress it describes, if any.
+func (pt *progressTracker) report(line string) {
+	p, ok := pt.cfg.parser(line)
+	if !ok {
+		return
+	}
+	p.Time = pt.clock.Now()
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.last = &p
+	if pt.cfg.fn != nil {
+		pt.cfg.fn(p)
+	}
+}
+
+// flush reports incomplete last lines. It is called once the outputs
+// have been consumed.
+func (pt *progressTracker) flush() {
+	if pt == nil {
+		return
+	}
+	for _, w := range pt.writers {
+		w.flush()
+	}
+}
+
+// latest returns the last progress reported, if any.
+func (pt *progressTracker) latest() *Progress {
+	if pt == nil {
+		return nil
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return pt.last
+}
+
+// progressWriter splits output into lines delimited by carriage returns
+// or newlines, and reports them to its tracker.
+type progressWriter struct {
+	pt      *progressTracker
+	partial []byte
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\r' && b != '\n' {
+			pw.partial = append(pw.partial, b)
+			continue
+		}
+		pw.flush()
+	}
+	return len(p), nil
+}
+
+func (pw *progressWriter) flush() {
+	if len(pw.partial) > 0 {
+		pw.pt.report(string(pw.partial))
+		pw.partial = pw.partial[:0]
+	}
+}
+
+var percentRE = regexp.MustCompile(`(\d{1,3}(?:\.\d+)?)%`)
+
+// PercentProgress parses lines containing percentages, such as
+// "Downloading... 42%", or "[#####     ] 50.5%". The last percentage
+// on the line is used.
+var PercentProgress ProgressParser = func(line string) (Progress, bool) {
+	m := percentRE.FindAllStringSubmatch(line, -1)
+	if m == nil {
+		return Progress{}, false
+	}
+	pct, err := strconv.ParseFloat(m[len(m)-1][1], 64)
+	if err != nil || pct > 100 {
+		return Progress{}, false
+	}
+	return Progress{Fraction: pct / 100, Line: line}, true
+}
+
+// CurlProgress parses the progress meter curl writes to standard error,
+// such as
+//
+//	45 10.0M   45 4608k    0     0  1234k      0  0:00:08  0:00:03  0:00:05 1234k
+var CurlProgress ProgressParser = func(line string) (Progress, bool) {
+	f := strings.Fields(line)
+	if len(f) != 12 {
+		return Progress{}, false
+	}
+	pct, err := strconv.ParseFloat(f[0], 64)
+	if err != nil {
+		return Progress{}, false
+	}
+	p := Progress{Fraction: pct / 100, Line: line}
+	if f[1] == "0" {
+		// The size of the transfer is not known.
+		p.Fraction = -1
+	}
+	p.Rate, _ = parseSize(f[11], "")
+	p.ETA, _ = parseClock(f[10])
+	return p, true
+}
+
+var rsyncRE = regexp.MustCompile(`^\s*[\d,.]+[kMGT]?\s+(\d+)%\s+([\d.]+[kMGT]?B)/s\s+(\d+:\d{2}:\d{2})`)
+
+// RsyncProgress parses the progress lines rsync writes to standard output
+// when run with --progress or --info=progress2, such as
+//
+//	1,234,567  12%   1.23MB/s    0:01:23 (xfr#1, to-chk=5/10)
+var RsyncProgress ProgressParser = func(line string) (Progress, bool) {
+	m := rsyncRE.FindStringSubmatch(line)
+	if m == nil {
+		return Progress{}, false
+	}
+	pct, _ := strconv.ParseFloat(m[1], 64)
+	p := Progress{Fraction: pct / 100, Line: line}
+	p.Rate, _ = parseSize(m[2], "B")
+	p.ETA, _ = parseClock(m[3])
+	return p, true
+}
+
+var (
+	ffmpegTimeRE  = regexp.MustCompile(`time=(\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+	ffmpegSpeedRE = regexp.MustCompile(`speed=\s*([\d.]+)x`)
+)
+
+// FFmpegProgress returns a ProgressParser which parses the status lines
+// ffmpeg writes to standard error, such as
+//
+//	frame=  123 fps= 25 q=28.0 size=     512kB time=00:00:05.12 bitrate= 819.2kbits/s speed=1.02x
+//
+// ffmpeg does not report the duration of its output on the status line,
+// so Fraction and ETA are computed relative to total, the duration of
+// the media being processed. If total is zero, they are not known.
+func FFmpegProgress(total time.Duration) ProgressParser {
+	return func(line string) (Progress, bool) {
+		m := ffmpegTimeRE.FindStringSubmatch(line)
+		if m == nil {
+			return Progress{}, false
+		}
+		h, _ := strconv.Atoi(m[1])
+		min, _ := strconv.Atoi(m[2])
+		sec, _ := strconv.ParseFloat(m[3], 64)
+		done := time.Duration(h)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec*float64(time.Second))
+		p := Progress{Fraction: -1, Line: line}
+		if sm := ffmpegSpeedRE.FindStringSubmatch(line); sm != nil {
+			p.Rate, _ = strconv.ParseFloat(sm[1], 64)
+		}
+		if total > 0 {
+			p.Fraction = float64(done) / float64(total)
+			if p.Fraction > 1 {
+				p.Fraction = 1
+			}
+			if p.Rate > 0 && done < total {
+				p.ETA = time.Duration(float64(total-done) / p.Rate)
+			}
+		}
+		return p, true
+	}
+}
+
+// parseSize parses a size such as "1234k" or "1.23MB", with binary
+// multipliers, after trimming unit from it.
+func parseSize(s, unit string) (float64, error) {
+	s = strings.TrimSuffix(s, unit)
+	mult := 1.0
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k', 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult != 1 {
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return v * mult, nil
+}
+
+// parseClock parses a duration in the h:mm:ss format.
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWithProgress(t *testing.T) {
+	var got []float64
+	_, err := execx.Run(context.Background(), selfCmd("progress"), execx.WithProgress(execx.PercentProgress, func(p execx.Progress) {
+		got = append(got, p.Fraction)
+	}))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if len(got) != 3 || got[0] != 0.1 || got[2] != 0.75 {
+		t.Errorf("got progress %v, want [0.1 0.5 0.75]", got)
+	}
+	v, ok := ee.Detail("progress")
+	if !ok {
+		t.Fatal("no progress detail")
+	}
+	if p := v.(execx.Progress); p.Fraction != 0.75 || p.Time.IsZero() {
+		t.Errorf("got last progress %+v", p)
+	}
+}
+
+func TestProgressParsers(t *testing.T) {
+	tests := []struct {
+		name   string
+		parser execx.ProgressParser
+		line   string
+		want   execx.Progress
+		ok     bool
+	}{
+		{
+			name:   "Percent",
+			parser: execx.PercentProgress,
+			line:   "[#####     ] 50.5%",
+			want:   execx.Progress{Fraction: 0.505},
+			ok:     true,
+		},
+		{
+			name:   "PercentNone",
+			parser: execx.PercentProgress,
+			line:   "starting",
+		},
+		{
+			name:   "Curl",
+			parser: execx.CurlProgress,
+			line:   " 45 10.0M   45 4608k    0     0  1234k      0  0:00:08  0:00:03  0:00:05 1234k",
+			want:   execx.Progress{Fraction: 0.45, Rate: 1234 * 1024, ETA: 5 * time.Second},
+			ok:     true,
+		},
+		{
+			name:   "CurlHeader",
+			parser: execx.CurlProgress,
+			line:   "                                 Dload  Upload   Total   Spent    Left  Speed",
+		},
+		{
+			name:   "Rsync",
+			parser: execx.RsyncProgress,
+			line:   "      1,234,567  12%    1.50MB/s    0:01:23 (xfr#1, to-chk=5/10)",
+			want:   execx.Progress{Fraction: 0.12, Rate: 1.5 * (1 << 20), ETA: 83 * time.Second},
+			ok:     true,
+		},
+		{
+			name:   "FFmpeg",
+			parser: execx.FFmpegProgress(20 * time.Second),
+			line:   "frame=  123 fps= 25 q=28.0 size=     512kB time=00:00:05.00 bitrate= 819.2kbits/s speed=2.5x",
+			want:   execx.Progress{Fraction: 0.25, Rate: 2.5, ETA: 6 * time.Second},
+			ok:     true,
+		},
+		{
+			name:   "FFmpegUnknownDuration",
+			parser: execx.FFmpegProgress(0),
+			line:   "frame=  123 fps= 25 q=28.0 size=     512kB time=00:00:05.00 bitrate= 819.2kbits/s speed=2.5x",
+			want:   execx.Progress{Fraction: -1, Rate: 2.5},
+			ok:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.parser(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("got ok = %t, want %t", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.Fraction != tt.want.Fraction || got.Rate != tt.want.Rate || got.ETA != tt.want.ETA {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got.Line != tt.line {
+				t.Errorf("got line %q, want %q", got.Line, tt.line)
+			}
+		})
+	}
+}
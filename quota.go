@@ -0,0 +1,194 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errQuotaFull is the error recorded by a QuotaTimeoutError when the
+// quota is exhausted, and the command was configured not to wait.
+var errQuotaFull = errors.New("execx: quota exhausted")
+
+// SetQuota limits the number of commands labeled label, using WithQuota,
+// which run concurrently in the current process, to max. Commands started
+// while the quota is exhausted wait, in order, for a running command to
+// exit. If max is zero or negative, the quota is lifted. SetQuota may be
+// called at any time, and is safe to call from multiple goroutines
+// concurrently. Raising a quota lets waiting commands start immediately.
+//
+// For example, SetQuota("ffmpeg", 2) and SetQuota("git", 8) bound the
+// number of concurrent transcoding jobs and Git operations respectively,
+// regardless of how many goroutines start them.
+func SetQuota(label string, max int) {
+	quotas.Lock()
+	defer quotas.Unlock()
+	q := quotas.get(label)
+	q.max = max
+	q.grant()
+}
+
+// WithQuota counts the command against the quota for label, set using
+// SetQuota. Start waits until the quota allows the command to run, and
+// the slot is held until the process exits. The time spent waiting is
+// recorded in Result.QuotaWait. By default, Start waits until its context
+// is done. Use WithQuotaTimeout to bound the wait. If the wait fails,
+// Start returns a *StartError which wraps a *QuotaTimeoutError.
+func WithQuota(label string) Option {
+	return func(cfg *config) {
+		cfg.quota = label
+	}
+}
+
+// WithQuotaTimeout bounds the time Start waits for the quota configured
+// using WithQuota. If d is zero, Start fails immediately if the quota is
+// exhausted.
+func WithQuotaTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.quotaTimeout = d
+		cfg.quotaTimeoutSet = true
+	}
+}
+
+// QuotaTimeoutError records a command which could not start within its
+// quota in time.
+type QuotaTimeoutError struct {
+	// Label is the label of the quota.
+	Label string
+
+	// Limit is the quota at the time the wait failed.
+	Limit int
+
+	// Waited is the time spent waiting.
+	Waited time.Duration
+
+	// Err is the underlying error, such as context.DeadlineExceeded if
+	// the wait timed out.
+	Err error
+}
+
+func (e *QuotaTimeoutError) Error() string {
+	return fmt.Sprintf("execx: quota %q (%d concurrent) exhausted after %v: %v", e.Label, e.Limit, e.Waited.Round(time.Millisecond), e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *QuotaTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// A quota counts the commands running under a label.
+type quota struct {
+	max     int // zero or negative if unlimited
+	active  int
+	waiters []chan struct{} // in arrival order
+}
+
+// A quotaTable holds the quotas, by label.
+type quotaTable struct {
+	sync.Mutex
+	m map[string]*quota
+}
+
+var quotas quotaTable
+
+// get returns the quota for label, creating it if needed. quotas must be
+// locked.
+func (qs *quotaTable) get(label string) *quota {
+	if qs.m == nil {
+		qs.m = make(map[string]*quota)
+	}
+	q := qs.m[label]
+	if q == nil {
+		q = new(quota)
+		qs.m[label] = q
+	}
+	return q
+}
+
+// grant hands free slots to waiting commands. quotas must be locked.
+func (q *quota) grant() {
+	for len(q.waiters) > 0 && (q.max <= 0 || q.active < q.max) {
+		close(q.waiters[0])
+		q.waiters = q.waiters[1:]
+		q.active++
+	}
+}
+
+// acquireQuota waits for a slot in the quota configured for h, and
+// records the time spent waiting.
+func (h *Handle) acquireQuota(ctx context.Context) error {
+	label := h.cfg.quota
+	start := h.clock.Now()
+	quotas.Lock()
+	q := quotas.get(label)
+	if len(q.waiters) == 0 && (q.max <= 0 || q.active < q.max) {
+		q.active++
+		quotas.Unlock()
+		h.quotaHeld = true
+		return nil
+	}
+	if h.cfg.quotaTimeoutSet && h.cfg.quotaTimeout <= 0 {
+		max := q.max
+		quotas.Unlock()
+		return wrapStart(&QuotaTimeoutError{Label: label, Limit: max, Err: errQuotaFull}, h.cmd, h.cfg.collectors)
+	}
+	granted := make(chan struct{})
+	q.waiters = append(q.waiters, granted)
+	quotas.Unlock()
+
+	if h.cfg.quotaTimeoutSet {
+		var cancel context.CancelFunc
+		ctx, cancel = withClockTimeout(ctx, h.clock, h.cfg.quotaTimeout)
+		defer cancel()
+	}
+	select {
+	case <-granted:
+		h.quotaHeld = true
+		h.quotaWait = h.clock.Now().Sub(start)
+		return nil
+	case <-ctx.Done():
+	}
+	quotas.Lock()
+	defer quotas.Unlock()
+	for i, w := range q.waiters {
+		if w == granted {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			waited := h.clock.Now().Sub(start)
+			qerr := &QuotaTimeoutError{Label: label, Limit: q.max, Waited: waited, Err: ctx.Err()}
+			return wrapStart(qerr, h.cmd, h.cfg.collectors)
+		}
+	}
+	// The slot was granted concurrently with ctx being done. Take it.
+	h.quotaHeld = true
+	h.quotaWait = h.clock.Now().Sub(start)
+	return nil
+}
+
+// releaseQuota releases the slot held by h, if any.
+func (h *Handle) releaseQuota() {
+	if !h.quotaHeld {
+		return
+	}
+	h.quotaHeld = false
+	quotas.Lock()
+	defer quotas.Unlock()
+	q := quotas.get(h.cfg.quota)
+	q.active--
+	q.grant()
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestQuota(t *testing.T) {
+	const label = "execx-test-quota"
+	execx.SetQuota(label, 1)
+	defer execx.SetQuota(label, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first, err := execx.Start(ctx, selfCmd("hang"), execx.WithQuota(label))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Timeout", func(t *testing.T) {
+		_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithQuota(label), execx.WithQuotaTimeout(50*time.Millisecond))
+		var qerr *execx.QuotaTimeoutError
+		if !errors.As(err, &qerr) {
+			t.Fatalf("got %v, want *QuotaTimeoutError", err)
+		}
+		if qerr.Label != label || qerr.Limit != 1 || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %+v", qerr)
+		}
+		if qerr.Waited < 50*time.Millisecond {
+			t.Errorf("waited %v, want at least 50ms", qerr.Waited)
+		}
+	})
+	t.Run("FailFast", func(t *testing.T) {
+		_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithQuota(label), execx.WithQuotaTimeout(0))
+		var qerr *execx.QuotaTimeoutError
+		if !errors.As(err, &qerr) {
+			t.Fatalf("got %v, want *QuotaTimeoutError", err)
+		}
+	})
+	t.Run("Wait", func(t *testing.T) {
+		type result struct {
+			res *execx.Result
+			err error
+		}
+		done := make(chan result, 1)
+		go func() {
+			res, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithQuota(label))
+			done <- result{res, err}
+		}()
+		select {
+		case <-done:
+			t.Fatal("command ran despite the quota")
+		case <-time.After(100 * time.Millisecond):
+		}
+		cancel()
+		first.Wait()
+		r := <-done
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if r.res.QuotaWait < 100*time.Millisecond {
+			t.Errorf("QuotaWait = %v, want at least 100ms", r.res.QuotaWait)
+		}
+	})
+	t.Run("Raise", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := execx.Start(ctx, selfCmd("hang"), execx.WithQuota(label))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Wait()
+		defer cancel()
+		done := make(chan error, 1)
+		go func() {
+			_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithQuota(label))
+			done <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+		execx.SetQuota(label, 2)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("raising the quota did not start the waiting command")
+		}
+	})
+}
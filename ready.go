@@ -0,0 +1,251 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// A Probe determines whether a server started by StartAndWaitReady is
+// ready to serve requests.
+type Probe interface {
+	// Ready returns nil once the server is ready. Ready must return
+	// an error once ctx is done. The context passed to Ready is done
+	// if the process exits.
+	Ready(ctx context.Context) error
+}
+
+// ProbeFunc is an adapter to allow the use of ordinary functions as probes.
+type ProbeFunc func(ctx context.Context) error
+
+// Ready returns f(ctx).
+func (f ProbeFunc) Ready(ctx context.Context) error {
+	return f(ctx)
+}
+
+func (f ProbeFunc) String() string {
+	return "custom probe"
+}
+
+// probeInterval is the interval at which polling probes check readiness.
+const probeInterval = 50 * time.Millisecond
+
+// poll calls check every probeInterval, until it returns true, or ctx
+// is done.
+func poll(ctx context.Context, check func(ctx context.Context) bool) error {
+	t := time.NewTicker(probeInterval)
+	defer t.Stop()
+	for !check(ctx) {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// PortOpen returns a Probe which reports that the server is ready once
+// a TCP connection to addr succeeds.
+func PortOpen(addr string) Probe {
+	return portProbe(addr)
+}
+
+type portProbe string
+
+func (p portProbe) Ready(ctx context.Context) error {
+	var d net.Dialer
+	return poll(ctx, func(ctx context.Context) bool {
+		conn, err := d.DialContext(ctx, "tcp", string(p))
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	})
+}
+
+func (p portProbe) String() string {
+	return fmt.Sprintf("port %s open", string(p))
+}
+
+// HTTPOK returns a Probe which reports that the server is ready once
+// a GET request for url returns status 200.
+func HTTPOK(url string) Probe {
+	return httpProbe(url)
+}
+
+type httpProbe string
+
+func (p httpProbe) Ready(ctx context.Context) error {
+	return poll(ctx, func(ctx context.Context) bool {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, string(p), nil)
+		if err != nil {
+			return false
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	})
+}
+
+func (p httpProbe) String() string {
+	return fmt.Sprintf("HTTP 200 from %s", string(p))
+}
+
+// LogLine returns a Probe which reports that the server is ready once
+// it writes a line matching re to its standard output or standard error.
+// Output which the process writes directly to an *os.File is not observed.
+func LogLine(re *regexp.Regexp) Probe {
+	return &logProbe{re: re, ready: make(chan struct{})}
+}
+
+// logProbe watches the output of a process for a line matching re.
+type logProbe struct {
+	re    *regexp.Regexp
+	ready chan struct{}
+
+	mu   sync.Mutex // protects the fields below
+	line []byte     // partial line
+	done bool
+}
+
+// Write implements io.Writer, such that the probe can tap the output of
+// the process. Standard output and standard error are watched for lines
+// separately, but interleaved writes are not distinguished, since lines
+// are generally written atomically.
+func (p *logProbe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		return len(b), nil
+	}
+	p.line = append(p.line, b...)
+	for {
+		i := bytes.IndexByte(p.line, '\n')
+		if i < 0 {
+			break
+		}
+		if p.re.Match(p.line[:i]) {
+			p.done = true
+			p.line = nil
+			close(p.ready)
+			break
+		}
+		p.line = p.line[i+1:]
+	}
+	return len(b), nil
+}
+
+func (p *logProbe) Ready(ctx context.Context) error {
+	select {
+	case <-p.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *logProbe) String() string {
+	return fmt.Sprintf("log line matching %q", p.re)
+}
+
+// WithReadyTimeout bounds the time StartAndWaitReady waits for the server
+// to become ready.
+func WithReadyTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.ready = d
+	}
+}
+
+var errExitedBeforeReady = errors.New("process exited")
+
+// StartAndWaitReady starts cmd as per Start, and waits until the server
+// it runs is ready, according to probe. The context governs the lifetime
+// of the process, as per Start. Use WithReadyTimeout to bound the time
+// spent waiting for the server to become ready.
+//
+// If the process exits before it becomes ready, StartAndWaitReady returns
+// an *ExitError whose Reason is ReasonExitedBeforeReady, and whose Result
+// holds the captured startup output. If the probe fails otherwise, the
+// process is stopped, and StartAndWaitReady returns an *ExitError. In both
+// cases, the *ExitError carries a detail named "readiness", which
+// describes the failure.
+func StartAndWaitReady(ctx context.Context, cmd *exec.Cmd, probe Probe, opts ...Option) (*Handle, error) {
+	if lp, ok := probe.(*logProbe); ok {
+		opts = append(opts, func(cfg *config) {
+			cfg.taps = append(cfg.taps, lp)
+		})
+	}
+	h, err := Start(ctx, cmd, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	readyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if h.cfg.ready > 0 {
+		readyCtx, cancel = context.WithTimeout(readyCtx, h.cfg.ready)
+		defer cancel()
+	}
+	go func() {
+		select {
+		case <-h.exited:
+			cancel()
+		case <-readyCtx.Done():
+		}
+	}()
+	perr := probe.Ready(readyCtx)
+	if perr == nil {
+		return h, nil
+	}
+
+	exited := false
+	select {
+	case <-h.exited:
+		exited = true
+		perr = errExitedBeforeReady
+	default:
+		if h.cfg.grace > 0 {
+			h.Stop(h.cfg.grace)
+		} else {
+			h.kill()
+		}
+	}
+	res, err := h.Wait()
+	ee, ok := err.(*ExitError)
+	if !ok {
+		// The process exited successfully, or its output could not
+		// be copied. Describe the failure as an ExitError all the same.
+		ee = h.wrap(&exec.ExitError{ProcessState: res.ProcessState, Stderr: res.Stderr}, res).(*ExitError)
+	}
+	if exited {
+		ee.Reason = ReasonExitedBeforeReady
+	}
+	ee.Details = append(ee.Details, Detail{Key: "readiness", Value: fmt.Sprintf("not ready: %v: %v", probe, perr)})
+	return nil, ee
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestStartAndWaitReady(t *testing.T) {
+	t.Run("LogLine", testReadyLogLine)
+	t.Run("PortOpen", testReadyPortOpen)
+	t.Run("HTTPOK", testReadyHTTPOK)
+	t.Run("Func", testReadyFunc)
+	t.Run("ExitedBeforeReady", testReadyExited)
+	t.Run("Timeout", testReadyTimeout)
+}
+
+func testReadyLogLine(t *testing.T) {
+	probe := execx.LogLine(regexp.MustCompile(`^listening on`))
+	h, err := execx.StartAndWaitReady(context.Background(), selfCmd("serve"), probe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Stop(time.Second)
+}
+
+func testReadyPortOpen(t *testing.T) {
+	addr := freeAddr(t)
+	self := selfCmd("serve")
+	self.Env = append(self.Env, "EXECX_TEST_ADDR="+addr)
+	h, err := execx.StartAndWaitReady(context.Background(), self, execx.PortOpen(addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Stop(time.Second)
+}
+
+func testReadyHTTPOK(t *testing.T) {
+	addr := freeAddr(t)
+	self := selfCmd("serve")
+	self.Env = append(self.Env, "EXECX_TEST_ADDR="+addr)
+	h, err := execx.StartAndWaitReady(context.Background(), self, execx.HTTPOK("http://"+addr+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Stop(time.Second)
+}
+
+func testReadyFunc(t *testing.T) {
+	probe := execx.ProbeFunc(func(ctx context.Context) error {
+		return errors.New("broken")
+	})
+	_, err := execx.StartAndWaitReady(context.Background(), selfCmd("serve"), probe)
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Reason != execx.ReasonNone {
+		t.Errorf("got reason %q, want none", ee.Reason)
+	}
+	if got, _ := ee.Fields()["readiness"].(string); !strings.Contains(got, "broken") {
+		t.Errorf("got readiness %q, want probe error", got)
+	}
+}
+
+func testReadyExited(t *testing.T) {
+	probe := execx.LogLine(regexp.MustCompile(`^listening on`))
+	_, err := execx.StartAndWaitReady(context.Background(), selfCmd("on"), probe)
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Reason != execx.ReasonExitedBeforeReady {
+		t.Errorf("got reason %q, want %q", ee.Reason, execx.ReasonExitedBeforeReady)
+	}
+	if string(ee.Result.Stderr) != "whoops" {
+		t.Errorf("got startup output %q, want %q", ee.Result.Stderr, "whoops")
+	}
+	if _, ok := ee.Fields()["readiness"]; !ok {
+		t.Errorf("readiness failure not recorded")
+	}
+}
+
+func testReadyTimeout(t *testing.T) {
+	probe := execx.LogLine(regexp.MustCompile(`never`))
+	_, err := execx.StartAndWaitReady(context.Background(), selfCmd("serve"), probe, execx.WithReadyTimeout(100*time.Millisecond))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if got, _ := ee.Fields()["readiness"].(string); !strings.Contains(got, "deadline exceeded") {
+		t.Errorf("got readiness %q, want deadline exceeded", got)
+	}
+}
+
+// freeAddr returns a local TCP address which is likely not in use.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	port, err := execx.FreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+}
@@ -0,0 +1,262 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// children tracks the processes started by Start which have not been
+// waited for yet, by PID, such that a Reaper does not reap them, and can
+// attribute orphans to them.
+var children struct {
+	sync.Mutex
+	m map[int]*Handle
+}
+
+func track(h *Handle) {
+	children.Lock()
+	defer children.Unlock()
+	if children.m == nil {
+		children.m = make(map[int]*Handle)
+	}
+	children.m[h.cmd.Process.Pid] = h
+}
+
+func untrack(h *Handle) {
+	children.Lock()
+	defer children.Unlock()
+	delete(children.m, h.cmd.Process.Pid)
+}
+
+func tracked(pid int) bool {
+	children.Lock()
+	defer children.Unlock()
+	_, ok := children.m[pid]
+	return ok
+}
+
+// attribute returns the command line of the tracked process which leads
+// the process group pgid, if any. Processes in the process group of the
+// current process are not attributed, since all children which do not
+// run in process groups of their own are members of it.
+func attribute(pgid int) (string, bool) {
+	if pgid <= 0 || pgid == ownPGID() {
+		return "", false
+	}
+	children.Lock()
+	defer children.Unlock()
+	for pid, h := range children.m {
+		if pgidOf(h.cmd, pid) == pgid {
+			return Cmdline(h.cmd), true
+		}
+	}
+	return "", false
+}
+
+// An Orphan is a process reaped by a Reaper.
+type Orphan struct {
+	// PID is the process ID of the orphan.
+	PID int
+
+	// PGID is the process group ID of the orphan, or 0 if it could
+	// not be determined.
+	PGID int
+
+	// ExitCode is the exit code of the orphan, or -1 if it was
+	// terminated by a signal.
+	ExitCode int
+
+	// Signal is the signal which terminated the orphan, if any.
+	Signal os.Signal
+
+	// Cmdline is the command line of the command started by execx
+	// the orphan is attributed to, if it could be attributed to one.
+	// An orphan is attributed to a command if the command is still
+	// running, in a process group of its own, and the orphan was a
+	// member of that process group.
+	Cmdline string
+
+	// Reaped is the time at which the orphan was reaped.
+	Reaped time.Time
+}
+
+func (o *Orphan) String() string {
+	s := fmt.Sprintf("pid %d", o.PID)
+	if o.Signal != nil {
+		s += fmt.Sprintf(" killed by %v", o.Signal)
+	} else {
+		s += fmt.Sprintf(" exited with code %d", o.ExitCode)
+	}
+	if o.Cmdline != "" {
+		s += fmt.Sprintf(" (spawned by %s)", o.Cmdline)
+	}
+	return s
+}
+
+// A Reaper reaps orphaned child processes, as is required of programs
+// which run as PID 1, such as in containers, or which register as child
+// subreapers. Processes started by Start are not reaped by the Reaper,
+// but by Wait, as usual. Reapers are supported on Linux only.
+//
+// Processes started by other means, for example by os/exec directly, may
+// be reaped by the Reaper before they are waited for. Such processes, as
+// well as processes started by Start which are reaped by another party,
+// are reported as a *ReapedError.
+type Reaper struct {
+	// Subreaper registers the current process as a child subreaper,
+	// such that orphaned descendants are reparented to it, rather
+	// than to PID 1.
+	Subreaper bool
+
+	// OnOrphan, if not nil, is called for each orphan the Reaper
+	// reaps, from a goroutine started by the Reaper.
+	OnOrphan func(*Orphan)
+
+	mu      sync.Mutex
+	recent  []*Orphan // most recently reaped orphans, oldest first
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// maxRecentOrphans is the number of orphans a Reaper remembers, for
+// ReapedError.
+const maxRecentOrphans = 128
+
+// activeReaper is the Reaper started by Start, if any.
+var activeReaper struct {
+	sync.Mutex
+	r *Reaper
+}
+
+var errReaperRunning = errors.New("execx: a Reaper is already running")
+
+// Start starts reaping orphans. Only one Reaper may run at a time.
+func (r *Reaper) Start() error {
+	activeReaper.Lock()
+	defer activeReaper.Unlock()
+	if activeReaper.r != nil {
+		return errReaperRunning
+	}
+	r.stop = make(chan struct{})
+	r.stopped = make(chan struct{})
+	if err := r.start(); err != nil {
+		return err
+	}
+	activeReaper.r = r
+	return nil
+}
+
+// Stop stops reaping orphans.
+func (r *Reaper) Stop() {
+	activeReaper.Lock()
+	defer activeReaper.Unlock()
+	if activeReaper.r != r {
+		return
+	}
+	close(r.stop)
+	<-r.stopped
+	activeReaper.r = nil
+}
+
+// Recent returns the orphans reaped most recently, oldest first.
+func (r *Reaper) Recent() []*Orphan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Orphan(nil), r.recent...)
+}
+
+// record records o.
+func (r *Reaper) record(o *Orphan) {
+	r.mu.Lock()
+	r.recent = append(r.recent, o)
+	if len(r.recent) > maxRecentOrphans {
+		r.recent = r.recent[len(r.recent)-maxRecentOrphans:]
+	}
+	r.mu.Unlock()
+	if r.OnOrphan != nil {
+		r.OnOrphan(o)
+	}
+}
+
+// reapedOrphan returns the orphan with the specified PID reaped by the
+// active Reaper, if any.
+func reapedOrphan(pid int) *Orphan {
+	activeReaper.Lock()
+	r := activeReaper.r
+	activeReaper.Unlock()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.recent) - 1; i >= 0; i-- {
+		if r.recent[i].PID == pid {
+			return r.recent[i]
+		}
+	}
+	return nil
+}
+
+// ReapedError records a child process which exited, but was reaped by
+// another party, such as a Reaper, or a signal handler, before it could
+// be waited for. Its exit status is known only if it was reaped by the
+// active Reaper.
+type ReapedError struct {
+	// Path is the path of the command which was executed.
+	Path string
+
+	// Args holds command line arguments.
+	Args []string
+
+	// PID is the process ID of the child process.
+	PID int
+
+	// Orphan describes the process, if it was reaped by the active
+	// Reaper. Otherwise, Orphan is nil.
+	Orphan *Orphan
+
+	// Err is the error returned by Wait.
+	Err error
+}
+
+// Cmdline returns the concatenation of filepath.Base(e.Path) and e.Args,
+// separated by spaces. See func Cmdline.
+func (e *ReapedError) Cmdline() string {
+	return cmdline(e.Path, e.Args)
+}
+
+// Unwrap returns e.Err.
+func (e *ReapedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ReapedError) Error() string {
+	if e.Orphan != nil {
+		return fmt.Sprintf("%s: child exited but was reaped by a Reaper: %v", e.Cmdline(), e.Orphan)
+	}
+	return fmt.Sprintf("%s: child pid %d exited but was reaped by someone else", e.Cmdline(), e.PID)
+}
+
+// isReaped reports whether err, returned by Wait, signals that the child
+// process was reaped by another party.
+func isReaped(err error) bool {
+	return errors.Is(err, syscall.ECHILD)
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	prSetChildSubreaper = 36
+
+	pAll    = 0
+	pPID    = 1
+	wNowait = 0x1000000
+)
+
+func (r *Reaper) start() error {
+	if r.Subreaper {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+			return os.NewSyscallError("prctl", errno)
+		}
+	}
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGCHLD)
+	go func() {
+		defer close(r.stopped)
+		defer signal.Stop(sigc)
+		if r.Subreaper {
+			defer syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 0, 0)
+		}
+		// Orphans are also reaped periodically, in case they could
+		// not be reaped when SIGCHLD was delivered, because a process
+		// started by Start had not been waited for yet.
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for {
+			r.reapAll()
+			select {
+			case <-sigc:
+			case <-t.C:
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// reapAll reaps all orphans which have exited, stopping at the first
+// process which has exited but is tracked, and must be waited for by its
+// Handle.
+func (r *Reaper) reapAll() {
+	for {
+		pid := peekExited()
+		if pid <= 0 || tracked(pid) {
+			return
+		}
+		pgid := zombiePGID(pid)
+		var ws syscall.WaitStatus
+		wpid, err := syscall.Wait4(pid, &ws, syscall.WNOHANG, nil)
+		if err != nil || wpid != pid {
+			return
+		}
+		o := &Orphan{
+			PID:      pid,
+			PGID:     pgid,
+			ExitCode: ws.ExitStatus(),
+			Reaped:   time.Now(),
+		}
+		if ws.Signaled() {
+			o.Signal = ws.Signal()
+		}
+		o.Cmdline, _ = attribute(pgid)
+		r.record(o)
+	}
+}
+
+// peekExited returns the PID of a child process which has exited, without
+// reaping it, or 0 if there is none.
+func peekExited() int {
+	pid, _ := waitidNowait(pAll, 0)
+	return pid
+}
+
+// waitidNowait returns the PID of a child process matching idtype and id
+// which has exited, without reaping it, or 0 if there is none.
+func waitidNowait(idtype, id int) (int, syscall.Errno) {
+	// siginfo_t is 128 bytes long. si_pid follows si_signo, si_errno
+	// and si_code, at the alignment of pointers.
+	var info [128]byte
+	_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, uintptr(idtype), uintptr(id), uintptr(unsafe.Pointer(&info[0])), syscall.WEXITED|syscall.WNOHANG|wNowait, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	off := 12
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		off = 16
+	}
+	return int(*(*int32)(unsafe.Pointer(&info[off]))), 0
+}
+
+// zombiePGID returns the process group ID of the exited, but not yet
+// reaped, process with the specified PID, or 0 if it cannot be determined.
+func zombiePGID(pid int) int {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0
+	}
+	// The command name, in parentheses, may contain spaces. The state,
+	// the parent PID and the process group ID follow it.
+	s := string(b)
+	fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+	if len(fields) < 3 {
+		return 0
+	}
+	pgid, _ := strconv.Atoi(fields[2])
+	return pgid
+}
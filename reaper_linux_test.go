@@ -0,0 +1,66 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestReaper(t *testing.T) {
+	orphans := make(chan *execx.Orphan, 1)
+	r := &execx.Reaper{
+		Subreaper: true,
+		OnOrphan:  func(o *execx.Orphan) { orphans <- o },
+	}
+	if err := r.Start(); err != nil {
+		t.Skipf("cannot start reaper: %v", err)
+	}
+	defer r.Stop()
+
+	stdin, stdinw := io.Pipe()
+	self := selfCmd("spawn-orphan")
+	self.Stdin = stdin
+	self.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	h, err := execx.Start(context.Background(), self)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case o := <-orphans:
+		if o.ExitCode != 7 {
+			t.Errorf("got orphan exit code %d, want 7", o.ExitCode)
+		}
+		if o.Cmdline == "" {
+			t.Errorf("orphan %v not attributed to the command which spawned it", o)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("orphan not reaped")
+	}
+	if got := r.Recent(); len(got) != 1 {
+		t.Errorf("got %d recent orphans, want 1", len(got))
+	}
+
+	stdinw.Close()
+	if _, err := h.Wait(); err != nil {
+		t.Fatalf("command started by Start was not left to Wait: %v", err)
+	}
+}
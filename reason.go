@@ -0,0 +1,47 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+// A Reason explains why a process exited, beyond its exit status.
+type Reason string
+
+// Reasons.
+const (
+	// ReasonNone means that no particular reason is known.
+	ReasonNone Reason = ""
+
+	// ReasonOOMKilled means that the process was killed by the
+	// kernel's out-of-memory killer.
+	ReasonOOMKilled Reason = "OOMKilled"
+
+	// ReasonOutputMatched means that the process exited successfully,
+	// but its output matched a failure condition set using FailIf or
+	// FailIfFunc.
+	ReasonOutputMatched Reason = "OutputMatched"
+
+	// ReasonExitedBeforeReady means that a process started by
+	// StartAndWaitReady exited before it became ready.
+	ReasonExitedBeforeReady Reason = "ExitedBeforeReady"
+
+	// ReasonCanceledByCaller means that the process was stopped
+	// because the caller canceled it, by canceling the context of the
+	// command, or using GroupMember.Cancel.
+	ReasonCanceledByCaller Reason = "CanceledByCaller"
+
+	// ReasonTimedOut means that the process was stopped because the
+	// deadline of its context, or the timeout set using WithTimeout,
+	// expired.
+	ReasonTimedOut Reason = "TimedOut"
+)
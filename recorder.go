@@ -0,0 +1,236 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Step is a command recorded by a Recorder.
+type Step struct {
+	// Args holds the command line arguments, including the name of
+	// the command.
+	Args []string
+
+	// Dir is the working directory of the command.
+	Dir string
+
+	// Start is the time the command was started.
+	Start time.Time
+
+	// Duration is the time it took the command to complete.
+	Duration time.Duration
+
+	// ExitCode is the exit code of the command, or -1 if it was
+	// terminated by a signal, or failed to start.
+	ExitCode int
+
+	// Err is the error the command failed with, if any.
+	Err error
+
+	// Result is the result of the command, if it was started.
+	Result *Result
+
+	// Confirmation records the decision to run the command, if it
+	// required confirmation by a ConfirmPolicy.
+	Confirmation *Confirmation
+}
+
+// A Recorder is a Runner which records the commands it runs, such that
+// they can be rendered as a transcript, for example to document the steps
+// taken during an incident. To record all commands run by Run within a
+// scope, install the Recorder using WithRunner.
+//
+// A Recorder is safe for concurrent use by multiple goroutines. Steps are
+// recorded in the order in which they start.
+type Recorder struct {
+	// Runner runs the commands. If Runner is nil, Local is used.
+	Runner Runner
+
+	mu    sync.Mutex
+	steps []*Step
+}
+
+// Run runs cmd, and records it.
+func (r *Recorder) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	runner := r.Runner
+	if runner == nil {
+		runner = Local
+	}
+	args := copyStrings(cmd.Args)
+	if len(args) == 0 {
+		args = []string{cmd.Path}
+	}
+	clock := ClockFrom(ctx)
+	step := &Step{Args: args, Start: clock.Now()}
+	step.Dir, _, _ = describe(cmd)
+	r.mu.Lock()
+	r.steps = append(r.steps, step)
+	r.mu.Unlock()
+
+	ctx = context.WithValue(ctx, stepKey{}, stepRef{r: r, step: step})
+	res, err := runner.Run(ctx, cmd, opts...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	step.Duration = clock.Now().Sub(step.Start)
+	step.ExitCode = -1
+	if res != nil {
+		step.ExitCode = res.ExitCode
+		if res.Dir != "" {
+			step.Dir = res.Dir
+		}
+	}
+	step.Err = err
+	step.Result = res
+	return res, err
+}
+
+type stepKey struct{}
+
+// stepRef refers to the step a Recorder is recording.
+type stepRef struct {
+	r    *Recorder
+	step *Step
+}
+
+// recordConfirmation records conf in the step being recorded by the
+// Recorder carried by ctx, if any.
+func recordConfirmation(ctx context.Context, conf *Confirmation) {
+	ref, ok := ctx.Value(stepKey{}).(stepRef)
+	if !ok {
+		return
+	}
+	ref.r.mu.Lock()
+	defer ref.r.mu.Unlock()
+	ref.step.Confirmation = conf
+}
+
+// Steps returns the steps recorded so far.
+func (r *Recorder) Steps() []Step {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	steps := make([]Step, 0, len(r.steps))
+	for _, s := range r.steps {
+		steps = append(steps, *s)
+	}
+	return steps
+}
+
+// WriteShell writes the recorded steps to w as a shell script, in which
+// each command runs in a subshell, in its working directory, preceded by
+// a comment describing its outcome, the confirmation decision, if any,
+// and the prompts answered using WithAskpass, if any.
+func (r *Recorder) WriteShell(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#!/bin/sh\n")
+	for i, s := range r.Steps() {
+		fmt.Fprintf(bw, "\n# %d: %s\n", i+1, s.outcome())
+		if s.Confirmation != nil {
+			fmt.Fprintf(bw, "# %v\n", s.Confirmation)
+		}
+		for _, p := range s.askpassPrompts() {
+			fmt.Fprintf(bw, "# askpass prompt %v\n", p)
+		}
+		fmt.Fprintf(bw, "(cd %s && %s)\n", shellQuote(s.Dir), s.cmdline())
+	}
+	return bw.Flush()
+}
+
+// WriteMarkdown writes the recorded steps to w as a Markdown table.
+func (r *Recorder) WriteMarkdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "| # | Command | Directory | Started | Duration | Outcome |\n")
+	fmt.Fprintf(bw, "|---|---------|-----------|---------|----------|---------|\n")
+	for i, s := range r.Steps() {
+		fmt.Fprintf(bw, "| %d | `%s` | `%s` | %s | %v | %s |\n",
+			i+1,
+			markdownEscape(s.cmdline()),
+			markdownEscape(s.Dir),
+			s.Start.Format(time.RFC3339),
+			s.Duration.Round(time.Millisecond),
+			markdownEscape(s.markdownOutcome()),
+		)
+	}
+	return bw.Flush()
+}
+
+func (s *Step) markdownOutcome() string {
+	outcome := s.outcome()
+	if s.Confirmation != nil {
+		outcome = fmt.Sprintf("%s; %v", outcome, s.Confirmation)
+	}
+	for _, p := range s.askpassPrompts() {
+		outcome = fmt.Sprintf("%s; askpass prompt %v", outcome, p)
+	}
+	return outcome
+}
+
+// askpassPrompts returns the prompts answered using WithAskpass while
+// running the command, if any.
+func (s *Step) askpassPrompts() []AskpassPrompt {
+	if s.Result == nil {
+		return nil
+	}
+	return s.Result.AskpassPrompts
+}
+
+func (s *Step) cmdline() string {
+	return quoteArgs(s.Args)
+}
+
+// quoteArgs joins args by spaces, quoting each as per shellQuote.
+func quoteArgs(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (s *Step) outcome() string {
+	switch err := s.Err.(type) {
+	case nil:
+		return fmt.Sprintf("exit status %d", s.ExitCode)
+	case *ExitError:
+		return err.ExitError.Error()
+	case *StartError:
+		return fmt.Sprintf("failed to start: %v", err.Err)
+	default:
+		return err.Error()
+	}
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell command
+// line, if necessary.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool { return !isShellSafe(r) }) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// markdownEscape escapes s for use in a Markdown table cell.
+func markdownEscape(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
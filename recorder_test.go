@@ -0,0 +1,74 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestRecorder(t *testing.T) {
+	rec := new(execx.Recorder)
+	ctx := execx.WithRunner(context.Background(), rec)
+
+	if _, err := execx.Run(ctx, selfCmd("echo")); err != nil {
+		t.Fatal(err)
+	}
+	failing := selfCmd("on")
+	failing.Args = append(failing.Args, "it's")
+	if _, err := execx.Run(ctx, failing); err == nil {
+		t.Fatal("command did not fail")
+	}
+
+	steps := rec.Steps()
+	if len(steps) != 2 {
+		t.Fatalf("recorded %d steps, want 2", len(steps))
+	}
+	if steps[0].ExitCode != 0 || steps[0].Err != nil {
+		t.Errorf("step 1: got exit code %d, error %v", steps[0].ExitCode, steps[0].Err)
+	}
+	if steps[1].ExitCode != 1 || steps[1].Err == nil {
+		t.Errorf("step 2: got exit code %d, error %v", steps[1].ExitCode, steps[1].Err)
+	}
+	if steps[0].Dir != mustGetwd(t) {
+		t.Errorf("step 1: got dir %q, want %q", steps[0].Dir, mustGetwd(t))
+	}
+
+	sh := new(bytes.Buffer)
+	if err := rec.WriteShell(sh); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"#!/bin/sh\n", "# 1: exit status 0\n", "# 2: exit status 1\n", `'it'\''s')`} {
+		if !strings.Contains(sh.String(), want) {
+			t.Errorf("shell transcript missing %q:\n%s", want, sh)
+		}
+	}
+
+	md := new(bytes.Buffer)
+	if err := rec.WriteMarkdown(md); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(md.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines of Markdown, want 4:\n%s", len(lines), md)
+	}
+	if !strings.HasPrefix(lines[3], "| 2 | `") || !strings.HasSuffix(lines[3], "| exit status 1 |") {
+		t.Errorf("unexpected Markdown row %q", lines[3])
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"strings"
+
+	"acln.ro/env"
+)
+
+// Redacted is the placeholder which replaces the values of sensitive
+// environment variables in output produced by this package.
+const Redacted = "<redacted>"
+
+// sensitiveNames lists substrings which, if present in the name of an
+// environment variable, mark the variable as likely to hold a secret.
+var sensitiveNames = []string{
+	"PASSWORD",
+	"PASSWD",
+	"SECRET",
+	"TOKEN",
+	"CREDENTIAL",
+	"PRIVATE",
+	"API_KEY",
+	"APIKEY",
+	"ACCESS_KEY",
+	"AUTH",
+}
+
+// IsSensitive reports whether the environment variable with the specified
+// name is likely to hold a secret, such as a password or an API token,
+// as per Config.SensitiveNames. The check is case insensitive.
+func IsSensitive(name string) bool {
+	name = strings.ToUpper(name)
+	for _, s := range currentConfig().sensitive() {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactEnv returns a copy of m in which the values of sensitive variables,
+// as reported by IsSensitive, are replaced by Redacted.
+func RedactEnv(m env.Map) env.Map {
+	redacted := make(env.Map, len(m))
+	for k, v := range m {
+		if IsSensitive(k) {
+			v = Redacted
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+// WithRedactedEnv redacts the values of sensitive environment variables,
+// as per RedactEnv, in the ParentEnv and ChildEnv of the errors produced
+// by the command, such that printing the errors using %+v, or logging
+// them, does not reveal secrets. The environment of the command itself is
+// not affected.
+func WithRedactedEnv() Option {
+	return func(cfg *config) {
+		cfg.redactEnv = true
+	}
+}
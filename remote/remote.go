@@ -0,0 +1,419 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+// Package remote implements a small protocol for running commands on a
+// remote agent, such as a build farm worker, over HTTP.
+//
+// The client POSTs a JSON encoded Request, which carries the arguments,
+// the environment, the working directory and the standard input of the
+// command, as well as limits on its execution. The server responds with a
+// stream of newline delimited JSON encoded Frames, carrying the output of
+// the command as it is produced, followed by a final Frame describing how
+// the command exited. The client reassembles the frames into an
+// *execx.Result, and an *execx.ExitError or *execx.StartError if the
+// command failed, such that remote failures are handled uniformly with
+// local ones.
+//
+// The server runs arbitrary commands on behalf of its clients. It must be
+// protected, for example by an authenticating http.Handler.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	"acln.ro/execx"
+)
+
+// A Request asks the agent to run a command.
+type Request struct {
+	// Args holds the name of the command, which is resolved by the
+	// agent, followed by its arguments.
+	Args []string `json:"args"`
+
+	// Env is the environment of the command. If Env is nil, the command
+	// inherits the environment of the agent.
+	Env []string `json:"env,omitempty"`
+
+	// Dir is the working directory of the command. If Dir is empty,
+	// the command runs in the working directory of the agent.
+	Dir string `json:"dir,omitempty"`
+
+	// Stdin holds the standard input of the command.
+	Stdin []byte `json:"stdin,omitempty"`
+
+	// Timeout, if positive, bounds the running time of the command.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// OutputLimit, if positive, bounds the combined size of the
+	// standard output and standard error of the command. If the
+	// command exceeds it, it is killed.
+	OutputLimit int `json:"output_limit,omitempty"`
+}
+
+// A Frame is an element of the response stream. Exactly one of the fields
+// is set.
+type Frame struct {
+	Stdout []byte `json:"stdout,omitempty"`
+	Stderr []byte `json:"stderr,omitempty"`
+	Exit   *Exit  `json:"exit,omitempty"`
+}
+
+// Exit describes how a command exited. It is sent in the last Frame of
+// the response stream.
+type Exit struct {
+	// ExitCode is the exit code of the command, or -1 if it was
+	// terminated by a signal, or failed to start.
+	ExitCode int `json:"exit_code"`
+
+	// Error is the error message, if the command failed.
+	Error string `json:"error,omitempty"`
+
+	// StartError reports whether the command failed to start.
+	StartError bool `json:"start_error,omitempty"`
+
+	// Path is the path of the command on the agent, if it was resolved.
+	Path string `json:"path,omitempty"`
+
+	// Reason, Hints and Details carry the fields of the same names of
+	// the *execx.ExitError. The values of details are formatted as
+	// strings, using fmt.Sprint.
+	Reason  execx.Reason      `json:"reason,omitempty"`
+	Hints   []string          `json:"hints,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+
+	// Duration is the wall time the command took.
+	Duration time.Duration `json:"duration"`
+
+	// UserTime and SystemTime are the user and system CPU time of the
+	// command, if it ran.
+	UserTime   time.Duration `json:"user_time,omitempty"`
+	SystemTime time.Duration `json:"system_time,omitempty"`
+}
+
+// exitState describes how a remote command exited, such that failures
+// are wrapped like those of local commands.
+type exitState struct {
+	exit *Exit
+}
+
+func (s exitState) ExitCode() int             { return s.exit.ExitCode }
+func (s exitState) Success() bool             { return s.exit.Error == "" }
+func (s exitState) String() string            { return s.exit.Error }
+func (s exitState) UserTime() time.Duration   { return s.exit.UserTime }
+func (s exitState) SystemTime() time.Duration { return s.exit.SystemTime }
+
+// Server is an http.Handler which serves requests to run commands.
+type Server struct {
+	// Runner runs the commands. If Runner is nil, execx.Local is used.
+	Runner execx.Runner
+
+	// Options are applied to every command.
+	Options []execx.Option
+}
+
+// ServeHTTP runs the command described by the request, and streams its
+// output and exit status to the client. If the client goes away, the
+// command is killed.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Args) == 0 {
+		http.Error(w, "bad request: no command", http.StatusBadRequest)
+		return
+	}
+	runner := s.Runner
+	if runner == nil {
+		runner = execx.Local
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	fw := &frameWriter{enc: json.NewEncoder(w), limit: req.OutputLimit}
+	fw.flusher, _ = w.(http.Flusher)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	fw.onExceed = cancel
+
+	cmd := exec.Command(req.Args[0], req.Args[1:]...)
+	cmd.Env = req.Env
+	cmd.Dir = req.Dir
+	cmd.Stdin = bytes.NewReader(req.Stdin)
+	cmd.Stdout = &streamWriter{fw: fw, stdout: true}
+	cmd.Stderr = &streamWriter{fw: fw}
+	opts := s.Options
+	if req.Timeout > 0 {
+		opts = append(opts[:len(opts):len(opts)], execx.WithTimeout(req.Timeout))
+	}
+
+	clock := execx.ClockFrom(ctx)
+	start := clock.Now()
+	_, err := runner.Run(ctx, cmd, opts...)
+	exit := exitOf(cmd, err)
+	exit.Duration = clock.Now().Sub(start)
+	if fw.exceeded() {
+		exit.Hints = append(exit.Hints, fmt.Sprintf("output exceeded the limit of %d bytes", req.OutputLimit))
+	}
+	fw.send(Frame{Exit: exit})
+}
+
+// exitOf describes how cmd exited, with the error err.
+func exitOf(cmd *exec.Cmd, err error) *Exit {
+	exit := &Exit{Path: cmd.Path}
+	var ee *execx.ExitError
+	var se *execx.StartError
+	switch {
+	case err == nil:
+		return exit
+	case errors.As(err, &ee):
+		exit.ExitCode = ee.ExitCode()
+		exit.UserTime = ee.UserTime()
+		exit.SystemTime = ee.SystemTime()
+		exit.Reason = ee.Reason
+		exit.Hints = ee.Hints
+		if len(ee.Details) > 0 {
+			exit.Details = make(map[string]string, len(ee.Details))
+			for _, d := range ee.Details {
+				exit.Details[d.Key] = fmt.Sprint(d.Value)
+			}
+		}
+	case errors.As(err, &se):
+		exit.ExitCode = -1
+		exit.StartError = true
+	default:
+		exit.ExitCode = -1
+	}
+	exit.Error = err.Error()
+	return exit
+}
+
+// frameWriter writes frames to the response stream.
+type frameWriter struct {
+	mu       sync.Mutex
+	enc      *json.Encoder
+	flusher  http.Flusher
+	limit    int
+	written  int
+	over     bool
+	onExceed func()
+}
+
+func (fw *frameWriter) send(f Frame) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.sendLocked(f)
+}
+
+func (fw *frameWriter) sendLocked(f Frame) error {
+	if err := fw.enc.Encode(f); err != nil {
+		return err
+	}
+	if fw.flusher != nil {
+		fw.flusher.Flush()
+	}
+	return nil
+}
+
+func (fw *frameWriter) exceeded() bool {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.over
+}
+
+// streamWriter writes the output of a stream of the command to frames.
+type streamWriter struct {
+	fw     *frameWriter
+	stdout bool
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	fw := sw.fw
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.over {
+		return len(p), nil
+	}
+	data := p
+	if fw.limit > 0 && fw.written+len(p) > fw.limit {
+		data = p[:fw.limit-fw.written]
+		fw.over = true
+		fw.onExceed()
+	}
+	fw.written += len(data)
+	f := Frame{Stderr: data}
+	if sw.stdout {
+		f = Frame{Stdout: data}
+	}
+	if len(data) > 0 {
+		if err := fw.sendLocked(f); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Client is an execx.Runner which runs commands on a remote agent served
+// by a Server.
+//
+// The path, arguments, environment, working directory and standard input
+// of commands are sent to the agent, which resolves the command anew, and
+// the output is written to cmd.Stdout and cmd.Stderr, or captured if they
+// are nil. The deadline of the context, if any, is sent to the agent as
+// the timeout of the command. Options passed to Run cannot be applied
+// remotely, and are ignored: configure them on the Server instead.
+type Client struct {
+	// URL is the URL of the agent.
+	URL string
+
+	// HTTPClient is the client used to make requests. If HTTPClient
+	// is nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// OutputLimit, if positive, is sent as the OutputLimit of every
+	// request.
+	OutputLimit int
+}
+
+// Run runs cmd on the agent.
+func (c *Client) Run(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+	req := Request{
+		Args:        append([]string(nil), cmd.Args...),
+		Env:         cmd.Env,
+		Dir:         cmd.Dir,
+		OutputLimit: c.OutputLimit,
+	}
+	if len(req.Args) == 0 {
+		req.Args = []string{cmd.Path}
+	}
+	if cmd.Stdin != nil {
+		stdin, err := ioutil.ReadAll(cmd.Stdin)
+		if err != nil {
+			return nil, &execx.StartError{Err: err, Path: cmd.Path, Args: cmd.Args, Dir: cmd.Dir}
+		}
+		req.Stdin = stdin
+	}
+	clock := execx.ClockFrom(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Timeout = deadline.Sub(clock.Now())
+	}
+	res := &execx.Result{Path: cmd.Path, Args: cmd.Args, Dir: cmd.Dir}
+	res.Timeline.Created = clock.Now()
+	exit, err := c.do(ctx, &req, cmd, res)
+	if err != nil {
+		return nil, &execx.StartError{Err: err, Path: cmd.Path, Args: cmd.Args, Dir: cmd.Dir}
+	}
+	res.Timeline.WaitReturned = clock.Now()
+	res.Timeline.Running = res.Timeline.WaitReturned.Add(-exit.Duration)
+	res.ExitCode = exit.ExitCode
+	if exit.Path != "" {
+		res.Path = exit.Path
+	}
+	if exit.Error == "" {
+		return res, nil
+	}
+	if exit.StartError {
+		return nil, &execx.StartError{Err: errors.New(exit.Error), Path: res.Path, Args: cmd.Args, Dir: cmd.Dir}
+	}
+	ee := execx.WrapState(exitState{exit}, cmd, res.Stderr).(*execx.ExitError)
+	ee.Path = res.Path
+	ee.Reason = exit.Reason
+	ee.Hints = exit.Hints
+	ee.Result = res
+	for k, v := range exit.Details {
+		ee.Details = append(ee.Details, execx.Detail{Key: k, Value: v})
+	}
+	ee.Details = append(ee.Details, execx.Detail{Key: "remote", Value: c.URL})
+	return res, ee
+}
+
+// do sends req to the agent, and processes the response stream, writing
+// or capturing the output of the command.
+func (c *Client) do(ctx context.Context, req *Request, cmd *exec.Cmd, res *execx.Result) (*Exit, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("remote: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var stdout, stderr bytes.Buffer
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var f Frame
+		if err := dec.Decode(&f); err != nil {
+			if err == io.EOF {
+				err = errors.New("remote: response ended before the command exited")
+			}
+			return nil, err
+		}
+		switch {
+		case f.Exit != nil:
+			if cmd.Stdout == nil {
+				res.Stdout = stdout.Bytes()
+			}
+			if cmd.Stderr == nil {
+				res.Stderr = stderr.Bytes()
+			}
+			return f.Exit, nil
+		case f.Stdout != nil:
+			if err := writeOutput(cmd.Stdout, &stdout, f.Stdout); err != nil {
+				return nil, err
+			}
+		case f.Stderr != nil:
+			if err := writeOutput(cmd.Stderr, &stderr, f.Stderr); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// writeOutput writes p to w, or captures it in capture if w is nil.
+func writeOutput(w io.Writer, capture *bytes.Buffer, p []byte) error {
+	if w == nil {
+		w = capture
+	}
+	_, err := w.Write(p)
+	return err
+}
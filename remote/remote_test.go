@@ -0,0 +1,146 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+	"acln.ro/execx/remote"
+)
+
+func TestMain(m *testing.M) {
+	switch os.Getenv("EXECX_TEST") {
+	case "echo":
+		io.Copy(os.Stdout, os.Stdin)
+		os.Stderr.WriteString("echoed")
+		os.Exit(0)
+	case "fail":
+		os.Stdout.WriteString("partial")
+		os.Stderr.WriteString("whoops")
+		os.Exit(3)
+	case "flood":
+		os.Stdout.Write(make([]byte, 1<<20))
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	case "hang":
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func remoteCmd(mode string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "EXECX_TEST="+mode)
+	return cmd
+}
+
+func newClient(t *testing.T) *remote.Client {
+	srv := httptest.NewServer(new(remote.Server))
+	t.Cleanup(srv.Close)
+	return &remote.Client{URL: srv.URL}
+}
+
+func TestRun(t *testing.T) {
+	c := newClient(t)
+	cmd := remoteCmd("echo")
+	cmd.Stdin = strings.NewReader("hello")
+	res, err := c.Run(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "hello" || string(res.Stderr) != "echoed" || res.ExitCode != 0 {
+		t.Errorf("got stdout %q, stderr %q, exit code %d", res.Stdout, res.Stderr, res.ExitCode)
+	}
+}
+
+func TestRunWriters(t *testing.T) {
+	c := newClient(t)
+	cmd := remoteCmd("echo")
+	cmd.Stdin = strings.NewReader("hello")
+	stdout := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	res, err := c.Run(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "hello" || res.Stdout != nil {
+		t.Errorf("got stdout %q, captured %q", stdout, res.Stdout)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	c := newClient(t)
+	res, err := c.Run(context.Background(), remoteCmd("fail"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *execx.ExitError", err)
+	}
+	if ee.ExitCode() != 3 || string(ee.Stderr) != "whoops" || string(res.Stdout) != "partial" {
+		t.Errorf("got exit code %d, stderr %q, stdout %q", ee.ExitCode(), ee.Stderr, res.Stdout)
+	}
+	if !strings.Contains(ee.Error(), "exit status 3") {
+		t.Errorf("got error %q", ee.Error())
+	}
+	if v, _ := ee.Detail("remote"); v != c.URL {
+		t.Errorf("got remote %v, want %s", v, c.URL)
+	}
+}
+
+func TestRunStartError(t *testing.T) {
+	c := newClient(t)
+	_, err := c.Run(context.Background(), exec.Command("execx-nonexistent-command"))
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want *execx.StartError", err)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	c := newClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	c.Run(ctx, remoteCmd("hang"))
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("took %v, timeout not applied", elapsed)
+	}
+}
+
+func TestRunOutputLimit(t *testing.T) {
+	c := newClient(t)
+	c.OutputLimit = 1024
+	res, err := c.Run(context.Background(), remoteCmd("flood"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *execx.ExitError", err)
+	}
+	if len(res.Stdout) != 1024 {
+		t.Errorf("got %d bytes of output, want 1024", len(res.Stdout))
+	}
+	if len(ee.Hints) == 0 || !strings.Contains(ee.Hints[len(ee.Hints)-1], "limit of 1024 bytes") {
+		t.Errorf("got hints %q", ee.Hints)
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// WriteHTML writes an HTML fragment describing e to w, for failure detail
+// pages, such as those of CI systems. The fragment holds the information
+// "%+v" emits: the standard error output, with lines which look like
+// errors or warnings highlighted, the details of the process, its
+// timeline, the call site which launched it, and its environment, in a
+// collapsible section. Messages are translated using Config.Catalog.
+//
+// The fragment is a single <div> element of class "execx-error". Its
+// parts carry classes prefixed with "execx-", such that pages can style
+// them. Highlighted lines carry the classes "execx-line-error" and
+// "execx-line-warning".
+func (e *ExitError) WriteHTML(w io.Writer) error {
+	return htmlReport.Execute(w, e.report(defaultPrinter()))
+}
+
+// WriteANSI writes a description of e to w, like "%+v" does, but using
+// ANSI escape sequences to highlight its structure, and lines of standard
+// error output which look like errors or warnings, for display in
+// terminals. Messages are translated using Config.Catalog.
+func (e *ExitError) WriteANSI(w io.Writer) error {
+	r := e.report(defaultPrinter())
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s%s%s\n", ansiBold+ansiRed, r.Title, ansiReset)
+	for _, hint := range r.Hints {
+		fmt.Fprintf(bw, "%s%s%s\n", ansiYellow, hint, ansiReset)
+	}
+	if len(r.Stderr) > 0 {
+		fmt.Fprintf(bw, "%s%s%s\n", ansiBold, r.StderrLabel, ansiReset)
+		for _, line := range r.Stderr {
+			switch line.Level {
+			case "error":
+				fmt.Fprintf(bw, "\t%s%s%s\n", ansiRed, line.Text, ansiReset)
+			case "warning":
+				fmt.Fprintf(bw, "\t%s%s%s\n", ansiYellow, line.Text, ansiReset)
+			default:
+				fmt.Fprintf(bw, "\t%s\n", line.Text)
+			}
+		}
+	}
+	for _, f := range r.Facts {
+		fmt.Fprintf(bw, "%s%s:%s %s\n", ansiDim, f.Label, ansiReset, f.Value)
+	}
+	ansiSection(bw, r.TimelineLabel, r.Timeline)
+	ansiSection(bw, r.CallersLabel, r.Callers)
+	if len(r.Env) > 0 {
+		fmt.Fprintf(bw, "%s%s%s\n", ansiBold, r.EnvLabel, ansiReset)
+		for _, v := range r.Env {
+			fmt.Fprintf(bw, "\t%s%s%s=%s", ansiCyan, v.Key, ansiReset, v.Value)
+			if v.Source != "" {
+				fmt.Fprintf(bw, " %s(%s)%s", ansiDim, v.Source, ansiReset)
+			}
+			fmt.Fprintf(bw, "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// ANSI escape sequences used by WriteANSI.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+func ansiSection(w io.Writer, label string, facts []reportFact) {
+	if len(facts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s%s%s\n", ansiBold, label, ansiReset)
+	for _, f := range facts {
+		fmt.Fprintf(w, "\t%s%s%s\t%s\n", ansiDim, f.Label, ansiReset, f.Value)
+	}
+}
+
+// report is the information rendered by WriteHTML and WriteANSI.
+type report struct {
+	Title         string
+	Hints         []string
+	StderrLabel   string
+	Stderr        []reportLine
+	Facts         []reportFact
+	TimelineLabel string
+	Timeline      []reportFact
+	CallersLabel  string
+	Callers       []reportFact
+	EnvLabel      string
+	Env           []reportVar
+}
+
+type reportFact struct {
+	Label, Value string
+}
+
+type reportLine struct {
+	Text  string
+	Level string // "error", "warning", or empty
+}
+
+type reportVar struct {
+	Key, Value, Source string
+}
+
+var (
+	errorLineRE   = regexp.MustCompile(`(?i)\b(error|fatal|panic|failed|failure)\b`)
+	warningLineRE = regexp.MustCompile(`(?i)\b(warning|warn|deprecated)\b`)
+)
+
+// report gathers the information about e rendered by WriteHTML and
+// WriteANSI, translating messages using p.
+func (e *ExitError) report(p printer) *report {
+	r := &report{
+		Title:         e.Cmdline() + ": " + e.Error(),
+		StderrLabel:   p.sprintf("stderr:"),
+		TimelineLabel: p.sprintf("timeline:"),
+		CallersLabel:  p.sprintf("called from:"),
+	}
+	if e.Reason != ReasonNone {
+		r.Title += fmt.Sprintf(" (%s)", e.Reason)
+	}
+	for _, hint := range e.localizedHints(p) {
+		r.Hints = append(r.Hints, p.sprintf("hint: %s", hint))
+	}
+	if e.ExitError != nil {
+		stderr := strings.TrimRight(string(e.ExitError.Stderr), "\n")
+		if stderr != "" {
+			for _, line := range strings.Split(stderr, "\n") {
+				rl := reportLine{Text: line}
+				switch {
+				case errorLineRE.MatchString(line):
+					rl.Level = "error"
+				case warningLineRE.MatchString(line):
+					rl.Level = "warning"
+				}
+				r.Stderr = append(r.Stderr, rl)
+			}
+		}
+	}
+	fact := func(line string) {
+		label, value, _ := strings.Cut(line, ":")
+		r.Facts = append(r.Facts, reportFact{Label: label, Value: strings.TrimSpace(value)})
+	}
+	if e.Symlinked() {
+		fact(p.sprintf("resolved path: %s", e.ResolvedPath))
+	}
+	fact(p.sprintf("workdir: %s", e.Dir))
+	if e.PID != 0 {
+		fact(p.sprintf("pid: %d ppid: %d pgid: %d", e.PID, e.PPID, e.PGID))
+	}
+	fact(p.sprintf("user time: %v", e.UserTime()))
+	fact(p.sprintf("system time: %v", e.SystemTime()))
+	if e.StderrDropped > 0 {
+		fact(p.sprintf("stderr truncated: dropped %d bytes", e.StderrDropped))
+	}
+	for _, d := range e.Details {
+		r.Facts = append(r.Facts, reportFact{Label: d.Key, Value: fmt.Sprint(d.Value)})
+	}
+	if e.Result != nil {
+		if e.Result.Scheduling != nil {
+			fact(p.sprintf("scheduling: %v", e.Result.Scheduling))
+		}
+		for _, ev := range e.Result.Timeline.events(p) {
+			r.Timeline = append(r.Timeline, reportFact{Label: ev.name, Value: fmt.Sprintf("+%.3fms", ev.ms)})
+		}
+	}
+	frames := e.callers.frames()
+	if len(frames) > callFrames {
+		frames = frames[:callFrames]
+	}
+	for _, f := range frames {
+		r.Callers = append(r.Callers, reportFact{Label: f.Function, Value: fmt.Sprintf("%s:%d", f.File, f.Line)})
+	}
+	keys := make([]string, 0, len(e.ChildEnv))
+	for k := range e.ChildEnv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := reportVar{Key: k, Value: e.ChildEnv[k]}
+		if src, ok := e.EnvSources[k]; ok && src.Origin != EnvInherited {
+			v.Source = src.String()
+		}
+		r.Env = append(r.Env, v)
+	}
+	if len(e.Profiles) > 0 {
+		fact(p.sprintf("profiles: %s", strings.Join(e.Profiles, ", ")))
+	}
+	r.EnvLabel = p.sprintf("environment (%d variables):", len(r.Env))
+	return r
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<div class="execx-error">
+<p class="execx-title"><code>{{.Title}}</code></p>
+{{- if .Hints}}
+<ul class="execx-hints">
+{{- range .Hints}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Stderr}}
+<details class="execx-stderr" open>
+<summary>{{.StderrLabel}}</summary>
+<pre>
+{{- range .Stderr}}
+{{if .Level}}<span class="execx-line-{{.Level}}">{{.Text}}</span>{{else}}{{.Text}}{{end}}
+{{- end}}
+</pre>
+</details>
+{{- end}}
+<dl class="execx-facts">
+{{- range .Facts}}
+<dt>{{.Label}}</dt><dd>{{.Value}}</dd>
+{{- end}}
+</dl>
+{{- if .Timeline}}
+<details class="execx-timeline">
+<summary>{{.TimelineLabel}}</summary>
+<table>
+{{- range .Timeline}}
+<tr><td>{{.Label}}</td><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+</details>
+{{- end}}
+{{- if .Callers}}
+<details class="execx-callers">
+<summary>{{.CallersLabel}}</summary>
+<ol>
+{{- range .Callers}}
+<li><code>{{.Label}}</code><br><code>{{.Value}}</code></li>
+{{- end}}
+</ol>
+</details>
+{{- end}}
+{{- if .Env}}
+<details class="execx-env">
+<summary>{{.EnvLabel}}</summary>
+<table>
+{{- range .Env}}
+<tr><td><code>{{.Key}}</code></td><td><code>{{.Value}}</code></td><td>{{.Source}}</td></tr>
+{{- end}}
+</table>
+</details>
+{{- end}}
+</div>
+`))
@@ -0,0 +1,82 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func renderError(t *testing.T) *execx.ExitError {
+	t.Helper()
+
+	cmd := exec.Command("sh", "-c", `echo "building <main>" >&2; echo "warning: unused" >&2; echo "error: undefined: x" >&2; exit 2`)
+	_, err := execx.Run(context.Background(), cmd, execx.WithEnv("EXECX_RENDER", "a&b"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Skipf("cannot run sh: %v", err)
+	}
+	return ee
+}
+
+func TestWriteHTML(t *testing.T) {
+	ee := renderError(t)
+	var buf bytes.Buffer
+	if err := ee.WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		`<div class="execx-error">`,
+		`building &lt;main&gt;`,
+		`<span class="execx-line-warning">warning: unused</span>`,
+		`<span class="execx-line-error">error: undefined: x</span>`,
+		`<dt>workdir</dt>`,
+		`<details class="execx-env">`,
+		`<code>a&amp;b</code>`,
+		`WithEnv at `,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("HTML does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestWriteANSI(t *testing.T) {
+	ee := renderError(t)
+	var buf bytes.Buffer
+	if err := ee.WriteANSI(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"\x1b[1m\x1b[31msh -c ",
+		": exit status 2\x1b[0m\n",
+		"\t\x1b[31merror: undefined: x\x1b[0m\n",
+		"\t\x1b[33mwarning: unused\x1b[0m\n",
+		"\tbuilding <main>\n",
+		"\x1b[36mEXECX_RENDER\x1b[0m=a&b",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ANSI output does not contain %q:\n%q", want, got)
+		}
+	}
+}
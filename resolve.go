@@ -0,0 +1,279 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// A Resolution records how an executable was located.
+type Resolution struct {
+	// Name is the name of the executable, as requested.
+	Name string
+
+	// Path is the path the executable was resolved to.
+	Path string
+
+	// Via describes the steps which led to Path, such as the
+	// configuration files which were consulted.
+	Via []string
+}
+
+// String returns a description of the resolution, such as
+//
+//	resolved "node" via .tool-versions → /home/user/.asdf/installs/nodejs/20.1.0/bin/node
+func (r *Resolution) String() string {
+	chain := append(r.Via[:len(r.Via):len(r.Via)], r.Path)
+	return fmt.Sprintf("resolved %q via %s", r.Name, strings.Join(chain, " → "))
+}
+
+// A Resolver locates executables by name.
+type Resolver interface {
+	Resolve(name string) (*Resolution, error)
+}
+
+// ResolverFunc is an adapter to allow the use of ordinary functions as
+// resolvers.
+type ResolverFunc func(name string) (*Resolution, error)
+
+// Resolve returns f(name).
+func (f ResolverFunc) Resolve(name string) (*Resolution, error) {
+	return f(name)
+}
+
+// ResolveError records a failure to resolve an executable.
+type ResolveError struct {
+	// Name is the name of the executable.
+	Name string
+
+	// Errs holds the errors encountered by each resolver which
+	// was consulted, in order.
+	Errs []error
+}
+
+func (e *ResolveError) Error() string {
+	var msgs []string
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("execx: cannot resolve %q: %s", e.Name, strings.Join(msgs, "; "))
+}
+
+// WithResolver locates the executable named by cmd.Args[0] using r, rather
+// than $PATH. Names which contain a path separator are not resolved. The
+// resolution is recorded as a detail named "resolution" in errors produced
+// by the command. If the executable cannot be located, Start returns a
+// *StartError which wraps the error returned by r.
+func WithResolver(r Resolver) Option {
+	return func(cfg *config) {
+		cfg.resolver = r
+	}
+}
+
+// resolve resolves the executable of h.cmd using the configured resolver.
+func (h *Handle) resolve() error {
+	cmd := h.cmd
+	name := cmd.Path
+	if len(cmd.Args) > 0 {
+		name = cmd.Args[0]
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return nil
+	}
+	res, err := h.cfg.resolver.Resolve(name)
+	if err != nil {
+		return wrapStart(err, cmd, h.cfg.collectors)
+	}
+	cmd.Path = res.Path
+	cmd.Err = nil
+	h.cfg.collectors = append(h.cfg.collectors, CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "resolution", res
+	}))
+	return nil
+}
+
+// PathResolver locates executables in $PATH, using exec.LookPath.
+var PathResolver Resolver = ResolverFunc(func(name string) (*Resolution, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Resolution{Name: name, Path: path, Via: []string{"$PATH"}}, nil
+})
+
+// DirResolver returns a Resolver which locates executables in the
+// specified directories, such as a project's vendored bin directory.
+func DirResolver(dirs ...string) Resolver {
+	return ResolverFunc(func(name string) (*Resolution, error) {
+		for _, dir := range dirs {
+			path := filepath.Join(dir, name)
+			if isExecutable(path) {
+				return &Resolution{Name: name, Path: path, Via: []string{dir}}, nil
+			}
+		}
+		return nil, fmt.Errorf("%q not found in %s", name, strings.Join(dirs, ", "))
+	})
+}
+
+// ToolVersionsResolver returns a Resolver which locates executables
+// installed by the asdf or mise version managers, according to the
+// .tool-versions, mise.toml or .mise.toml file found in dir or the
+// closest of its parents. For each tool listed in the file, the
+// resolver looks for the executable in the bin directory of the
+// installation of the pinned version.
+func ToolVersionsResolver(dir string) Resolver {
+	return ResolverFunc(func(name string) (*Resolution, error) {
+		cfgPath, tools, err := findToolVersions(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, tool := range tools {
+			for _, root := range installRoots() {
+				path := filepath.Join(root, tool.name, tool.version, "bin", name)
+				if isExecutable(path) {
+					via := fmt.Sprintf("%s (%s %s)", cfgPath, tool.name, tool.version)
+					return &Resolution{Name: name, Path: path, Via: []string{via}}, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%q not provided by any tool pinned in %s", name, cfgPath)
+	})
+}
+
+// Chain returns a Resolver which consults the specified resolvers in
+// order, and returns the first successful resolution. If all resolvers
+// fail, the returned error is a *ResolveError.
+func Chain(rs ...Resolver) Resolver {
+	return ResolverFunc(func(name string) (*Resolution, error) {
+		rerr := &ResolveError{Name: name}
+		for _, r := range rs {
+			res, err := r.Resolve(name)
+			if err == nil {
+				return res, nil
+			}
+			rerr.Errs = append(rerr.Errs, err)
+		}
+		return nil, rerr
+	})
+}
+
+// toolVersion is a tool pinned to a specific version.
+type toolVersion struct {
+	name    string
+	version string
+}
+
+// findToolVersions finds and parses the version manager configuration file
+// closest to dir.
+func findToolVersions(dir string) (string, []toolVersion, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		for _, name := range []string{".tool-versions", "mise.toml", ".mise.toml"} {
+			path := filepath.Join(dir, name)
+			f, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			var tools []toolVersion
+			if name == ".tool-versions" {
+				tools, err = parseToolVersions(f)
+			} else {
+				tools, err = parseMiseTools(f)
+			}
+			f.Close()
+			return path, tools, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, fmt.Errorf("no .tool-versions or mise.toml found")
+		}
+		dir = parent
+	}
+}
+
+// parseToolVersions parses an asdf .tool-versions file.
+func parseToolVersions(f *os.File) ([]toolVersion, error) {
+	var tools []toolVersion
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		tools = append(tools, toolVersion{name: fields[0], version: fields[1]})
+	}
+	return tools, sc.Err()
+}
+
+// parseMiseTools parses the [tools] section of a mise.toml file. Only
+// simple string values, such as node = "20.1.0", are understood.
+func parseMiseTools(f *os.File) ([]toolVersion, error) {
+	var tools []toolVersion
+	inTools := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") {
+			inTools = line == "[tools]"
+			continue
+		}
+		eq := strings.IndexByte(line, '=')
+		if !inTools || eq < 0 {
+			continue
+		}
+		name := strings.Trim(strings.TrimSpace(line[:eq]), `"'`)
+		version := strings.Trim(strings.TrimSpace(line[eq+1:]), `"'`)
+		if name != "" && version != "" {
+			tools = append(tools, toolVersion{name: name, version: version})
+		}
+	}
+	return tools, sc.Err()
+}
+
+// installRoots returns the directories asdf and mise install tools in.
+func installRoots() []string {
+	home, _ := os.UserHomeDir()
+	asdf := os.Getenv("ASDF_DATA_DIR")
+	if asdf == "" {
+		asdf = filepath.Join(home, ".asdf")
+	}
+	mise := os.Getenv("MISE_DATA_DIR")
+	if mise == "" {
+		mise = filepath.Join(home, ".local", "share", "mise")
+	}
+	return []string{filepath.Join(asdf, "installs"), filepath.Join(mise, "installs")}
+}
+
+// isExecutable reports whether path names an executable regular file.
+func isExecutable(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	return runtime.GOOS == "windows" || fi.Mode()&0111 != 0
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestResolver(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test executables are shell scripts")
+	}
+	t.Run("ToolVersions", testResolverToolVersions)
+	t.Run("Mise", testResolverMise)
+	t.Run("Run", testResolverRun)
+	t.Run("Failure", testResolverFailure)
+}
+
+func testResolverToolVersions(t *testing.T) {
+	dir := tempDir(t)
+	os.Setenv("ASDF_DATA_DIR", filepath.Join(dir, "asdf"))
+	defer os.Unsetenv("ASDF_DATA_DIR")
+
+	bin := filepath.Join(dir, "asdf", "installs", "nodejs", "20.1.0", "bin")
+	writeExecutable(t, filepath.Join(bin, "node"), "#!/bin/sh\n")
+	writeFile(t, filepath.Join(dir, "project", ".tool-versions"), "nodejs 20.1.0 # pinned\n")
+	sub := filepath.Join(dir, "project", "sub")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := execx.ToolVersionsResolver(sub).Resolve("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(bin, "node"); res.Path != want {
+		t.Errorf("got path %q, want %q", res.Path, want)
+	}
+	if !strings.Contains(res.String(), ".tool-versions (nodejs 20.1.0) → ") {
+		t.Errorf("resolution %q doesn't describe chain", res)
+	}
+}
+
+func testResolverMise(t *testing.T) {
+	dir := tempDir(t)
+	os.Setenv("MISE_DATA_DIR", filepath.Join(dir, "mise"))
+	defer os.Unsetenv("MISE_DATA_DIR")
+
+	bin := filepath.Join(dir, "mise", "installs", "go", "1.22", "bin")
+	writeExecutable(t, filepath.Join(bin, "gofmt"), "#!/bin/sh\n")
+	writeFile(t, filepath.Join(dir, "mise.toml"), "[env]\nA = \"b\"\n[tools]\ngo = \"1.22\"\n")
+
+	res, err := execx.ToolVersionsResolver(dir).Resolve("gofmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(bin, "gofmt"); res.Path != want {
+		t.Errorf("got path %q, want %q", res.Path, want)
+	}
+}
+
+func testResolverRun(t *testing.T) {
+	dir := tempDir(t)
+	writeExecutable(t, filepath.Join(dir, "execx-vendored"), "#!/bin/sh\necho vendored\nexit 1\n")
+
+	cmd := exec.Command("execx-vendored")
+	r := execx.Chain(execx.PathResolver, execx.DirResolver(dir))
+	_, err := execx.Run(context.Background(), cmd, execx.WithResolver(r))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	if string(ee.Result.Stdout) != "vendored\n" {
+		t.Errorf("didn't run vendored executable")
+	}
+	res, ok := ee.Fields()["resolution"].(*execx.Resolution)
+	if !ok || res.Via[0] != dir {
+		t.Errorf("resolution not recorded in error")
+	}
+}
+
+func testResolverFailure(t *testing.T) {
+	cmd := exec.Command("execx-no-such-command")
+	r := execx.Chain(execx.PathResolver, execx.DirResolver(tempDir(t)))
+	_, err := execx.Run(context.Background(), cmd, execx.WithResolver(r))
+	se, ok := err.(*execx.StartError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.StartError)(nil))
+	}
+	rerr, ok := se.Err.(*execx.ResolveError)
+	if !ok {
+		t.Fatalf("got %T, want %T", se.Err, (*execx.ResolveError)(nil))
+	}
+	if len(rerr.Errs) != 2 {
+		t.Errorf("got %d errors, want 2", len(rerr.Errs))
+	}
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "execx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeExecutable(t *testing.T, path, contents string) {
+	t.Helper()
+
+	writeFile(t, path, contents)
+	if err := os.Chmod(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
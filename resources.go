@@ -0,0 +1,190 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A ResourceSample is a sample of the resource usage of a process.
+type ResourceSample struct {
+	// Time is the time the sample was taken.
+	Time time.Time
+
+	// RSS is the resident set size of the process, in bytes.
+	RSS uint64
+
+	// CPU is the CPU time consumed by the process so far, in user and
+	// system mode.
+	CPU time.Duration
+}
+
+// ResourceUsage summarizes the resource usage of a process over its
+// lifetime, as sampled by WithResourceSampling.
+type ResourceUsage struct {
+	// Samples holds a time series of samples, oldest first. To keep
+	// the series small, its resolution is halved whenever it grows
+	// beyond 120 samples.
+	Samples []ResourceSample
+
+	// PeakRSS is the largest resident set size sampled, in bytes.
+	PeakRSS uint64
+
+	// AvgRSS is the average resident set size sampled, in bytes.
+	AvgRSS uint64
+
+	// CPU is the CPU time consumed by the process, as of the last
+	// sample.
+	CPU time.Duration
+
+	// Count is the number of samples taken, including samples which
+	// were dropped from Samples.
+	Count int
+}
+
+func (u *ResourceUsage) String() string {
+	return fmt.Sprintf("peak rss %s, avg rss %s, cpu %v over %d samples",
+		formatBytes(u.PeakRSS), formatBytes(u.AvgRSS), u.CPU.Round(time.Millisecond), u.Count)
+}
+
+// formatBytes formats n as a human readable size, with binary multipliers.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// defaultResourceInterval is the default sampling interval used by
+// WithResourceSampling.
+const defaultResourceInterval = 100 * time.Millisecond
+
+// maxResourceSamples bounds the length of ResourceUsage.Samples.
+const maxResourceSamples = 120
+
+// WithResourceSampling samples the resident set size and CPU time of the
+// process at the specified interval while it runs, or every 100ms if
+// interval is zero. The samples are summarized in Result.Resources, and
+// recorded as a *ResourceUsage detail named "resources" in errors produced
+// by the command, such that a command which ran out of memory can be
+// diagnosed after the fact. WithResourceSampling is supported on Linux
+// only, and does nothing on other platforms.
+func WithResourceSampling(interval time.Duration) Option {
+	return func(cfg *config) {
+		if interval <= 0 {
+			interval = defaultResourceInterval
+		}
+		cfg.resourceInterval = interval
+	}
+}
+
+// resourceSampler periodically samples the resource usage of a process.
+type resourceSampler struct {
+	done chan struct{} // closed when sampling stops
+
+	mu     sync.Mutex // protects the fields below
+	usage  ResourceUsage
+	sum    uint64 // sum of RSS samples
+	stride int    // number of samples per entry in usage.Samples
+	skip   int    // samples to skip before the next entry
+}
+
+// sampleResources samples the resource usage of the process with the
+// specified pid until exited is closed, recording panics in ie.
+// sampleResources returns nil if resource usage is not available on this
+// platform.
+func sampleResources(pid int, interval time.Duration, exited <-chan struct{}, ie *internalErrors) *resourceSampler {
+	if !resourceSamplingSupported {
+		return nil
+	}
+	s := &resourceSampler{done: make(chan struct{}), stride: 1}
+	go func() {
+		defer close(s.done)
+		defer ie.catch("sample resource usage")
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			sample, err := readResourceSample(pid)
+			select {
+			case <-exited:
+				// The process may have been reaped while it was
+				// being sampled, and the sample may be bogus.
+				return
+			default:
+			}
+			if err == nil {
+				s.add(sample)
+			}
+			select {
+			case <-t.C:
+			case <-exited:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// add records sample.
+func (s *resourceSampler) add(sample ResourceSample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := &s.usage
+	u.Count++
+	s.sum += sample.RSS
+	u.AvgRSS = s.sum / uint64(u.Count)
+	if sample.RSS > u.PeakRSS {
+		u.PeakRSS = sample.RSS
+	}
+	u.CPU = sample.CPU
+	if s.skip > 0 {
+		s.skip--
+		return
+	}
+	if len(u.Samples) == maxResourceSamples {
+		for i := 0; i < len(u.Samples)/2; i++ {
+			u.Samples[i] = u.Samples[2*i]
+		}
+		u.Samples = u.Samples[:len(u.Samples)/2]
+		s.stride *= 2
+	}
+	u.Samples = append(u.Samples, sample)
+	s.skip = s.stride - 1
+}
+
+// result waits for sampling to stop, and returns the summary of the
+// samples, or nil if there are none.
+func (s *resourceSampler) result() *ResourceUsage {
+	if s == nil {
+		return nil
+	}
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.usage.Count == 0 {
+		return nil
+	}
+	u := s.usage
+	u.Samples = append([]ResourceSample(nil), u.Samples...)
+	return &u
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const resourceSamplingSupported = true
+
+var pageSize = uint64(os.Getpagesize())
+
+// readResourceSample samples the resource usage of the process with the
+// specified pid from /proc/<pid>/stat.
+func readResourceSample(pid int) (ResourceSample, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return ResourceSample{}, err
+	}
+	// User and system time are the 12th and 13th fields after the
+	// command name, and the resident set size, in pages, is the 22nd.
+	s := string(b)
+	rp := strings.LastIndexByte(s, ')')
+	if rp < 0 {
+		return ResourceSample{}, errors.New("execx: malformed /proc/<pid>/stat")
+	}
+	fields := strings.Fields(s[rp+1:])
+	if len(fields) < 22 {
+		return ResourceSample{}, errors.New("execx: malformed /proc/<pid>/stat")
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	rss, _ := strconv.ParseUint(fields[21], 10, 64)
+	if rss == 0 {
+		// The process is exiting, and its memory map is gone.
+		return ResourceSample{}, errProcExiting
+	}
+	return ResourceSample{
+		Time: time.Now(),
+		RSS:  rss * pageSize,
+		CPU:  time.Duration(utime+stime) * time.Second / clockTicks,
+	}, nil
+}
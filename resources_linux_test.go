@@ -0,0 +1,75 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWithResourceSampling(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("balloon"), execx.WithResourceSampling(20*time.Millisecond))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	u := ee.Result.Resources
+	if u == nil {
+		t.Fatal("no resource usage in Result")
+	}
+	if u.PeakRSS < 64<<20 {
+		t.Errorf("got peak RSS %d, want at least 64MiB", u.PeakRSS)
+	}
+	if u.AvgRSS == 0 || u.AvgRSS > u.PeakRSS {
+		t.Errorf("got average RSS %d, peak %d", u.AvgRSS, u.PeakRSS)
+	}
+	if len(u.Samples) < 2 || len(u.Samples) > u.Count {
+		t.Errorf("got %d samples, count %d", len(u.Samples), u.Count)
+	}
+	v, ok := ee.Detail("resources")
+	if !ok || v.(*execx.ResourceUsage) != u {
+		t.Fatalf("got resources detail %v", v)
+	}
+	if s := u.String(); !strings.Contains(s, "peak rss") || !strings.Contains(s, "MiB") {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestResourceSamplingBounded(t *testing.T) {
+	res, err := execx.Run(context.Background(), selfCmd("nap"), execx.WithResourceSampling(time.Millisecond))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	u := res.Resources
+	if u == nil {
+		t.Fatal("no resource usage in Result")
+	}
+	if len(u.Samples) > 120 {
+		t.Errorf("got %d samples, want at most 120", len(u.Samples))
+	}
+	if u.Count <= len(u.Samples) {
+		t.Errorf("got count %d for %d samples, want samples dropped", u.Count, len(u.Samples))
+	}
+	for i := 1; i < len(u.Samples); i++ {
+		if u.Samples[i].Time.Before(u.Samples[i-1].Time) {
+			t.Fatalf("samples out of order at %d", i)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// A Root is an alternate root file system for a command, such as a
+// directory holding a minimal image for a build tool, into which parts of
+// the file system of the caller are bind mounted.
+type Root struct {
+	// Path is the directory which becomes the root directory of the
+	// command.
+	Path string
+
+	// Binds lists the files and directories of the caller which are
+	// made available under the root.
+	Binds []Bind
+}
+
+// A Bind is a bind mount from the file system of the caller into a Root.
+type Bind struct {
+	// Source is the path of the file or directory being mounted.
+	Source string
+
+	// Target is the path of the mount, relative to the root. If Target
+	// is empty, Source is used. Missing mount points are created.
+	Target string
+
+	// Writable makes the mount writable. By default, bind mounts are
+	// read-only.
+	Writable bool
+}
+
+// target returns the path of the mount point of b, under root.
+func (b Bind) target(root string) string {
+	t := b.Target
+	if t == "" {
+		t = b.Source
+	}
+	return filepath.Join(root, filepath.Clean("/"+t))
+}
+
+func (b Bind) String() string {
+	mode := "ro"
+	if b.Writable {
+		mode = "rw"
+	}
+	if b.Target == "" || b.Target == b.Source {
+		return b.Source + ":" + mode
+	}
+	return b.Source + ":" + b.Target + ":" + mode
+}
+
+// String returns a compact description of r, suitable for error messages.
+func (r *Root) String() string {
+	if len(r.Binds) == 0 {
+		return r.Path
+	}
+	binds := make([]string, len(r.Binds))
+	for i, b := range r.Binds {
+		binds[i] = b.String()
+	}
+	return r.Path + " " + strings.Join(binds, " ")
+}
+
+// WithRoot runs the command in a new mount namespace, in which r.Path is
+// the root directory, and in which the bind mounts described by r are set
+// up. cmd.Path and cmd.Dir are resolved under the new root. Mounts do not
+// propagate back to the caller, and disappear with the command and its
+// descendants. The root is recorded as a detail named "root" in errors
+// produced by the command.
+//
+// If the mounts cannot be set up, the command fails to start with a
+// *StartError which wraps a *MountError. WithRoot is supported on Linux
+// only, and requires the CAP_SYS_ADMIN capability. If a Sandbox is also
+// in effect, its paths are interpreted under the new root.
+func WithRoot(r Root) Option {
+	return func(cfg *config) {
+		r.Binds = append([]Bind(nil), r.Binds...)
+		cfg.root = &r
+	}
+}
+
+// A MountError records a failure to set up the alternate root of a
+// command started with WithRoot, as opposed to a failure of the command.
+type MountError struct {
+	// Op is the operation which failed, such as "unshare", "bind",
+	// "remount" or "pivot_root".
+	Op string
+
+	// Source and Target are the paths involved in the operation, if any.
+	Source string
+	Target string
+
+	Err error
+}
+
+func (e *MountError) Error() string {
+	switch {
+	case e.Source != "":
+		return fmt.Sprintf("execx: root: %s %s on %s: %v", e.Op, e.Source, e.Target, e.Err)
+	case e.Target != "":
+		return fmt.Sprintf("execx: root: %s %s: %v", e.Op, e.Target, e.Err)
+	default:
+		return fmt.Sprintf("execx: root: %s: %v", e.Op, e.Err)
+	}
+}
+
+// Unwrap returns e.Err.
+func (e *MountError) Unwrap() error {
+	return e.Err
+}
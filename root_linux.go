@@ -0,0 +1,141 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// startInRoot starts cmd in a new mount namespace, rooted as per r, and
+// under the restrictions described by s, if s is not nil.
+func startInRoot(cmd *exec.Cmd, r *Root, s *Sandbox) error {
+	if s != nil && s.Profile != "" {
+		return errors.New("execx: sandbox: profiles are only supported on macOS")
+	}
+	root, err := filepath.Abs(r.Path)
+	if err != nil {
+		return &MountError{Op: "resolve", Target: r.Path, Err: err}
+	}
+	// os/exec opens the null device for standard streams which are nil,
+	// which may not exist under the new root.
+	if cmd.Stdin == nil || cmd.Stdout == nil || cmd.Stderr == nil {
+		null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		defer null.Close()
+		if cmd.Stdin == nil {
+			cmd.Stdin = null
+		}
+		if cmd.Stdout == nil {
+			cmd.Stdout = null
+		}
+		if cmd.Stderr == nil {
+			cmd.Stderr = null
+		}
+	}
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		// Deliberately no UnlockOSThread: the thread is in a mount
+		// namespace of its own, and must not be reused.
+		if err := enterRoot(root, r.Binds); err != nil {
+			errc <- err
+			return
+		}
+		if s != nil {
+			if err := restrictThread(s); err != nil {
+				errc <- err
+				return
+			}
+		}
+		errc <- cmd.Start()
+	}()
+	return <-errc
+}
+
+// enterRoot moves the calling thread to a new mount namespace, sets up
+// binds under root, and makes root the root directory of the thread.
+func enterRoot(root string, binds []Bind) error {
+	if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
+		return &MountError{Op: "unshare", Err: err}
+	}
+	// Keep the mounts which follow from propagating to the caller.
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return &MountError{Op: "make-private", Target: "/", Err: err}
+	}
+	// pivot_root requires the new root to be a mount point.
+	if err := syscall.Mount(root, root, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return &MountError{Op: "bind", Source: root, Target: root, Err: err}
+	}
+	for _, b := range binds {
+		target := b.target(root)
+		if err := mountPoint(b.Source, target); err != nil {
+			return &MountError{Op: "bind", Source: b.Source, Target: target, Err: err}
+		}
+		if err := syscall.Mount(b.Source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return &MountError{Op: "bind", Source: b.Source, Target: target, Err: err}
+		}
+		if b.Writable {
+			continue
+		}
+		if err := syscall.Mount("", target, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+			return &MountError{Op: "remount", Target: target, Err: err}
+		}
+	}
+	if err := syscall.Chdir(root); err != nil {
+		return &MountError{Op: "chdir", Target: root, Err: err}
+	}
+	// Stack the new root on top of the old one, then detach the old
+	// one, such that no directory needs to be set aside for it.
+	if err := syscall.PivotRoot(".", "."); err != nil {
+		return &MountError{Op: "pivot_root", Target: root, Err: err}
+	}
+	if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+		return &MountError{Op: "unmount", Target: "old root", Err: err}
+	}
+	if err := syscall.Chdir("/"); err != nil {
+		return &MountError{Op: "chdir", Target: "/", Err: err}
+	}
+	return nil
+}
+
+// mountPoint creates target, as a directory or as an empty file, after
+// the type of source, if it does not exist.
+func mountPoint(source, target string) error {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(target); err == nil {
+		return nil
+	}
+	if fi.IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+// systemBinds returns read-only binds of the directories a shell needs.
+func systemBinds() []execx.Bind {
+	var binds []execx.Bind
+	for _, dir := range []string{"/bin", "/lib", "/lib64", "/usr"} {
+		if _, err := os.Stat(dir); err == nil {
+			binds = append(binds, execx.Bind{Source: dir})
+		}
+	}
+	return binds
+}
+
+func TestWithRoot(t *testing.T) {
+	root := tempDir(t)
+	if err := ioutil.WriteFile(filepath.Join(root, "marker"), []byte("inside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := tempDir(t)
+	binds := append(systemBinds(), execx.Bind{Source: out, Target: "/out", Writable: true})
+	opt := execx.WithRoot(execx.Root{Path: root, Binds: binds})
+
+	cmd := exec.Command("/bin/sh", "-c", "cat /marker && touch /out/written")
+	res, err := execx.Run(context.Background(), cmd, opt)
+	var me *execx.MountError
+	if errors.As(err, &me) && errors.Is(me.Err, syscall.EPERM) {
+		t.Skipf("mount namespaces not permitted: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Stdout); got != "inside" {
+		t.Errorf("read %q from the root, want %q", got, "inside")
+	}
+	if _, err := os.Stat(filepath.Join(out, "written")); err != nil {
+		t.Errorf("write to writable bind: %v", err)
+	}
+
+	cmd = exec.Command("/bin/sh", "-c", "touch /usr/execx-root-test")
+	_, err = execx.Run(context.Background(), cmd, opt)
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("write to read-only bind: got %v, want *ExitError", err)
+	}
+	if !strings.Contains(string(ee.Stderr), "Read-only") {
+		t.Errorf("write to read-only bind failed with %q", ee.Stderr)
+	}
+	if got := ee.Fields()["root"]; !strings.HasPrefix(got.(string), root) {
+		t.Errorf("root = %v, want description of %s", got, root)
+	}
+}
+
+func TestWithRootMountError(t *testing.T) {
+	root := tempDir(t)
+	binds := []execx.Bind{{Source: filepath.Join(root, "missing"), Target: "/missing"}}
+	cmd := exec.Command("/bin/true")
+	_, err := execx.Run(context.Background(), cmd, execx.WithRoot(execx.Root{Path: root, Binds: binds}))
+	se, ok := err.(*execx.StartError)
+	if !ok {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+	var me *execx.MountError
+	if !errors.As(se, &me) {
+		t.Fatalf("got %v, want a *MountError", se.Err)
+	}
+	if me.Op == "unshare" {
+		t.Skipf("mount namespaces not permitted: %v", err)
+	}
+	if me.Op != "bind" || !errors.Is(me, os.ErrNotExist) {
+		t.Errorf("got %v, want failed bind of missing source", me)
+	}
+}
@@ -0,0 +1,1010 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// An Option configures a command run by Run or Start.
+type Option func(*config)
+
+// config holds the configuration for a command run by Run or Start.
+type config struct {
+	collectors []Collector
+	timeout    time.Duration
+	grace      time.Duration
+	decoder    Decoder
+	resolver   Resolver
+	sched      *Scheduling
+	sandbox    *Sandbox
+	root       *Root
+	noNetwork  bool
+	dir        string
+	argv0      string
+	allowed    []int
+	failIf     []func(stdout, stderr []byte) (string, bool)
+	contracts  []Contract
+	noDedup    bool
+	taps       []io.Writer
+	ready      time.Duration
+	ports      []string
+	wrappers   []Wrapper
+	injections []Injection
+	winQuoting WindowsQuoting
+	rawCmdLine *string
+	spawn      SpawnFlags
+	procStatus bool
+	procStats  bool
+	execChain  bool
+	env        []envSetting
+	profiles   []profileRef
+	hermetic   []string
+	limit      int
+	overflow   OverflowAction
+
+	stderrLimit int
+	summarize   bool
+	sampling    *LineSampling
+	compress    bool
+
+	syslog  *syslogAddr
+	journal string
+
+	asUser    string
+	asUserSrc EnvSource
+
+	lockTimeout    time.Duration
+	lockTimeoutSet bool
+
+	aborts []abortTrigger
+
+	quota           string
+	quotaTimeout    time.Duration
+	quotaTimeoutSet bool
+
+	spawnRetries    int
+	spawnRetriesSet bool
+
+	envBaseline string
+
+	progress *progressConfig
+
+	resourceInterval time.Duration
+
+	isolatedHome    bool
+	isolatedHomeSrc EnvSource
+	homeCleanup     HomeCleanup
+
+	umask    os.FileMode
+	umaskSet bool
+
+	fdAudit FDAudit
+
+	fsChanges []string
+
+	finalState     bool
+	finalStateKeys []string
+
+	treeUsage bool
+
+	stdinCloseDelay time.Duration
+	stdinHeldOpen   bool
+
+	askpass    AskpassFunc
+	askpassSrc EnvSource
+
+	groupKill bool
+	redactEnv bool
+
+	annotations *annotationConfig
+
+	adaptiveTimeout *adaptiveTimeout
+
+	dumpSignal os.Signal
+	dumpWait   time.Duration
+
+	verboseFlags map[string][]string
+	auxiliary    bool // run on behalf of another command, such as a verbose run
+
+	extraFiles []*os.File
+	namedFiles []namedFile
+	activation []namedFile
+
+	tail    int
+	tailSet bool
+
+	shebangFallback bool
+
+	cancel       func(*exec.Cmd) error
+	waitDelay    time.Duration
+	waitDelaySet bool
+
+	stdoutWriters []io.Writer
+	stderrWriters []io.Writer
+
+	stdinFS     fs.FS
+	stdinName   string
+	outputFS    OutputSink
+	outputNames [2]string
+
+	endpoints []endpointSpec
+}
+
+func newConfig(opts []Option) *config {
+	cfg := new(config)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithCollectors attaches details gathered by the specified collectors to
+// errors produced by the command, as per WrapWith.
+func WithCollectors(cs ...Collector) Option {
+	return func(cfg *config) {
+		cfg.collectors = append(cfg.collectors, cs...)
+	}
+}
+
+// WithTimeout kills the command if it does not complete within the
+// specified amount of time. If the command times out while blocked
+// writing to an output pipe nobody reads from, the resulting *ExitError
+// carries a hint to that effect. On Linux, a snapshot of the process tree
+// of the command, taken before it is killed, is attached to the *ExitError
+// as a *ProcNode detail named "process_tree".
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = d
+	}
+}
+
+// WithAllowedExitCodes treats the specified exit codes as success, for
+// tools such as diff and grep, which use nonzero exit codes to report
+// outcomes other than errors. If the command exits with one of the codes,
+// Run and Wait return a nil error, and the code is available in
+// Result.ExitCode. Other nonzero exit codes produce an *ExitError as usual.
+func WithAllowedExitCodes(codes ...int) Option {
+	return func(cfg *config) {
+		cfg.allowed = append(cfg.allowed, codes...)
+	}
+}
+
+// allows reports whether cfg treats the specified exit code as success.
+func (cfg *config) allows(code int) bool {
+	for _, c := range cfg.allowed {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Result describes a command which ran to completion.
+type Result struct {
+	// Path is the path of the command which was executed.
+	Path string
+
+	// Args holds command line arguments.
+	Args []string
+
+	// Dir holds the working directory for the child process.
+	Dir string
+
+	// ExitCode is the exit code of the process, or -1 if the process
+	// was terminated by a signal.
+	ExitCode int
+
+	// Stdout holds the standard output of the process, if it was
+	// captured. Standard output is captured if cmd.Stdout was nil.
+	Stdout []byte
+
+	// Stderr holds the standard error of the process, if it was
+	// captured. Standard error is captured if cmd.Stderr was nil.
+	Stderr []byte
+
+	// StdoutTail and StderrTail hold the last bytes of the standard
+	// output and the standard error of the process, if they were
+	// written to cmd.Stdout and cmd.Stderr, rather than captured. See
+	// WithOutputTail.
+	StdoutTail []byte
+	StderrTail []byte
+
+	// CompressedStdout and CompressedStderr hold the captured output of
+	// the process, gzip-compressed, if it was captured using
+	// WithCompressedCapture. See Result.StdoutBytes.
+	CompressedStdout []byte
+	CompressedStderr []byte
+
+	// ProcessState describes the exited process.
+	ProcessState *os.ProcessState
+
+	// Timeline records the lifecycle of the command.
+	Timeline Timeline
+
+	// Scheduling describes the scheduling parameters applied to the
+	// process, if any were requested. Otherwise, Scheduling is nil.
+	Scheduling *Scheduling
+
+	// Ports holds the ports allocated by WithFreePort, by placeholder.
+	Ports map[string]int
+
+	// WriterErrors holds the errors encountered by writers passed to
+	// WithStdoutWriters and WithStderrWriters.
+	WriterErrors []error
+
+	// InternalErrors holds the panics recovered in goroutines run on
+	// behalf of the command. See InternalError.
+	InternalErrors []*InternalError
+
+	// Resources summarizes the resource usage of the process, if it
+	// was sampled using WithResourceSampling.
+	Resources *ResourceUsage
+
+	// Home describes the home directory created for the command, if
+	// it was run using IsolatedHome.
+	Home *HomeDir
+
+	// LockWait is the time spent waiting for the lock taken by
+	// Exclusive, if the command was run using Exclusive.
+	LockWait time.Duration
+
+	// QuotaWait is the time Start spent waiting for the quota of the
+	// command, if it was run using WithQuota.
+	QuotaWait time.Duration
+
+	// ProcStats holds the I/O and scheduler statistics of the process,
+	// if they were captured using WithProcStats.
+	ProcStats *ProcStats
+
+	// ExecChain records the images executed by the process, if they
+	// were tracked using WithExecChain.
+	ExecChain ExecChain
+
+	// SpawnRetries records the attempts to start the process which
+	// failed with transient errors, and were retried. See
+	// WithSpawnRetries.
+	SpawnRetries []SpawnAttempt
+
+	// FSChanges records the files changed by the command, if they were
+	// tracked using WithFSChanges.
+	FSChanges *FSChanges
+
+	// FinalState describes the state of the process shortly before it
+	// exited, if it was sampled using WithFinalState.
+	FinalState *FinalState
+
+	// TreeUsage holds the resource usage of the process and of all its
+	// descendants, if it was tracked using WithTreeUsage.
+	TreeUsage *TreeUsage
+
+	// StdoutLinesDropped and StderrLinesDropped are the numbers of lines
+	// dropped from the captured standard output and standard error by
+	// WithLineSampling.
+	StdoutLinesDropped int64
+	StderrLinesDropped int64
+
+	// AskpassPrompts records the prompts answered by the AskpassFunc
+	// passed to WithAskpass, if any.
+	AskpassPrompts []AskpassPrompt
+
+	// Journal identifies the journal entries written by the command,
+	// if it was run using WithJournal. Otherwise, Journal is nil.
+	Journal *JournalRange
+
+	// Abandoned holds the names of the output streams, "stdout" or
+	// "stderr", which were still open when the WaitDelay expired, and
+	// which were closed without reading them to the end. See
+	// WithWaitDelay.
+	Abandoned []string
+
+	buffers []*bytes.Buffer // capture buffers, returned to the pool by Release
+	decoder Decoder         // decodes compressed output, once decompressed
+}
+
+// Duration returns the wall time elapsed between the start of the process
+// and the time Wait returned.
+func (r *Result) Duration() time.Duration {
+	return r.Timeline.WaitReturned.Sub(r.Timeline.Running)
+}
+
+// A Handle is a command started by Start.
+type Handle struct {
+	cmd *exec.Cmd
+	cfg *config
+
+	clock Clock // clock carried by the context passed to Start
+
+	conf     *Config  // Config current when the command was started
+	programs []string // programs executed by the command, as per checkPrograms
+
+	mu       sync.Mutex // protects timeline, hints, tree and stopped
+	timeline Timeline
+	hints    []string
+	hintMsgs []message // untranslated hints, for Catalogs
+	tree     *ProcNode // process tree, snapshotted on timeout
+	stopped  error     // error of the context which stopped the process
+
+	stdin   *inputStream
+	outputs []*outputStream
+	direct  []directOutput
+
+	sched     *Scheduling
+	oom       *oomWatch
+	proc      *procSampler
+	rsrc      *resourceSampler
+	execs     *execTracker
+	final     *stateSampler
+	treeUse   *treeSampler
+	askpass   *askpassServer
+	netns     string         // network isolation mode, if any
+	ports     map[string]int // ports allocated by WithFreePort
+	fs        outputFS       // files used by WithStdinFS and WithOutputFS
+	endpoints []*endpoint    // endpoints created by WithUnixSocket and WithNamedPipe
+	logs      logs           // sinks used by WithSyslog and WithJournal
+
+	budget *Budget // budget debited by the command, if any
+
+	quotaHeld bool          // a slot in the quota of the command is held
+	quotaWait time.Duration // time spent waiting for the slot
+
+	spawnRetries []SpawnAttempt // failed attempts to start the process
+
+	identity *Identity // identity set by AsUser, if any
+	home     *HomeDir  // home directory created by IsolatedHome, if any
+	homeRes  *Tracked  // tracks home
+
+	tracker *ResourceTracker // tracks temporary resources
+
+	fsBefore *fsSnapshot // trees watched by WithFSChanges, before the start
+
+	progress *progressTracker // progress reported by the command, if tracked
+
+	envSources map[string]EnvSource // origins of variables, if tracked
+
+	callers callers // call stack which launched the command
+
+	logCtx context.Context // context passed to the SpawnLogger
+
+	attach *attachLog // recent output, for Attach
+
+	internal *internalErrors // panics recovered in goroutines of the command
+
+	cmdline string // command line of the command, as passed to Start
+	fprint  string // fingerprint of the command, as passed to Start
+
+	exited chan struct{}
+	done   chan struct{}
+	result *Result
+	err    error
+}
+
+// Run runs cmd using the runner returned by RunnerFrom(ctx), and returns
+// a description of the run. Using the default runner, Run is equivalent to
+// calling Start followed by Wait.
+func Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	// Start rewrites cmd.Path for wrappers and shims, so the name of the
+	// tool is taken beforehand.
+	tool := toolName(cmd)
+	res, err := RunnerFrom(ctx).Run(ctx, cmd, opts...)
+	if ee, ok := err.(*ExitError); ok {
+		verboseRetry(ctx, ee, tool, opts)
+	}
+	return res, err
+}
+
+// Start starts cmd, configured by opts. If ctx is done before the command
+// completes, the process is killed.
+//
+// Start takes ownership of cmd: unless cmd.Stdin, cmd.Stdout or cmd.Stderr
+// are of type *os.File, Start replaces them with pipes it services itself,
+// in order to observe the standard I/O of the process. If cmd.Stdout or
+// cmd.Stderr are nil, the respective output is captured, and made
+// available in the Result. On Linux, output written to a destination
+// backed by a file descriptor, such as a network connection, is moved
+// using splice(2), without copying it through user space, unless it is
+// also written to other writers, or observed by options such as
+// WithProgress.
+//
+// If the command fails to start, Start returns a *StartError.
+func Start(ctx context.Context, cmd *exec.Cmd, opts ...Option) (_ *Handle, err error) {
+	cmdline := Cmdline(cmd)
+	h := &Handle{
+		cmd:      cmd,
+		cfg:      newConfig(opts),
+		clock:    ClockFrom(ctx),
+		tracker:  ResourceTrackerFrom(ctx),
+		exited:   make(chan struct{}),
+		done:     make(chan struct{}),
+		callers:  captureCallers(),
+		attach:   newAttachLog(),
+		internal: newInternalErrors(cmdline),
+		cmdline:  cmdline,
+		fprint:   Fingerprint(cmd),
+	}
+	h.mark(&h.timeline.Created)
+	started := false
+	defer func() {
+		if !started {
+			if se, ok := err.(*StartError); ok && h.cfg.redactEnv {
+				se.ParentEnv, se.ChildEnv = RedactEnv(se.ParentEnv), RedactEnv(se.ChildEnv)
+			}
+			h.releaseQuota()
+			h.removeHome()
+			h.closeEndpoints()
+			h.closeAskpass()
+			h.publishStartFailure(ctx, err)
+		}
+	}()
+	if h.cfg.adaptiveTimeout != nil {
+		// Before the command is modified, such that the fingerprint
+		// matches those recorded by History.
+		h.applyAdaptiveTimeout(ctx)
+	}
+	if h.cfg.dir != "" {
+		cmd.Dir = h.cfg.dir
+	}
+	if err := h.applyConfig(); err != nil {
+		return nil, err
+	}
+	if err := ScopeFrom(ctx).closed(); err != nil {
+		return nil, wrapStart(err, cmd, h.cfg.collectors)
+	}
+	if h.cfg.quota != "" {
+		if err := h.acquireQuota(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := h.reserveBudget(ctx); err != nil {
+		return nil, err
+	}
+	if h.cfg.asUser != "" {
+		if err := h.applyUser(); err != nil {
+			return nil, err
+		}
+	}
+	if h.cfg.isolatedHome {
+		if err := h.isolateHome(); err != nil {
+			return nil, err
+		}
+	}
+	if h.cfg.askpass != nil {
+		if err := h.openAskpass(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if len(h.cfg.env) > 0 || len(h.cfg.profiles) > 0 || h.cfg.hermetic != nil {
+		if err := h.applyEnv(); err != nil {
+			return nil, err
+		}
+	}
+	if len(h.cfg.injections) > 0 {
+		h.applyInjections()
+	}
+	if len(h.cfg.ports) > 0 {
+		if err := h.allocatePorts(); err != nil {
+			return nil, err
+		}
+	}
+	if h.cfg.resolver != nil {
+		if err := h.resolve(); err != nil {
+			return nil, err
+		}
+	}
+	if h.cfg.shebangFallback {
+		h.applyShebangFallback()
+	}
+	if h.cfg.argv0 != "" {
+		h.applyArgv0()
+	}
+	// The resolver and the shebang fallback may have replaced the program.
+	h.programs = append(h.programs, cmd.Path)
+	if len(h.cfg.activation) > 0 {
+		if err := h.applyActivation(); err != nil {
+			return nil, err
+		}
+	}
+	if len(h.cfg.extraFiles) > 0 {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, h.cfg.extraFiles...)
+	}
+	if len(h.cfg.namedFiles) > 0 {
+		if err := h.applyNamedFiles(); err != nil {
+			return nil, err
+		}
+	}
+	if len(h.cfg.wrappers) > 0 {
+		if err := h.applyWrappers(); err != nil {
+			return nil, err
+		}
+	}
+	if h.cfg.umaskSet {
+		if err := h.applyUmask(); err != nil {
+			return nil, err
+		}
+	}
+	if err := h.applyCmdLine(); err != nil {
+		return nil, err
+	}
+	if err := applySpawnFlags(cmd, h.cfg.spawn); err != nil {
+		return nil, wrapStart(err, cmd, h.cfg.collectors)
+	}
+	if h.cfg.noNetwork {
+		mode, err := isolateNetwork(cmd)
+		if err != nil {
+			se := wrapStart(err, cmd, h.cfg.collectors)
+			se.Details = append(se.Details, Detail{Key: "network", Value: "unsupported"})
+			return nil, se
+		}
+		h.netns = mode
+	}
+	if err := h.checkWorkDir(); err != nil {
+		return nil, wrapStart(err, cmd, h.cfg.collectors)
+	}
+	if err := h.checkPrograms(); err != nil {
+		return nil, err
+	}
+	if h.cfg.fdAudit != 0 {
+		if err := h.auditFDs(); err != nil {
+			return nil, err
+		}
+	}
+	if len(h.cfg.fsChanges) > 0 {
+		h.snapshotFS()
+	}
+	if err := h.openFS(); err != nil {
+		return nil, err
+	}
+	if err := h.openEndpoints(); err != nil {
+		h.closeFS()
+		return nil, err
+	}
+	if err := h.openLogs(); err != nil {
+		h.closeFS()
+		return nil, err
+	}
+	h.trackProgress()
+	if err := h.plumb(); err != nil {
+		h.closeFS()
+		h.closeLogs()
+		return nil, err
+	}
+	h.mark(&h.timeline.Start)
+	if err := h.startProcess(ctx); err != nil {
+		h.closePipes()
+		h.closeFS()
+		h.closeLogs()
+		return nil, err
+	}
+	h.mark(&h.timeline.Running)
+	started = true
+	track(h)
+	if sc := ScopeFrom(ctx); sc != nil {
+		sc.add(h)
+	}
+	stats.started.Add(1)
+	h.logStart(ctx)
+	h.publishStart(ctx)
+	h.sched = h.applyScheduling()
+	h.oom = watchOOM(cmd.Process.Pid)
+	if h.cfg.procStatus {
+		h.proc = sampleProc(cmd.Process.Pid, h.exited, h.internal)
+	}
+	if h.cfg.resourceInterval > 0 {
+		h.rsrc = sampleResources(cmd.Process.Pid, h.cfg.resourceInterval, h.exited, h.internal)
+	}
+	if h.cfg.execChain {
+		h.execs = trackExecs(cmd, h.timeline.Running, h.exited, h.internal)
+	}
+	if h.cfg.finalState {
+		h.final = sampleFinalState(cmd, h.cfg.finalStateKeys, h.exited, h.internal)
+	}
+	if h.cfg.treeUsage {
+		h.treeUse = sampleTree(cmd.Process.Pid, h.exited, h.internal)
+	}
+	h.closeChildEnds()
+	h.connectEndpoints(ctx)
+	h.startCopying()
+	cancel := func() {}
+	if h.cfg.timeout > 0 {
+		ctx, cancel = withClockTimeout(ctx, h.clock, h.cfg.timeout)
+	}
+	go h.watch(ctx, cancel)
+	h.startWaiting()
+	return h, nil
+}
+
+// startProcess starts the process, and wraps errors as per Wrap.
+func (h *Handle) startProcess(ctx context.Context) error {
+	var err error
+	if h.cfg.sandbox == nil && h.cfg.root == nil {
+		err = WrapWith(h.startRetrying(ctx), h.cmd, h.cfg.collectors...)
+	} else if err = h.startConfined(); err != nil {
+		if isStartError(err) {
+			err = WrapWith(err, h.cmd, h.cfg.collectors...)
+		} else {
+			err = wrapStart(err, h.cmd, h.cfg.collectors)
+		}
+	}
+	if se, ok := err.(*StartError); ok && errors.Is(se.Err, os.ErrPermission) {
+		if nee := notExecutable(h.cmd.Path, se.Err); nee != nil {
+			se.Err = nee
+		}
+	}
+	if se, ok := err.(*StartError); ok && h.netns != "" {
+		se.Details = append(se.Details, Detail{Key: "network", Value: h.netns})
+	}
+	if se, ok := err.(*StartError); ok && h.cfg.root != nil {
+		se.Details = append(se.Details, Detail{Key: "root", Value: h.cfg.root.String()})
+	}
+	if se, ok := err.(*StartError); ok && len(h.spawnRetries) > 0 {
+		se.Details = append(se.Details, Detail{Key: "spawn_retries", Value: h.spawnRetries})
+	}
+	return err
+}
+
+// startConfined starts the process under an alternate root, or under a
+// sandbox, on a thread set aside for it.
+func (h *Handle) startConfined() error {
+	if h.cfg.root != nil {
+		return startInRoot(h.cmd, h.cfg.root, h.cfg.sandbox)
+	}
+	return startSandboxed(h.cmd, h.cfg.sandbox)
+}
+
+// Wait waits for the command to complete, and returns a description of
+// the run. If the command fails, Wait returns a non-nil *Result as well as
+// a non-nil error. If the error is an *ExitError, its Result field refers
+// to the returned Result.
+//
+// Wait may be called multiple times, and from multiple goroutines.
+func (h *Handle) Wait() (*Result, error) {
+	<-h.done
+	return h.result, h.err
+}
+
+// Done returns a channel which is closed when the command has completed.
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// watch stops the process if ctx is done before the process exits.
+func (h *Handle) watch(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+	defer h.internal.catch("watch context")
+	select {
+	case <-ctx.Done():
+		h.mu.Lock()
+		h.stopped = ctx.Err()
+		h.mu.Unlock()
+		// Stop the process even if diagnosing it panics.
+		defer h.cancel()
+		if ctx.Err() == context.DeadlineExceeded {
+			h.diagnose()
+			h.snapshotTree()
+			if h.cfg.dumpSignal != nil {
+				h.requestStackDump()
+			}
+		}
+	case <-h.exited:
+	}
+}
+
+func (h *Handle) wait() {
+	var stats *ProcStats
+	if h.cfg.procStats || h.execs != nil || h.treeUse != nil {
+		// Read what is left of the process in /proc before it is
+		// reaped.
+		zombie := awaitZombie(h.cmd.Process.Pid)
+		if zombie && h.cfg.procStats {
+			stats = readProcStats(h.cmd.Process.Pid)
+		}
+		h.execs.stop(zombie)
+		h.treeUse.stop(zombie)
+	}
+	err := h.cmd.Wait()
+	untrack(h)
+	h.releaseQuota()
+	h.mark(&h.timeline.Exited)
+	close(h.exited)
+	abandoned := h.awaitOutputs()
+	h.closeEndpoints()
+	prompts := h.closeAskpass()
+	h.attach.close()
+	for _, s := range h.outputs {
+		if sm, ok := s.dst.(*summarizer); ok {
+			sm.flush()
+		}
+		if ls, ok := s.sampler(); ok {
+			ls.flush()
+		}
+		if sv, ok := s.limiter().(*stderrSaver); ok {
+			sv.flush()
+		}
+		s.zip.close()
+		if err == nil && s.err != nil && abandoned == nil {
+			err = s.err
+		}
+	}
+	if err == nil && abandoned != nil {
+		err = ErrWaitDelay
+	}
+	internal := h.internal.list()
+	if err == nil && len(internal) > 0 {
+		err = internal[0]
+	}
+	if errs := h.endpointErrors(); err == nil && len(errs) > 0 {
+		err = errs[0]
+	}
+	h.collectFS()
+	h.closeLogs()
+	h.progress.flush()
+	h.mark(&h.timeline.WaitReturned)
+
+	res := &Result{
+		Path:           h.cmd.Path,
+		Args:           h.cmd.Args,
+		ProcessState:   h.cmd.ProcessState,
+		ExitCode:       h.cmd.ProcessState.ExitCode(),
+		Timeline:       h.snapshot(),
+		Scheduling:     h.sched,
+		Ports:          h.ports,
+		Journal:        h.logs.journal,
+		Resources:      h.rsrc.result(),
+		Abandoned:      abandoned,
+		QuotaWait:      h.quotaWait,
+		SpawnRetries:   h.spawnRetries,
+		ProcStats:      stats,
+		ExecChain:      h.execs.result(),
+		InternalErrors: internal,
+		FSChanges:      h.fsChanges(),
+		FinalState:     h.final.result(),
+		TreeUsage:      h.treeUse.result(h.cmd.ProcessState),
+		AskpassPrompts: prompts,
+		decoder:        h.cfg.decoder,
+	}
+	res.Dir, _, _ = describe(h.cmd)
+	h.debitBudget(res)
+	for _, s := range h.outputs {
+		if s.fanout != nil {
+			res.WriterErrors = append(res.WriterErrors, s.fanout.errors()...)
+		}
+		if tail := s.tail.bytes(); len(tail) > 0 {
+			switch s.name {
+			case "stdout":
+				res.StdoutTail = decode(h.cfg.decoder, tail)
+			case "stderr":
+				res.StderrTail = decode(h.cfg.decoder, tail)
+			}
+		}
+		if s.capture == nil {
+			continue
+		}
+		switch s.name {
+		case "stdout":
+			res.StdoutLinesDropped = s.linesDropped()
+		case "stderr":
+			res.StderrLinesDropped = s.linesDropped()
+		}
+		res.buffers = append(res.buffers, s.capture)
+		switch {
+		case s.zip != nil && s.name == "stdout":
+			res.CompressedStdout = s.capture.Bytes()
+		case s.zip != nil && s.name == "stderr":
+			res.CompressedStderr = s.capture.Bytes()
+		case s.name == "stdout":
+			res.Stdout = decode(h.cfg.decoder, s.capture.Bytes())
+		case s.name == "stderr":
+			res.Stderr = decode(h.cfg.decoder, s.capture.Bytes())
+		}
+	}
+	if isReaped(err) {
+		pid := h.cmd.Process.Pid
+		err = &ReapedError{Path: h.cmd.Path, Args: h.cmd.Args, PID: pid, Orphan: reapedOrphan(pid), Err: err}
+	}
+	if _, ok := err.(*exec.ExitError); ok && h.cfg.allows(res.ExitCode) {
+		err = nil
+	}
+	if h.cfg.compress && (err != nil || h.inspectsOutput()) {
+		res.inflate()
+	}
+	matched, fail := "", false
+	if err == nil {
+		matched, fail = h.cfg.matchFailure(res.Stdout, res.Stderr)
+		if fail {
+			err = &exec.ExitError{ProcessState: h.cmd.ProcessState}
+		}
+	}
+	if err == nil && len(h.cfg.contracts) > 0 {
+		err = h.checkContracts(res)
+	}
+	res.Home = h.collectHome(err != nil)
+	if ee, ok := err.(*exec.ExitError); ok {
+		ee.Stderr = res.Stderr
+		if ee.Stderr == nil {
+			ee.Stderr = res.StderrTail
+		}
+		err = h.wrap(ee, res)
+	}
+	if newee, ok := err.(*ExitError); ok && fail {
+		newee.Reason = ReasonOutputMatched
+		newee.Details = append(newee.Details, Detail{Key: "failure_match", Value: matched})
+	}
+	aborts, abortReqs := h.abortRequests(res)
+	if newee, ok := err.(*ExitError); ok && len(abortReqs) > 0 {
+		newee.Details = append(newee.Details, Detail{Key: "abort_requested", Value: abortReqs[0]})
+	}
+	if oerr := h.overflowError(res, err); oerr != nil {
+		err = oerr
+	}
+	if h.cfg.compress && err == nil {
+		// The output was decompressed only to be inspected.
+		res.Stdout, res.Stderr = nil, nil
+	}
+	h.cfg.annotations.annotate(err)
+	h.logExit(res, err)
+	h.publishExit(res, err)
+	countExit(h.cmd.ProcessState, err)
+	recordLatency(h.fprint, h.cmdline, res.Duration(), err)
+	for i, t := range aborts {
+		t.cancel(abortReqs[i])
+	}
+	h.result, h.err = res, err
+	close(h.done)
+}
+
+// stopReason returns the reason the process was stopped for, if it was
+// stopped because its context was done.
+func (h *Handle) stopReason() Reason {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch h.stopped {
+	case context.DeadlineExceeded:
+		return ReasonTimedOut
+	case context.Canceled:
+		return ReasonCanceledByCaller
+	default:
+		return ReasonNone
+	}
+}
+
+// wrap wraps ee in an *ExitError carrying res.
+func (h *Handle) wrap(ee *exec.ExitError, res *Result) error {
+	err := WrapWith(ee, h.cmd, h.cfg.collectors...)
+	if newee, ok := err.(*ExitError); ok {
+		newee.Result = res
+		newee.callers = h.callers
+		newee.EnvSources = h.envSources
+		newee.Profiles = profileNames(h.cfg.profiles)
+		if h.cfg.envBaseline != "" {
+			newee.Details = append(newee.Details, Detail{Key: "env_baseline", Value: diffBaseline(h.cfg.envBaseline, newee.ChildEnv)})
+		}
+		if h.cfg.redactEnv {
+			newee.ParentEnv, newee.ChildEnv = RedactEnv(newee.ParentEnv), RedactEnv(newee.ChildEnv)
+		}
+		newee.StderrDropped = h.stderrDropped()
+		if h.oom.oomKilled(ee.ProcessState) {
+			newee.Reason = ReasonOOMKilled
+		} else {
+			newee.Reason = h.stopReason()
+		}
+		if h.cfg.sandbox != nil {
+			newee.Details = append(newee.Details, sandboxDetails(h.cfg.sandbox, res.Stderr, sandboxLogDenials(newee.PID, res.Timeline.Start))...)
+		}
+		if dump := h.stackDump(res); dump != "" {
+			newee.Details = append(newee.Details, Detail{Key: "stack_dump", Value: dump})
+		}
+		if h.identity != nil {
+			newee.Details = append(newee.Details, Detail{Key: "identity", Value: h.identity})
+		}
+		if h.netns != "" {
+			newee.Details = append(newee.Details, Detail{Key: "network", Value: h.netns})
+		}
+		if h.cfg.root != nil {
+			newee.Details = append(newee.Details, Detail{Key: "root", Value: h.cfg.root.String()})
+		}
+		if h.cfg.hermetic != nil {
+			newee.Details = append(newee.Details, Detail{Key: "hermetic", Value: h.cfg.hermetic})
+		}
+		if len(h.ports) > 0 {
+			newee.Details = append(newee.Details, Detail{Key: "ports", Value: portList(h.ports)})
+		}
+		if st := h.proc.status(); st != nil {
+			newee.Details = append(newee.Details, Detail{Key: "proc_status", Value: st})
+		}
+		if len(res.WriterErrors) > 0 {
+			newee.Details = append(newee.Details, Detail{Key: "writer_errors", Value: res.WriterErrors})
+		}
+		if len(res.InternalErrors) > 0 {
+			newee.Details = append(newee.Details, Detail{Key: "internal_errors", Value: res.InternalErrors})
+		}
+		if errs := h.endpointErrors(); len(errs) > 0 {
+			newee.Details = append(newee.Details, Detail{Key: "endpoint_errors", Value: errs})
+		}
+		if res.Home != nil {
+			newee.Details = append(newee.Details, Detail{Key: "isolated_home", Value: res.Home})
+		}
+		if res.FSChanges != nil {
+			newee.Details = append(newee.Details, Detail{Key: "fs_changes", Value: res.FSChanges})
+		}
+		if res.FinalState != nil && res.FinalState.Changed() {
+			newee.Details = append(newee.Details, Detail{Key: "final_state", Value: res.FinalState})
+		}
+		if res.Resources != nil {
+			newee.Details = append(newee.Details, Detail{Key: "resources", Value: res.Resources})
+		}
+		if res.ProcStats != nil {
+			newee.Details = append(newee.Details, Detail{Key: "proc_stats", Value: res.ProcStats})
+		}
+		if len(res.AskpassPrompts) > 0 {
+			newee.Details = append(newee.Details, Detail{Key: "askpass_prompts", Value: res.AskpassPrompts})
+		}
+		if res.TreeUsage != nil {
+			newee.Details = append(newee.Details, Detail{Key: "tree_usage", Value: res.TreeUsage})
+		}
+		if res.StdoutLinesDropped > 0 {
+			newee.Details = append(newee.Details, Detail{Key: "stdout_lines_dropped", Value: res.StdoutLinesDropped})
+		}
+		if res.StderrLinesDropped > 0 {
+			newee.Details = append(newee.Details, Detail{Key: "stderr_lines_dropped", Value: res.StderrLinesDropped})
+		}
+		if len(res.SpawnRetries) > 0 {
+			newee.Details = append(newee.Details, Detail{Key: "spawn_retries", Value: res.SpawnRetries})
+		}
+		if len(res.ExecChain) > 1 {
+			newee.Details = append(newee.Details, Detail{Key: "exec_chain", Value: res.ExecChain})
+		}
+		if len(res.StdoutTail) > 0 {
+			newee.Details = append(newee.Details, Detail{Key: "stdout_tail", Value: string(res.StdoutTail)})
+		}
+		if len(res.Abandoned) > 0 {
+			newee.Details = append(newee.Details, Detail{Key: "wait_delay_expired", Value: res.Abandoned})
+		}
+		if p := h.progress.latest(); p != nil {
+			newee.Details = append(newee.Details, Detail{Key: "progress", Value: *p})
+		}
+		h.mu.Lock()
+		newee.Hints = h.hints
+		newee.hintMsgs = h.hintMsgs
+		if h.tree != nil {
+			newee.Details = append(newee.Details, Detail{Key: "process_tree", Value: h.tree})
+		}
+		h.mu.Unlock()
+	}
+	return err
+}
+
+// snapshot returns a copy of h.timeline.
+func (h *Handle) snapshot() Timeline {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t := h.timeline
+	t.Endpoints = append([]EndpointEvent(nil), t.Endpoints...)
+	return t
+}
+
+// mark records the current time in *t.
+func (h *Handle) mark(t *time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*t = h.clock.Now()
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("Capture", testRunCapture)
+	t.Run("Writers", testRunWriters)
+	t.Run("Failure", testRunFailure)
+	t.Run("Context", testRunContext)
+	t.Run("StartError", testRunStartError)
+	t.Run("AllowedExitCodes", testRunAllowedExitCodes)
+}
+
+func testRunCapture(t *testing.T) {
+	self := selfCmd("echo")
+	self.Stdin = strings.NewReader("hello")
+	res, err := execx.Run(context.Background(), self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "hello" {
+		t.Errorf("got stdout %q, want %q", res.Stdout, "hello")
+	}
+	if string(res.Stderr) != "echoed" {
+		t.Errorf("got stderr %q, want %q", res.Stderr, "echoed")
+	}
+	if res.ExitCode != 0 {
+		t.Errorf("got exit code %d, want 0", res.ExitCode)
+	}
+
+	tl := res.Timeline
+	events := []time.Time{tl.Created, tl.Start, tl.Running, tl.Exited, tl.WaitReturned}
+	for i := 1; i < len(events); i++ {
+		if events[i].Before(events[i-1]) {
+			t.Errorf("timeline out of order: %+v", tl)
+		}
+	}
+	// Output is observed by the parent asynchronously, possibly
+	// after the process exited, but always before Wait returns.
+	if tl.FirstStdout.Before(tl.Running) || tl.FirstStdout.After(tl.WaitReturned) {
+		t.Errorf("first stdout out of order: %+v", tl)
+	}
+	if tl.StdinEOF.IsZero() || tl.FirstStderr.IsZero() {
+		t.Errorf("timeline missing events: %+v", tl)
+	}
+	if d := tl.SpawnLatency(); d <= 0 || d != tl.Running.Sub(tl.Start) {
+		t.Errorf("got spawn latency %v, want %v", d, tl.Running.Sub(tl.Start))
+	}
+}
+
+func testRunWriters(t *testing.T) {
+	self := selfCmd("echo")
+	self.Stdin = strings.NewReader("hello")
+	combined := new(bytes.Buffer)
+	self.Stdout = combined
+	self.Stderr = combined
+	res, err := execx.Run(context.Background(), self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stdout != nil || res.Stderr != nil {
+		t.Errorf("captured output despite writers being set")
+	}
+	if got := combined.String(); !strings.Contains(got, "hello") || !strings.Contains(got, "echoed") {
+		t.Errorf("got combined output %q", got)
+	}
+}
+
+func testRunFailure(t *testing.T) {
+	res, err := execx.Run(context.Background(), selfCmd("on"))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	if ee.Result != res {
+		t.Fatalf("ExitError does not refer to Result")
+	}
+	if string(ee.Stderr) != "whoops" {
+		t.Errorf("got stderr %q, want %q", ee.Stderr, "whoops")
+	}
+	if got := fmt.Sprintf("%+v", ee); !strings.Contains(got, "timeline:") {
+		t.Errorf("detailed output doesn't contain timeline")
+	}
+}
+
+func testRunContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	self := selfCmd("echo")
+	self.Stdin = blockingReader{ctx}
+	h, err := execx.Start(ctx, self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := h.Wait(); err == nil {
+		t.Fatal("process wasn't killed")
+	}
+}
+
+func testRunStartError(t *testing.T) {
+	cmd := selfCmd("on")
+	cmd.Path = "/execx-no-such-file"
+	_, err := execx.Run(context.Background(), cmd)
+	if _, ok := err.(*execx.StartError); !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.StartError)(nil))
+	}
+}
+
+// blockingReader blocks until its context is done.
+type blockingReader struct {
+	ctx context.Context
+}
+
+func (br blockingReader) Read(p []byte) (int, error) {
+	<-br.ctx.Done()
+	return 0, br.ctx.Err()
+}
+
+func testRunAllowedExitCodes(t *testing.T) {
+	res, err := execx.Run(context.Background(), selfCmd("on"), execx.WithAllowedExitCodes(0, 1))
+	if err != nil {
+		t.Fatalf("got %v, want nil error for allowed exit code", err)
+	}
+	if res.ExitCode != 1 {
+		t.Errorf("got exit code %d, want 1", res.ExitCode)
+	}
+
+	_, err = execx.Run(context.Background(), selfCmd("on"), execx.WithAllowedExitCodes(2))
+	if _, ok := err.(*execx.ExitError); !ok {
+		t.Fatalf("got %v, want *ExitError for disallowed exit code", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"os/exec"
+	"sync/atomic"
+)
+
+// A Runner runs commands. Implementations may run commands as local
+// processes, or do something else entirely, such as auditing, rate
+// limiting, or mocking them.
+//
+// Implementations must be safe for concurrent use by multiple goroutines.
+type Runner interface {
+	Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error)
+}
+
+// RunnerFunc is an adapter to allow the use of ordinary functions as
+// runners.
+type RunnerFunc func(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error)
+
+// Run returns f(ctx, cmd, opts...).
+func (f RunnerFunc) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	return f(ctx, cmd, opts...)
+}
+
+// Local is a Runner which runs commands as local processes, using Start
+// and Wait. Local is the default runner.
+var Local Runner = localRunner{}
+
+type localRunner struct{}
+
+func (localRunner) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	h, err := Start(ctx, cmd, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return h.Wait()
+}
+
+// runnerBox allows storing runners of different dynamic types in an
+// atomic.Value.
+type runnerBox struct {
+	r Runner
+}
+
+var defaultRunner atomic.Value
+
+func init() {
+	defaultRunner.Store(runnerBox{Local})
+}
+
+// SetDefault sets the default runner used by Run to r. If r is nil, the
+// default runner is reset to Local. SetDefault is safe to call from
+// multiple goroutines concurrently.
+func SetDefault(r Runner) {
+	if r == nil {
+		r = Local
+	}
+	defaultRunner.Store(runnerBox{r})
+}
+
+// Default returns the default runner.
+func Default() Runner {
+	return defaultRunner.Load().(runnerBox).r
+}
+
+type runnerKey struct{}
+
+// WithRunner returns a copy of ctx carrying r. Run uses r for commands run
+// using the returned context, or contexts derived from it, overriding the
+// default runner.
+func WithRunner(ctx context.Context, r Runner) context.Context {
+	return context.WithValue(ctx, runnerKey{}, r)
+}
+
+// RunnerFrom returns the runner carried by ctx, or the default runner if
+// ctx carries none.
+func RunnerFrom(ctx context.Context) Runner {
+	if r, ok := ctx.Value(runnerKey{}).(Runner); ok && r != nil {
+		return r
+	}
+	return Default()
+}
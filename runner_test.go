@@ -0,0 +1,70 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"os/exec"
+	"sync/atomic"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestRunner(t *testing.T) {
+	t.Run("SetDefault", testRunnerSetDefault)
+	t.Run("WithRunner", testRunnerWithRunner)
+}
+
+func testRunnerSetDefault(t *testing.T) {
+	fake := new(countingRunner)
+	execx.SetDefault(fake)
+	defer execx.SetDefault(nil)
+
+	if _, err := execx.Run(context.Background(), selfCmd("on")); err != nil {
+		t.Fatal(err)
+	}
+	if fake.n != 1 {
+		t.Fatalf("default runner called %d times, want 1", fake.n)
+	}
+	execx.SetDefault(nil)
+	if execx.Default() != execx.Local {
+		t.Fatalf("SetDefault(nil) did not reset default runner")
+	}
+}
+
+func testRunnerWithRunner(t *testing.T) {
+	fake := new(countingRunner)
+	ctx := execx.WithRunner(context.Background(), fake)
+	if _, err := execx.RunScript(ctx, "exit 1"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.n != 1 {
+		t.Fatalf("context runner called %d times, want 1", fake.n)
+	}
+	if execx.RunnerFrom(context.Background()) != execx.Default() {
+		t.Fatalf("RunnerFrom didn't fall back to the default runner")
+	}
+}
+
+// countingRunner counts commands, and pretends they succeed.
+type countingRunner struct {
+	n int32
+}
+
+func (cr *countingRunner) Run(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+	atomic.AddInt32(&cr.n, 1)
+	return &execx.Result{Path: cmd.Path, Args: cmd.Args}, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import "time"
+
+// Defaults used by Safe.
+const (
+	safeGracePeriod = 5 * time.Second
+	safeOutputTail  = 32 << 10
+)
+
+// Safe returns an Option which bundles defaults suitable for most
+// commands, such that good behavior takes one option:
+//
+//	res, err := execx.Run(ctx, cmd, execx.Safe())
+//
+// Safe is equivalent to the following options:
+//
+//	WithGroupKill()
+//	WithGracePeriod(5 * time.Second)
+//	WithOutputTail(32 << 10)
+//	WithRedactedEnv()
+//
+// Thus, when ctx is done, or its deadline expires, the process group of
+// the command is asked to exit using Terminate, and is killed if it does
+// not exit within 5 seconds. The last 32KB of the output of the command
+// are kept to explain failures, and sensitive variables are redacted from
+// errors. As always, failures to start the command are reported as
+// *StartError, and failures of the command as *ExitError.
+//
+// The grace period and the size of the tails can be overridden by options
+// which follow Safe:
+//
+//	execx.Run(ctx, cmd, execx.Safe(), execx.WithGracePeriod(time.Minute))
+//
+// To do without WithGroupKill or WithRedactedEnv, list the other options
+// instead of using Safe.
+func Safe() Option {
+	return func(cfg *config) {
+		for _, opt := range []Option{
+			WithGroupKill(),
+			WithGracePeriod(safeGracePeriod),
+			WithOutputTail(safeOutputTail),
+			WithRedactedEnv(),
+		} {
+			opt(cfg)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestSafe(t *testing.T) {
+	// The background sleep holds stdout open. Unless it is killed
+	// along with the shell, Wait blocks until it exits.
+	cmd := exec.Command("sh", "-c", "sleep 30 & echo $!; wait")
+	cmd.Env = append(os.Environ(), "EXECX_API_TOKEN=hunter2")
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	res, err := execx.Run(ctx, cmd, execx.Safe())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run returned after %v, want the process group stopped", elapsed)
+	}
+	if err == nil {
+		t.Fatal("command did not fail")
+	}
+	out := fmt.Sprintf("%+v", err)
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("sensitive variable revealed by %%+v:\n%s", out)
+	}
+	if !strings.Contains(out, "EXECX_API_TOKEN") {
+		t.Errorf("environment missing from %%+v:\n%s", out)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(res.Stdout)))
+	if err != nil {
+		t.Fatalf("bad output %q", res.Stdout)
+	}
+	for deadline := time.Now().Add(2 * time.Second); alive(pid); {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("child %d outlived the command", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// alive reports whether the process with the specified pid is alive, and
+// not a zombie waiting to be reaped by init, if that can be determined.
+func alive(pid int) bool {
+	if b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		return !strings.Contains(string(b), ") Z ")
+	}
+	return syscall.Kill(pid, 0) == nil
+}
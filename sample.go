@@ -0,0 +1,189 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+// DefaultKeepPatterns match lines which report errors, and which are
+// kept by WithLineSampling unless LineSampling.Keep says otherwise.
+var DefaultKeepPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(error|fatal|panic|exception|fail(ed|ure)?)\b`),
+}
+
+// LineSampling configures WithLineSampling.
+type LineSampling struct {
+	// After is the number of lines of each stream which are kept in
+	// full, before sampling starts.
+	After int
+
+	// Every keeps one in every Every lines past the first After lines.
+	// If Every is zero, such lines are dropped, unless they match Keep.
+	Every int
+
+	// PerSecond, if positive, limits the number of lines past the first
+	// After lines which are kept in each second, in addition to Every.
+	PerSecond int
+
+	// Keep lists patterns matching lines which are always kept. If Keep
+	// is nil, DefaultKeepPatterns are used.
+	Keep []*regexp.Regexp
+}
+
+// WithLineSampling bounds the captured standard output and standard error
+// of commands which emit large numbers of lines, such as verbose logs, by
+// sampling the lines stored once a stream reaches a number of lines, as
+// described by s. Lines which report errors are kept regardless, such that
+// the captured output remains representative of the failure. Each gap
+// left by dropped lines is marked by a note such as
+//
+//	[1,024 lines dropped]
+//
+// The number of lines dropped from each stream is recorded in
+// Result.StdoutLinesDropped and Result.StderrLinesDropped, and as details
+// named "stdout_lines_dropped" and "stderr_lines_dropped" in errors
+// produced by the command. Sampling applies after WithSummarizedOutput,
+// and before limits set by WithOutputLimit and WithStderrLimit. Output
+// written to non-nil cmd.Stdout or cmd.Stderr is not sampled.
+func WithLineSampling(s LineSampling) Option {
+	return func(cfg *config) {
+		if s.Keep == nil {
+			s.Keep = DefaultKeepPatterns
+		}
+		cfg.sampling = &s
+	}
+}
+
+// lineSampler samples the lines written to it, and writes the lines it
+// keeps to w.
+type lineSampler struct {
+	w       io.Writer
+	cfg     *LineSampling
+	clock   Clock
+	partial []byte // incomplete line
+	lines   int64  // complete lines seen
+	dropped int64  // lines dropped in total
+	gap     int64  // lines dropped since the last line kept
+	window  time.Time
+	inWin   int // lines kept by the rate limit in the current window
+}
+
+func (ls *lineSampler) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			ls.partial = append(ls.partial, p...)
+			break
+		}
+		line := p[:i+1]
+		if len(ls.partial) > 0 {
+			line = append(ls.partial, line...)
+			ls.partial = ls.partial[:0]
+		}
+		ls.line(line)
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// line processes a complete line.
+func (ls *lineSampler) line(line []byte) {
+	ls.lines++
+	if !ls.keep(line) {
+		ls.dropped++
+		ls.gap++
+		return
+	}
+	ls.endGap()
+	ls.w.Write(line)
+}
+
+// keep reports whether line, the ls.lines-th line, is kept.
+func (ls *lineSampler) keep(line []byte) bool {
+	if ls.lines <= int64(ls.cfg.After) {
+		return true
+	}
+	for _, re := range ls.cfg.Keep {
+		if re.Match(line) {
+			return true
+		}
+	}
+	if ls.cfg.Every <= 0 || (ls.lines-int64(ls.cfg.After))%int64(ls.cfg.Every) != 0 {
+		return false
+	}
+	if ls.cfg.PerSecond <= 0 {
+		return true
+	}
+	now := ls.clock.Now()
+	if now.Sub(ls.window) >= time.Second {
+		ls.window, ls.inWin = now, 0
+	}
+	if ls.inWin >= ls.cfg.PerSecond {
+		return false
+	}
+	ls.inWin++
+	return true
+}
+
+// endGap writes a note for the lines dropped since the last line kept.
+func (ls *lineSampler) endGap() {
+	switch {
+	case ls.gap == 1:
+		io.WriteString(ls.w, "[1 line dropped]\n")
+	case ls.gap > 1:
+		fmt.Fprintf(ls.w, "[%s lines dropped]\n", groupThousands(int(ls.gap)))
+	}
+	ls.gap = 0
+}
+
+// flush writes the incomplete line, and the note for the trailing gap,
+// once the stream is done.
+func (ls *lineSampler) flush() {
+	if len(ls.partial) > 0 {
+		ls.lines++
+		if !ls.keep(ls.partial) {
+			ls.dropped++
+			ls.gap++
+			ls.partial = ls.partial[:0]
+		}
+	}
+	ls.endGap()
+	ls.w.Write(ls.partial)
+	ls.partial = nil
+}
+
+// linesDropped returns the number of lines dropped from the output of s.
+func (s *outputStream) linesDropped() int64 {
+	if ls, ok := s.sampler(); ok {
+		return ls.dropped
+	}
+	return 0
+}
+
+// sampler returns the line sampler of s, if any.
+func (s *outputStream) sampler() (*lineSampler, bool) {
+	w := s.dst
+	if sm, ok := w.(*summarizer); ok {
+		w = sm.w
+	}
+	ls, ok := w.(*lineSampler)
+	return ls, ok
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+// numbered returns n lines, numbered from 1, with the lines at the
+// specified numbers replaced by error reports.
+func numbered(n int, errs ...int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		for _, e := range errs {
+			if i == e {
+				line = fmt.Sprintf("error: at %d\n", i)
+			}
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+func TestWithLineSampling(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		s       execx.LineSampling
+		want    string
+		dropped int64
+	}{
+		{
+			name: "BelowThreshold",
+			in:   numbered(3),
+			s:    execx.LineSampling{After: 3},
+			want: numbered(3),
+		},
+		{
+			name:    "DropAll",
+			in:      numbered(6),
+			s:       execx.LineSampling{After: 2},
+			want:    "line 1\nline 2\n[4 lines dropped]\n",
+			dropped: 4,
+		},
+		{
+			name:    "Every",
+			in:      numbered(8),
+			s:       execx.LineSampling{After: 2, Every: 3},
+			want:    "line 1\nline 2\n[2 lines dropped]\nline 5\n[2 lines dropped]\nline 8\n",
+			dropped: 4,
+		},
+		{
+			name:    "KeepErrors",
+			in:      numbered(6, 4),
+			s:       execx.LineSampling{After: 1},
+			want:    "line 1\n[2 lines dropped]\nerror: at 4\n[2 lines dropped]\n",
+			dropped: 4,
+		},
+		{
+			name:    "CustomKeep",
+			in:      numbered(4, 3),
+			s:       execx.LineSampling{After: 1, Keep: []*regexp.Regexp{regexp.MustCompile(`line 4`)}},
+			want:    "line 1\n[2 lines dropped]\nline 4\n",
+			dropped: 2,
+		},
+		{
+			name:    "PerSecond",
+			in:      numbered(6),
+			s:       execx.LineSampling{After: 1, Every: 1, PerSecond: 2},
+			want:    "line 1\nline 2\nline 3\n[3 lines dropped]\n",
+			dropped: 3,
+		},
+		{
+			name:    "PartialLine",
+			in:      "line 1\nline 2\nerror: partial",
+			s:       execx.LineSampling{After: 1},
+			want:    "line 1\n[1 line dropped]\nerror: partial",
+			dropped: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := selfCmd("echo")
+			cmd.Stdin = strings.NewReader(tt.in)
+			res, err := execx.Run(context.Background(), cmd, execx.WithLineSampling(tt.s))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(res.Stdout); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if res.StdoutLinesDropped != tt.dropped {
+				t.Errorf("dropped %d lines, want %d", res.StdoutLinesDropped, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestWithLineSamplingDetail(t *testing.T) {
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader(numbered(100))
+	_, err := execx.Run(context.Background(), cmd,
+		execx.WithLineSampling(execx.LineSampling{After: 10}),
+		execx.FailIf(regexp.MustCompile(`line 1\n`)))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if got := ee.Fields()["stdout_lines_dropped"]; got != int64(90) {
+		t.Errorf("stdout_lines_dropped = %v, want 90", got)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// A Sandbox is a set of restrictions enforced on a child process, and on
+// its descendants, by the kernel. Sandboxes are supported on Linux, using
+// Landlock (Linux 5.13 and later) for file system restrictions, and
+// seccomp for network restrictions, and on macOS, using sandbox-exec.
+//
+// If the restrictions cannot be enforced, the command fails to start.
+//
+// Note that the dynamic loader, shared libraries, and other files the
+// program needs in order to run must be accessible under the sandbox.
+type Sandbox struct {
+	// ReadOnly denies all writes to the file system, except under
+	// WritablePaths.
+	ReadOnly bool
+
+	// AllowedPaths, if not nil, restricts access to the file system to
+	// the specified paths, and the files beneath them. If AllowedPaths
+	// is nil, the entire file system is accessible.
+	AllowedPaths []string
+
+	// WritablePaths lists paths which are writable even if ReadOnly
+	// is set.
+	WritablePaths []string
+
+	// NoNetwork denies the creation of IPv4 and IPv6 sockets.
+	NoNetwork bool
+
+	// Profile, if not empty, is a sandbox-exec profile, written in the
+	// Sandbox Profile Language, which is used on macOS instead of the
+	// profile generated from the other fields. See SandboxExecProfile.
+	// Profiles are not supported on other platforms.
+	Profile string
+}
+
+// String returns a compact description of s, suitable for error messages.
+func (s *Sandbox) String() string {
+	var parts []string
+	if s.ReadOnly {
+		parts = append(parts, "read-only")
+	}
+	if s.AllowedPaths != nil {
+		parts = append(parts, "allow="+strings.Join(s.AllowedPaths, ":"))
+	}
+	if len(s.WritablePaths) > 0 {
+		parts = append(parts, "writable="+strings.Join(s.WritablePaths, ":"))
+	}
+	if s.NoNetwork {
+		parts = append(parts, "no-network")
+	}
+	if s.Profile != "" {
+		parts = append(parts, "custom-profile")
+	}
+	if len(parts) == 0 {
+		return "unrestricted"
+	}
+	return strings.Join(parts, " ")
+}
+
+// usesLandlock reports whether s requires file system restrictions.
+func (s *Sandbox) usesLandlock() bool {
+	return s.ReadOnly || s.AllowedPaths != nil
+}
+
+// WithSandbox runs the command under the restrictions described by s.
+// The sandbox is recorded as a detail named "sandbox" in errors produced
+// by the command. If the command fails, and its captured standard error
+// suggests it was denied access by the sandbox, the error also carries a
+// *SandboxViolation detail named "sandbox_violation".
+func WithSandbox(s Sandbox) Option {
+	return func(cfg *config) {
+		cfg.sandbox = &s
+	}
+}
+
+// WithSandboxProfile runs the command under sandbox-exec on macOS, using
+// the specified profile, written in the Sandbox Profile Language. It is
+// equivalent to WithSandbox(Sandbox{Profile: profile}).
+func WithSandboxProfile(profile string) Option {
+	return WithSandbox(Sandbox{Profile: profile})
+}
+
+// SandboxExecProfile returns the sandbox-exec profile which enforces s on
+// macOS. If s.Profile is set, it is returned as-is. Otherwise, the profile
+// allows everything by default, then denies what s restricts.
+func (s *Sandbox) SandboxExecProfile() string {
+	if s.Profile != "" {
+		return s.Profile
+	}
+	var sb strings.Builder
+	sb.WriteString("(version 1)\n(allow default)\n")
+	if s.AllowedPaths != nil {
+		sb.WriteString("(deny file-read* file-write*)\n")
+		sb.WriteString("(allow file-read*" + sbplPaths(s.AllowedPaths) + ")\n")
+		if !s.ReadOnly {
+			sb.WriteString("(allow file-write*" + sbplPaths(s.AllowedPaths) + ")\n")
+		}
+	} else if s.ReadOnly {
+		sb.WriteString("(deny file-write*)\n")
+	}
+	if len(s.WritablePaths) > 0 {
+		sb.WriteString("(allow file-read* file-write*" + sbplPaths(s.WritablePaths) + ")\n")
+	}
+	if s.NoNetwork {
+		sb.WriteString("(deny network* (local ip))\n(deny network* (remote ip))\n")
+	}
+	return sb.String()
+}
+
+// sbplPaths returns subpath filters matching paths and the files beneath
+// them, for use in a sandbox-exec profile.
+func sbplPaths(paths []string) string {
+	var sb strings.Builder
+	for _, path := range paths {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			// sandbox-exec matches resolved paths, such as
+			// /private/tmp rather than /tmp.
+			path = real
+		}
+		sb.WriteString(" (subpath " + sbplString(path) + ")")
+	}
+	return sb.String()
+}
+
+// sbplString quotes s as a string in the Sandbox Profile Language.
+func sbplString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// SandboxViolation describes evidence that a command which failed was
+// denied access to a resource by its sandbox.
+type SandboxViolation struct {
+	// Evidence is the line of standard error which reported the
+	// denied access.
+	Evidence string
+}
+
+func (v *SandboxViolation) String() string {
+	return fmt.Sprintf("sandbox denied access: %s", v.Evidence)
+}
+
+// sandboxDenials lists strings which signal denied access in error
+// messages. They are matched case-insensitively.
+var sandboxDenials = []string{
+	"permission denied",
+	"operation not permitted",
+	"eacces",
+	"eperm",
+}
+
+// findSandboxViolation looks for evidence of denied access in stderr.
+func findSandboxViolation(stderr []byte) *SandboxViolation {
+	sc := bufio.NewScanner(bytes.NewReader(stderr))
+	for sc.Scan() {
+		line := sc.Text()
+		lower := strings.ToLower(line)
+		for _, denial := range sandboxDenials {
+			if strings.Contains(lower, denial) {
+				return &SandboxViolation{Evidence: line}
+			}
+		}
+	}
+	return nil
+}
+
+// maxSandboxDenials is the maximum number of denials reported by the
+// system log which are recorded in errors.
+const maxSandboxDenials = 10
+
+// sandboxDetails returns the details recorded in errors produced by
+// a command which ran under s, and which wrote stderr to standard error.
+// denials holds the denials reported by the system log, if any.
+func sandboxDetails(s *Sandbox, stderr []byte, denials []string) []Detail {
+	details := []Detail{{Key: "sandbox", Value: s.String()}}
+	if v := findSandboxViolation(stderr); v != nil {
+		details = append(details, Detail{Key: "sandbox_violation", Value: v})
+	}
+	if len(denials) > 0 {
+		details = append(details, Detail{Key: "sandbox_denials", Value: denials})
+	}
+	return details
+}
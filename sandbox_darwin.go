@@ -0,0 +1,89 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// sandboxExec is the path of the sandbox-exec program.
+const sandboxExec = "/usr/bin/sandbox-exec"
+
+// startSandboxed starts cmd under sandbox-exec, using the profile which
+// enforces s. The path and arguments of cmd are adjusted accordingly, such
+// that errors describe the real invocation.
+func startSandboxed(cmd *exec.Cmd, s *Sandbox) error {
+	args := []string{"sandbox-exec", "-p", s.SandboxExecProfile(), cmd.Path}
+	if len(cmd.Args) > 1 {
+		args = append(args, cmd.Args[1:]...)
+	}
+	cmd.Path = sandboxExec
+	cmd.Args = args
+	return cmd.Start()
+}
+
+// sandboxLogDenials returns the sandbox denials reported by the unified
+// log for the process with the specified pid, since the specified time.
+// sandbox-exec replaces itself with the sandboxed program, so the pid
+// identifies both.
+func sandboxLogDenials(pid int, since time.Time) []string {
+	if pid == 0 {
+		return nil
+	}
+	// The log is not queryable at sub-second granularity, and
+	// entries may be written slightly after the process exits.
+	start := since.Add(-time.Second).Format("2006-01-02 15:04:05")
+	predicate := fmt.Sprintf(`sender == "Sandbox" AND eventMessage CONTAINS "(%d) deny"`, pid)
+	out, err := exec.Command("/usr/bin/log", "show", "--style", "ndjson", "--start", start, "--predicate", predicate).Output()
+	if err != nil {
+		return nil
+	}
+	return parseSandboxLog(out)
+}
+
+// parseSandboxLog extracts distinct denial messages, such as
+//
+//	Sandbox: touch(1234) deny(1) file-write-create /private/tmp/x
+//
+// from newline-delimited JSON output of log show.
+func parseSandboxLog(out []byte) []string {
+	var denials []string
+	seen := make(map[string]bool)
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		var entry struct {
+			EventMessage string `json:"eventMessage"`
+		}
+		if json.Unmarshal(sc.Bytes(), &entry) != nil || entry.EventMessage == "" {
+			continue
+		}
+		msg := strings.TrimSpace(entry.EventMessage)
+		if seen[msg] {
+			continue
+		}
+		seen[msg] = true
+		denials = append(denials, msg)
+		if len(denials) == maxSandboxDenials {
+			break
+		}
+	}
+	return denials
+}
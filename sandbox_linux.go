@@ -0,0 +1,236 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Landlock system calls and constants, which package syscall does not
+// define. The system call numbers are the same on all architectures.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockRulePathBeneath = 1
+
+	landlockAccessExecute    = 1 << 0
+	landlockAccessWriteFile  = 1 << 1
+	landlockAccessReadFile   = 1 << 2
+	landlockAccessReadDir    = 1 << 3
+	landlockAccessRemoveDir  = 1 << 4
+	landlockAccessRemoveFile = 1 << 5
+	landlockAccessMakeChar   = 1 << 6
+	landlockAccessMakeDir    = 1 << 7
+	landlockAccessMakeReg    = 1 << 8
+	landlockAccessMakeSock   = 1 << 9
+	landlockAccessMakeFifo   = 1 << 10
+	landlockAccessMakeBlock  = 1 << 11
+	landlockAccessMakeSym    = 1 << 12
+
+	landlockAccessAll      = 1<<13 - 1
+	landlockAccessRead     = landlockAccessExecute | landlockAccessReadFile | landlockAccessReadDir
+	landlockAccessFileOnly = landlockAccessExecute | landlockAccessWriteFile | landlockAccessReadFile
+
+	oPath = 0x200000
+
+	prSetNoNewPrivs   = 38
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+)
+
+// startSandboxed starts cmd under the restrictions described by s.
+//
+// Landlock and seccomp restrictions apply to the thread which installs
+// them, and are inherited by processes forked from that thread. Therefore,
+// startSandboxed installs them on a dedicated, locked OS thread, forks the
+// child from that thread, and discards the thread afterwards, by exiting
+// the goroutine without unlocking it.
+func startSandboxed(cmd *exec.Cmd, s *Sandbox) error {
+	if s.Profile != "" {
+		return errors.New("execx: sandbox: profiles are only supported on macOS")
+	}
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		// Deliberately no UnlockOSThread: the thread is restricted,
+		// and must not be reused.
+		if err := restrictThread(s); err != nil {
+			errc <- err
+			return
+		}
+		errc <- cmd.Start()
+	}()
+	return <-errc
+}
+
+// sandboxLogDenials returns nil: Landlock and seccomp denials are not
+// logged, and are only evident from the errors the process reports.
+func sandboxLogDenials(pid int, since time.Time) []string {
+	return nil
+}
+
+// restrictThread installs the restrictions described by s on the calling
+// thread.
+func restrictThread(s *Sandbox) error {
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("execx: sandbox: prctl(PR_SET_NO_NEW_PRIVS): %v", errno)
+	}
+	if s.usesLandlock() {
+		if err := landlock(s); err != nil {
+			return fmt.Errorf("execx: sandbox: landlock: %v", err)
+		}
+	}
+	if s.NoNetwork {
+		if err := denyNetwork(); err != nil {
+			return fmt.Errorf("execx: sandbox: seccomp: %v", err)
+		}
+	}
+	return nil
+}
+
+// landlock installs the file system restrictions described by s.
+func landlock(s *Sandbox) error {
+	attr := struct{ handledAccessFS uint64 }{landlockAccessAll}
+	fd, _, errno := syscall.RawSyscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return errno
+	}
+	ruleset := int(fd)
+	defer syscall.Close(ruleset)
+
+	readable := s.AllowedPaths
+	if readable == nil {
+		readable = []string{"/"}
+	}
+	rights := uint64(landlockAccessAll)
+	if s.ReadOnly {
+		rights = landlockAccessRead
+	}
+	for _, path := range readable {
+		if err := landlockAllow(ruleset, path, rights); err != nil {
+			return err
+		}
+	}
+	for _, path := range s.WritablePaths {
+		if err := landlockAllow(ruleset, path, landlockAccessAll); err != nil {
+			return err
+		}
+	}
+	if _, _, errno := syscall.RawSyscall(sysLandlockRestrictSelf, uintptr(ruleset), 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// landlockAllow adds a rule granting the specified rights to path, and the
+// files beneath it, to ruleset.
+func landlockAllow(ruleset int, path string, rights uint64) error {
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer syscall.Close(fd)
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		rights &= landlockAccessFileOnly
+	}
+
+	// struct landlock_path_beneath_attr is packed: a __u64 followed
+	// by a __s32, with no padding.
+	var attr [12]byte
+	*(*uint64)(unsafe.Pointer(&attr[0])) = rights
+	*(*int32)(unsafe.Pointer(&attr[8])) = int32(fd)
+	_, _, errno := syscall.RawSyscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr[0])), 0, 0, 0)
+	if errno != 0 {
+		return &os.PathError{Op: "landlock_add_rule", Path: path, Err: errno}
+	}
+	return nil
+}
+
+// BPF instruction classes and fields, as used by seccomp filters.
+const (
+	bpfLdWAbs       = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJeqK         = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJgeK         = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfRetK         = 0x06 // BPF_RET | BPF_K
+	seccompRetAllow = 0x7fff0000
+	seccompRetErrno = 0x00050000
+
+	// Offsets into struct seccomp_data.
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArg0 = 16
+)
+
+type sockFilter struct {
+	code uint16
+	jt   uint8
+	jf   uint8
+	k    uint32
+}
+
+type sockFprog struct {
+	len    uint16
+	filter *sockFilter
+}
+
+// errSeccompUnsupported is returned if seccomp filters are not supported
+// on the current architecture.
+var errSeccompUnsupported = errors.New("not supported on " + runtime.GOARCH)
+
+// denyNetwork installs a seccomp filter which makes socket(2) fail with
+// EACCES for the AF_INET and AF_INET6 address families.
+func denyNetwork() error {
+	if auditArch == 0 {
+		return errSeccompUnsupported
+	}
+	const (
+		allow = 8
+		deny  = 9
+	)
+	// Jump offsets are relative to the next instruction.
+	filter := []sockFilter{
+		/* 0 */ {bpfLdWAbs, 0, 0, seccompDataArch},
+		/* 1 */ {bpfJeqK, 0, deny - 2, auditArch},
+		/* 2 */ {bpfLdWAbs, 0, 0, seccompDataNr},
+		/* 3 */ {bpfJgeK, deny - 4, 0, x32SyscallBit},
+		/* 4 */ {bpfJeqK, 0, allow - 5, sysSocket},
+		/* 5 */ {bpfLdWAbs, 0, 0, seccompDataArg0},
+		/* 6 */ {bpfJeqK, deny - 7, 0, syscall.AF_INET},
+		/* 7 */ {bpfJeqK, deny - 8, allow - 8, syscall.AF_INET6},
+		/* 8 */ {bpfRetK, 0, 0, seccompRetAllow},
+		/* 9 */ {bpfRetK, 0, 0, seccompRetErrno | uint32(syscall.EACCES)},
+	}
+	prog := sockFprog{len: uint16(len(filter)), filter: &filter[0]}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog)))
+	runtime.KeepAlive(filter)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
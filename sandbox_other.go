@@ -0,0 +1,35 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package execx
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// startSandboxed reports that sandboxes are not supported on this platform.
+func startSandboxed(cmd *exec.Cmd, s *Sandbox) error {
+	return errors.New("execx: sandbox: not supported on this platform")
+}
+
+// sandboxLogDenials returns nil: the denials are not logged on this
+// platform.
+func sandboxLogDenials(pid int, since time.Time) []string {
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("sandboxes are only supported on Linux and macOS")
+	}
+	t.Run("NoNetwork", testSandboxNoNetwork)
+	t.Run("ReadOnly", testSandboxReadOnly)
+}
+
+func testSandboxNoNetwork(t *testing.T) {
+	self := selfCmd("listen")
+	_, err := execx.Run(context.Background(), self, execx.WithSandbox(execx.Sandbox{NoNetwork: true}))
+	checkSandboxViolation(t, err)
+}
+
+func testSandboxReadOnly(t *testing.T) {
+	dir := tempDir(t)
+	self := selfCmd("create")
+	self.Env = append(self.Env, "EXECX_TEST_PATH="+filepath.Join(dir, "file"))
+	_, err := execx.Run(context.Background(), self, execx.WithSandbox(execx.Sandbox{ReadOnly: true}))
+	checkSandboxViolation(t, err)
+}
+
+func checkSandboxViolation(t *testing.T, err error) {
+	t.Helper()
+
+	if se, ok := err.(*execx.StartError); ok {
+		t.Skipf("sandbox not supported: %v", se)
+	}
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	if _, ok := ee.Fields()["sandbox_violation"].(*execx.SandboxViolation); !ok {
+		t.Fatalf("sandbox violation not recorded: %+v", ee)
+	}
+}
+
+func TestSandboxExecProfile(t *testing.T) {
+	s := execx.Sandbox{
+		ReadOnly:      true,
+		AllowedPaths:  []string{"/nonexistent/usr", `/nonexistent/say "hi"`},
+		WritablePaths: []string{"/nonexistent/out"},
+		NoNetwork:     true,
+	}
+	want := strings.Join([]string{
+		"(version 1)",
+		"(allow default)",
+		"(deny file-read* file-write*)",
+		`(allow file-read* (subpath "/nonexistent/usr") (subpath "/nonexistent/say \"hi\""))`,
+		`(allow file-read* file-write* (subpath "/nonexistent/out"))`,
+		"(deny network* (local ip))",
+		"(deny network* (remote ip))",
+	}, "\n") + "\n"
+	if got := s.SandboxExecProfile(); got != want {
+		t.Errorf("got profile\n%s\nwant\n%s", got, want)
+	}
+	custom := execx.Sandbox{Profile: "(version 1)\n(deny default)\n"}
+	if got := custom.SandboxExecProfile(); got != custom.Profile {
+		t.Errorf("custom profile not used: got %q", got)
+	}
+}
+
+func TestSandboxProfileUnsupported(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("profiles are supported on macOS")
+	}
+	_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithSandboxProfile("(version 1)"))
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An IOClass is an I/O scheduling class, as used by ioprio_set(2).
+type IOClass int
+
+// I/O scheduling classes.
+const (
+	IOClassNone IOClass = iota
+	IOClassRealtime
+	IOClassBestEffort
+	IOClassIdle
+)
+
+func (c IOClass) String() string {
+	switch c {
+	case IOClassNone:
+		return "none"
+	case IOClassRealtime:
+		return "realtime"
+	case IOClassBestEffort:
+		return "best-effort"
+	case IOClassIdle:
+		return "idle"
+	default:
+		return fmt.Sprintf("IOClass(%d)", int(c))
+	}
+}
+
+// A SchedPolicy is a CPU scheduling policy, as used by
+// sched_setscheduler(2).
+type SchedPolicy int
+
+// CPU scheduling policies. The values match the Linux definitions. The
+// realtime policies, SchedFIFO, SchedRR and SchedDeadline, are reported
+// by WithPriorityReset, but cannot be set using WithSchedPolicy.
+const (
+	SchedOther    SchedPolicy = 0
+	SchedFIFO     SchedPolicy = 1
+	SchedRR       SchedPolicy = 2
+	SchedBatch    SchedPolicy = 3
+	SchedIdle     SchedPolicy = 5
+	SchedDeadline SchedPolicy = 6
+)
+
+func (p SchedPolicy) String() string {
+	switch p {
+	case SchedOther:
+		return "other"
+	case SchedFIFO:
+		return "fifo"
+	case SchedRR:
+		return "rr"
+	case SchedBatch:
+		return "batch"
+	case SchedIdle:
+		return "idle"
+	case SchedDeadline:
+		return "deadline"
+	default:
+		return fmt.Sprintf("SchedPolicy(%d)", int(p))
+	}
+}
+
+// Scheduling describes the scheduling parameters applied to a process.
+//
+// Scheduling parameters are applied as soon as the process has started.
+// They are supported on Linux only.
+type Scheduling struct {
+	// Nice is the nice value of the process, if SetNice is true.
+	Nice    int
+	SetNice bool
+
+	// IOClass and IOLevel describe the I/O priority of the process,
+	// if IOClass is not IOClassNone.
+	IOClass IOClass
+	IOLevel int
+
+	// CPUs holds the CPUs the process may run on. If CPUs is empty,
+	// the CPU affinity of the process is not changed.
+	CPUs []int
+
+	// Policy is the CPU scheduling policy of the process, if SetPolicy
+	// is true.
+	Policy    SchedPolicy
+	SetPolicy bool
+
+	// OOMScoreAdj is the OOM killer score adjustment of the process,
+	// if SetOOMScoreAdj is true.
+	OOMScoreAdj    int
+	SetOOMScoreAdj bool
+
+	// ResetPriority, if true, resets the elevated scheduling parameters
+	// the process inherited from the current process, before the other
+	// parameters are applied. See WithPriorityReset.
+	ResetPriority bool
+
+	// Resets describes the parameters which were reset, such as
+	// "policy:fifo/50->other" or "nice:-10->0".
+	Resets []string
+
+	// Errors holds the errors encountered while applying the
+	// scheduling parameters, if any.
+	Errors []string
+}
+
+// WithNice sets the nice value of the process.
+func WithNice(n int) Option {
+	return func(cfg *config) {
+		cfg.scheduling().Nice = n
+		cfg.scheduling().SetNice = true
+	}
+}
+
+// WithIOPriority sets the I/O scheduling class and priority level of
+// the process.
+func WithIOPriority(class IOClass, level int) Option {
+	return func(cfg *config) {
+		cfg.scheduling().IOClass = class
+		cfg.scheduling().IOLevel = level
+	}
+}
+
+// WithCPUAffinity restricts the process to the specified CPUs.
+func WithCPUAffinity(cpus ...int) Option {
+	return func(cfg *config) {
+		cfg.scheduling().CPUs = append([]int(nil), cpus...)
+	}
+}
+
+// WithSchedPolicy sets the CPU scheduling policy of the process.
+func WithSchedPolicy(p SchedPolicy) Option {
+	return func(cfg *config) {
+		cfg.scheduling().Policy = p
+		cfg.scheduling().SetPolicy = true
+	}
+}
+
+// WithOOMScoreAdj sets the OOM killer score adjustment of the process,
+// which ranges from -1000 (never kill) to 1000 (kill first). Lowering the
+// adjustment usually requires privileges.
+func WithOOMScoreAdj(adj int) Option {
+	return func(cfg *config) {
+		cfg.scheduling().OOMScoreAdj = adj
+		cfg.scheduling().SetOOMScoreAdj = true
+	}
+}
+
+// WithPriorityReset resets the elevated scheduling parameters which the
+// process inherits from the current process to their defaults, such that
+// the children of a process running with a realtime policy, a negative
+// nice value, or in the realtime I/O class, cannot starve the system. A
+// realtime policy is reset to SchedOther, a negative nice value to zero,
+// and the realtime I/O class to the default class. Parameters which are
+// not elevated are left alone, and parameters set explicitly, such as by
+// WithNice, take precedence. The parameters which were reset are recorded
+// in Result.Scheduling.
+//
+// Like other scheduling parameters, the reset is applied as soon as the
+// process has started, so the process runs with the inherited parameters
+// for a short while.
+func WithPriorityReset() Option {
+	return func(cfg *config) {
+		cfg.scheduling().ResetPriority = true
+	}
+}
+
+// scheduling returns cfg.sched, allocating it if necessary.
+func (cfg *config) scheduling() *Scheduling {
+	if cfg.sched == nil {
+		cfg.sched = new(Scheduling)
+	}
+	return cfg.sched
+}
+
+// String returns a compact description of s, such as
+// "reset=nice:-10->0 nice=10 io=idle/7 cpus=0,1 policy=batch".
+func (s *Scheduling) String() string {
+	var parts []string
+	if s.ResetPriority {
+		if len(s.Resets) > 0 {
+			parts = append(parts, "reset="+strings.Join(s.Resets, ","))
+		} else {
+			parts = append(parts, "reset=none")
+		}
+	}
+	if s.SetNice {
+		parts = append(parts, fmt.Sprintf("nice=%d", s.Nice))
+	}
+	if s.IOClass != IOClassNone {
+		parts = append(parts, fmt.Sprintf("io=%v/%d", s.IOClass, s.IOLevel))
+	}
+	if len(s.CPUs) > 0 {
+		cpus := make([]string, len(s.CPUs))
+		for i, cpu := range s.CPUs {
+			cpus[i] = fmt.Sprint(cpu)
+		}
+		parts = append(parts, "cpus="+strings.Join(cpus, ","))
+	}
+	if s.SetPolicy {
+		parts = append(parts, fmt.Sprintf("policy=%v", s.Policy))
+	}
+	if s.SetOOMScoreAdj {
+		parts = append(parts, fmt.Sprintf("oom_score_adj=%d", s.OOMScoreAdj))
+	}
+	for _, err := range s.Errors {
+		parts = append(parts, fmt.Sprintf("error=%q", err))
+	}
+	return strings.Join(parts, " ")
+}
+
+// applyScheduling applies the configured scheduling parameters to the
+// process, and returns a record of them.
+func (h *Handle) applyScheduling() *Scheduling {
+	if h.cfg.sched == nil {
+		return nil
+	}
+	applied := *h.cfg.sched
+	applied.Errors = nil
+	applied.Resets = nil
+	for _, err := range setScheduling(h.cmd.Process.Pid, &applied) {
+		applied.Errors = append(applied.Errors, err.Error())
+	}
+	return &applied
+}
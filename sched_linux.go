@@ -0,0 +1,128 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+
+	// schedResetOnFork is or-ed into the policy of processes whose
+	// children do not inherit their realtime policy.
+	schedResetOnFork = 0x40000000
+)
+
+// setScheduling applies s to the process with the specified pid. Note
+// that on Linux, the nice value applies to the main thread of the process
+// only, and that threads or processes created by the process before the
+// parameters are applied do not inherit them.
+func setScheduling(pid int, s *Scheduling) []error {
+	var errs []error
+	if s.ResetPriority {
+		errs = append(errs, resetPriority(pid, s)...)
+	}
+	if s.SetNice {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, s.Nice); err != nil {
+			errs = append(errs, fmt.Errorf("setpriority: %v", err))
+		}
+	}
+	if s.IOClass != IOClassNone {
+		prio := uintptr(s.IOClass)<<ioprioClassShift | uintptr(s.IOLevel)
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), prio)
+		if errno != 0 {
+			errs = append(errs, fmt.Errorf("ioprio_set: %v", errno))
+		}
+	}
+	if len(s.CPUs) > 0 {
+		var mask [16]uint64 // 1024 CPUs, like glibc's cpu_set_t
+		for _, cpu := range s.CPUs {
+			if cpu < 0 || cpu >= len(mask)*64 {
+				errs = append(errs, fmt.Errorf("sched_setaffinity: invalid CPU %d", cpu))
+				continue
+			}
+			mask[cpu/64] |= 1 << uint(cpu%64)
+		}
+		_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(pid), unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+		if errno != 0 {
+			errs = append(errs, fmt.Errorf("sched_setaffinity: %v", errno))
+		}
+	}
+	if s.SetPolicy {
+		var param struct{ priority int32 }
+		_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETSCHEDULER, uintptr(pid), uintptr(s.Policy), uintptr(unsafe.Pointer(&param)))
+		if errno != 0 {
+			errs = append(errs, fmt.Errorf("sched_setscheduler: %v", errno))
+		}
+	}
+	if s.SetOOMScoreAdj {
+		path := fmt.Sprintf("/proc/%d/oom_score_adj", pid)
+		if err := ioutil.WriteFile(path, []byte(fmt.Sprint(s.OOMScoreAdj)), 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// resetPriority resets the elevated scheduling parameters of the process
+// with the specified pid, and records them in s.Resets.
+func resetPriority(pid int, s *Scheduling) []error {
+	var errs []error
+	policy, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETSCHEDULER, uintptr(pid), 0, 0)
+	switch p := SchedPolicy(policy &^ schedResetOnFork); {
+	case errno != 0:
+		errs = append(errs, fmt.Errorf("sched_getscheduler: %v", errno))
+	case p == SchedFIFO || p == SchedRR || p == SchedDeadline:
+		var param struct{ priority int32 }
+		syscall.RawSyscall(syscall.SYS_SCHED_GETPARAM, uintptr(pid), uintptr(unsafe.Pointer(&param)), 0)
+		old := param.priority
+		param.priority = 0
+		_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETSCHEDULER, uintptr(pid), uintptr(SchedOther), uintptr(unsafe.Pointer(&param)))
+		if errno != 0 {
+			errs = append(errs, fmt.Errorf("sched_setscheduler: %v", errno))
+		} else {
+			s.Resets = append(s.Resets, fmt.Sprintf("policy:%v/%d->%v", p, old, SchedOther))
+		}
+	}
+	// The raw system call returns 20 - nice, to avoid negative values.
+	if prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, pid); err != nil {
+		errs = append(errs, fmt.Errorf("getpriority: %v", err))
+	} else if nice := 20 - prio; nice < 0 && !s.SetNice {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, 0); err != nil {
+			errs = append(errs, fmt.Errorf("setpriority: %v", err))
+		} else {
+			s.Resets = append(s.Resets, fmt.Sprintf("nice:%d->0", nice))
+		}
+	}
+	ioprio, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(pid), 0)
+	switch class := IOClass(ioprio >> ioprioClassShift); {
+	case errno != 0:
+		errs = append(errs, fmt.Errorf("ioprio_get: %v", errno))
+	case class == IOClassRealtime && s.IOClass == IOClassNone:
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), 0)
+		if errno != 0 {
+			errs = append(errs, fmt.Errorf("ioprio_set: %v", errno))
+		} else {
+			level := ioprio & (1<<ioprioClassShift - 1)
+			s.Resets = append(s.Resets, fmt.Sprintf("io:%v/%d->%v", class, level, IOClassNone))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestPriorityReset(t *testing.T) {
+	t.Run("NotElevated", func(t *testing.T) {
+		res, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithPriorityReset())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.Scheduling.String(); got != "reset=none" {
+			t.Errorf("got %q, want %q", got, "reset=none")
+		}
+	})
+	t.Run("Nice", func(t *testing.T) {
+		// The nice value applies to threads: raise the priority of
+		// the thread which starts the child only.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		tid := syscall.Gettid()
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, -5); err != nil {
+			t.Skipf("cannot raise priority: %v", err)
+		}
+		defer syscall.Setpriority(syscall.PRIO_PROCESS, tid, 0)
+
+		pr, pw := io.Pipe()
+		self := selfCmd("echo")
+		self.Stdin = pr // keeps the child alive until pw is closed
+		h, err := execx.Start(context.Background(), self, execx.WithPriorityReset())
+		if err != nil {
+			t.Fatal(err)
+		}
+		prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, self.Process.Pid)
+		pw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nice := 20 - prio; nice != 0 {
+			t.Errorf("got nice value %d in the child, want 0", nice)
+		}
+		res, err := h.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.Scheduling.String(); got != "reset=nice:-5->0" {
+			t.Errorf("got %q, want %q", got, "reset=nice:-5->0")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestScheduling(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("scheduling parameters are only supported on Linux")
+	}
+	pr, pw := io.Pipe()
+	self := selfCmd("echo")
+	self.Stdin = pr // keeps the child alive until pw is closed
+	h, err := execx.Start(context.Background(), self,
+		execx.WithNice(5),
+		execx.WithIOPriority(execx.IOClassIdle, 0),
+		execx.WithCPUAffinity(0),
+		execx.WithSchedPolicy(execx.SchedBatch),
+		execx.WithOOMScoreAdj(500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+	res, err := h.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sched := res.Scheduling
+	if sched == nil {
+		t.Fatal("scheduling parameters not recorded")
+	}
+	if len(sched.Errors) > 0 {
+		t.Errorf("errors applying scheduling parameters: %q", sched.Errors)
+	}
+	want := "nice=5 io=idle/0 cpus=0 policy=batch oom_score_adj=500"
+	if got := sched.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,361 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// An Overlap is a policy for activations of a Job which occur while a
+// previous run of the Job is still in progress.
+type Overlap int
+
+// Overlap policies.
+const (
+	// OverlapSkip skips the activation. The skipped run is recorded
+	// in the history of the Job.
+	OverlapSkip Overlap = iota
+
+	// OverlapQueue runs the Job again once the previous run completes.
+	// Activations which occur while a run is already queued are
+	// coalesced into it.
+	OverlapQueue
+
+	// OverlapKillPrevious cancels the previous run, waits for it to
+	// complete, and starts a new one.
+	OverlapKillPrevious
+)
+
+func (o Overlap) String() string {
+	switch o {
+	case OverlapSkip:
+		return "skip"
+	case OverlapQueue:
+		return "queue"
+	case OverlapKillPrevious:
+		return "kill-previous"
+	default:
+		return fmt.Sprintf("Overlap(%d)", int(o))
+	}
+}
+
+// defaultHistory is the default number of runs recorded for each Job.
+const defaultHistory = 16
+
+// A Job is a command run periodically by a Scheduler.
+type Job struct {
+	// Name identifies the Job within its Scheduler.
+	Name string
+
+	// Cmd is the command to run. Each run uses a Clone of Cmd.
+	Cmd *exec.Cmd
+
+	// Options configure each run of the command.
+	Options []Option
+
+	// Schedule determines when the Job runs.
+	Schedule Schedule
+
+	// Overlap is the policy for activations which occur while the Job
+	// is running.
+	Overlap Overlap
+
+	// Jitter, if positive, delays each activation by a random duration
+	// in [0, Jitter), in order to spread the load of jobs which share
+	// a schedule. See WithRand.
+	Jitter time.Duration
+
+	// History is the number of runs recorded by the Scheduler. If
+	// History is zero, 16 runs are recorded.
+	History int
+}
+
+// A JobRun records a run of a Job.
+type JobRun struct {
+	// Job is the name of the Job.
+	Job string
+
+	// Scheduled is the activation time of the run.
+	Scheduled time.Time
+
+	// Start is the time the run started. It is the zero time if the
+	// run was skipped.
+	Start time.Time
+
+	// Duration is the time it took the run to complete.
+	Duration time.Duration
+
+	// Skipped is true if the run was skipped as per OverlapSkip.
+	Skipped bool
+
+	// Result is the result of the command, if it started.
+	Result *Result
+
+	// Err is the error returned by the Runner, typically an *ExitError
+	// or a *StartError. If the run was canceled as per
+	// OverlapKillPrevious, or because the Scheduler was stopped, Err
+	// reflects that.
+	Err error
+}
+
+// A Scheduler runs Jobs on their schedules, in the current process, like
+// a lightweight cron. Use Add to register Jobs, and Run to run them.
+//
+// The zero value is a Scheduler which runs commands using Local.
+// A Scheduler is safe for concurrent use by multiple goroutines.
+type Scheduler struct {
+	// Runner runs the commands. If Runner is nil, Local is used.
+	Runner Runner
+
+	mu      sync.Mutex // protects the fields below
+	jobs    map[string]*job
+	ctx     context.Context // set while Run is running
+	wg      sync.WaitGroup
+	running bool
+}
+
+// job is the state of a Job registered with a Scheduler.
+type job struct {
+	Job
+
+	mu      sync.Mutex // protects the fields below
+	cancel  context.CancelFunc
+	done    chan struct{} // closed when the current run completes
+	queued  *JobRun
+	history []JobRun
+	stop    chan struct{} // closed when the Job is removed
+}
+
+// Add registers j with the Scheduler. If the Scheduler is running, the
+// Job is scheduled immediately. Add returns an error if a Job with the
+// same name is already registered.
+func (s *Scheduler) Add(j Job) error {
+	if j.Cmd == nil || j.Schedule == nil {
+		return fmt.Errorf("execx: job %q: Cmd and Schedule must be set", j.Name)
+	}
+	if j.History <= 0 {
+		j.History = defaultHistory
+	}
+	j.Cmd = Clone(j.Cmd)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[j.Name]; ok {
+		return fmt.Errorf("execx: job %q already exists", j.Name)
+	}
+	if s.jobs == nil {
+		s.jobs = make(map[string]*job)
+	}
+	jb := &job{Job: j, stop: make(chan struct{})}
+	s.jobs[j.Name] = jb
+	if s.running {
+		s.launch(jb)
+	}
+	return nil
+}
+
+// Remove unregisters the Job with the specified name, and cancels its
+// run, if one is in progress. Its history is discarded.
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	jb, ok := s.jobs[name]
+	delete(s.jobs, name)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	close(jb.stop)
+	jb.mu.Lock()
+	if jb.cancel != nil {
+		jb.cancel()
+	}
+	jb.mu.Unlock()
+}
+
+var errSchedulerRunning = errors.New("execx: scheduler is already running")
+
+// Run runs the registered Jobs until ctx is done. Runs in progress when
+// ctx is done are canceled, and Run waits for them to complete before
+// returning ctx.Err(). Commands run under contexts derived from ctx.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return errSchedulerRunning
+	}
+	s.running = true
+	s.ctx = ctx
+	for _, jb := range s.jobs {
+		s.launch(jb)
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	s.running = false
+	s.ctx = nil
+	s.mu.Unlock()
+	s.wg.Wait()
+	return ctx.Err()
+}
+
+// History returns the recorded runs of the Job with the specified name,
+// oldest first, or nil if there is no such Job. Runs in progress are
+// not included.
+func (s *Scheduler) History(name string) []JobRun {
+	s.mu.Lock()
+	jb, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	jb.mu.Lock()
+	defer jb.mu.Unlock()
+	return append([]JobRun(nil), jb.history...)
+}
+
+// launch starts the goroutine which activates jb. s.mu must be held.
+func (s *Scheduler) launch(jb *job) {
+	s.wg.Add(1)
+	go s.loop(s.ctx, jb)
+}
+
+// loop activates jb on its schedule until ctx is done, or jb is removed,
+// then waits for the run in progress, if any.
+func (s *Scheduler) loop(ctx context.Context, jb *job) {
+	defer s.wg.Done()
+	defer jb.wait()
+
+	clock := ClockFrom(ctx)
+	next := clock.Now()
+	for {
+		next = jb.Schedule.Next(next)
+		if next.IsZero() {
+			return
+		}
+		at := next
+		if jb.Jitter > 0 {
+			at = at.Add(time.Duration(randInt63n(ctx, int64(jb.Jitter))))
+		}
+		t := clock.NewTimer(at.Sub(clock.Now()))
+		select {
+		case <-t.C():
+			s.activate(ctx, jb, next)
+		case <-jb.stop:
+			t.Stop()
+			return
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+		if now := clock.Now(); next.Before(now) {
+			// Catch up after a long run, or a suspended system,
+			// without activating the Job for each missed time.
+			next = now
+		}
+	}
+}
+
+// activate handles an activation of jb scheduled at the specified time.
+func (s *Scheduler) activate(ctx context.Context, jb *job, scheduled time.Time) {
+	run := &JobRun{Job: jb.Name, Scheduled: scheduled}
+
+	jb.mu.Lock()
+	if jb.done != nil {
+		switch jb.Overlap {
+		case OverlapSkip:
+			run.Skipped = true
+			jb.record(*run)
+			jb.mu.Unlock()
+			return
+		case OverlapQueue:
+			if jb.queued == nil {
+				jb.queued = run
+			}
+			jb.mu.Unlock()
+			return
+		case OverlapKillPrevious:
+			jb.cancel()
+			done := jb.done
+			jb.mu.Unlock()
+			<-done
+			jb.mu.Lock()
+		}
+	}
+	s.start(ctx, jb, run)
+	jb.mu.Unlock()
+}
+
+// start starts run. jb.mu must be held.
+func (s *Scheduler) start(ctx context.Context, jb *job, run *JobRun) {
+	r := s.Runner
+	if r == nil {
+		r = Local
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	jb.cancel = cancel
+	jb.done = done
+	go func() {
+		defer cancel()
+		clock := ClockFrom(ctx)
+		run.Start = clock.Now()
+		run.Result, run.Err = r.Run(runCtx, Clone(jb.Cmd), jb.Options...)
+		run.Duration = clock.Now().Sub(run.Start)
+
+		jb.mu.Lock()
+		defer jb.mu.Unlock()
+		jb.record(*run)
+		jb.cancel = nil
+		jb.done = nil
+		close(done)
+		if q := jb.queued; q != nil && ctx.Err() == nil {
+			jb.queued = nil
+			select {
+			case <-jb.stop:
+			default:
+				s.start(ctx, jb, q)
+			}
+		}
+	}()
+}
+
+// wait waits for the run of jb in progress, if any, including queued
+// runs started in the meantime.
+func (jb *job) wait() {
+	for {
+		jb.mu.Lock()
+		done := jb.done
+		jb.mu.Unlock()
+		if done == nil {
+			return
+		}
+		<-done
+	}
+}
+
+// record appends run to the history of jb. jb.mu must be held.
+func (jb *job) record(run JobRun) {
+	if len(jb.history) >= jb.History {
+		copy(jb.history, jb.history[1:])
+		jb.history = jb.history[:len(jb.history)-1]
+	}
+	jb.history = append(jb.history, run)
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestScheduler(t *testing.T) {
+	var s execx.Scheduler
+	err := s.Add(execx.Job{Name: "fail", Cmd: selfCmd("on"), Schedule: execx.Every(50 * time.Millisecond), History: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(execx.Job{Name: "fail", Cmd: selfCmd("on"), Schedule: execx.Every(time.Second)}); err == nil {
+		t.Fatal("added duplicate job")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	if err := s.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	runs := s.History("fail")
+	if len(runs) != 3 {
+		t.Fatalf("got %d runs, want 3", len(runs))
+	}
+	for _, run := range runs {
+		if run.Skipped {
+			// The previous run was still in progress.
+			continue
+		}
+		var ee *execx.ExitError
+		if !errors.As(run.Err, &ee) || ee.ExitCode() != 1 {
+			t.Errorf("got error %v, want exit code 1", run.Err)
+		}
+	}
+	if s.History("missing") != nil {
+		t.Error("got history for missing job")
+	}
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	tests := []struct {
+		overlap execx.Overlap
+		check   func(t *testing.T, runs []execx.JobRun)
+	}{
+		{execx.OverlapSkip, func(t *testing.T, runs []execx.JobRun) {
+			skipped := 0
+			for _, run := range runs {
+				if run.Skipped {
+					skipped++
+				}
+			}
+			if skipped == 0 {
+				t.Errorf("no runs skipped: %+v", runs)
+			}
+		}},
+		{execx.OverlapQueue, func(t *testing.T, runs []execx.JobRun) {
+			for _, run := range runs {
+				if run.Skipped {
+					t.Errorf("run skipped: %+v", run)
+				}
+			}
+		}},
+		{execx.OverlapKillPrevious, func(t *testing.T, runs []execx.JobRun) {
+			if len(runs) < 2 {
+				t.Fatalf("got %d runs, want at least 2", len(runs))
+			}
+			if runs[0].Err == nil || runs[0].Duration >= time.Second {
+				t.Errorf("first run was not killed: %+v", runs[0])
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overlap.String(), func(t *testing.T) {
+			var s execx.Scheduler
+			s.Add(execx.Job{
+				Name:     "nap",
+				Cmd:      selfCmd("nap"),
+				Schedule: execx.Every(200 * time.Millisecond),
+				Overlap:  tt.overlap,
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 700*time.Millisecond)
+			defer cancel()
+			s.Run(ctx)
+			tt.check(t, s.History("nap"))
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExitErrorSchema is the version of the JSON representation of
+// *ExitError produced by this version of the package, recorded in its
+// "schema" field. It is incremented when fields are added. Versions
+// before the field was introduced are read as zero.
+const ExitErrorSchema = 2
+
+// UnmarshalJSON implements json.Unmarshaler for *ExitError, such that
+// errors serialized by MarshalJSON, possibly by another program using a
+// different version of this package, can be decoded.
+//
+// Decoding is tolerant: representations of any schema version are
+// accepted, and fields which this version of the package does not know
+// about are preserved, and written back by MarshalJSON, along with the
+// more recent schema version, such that errors relayed by an older
+// program lose no data. The state of the process is restored as per
+// WrapState: Error, ExitCode, UserTime and SystemTime return the values
+// which were serialized. Details are restored in lexical order of their
+// keys, with values as decoded by package encoding/json.
+func (e *ExitError) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return fmt.Errorf("execx: decoding ExitError: %w", err)
+	}
+	var je jsonExitError
+	if err := json.Unmarshal(b, &je); err != nil {
+		return fmt.Errorf("execx: decoding ExitError: %w", err)
+	}
+	for _, key := range jsonExitErrorKeys() {
+		delete(fields, key)
+	}
+	*e = ExitError{
+		ExitError:     &exec.ExitError{},
+		Path:          je.Path,
+		ResolvedPath:  je.Resolved,
+		Args:          je.Args,
+		Dir:           je.Dir,
+		ChildEnv:      je.ChildEnv,
+		Profiles:      je.Profiles,
+		PID:           je.PID,
+		PPID:          je.PPID,
+		PGID:          je.PGID,
+		StderrDropped: je.StderrDrop,
+		Reason:        je.Reason,
+		Hints:         je.Hints,
+		State: decodedState{
+			code:   je.ExitCode,
+			status: je.Error,
+			user:   je.UserTime,
+			system: je.SystemTime,
+		},
+		schema: je.Schema,
+	}
+	if je.Stderr != "" {
+		e.ExitError.Stderr = []byte(je.Stderr)
+	}
+	if je.Error == "" {
+		e.State = decodedState{code: je.ExitCode, status: fmt.Sprintf("exit status %d", je.ExitCode)}
+	}
+	keys := make([]string, 0, len(je.Details))
+	for k := range je.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.Details = append(e.Details, Detail{Key: k, Value: je.Details[k]})
+	}
+	if len(fields) > 0 {
+		e.unknown = fields
+	}
+	return nil
+}
+
+// jsonExitErrorKeys returns the keys of the fields of jsonExitError.
+func jsonExitErrorKeys() []string {
+	t := reflect.TypeOf(jsonExitError{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// withUnknown returns b, the JSON representation of e, with the fields
+// preserved by UnmarshalJSON added, and the schema version updated, if
+// e was decoded from a more recent version.
+func (e *ExitError) withUnknown(b []byte) ([]byte, error) {
+	if len(e.unknown) == 0 && e.schema <= ExitErrorSchema {
+		return b, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range e.unknown {
+		m[k] = v
+	}
+	if e.schema > ExitErrorSchema {
+		m["schema"] = json.RawMessage(fmt.Sprint(e.schema))
+	}
+	return json.Marshal(m)
+}
+
+// decodedState is the state of a process whose *ExitError was decoded
+// by UnmarshalJSON.
+type decodedState struct {
+	code   int
+	status string
+	user   time.Duration
+	system time.Duration
+}
+
+func (s decodedState) ExitCode() int             { return s.code }
+func (s decodedState) Success() bool             { return false }
+func (s decodedState) String() string            { return s.status }
+func (s decodedState) UserTime() time.Duration   { return s.user }
+func (s decodedState) SystemTime() time.Duration { return s.system }
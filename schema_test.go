@@ -0,0 +1,100 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestExitErrorJSONRoundTrip(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"))
+	err = execx.WithDetail(err, "attempt", 2)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	b, err := json.Marshal(ee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"schema":2`) {
+		t.Errorf("schema version missing from %s", b)
+	}
+	got := new(execx.ExitError)
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != ee.Path || !reflect.DeepEqual(got.Args, ee.Args) || got.PID != ee.PID {
+		t.Errorf("got %q %q, pid %d, want %q %q, pid %d", got.Path, got.Args, got.PID, ee.Path, ee.Args, ee.PID)
+	}
+	if got.Error() != ee.Error() || got.ExitCode() != 1 || string(got.Stderr) != "whoops" {
+		t.Errorf("got %q, exit code %d, stderr %q", got.Error(), got.ExitCode(), got.Stderr)
+	}
+	if v, _ := got.Detail("attempt"); v != 2.0 {
+		t.Errorf("attempt = %v, want 2", v)
+	}
+	again, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(b) {
+		t.Errorf("representation changed by a round trip:\n%s\n%s", b, again)
+	}
+}
+
+func TestExitErrorJSONForwardCompatible(t *testing.T) {
+	const future = `{"schema":7,"path":"/bin/false","args":["false"],"dir":"/","exit_code":1,` +
+		`"error":"exit status 1","user_time":0,"system_time":0,"env":null,` +
+		`"container":{"id":"c0ffee","image":"alpine"}}`
+	ee := new(execx.ExitError)
+	if err := json.Unmarshal([]byte(future), ee); err != nil {
+		t.Fatal(err)
+	}
+	if ee.ExitCode() != 1 || ee.Cmdline() != "false" {
+		t.Errorf("got exit code %d, command line %q", ee.ExitCode(), ee.Cmdline())
+	}
+	b, err := json.Marshal(ee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if string(m["schema"]) != "7" {
+		t.Errorf("schema = %s, want 7", m["schema"])
+	}
+	if string(m["container"]) != `{"id":"c0ffee","image":"alpine"}` {
+		t.Errorf("unknown field not preserved: %s", b)
+	}
+}
+
+func TestExitErrorJSONUnversioned(t *testing.T) {
+	const old = `{"path":"/bin/false","args":["false"],"dir":"/","exit_code":3,"user_time":0,"system_time":0,"env":null}`
+	ee := new(execx.ExitError)
+	if err := json.Unmarshal([]byte(old), ee); err != nil {
+		t.Fatal(err)
+	}
+	if ee.Error() != "exit status 3" {
+		t.Errorf("got %q, want %q", ee.Error(), "exit status 3")
+	}
+}
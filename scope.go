@@ -0,0 +1,228 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"acln.ro/execx/errcode"
+)
+
+// ErrScopeClosed is returned, wrapped in a *StartError, by Start for
+// commands started within a ProcessScope which was canceled.
+var ErrScopeClosed = newCodedError("execx: process scope closed", errcode.Canceled)
+
+// A ProcessScope groups the commands started on behalf of a request, such
+// as an HTTP request served by a program which runs commands, such that
+// they can be enumerated, canceled and waited for together once the
+// request ends, and such that commands which outlive it are reported,
+// rather than leaked.
+//
+// A ProcessScope is safe for concurrent use by multiple goroutines.
+type ProcessScope struct {
+	id     string
+	cancel context.CancelFunc
+	clock  Clock
+
+	mu       sync.Mutex
+	running  map[*Handle]ScopedCommand
+	canceled bool
+}
+
+// A ScopedCommand is a command started within a ProcessScope.
+type ScopedCommand struct {
+	// Handle is the handle of the command.
+	Handle *Handle
+
+	// PID is the process ID of the command.
+	PID int
+
+	// Cmdline is the command line of the command, as per Cmdline.
+	Cmdline string
+
+	// Started is the time the command started running.
+	Started time.Time
+}
+
+func (c ScopedCommand) String() string {
+	return fmt.Sprintf("pid %d: %s", c.PID, c.Cmdline)
+}
+
+type scopeKey struct{}
+
+// Scope returns a copy of ctx carrying a new ProcessScope identified by id,
+// such as a request ID, and the scope. Commands started using the
+// returned context, or contexts derived from it, belong to the scope. The
+// returned context is canceled when the scope is canceled, or when ctx is
+// done. The caller typically closes the scope when the request ends:
+//
+//	ctx, scope := execx.Scope(r.Context(), requestID)
+//	defer scope.Close(5 * time.Second)
+func Scope(ctx context.Context, id string) (context.Context, *ProcessScope) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &ProcessScope{
+		id:      id,
+		cancel:  cancel,
+		clock:   ClockFrom(ctx),
+		running: make(map[*Handle]ScopedCommand),
+	}
+	return context.WithValue(ctx, scopeKey{}, s), s
+}
+
+// ScopeFrom returns the ProcessScope carried by ctx, or nil if ctx carries
+// none.
+func ScopeFrom(ctx context.Context) *ProcessScope {
+	s, _ := ctx.Value(scopeKey{}).(*ProcessScope)
+	return s
+}
+
+// ID returns the identifier of s.
+func (s *ProcessScope) ID() string {
+	return s.id
+}
+
+// Running returns the commands of s which have not completed yet, in the
+// order in which they started.
+func (s *ProcessScope) Running() []ScopedCommand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmds := make([]ScopedCommand, 0, len(s.running))
+	for h, c := range s.running {
+		select {
+		case <-h.done:
+			// Completed, but not removed yet.
+		default:
+			cmds = append(cmds, c)
+		}
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Started.Before(cmds[j].Started)
+	})
+	return cmds
+}
+
+// Cancel cancels the context of s, which stops the commands of s as if
+// their contexts were canceled, honoring options such as WithGracePeriod.
+// Commands started within s from then on fail to start with a *StartError
+// which wraps ErrScopeClosed. Cancel does not wait for the commands to
+// complete.
+func (s *ProcessScope) Cancel() {
+	s.mu.Lock()
+	s.canceled = true
+	s.mu.Unlock()
+	s.cancel()
+}
+
+// Wait waits for all the commands of s to complete, including those
+// started while Wait waits.
+func (s *ProcessScope) Wait() {
+	for {
+		cmds := s.Running()
+		if len(cmds) == 0 {
+			return
+		}
+		for _, c := range cmds {
+			<-c.Handle.done
+		}
+		s.mu.Lock()
+		for _, c := range cmds {
+			delete(s.running, c.Handle)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Close cancels s, and waits up to timeout for its commands to complete.
+// If some commands are still running by then, such as commands whose
+// output is held open by their descendants, Close returns a *ScopeError
+// which lists them. The timeout is measured by the Clock carried by the
+// context passed to Scope.
+func (s *ProcessScope) Close(timeout time.Duration) error {
+	s.Cancel()
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	t := s.clock.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-t.C():
+	}
+	survivors := s.Running()
+	if len(survivors) == 0 {
+		return nil
+	}
+	return &ScopeError{ID: s.id, Survivors: survivors}
+}
+
+// closed returns an error if s was canceled. It returns nil if s is nil.
+func (s *ProcessScope) closed() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.canceled {
+		return fmt.Errorf("%w: %s", ErrScopeClosed, s.id)
+	}
+	return nil
+}
+
+// add adds h, which started running, to s, until it completes.
+func (s *ProcessScope) add(h *Handle) {
+	h.mu.Lock()
+	started := h.timeline.Running
+	h.mu.Unlock()
+	s.mu.Lock()
+	s.running[h] = ScopedCommand{
+		Handle:  h,
+		PID:     h.cmd.Process.Pid,
+		Cmdline: h.cmdline,
+		Started: started,
+	}
+	s.mu.Unlock()
+	go func() {
+		<-h.done
+		s.mu.Lock()
+		delete(s.running, h)
+		s.mu.Unlock()
+	}()
+}
+
+// A ScopeError reports the commands of a ProcessScope which were still
+// running when the scope was closed.
+type ScopeError struct {
+	// ID is the identifier of the scope.
+	ID string
+
+	// Survivors lists the commands which were still running.
+	Survivors []ScopedCommand
+}
+
+func (e *ScopeError) Error() string {
+	cmds := make([]string, len(e.Survivors))
+	for i, c := range e.Survivors {
+		cmds[i] = c.String()
+	}
+	return fmt.Sprintf("execx: scope %s: %d commands still running: %s", e.ID, len(e.Survivors), strings.Join(cmds, "; "))
+}
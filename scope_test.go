@@ -0,0 +1,124 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+	"acln.ro/execx/exectest"
+)
+
+func TestScope(t *testing.T) {
+	t.Run("Close", testScopeClose)
+	t.Run("Closed", testScopeClosed)
+	t.Run("Survivors", testScopeSurvivors)
+	t.Run("Clock", testScopeClock)
+}
+
+func testScopeClose(t *testing.T) {
+	ctx, scope := execx.Scope(context.Background(), "req-1")
+	if execx.ScopeFrom(ctx) != scope {
+		t.Fatal("scope not carried by its context")
+	}
+	var handles []*execx.Handle
+	for i := 0; i < 2; i++ {
+		h, err := execx.Start(ctx, selfCmd("hang"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		handles = append(handles, h)
+	}
+	if n := len(scope.Running()); n != 2 {
+		t.Fatalf("%d commands running, want 2", n)
+	}
+	if err := scope.Close(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range handles {
+		select {
+		case <-h.Done():
+		default:
+			t.Fatal("command still running after Close")
+		}
+	}
+	if n := len(scope.Running()); n != 0 {
+		t.Errorf("%d commands running after Close, want 0", n)
+	}
+}
+
+func testScopeClosed(t *testing.T) {
+	ctx, scope := execx.Scope(context.Background(), "req-2")
+	scope.Cancel()
+	_, err := execx.Run(ctx, selfCmd("echo"))
+	var se *execx.StartError
+	if !errors.As(err, &se) || !errors.Is(err, execx.ErrScopeClosed) {
+		t.Fatalf("got %v, want *StartError wrapping ErrScopeClosed", err)
+	}
+}
+
+func testScopeSurvivors(t *testing.T) {
+	ctx, scope := execx.Scope(context.Background(), "req-3")
+	// The child exits, but its descendant holds its output open.
+	h, err := execx.Start(ctx, selfCmd("leak-stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	err = scope.Close(100 * time.Millisecond)
+	var serr *execx.ScopeError
+	if !errors.As(err, &serr) {
+		t.Fatalf("got %v, want *ScopeError", err)
+	}
+	if serr.ID != "req-3" || len(serr.Survivors) != 1 || serr.Survivors[0].Handle != h {
+		t.Errorf("got %v, want the leaking command", serr)
+	}
+	scope.Wait()
+}
+
+func testScopeClock(t *testing.T) {
+	clock := exectest.NewFakeClock(epoch)
+	ctx, scope := execx.Scope(execx.WithClock(context.Background(), clock), "req-4")
+	// The command measures its own timers using the system clock, such
+	// that the only timer of the fake clock is that of Close.
+	h, err := execx.Start(execx.WithClock(ctx, execx.SystemClock), selfCmd("leak-stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() { done <- scope.Close(time.Hour) }()
+
+	clock.BlockUntil(1)
+	select {
+	case err := <-done:
+		t.Fatalf("Close returned %v before the timeout elapsed", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	clock.Advance(time.Hour)
+	var serr *execx.ScopeError
+	select {
+	case err := <-done:
+		if !errors.As(err, &serr) || len(serr.Survivors) != 1 || serr.Survivors[0].Handle != h {
+			t.Errorf("got %v, want *ScopeError listing the leaking command", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close did not return once the timeout elapsed")
+	}
+	scope.Wait()
+}
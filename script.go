@@ -0,0 +1,114 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxScriptDetail is the maximum number of bytes of a script's body which
+// are embedded in errors produced by RunScript.
+const maxScriptDetail = 4096
+
+// RunScript writes contents to a temporary executable file, runs it, and
+// removes the file once the script completes.
+//
+// If contents starts with a shebang line, the script is executed directly,
+// honoring the shebang. On Windows, where shebang lines have no meaning to
+// the system, the interpreter named by the shebang line is looked up in
+// $PATH instead. Scripts without a shebang line are run using /bin/sh, or
+// using cmd.exe as a batch file on Windows.
+//
+// If the script fails, the returned *ExitError carries the body of the
+// script, truncated to 4KB, as a detail named "script".
+func RunScript(ctx context.Context, contents string, opts ...Option) (*Result, error) {
+	path, err := writeScript(contents)
+	if err != nil {
+		return nil, err
+	}
+	script := ResourceTrackerFrom(ctx).Track("script", path, removeFunc(path))
+	defer script.Release()
+
+	cmd, err := scriptCommand(path, contents)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts[:len(opts):len(opts)], WithCollectors(scriptCollector(contents)))
+	return Run(ctx, cmd, opts...)
+}
+
+// writeScript writes contents to a temporary file, and returns its path.
+func writeScript(contents string) (string, error) {
+	pattern := "execx-script-*"
+	if _, _, ok := parseShebang(contents); !ok {
+		pattern += scriptExt
+	}
+	f, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(contents); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Chmod(0700); err != nil && !isChmodUnsupported(err) {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// parseShebang parses the shebang line at the start of contents, if any.
+func parseShebang(contents string) (interp string, args []string, ok bool) {
+	if !strings.HasPrefix(contents, "#!") {
+		return "", nil, false
+	}
+	line := contents[2:]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(strings.TrimSuffix(line, "\r"))
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+	return fields[0], fields[1:], true
+}
+
+// scriptCollector returns a collector which attaches the (possibly
+// truncated) body of a script.
+func scriptCollector(contents string) Collector {
+	if len(contents) > maxScriptDetail {
+		// Cut on a rune boundary, such that the detail is valid UTF-8.
+		n := maxScriptDetail
+		for n > 0 && !utf8.RuneStart(contents[n]) {
+			n--
+		}
+		contents = contents[:n] + "\n[truncated]"
+	}
+	return CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "script", contents
+	})
+}
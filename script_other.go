@@ -0,0 +1,38 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build !windows
+// +build !windows
+
+package execx
+
+import "os/exec"
+
+// scriptExt is the extension of scripts without a shebang line.
+const scriptExt = ".sh"
+
+// scriptCommand returns a command which runs the script file: directly
+// if it has a shebang line, or using /bin/sh otherwise.
+func scriptCommand(script, contents string) (*exec.Cmd, error) {
+	if _, _, ok := parseShebang(contents); !ok {
+		return exec.Command("/bin/sh", script), nil
+	}
+	return exec.Command(script), nil
+}
+
+// isChmodUnsupported reports whether err signals that file modes cannot
+// be changed.
+func isChmodUnsupported(err error) bool {
+	return false
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"acln.ro/execx"
+)
+
+func TestRunScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test scripts require a POSIX shell")
+	}
+	t.Run("Shebang", testRunScriptShebang)
+	t.Run("NoShebang", testRunScriptNoShebang)
+	t.Run("Failure", testRunScriptFailure)
+	t.Run("TruncatedUTF8", testRunScriptTruncatedUTF8)
+}
+
+func testRunScriptShebang(t *testing.T) {
+	res, err := execx.RunScript(context.Background(), "#!/bin/sh\necho hello\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Stdout); got != "hello\n" {
+		t.Errorf("got stdout %q, want %q", got, "hello\n")
+	}
+	if _, err := os.Stat(res.Path); !os.IsNotExist(err) {
+		t.Errorf("script file was not removed")
+	}
+}
+
+func testRunScriptNoShebang(t *testing.T) {
+	res, err := execx.RunScript(context.Background(), "echo hello\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(res.Stdout); got != "hello\n" {
+		t.Errorf("got stdout %q, want %q", got, "hello\n")
+	}
+}
+
+func testRunScriptFailure(t *testing.T) {
+	script := "#!/bin/sh\necho oops >&2\nexit 3\n" + strings.Repeat("#", 8192)
+	_, err := execx.RunScript(context.Background(), script)
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	if ee.ExitCode() != 3 {
+		t.Errorf("got exit code %d, want 3", ee.ExitCode())
+	}
+	body, _ := ee.Fields()["script"].(string)
+	if !strings.HasPrefix(body, "#!/bin/sh\necho oops") {
+		t.Errorf("script body not attached to error")
+	}
+	if len(body) >= len(script) {
+		t.Errorf("script body not truncated")
+	}
+}
+
+func testRunScriptTruncatedUTF8(t *testing.T) {
+	// The odd-length prefix puts the truncation point in the middle of
+	// a two-byte rune.
+	script := "#!/bin/sh\nexit 3\n# " + strings.Repeat("é", 4096)
+	_, err := execx.RunScript(context.Background(), script)
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	body, _ := ee.Fields()["script"].(string)
+	if !strings.HasSuffix(body, "é\n[truncated]") {
+		t.Errorf("script body not truncated after a whole rune")
+	}
+	if !utf8.ValidString(body) {
+		t.Errorf("truncated script body is not valid UTF-8")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// scriptExt is the extension of scripts without a shebang line.
+const scriptExt = ".bat"
+
+// scriptCommand returns a command which runs the script file. Since
+// Windows does not honor shebang lines, scriptCommand looks up the
+// interpreter named by the shebang line by its base name, skipping over
+// /usr/bin/env if necessary.
+func scriptCommand(script, contents string) (*exec.Cmd, error) {
+	interp, args, ok := parseShebang(contents)
+	if !ok {
+		return exec.Command("cmd.exe", "/c", script), nil
+	}
+	name := path.Base(strings.Replace(interp, `\`, "/", -1))
+	if name == "env" && len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	exe, err := exec.LookPath(name)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, script)
+	return exec.Command(exe, args...), nil
+}
+
+// isChmodUnsupported reports whether err signals that file modes cannot
+// be changed, which is the case for some file systems on Windows.
+func isChmodUnsupported(err error) bool {
+	return true
+}
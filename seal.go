@@ -0,0 +1,263 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Magic numbers which identify sealed data.
+var (
+	sealedMagic = []byte("EXS1") // a single sealed message
+	streamMagic = []byte("EXW1") // a sealed stream
+)
+
+// sealChunkSize is the size of the chunks in which sealed streams are
+// written.
+const sealChunkSize = 64 * 1024
+
+// ErrSealed is returned, possibly wrapped, when data sealed by a Sealer
+// cannot be opened: it was not sealed, it was sealed using a different
+// key, or it was tampered with or truncated.
+var ErrSealed = errors.New("execx: cannot open sealed data")
+
+// A Sealer encrypts data which execx stores at rest, such as cassettes and
+// command histories, which may hold the output, the arguments and the
+// environment of commands, using AES-GCM with a key supplied by the
+// caller, such that sensitive data is not stored in plaintext on shared
+// machines, such as CI runners. Sealed data is authenticated: data which
+// was tampered with, or sealed using another key, cannot be opened.
+//
+// A Sealer is safe for concurrent use by multiple goroutines.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer returns a Sealer which uses key, which must be 16, 24 or 32
+// bytes long, to select AES-128, AES-192 or AES-256. Keys should be
+// generated randomly, and kept out of the data they protect.
+func NewSealer(key []byte) (*Sealer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("execx: sealer: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("execx: sealer: %v", err)
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts and authenticates plaintext, and returns the result.
+func (s *Sealer) Seal(plaintext []byte) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic("execx: reading random nonce: " + err.Error())
+	}
+	out := append(append([]byte(nil), sealedMagic...), nonce...)
+	return s.aead.Seal(out, nonce, plaintext, sealedMagic)
+}
+
+// Open authenticates and decrypts data sealed by Seal. If data cannot be
+// opened, Open returns an error which wraps ErrSealed.
+func (s *Sealer) Open(sealed []byte) ([]byte, error) {
+	if !IsSealed(sealed) || len(sealed) < len(sealedMagic)+s.aead.NonceSize() {
+		return nil, fmt.Errorf("%w: not sealed", ErrSealed)
+	}
+	sealed = sealed[len(sealedMagic):]
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, sealedMagic)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSealed, err)
+	}
+	return plaintext, nil
+}
+
+// IsSealed reports whether data looks like it was sealed by Seal.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, sealedMagic)
+}
+
+// NewWriter returns a writer which seals the data written to it, and
+// writes it to w, in chunks, such that long streams, such as logs and
+// transcripts, can be sealed without holding them in memory. The caller
+// must call Close, which writes the final chunk, but does not close w.
+// Streams which were not closed are reported as truncated by NewReader.
+func (s *Sealer) NewWriter(w io.Writer) io.WriteCloser {
+	return &sealWriter{s: s, w: w}
+}
+
+// NewReader returns a reader which opens the stream written by the writer
+// returned by NewWriter, read from r. If the stream cannot be opened, or
+// was truncated, Read returns an error which wraps ErrSealed.
+func (s *Sealer) NewReader(r io.Reader) io.Reader {
+	return &sealReader{s: s, r: r}
+}
+
+// streamNonce returns the nonce of the chunk with the specified index in
+// the stream with the specified prefix.
+func (s *Sealer) streamNonce(prefix []byte, index uint32) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(nonce)-4:], index)
+	return nonce
+}
+
+// chunkAD returns the additional data of a chunk, which marks the last
+// chunk in a stream, such that truncation is detected.
+func chunkAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// sealWriter is the writer returned by Sealer.NewWriter.
+type sealWriter struct {
+	s      *Sealer
+	w      io.Writer
+	prefix []byte // random nonce prefix, set once the header is written
+	index  uint32
+	buf    []byte
+	err    error
+	closed bool
+}
+
+func (sw *sealWriter) Write(p []byte) (int, error) {
+	if sw.closed {
+		return 0, errors.New("execx: write to closed sealed stream")
+	}
+	n := len(p)
+	for len(p) > 0 && sw.err == nil {
+		room := sealChunkSize - len(sw.buf)
+		if room > len(p) {
+			room = len(p)
+		}
+		sw.buf = append(sw.buf, p[:room]...)
+		p = p[room:]
+		if len(sw.buf) == sealChunkSize {
+			sw.flush(false)
+		}
+	}
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	return n, nil
+}
+
+// Close writes the final chunk.
+func (sw *sealWriter) Close() error {
+	if sw.closed {
+		return sw.err
+	}
+	sw.closed = true
+	if sw.err == nil {
+		sw.flush(true)
+	}
+	return sw.err
+}
+
+// flush seals and writes the buffered data as a chunk.
+func (sw *sealWriter) flush(last bool) {
+	if sw.prefix == nil {
+		sw.prefix = make([]byte, sw.s.aead.NonceSize()-4)
+		if _, err := rand.Read(sw.prefix); err != nil {
+			sw.err = err
+			return
+		}
+		if _, err := sw.w.Write(append(append([]byte(nil), streamMagic...), sw.prefix...)); err != nil {
+			sw.err = err
+			return
+		}
+	}
+	nonce := sw.s.streamNonce(sw.prefix, sw.index)
+	sw.index++
+	chunk := sw.s.aead.Seal(make([]byte, 4), nonce, sw.buf, chunkAD(last))
+	binary.BigEndian.PutUint32(chunk, uint32(len(chunk)-4))
+	if _, err := sw.w.Write(chunk); err != nil {
+		sw.err = err
+	}
+	sw.buf = sw.buf[:0]
+}
+
+// sealReader is the reader returned by Sealer.NewReader.
+type sealReader struct {
+	s      *Sealer
+	r      io.Reader
+	prefix []byte
+	index  uint32
+	buf    []byte // opened data not yet read
+	done   bool   // the last chunk was opened
+	err    error
+}
+
+func (sr *sealReader) Read(p []byte) (int, error) {
+	for len(sr.buf) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		if sr.done {
+			return 0, io.EOF
+		}
+		sr.err = sr.next()
+	}
+	n := copy(p, sr.buf)
+	sr.buf = sr.buf[n:]
+	return n, nil
+}
+
+// next reads and opens the next chunk.
+func (sr *sealReader) next() error {
+	if sr.prefix == nil {
+		header := make([]byte, len(streamMagic)+sr.s.aead.NonceSize()-4)
+		if _, err := io.ReadFull(sr.r, header); err != nil {
+			return fmt.Errorf("%w: reading header: %v", ErrSealed, err)
+		}
+		if !bytes.HasPrefix(header, streamMagic) {
+			return fmt.Errorf("%w: not a sealed stream", ErrSealed)
+		}
+		sr.prefix = header[len(streamMagic):]
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(sr.r, size[:]); err != nil {
+		return fmt.Errorf("%w: truncated stream", ErrSealed)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > sealChunkSize+uint32(sr.s.aead.Overhead()) {
+		return fmt.Errorf("%w: chunk too large", ErrSealed)
+	}
+	chunk := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, chunk); err != nil {
+		return fmt.Errorf("%w: truncated stream", ErrSealed)
+	}
+	nonce := sr.s.streamNonce(sr.prefix, sr.index)
+	sr.index++
+	for _, last := range []bool{false, true} {
+		plaintext, err := sr.s.aead.Open(nil, nonce, chunk, chunkAD(last))
+		if err == nil {
+			sr.buf = plaintext
+			sr.done = last
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: chunk %d failed authentication", ErrSealed, sr.index-1)
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestSealer(t *testing.T) {
+	s := newSealer(t, 1)
+	sealed := s.Seal([]byte("hunter2"))
+	if bytes.Contains(sealed, []byte("hunter2")) || !execx.IsSealed(sealed) {
+		t.Fatalf("got %q", sealed)
+	}
+	got, err := s.Open(sealed)
+	if err != nil || string(got) != "hunter2" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if _, err := newSealer(t, 2).Open(sealed); !errors.Is(err, execx.ErrSealed) {
+		t.Errorf("opened with the wrong key: %v", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := s.Open(sealed); !errors.Is(err, execx.ErrSealed) {
+		t.Errorf("opened tampered data: %v", err)
+	}
+	if _, err := execx.NewSealer([]byte("short")); err == nil {
+		t.Error("accepted a short key")
+	}
+}
+
+func TestSealerStream(t *testing.T) {
+	s := newSealer(t, 1)
+	want := bytes.Repeat([]byte("TOKEN=hunter2\n"), 10000)
+	var buf bytes.Buffer
+	w := s.NewWriter(&buf)
+	if _, err := w.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("hunter2")) {
+		t.Fatal("plaintext in sealed stream")
+	}
+	got, err := ioutil.ReadAll(s.NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+
+	// Drop the final chunk: the truncation must be detected.
+	truncated := buf.Bytes()[:buf.Len()/2]
+	if _, err := io.Copy(ioutil.Discard, s.NewReader(bytes.NewReader(truncated))); !errors.Is(err, execx.ErrSealed) {
+		t.Errorf("read truncated stream: %v", err)
+	}
+}
+
+func TestSealedCassette(t *testing.T) {
+	path := filepath.Join(tempDir(t), "cassette.sealed")
+	s := newSealer(t, 1)
+	rec, err := execx.NewSealedCassette(path, execx.CassetteRecord, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := cassetteCmd("echo")
+	echo.Stdin = strings.NewReader("hunter2")
+	if _, err := execx.Run(execx.WithRunner(context.Background(), rec), echo); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("hunter2")) {
+		t.Fatal("plaintext output in sealed cassette")
+	}
+	if _, err := execx.NewCassette(path, execx.CassetteReplay); err == nil {
+		t.Error("replayed sealed cassette without a Sealer")
+	}
+	play, err := execx.NewSealedCassette(path, execx.CassetteReplay, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := execx.Run(execx.WithRunner(context.Background(), play), cassetteCmd("echo"))
+	if err != nil || string(res.Stdout) != "hunter2" {
+		t.Fatalf("got %v, %v", res, err)
+	}
+}
+
+func TestSealedHistory(t *testing.T) {
+	hdb := new(historyDB)
+	db := sql.OpenDB(hdb)
+	defer db.Close()
+	h, err := execx.NewHistory(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Sealer = newSealer(t, 1)
+	h.OnError = func(err error) { t.Error(err) }
+	ctx := execx.WithRunner(context.Background(), h)
+	if _, err := execx.Run(ctx, selfCmd("on")); err == nil {
+		t.Fatal("command did not fail")
+	}
+	for _, v := range hdb.rows[0] {
+		if s, ok := v.(string); ok && strings.Contains(s, "exit status") {
+			t.Fatalf("plaintext error in sealed history: %q", s)
+		}
+	}
+	runs, err := h.Slowest(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || !strings.Contains(runs[0].Err, "exit status 1") || len(runs[0].Args) == 0 {
+		t.Fatalf("got %+v", runs)
+	}
+	h.Sealer = nil
+	if _, err := h.Slowest(context.Background(), 1); !errors.Is(err, execx.ErrSealed) {
+		t.Errorf("read sealed history without a Sealer: %v", err)
+	}
+}
+
+// newSealer returns a Sealer whose key is derived from seed.
+func newSealer(t *testing.T, seed byte) *execx.Sealer {
+	s, err := execx.NewSealer(bytes.Repeat([]byte{seed}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SelfEnv names the environment variable which marks the copies of the
+// current program started by Self and SelfCommand.
+const SelfEnv = "EXECX_SELF"
+
+// IsSelf reports whether the current process is a copy of its parent,
+// started by Self or SelfCommand. Programs which re-execute themselves
+// typically check IsSelf at the beginning of their main function.
+func IsSelf() bool {
+	return os.Getenv(SelfEnv) == "1"
+}
+
+// SelfFile returns the i-th file handed off to the current process, a
+// copy started by Self or SelfCommand, using WithExtraFiles, or nil if
+// the current process was not started that way. name is used as the
+// name of the file.
+func SelfFile(i int, name string) *os.File {
+	if !IsSelf() || i < 0 {
+		return nil
+	}
+	return os.NewFile(uintptr(3+i), name)
+}
+
+// Executable returns the path of the executable of the current process,
+// with symbolic links resolved, such that it can be executed again. Unlike
+// os.Args[0], it does not depend on how the program was invoked, or on
+// the working directory.
+func Executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return exe, nil
+}
+
+// SelfCommand returns a command which runs a copy of the current program,
+// as found by Executable, with the arguments args, and with SelfEnv set
+// in its environment.
+func SelfCommand(args ...string) (*exec.Cmd, error) {
+	exe, err := Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), SelfEnv+"=1")
+	return cmd, nil
+}
+
+// Self runs a copy of the current program, as per SelfCommand and Run,
+// such as in order to perform privilege or namespace transitions, which
+// are only possible at process creation, using options such as AsUser or
+// WithoutNetwork. Files are handed off to the copy using WithExtraFiles.
+//
+// If the copy fails, Self returns a *SelfError which wraps the error,
+// such that failures of the program itself are distinguished from those
+// of the commands it runs.
+func Self(ctx context.Context, args []string, opts ...Option) (*Result, error) {
+	cmd, err := SelfCommand(args...)
+	if err != nil {
+		return nil, &SelfError{Args: args, Err: err}
+	}
+	res, err := Run(ctx, cmd, opts...)
+	if err != nil {
+		err = &SelfError{Args: args, Err: err}
+	}
+	return res, err
+}
+
+// A SelfError records the failure of a copy of the current program
+// started by Self. Err is usually an *ExitError or a *StartError.
+type SelfError struct {
+	// Args holds the arguments passed to the copy, excluding the name
+	// of the program.
+	Args []string
+
+	Err error
+}
+
+func (e *SelfError) Error() string {
+	if len(e.Args) == 0 {
+		return fmt.Sprintf("execx: re-executed self: %v", e.Err)
+	}
+	return fmt.Sprintf("execx: re-executed self %s: %v", strings.Join(e.Args, " "), e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *SelfError) Unwrap() error {
+	return e.Err
+}
+
+// WithExtraFiles hands off files to the command, in addition to those in
+// cmd.ExtraFiles, as per exec.Cmd.ExtraFiles. The i-th file becomes file
+// descriptor 3+i+len(cmd.ExtraFiles) in the child process. It is not
+// supported on Windows.
+func WithExtraFiles(files ...*os.File) Option {
+	return func(cfg *config) {
+		cfg.extraFiles = append(cfg.extraFiles, files...)
+	}
+}
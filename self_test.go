@@ -0,0 +1,75 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestSelf(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("extra files are not supported on Windows")
+	}
+	t.Run("ExtraFiles", testSelfExtraFiles)
+	t.Run("Failure", testSelfFailure)
+}
+
+func testSelfExtraFiles(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	_, err = execx.Self(context.Background(), []string{"hello"},
+		execx.WithEnv("EXECX_TEST", "self"),
+		execx.WithExtraFiles(w))
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("got %q through handed off file, want %q", got, "hello")
+	}
+}
+
+func testSelfFailure(t *testing.T) {
+	_, err := execx.Self(context.Background(), []string{"fail"}, execx.WithEnv("EXECX_TEST", "self"))
+	var se *execx.SelfError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want *SelfError", err)
+	}
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) || ee.ExitCode() != 1 {
+		t.Fatalf("got %v, want *ExitError with exit code 1", err)
+	}
+	exe, err := execx.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ee.Path != exe {
+		t.Errorf("ran %q, want %q", ee.Path, exe)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Fingerprint returns a string which identifies the invocation described
+// by cmd: its path, arguments, working directory and environment.
+// Commands with equal fingerprints are expected to behave identically,
+// unless they have side effects, or their standard input differs.
+func Fingerprint(cmd *exec.Cmd) string {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(strconv.Itoa(len(s))))
+		h.Write([]byte{':'})
+		h.Write([]byte(s))
+	}
+	write(cmd.Path)
+	for _, arg := range cmd.Args {
+		write(arg)
+	}
+	h.Write([]byte{0})
+	write(cmd.Dir)
+	if cmd.Env == nil {
+		h.Write([]byte{0})
+	} else {
+		for _, kv := range cmd.Env {
+			write(kv)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WithoutDedup opts the command out of deduplication by a Group. It must
+// be used for commands which have side effects.
+func WithoutDedup() Option {
+	return func(cfg *config) {
+		cfg.noDedup = true
+	}
+}
+
+// A Group is a Runner which deduplicates concurrent identical invocations.
+// While a command runs, other commands with the same Fingerprint do not
+// start processes of their own, but wait for the first command to
+// complete, and share its *Result and error. The shared values must not
+// be modified.
+//
+// Only commands whose standard input, standard output and standard error
+// are nil, and which are run without options, are deduplicated. Options
+// such as InDir, WithEnv, WithTimeout or WithStdoutWriters change the
+// command, how its outcome is judged, or who consumes its output, none of
+// which are part of the Fingerprint, so commands configured with options,
+// including WithoutDedup, are run independently. Deduplicated commands run
+// under a context which carries the values of the context of the first
+// caller, and which is canceled once all the callers waiting for the
+// command have given up on it, as per GroupMember.Cancel.
+//
+// The zero value is a Group which runs commands using Local.
+type Group struct {
+	// Runner runs the commands. If Runner is nil, Local is used.
+	Runner Runner
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// call is an in-flight or completed invocation of a command by a Group.
+type call struct {
+	key    string // fingerprint, if the call is deduplicated
+	cancel context.CancelFunc
+	done   chan struct{}
+	res    *Result
+	err    error
+
+	members int    // members waiting for the call, guarded by Group.mu
+	reason  Reason // why all members gave up on the call, guarded by Group.mu
+}
+
+// A GroupMember is a caller of Group.Start, which shares the invocation
+// of its command with the members which started identical commands.
+type GroupMember struct {
+	g      *Group
+	c      *call
+	cmd    *exec.Cmd
+	cancel chan struct{}
+	once   sync.Once
+	done   chan struct{}
+	res    *Result
+	err    error
+}
+
+// Run runs cmd, or waits for an identical command which is already running,
+// and returns its results. If ctx is done before the command completes,
+// Run returns, as per GroupMember.Cancel.
+func (g *Group) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	return g.Start(ctx, cmd, opts...).Wait()
+}
+
+// Start starts cmd, or joins an identical command which is already
+// running, and returns a handle to the invocation, which can be waited for,
+// or canceled without affecting the other members waiting for it. If ctx
+// is canceled before the command completes, the member is canceled. If
+// the deadline of ctx expires first, the member gives up on the command,
+// and Wait returns context.DeadlineExceeded, unless the command is
+// stopped because no other members are waiting for it.
+func (g *Group) Start(ctx context.Context, cmd *exec.Cmd, opts ...Option) *GroupMember {
+	r := g.Runner
+	if r == nil {
+		r = Local
+	}
+	m := &GroupMember{g: g, cmd: cmd, cancel: make(chan struct{}), done: make(chan struct{})}
+	key := ""
+	if dedupable(cmd, newConfig(opts)) {
+		key = Fingerprint(cmd)
+	}
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok && key != "" {
+		c.members++
+		m.c = c
+		g.mu.Unlock()
+		go m.wait(ctx)
+		return m
+	}
+	cctx, cancel := context.WithCancel(valuesOnly{ctx})
+	m.c = &call{key: key, cancel: cancel, done: make(chan struct{}), members: 1}
+	if key != "" {
+		if g.calls == nil {
+			g.calls = make(map[string]*call)
+		}
+		g.calls[key] = m.c
+	}
+	g.mu.Unlock()
+	go g.run(cctx, m.c, r, cmd, opts)
+	go m.wait(ctx)
+	return m
+}
+
+// run runs the command of c.
+func (g *Group) run(ctx context.Context, c *call, r Runner, cmd *exec.Cmd, opts []Option) {
+	res, err := r.Run(ctx, cmd, opts...)
+	c.cancel()
+	g.mu.Lock()
+	if c.key != "" && g.calls[c.key] == c {
+		delete(g.calls, c.key)
+	}
+	// The context of the call was canceled on behalf of the members.
+	if ee, ok := err.(*ExitError); ok && c.reason != ReasonNone && (ee.Reason == ReasonNone || ee.Reason == ReasonCanceledByCaller) {
+		ee.Reason = c.reason
+	}
+	g.mu.Unlock()
+	c.res, c.err = res, err
+	close(c.done)
+}
+
+// wait waits for the call of m to complete, or for m to be canceled.
+func (m *GroupMember) wait(ctx context.Context) {
+	defer close(m.done)
+	select {
+	case <-m.c.done:
+		m.res, m.err = m.c.res, m.c.err
+		return
+	case <-ctx.Done():
+	case <-m.cancel:
+	}
+	// A member whose deadline expired was not canceled by its caller.
+	byCaller := ctx.Err() != context.DeadlineExceeded
+	g, c := m.g, m.c
+	g.mu.Lock()
+	c.members--
+	last := c.members == 0
+	if last {
+		c.reason = ReasonCanceledByCaller
+		if !byCaller {
+			c.reason = ReasonTimedOut
+		}
+		if c.key != "" && g.calls[c.key] == c {
+			// Identical commands started from now on must not
+			// join the call which is being canceled.
+			delete(g.calls, c.key)
+		}
+	}
+	g.mu.Unlock()
+	if last {
+		c.cancel()
+		<-c.done
+		m.res, m.err = c.res, c.err
+		return
+	}
+	if !byCaller {
+		m.err = ctx.Err()
+		return
+	}
+	ee := &ExitError{
+		ExitError: &exec.ExitError{},
+		Path:      m.cmd.Path,
+		Args:      m.cmd.Args,
+		Reason:    ReasonCanceledByCaller,
+	}
+	ee.Dir, ee.ParentEnv, ee.ChildEnv = describe(m.cmd)
+	m.err = ee
+}
+
+// Cancel cancels m. If other members are waiting for the same invocation,
+// the command keeps running for their sake, and Wait returns an
+// *ExitError without a process state, whose Reason is
+// ReasonCanceledByCaller. Otherwise, the command is canceled, as if its
+// context was canceled, and Wait returns the error it fails with, whose
+// Reason is ReasonCanceledByCaller, unless a more specific reason is
+// known. Cancel does nothing if the command completed already.
+func (m *GroupMember) Cancel() {
+	m.once.Do(func() { close(m.cancel) })
+}
+
+// Wait waits for the command of m to complete, or for m to be canceled,
+// and returns its results, which are shared with the other members.
+func (m *GroupMember) Wait() (*Result, error) {
+	<-m.done
+	return m.res, m.err
+}
+
+// Done returns a channel which is closed when Wait would return.
+func (m *GroupMember) Done() <-chan struct{} {
+	return m.done
+}
+
+// valuesOnly is a context which carries the values of its parent, but is
+// never done.
+type valuesOnly struct {
+	context.Context
+}
+
+func (valuesOnly) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valuesOnly) Done() <-chan struct{}       { return nil }
+func (valuesOnly) Err() error                  { return nil }
+
+// dedupable reports whether cmd, configured by cfg, may share its results
+// with identical commands.
+func dedupable(cmd *exec.Cmd, cfg *config) bool {
+	if cmd.Stdin != nil || cmd.Stdout != nil || cmd.Stderr != nil {
+		return false
+	}
+	// Options are not part of the fingerprint, and most of them change
+	// the command or its outcome, or belong to one caller.
+	return reflect.DeepEqual(*cfg, config{})
+}
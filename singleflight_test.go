@@ -0,0 +1,217 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestFingerprint(t *testing.T) {
+	a := exec.Command("git", "rev-parse", "HEAD")
+	b := exec.Command("git", "rev-parse", "HEAD")
+	if execx.Fingerprint(a) != execx.Fingerprint(b) {
+		t.Fatal("identical commands have different fingerprints")
+	}
+	b.Dir = "/elsewhere"
+	if execx.Fingerprint(a) == execx.Fingerprint(b) {
+		t.Fatal("commands in different directories have equal fingerprints")
+	}
+	c := exec.Command("git", "rev-parse HEAD")
+	if execx.Fingerprint(a) == execx.Fingerprint(c) {
+		t.Fatal("commands with different arguments have equal fingerprints")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	t.Run("Dedup", testGroupDedup)
+	t.Run("WithoutDedup", testGroupWithoutDedup)
+	t.Run("DistinctOptions", testGroupDistinctOptions)
+	t.Run("DistinctDirs", testGroupDistinctDirs)
+	t.Run("CancelMember", testGroupCancelMember)
+	t.Run("CancelLastMember", testGroupCancelLastMember)
+}
+
+// delayingRunner counts the commands it runs, and delays them, such that
+// concurrent identical commands overlap.
+func delayingRunner(n *int32) execx.Runner {
+	return execx.RunnerFunc(func(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+		atomic.AddInt32(n, 1)
+		time.Sleep(100 * time.Millisecond)
+		return execx.Local.Run(ctx, cmd, opts...)
+	})
+}
+
+func runConcurrently(g *execx.Group, n int, opts ...execx.Option) []*execx.Result {
+	results := make([]*execx.Result, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = g.Run(context.Background(), selfCmd("echo"), opts...)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+func testGroupDedup(t *testing.T) {
+	var n int32
+	g := &execx.Group{Runner: delayingRunner(&n)}
+	results := runConcurrently(g, 5)
+	if n != 1 {
+		t.Errorf("ran %d processes, want 1", n)
+	}
+	for _, res := range results[1:] {
+		if res != results[0] {
+			t.Fatalf("results not shared")
+		}
+	}
+}
+
+func testGroupWithoutDedup(t *testing.T) {
+	var n int32
+	g := &execx.Group{Runner: delayingRunner(&n)}
+	runConcurrently(g, 5, execx.WithoutDedup())
+	if n != 5 {
+		t.Errorf("ran %d processes, want 5", n)
+	}
+}
+
+func testGroupDistinctOptions(t *testing.T) {
+	var n int32
+	g := &execx.Group{Runner: delayingRunner(&n)}
+	fsys := fstest.MapFS{
+		"a": &fstest.MapFile{Data: []byte("AAA")},
+		"b": &fstest.MapFile{Data: []byte("BBB")},
+	}
+	var bufs [2]bytes.Buffer
+	var results [2]*execx.Result
+	var wg sync.WaitGroup
+	for i, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i], _ = g.Run(context.Background(), selfCmd("echo"),
+				execx.WithStdinFS(fsys, name), execx.WithStdoutWriters(&bufs[i]))
+		}(i, name)
+	}
+	wg.Wait()
+	if n != 2 {
+		t.Errorf("ran %d processes, want 2", n)
+	}
+	for i, want := range []string{"AAA", "BBB"} {
+		if got := string(results[i].Stdout); got != want {
+			t.Errorf("member %d: stdout = %q, want %q", i, got, want)
+		}
+		if got := bufs[i].String(); got != want {
+			t.Errorf("member %d: writer got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func testGroupDistinctDirs(t *testing.T) {
+	var n int32
+	g := &execx.Group{Runner: delayingRunner(&n)}
+	dirs := []string{t.TempDir(), t.TempDir()}
+	var results [2]*execx.Result
+	var wg sync.WaitGroup
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			results[i], _ = g.Run(context.Background(), selfCmd("pwd"), execx.InDir(dir))
+		}(i, dir)
+	}
+	wg.Wait()
+	if n != 2 {
+		t.Errorf("ran %d processes, want 2", n)
+	}
+	for i, dir := range dirs {
+		if results[i] == nil {
+			t.Fatalf("member %d: no result", i)
+		}
+		want, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(results[i].Stdout); got != want {
+			t.Errorf("member %d: stdout = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func testGroupCancelMember(t *testing.T) {
+	var n int32
+	g := &execx.Group{Runner: delayingRunner(&n)}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	a := g.Start(ctx, selfCmd("hang"))
+	b := g.Start(ctx, selfCmd("hang"))
+	a.Cancel()
+	_, err := a.Wait()
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Reason != execx.ReasonCanceledByCaller {
+		t.Errorf("got reason %q, want %q", ee.Reason, execx.ReasonCanceledByCaller)
+	}
+	select {
+	case <-b.Done():
+		t.Fatal("canceling one member canceled the others")
+	case <-time.After(200 * time.Millisecond):
+	}
+	_, err = b.Wait()
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Reason != execx.ReasonTimedOut {
+		t.Errorf("member whose deadline expired has reason %q, want %q", ee.Reason, execx.ReasonTimedOut)
+	}
+	if n != 1 {
+		t.Errorf("ran %d processes, want 1", n)
+	}
+}
+
+func testGroupCancelLastMember(t *testing.T) {
+	var n int32
+	g := &execx.Group{Runner: delayingRunner(&n)}
+	m := g.Start(context.Background(), selfCmd("hang"))
+	time.Sleep(200 * time.Millisecond)
+	m.Cancel()
+	res, err := m.Wait()
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Reason != execx.ReasonCanceledByCaller {
+		t.Errorf("got reason %q, want %q", ee.Reason, execx.ReasonCanceledByCaller)
+	}
+	if res == nil || res.ExitCode != -1 {
+		t.Errorf("got result %v, want the result of the killed process", res)
+	}
+}
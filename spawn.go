@@ -0,0 +1,79 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import "strings"
+
+// SpawnFlags control how a process is detached from the current process,
+// its console, and its process group. They map to the mechanism
+// appropriate for each platform.
+type SpawnFlags int
+
+// Known spawn flags.
+const (
+	// HideWindow prevents a console window from being created for
+	// the process. On Windows, it maps to CREATE_NO_WINDOW, and hides
+	// the main window of the process. It has no effect elsewhere.
+	HideWindow SpawnFlags = 1 << iota
+
+	// NewProcessGroup starts the process in a new process group, such
+	// that signals sent to the group of the current process, such as
+	// those generated by Ctrl-C in a terminal, do not reach it. On
+	// Windows, it maps to CREATE_NEW_PROCESS_GROUP, which also enables
+	// Terminate to send CTRL_BREAK_EVENT. On Unix, it maps to Setpgid.
+	NewProcessGroup
+
+	// Detached detaches the process from the console or terminal of the
+	// current process. On Windows, it maps to DETACHED_PROCESS. On Unix,
+	// it maps to Setsid, which also starts a new process group.
+	Detached
+)
+
+// String returns the names of the flags set in f, separated by "|".
+func (f SpawnFlags) String() string {
+	var names []string
+	for _, flag := range []struct {
+		f    SpawnFlags
+		name string
+	}{
+		{HideWindow, "HideWindow"},
+		{NewProcessGroup, "NewProcessGroup"},
+		{Detached, "Detached"},
+	} {
+		if f&flag.f != 0 {
+			names = append(names, flag.name)
+		}
+	}
+	if len(names) == 0 {
+		return "0"
+	}
+	return strings.Join(names, "|")
+}
+
+// WithSpawnFlags starts the command with the specified flags, which
+// configure cmd.SysProcAttr accordingly. For example, GUI applications
+// which spawn console helpers on Windows can use
+//
+//	WithSpawnFlags(HideWindow)
+//
+// to prevent console windows from flashing on the screen. The same
+// options work, or are ignored if not applicable, on other platforms.
+// If the flags cannot be honored on this platform, Start returns a
+// *StartError.
+func WithSpawnFlags(f SpawnFlags) Option {
+	return func(cfg *config) {
+		cfg.spawn |= f
+	}
+}
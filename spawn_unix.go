@@ -0,0 +1,44 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// applySpawnFlags configures cmd to start as per f.
+func applySpawnFlags(cmd *exec.Cmd, f SpawnFlags) error {
+	if f&(NewProcessGroup|Detached) == 0 {
+		return nil
+	}
+	attr := new(syscall.SysProcAttr)
+	if cmd.SysProcAttr != nil {
+		attr = copySysProcAttr(cmd.SysProcAttr)
+	}
+	cmd.SysProcAttr = attr
+	if f&Detached != 0 {
+		// A session leader cannot change its process group, and
+		// setsid starts a new one anyway.
+		attr.Setsid = true
+		attr.Setpgid = false
+		return nil
+	}
+	attr.Setpgid = true
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithSpawnFlags(t *testing.T) {
+	for _, flags := range []execx.SpawnFlags{
+		execx.NewProcessGroup,
+		execx.Detached,
+		execx.HideWindow | execx.NewProcessGroup | execx.Detached,
+	} {
+		t.Run(flags.String(), func(t *testing.T) {
+			cmd := selfCmd("on")
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+			_, err := execx.Run(context.Background(), cmd, execx.WithSpawnFlags(flags))
+			var ee *execx.ExitError
+			if !errors.As(err, &ee) {
+				t.Fatalf("got %v, want *ExitError", err)
+			}
+			if ee.PGID != ee.PID {
+				t.Errorf("got pgid %d, want %d", ee.PGID, ee.PID)
+			}
+			if ee.PGID == syscall.Getpgrp() {
+				t.Errorf("process started in the process group of the parent")
+			}
+		})
+	}
+}
+
+func TestWithSpawnFlagsHideWindow(t *testing.T) {
+	cmd := selfCmd("on")
+	_, err := execx.Run(context.Background(), cmd, execx.WithSpawnFlags(execx.HideWindow))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.PGID != syscall.Getpgrp() {
+		t.Errorf("HideWindow changed the process group: got %d, want %d", ee.PGID, syscall.Getpgrp())
+	}
+}
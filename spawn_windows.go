@@ -0,0 +1,51 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+const (
+	createNoWindow  = 0x08000000
+	detachedProcess = 0x00000008
+)
+
+// applySpawnFlags configures cmd to start as per f.
+func applySpawnFlags(cmd *exec.Cmd, f SpawnFlags) error {
+	if f == 0 {
+		return nil
+	}
+	attr := new(syscall.SysProcAttr)
+	if cmd.SysProcAttr != nil {
+		attr = copySysProcAttr(cmd.SysProcAttr)
+	}
+	cmd.SysProcAttr = attr
+	if f&HideWindow != 0 {
+		attr.HideWindow = true
+		attr.CreationFlags |= createNoWindow
+	}
+	if f&NewProcessGroup != 0 {
+		attr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+	}
+	if f&Detached != 0 {
+		// DETACHED_PROCESS and CREATE_NO_WINDOW are mutually
+		// exclusive: a detached process has no console at all.
+		attr.CreationFlags &^= createNoWindow
+		attr.CreationFlags |= detachedProcess
+	}
+	return nil
+}
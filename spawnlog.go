@@ -0,0 +1,187 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A LogLevel is the importance of a SpawnRecord. The values match those
+// of the levels in package log/slog.
+type LogLevel int
+
+// Log levels.
+const (
+	LevelDebug LogLevel = -4
+	LevelInfo  LogLevel = 0
+	LevelWarn  LogLevel = 4
+	LevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
+
+// ParseLogLevel parses the name of a log level, such as "debug" or
+// "WARN", as found in configuration files or command line flags.
+func ParseLogLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("execx: unknown log level %q", s)
+	}
+}
+
+// A SpawnEvent identifies the kind of a SpawnRecord.
+type SpawnEvent int
+
+// Spawn events.
+const (
+	SpawnStarted SpawnEvent = iota // the process started
+	SpawnExited                    // the command completed
+)
+
+func (e SpawnEvent) String() string {
+	switch e {
+	case SpawnStarted:
+		return "start"
+	case SpawnExited:
+		return "exit"
+	default:
+		return fmt.Sprintf("SpawnEvent(%d)", int(e))
+	}
+}
+
+// A SpawnRecord describes the start or the exit of a command.
+type SpawnRecord struct {
+	Event SpawnEvent
+	Level LogLevel
+	Time  time.Time
+
+	// Cmdline is the command line of the command, as per Cmdline.
+	Cmdline string
+
+	// PID is the process ID of the command.
+	PID int
+
+	// Duration, ExitCode and Status are set for SpawnExited records
+	// only. Status is the exit status of the process, such as
+	// "exit status 1" or "signal: killed".
+	Duration time.Duration
+	ExitCode int
+	Status   string
+
+	// Err is the error returned by Wait, for SpawnExited records.
+	Err error
+
+	// Build identifies the build of the current program, as per
+	// ParentBuild.
+	Build *BuildInfo
+}
+
+// A SpawnLogger logs the starts and exits of commands. ctx is the context
+// the command was started with, such that implementations can extract
+// request-scoped values from it, such as trace identifiers.
+//
+// Implementations must be safe for concurrent use by multiple goroutines.
+type SpawnLogger interface {
+	LogSpawn(ctx context.Context, rec *SpawnRecord)
+}
+
+// SpawnLoggerFunc is an adapter to allow the use of ordinary functions as
+// spawn loggers.
+type SpawnLoggerFunc func(ctx context.Context, rec *SpawnRecord)
+
+// LogSpawn calls f(ctx, rec).
+func (f SpawnLoggerFunc) LogSpawn(ctx context.Context, rec *SpawnRecord) {
+	f(ctx, rec)
+}
+
+// SetSpawnLogger sets the logger Start uses to record the start and the
+// exit of every command to l. Records less important than level are
+// dropped. Starts, and successful exits, are logged at LevelDebug.
+// Failures are logged at LevelInfo. If l is nil, spawns are not logged,
+// which is the default. SetSpawnLogger is equivalent to setting
+// Config.SpawnLogger and Config.SpawnLogLevel using UpdateConfig, and is
+// safe to call from multiple goroutines concurrently.
+func SetSpawnLogger(l SpawnLogger, level LogLevel) {
+	UpdateConfig(func(c *Config) {
+		c.SpawnLogger, c.SpawnLogLevel = l, level
+	})
+}
+
+// logSpawn passes rec to the configured logger, if the level of rec is
+// enabled.
+func logSpawn(ctx context.Context, rec *SpawnRecord) {
+	c := currentConfig()
+	if c.SpawnLogger == nil || rec.Level < c.SpawnLogLevel {
+		return
+	}
+	c.SpawnLogger.LogSpawn(ctx, rec)
+}
+
+// logStart logs the start of the process, and remembers ctx for logExit.
+func (h *Handle) logStart(ctx context.Context) {
+	h.logCtx = ctx
+	logSpawn(ctx, &SpawnRecord{
+		Event:   SpawnStarted,
+		Level:   LevelDebug,
+		Time:    h.timeline.Running,
+		Cmdline: Cmdline(h.cmd),
+		PID:     h.cmd.Process.Pid,
+		Build:   ParentBuild(),
+	})
+}
+
+// logExit logs the completion of the command, which produced res and err.
+func (h *Handle) logExit(res *Result, err error) {
+	rec := &SpawnRecord{
+		Event:    SpawnExited,
+		Level:    LevelDebug,
+		Time:     res.Timeline.WaitReturned,
+		Cmdline:  Cmdline(h.cmd),
+		PID:      h.cmd.Process.Pid,
+		Duration: res.Duration(),
+		ExitCode: res.ExitCode,
+		Status:   res.ProcessState.String(),
+		Err:      err,
+		Build:    ParentBuild(),
+	}
+	if err != nil {
+		rec.Level = LevelInfo
+	}
+	logSpawn(h.logCtx, rec)
+}
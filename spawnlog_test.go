@@ -0,0 +1,115 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+type logKey struct{}
+
+func TestSpawnLogger(t *testing.T) {
+	t.Run("Debug", testSpawnLoggerDebug)
+	t.Run("Info", testSpawnLoggerInfo)
+}
+
+// recordSpawns installs a spawn logger at level, which records the
+// spawns run using contexts carrying id.
+func recordSpawns(t *testing.T, level execx.LogLevel, id string) func() []execx.SpawnRecord {
+	var (
+		mu   sync.Mutex
+		recs []execx.SpawnRecord
+	)
+	execx.SetSpawnLogger(execx.SpawnLoggerFunc(func(ctx context.Context, rec *execx.SpawnRecord) {
+		if ctx.Value(logKey{}) != id {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		recs = append(recs, *rec)
+	}), level)
+	t.Cleanup(func() { execx.SetSpawnLogger(nil, 0) })
+	return func() []execx.SpawnRecord {
+		mu.Lock()
+		defer mu.Unlock()
+		return recs
+	}
+}
+
+func testSpawnLoggerDebug(t *testing.T) {
+	records := recordSpawns(t, execx.LevelDebug, t.Name())
+	ctx := context.WithValue(context.Background(), logKey{}, t.Name())
+	res, err := execx.Run(ctx, selfCmd("echo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := records()
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	start, exit := recs[0], recs[1]
+	if start.Event != execx.SpawnStarted || exit.Event != execx.SpawnExited {
+		t.Errorf("got events %v, %v, want start, exit", start.Event, exit.Event)
+	}
+	if start.PID != res.ProcessState.Pid() || exit.PID != start.PID {
+		t.Errorf("got PIDs %d, %d, want %d", start.PID, exit.PID, res.ProcessState.Pid())
+	}
+	if exit.Level != execx.LevelDebug || exit.Status != "exit status 0" || exit.Err != nil {
+		t.Errorf("unexpected exit record: %+v", exit)
+	}
+	if exit.Duration != res.Duration() {
+		t.Errorf("got duration %v, want %v", exit.Duration, res.Duration())
+	}
+}
+
+func testSpawnLoggerInfo(t *testing.T) {
+	records := recordSpawns(t, execx.LevelInfo, t.Name())
+	ctx := context.WithValue(context.Background(), logKey{}, t.Name())
+	execx.Run(ctx, selfCmd("echo"))
+	if recs := records(); len(recs) != 0 {
+		t.Fatalf("successful run logged at info level: %+v", recs)
+	}
+	if _, err := execx.Run(ctx, selfCmd("on")); err == nil {
+		t.Fatal("run succeeded")
+	}
+	recs := records()
+	if len(recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(recs))
+	}
+	if recs[0].Event != execx.SpawnExited || recs[0].Level != execx.LevelInfo || recs[0].ExitCode != 1 {
+		t.Errorf("unexpected record: %+v", recs[0])
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for s, want := range map[string]execx.LogLevel{
+		"debug":   execx.LevelDebug,
+		"INFO":    execx.LevelInfo,
+		"warning": execx.LevelWarn,
+		"Error":   execx.LevelError,
+	} {
+		got, err := execx.ParseLogLevel(s)
+		if err != nil || got != want {
+			t.Errorf("ParseLogLevel(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if _, err := execx.ParseLogLevel("loud"); err == nil {
+		t.Error("unknown level parsed")
+	}
+}
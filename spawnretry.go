@@ -0,0 +1,99 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// Retries of transient spawn errors, by default. The delay doubles after
+// every attempt.
+const (
+	defaultSpawnRetries = 4
+	spawnRetryDelay     = 10 * time.Millisecond
+)
+
+// A SpawnAttempt records an attempt to start a process which failed with
+// a transient error, and which was retried.
+type SpawnAttempt struct {
+	// Time is the time the attempt failed.
+	Time time.Time
+
+	// Err is the error the attempt failed with.
+	Err error
+}
+
+func (a SpawnAttempt) String() string {
+	return fmt.Sprintf("%s: %v", a.Time.Format("15:04:05.000"), a.Err)
+}
+
+// WithSpawnRetries sets the number of times Start retries starting the
+// process if it fails with a transient error, such as ETXTBSY, which
+// occurs if the executable was just written, and a file descriptor open
+// for writing to it was inherited by a process started concurrently, or
+// EAGAIN, which fork returns if process or memory limits are reached
+// temporarily. The delay between attempts starts at 10ms, and doubles
+// after every attempt. By default, Start retries 4 times. If n is zero,
+// Start does not retry.
+//
+// The failed attempts are recorded in Result.SpawnRetries, and as a
+// []SpawnAttempt detail named "spawn_retries" in errors produced by the
+// command, including the *StartError returned by Start if all attempts
+// fail. Commands run in a Sandbox are not retried.
+func WithSpawnRetries(n int) Option {
+	return func(cfg *config) {
+		cfg.spawnRetries = n
+		cfg.spawnRetriesSet = true
+	}
+}
+
+// transientSpawnError reports whether err, returned by exec.Cmd.Start,
+// is worth retrying.
+func transientSpawnError(err error) bool {
+	return errors.Is(err, syscall.ETXTBSY) || errors.Is(err, syscall.EAGAIN)
+}
+
+// startRetrying starts h.cmd, retrying transient errors, as configured by
+// WithSpawnRetries.
+func (h *Handle) startRetrying(ctx context.Context) error {
+	retries := defaultSpawnRetries
+	if h.cfg.spawnRetriesSet {
+		retries = h.cfg.spawnRetries
+	}
+	// exec.Cmd.Start refuses to run twice, even if it failed. Restore
+	// the command to its state before the first attempt instead.
+	unstarted := *h.cmd
+	delay := spawnRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := h.cmd.Start()
+		if err == nil || attempt >= retries || !transientSpawnError(err) {
+			return err
+		}
+		h.spawnRetries = append(h.spawnRetries, SpawnAttempt{Time: h.clock.Now(), Err: err})
+		t := h.clock.NewTimer(delay)
+		select {
+		case <-t.C():
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		delay *= 2
+		*h.cmd = unstarted
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestSpawnRetries(t *testing.T) {
+	t.Run("Recovered", func(t *testing.T) {
+		path, f := busyExecutable(t)
+		time.AfterFunc(30*time.Millisecond, func() { f.Close() })
+		res, err := execx.Run(context.Background(), exec.Command(path))
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if len(res.SpawnRetries) == 0 || !errors.Is(res.SpawnRetries[0].Err, syscall.ETXTBSY) {
+			t.Errorf("got spawn retries %v", res.SpawnRetries)
+		}
+	})
+	t.Run("Exhausted", func(t *testing.T) {
+		path, f := busyExecutable(t)
+		defer f.Close()
+		_, err := execx.Run(context.Background(), exec.Command(path), execx.WithSpawnRetries(2))
+		var se *execx.StartError
+		if !errors.As(err, &se) || !errors.Is(err, syscall.ETXTBSY) {
+			t.Fatalf("got %v, want *StartError wrapping ETXTBSY", err)
+		}
+		if v := startDetail(se, "spawn_retries"); v == nil || len(v.([]execx.SpawnAttempt)) != 2 {
+			t.Errorf("got spawn_retries detail %v", v)
+		}
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		path, f := busyExecutable(t)
+		defer f.Close()
+		_, err := execx.Run(context.Background(), exec.Command(path), execx.WithSpawnRetries(0))
+		var se *execx.StartError
+		if !errors.As(err, &se) {
+			t.Fatalf("got %v, want *StartError", err)
+		}
+		if startDetail(se, "spawn_retries") != nil {
+			t.Error("got spawn_retries detail without retries")
+		}
+	})
+}
+
+// busyExecutable copies true(1) to a temporary directory, and returns the
+// path of the copy, along with the file, still open for writing, such that
+// executing it fails with ETXTBSY until it is closed.
+func busyExecutable(t *testing.T) (string, *os.File) {
+	truePath, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip(err)
+	}
+	src, err := os.Open(truePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	path := filepath.Join(tempDir(t), "busy")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		t.Fatal(err)
+	}
+	return path, f
+}
+
+// startDetail returns the value of the detail of se with the specified
+// key, or nil if there is none.
+func startDetail(se *execx.StartError, key string) interface{} {
+	for _, d := range se.Details {
+		if d.Key == key {
+			return d.Value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Flags for splice(2).
+const (
+	spliceMove     = 0x1
+	spliceNonblock = 0x2
+)
+
+// maxSplice is the maximum number of bytes moved by a call to splice.
+const maxSplice = 1 << 20
+
+// spliceOutput moves the output of s from its pipe to its destination
+// using splice(2), if the destination is backed by a file descriptor,
+// such as a socket, such that the output is not copied through user
+// space. It reports false if splice cannot be used, in which case no
+// output has been consumed.
+//
+// Both descriptors are non-blocking. All calls to splice are made from
+// within the Read and Write methods of their syscall.RawConns, such that
+// readiness notifications which arrive after a call are not lost.
+func (h *Handle) spliceOutput(s *outputStream) bool {
+	sc, ok := s.dst.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	dst, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+	src, err := s.r.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var (
+		seen        bool // some output was moved
+		done        bool // the stream is done, or splice is unsupported
+		unsupported bool
+	)
+	rerr := src.Read(func(sfd uintptr) bool {
+		werr := dst.Write(func(dfd uintptr) bool {
+			s.setBlocked(time.Time{})
+			buffered := false // the pipe held output before the last call
+			for {
+				n, err := syscall.Splice(int(sfd), nil, int(dfd), nil, maxSplice, spliceMove|spliceNonblock)
+				switch {
+				case n > 0:
+					if !seen {
+						h.mark(s.first)
+						seen = true
+					}
+					buffered = false
+				case n == 0 && err == nil:
+					done = true
+					return true
+				case err == syscall.EINTR:
+				case err == syscall.EAGAIN && buffered:
+					// The destination is full.
+					s.setBlocked(time.Now())
+					return false
+				case err == syscall.EAGAIN && s.pipeBuffered():
+					// Output arrived after the call. Try again, to
+					// find out whether the destination is full.
+					buffered = true
+				case err == syscall.EAGAIN:
+					// The pipe is empty. Wait for output.
+					return true
+				case !seen && (err == syscall.EINVAL || err == syscall.ENOSYS):
+					done, unsupported = true, true
+					return true
+				default:
+					s.err = os.NewSyscallError("splice", err)
+					done = true
+					return true
+				}
+			}
+		})
+		if werr != nil && s.err == nil {
+			s.err = werr
+			done = true
+		}
+		return done
+	})
+	if rerr != nil && s.err == nil {
+		s.err = rerr
+	}
+	return !unsupported
+}
+
+// pipeBuffered reports whether the pipe of s holds output.
+func (s *outputStream) pipeBuffered() bool {
+	buffered, _, ok := pipeState(s.r)
+	return ok && buffered > 0
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestSpliceOutput(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		received <- b
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := bytes.Repeat([]byte("0123456789abcdef"), 1<<18) // 4MiB
+	cmd := selfCmd("echo")
+	cmd.Stdin = bytes.NewReader(want)
+	cmd.Stdout = conn
+	res, err := execx.Run(context.Background(), cmd)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; !bytes.Equal(got, want) {
+		t.Errorf("received %d bytes, want %d", len(got), len(want))
+	}
+	if res.Timeline.FirstStdout.IsZero() {
+		t.Errorf("first stdout not recorded")
+	}
+}
+
+// fdWriter is backed by a file descriptor, but is not an *os.File, such
+// that Start services it using a pipe.
+type fdWriter struct {
+	*os.File
+}
+
+func TestSpliceOutputFallback(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		flag int
+	}{
+		{"Spliced", os.O_WRONLY | os.O_CREATE},
+		// splice(2) does not support O_APPEND destinations.
+		{"Append", os.O_WRONLY | os.O_CREATE | os.O_APPEND},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir(t), "out")
+			f, err := os.OpenFile(path, tt.flag, 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			cmd := selfCmd("echo")
+			cmd.Stdin = bytes.NewReader([]byte("hello"))
+			cmd.Stdout = fdWriter{f}
+			if _, err := execx.Run(context.Background(), cmd); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "hello" {
+				t.Errorf("got %q, want %q", got, "hello")
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"regexp"
+	"time"
+)
+
+// WithStackDump configures the command to be sent sig, such as
+// syscall.SIGQUIT or syscall.SIGABRT, when it times out, before it is
+// terminated. Go programs respond to these signals by writing the stacks
+// of their goroutines to standard error, and exiting. After sending the
+// signal, Wait waits up to wait for the process to exit, then proceeds to
+// terminate it as usual. If standard error is captured, the stack dump is
+// attached to the *ExitError as a detail named "stack_dump".
+//
+// WithStackDump is tailored to debugging hung Go child processes. It is
+// not supported on Windows, where the process is terminated directly.
+func WithStackDump(sig os.Signal, wait time.Duration) Option {
+	return func(cfg *config) {
+		cfg.dumpSignal = sig
+		cfg.dumpWait = wait
+	}
+}
+
+// requestStackDump sends the stack dump signal to the process, and waits
+// for it to exit, for at most the configured duration.
+func (h *Handle) requestStackDump() {
+	if err := h.cmd.Process.Signal(h.cfg.dumpSignal); err != nil {
+		return
+	}
+	t := h.clock.NewTimer(h.cfg.dumpWait)
+	defer t.Stop()
+	select {
+	case <-h.exited:
+	case <-t.C():
+	}
+}
+
+// goDumpRx matches the first line of a stack dump written by the Go
+// runtime in response to a signal.
+var goDumpRx = regexp.MustCompile(`(?m)^SIG[A-Z]+: `)
+
+// findStackDump returns the stack dump in stderr, if any.
+func findStackDump(stderr []byte) string {
+	loc := goDumpRx.FindIndex(stderr)
+	if loc == nil {
+		return ""
+	}
+	return string(stderr[loc[0]:])
+}
+
+// stackDump returns the stack dump the process wrote to its captured
+// standard error, if one was requested.
+func (h *Handle) stackDump(res *Result) string {
+	if h.cfg.dumpSignal == nil {
+		return ""
+	}
+	return findStackDump(res.Stderr)
+}
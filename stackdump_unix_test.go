@@ -0,0 +1,64 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWithStackDump(t *testing.T) {
+	start := time.Now()
+	_, err := execx.Run(context.Background(), selfCmd("hang"),
+		execx.WithTimeout(200*time.Millisecond),
+		execx.WithStackDump(syscall.SIGQUIT, 10*time.Second))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	v, ok := ee.Detail("stack_dump")
+	if !ok {
+		t.Fatalf("stack dump not attached to error; stderr: %s", ee.Result.Stderr)
+	}
+	dump := v.(string)
+	if !strings.HasPrefix(dump, "SIGQUIT: quit") || !strings.Contains(dump, "goroutine ") {
+		t.Errorf("got stack dump %.200q", dump)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %v, did not proceed once the process exited", elapsed)
+	}
+}
+
+func TestWithStackDumpNoTimeout(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"),
+		execx.WithTimeout(time.Minute),
+		execx.WithStackDump(syscall.SIGQUIT, time.Second))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if _, ok := ee.Detail("stack_dump"); ok {
+		t.Errorf("stack dump attached to error from a command which did not time out")
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"acln.ro/env"
+	"acln.ro/execx/errcode"
+)
+
+// StartError records a command which failed to start, for example because
+// the executable could not be found, or because it is not executable.
+type StartError struct {
+	// Err is the error returned by os/exec.
+	Err error
+
+	// Path is the path of the command which failed to start.
+	Path string
+
+	// Args holds command line arguments.
+	Args []string
+
+	// Dir holds the working directory for the child process.
+	Dir string
+
+	// ParentEnv is the environment of the parent process.
+	ParentEnv env.Map
+
+	// ChildEnv is the environment the child process would have had.
+	ChildEnv env.Map
+
+	// Errno is the underlying system error, or 0 if there is no such
+	// error, such as when the executable was not found in $PATH.
+	Errno syscall.Errno
+
+	// Details holds additional details gathered by collectors.
+	Details []Detail
+
+	callers callers // call stack which attempted to start the command
+}
+
+// isStartError reports whether err is of a type which exec.Cmd.Start
+// returns when it fails to start a process.
+func isStartError(err error) bool {
+	switch err.(type) {
+	case *exec.Error, *os.PathError, *os.SyscallError, syscall.Errno:
+		return true
+	default:
+		return false
+	}
+}
+
+func wrapStart(err error, cmd *exec.Cmd, collectors []Collector) *StartError {
+	se := &StartError{
+		Err:   err,
+		Path:  cmd.Path,
+		Args:  cmd.Args,
+		Errno: errno(err),
+	}
+	se.Dir, se.ParentEnv, se.ChildEnv = describe(cmd)
+	se.Details = collect(cmd, nil, collectors)
+	se.callers = captureCallers()
+	return se
+}
+
+// errno returns the syscall.Errno underlying err, or 0 if there is none.
+func errno(err error) syscall.Errno {
+	for {
+		switch e := err.(type) {
+		case syscall.Errno:
+			return e
+		case *exec.Error:
+			err = e.Err
+		case *os.PathError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		default:
+			return 0
+		}
+	}
+}
+
+// Cmdline returns the concatenation of filepath.Base(e.Path) and e.Args,
+// separated by spaces. See func Cmdline.
+func (e *StartError) Cmdline() string {
+	return cmdline(e.Path, e.Args)
+}
+
+// Unwrap returns e.Err.
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+// Error returns e.Err.Error().
+func (e *StartError) Error() string {
+	return e.Err.Error()
+}
+
+// Format implements fmt.Formatter for *StartError, in the same fashion
+// as (*ExitError).Format.
+//
+// For "%v", Format emits e.Cmdline() and the reason the process failed
+// to start.
+//
+// For "%+v", Format emits everything "%v" emits, followed by the working
+// directory, the underlying system error, and the environment.
+func (e *StartError) Format(s fmt.State, verb rune) {
+	if verb != 'v' {
+		return
+	}
+	e.format(s, defaultPrinter())
+}
+
+// format formats e for "%v" or "%+v", as requested by s, translating
+// fixed messages using p.
+func (e *StartError) format(s fmt.State, p printer) {
+	if s.Flag('+') {
+		e.formatDetail(s, p)
+	} else {
+		e.formatBasic(s, p)
+	}
+}
+
+func (e *StartError) formatDetail(w io.Writer, p printer) {
+	e.formatBasic(w, p)
+	fmt.Fprintf(w, "\n")
+	fmt.Fprintf(w, "%s\n", p.sprintf("workdir: %s", e.Dir))
+	if e.Errno != 0 {
+		fmt.Fprintf(w, "%s\n", p.sprintf("errno: %d (%v)", uintptr(e.Errno), e.Errno))
+	}
+	for _, d := range e.Details {
+		fmt.Fprintf(w, "%s: %v\n", d.Key, d.Value)
+	}
+	e.callers.format(w, p)
+	fmt.Fprintf(w, "\n")
+	fmt.Fprintf(w, "%+v", e.ChildEnv)
+}
+
+func (e *StartError) formatBasic(w io.Writer, p printer) {
+	fmt.Fprintf(w, "%s: %s", e.Cmdline(), p.sprintf("failed to start: %v", e.Err))
+}
+
+// Fields returns a flat representation of e, suitable for use with
+// structured logging packages. See (*ExitError).Fields.
+func (e *StartError) Fields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, d := range e.Details {
+		fields[d.Key] = d.Value
+	}
+	fields["cmdline"] = e.Cmdline()
+	fields["path"] = e.Path
+	fields["args"] = e.Args
+	fields["dir"] = e.Dir
+	fields["error"] = e.Err.Error()
+	fields["code"] = string(e.Code())
+	if e.Errno != 0 {
+		fields["errno"] = uintptr(e.Errno)
+	}
+	return fields
+}
+
+// jsonStartError is the JSON representation of a StartError.
+type jsonStartError struct {
+	Path     string                 `json:"path"`
+	Args     []string               `json:"args"`
+	Dir      string                 `json:"dir"`
+	Error    string                 `json:"error"`
+	Errno    uintptr                `json:"errno,omitempty"`
+	Code     errcode.Code           `json:"code"`
+	ChildEnv env.Map                `json:"env"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler for *StartError. The values of
+// sensitive environment variables are redacted, as per RedactEnv.
+func (e *StartError) MarshalJSON() ([]byte, error) {
+	je := jsonStartError{
+		Path:     e.Path,
+		Args:     e.Args,
+		Dir:      e.Dir,
+		Error:    e.Err.Error(),
+		Errno:    uintptr(e.Errno),
+		Code:     e.Code(),
+		ChildEnv: RedactEnv(e.ChildEnv),
+		Details:  detailMap(e.Details),
+	}
+	return json.Marshal(je)
+}
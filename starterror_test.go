@@ -0,0 +1,100 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestStartError(t *testing.T) {
+	t.Run("NotFound", testStartErrorNotFound)
+	t.Run("NoSuchFile", testStartErrorNoSuchFile)
+	t.Run("Print", testStartErrorPrint)
+	t.Run("JSON", testStartErrorJSON)
+}
+
+func testStartErrorNotFound(t *testing.T) {
+	cmd := exec.Command("execx-no-such-command")
+	err := execx.Wrap(cmd.Run(), cmd)
+	se, ok := err.(*execx.StartError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.StartError)(nil))
+	}
+	if _, ok := se.Unwrap().(*exec.Error); !ok {
+		t.Fatalf("got underlying %T, want %T", se.Unwrap(), (*exec.Error)(nil))
+	}
+	if se.Errno != 0 {
+		t.Errorf("got errno %v, want none", se.Errno)
+	}
+}
+
+func testStartErrorNoSuchFile(t *testing.T) {
+	se := startNoSuchFile(t)
+	if se.Errno != syscall.ENOENT {
+		t.Errorf("got errno %v, want %v", se.Errno, syscall.ENOENT)
+	}
+	if se.Dir != mustGetwd(t) {
+		t.Errorf("got dir %q, want %q", se.Dir, mustGetwd(t))
+	}
+}
+
+func testStartErrorPrint(t *testing.T) {
+	se := startNoSuchFile(t)
+	got := fmt.Sprintf("%v", se)
+	if !strings.HasPrefix(got, "execx-no-such-file arg: failed to start") {
+		t.Errorf("unexpected basic output %q", got)
+	}
+	got = fmt.Sprintf("%+v", se)
+	if !strings.Contains(got, "workdir: "+se.Dir) {
+		t.Errorf("detailed output doesn't contain working directory")
+	}
+}
+
+func testStartErrorJSON(t *testing.T) {
+	se := startNoSuchFile(t)
+	b, err := json.Marshal(se)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Path  string  `json:"path"`
+		Errno uintptr `json:"errno"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != se.Path || got.Errno != uintptr(syscall.ENOENT) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func startNoSuchFile(t *testing.T) *execx.StartError {
+	t.Helper()
+
+	cmd := exec.Command("/execx-no-such-dir/execx-no-such-file", "arg")
+	err := execx.Wrap(cmd.Run(), cmd)
+	se, ok := err.(*execx.StartError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.StartError)(nil))
+	}
+	return se
+}
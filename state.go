@@ -0,0 +1,93 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"os/exec"
+	"time"
+
+	"acln.ro/env"
+)
+
+// A StateProvider describes how a command exited. *os.ProcessState is a
+// StateProvider. Backends which run commands by other means than os/exec,
+// such as remote agents, container runtimes or WASM runtimes, implement
+// StateProvider to report failures using WrapState, such that they are
+// handled and formatted like the failures of local processes.
+type StateProvider interface {
+	// ExitCode returns the exit code of the command, or -1 if it was
+	// terminated by a signal.
+	ExitCode() int
+
+	// Success reports whether the command exited successfully.
+	Success() bool
+
+	// String describes how the command exited, such as "exit status 1"
+	// or "signal: killed", as *os.ProcessState does.
+	String() string
+
+	// UserTime and SystemTime return the user and system CPU time of
+	// the command, or zero if they are not known.
+	UserTime() time.Duration
+	SystemTime() time.Duration
+}
+
+var _ StateProvider = (*os.ProcessState)(nil)
+
+// WrapState is like WrapWith, for commands run by backends which do not
+// produce an *os.ProcessState: it wraps the failure of cmd, described by
+// state, in an *ExitError, whose State is state. stderr is the captured
+// standard error of the command, if any. If state reports success,
+// WrapState returns nil.
+//
+// Like WrapMinimal, WrapState does not capture the environment, which
+// the backend may not share with the current process: the ChildEnv of
+// the returned *ExitError is cmd.Env, if set. Collectors are passed a nil
+// *os.ProcessState, unless state is an *os.ProcessState.
+func WrapState(state StateProvider, cmd *exec.Cmd, stderr []byte, collectors ...Collector) error {
+	if state == nil || state.Success() {
+		return nil
+	}
+	ps, _ := state.(*os.ProcessState)
+	newee := &ExitError{
+		ExitError:     &exec.ExitError{ProcessState: ps, Stderr: stderr},
+		State:         state,
+		Path:          cmd.Path,
+		Args:          cmd.Args,
+		Dir:           cmd.Dir,
+		StderrDropped: omittedBytes(stderr),
+		rawEnv:        cmd.Env,
+	}
+	if cmd.Env != nil {
+		newee.ChildEnv = env.Parse(cmd.Env...)
+	}
+	newee.Details = collect(cmd, ps, collectors)
+	newee.cmd = Clone(cmd)
+	newee.callers = captureCallers()
+	return newee
+}
+
+// state returns the state of the exited process, or nil if it is not
+// available.
+func (e *ExitError) state() StateProvider {
+	if e.State != nil {
+		return e.State
+	}
+	if e.ExitError != nil && e.ProcessState != nil {
+		return e.ProcessState
+	}
+	return nil
+}
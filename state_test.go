@@ -0,0 +1,63 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+// wasmState is the state of a command run by a hypothetical WASM runtime.
+type wasmState struct {
+	code int
+	cpu  time.Duration
+}
+
+func (s wasmState) ExitCode() int             { return s.code }
+func (s wasmState) Success() bool             { return s.code == 0 }
+func (s wasmState) String() string            { return fmt.Sprintf("exit status %d", s.code) }
+func (s wasmState) UserTime() time.Duration   { return s.cpu }
+func (s wasmState) SystemTime() time.Duration { return 0 }
+
+func TestWrapState(t *testing.T) {
+	cmd := exec.Command("module.wasm", "-v")
+	if err := execx.WrapState(wasmState{code: 0}, cmd, nil); err != nil {
+		t.Fatalf("got %v for a successful command, want nil", err)
+	}
+	err := execx.WrapState(wasmState{code: 3, cpu: 2 * time.Second}, cmd, []byte("trap: unreachable\n"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.Error() != "exit status 3" || ee.ExitCode() != 3 || ee.UserTime() != 2*time.Second {
+		t.Errorf("got %q, exit code %d, user time %v", ee.Error(), ee.ExitCode(), ee.UserTime())
+	}
+	if got, want := ee.SummaryWidth(0), "module.wasm: exit 3: trap: unreachable"; got != want {
+		t.Errorf("Summary = %q, want %q", got, want)
+	}
+	verbose := fmt.Sprintf("%+v", ee)
+	if !strings.Contains(verbose, "user time: 2s") || !strings.Contains(verbose, "trap: unreachable") {
+		t.Errorf("%%+v output lacks the state of the command:\n%s", verbose)
+	}
+	if ee.Command().Path != cmd.Path {
+		t.Errorf("Command() does not rebuild the command")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds counters which describe the activity of the package since
+// the program started. Package acln.ro/execx/execxvar publishes them using
+// package expvar, such that dashboards which scrape /debug/vars pick up
+// subprocess activity.
+type Stats struct {
+	// Started counts the commands started by Start.
+	Started int64
+
+	// Running counts the commands started by Start which have not
+	// exited.
+	Running int
+
+	// Failed counts the commands which completed with an error.
+	Failed int64
+
+	// CPU is the user and system CPU time of the commands which exited.
+	CPU time.Duration
+
+	// ToolHits and ToolMisses count the resolutions and versions served
+	// by a ToolCache, and those it had not cached, respectively.
+	ToolHits   int64
+	ToolMisses int64
+}
+
+var stats struct {
+	started    atomic.Int64
+	failed     atomic.Int64
+	cpu        atomic.Int64 // nanoseconds
+	toolHits   atomic.Int64
+	toolMisses atomic.Int64
+}
+
+// ReadStats returns the current values of the counters.
+func ReadStats() Stats {
+	children.Lock()
+	running := len(children.m)
+	children.Unlock()
+	return Stats{
+		Started:    stats.started.Load(),
+		Running:    running,
+		Failed:     stats.failed.Load(),
+		CPU:        time.Duration(stats.cpu.Load()),
+		ToolHits:   stats.toolHits.Load(),
+		ToolMisses: stats.toolMisses.Load(),
+	}
+}
+
+// countExit updates the counters once a command has completed, after its
+// process, described by ps, exited.
+func countExit(ps *os.ProcessState, err error) {
+	if err != nil {
+		stats.failed.Add(1)
+	}
+	stats.cpu.Add(int64(ps.UserTime() + ps.SystemTime()))
+}
@@ -0,0 +1,40 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestReadStats(t *testing.T) {
+	before := execx.ReadStats()
+	execx.Run(context.Background(), selfCmd("echo"))
+	execx.Run(context.Background(), selfCmd("on"))
+	after := execx.ReadStats()
+	// Other tests may run commands concurrently, so only lower bounds
+	// can be checked.
+	if after.Started-before.Started < 2 {
+		t.Errorf("started: got %d more, want at least 2", after.Started-before.Started)
+	}
+	if after.Failed-before.Failed < 1 {
+		t.Errorf("failed: got %d more, want at least 1", after.Failed-before.Failed)
+	}
+	if after.CPU <= before.CPU {
+		t.Errorf("CPU time did not increase: %v, then %v", before.CPU, after.CPU)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Environment variables which carry the path of the status file, and the
+// number of extra files to hand off to the command, to the shim started
+// by StatusCommand.
+const (
+	statusFileEnv  = "EXECX_STATUS_FILE"
+	statusFilesEnv = "EXECX_STATUS_EXTRA_FILES"
+)
+
+// An ExitStatus is the final status of a command run by StatusCommand, as
+// recorded in its status file by the shim.
+type ExitStatus struct {
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	Dir  string   `json:"dir"`
+
+	// PID is the process ID of the command.
+	PID int `json:"pid"`
+
+	// ExitCode is the exit code of the command, or -1 if it was
+	// terminated by a signal, or failed to start.
+	ExitCode int `json:"exit_code"`
+
+	// Signal is the name of the signal which terminated the command,
+	// if any.
+	Signal string `json:"signal,omitempty"`
+
+	// Err is the message of the error which prevented the command from
+	// starting, if any.
+	Err string `json:"error,omitempty"`
+
+	Started time.Time `json:"started"`
+	Exited  time.Time `json:"exited"`
+
+	UserTime   time.Duration `json:"user_time"`
+	SystemTime time.Duration `json:"system_time"`
+
+	// MaxRSS is the peak resident set size of the command, in bytes,
+	// or 0 if it is not known.
+	MaxRSS int64 `json:"max_rss,omitempty"`
+}
+
+// ErrNotExited is returned by Collect if the command has not exited, or if
+// its shim was killed before recording its status.
+var ErrNotExited = errors.New("execx: command has not exited")
+
+// StatusCommand returns a command which runs cmd under a shim, which
+// records the ExitStatus of cmd in the file at path once it exits, such
+// that children which outlive the current process, such as those started
+// by Daemonize, can be inspected after the fact, using Collect.
+//
+// The shim is a copy of the current program, as per SelfCommand, which
+// must call StatusMain at the beginning of its main function. It runs cmd
+// with its standard I/O, environment and working directory, forwards
+// termination signals to it, and exits with its exit code.
+func StatusCommand(cmd *exec.Cmd, path string) (*exec.Cmd, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	shim, err := SelfCommand(append([]string{cmd.Path}, cmd.Args...)...)
+	if err != nil {
+		return nil, err
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	shim.Env = append(env[:len(env):len(env)],
+		SelfEnv+"=1",
+		statusFileEnv+"="+path,
+		statusFilesEnv+"="+strconv.Itoa(len(cmd.ExtraFiles)))
+	shim.Dir = cmd.Dir
+	shim.Stdin = cmd.Stdin
+	shim.Stdout = cmd.Stdout
+	shim.Stderr = cmd.Stderr
+	shim.ExtraFiles = cmd.ExtraFiles
+	shim.SysProcAttr = cmd.SysProcAttr
+	return shim, nil
+}
+
+// StatusMain runs the command, records its status, and exits, if the
+// process was started as a shim by StatusCommand. Otherwise, StatusMain
+// returns immediately.
+func StatusMain() {
+	path := os.Getenv(statusFileEnv)
+	if path == "" || !IsSelf() || len(os.Args) < 3 {
+		return
+	}
+	files, _ := strconv.Atoi(os.Getenv(statusFilesEnv))
+	for _, key := range []string{SelfEnv, statusFileEnv, statusFilesEnv} {
+		os.Unsetenv(key)
+	}
+	cmd := &exec.Cmd{Path: os.Args[1], Args: os.Args[2:]}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	for i := 0; i < files; i++ {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, os.NewFile(uintptr(3+i), ""))
+	}
+	st := runStatus(cmd)
+	if err := writeStatus(path, st); err != nil {
+		fmt.Fprintf(os.Stderr, "execx: writing status file: %v\n", err)
+	}
+	code := st.ExitCode
+	if code < 0 {
+		code = 128 + signalNumber(cmd.ProcessState)
+	}
+	os.Exit(code)
+}
+
+// runStatus runs cmd, forwarding termination signals to it, and returns
+// its status.
+func runStatus(cmd *exec.Cmd) *ExitStatus {
+	st := &ExitStatus{Path: cmd.Path, Args: cmd.Args, ExitCode: -1}
+	st.Dir, _ = os.Getwd()
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(sigc)
+	st.Started = time.Now()
+	if err := cmd.Start(); err != nil {
+		st.Err = err.Error()
+		st.Exited = st.Started
+		return st
+	}
+	st.PID = cmd.Process.Pid
+	waited := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigc:
+				cmd.Process.Signal(sig)
+			case <-waited:
+				return
+			}
+		}
+	}()
+	cmd.Wait()
+	close(waited)
+	st.Exited = time.Now()
+	ps := cmd.ProcessState
+	st.ExitCode = ps.ExitCode()
+	st.UserTime = ps.UserTime()
+	st.SystemTime = ps.SystemTime()
+	st.Signal, st.MaxRSS = exitDetails(ps)
+	return st
+}
+
+// writeStatus records st in the status file at path, atomically.
+func writeStatus(path string, st *ExitStatus) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Collect reads the status file at path, written by the shim of a command
+// started using StatusCommand, and returns the status of the command. If
+// the command failed, Collect also returns an *ExitError describing the
+// failure, or a *StartError if the command failed to start, such that
+// failures of detached children are reported in the same way as others.
+// The ExitStatus is attached to the error as a detail named
+// "exit_status". The state of the process is not available in the
+// *ExitError: its exit code is available through ExitCode and Result.
+//
+// If the status file does not exist, Collect returns ErrNotExited.
+func Collect(path string) (*ExitStatus, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExited
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := new(ExitStatus)
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("execx: malformed status file %s: %v", path, err)
+	}
+	details := []Detail{{Key: "exit_status", Value: st}}
+	if st.Err != "" {
+		return st, &StartError{
+			Err:     errors.New(st.Err),
+			Path:    st.Path,
+			Args:    st.Args,
+			Dir:     st.Dir,
+			Details: details,
+		}
+	}
+	if st.ExitCode == 0 {
+		return st, nil
+	}
+	res := &Result{
+		Path:     st.Path,
+		Args:     st.Args,
+		Dir:      st.Dir,
+		ExitCode: st.ExitCode,
+		Timeline: Timeline{Running: st.Started, Exited: st.Exited, WaitReturned: st.Exited},
+	}
+	ee := &ExitError{
+		ExitError: &exec.ExitError{},
+		Path:      st.Path,
+		Args:      st.Args,
+		Dir:       st.Dir,
+		PID:       st.PID,
+		Details:   details,
+		Result:    res,
+	}
+	if st.Signal != "" {
+		ee.Hints = append(ee.Hints, fmt.Sprintf("process terminated by signal (%s)", st.Signal))
+	}
+	return st, ee
+}
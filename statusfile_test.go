@@ -0,0 +1,79 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestCollect(t *testing.T) {
+	t.Run("Success", testCollectSuccess)
+	t.Run("Failure", testCollectFailure)
+	t.Run("NotExited", testCollectNotExited)
+}
+
+func runWithStatus(t *testing.T, cmd *exec.Cmd) string {
+	path := filepath.Join(t.TempDir(), "status.json")
+	shim, err := execx.StatusCommand(cmd, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The outcome is collected from the status file, rather than from
+	// the shim itself.
+	execx.Run(context.Background(), shim)
+	return path
+}
+
+func testCollectSuccess(t *testing.T) {
+	path := runWithStatus(t, selfCmd("echo"))
+	st, err := execx.Collect(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ExitCode != 0 || st.PID == 0 || st.Exited.Before(st.Started) {
+		t.Errorf("unexpected status: %+v", st)
+	}
+}
+
+func testCollectFailure(t *testing.T) {
+	cmd := selfCmd("on")
+	path := runWithStatus(t, cmd)
+	st, err := execx.Collect(path)
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.ExitCode() != 1 || ee.PID != st.PID {
+		t.Errorf("got exit code %d, PID %d, want 1, %d", ee.ExitCode(), ee.PID, st.PID)
+	}
+	if ee.Path != cmd.Path {
+		t.Errorf("got path %q, want %q", ee.Path, cmd.Path)
+	}
+	if got, ok := ee.Detail("exit_status"); !ok || got.(*execx.ExitStatus).PID != st.PID {
+		t.Errorf("exit_status detail not attached: %v", ee.Details)
+	}
+}
+
+func testCollectNotExited(t *testing.T) {
+	_, err := execx.Collect(filepath.Join(t.TempDir(), "status.json"))
+	if err != execx.ErrNotExited {
+		t.Fatalf("got %v, want ErrNotExited", err)
+	}
+}
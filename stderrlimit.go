@@ -0,0 +1,102 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// WithStderrLimit limits the captured standard error of the command to
+// about max bytes. Like exec.Cmd.Output, which caps standard error at 32KB,
+// the beginning and the end of the output are kept, and the middle is
+// replaced by a line noting how many bytes were omitted. If the command
+// fails, the number of dropped bytes is recorded in the StderrDropped
+// field of the *ExitError.
+//
+// Unlike WithOutputLimit, WithStderrLimit takes no action when the limit
+// is exceeded: the process runs to completion. For standard error,
+// WithStderrLimit overrides WithOutputLimit.
+func WithStderrLimit(max int) Option {
+	return func(cfg *config) {
+		cfg.stderrLimit = max
+	}
+}
+
+// stderrSaver captures the first and last bytes written to it, dropping
+// the middle, in the manner of the prefixSuffixSaver used by os/exec.
+type stderrSaver struct {
+	buf     captureWriter // receives the prefix, and the suffix on flush
+	prefix  int           // size of the prefix
+	max     int           // size of the suffix
+	suffix  []byte
+	dropped int64
+}
+
+func newStderrSaver(buf captureWriter, max int) *stderrSaver {
+	return &stderrSaver{buf: buf, prefix: max / 2, max: max - max/2}
+}
+
+func (sv *stderrSaver) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := sv.prefix - sv.buf.Len(); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		sv.buf.Write(p[:room])
+		p = p[room:]
+	}
+	sv.suffix = append(sv.suffix, p...)
+	if over := len(sv.suffix) - sv.max; over > 0 {
+		sv.dropped += int64(over)
+		sv.suffix = append(sv.suffix[:0], sv.suffix[over:]...)
+	}
+	return n, nil
+}
+
+// flush appends the suffix to the captured output, once the stream is
+// done.
+func (sv *stderrSaver) flush() {
+	if sv.dropped > 0 {
+		fmt.Fprintf(sv.buf, "\n... omitting %d bytes ...\n", sv.dropped)
+	}
+	sv.buf.Write(sv.suffix)
+	sv.suffix = nil
+}
+
+// stderrDropped returns the number of bytes of standard error dropped
+// by WithStderrLimit.
+func (h *Handle) stderrDropped() int64 {
+	for _, s := range h.outputs {
+		if sv, ok := s.limiter().(*stderrSaver); ok {
+			return sv.dropped
+		}
+	}
+	return 0
+}
+
+var omittingRx = regexp.MustCompile(`\n\.\.\. omitting (\d+) bytes \.\.\.\n`)
+
+// omittedBytes returns the number of bytes noted as omitted from stderr,
+// as captured by exec.Cmd.Output or WithStderrLimit.
+func omittedBytes(stderr []byte) int64 {
+	m := omittingRx.FindSubmatch(stderr)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(string(m[1]), 10, 64)
+	return n
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithStderrLimit(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("stderr-flood"), execx.WithStderrLimit(1000))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	const total = len("begin") + 100000 + len("end")
+	if want := int64(total - 1000); ee.StderrDropped != want {
+		t.Errorf("got %d bytes dropped, want %d", ee.StderrDropped, want)
+	}
+	stderr := ee.Result.Stderr
+	if !bytes.HasPrefix(stderr, []byte("begin")) || !bytes.HasSuffix(stderr, []byte("end")) {
+		t.Errorf("beginning or end of stderr not kept: %.20q ... %.20q", stderr, stderr[len(stderr)-20:])
+	}
+	if !bytes.Contains(stderr, []byte(fmt.Sprintf("... omitting %d bytes ...", ee.StderrDropped))) {
+		t.Errorf("truncation not noted in stderr")
+	}
+	if len(stderr) > 1100 {
+		t.Errorf("captured %d bytes of stderr, want about 1000", len(stderr))
+	}
+	if got := ee.Fields()["stderr_dropped"]; got != ee.StderrDropped {
+		t.Errorf("Fields()[%q] = %v, want %d", "stderr_dropped", got, ee.StderrDropped)
+	}
+	if !strings.Contains(fmt.Sprintf("%+v", ee), "stderr truncated: dropped") {
+		t.Errorf("truncation missing from %%+v output")
+	}
+	b, err := json.Marshal(ee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"stderr_dropped":`) {
+		t.Errorf("truncation missing from JSON output: %s", b)
+	}
+}
+
+func TestWithStderrLimitNotExceeded(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("on"), execx.WithStderrLimit(1000))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.StderrDropped != 0 || string(ee.Result.Stderr) != "whoops" {
+		t.Errorf("got %q, %d bytes dropped, want %q, 0", ee.Result.Stderr, ee.StderrDropped, "whoops")
+	}
+}
+
+func TestWrapOutputStderrTruncated(t *testing.T) {
+	cmd := selfCmd("stderr-flood")
+	_, err := cmd.Output()
+	ee, ok := execx.Wrap(err, cmd).(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.StderrDropped <= 0 {
+		t.Errorf("truncation by exec.Cmd.Output not recorded")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import "time"
+
+// WithStdinCloseDelay closes the standard input of the process d after the
+// end of cmd.Stdin is reached, rather than right away, for programs which
+// stop as soon as their input ends, before acting on all of it. The
+// standard input is closed when the process exits regardless.
+//
+// WithStdinCloseDelay applies only if cmd.Stdin is neither nil nor an
+// *os.File, since the process reads those directly.
+func WithStdinCloseDelay(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.stdinCloseDelay = d
+	}
+}
+
+// WithStdinHeldOpen keeps the standard input of the process open until
+// the process exits. Once the end of cmd.Stdin is reached, the process
+// sees no more input, but no end of file either, as needed by programs
+// which treat the end of their input as a request to exit. If cmd.Stdin
+// is nil, the process reads from an empty pipe, in place of the null
+// device.
+//
+// WithStdinHeldOpen does not apply if cmd.Stdin is an *os.File, since the
+// process reads it directly.
+func WithStdinHeldOpen() Option {
+	return func(cfg *config) {
+		cfg.stdinHeldOpen = true
+	}
+}
+
+// Write writes p to the pipe, and counts the bytes written.
+func (s *inputStream) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.mu.Lock()
+	s.n += int64(n)
+	s.mu.Unlock()
+	return n, err
+}
+
+// written returns the number of bytes written to the pipe so far.
+func (s *inputStream) written() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.n
+}
+
+// closeInput closes the write end of the stdin pipe once the end of the
+// input was reached, as per WithStdinCloseDelay and WithStdinHeldOpen, or
+// once the process exits, whichever happens first.
+func (h *Handle) closeInput(s *inputStream) {
+	defer s.w.Close()
+	var delay <-chan time.Time
+	switch {
+	case h.cfg.stdinHeldOpen:
+	case h.cfg.stdinCloseDelay > 0:
+		t := h.clock.NewTimer(h.cfg.stdinCloseDelay)
+		defer t.Stop()
+		delay = t.C()
+	default:
+		return
+	}
+	select {
+	case <-delay:
+	case <-h.exited:
+	}
+}
+
+// diagnoseStdin looks for processes in the tree of the process which are
+// blocked reading its standard input, and records a hint to that effect.
+func (h *Handle) diagnoseStdin() {
+	if len(stdinReaders(h.cmd.Process.Pid)) == 0 {
+		return
+	}
+	if h.stdin == nil || h.stdin.src == nil || h.stdin.written() == 0 {
+		h.hint("child appears blocked reading stdin which was never provided")
+		return
+	}
+	h.hint("child appears blocked reading stdin, which is still open after %d bytes", h.stdin.written())
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// stdinReaders returns the pids of the processes in the tree rooted at pid
+// which are blocked reading from the standard input of the process at the
+// root of the tree, as reported by /proc/<pid>/syscall.
+func stdinReaders(pid int) []int {
+	stdin, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/0", pid))
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	var visit func(n *ProcNode)
+	visit = func(n *ProcNode) {
+		if readingStdin(n.PID, stdin) {
+			pids = append(pids, n.PID)
+		}
+		for _, c := range n.Children {
+			visit(c)
+		}
+	}
+	if root := procTree(pid); root != nil {
+		visit(root)
+	}
+	return pids
+}
+
+// readingStdin reports whether the process with the specified pid is
+// blocked in read(2) on file descriptor 0, which refers to stdin.
+func readingStdin(pid int, stdin string) bool {
+	nr, args, ok := readSyscall(pid)
+	if !ok || nr != syscall.SYS_READ || args[0] != 0 {
+		return false
+	}
+	target, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/0", pid))
+	return err == nil && target == stdin
+}
+
+// readSyscall reads the number and the first argument of the system call
+// the process with the specified pid is blocked in from
+// /proc/<pid>/syscall. readSyscall reports false if the process is
+// running, or if the system call cannot be determined.
+func readSyscall(pid int) (nr int, args [1]uint64, ok bool) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/syscall", pid))
+	if err != nil {
+		return 0, args, false
+	}
+	// The syscall number is followed by its arguments, in hexadecimal.
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 {
+		return 0, args, false
+	}
+	nr, err = strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, args, false
+	}
+	args[0], err = strconv.ParseUint(strings.TrimPrefix(fields[1], "0x"), 16, 64)
+	return nr, args, err == nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWithStdinCloseDelay(t *testing.T) {
+	cmd := exec.Command("cat")
+	cmd.Stdin = strings.NewReader("hello")
+	res, err := execx.Run(context.Background(), cmd, execx.WithStdinCloseDelay(300*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "hello" {
+		t.Errorf("got stdout %q, want %q", res.Stdout, "hello")
+	}
+	if d := res.Timeline.Exited.Sub(res.Timeline.StdinEOF); d < 300*time.Millisecond {
+		t.Errorf("process exited %v after the end of stdin, want at least 300ms", d)
+	}
+}
+
+func TestWithStdinHeldOpen(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("blocked readers can only be found on Linux")
+	}
+	tests := []struct {
+		name  string
+		stdin string
+		hint  string
+	}{
+		{"NeverProvided", "", "child appears blocked reading stdin which was never provided"},
+		{"StillOpen", "hello", "child appears blocked reading stdin, which is still open after 5 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("cat")
+			if tt.stdin != "" {
+				cmd.Stdin = strings.NewReader(tt.stdin)
+			}
+			_, err := execx.Run(context.Background(), cmd, execx.WithStdinHeldOpen(), execx.WithTimeout(300*time.Millisecond))
+			ee, ok := err.(*execx.ExitError)
+			if !ok {
+				t.Fatalf("got %v, want *ExitError", err)
+			}
+			if string(ee.Result.Stdout) != tt.stdin {
+				t.Errorf("got stdout %q, want %q", ee.Result.Stdout, tt.stdin)
+			}
+			if len(ee.Hints) != 1 || ee.Hints[0] != tt.hint {
+				t.Errorf("got hints %q, want %q", ee.Hints, tt.hint)
+			}
+		})
+	}
+}
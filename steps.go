@@ -0,0 +1,163 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// A StepPolicy determines what Steps does when a step fails.
+type StepPolicy int
+
+// Step policies.
+const (
+	// StepAbort stops Steps at the failed step. Subsequent steps are
+	// not run.
+	StepAbort StepPolicy = iota
+
+	// StepContinue runs subsequent steps regardless. Steps still
+	// reports the failure once all steps have run.
+	StepContinue
+)
+
+func (p StepPolicy) String() string {
+	switch p {
+	case StepAbort:
+		return "abort"
+	case StepContinue:
+		return "continue"
+	default:
+		return fmt.Sprintf("StepPolicy(%d)", int(p))
+	}
+}
+
+// A ScriptStep is a named command run by Steps. It is unrelated to the
+// Step recorded by a Recorder.
+type ScriptStep struct {
+	// Name identifies the step in errors. If Name is empty, the
+	// command line of Cmd is used instead.
+	Name string
+
+	// Cmd is the command to run.
+	Cmd *exec.Cmd
+
+	// OnFailure determines what happens if the step fails.
+	OnFailure StepPolicy
+
+	// Opts configures the command, as per Run.
+	Opts []Option
+}
+
+// name returns the name of the step.
+func (s *ScriptStep) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return Cmdline(s.Cmd)
+}
+
+// A StepResult describes a step run by Steps.
+type StepResult struct {
+	// Name is the name of the step.
+	Name string
+
+	// Result describes the run, as returned by Run. It holds the
+	// output of the step, if it was captured.
+	Result *Result
+
+	// Err is the error returned by Run, if the step failed.
+	Err error
+}
+
+// StepsError records the failure of a step run by Steps.
+type StepsError struct {
+	// Step is the name of the first step which failed.
+	Step string
+
+	// Index is the index of that step, starting at zero.
+	Index int
+
+	// Err is the error the step failed with, such as an *ExitError.
+	Err error
+
+	// Preceding describes the steps which ran before the failed step,
+	// in order, for context.
+	Preceding []StepResult
+
+	// Failed holds the names of all the steps which failed, including
+	// those which failed after Step, if Step was allowed to fail using
+	// StepContinue.
+	Failed []string
+}
+
+func (e *StepsError) Error() string {
+	msg := fmt.Sprintf("execx: step %d (%s) failed: %v", e.Index+1, e.Step, e.Err)
+	if n := len(e.Failed); n > 1 {
+		msg += fmt.Sprintf(" (and %d more)", n-1)
+	}
+	return msg
+}
+
+// Unwrap returns e.Err.
+func (e *StepsError) Unwrap() error {
+	return e.Err
+}
+
+// Steps runs steps sequentially, using Run, and thus the runner carried
+// by ctx. It returns a StepResult for each step which was run, in order.
+//
+// If a step fails, and its policy is StepAbort, Steps returns right away.
+// If its policy is StepContinue, Steps runs the subsequent steps. In
+// either case, the returned error is a *StepsError, which identifies the
+// first step which failed, and holds the results of the steps which ran
+// before it. If ctx is done, the remaining steps are not run.
+func Steps(ctx context.Context, steps ...ScriptStep) ([]StepResult, error) {
+	var (
+		results []StepResult
+		serr    *StepsError
+	)
+	for i := range steps {
+		s := &steps[i]
+		if ctx.Err() != nil {
+			if serr == nil {
+				serr = &StepsError{Step: s.name(), Index: i, Err: ctx.Err(), Preceding: results}
+			}
+			break
+		}
+		res, err := Run(ctx, s.Cmd, s.Opts...)
+		results = append(results, StepResult{Name: s.name(), Result: res, Err: err})
+		if err == nil {
+			continue
+		}
+		if serr == nil {
+			serr = &StepsError{
+				Step:      s.name(),
+				Index:     i,
+				Err:       err,
+				Preceding: results[:i:i],
+			}
+		}
+		serr.Failed = append(serr.Failed, s.name())
+		if s.OnFailure == StepAbort {
+			break
+		}
+	}
+	if serr != nil {
+		return results, serr
+	}
+	return results, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestSteps(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		results, err := execx.Steps(context.Background(),
+			execx.ScriptStep{Name: "first", Cmd: selfCmd("echo")},
+			execx.ScriptStep{Name: "second", Cmd: selfCmd("echo")},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 || results[0].Name != "first" || results[1].Name != "second" {
+			t.Fatalf("got %+v", results)
+		}
+	})
+	t.Run("Abort", func(t *testing.T) {
+		results, err := execx.Steps(context.Background(),
+			execx.ScriptStep{Name: "configure", Cmd: selfCmd("echo")},
+			execx.ScriptStep{Name: "build", Cmd: selfCmd("on")},
+			execx.ScriptStep{Name: "install", Cmd: selfCmd("echo")},
+		)
+		var serr *execx.StepsError
+		if !errors.As(err, &serr) {
+			t.Fatalf("got %v, want *StepsError", err)
+		}
+		if serr.Step != "build" || serr.Index != 1 {
+			t.Errorf("failed step: got %q (%d), want %q (1)", serr.Step, serr.Index, "build")
+		}
+		var ee *execx.ExitError
+		if !errors.As(err, &ee) || ee.ExitCode() != 1 {
+			t.Errorf("got %v, want *ExitError with exit code 1", err)
+		}
+		if len(serr.Preceding) != 1 || serr.Preceding[0].Name != "configure" || serr.Preceding[0].Result == nil {
+			t.Errorf("preceding steps: got %+v", serr.Preceding)
+		}
+		if len(results) != 2 {
+			t.Errorf("ran %d steps, want 2", len(results))
+		}
+	})
+	t.Run("Continue", func(t *testing.T) {
+		results, err := execx.Steps(context.Background(),
+			execx.ScriptStep{Name: "lint", Cmd: selfCmd("on"), OnFailure: execx.StepContinue},
+			execx.ScriptStep{Cmd: selfCmd("echo")},
+			execx.ScriptStep{Name: "vet", Cmd: selfCmd("on"), OnFailure: execx.StepContinue},
+		)
+		var serr *execx.StepsError
+		if !errors.As(err, &serr) {
+			t.Fatalf("got %v, want *StepsError", err)
+		}
+		if serr.Step != "lint" || len(serr.Failed) != 2 {
+			t.Errorf("got %+v", serr)
+		}
+		if len(results) != 3 {
+			t.Fatalf("ran %d steps, want 3", len(results))
+		}
+		if results[1].Name == "" || results[1].Err != nil {
+			t.Errorf("unnamed step: got %+v", results[1])
+		}
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		results, err := execx.Steps(ctx, execx.ScriptStep{Name: "never", Cmd: selfCmd("echo")})
+		if !errors.Is(err, context.Canceled) || len(results) != 0 {
+			t.Errorf("got %v, %d results", err, len(results))
+		}
+	})
+}
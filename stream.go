@@ -0,0 +1,261 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// outputStream services the write end of an output pipe of a child process.
+type outputStream struct {
+	name    string
+	r, w    *os.File
+	dst     io.Writer
+	fanout  *fanout     // additional writers, if any
+	taps    []io.Writer // observers of the output, such as readiness probes
+	attach  *attachLog  // recent output, for Attach
+	tail    *tailBuffer // tail of output written to the caller's writer
+	capture *bytes.Buffer
+	zip     *gzipCapture // compresses into capture, if any
+	first   *time.Time
+	done    chan struct{}
+	err     error
+
+	mu      sync.Mutex // protects blocked
+	blocked time.Time  // when the current write to dst started
+}
+
+// blockedSince returns the time at which the stream started blocking on
+// a write to its destination, or the zero time if it is not blocked.
+func (s *outputStream) blockedSince() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blocked
+}
+
+func (s *outputStream) setBlocked(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked = t
+}
+
+// inputStream services the read end of an input pipe of a child process.
+type inputStream struct {
+	r, w *os.File
+	src  io.Reader // nil if the pipe is only held open
+
+	mu sync.Mutex // protects n
+	n  int64      // bytes written to the pipe
+}
+
+// lockedWriter serializes writes to a writer shared by multiple streams.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// plumb replaces the standard I/O of h.cmd with pipes serviced by h.
+func (h *Handle) plumb() error {
+	cmd := h.cmd
+	if _, ok := cmd.Stdin.(*os.File); !ok {
+		if cmd.Stdin != nil || h.cfg.stdinHeldOpen {
+			r, w, err := os.Pipe()
+			if err != nil {
+				return err
+			}
+			h.stdin = &inputStream{r: r, w: w, src: cmd.Stdin}
+			cmd.Stdin = r
+		}
+	}
+	var shared io.Writer
+	if cmd.Stdout != nil && cmd.Stdout == cmd.Stderr {
+		shared = &lockedWriter{w: cmd.Stdout}
+	}
+	stdout, err := h.plumbOutput("stdout", cmd.Stdout, shared, h.cfg.stdoutWriters, &h.timeline.FirstStdout)
+	if err != nil {
+		h.closePipes()
+		return err
+	}
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	stderr, err := h.plumbOutput("stderr", cmd.Stderr, shared, h.cfg.stderrWriters, &h.timeline.FirstStderr)
+	if err != nil {
+		h.closePipes()
+		return err
+	}
+	if stderr != nil {
+		cmd.Stderr = stderr
+	}
+	return nil
+}
+
+// plumbOutput sets up an output stream writing to dst, and to the extra
+// writers, and returns the write end of the pipe, or nil if dst is an
+// *os.File and there are no extra writers, in which case the child process
+// writes to dst directly.
+func (h *Handle) plumbOutput(name string, dst, shared io.Writer, extra []io.Writer, first *time.Time) (*os.File, error) {
+	if f, ok := dst.(*os.File); ok && len(extra) == 0 && !h.cfg.forceTail() {
+		h.direct = append(h.direct, directOutput{name: name, f: f})
+		return nil, nil
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	s := &outputStream{
+		name:   name,
+		r:      r,
+		w:      w,
+		dst:    dst,
+		taps:   h.cfg.taps,
+		attach: h.attach,
+		first:  first,
+		done:   make(chan struct{}),
+	}
+	switch {
+	case dst == nil:
+		s.capture = getCapture()
+		var buf captureWriter = s.capture
+		if h.cfg.compress {
+			s.zip = newGzipCapture(s.capture)
+			buf = s.zip
+		}
+		s.dst = buf
+		switch {
+		case name == "stderr" && h.cfg.stderrLimit > 0:
+			s.dst = newStderrSaver(buf, h.cfg.stderrLimit)
+		case h.cfg.limit > 0:
+			s.dst = &limitWriter{buf: buf, max: h.cfg.limit, onExceed: h.exceeded}
+		}
+		if h.cfg.sampling != nil {
+			s.dst = &lineSampler{w: s.dst, cfg: h.cfg.sampling, clock: h.clock}
+		}
+		if h.cfg.summarize {
+			s.dst = &summarizer{w: s.dst}
+		}
+	case shared != nil:
+		s.dst = shared
+	}
+	if len(extra) > 0 {
+		s.fanout = newFanout(name, extra, h.internal)
+	}
+	if dst != nil {
+		if n := h.cfg.tailSize(); n > 0 {
+			s.tail = &tailBuffer{max: n}
+		}
+	}
+	h.outputs = append(h.outputs, s)
+	return w, nil
+}
+
+// closeChildEnds closes the ends of the pipes which belong to the child
+// process, once the child process has started.
+func (h *Handle) closeChildEnds() {
+	if h.stdin != nil {
+		h.stdin.r.Close()
+	}
+	for _, s := range h.outputs {
+		s.w.Close()
+	}
+}
+
+// closePipes closes all pipes, if the child process failed to start.
+func (h *Handle) closePipes() {
+	if h.stdin != nil {
+		h.stdin.r.Close()
+		h.stdin.w.Close()
+	}
+	for _, s := range h.outputs {
+		s.r.Close()
+		s.w.Close()
+	}
+}
+
+// startCopying starts the goroutines which service the pipes.
+func (h *Handle) startCopying() {
+	if h.stdin != nil {
+		go h.copyInput(h.stdin)
+	}
+	for _, s := range h.outputs {
+		go h.copyOutput(s)
+	}
+}
+
+func (h *Handle) copyInput(s *inputStream) {
+	defer h.closeInput(s)
+	defer h.internal.catch("copy stdin")
+	if s.src == nil {
+		return
+	}
+	io.Copy(s, s.src)
+	h.mark(&h.timeline.StdinEOF)
+}
+
+func (h *Handle) copyOutput(s *outputStream) {
+	defer close(s.done)
+	defer s.r.Close()
+	defer h.internal.catch("copy " + s.name)
+
+	if s.fanout == nil && len(s.taps) == 0 && s.capture == nil && !h.cfg.forceTail() && h.spliceOutput(s) {
+		return
+	}
+	bufp := copyPool.Get().(*[copyBufferSize]byte)
+	defer copyPool.Put(bufp)
+	buf := bufp[:]
+	for seen := false; ; {
+		n, err := s.r.Read(buf)
+		if n > 0 {
+			if !seen {
+				h.mark(s.first)
+				seen = true
+			}
+			s.setBlocked(time.Now())
+			_, err := s.dst.Write(buf[:n])
+			s.setBlocked(time.Time{})
+			if err != nil {
+				s.err = err
+				return
+			}
+			if s.fanout != nil {
+				s.fanout.Write(buf[:n])
+			}
+			for _, tap := range s.taps {
+				tap.Write(buf[:n])
+			}
+			s.attach.Write(buf[:n])
+			if s.tail != nil {
+				s.tail.Write(buf[:n])
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			s.err = err
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WithSummarizedOutput summarizes the captured standard output and
+// standard error of the command, by collapsing runs of repeated lines,
+// such as a warning printed thousands of times by a failing build. Of
+// each run, the first and the last occurrences are kept, and the lines in
+// between are replaced by a note such as
+//
+//	[previous line repeated 2,134 times]
+//
+// Summarization applies before limits set by WithOutputLimit and
+// WithStderrLimit. Output written to non-nil cmd.Stdout or cmd.Stderr is
+// not summarized.
+func WithSummarizedOutput() Option {
+	return func(cfg *config) {
+		cfg.summarize = true
+	}
+}
+
+// summarizer collapses runs of repeated lines written to it, and writes
+// the summarized output to w.
+type summarizer struct {
+	w       io.Writer
+	partial []byte // incomplete line
+	last    []byte // last complete line, including the newline
+	repeats int    // number of times last was repeated, after it was written
+}
+
+func (sm *summarizer) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			sm.partial = append(sm.partial, p...)
+			break
+		}
+		line := p[:i+1]
+		if len(sm.partial) > 0 {
+			line = append(sm.partial, line...)
+			sm.partial = sm.partial[:0]
+		}
+		sm.line(line)
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// line processes a complete line.
+func (sm *summarizer) line(line []byte) {
+	if sm.last != nil && bytes.Equal(line, sm.last) {
+		sm.repeats++
+		return
+	}
+	sm.endRun()
+	sm.w.Write(line)
+	sm.last = append(sm.last[:0], line...)
+}
+
+// endRun writes the summary of the current run of repeated lines, if any.
+func (sm *summarizer) endRun() {
+	if sm.repeats > 1 {
+		fmt.Fprintf(sm.w, "[previous line repeated %s times]\n", groupThousands(sm.repeats-1))
+	}
+	if sm.repeats > 0 {
+		sm.w.Write(sm.last)
+	}
+	sm.repeats = 0
+}
+
+// flush writes the pending run and incomplete line, once the stream is
+// done.
+func (sm *summarizer) flush() {
+	if len(sm.partial) > 0 {
+		if bytes.Equal(append(sm.partial, '\n'), sm.last) {
+			// The last occurrence of the run lacks its newline.
+			sm.repeats++
+			sm.last = sm.last[:len(sm.last)-1]
+			sm.partial = sm.partial[:0]
+		}
+	}
+	sm.endRun()
+	sm.w.Write(sm.partial)
+	sm.partial = nil
+}
+
+// groupThousands formats n with commas separating groups of thousands.
+func groupThousands(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// limiter returns the writer which limits the captured output of s,
+// beneath the summarizer and the line sampler, if any.
+func (s *outputStream) limiter() io.Writer {
+	if ls, ok := s.sampler(); ok {
+		return ls.w
+	}
+	if sm, ok := s.dst.(*summarizer); ok {
+		return sm.w
+	}
+	return s.dst
+}
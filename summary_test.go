@@ -0,0 +1,97 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithSummarizedOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "NoRepeats",
+			in:   "a\nb\nc\n",
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "Twice",
+			in:   "a\na\nb\n",
+			want: "a\na\nb\n",
+		},
+		{
+			name: "Thrice",
+			in:   "a\na\na\nb\n",
+			want: "a\n[previous line repeated 1 times]\na\nb\n",
+		},
+		{
+			name: "Thousands",
+			in:   "start\n" + strings.Repeat("warning: unused variable\n", 5000) + "end\n",
+			want: "start\nwarning: unused variable\n[previous line repeated 4,998 times]\nwarning: unused variable\nend\n",
+		},
+		{
+			name: "Interleaved",
+			in:   "a\na\na\nb\na\na\na\n",
+			want: "a\n[previous line repeated 1 times]\na\nb\na\n[previous line repeated 1 times]\na\n",
+		},
+		{
+			name: "NoTrailingNewline",
+			in:   "a\na\na",
+			want: "a\n[previous line repeated 1 times]\na",
+		},
+		{
+			name: "PartialLine",
+			in:   "a\na\nab",
+			want: "a\na\nab",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := selfCmd("echo")
+			cmd.Stdin = strings.NewReader(tt.in)
+			res, err := execx.Run(context.Background(), cmd, execx.WithSummarizedOutput())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(res.Stdout); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if got := string(res.Stderr); got != "echoed" {
+				t.Errorf("got stderr %q, want %q", got, "echoed")
+			}
+		})
+	}
+}
+
+func TestWithSummarizedOutputLimit(t *testing.T) {
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader(strings.Repeat("again\n", 100000))
+	res, err := execx.Run(context.Background(), cmd,
+		execx.WithSummarizedOutput(),
+		execx.WithOutputLimit(1024, execx.OverflowKill))
+	if err != nil {
+		t.Fatalf("summarized output exceeded the limit: %v", err)
+	}
+	if want := "again\n[previous line repeated 99,998 times]\nagain\n"; string(res.Stdout) != want {
+		t.Errorf("got %q, want %q", res.Stdout, want)
+	}
+}
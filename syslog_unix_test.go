@@ -0,0 +1,87 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWithSyslog(t *testing.T) {
+	addr := filepath.Join(tempDir(t), "syslog.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer conn.Close()
+
+	cmd := selfCmd("echo")
+	cmd.Stdin = strings.NewReader("first\nsecond")
+	res, err := execx.Run(context.Background(), cmd, execx.WithSyslog("unixgram", addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Stdout) != "first\nsecond" {
+		t.Errorf("output not captured as usual: got %q", res.Stdout)
+	}
+
+	tag := filepath.Base(cmd.Path)
+	want := []struct {
+		priority string
+		msg      string
+	}{
+		{"<14>", "first"},
+		{"<14>", "second"},
+		{"<12>", "echoed"},
+	}
+	var got []string
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for range want {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(buf[:n]))
+	}
+	for _, w := range want {
+		found := false
+		for _, msg := range got {
+			if strings.HasPrefix(msg, w.priority) && strings.Contains(msg, tag) && strings.HasSuffix(strings.TrimSuffix(msg, "\n"), ": "+w.msg) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("message %q at priority %s not logged; got %q", w.msg, w.priority, got)
+		}
+	}
+}
+
+func TestWithSyslogDialError(t *testing.T) {
+	addr := filepath.Join(tempDir(t), "nonexistent.sock")
+	_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithSyslog("unixgram", addr))
+	if _, ok := err.(*execx.StartError); !ok {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SystemdRunner is a Runner which runs commands as transient systemd
+// units, using systemd-run, for cgroup accounting, journald capture of
+// their logs, and clean teardown of all their processes.
+//
+// By default, commands run as transient service units. systemd-run waits
+// for the unit to finish, and connects the standard I/O of the command to
+// that of systemd-run, such that it can be captured as usual. Services do
+// not inherit the environment or the working directory of the caller:
+// cmd.Env and cmd.Dir, if set, are passed to systemd-run explicitly.
+//
+// If the command fails, the properties of the unit, such as its result
+// and CPU usage, are recorded as a *SystemdUnit detail named
+// "systemd_unit" in the *ExitError. If the unit was killed by the
+// out-of-memory killer, the Reason of the *ExitError is ReasonOOMKilled.
+// If ctx is done before the command completes, the unit is stopped.
+type SystemdRunner struct {
+	// User runs units in the per-user service manager, rather than in
+	// the system service manager.
+	User bool
+
+	// Scope runs commands in transient scope units, rather than in
+	// service units. Scopes run as children of systemd-run, and inherit
+	// its environment and working directory.
+	Scope bool
+
+	// Slice is the slice in which units are placed, if not empty.
+	Slice string
+
+	// Properties holds unit properties, such as "MemoryMax=1G", which
+	// are set using systemd-run --property.
+	Properties []string
+}
+
+// A SystemdUnit describes a transient unit used to run a command.
+type SystemdUnit struct {
+	// Name is the name of the unit.
+	Name string
+
+	// Result is the result of the unit, such as "success",
+	// "exit-code", "timeout" or "oom-kill".
+	Result string
+
+	// ExecMainStatus is the exit status of the main process of a
+	// service unit, or the number of the signal which killed it.
+	ExecMainStatus int
+
+	// CPUUsage is the CPU time consumed by the unit, if CPU accounting
+	// is enabled.
+	CPUUsage time.Duration
+
+	// MemoryPeak is the peak memory usage of the unit, in bytes, if
+	// memory accounting is enabled and supported by systemd.
+	MemoryPeak uint64
+
+	// InvocationID identifies the run of the unit in the journal.
+	InvocationID string
+}
+
+func (u *SystemdUnit) String() string {
+	s := fmt.Sprintf("%s result=%s status=%d", u.Name, u.Result, u.ExecMainStatus)
+	if u.CPUUsage > 0 {
+		s += fmt.Sprintf(" cpu=%v", u.CPUUsage)
+	}
+	if u.MemoryPeak > 0 {
+		s += fmt.Sprintf(" memory_peak=%dkB", u.MemoryPeak/1024)
+	}
+	if u.InvocationID != "" {
+		s += " invocation=" + u.InvocationID
+	}
+	return s
+}
+
+// Run runs cmd in a transient unit, as per Run.
+func (r *SystemdRunner) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	path, err := exec.LookPath("systemd-run")
+	if err != nil {
+		return nil, wrapStart(err, cmd, nil)
+	}
+	var id [8]byte
+	rand.Read(id[:])
+	unit := "execx-" + hex.EncodeToString(id[:])
+	if r.Scope {
+		unit += ".scope"
+	} else {
+		unit += ".service"
+	}
+	dir, _, _ := describe(cmd)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	cmd.Args = append(r.args(unit, dir, cmd), cmd.Args[1:]...)
+	cmd.Path = path
+
+	res, err := Local.Run(ctx, cmd, opts...)
+	if ctx.Err() != nil {
+		r.systemctl("stop", unit)
+	}
+	var ee *ExitError
+	if errors.As(err, &ee) {
+		if u := r.show(unit); u != nil {
+			ee.Details = append(ee.Details, Detail{Key: "systemd_unit", Value: u})
+			if u.Result == "oom-kill" {
+				ee.Reason = ReasonOOMKilled
+			}
+		}
+	}
+	r.systemctl("reset-failed", unit)
+	return res, err
+}
+
+// args returns the arguments to systemd-run which run cmd in the
+// specified unit, followed by the path of cmd.
+func (r *SystemdRunner) args(unit, dir string, cmd *exec.Cmd) []string {
+	args := []string{"systemd-run", "--quiet", "--unit=" + unit}
+	if r.User {
+		args = append(args, "--user")
+	}
+	if r.Scope {
+		args = append(args, "--scope")
+	} else {
+		args = append(args, "--wait", "--pipe", "--working-directory="+dir)
+		for _, kv := range cmd.Env {
+			args = append(args, "--setenv="+kv)
+		}
+	}
+	if r.Slice != "" {
+		args = append(args, "--slice="+r.Slice)
+	}
+	for _, p := range r.Properties {
+		args = append(args, "--property="+p)
+	}
+	return append(args, "--", cmd.Path)
+}
+
+// systemctl runs systemctl with the specified verb on unit, in the
+// appropriate service manager, and returns its standard output.
+func (r *SystemdRunner) systemctl(verb, unit string, extra ...string) ([]byte, error) {
+	args := []string{verb, unit}
+	if r.User {
+		args = append([]string{"--user"}, args...)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return exec.CommandContext(ctx, "systemctl", append(args, extra...)...).Output()
+}
+
+// show returns the properties of unit, or nil if they are not available,
+// for example because the unit was garbage collected.
+func (r *SystemdRunner) show(unit string) *SystemdUnit {
+	out, err := r.systemctl("show", unit, "--property=LoadState,Result,ExecMainStatus,CPUUsageNSec,MemoryPeak,InvocationID")
+	if err != nil {
+		return nil
+	}
+	u := &SystemdUnit{Name: unit}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "LoadState":
+			if value == "not-found" {
+				return nil
+			}
+		case "Result":
+			u.Result = value
+		case "ExecMainStatus":
+			u.ExecMainStatus, _ = strconv.Atoi(value)
+		case "CPUUsageNSec":
+			// Without CPU accounting, the usage is reported as
+			// "[not set]", or as the maximum uint64 by older versions.
+			if n, err := strconv.ParseUint(value, 10, 64); err == nil && n < math.MaxInt64 {
+				u.CPUUsage = time.Duration(n)
+			}
+		case "MemoryPeak":
+			u.MemoryPeak, _ = strconv.ParseUint(value, 10, 64)
+		case "InvocationID":
+			u.InvocationID = value
+		}
+	}
+	return u
+}
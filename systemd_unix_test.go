@@ -0,0 +1,129 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+// fakeSystemd installs fake systemd-run and systemctl programs in PATH.
+// systemd-run runs the command following "--", and systemctl reports the
+// specified properties. Both log their arguments to the returned file.
+func fakeSystemd(t *testing.T, properties string) (log string) {
+	dir := tempDir(t)
+	log = filepath.Join(dir, "log")
+	writeFile(t, filepath.Join(dir, "systemd-run"), `#!/bin/sh
+echo "systemd-run $*" >> `+log+`
+while [ "$1" != "--" ]; do shift; done
+shift
+exec "$@"
+`)
+	writeFile(t, filepath.Join(dir, "systemctl"), `#!/bin/sh
+echo "systemctl $*" >> `+log+`
+case " $* " in
+*" show "*) printf '%s\n' '`+properties+`' ;;
+esac
+`)
+	for _, name := range []string{"systemd-run", "systemctl"} {
+		if err := os.Chmod(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestSystemdRunner(t *testing.T) {
+	log := fakeSystemd(t, "LoadState=loaded\nResult=oom-kill\nExecMainStatus=9\nCPUUsageNSec=1500000000\nMemoryPeak=[not set]\nInvocationID=abc123")
+
+	r := &execx.SystemdRunner{User: true, Properties: []string{"MemoryMax=1G"}}
+	cmd := selfCmd("on")
+	cmd.Env = append(cmd.Env, "FOO=bar")
+	_, err := r.Run(context.Background(), cmd)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.ExitCode() != 1 || string(ee.Result.Stderr) != "whoops" {
+		t.Errorf("got exit code %d, stderr %q", ee.ExitCode(), ee.Result.Stderr)
+	}
+	if ee.Reason != execx.ReasonOOMKilled {
+		t.Errorf("got reason %q, want %q", ee.Reason, execx.ReasonOOMKilled)
+	}
+	v, ok := ee.Detail("systemd_unit")
+	if !ok {
+		t.Fatal("unit not recorded")
+	}
+	u := v.(*execx.SystemdUnit)
+	if u.Result != "oom-kill" || u.ExecMainStatus != 9 || u.CPUUsage != 1500*time.Millisecond || u.MemoryPeak != 0 || u.InvocationID != "abc123" {
+		t.Errorf("got unit %+v", u)
+	}
+	if !strings.HasPrefix(u.Name, "execx-") || !strings.HasSuffix(u.Name, ".service") {
+		t.Errorf("got unit name %q", u.Name)
+	}
+
+	b, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := string(b)
+	for _, want := range []string{
+		"--unit=" + u.Name,
+		" --user ",
+		" --wait --pipe --working-directory=" + mustGetwd(t),
+		" --setenv=FOO=bar ",
+		" --property=MemoryMax=1G -- ",
+		"systemctl --user show " + u.Name,
+		"systemctl --user reset-failed " + u.Name,
+	} {
+		if !strings.Contains(calls, want) {
+			t.Errorf("calls do not contain %q:\n%s", want, calls)
+		}
+	}
+}
+
+func TestSystemdRunnerScope(t *testing.T) {
+	log := fakeSystemd(t, "LoadState=not-found")
+
+	r := &execx.SystemdRunner{Scope: true}
+	cmd := selfCmd("on")
+	_, err := r.Run(context.Background(), cmd)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if _, ok := ee.Detail("systemd_unit"); ok {
+		t.Errorf("recorded a unit which was not found")
+	}
+	b, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := string(b); !strings.Contains(calls, ".scope --scope -- ") || strings.Contains(calls, "--setenv") {
+		t.Errorf("unexpected calls:\n%s", calls)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+// defaultTail is the size of the tails kept of outputs which are written
+// to writers supplied by the caller.
+const defaultTail = 4 << 10
+
+// WithOutputTail configures the size of the tails kept of the standard
+// output and the standard error of the command, when they are written to
+// cmd.Stdout and cmd.Stderr, rather than captured. The caller's writers
+// receive the output as usual, and the last n bytes of each stream are
+// recorded in Result.StdoutTail and Result.StderrTail, such that failures
+// can be explained. If the command fails, and its standard error was not
+// captured, the tail of standard error is used as the Stderr of the
+// *ExitError, and the tail of standard output is attached as a detail
+// named "stdout_tail".
+//
+// By default, tails of 4KB are kept of outputs which flow through pipes
+// serviced by execx. WithOutputTail also keeps tails of outputs written to
+// *os.File destinations, which the command would otherwise write to
+// directly, and of outputs which would otherwise be moved using splice(2),
+// at the cost of copying them. If n is zero, no tails are kept.
+func WithOutputTail(n int) Option {
+	return func(cfg *config) {
+		cfg.tail = n
+		cfg.tailSet = true
+	}
+}
+
+// tailSize returns the size of the output tails configured by cfg.
+func (cfg *config) tailSize() int {
+	if cfg.tailSet {
+		return cfg.tail
+	}
+	return defaultTail
+}
+
+// forceTail reports whether tails must be kept even if that requires
+// copying output which would otherwise be passed on directly.
+func (cfg *config) forceTail() bool {
+	return cfg.tailSet && cfg.tail > 0
+}
+
+// tailBuffer keeps the last bytes written to it.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) > t.max {
+		p = p[len(p)-t.max:]
+	}
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.max; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return n, nil
+}
+
+// bytes returns the tail, or nil if t is nil.
+func (t *tailBuffer) bytes() []byte {
+	if t == nil {
+		return nil
+	}
+	return t.buf
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestOutputTail(t *testing.T) {
+	t.Run("Writer", testOutputTailWriter)
+	t.Run("File", testOutputTailFile)
+}
+
+func testOutputTailWriter(t *testing.T) {
+	var stderr strings.Builder
+	cmd := selfCmd("on")
+	cmd.Stderr = &stderr
+	_, err := execx.Run(context.Background(), cmd)
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if stderr.String() != "whoops" {
+		t.Errorf("caller's writer got %q, want %q", stderr.String(), "whoops")
+	}
+	if string(ee.Stderr) != "whoops" || string(ee.Result.StderrTail) != "whoops" {
+		t.Errorf("got Stderr %q, StderrTail %q, want %q", ee.Stderr, ee.Result.StderrTail, "whoops")
+	}
+	if ee.Result.Stderr != nil {
+		t.Errorf("standard error captured: %q", ee.Result.Stderr)
+	}
+}
+
+func testOutputTailFile(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cmd := selfCmd("on")
+	cmd.Stderr = f
+	_, err = execx.Run(context.Background(), cmd, execx.WithOutputTail(3))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if string(ee.Stderr) != "ops" {
+		t.Errorf("got Stderr %q, want %q", ee.Stderr, "ops")
+	}
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "whoops" {
+		t.Errorf("file got %q, want %q", b, "whoops")
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteTAP writes the steps recorded by r to w in version 13 of the Test
+// Anything Protocol, in which each command is a test point. Commands which
+// fail are reported as "not ok", followed by a YAML diagnostics block.
+// For an *ExitError, the block holds the fields returned by its Fields
+// method. For other errors, it holds the message of the error.
+func (r *Recorder) WriteTAP(w io.Writer) error {
+	steps := r.Steps()
+	tw := newTAPWriter(w, len(steps))
+	for _, s := range steps {
+		tw.point(s.cmdline(), s.Err, "")
+	}
+	return tw.flush()
+}
+
+// WriteTAP writes the outcome of a run of p, as returned by p.Run, to w
+// in version 13 of the Test Anything Protocol, in which each task is a
+// test point, in the order in which tasks were declared. Tasks are reported
+// as per Recorder.WriteTAP. Tasks which were skipped because their
+// dependencies failed are reported using the SKIP directive.
+func (p *Plan) WriteTAP(w io.Writer, results map[string]*Result, err error) error {
+	var perr *PlanError
+	errors.As(err, &perr)
+	skipped := make(map[string]bool)
+	if perr != nil {
+		for _, name := range perr.Skipped {
+			skipped[name] = true
+		}
+	}
+	tw := newTAPWriter(w, len(p.Tasks))
+	for _, t := range p.Tasks {
+		switch {
+		case skipped[t.Name]:
+			tw.point(t.Name, nil, "SKIP dependencies failed")
+		case perr != nil:
+			tw.point(t.Name, perr.Errs[t.Name], "")
+		default:
+			tw.point(t.Name, nil, "")
+		}
+	}
+	return tw.flush()
+}
+
+// tapWriter writes TAP streams.
+type tapWriter struct {
+	bw *bufio.Writer
+	n  int
+}
+
+func newTAPWriter(w io.Writer, plan int) *tapWriter {
+	tw := &tapWriter{bw: bufio.NewWriter(w)}
+	fmt.Fprintf(tw.bw, "TAP version 13\n1..%d\n", plan)
+	return tw
+}
+
+// point writes a test point described by desc, which failed with err, if
+// err is not nil, followed by the specified directive, if any.
+func (tw *tapWriter) point(desc string, err error, directive string) {
+	tw.n++
+	status := "ok"
+	if err != nil {
+		status = "not ok"
+	}
+	fmt.Fprintf(tw.bw, "%s %d - %s", status, tw.n, tapEscape(desc))
+	if directive != "" {
+		fmt.Fprintf(tw.bw, " # %s", directive)
+	}
+	tw.bw.WriteByte('\n')
+	if err == nil {
+		return
+	}
+	var fields map[string]interface{}
+	var ee *ExitError
+	if errors.As(err, &ee) {
+		fields = ee.Fields()
+	} else {
+		fields = map[string]interface{}{"message": err.Error()}
+	}
+	tw.bw.WriteString("  ---\n")
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeYAMLField(tw.bw, "  ", k, fields[k])
+	}
+	tw.bw.WriteString("  ...\n")
+}
+
+func (tw *tapWriter) flush() error {
+	return tw.bw.Flush()
+}
+
+// tapEscape escapes the characters in a test point description which
+// would otherwise start a directive.
+func tapEscape(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "#", "\\#", "\n", " ").Replace(s)
+}
+
+// writeYAMLField writes key and value to w, as a YAML mapping entry,
+// indented by indent. Numbers and booleans are written as such, slices
+// are written as flow sequences, multi-line strings are written as
+// literal block scalars, and all other values are written as quoted
+// strings, formatted using "%v".
+func writeYAMLField(w *bufio.Writer, indent, key string, value interface{}) {
+	fmt.Fprintf(w, "%s%s: ", indent, yamlKey(key))
+	rv := reflect.ValueOf(value)
+	switch {
+	case value == nil:
+		w.WriteString("~\n")
+	case rv.Kind() == reflect.String && strings.Contains(rv.String(), "\n"):
+		// The indentation indicator allows the first line to start
+		// with spaces.
+		w.WriteString("|2-\n")
+		for _, line := range strings.Split(strings.TrimRight(rv.String(), "\n"), "\n") {
+			fmt.Fprintf(w, "%s  %s\n", indent, line)
+		}
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8:
+		elems := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			elems = append(elems, yamlScalar(rv.Index(i).Interface()))
+		}
+		fmt.Fprintf(w, "[%s]\n", strings.Join(elems, ", "))
+	default:
+		fmt.Fprintf(w, "%s\n", yamlScalar(value))
+	}
+}
+
+// yamlScalar returns v as a YAML scalar.
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, bool:
+		return fmt.Sprint(v)
+	default:
+		return strconv.Quote(fmt.Sprint(v))
+	}
+}
+
+// yamlKey returns k as a YAML mapping key, quoting it if necessary.
+func yamlKey(k string) string {
+	for _, r := range k {
+		if !(r == '_' || r == '-' || r == '.' || '0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			return strconv.Quote(k)
+		}
+	}
+	if k == "" {
+		return `""`
+	}
+	return k
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestRecorderWriteTAP(t *testing.T) {
+	rec := new(execx.Recorder)
+	ctx := execx.WithRunner(context.Background(), rec)
+
+	if _, err := execx.Run(ctx, selfCmd("echo")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execx.Run(ctx, selfCmd("on")); err == nil {
+		t.Fatal("command did not fail")
+	}
+	if _, err := execx.Run(ctx, exec.Command("/nonexistent/command")); err == nil {
+		t.Fatal("command started")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := rec.WriteTAP(buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"TAP version 13\n1..3\n",
+		"\nok 1 - ",
+		"\nnot ok 2 - ",
+		"\n  ---\n",
+		"\n  exit_code: 1\n",
+		"\n  stderr: \"whoops\"\n",
+		"\nnot ok 3 - /nonexistent/command\n  ---\n  message: ",
+		"\n  ...\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("TAP output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPlanWriteTAP(t *testing.T) {
+	r := execx.RunnerFunc(func(ctx context.Context, cmd *exec.Cmd, opts ...execx.Option) (*execx.Result, error) {
+		if cmd.Args[1] == "broken" {
+			return nil, errors.New("broke\nbadly")
+		}
+		return &execx.Result{}, nil
+	})
+	plan, err := execx.NewPlan(
+		&execx.Task{Name: "fetch", Argv: []string{"run", "fetch"}},
+		&execx.Task{Name: "broken", Argv: []string{"run", "broken"}, Deps: []string{"fetch"}},
+		&execx.Task{Name: "deploy#1", Argv: []string{"run", "deploy"}, Deps: []string{"broken"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := plan.Run(execx.WithRunner(context.Background(), r))
+	buf := new(bytes.Buffer)
+	if err := plan.WriteTAP(buf, results, err); err != nil {
+		t.Fatal(err)
+	}
+	want := `TAP version 13
+1..3
+ok 1 - fetch
+not ok 2 - broken
+  ---
+  message: |2-
+    broke
+    badly
+  ...
+ok 3 - deploy\#1 # SKIP dependencies failed
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
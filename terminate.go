@@ -0,0 +1,74 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// errNotStarted is returned when trying to terminate a command which has
+// not been started.
+var errNotStarted = errors.New("execx: process not started")
+
+// Terminate asks the process started by cmd to exit gracefully, using the
+// mechanism appropriate for the platform:
+//
+// On Unix systems, Terminate sends SIGTERM.
+//
+// On Windows, if the process was started in a new process group, using the
+// CREATE_NEW_PROCESS_GROUP creation flag, such as by WithSpawnFlags,
+// Terminate sends it a CTRL_BREAK_EVENT. Otherwise,
+// Terminate posts WM_CLOSE to the top-level windows owned by the process.
+// If the process has no windows, Terminate returns an error.
+//
+// Terminate does not wait for the process to exit. Processes are free to
+// ignore the request. See (*Handle).Stop for a way to escalate to Kill.
+func Terminate(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return errNotStarted
+	}
+	return terminate(cmd)
+}
+
+// WithGracePeriod configures the command to be terminated gracefully,
+// using Terminate, when its context is done or it times out. If the
+// process does not exit within the grace period, it is killed.
+func WithGracePeriod(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.grace = d
+	}
+}
+
+// Stop asks the process to exit gracefully, using Terminate. If the
+// process does not exit within the grace period, or if it cannot be
+// asked to exit gracefully, Stop kills it. Stop returns once the process
+// has exited. It does not wait for its output to be consumed.
+func (h *Handle) Stop(grace time.Duration) {
+	if err := h.terminate(); err != nil {
+		h.kill()
+		<-h.exited
+		return
+	}
+	t := h.clock.NewTimer(grace)
+	defer t.Stop()
+	select {
+	case <-h.exited:
+	case <-t.C():
+		h.kill()
+		<-h.exited
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestTerminate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test relies on SIGTERM")
+	}
+	t.Run("Graceful", testTerminateGraceful)
+	t.Run("Escalate", testTerminateEscalate)
+	t.Run("NotStarted", testTerminateNotStarted)
+}
+
+func testTerminateGraceful(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("sigterm"),
+		execx.WithTimeout(300*time.Millisecond),
+		execx.WithGracePeriod(5*time.Second))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	if ee.ExitCode() != 3 || string(ee.Stderr) != "terminated" {
+		t.Fatalf("process didn't exit gracefully: %v", ee)
+	}
+}
+
+func testTerminateEscalate(t *testing.T) {
+	h, err := execx.Start(context.Background(), selfCmd("hang"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	h.Stop(100 * time.Millisecond)
+	_, err = h.Wait()
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %T, want %T", err, (*execx.ExitError)(nil))
+	}
+	if ee.ExitCode() != -1 {
+		t.Fatalf("process wasn't killed: %v", ee)
+	}
+}
+
+func testTerminateNotStarted(t *testing.T) {
+	if err := execx.Terminate(selfCmd("hang")); err == nil {
+		t.Fatal("terminated command which wasn't started")
+	}
+}
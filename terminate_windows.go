@@ -0,0 +1,109 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+	user32   = syscall.NewLazyDLL("user32.dll")
+
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+	procEnumWindows              = user32.NewProc("EnumWindows")
+	procGetWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
+	procPostMessageW             = user32.NewProc("PostMessageW")
+)
+
+const (
+	ctrlBreakEvent = 1
+	wmClose        = 0x0010
+)
+
+// errNoWindows is returned by terminate if the process cannot be asked to
+// exit gracefully, because it has no windows.
+var errNoWindows = errors.New("execx: process has no console group or windows to signal")
+
+func terminate(cmd *exec.Cmd) error {
+	pid := uint32(cmd.Process.Pid)
+	attr := cmd.SysProcAttr
+	if attr != nil && attr.CreationFlags&syscall.CREATE_NEW_PROCESS_GROUP != 0 {
+		r, _, err := procGenerateConsoleCtrlEvent.Call(ctrlBreakEvent, uintptr(pid))
+		if r == 0 {
+			return err
+		}
+		return nil
+	}
+	return closeWindows(pid)
+}
+
+// closeWindowsCalls holds the state of the calls to closeWindows in
+// progress, by the ID passed to closeWindowsCallback as its lparam.
+var closeWindowsCalls struct {
+	sync.Mutex
+	next uintptr
+	m    map[uintptr]*closeWindowsState
+}
+
+type closeWindowsState struct {
+	pid    uint32
+	posted bool
+}
+
+// closeWindowsCallback is the EnumWindows callback used by closeWindows.
+// It is created once, since callbacks are never freed, and the number of
+// callbacks a process can create is limited.
+var closeWindowsCallback = syscall.NewCallback(func(hwnd, lparam uintptr) uintptr {
+	closeWindowsCalls.Lock()
+	st := closeWindowsCalls.m[lparam]
+	closeWindowsCalls.Unlock()
+	var owner uint32
+	procGetWindowThreadProcessId.Call(hwnd, uintptr(unsafe.Pointer(&owner)))
+	if st != nil && owner == st.pid {
+		procPostMessageW.Call(hwnd, wmClose, 0, 0)
+		st.posted = true
+	}
+	return 1 // continue enumeration
+})
+
+// closeWindows posts WM_CLOSE to the top-level windows owned by the
+// process with the specified pid.
+func closeWindows(pid uint32) error {
+	st := &closeWindowsState{pid: pid}
+	closeWindowsCalls.Lock()
+	if closeWindowsCalls.m == nil {
+		closeWindowsCalls.m = make(map[uintptr]*closeWindowsState)
+	}
+	closeWindowsCalls.next++
+	id := closeWindowsCalls.next
+	closeWindowsCalls.m[id] = st
+	closeWindowsCalls.Unlock()
+
+	// EnumWindows calls the callback synchronously, on this thread.
+	procEnumWindows.Call(closeWindowsCallback, id)
+
+	closeWindowsCalls.Lock()
+	delete(closeWindowsCalls.m, id)
+	closeWindowsCalls.Unlock()
+	if !st.posted {
+		return errNoWindows
+	}
+	return nil
+}
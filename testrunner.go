@@ -0,0 +1,102 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// TB is the subset of testing.TB used by Test.
+type TB interface {
+	Helper()
+	Cleanup(func())
+	Logf(format string, args ...interface{})
+}
+
+// testStopGrace is the grace period given to processes which are still
+// running when a test finishes.
+const testStopGrace = time.Second
+
+// TestRunner is a Runner for use in tests. See Test.
+type TestRunner struct {
+	t TB
+
+	mu      sync.Mutex
+	handles []*Handle
+}
+
+// Test returns a TestRunner bound to t. Commands run or started using the
+// returned runner are tied to the lifetime of t: when t finishes, processes
+// which are still running are stopped, as if by (*Handle).Stop with a grace
+// period of one second, and reaped. Failures are reported using t.Logf,
+// in the detailed "%+v" format.
+func Test(t TB) *TestRunner {
+	tr := &TestRunner{t: t}
+	t.Cleanup(tr.cleanup)
+	return tr
+}
+
+// Start starts cmd, as per the package-level Start function.
+func (tr *TestRunner) Start(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Handle, error) {
+	tr.t.Helper()
+
+	h, err := Start(ctx, cmd, opts...)
+	if err != nil {
+		tr.t.Logf("%+v", err)
+		return nil, err
+	}
+	tr.mu.Lock()
+	tr.handles = append(tr.handles, h)
+	tr.mu.Unlock()
+	return h, nil
+}
+
+// Run runs cmd, as per Start followed by Wait.
+func (tr *TestRunner) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	tr.t.Helper()
+
+	h, err := tr.Start(ctx, cmd, opts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.Wait()
+	if err != nil {
+		tr.t.Logf("%+v", err)
+	}
+	return res, err
+}
+
+func (tr *TestRunner) cleanup() {
+	tr.mu.Lock()
+	handles := tr.handles
+	tr.handles = nil
+	tr.mu.Unlock()
+
+	for _, h := range handles {
+		select {
+		case <-h.Done():
+			continue
+		default:
+		}
+		tr.t.Logf("stopping leaked process %s", Cmdline(h.cmd))
+		h.Stop(testStopGrace)
+		if _, err := h.Wait(); err != nil {
+			tr.t.Logf("%+v", err)
+		}
+	}
+}
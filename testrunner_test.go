@@ -0,0 +1,82 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestTestRunner(t *testing.T) {
+	t.Run("Run", testTestRunnerRun)
+	t.Run("Leak", testTestRunnerLeak)
+}
+
+func testTestRunnerRun(t *testing.T) {
+	ft := new(fakeTB)
+	tr := execx.Test(ft)
+	if _, err := tr.Run(context.Background(), selfCmd("on")); err == nil {
+		t.Fatal("command succeeded")
+	}
+	if len(ft.logs) != 1 || !strings.Contains(ft.logs[0], "timeline:") {
+		t.Fatalf("failure not logged in detail: %q", ft.logs)
+	}
+}
+
+func testTestRunnerLeak(t *testing.T) {
+	ft := new(fakeTB)
+	tr := execx.Test(ft)
+	h, err := tr.Start(context.Background(), selfCmd("hang"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft.cleanup()
+	select {
+	case <-h.Done():
+	default:
+		t.Fatal("leaked process not reaped")
+	}
+	if len(ft.logs) != 2 || !strings.HasPrefix(ft.logs[0], "stopping leaked process") {
+		t.Fatalf("leak not logged: %q", ft.logs)
+	}
+}
+
+var _ execx.TB = (*testing.T)(nil)
+
+// fakeTB records logs and cleanup functions.
+type fakeTB struct {
+	logs     []string
+	cleanups []func()
+}
+
+func (ft *fakeTB) Helper() {}
+
+func (ft *fakeTB) Cleanup(f func()) {
+	ft.cleanups = append(ft.cleanups, f)
+}
+
+func (ft *fakeTB) Logf(format string, args ...interface{}) {
+	ft.logs = append(ft.logs, fmt.Sprintf(format, args...))
+}
+
+func (ft *fakeTB) cleanup() {
+	for i := len(ft.cleanups) - 1; i >= 0; i-- {
+		ft.cleanups[i]()
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Timeline records the times at which lifecycle events occurred during
+// the execution of a command run by Run or Start. Events which did not
+// occur, or which could not be observed, hold the zero time.
+type Timeline struct {
+	// Created is the time Run or Start was called.
+	Created time.Time
+
+	// Start is the time exec.Cmd.Start was called.
+	Start time.Time
+
+	// Running is the time the process started running.
+	Running time.Time
+
+	// FirstStdout is the time the first byte of standard output
+	// was read from the process.
+	FirstStdout time.Time
+
+	// FirstStderr is the time the first byte of standard error
+	// was read from the process.
+	FirstStderr time.Time
+
+	// StdinEOF is the time the end of standard input was reached.
+	StdinEOF time.Time
+
+	// Exited is the time the process exited.
+	Exited time.Time
+
+	// WaitReturned is the time all output of the process was consumed,
+	// and Wait returned.
+	WaitReturned time.Time
+
+	// Endpoints records the state transitions of the endpoints created
+	// by WithUnixSocket and WithNamedPipe, in order.
+	Endpoints []EndpointEvent
+}
+
+// format writes t to w, one event per line, with times relative to
+// t.Created, in milliseconds. Event names are translated using p.
+func (t *Timeline) format(w io.Writer, p printer) {
+	fmt.Fprintf(w, "%s\n", p.sprintf("timeline:"))
+	for _, ev := range t.events(p) {
+		fmt.Fprintf(w, "\t%-14s +%.3fms\n", ev.name+":", ev.ms)
+	}
+}
+
+// timelineEvent is an event which occurred, named and timed relative to
+// Timeline.Created, in milliseconds.
+type timelineEvent struct {
+	name string
+	ms   float64
+}
+
+// events returns the events which occurred, in order. Endpoint events
+// are placed among the others according to their time. Event names are
+// translated using p.
+func (t *Timeline) events(p printer) []timelineEvent {
+	all := []struct {
+		name string
+		t    time.Time
+	}{
+		{"created", t.Created},
+		{"start", t.Start},
+		{"running", t.Running},
+		{"first stdout", t.FirstStdout},
+		{"first stderr", t.FirstStderr},
+		{"stdin eof", t.StdinEOF},
+		{"exited", t.Exited},
+		{"wait returned", t.WaitReturned},
+	}
+	var events []timelineEvent
+	endpoints := t.Endpoints
+	for _, ev := range all {
+		if ev.t.IsZero() {
+			continue
+		}
+		for ; len(endpoints) > 0 && endpoints[0].Time.Before(ev.t); endpoints = endpoints[1:] {
+			events = append(events, t.endpointEvent(endpoints[0], p))
+		}
+		ms := float64(ev.t.Sub(t.Created)) / float64(time.Millisecond)
+		events = append(events, timelineEvent{name: p.sprintf(ev.name), ms: ms})
+	}
+	for _, ev := range endpoints {
+		events = append(events, t.endpointEvent(ev, p))
+	}
+	return events
+}
+
+// endpointEvent returns ev as a timelineEvent, named using p.
+func (t *Timeline) endpointEvent(ev EndpointEvent, p printer) timelineEvent {
+	ms := float64(ev.Time.Sub(t.Created)) / float64(time.Millisecond)
+	return timelineEvent{name: p.sprintf("%s endpoint %v", ev.Stream, ev.State), ms: ms}
+}
+
+// SpawnLatency returns the time it took to create the process: the time
+// elapsed between the call to exec.Cmd.Start and the time the process
+// started running. SpawnLatency returns zero if either event did not
+// occur.
+//
+// On Linux, the Go runtime already creates processes using the equivalent
+// of vfork, which does not copy the address space of the parent. Spawn
+// latency still grows with the number of threads and open files of the
+// parent. Programs which start many commands, and which are large, can
+// measure it, and compare it to that of commands started from a small
+// helper process, using package acln.ro/execx/broker.
+func (t *Timeline) SpawnLatency() time.Duration {
+	if t.Start.IsZero() || t.Running.IsZero() {
+		return 0
+	}
+	return t.Running.Sub(t.Start)
+}
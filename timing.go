@@ -0,0 +1,152 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Timing breaks down the wall time of an operation which ran one or more
+// commands, such as a command which was retried, or a pipeline, such that
+// investigations of slow operations see where the time went.
+type Timing struct {
+	// Total is the wall time of the operation, from the first command
+	// being started, or waiting to start, to the last one completing.
+	Total time.Duration
+
+	// Executing is the time during which processes were running. Time
+	// during which several processes ran concurrently counts once.
+	Executing time.Duration
+
+	// Queued is the time spent waiting for locks taken by Exclusive, and
+	// for quotas set by WithQuota, before processes could start.
+	Queued time.Duration
+
+	// RetryWait is the time between commands, during which none of them
+	// was running or waiting to start, such as backoff between attempts.
+	RetryWait time.Duration
+
+	// Attempts is the number of commands run.
+	Attempts int
+}
+
+// Overhead returns the time not accounted for by the other fields, such
+// as the time spent starting processes, and draining their output after
+// they exited.
+func (t Timing) Overhead() time.Duration {
+	d := t.Total - t.Executing - t.Queued - t.RetryWait
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (t Timing) String() string {
+	parts := []string{"executing " + t.Executing.String()}
+	if t.Queued > 0 {
+		parts = append(parts, "queued "+t.Queued.String())
+	}
+	if t.RetryWait > 0 {
+		parts = append(parts, "waiting to retry "+t.RetryWait.String())
+	}
+	if d := t.Overhead(); d > 0 {
+		parts = append(parts, "overhead "+d.String())
+	}
+	attempts := "1 command"
+	if t.Attempts != 1 {
+		attempts = fmt.Sprintf("%d commands", t.Attempts)
+	}
+	return fmt.Sprintf("total %v over %s: %s", t.Total, attempts, strings.Join(parts, ", "))
+}
+
+// TimingOf returns the consolidated timing of the runs described by
+// results, such as the attempts of a command which was retried, or the
+// stages of a pipeline, based on their timelines. Nil results, of
+// commands which failed to start, are ignored.
+func TimingOf(results ...*Result) Timing {
+	var whole, exec, queued []span
+	for _, res := range results {
+		if res == nil {
+			continue
+		}
+		tl := res.Timeline
+		start := tl.Created.Add(-res.LockWait)
+		whole = append(whole, span{start, tl.WaitReturned})
+		queued = append(queued, span{start, tl.Created.Add(res.QuotaWait)})
+		if !tl.Running.IsZero() && !tl.Exited.IsZero() {
+			exec = append(exec, span{tl.Running, tl.Exited})
+		}
+	}
+	if len(whole) == 0 {
+		return Timing{}
+	}
+	first, last := whole[0].start, whole[0].end
+	for _, s := range whole[1:] {
+		if s.start.Before(first) {
+			first = s.start
+		}
+		if s.end.After(last) {
+			last = s.end
+		}
+	}
+	t := Timing{
+		Total:     last.Sub(first),
+		Executing: covered(exec),
+		Queued:    covered(queued),
+		Attempts:  len(whole),
+	}
+	t.RetryWait = t.Total - covered(whole)
+	return t
+}
+
+// span is an interval of time.
+type span struct {
+	start, end time.Time
+}
+
+// covered returns the total time covered by spans, counting the time
+// covered by more than one span once.
+func covered(spans []span) time.Duration {
+	spans = append([]span(nil), spans...)
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start.Before(spans[j].start)
+	})
+	var d time.Duration
+	var cur span
+	for _, s := range spans {
+		if !s.end.After(s.start) {
+			continue
+		}
+		if cur.end.IsZero() || s.start.After(cur.end) {
+			d += cur.end.Sub(cur.start)
+			cur = s
+		} else if s.end.After(cur.end) {
+			cur.end = s.end
+		}
+	}
+	return d + cur.end.Sub(cur.start)
+}
+
+// withTiming records the consolidated timing of results as a detail named
+// "timing" in err, as per WithDetail.
+func withTiming(err error, results ...*Result) error {
+	if err == nil {
+		return nil
+	}
+	return WithDetail(err, "timing", TimingOf(results...))
+}
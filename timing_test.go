@@ -0,0 +1,100 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+// timedResult returns a Result whose process ran from start+run to
+// start+exit, and whose Wait returned at start+done, in milliseconds.
+func timedResult(start time.Time, run, exit, done int) *execx.Result {
+	ms := func(n int) time.Time { return start.Add(time.Duration(n) * time.Millisecond) }
+	return &execx.Result{Timeline: execx.Timeline{
+		Created:      start,
+		Running:      ms(run),
+		Exited:       ms(exit),
+		WaitReturned: ms(done),
+	}}
+}
+
+func TestTimingOf(t *testing.T) {
+	t0 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+
+	t.Run("Retries", func(t *testing.T) {
+		first := timedResult(t0, 10, 100, 110)
+		second := timedResult(t0.Add(500*ms), 20, 220, 230)
+		second.QuotaWait = 20 * ms
+		got := execx.TimingOf(first, nil, second)
+		want := execx.Timing{
+			Total:     730 * ms,
+			Executing: 290 * ms,
+			Queued:    20 * ms,
+			RetryWait: 390 * ms,
+			Attempts:  2,
+		}
+		if got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+		if got.Overhead() != 30*ms {
+			t.Errorf("got overhead %v, want 30ms", got.Overhead())
+		}
+	})
+	t.Run("Pipeline", func(t *testing.T) {
+		a := timedResult(t0, 10, 100, 110)
+		b := timedResult(t0.Add(5*ms), 10, 300, 310)
+		got := execx.TimingOf(a, b)
+		want := execx.Timing{
+			Total:     315 * ms,
+			Executing: 295 * ms,
+			Attempts:  2,
+		}
+		if got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+	t.Run("Lock", func(t *testing.T) {
+		res := timedResult(t0, 10, 100, 110)
+		res.LockWait = 50 * ms
+		got := execx.TimingOf(res)
+		if got.Total != 160*ms || got.Queued != 50*ms || got.RetryWait != 0 {
+			t.Errorf("got %+v, want 160ms total, 50ms queued", got)
+		}
+	})
+}
+
+func TestPipelineTiming(t *testing.T) {
+	p := &execx.Pipeline{Cmds: []*exec.Cmd{selfCmd("echo"), exec.Command("false")}}
+	_, err := p.Run(context.Background())
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	v, ok := ee.Detail("timing")
+	if !ok {
+		t.Fatal("missing timing detail")
+	}
+	timing := v.(execx.Timing)
+	if timing.Attempts != 2 || timing.Total <= 0 || timing.Executing > timing.Total {
+		t.Errorf("implausible timing %v", timing)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// A ToolCache caches the resolution of executables in $PATH, along with
+// their versions, keyed by a hash of $PATH and the name of the tool, such
+// that tight loops which run the same tools avoid repeated searches of
+// $PATH, and repeated version probes. Unlike a PinnedResolver, a ToolCache
+// follows changes to $PATH: when $PATH changes, the entries cached for its
+// previous value are discarded. Failures to resolve are cached as well, so
+// a tool installed into a directory already in $PATH is not found until
+// $PATH changes, or until Reset is called.
+//
+// Hits and misses are counted in the statistics of the cache, and in the
+// counters returned by ReadStats.
+//
+// A ToolCache is safe for concurrent use by multiple goroutines.
+type ToolCache struct {
+	// VersionArgs holds the arguments of the command run by Version to
+	// probe the version of a tool. If VersionArgs is empty, the
+	// "--version" argument is used.
+	VersionArgs []string
+
+	mu       sync.Mutex
+	pathHash uint64
+	tools    map[string]*cachedTool
+	stats    ToolCacheStats
+}
+
+// CachedPath is a ToolCache which locates executables in $PATH. To use it
+// to resolve executables, use WithResolver(CachedPath).
+var CachedPath = new(ToolCache)
+
+// ToolCacheStats holds statistics about a ToolCache.
+type ToolCacheStats struct {
+	// Hits is the number of resolutions and versions served from the
+	// cache.
+	Hits int64
+
+	// Misses is the number of resolutions and versions which were not
+	// cached.
+	Misses int64
+
+	// Invalidations is the number of times the cache was discarded
+	// because $PATH changed.
+	Invalidations int64
+}
+
+// ToolVersionError records a failure to probe the version of a tool.
+type ToolVersionError struct {
+	// Tool is the name of the tool.
+	Tool string
+
+	// Err is the error the tool failed to resolve with, or the error
+	// the probe command failed with, such as an *ExitError.
+	Err error
+}
+
+func (e *ToolVersionError) Error() string {
+	return fmt.Sprintf("execx: probing the version of %s: %v", e.Tool, e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *ToolVersionError) Unwrap() error {
+	return e.Err
+}
+
+// cachedTool is the cached resolution and version of a tool.
+type cachedTool struct {
+	res   *Resolution
+	err   error
+	probe *versionProbe // nil until the version is requested
+}
+
+// versionProbe is the outcome of a version probe, shared by concurrent
+// callers.
+type versionProbe struct {
+	done    chan struct{} // closed when the probe completes
+	version string
+	err     error
+}
+
+// Resolve locates name in $PATH, using exec.LookPath, unless its resolution
+// is cached for the current value of $PATH.
+func (c *ToolCache) Resolve(name string) (*Resolution, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, hit := c.lookup(name)
+	c.count(hit)
+	return t.res, t.err
+}
+
+// Version returns the version of the tool name resolves to in $PATH, which
+// is the first line of the output of the tool when run with VersionArgs,
+// using Run, and thus the runner carried by ctx. If the tool prints nothing
+// to its standard output, the first line of its standard error is used.
+// Versions are cached along with the resolution of the tool, such that the
+// probe runs once per tool and value of $PATH, even when Version is called
+// concurrently.
+//
+// If the tool cannot be resolved, or if the probe fails, Version returns a
+// *ToolVersionError. Such errors are cached too, except for the errors of
+// the context.
+func (c *ToolCache) Version(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	t, _ := c.lookup(name)
+	p := t.probe
+	hit := p != nil
+	c.count(hit)
+	if !hit {
+		p = &versionProbe{done: make(chan struct{})}
+		t.probe = p
+	}
+	args := c.VersionArgs
+	c.mu.Unlock()
+	if !hit {
+		p.version, p.err = probeVersion(ctx, name, t, args)
+		if p.err != nil && ctx.Err() != nil {
+			// Let the next caller try again.
+			c.mu.Lock()
+			if t.probe == p {
+				t.probe = nil
+			}
+			c.mu.Unlock()
+		}
+		close(p.done)
+	}
+	select {
+	case <-p.done:
+		return p.version, p.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Stats returns statistics about c.
+func (c *ToolCache) Stats() ToolCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Reset discards the entries cached by c.
+func (c *ToolCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tools = nil
+}
+
+// lookup returns the entry for name, resolving name if the entry is not
+// cached for the current value of $PATH, and reports whether the entry was
+// cached. c.mu must be held.
+func (c *ToolCache) lookup(name string) (t *cachedTool, cached bool) {
+	h := fnv.New64a()
+	h.Write([]byte(os.Getenv("PATH")))
+	if sum := h.Sum64(); sum != c.pathHash || c.tools == nil {
+		if c.tools != nil {
+			c.stats.Invalidations++
+		}
+		c.pathHash = sum
+		c.tools = make(map[string]*cachedTool)
+	}
+	if t, ok := c.tools[name]; ok {
+		return t, true
+	}
+	t = new(cachedTool)
+	path, err := exec.LookPath(name)
+	if err != nil {
+		t.err = err
+	} else {
+		t.res = &Resolution{Name: name, Path: path, Via: []string{"$PATH"}}
+	}
+	c.tools[name] = t
+	return t, false
+}
+
+// count counts a hit or a miss.
+func (c *ToolCache) count(hit bool) {
+	if hit {
+		c.stats.Hits++
+		stats.toolHits.Add(1)
+	} else {
+		c.stats.Misses++
+		stats.toolMisses.Add(1)
+	}
+}
+
+// probeVersion runs the version probe of the tool described by t.
+func probeVersion(ctx context.Context, name string, t *cachedTool, args []string) (string, error) {
+	if t.err != nil {
+		return "", &ToolVersionError{Tool: name, Err: t.err}
+	}
+	if len(args) == 0 {
+		args = []string{"--version"}
+	}
+	res, err := Run(ctx, exec.Command(t.res.Path, args...))
+	if err != nil {
+		return "", &ToolVersionError{Tool: name, Err: err}
+	}
+	if v := firstLine(res.Stdout); v != "" {
+		return v, nil
+	}
+	return firstLine(res.Stderr), nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestToolCache(t *testing.T) {
+	dir1, dir2 := tempDir(t), tempDir(t)
+	probes := filepath.Join(tempDir(t), "probes")
+	writeExecutable(t, filepath.Join(dir1, "tool"), "#!/bin/sh\necho x >> "+probes+"\necho tool 1.2.3\necho built today\n")
+	writeExecutable(t, filepath.Join(dir2, "tool"), "#!/bin/sh\necho tool 2.0.0 >&2\n")
+	t.Setenv("PATH", dir1)
+
+	c := new(execx.ToolCache)
+	for i := 0; i < 3; i++ {
+		res, err := c.Resolve("tool")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(dir1, "tool"); res.Path != want {
+			t.Fatalf("got %s, want %s", res.Path, want)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Version(context.Background(), "tool")
+			if err != nil {
+				t.Error(err)
+			} else if v != "tool 1.2.3" {
+				t.Errorf("got version %q, want %q", v, "tool 1.2.3")
+			}
+		}()
+	}
+	wg.Wait()
+	if b, _ := ioutil.ReadFile(probes); len(b) != len("x\n") {
+		t.Errorf("version probed %d times, want once", len(b)/2)
+	}
+	if got, want := c.Stats(), (execx.ToolCacheStats{Hits: 5, Misses: 2}); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+
+	// Changing $PATH discards the cache.
+	t.Setenv("PATH", dir2+string(filepath.ListSeparator)+dir1)
+	v, err := c.Version(context.Background(), "tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "tool 2.0.0" {
+		t.Errorf("got version %q after changing $PATH, want %q", v, "tool 2.0.0")
+	}
+	if got := c.Stats().Invalidations; got != 1 {
+		t.Errorf("got %d invalidations, want 1", got)
+	}
+}
+
+func TestToolCacheNotFound(t *testing.T) {
+	t.Setenv("PATH", tempDir(t))
+	c := new(execx.ToolCache)
+	if _, err := c.Resolve("missing"); err == nil {
+		t.Fatal("resolved a missing executable")
+	}
+	_, err := c.Version(context.Background(), "missing")
+	if _, ok := err.(*execx.ToolVersionError); !ok {
+		t.Fatalf("got %v, want *ToolVersionError", err)
+	}
+	if got, want := c.Stats(), (execx.ToolCacheStats{Hits: 0, Misses: 2}); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A ResourceTracker tracks the temporary resources created on behalf of
+// commands, such as the scripts written by RunScript, the trace files
+// written by Debug, the home directories created by IsolatedHome,
+// and the sockets and pipes created by WithUnixSocket and WithNamedPipe,
+// such that they are cleaned up on every path, including panics and the
+// cancellation of contexts, and such that resources which were not
+// cleaned up can be reported, and removed, by Cleanup.
+//
+// The tracker used for a command is carried by the context passed to Run
+// or Start. See WithResourceTracker. Helpers outside of this package may
+// register their own resources using Track. Tests can check that no
+// resources were leaked using exectest.VerifyResources.
+//
+// The zero ResourceTracker is ready to use. A ResourceTracker is safe for
+// concurrent use by multiple goroutines.
+type ResourceTracker struct {
+	mu   sync.Mutex
+	live map[*Tracked]struct{}
+}
+
+// DefaultTracker is the ResourceTracker used when the context of a command
+// carries none.
+var DefaultTracker = new(ResourceTracker)
+
+type trackerKey struct{}
+
+// WithResourceTracker returns a copy of ctx carrying t. The temporary
+// resources of commands run using the returned context, or contexts
+// derived from it, are tracked by t.
+func WithResourceTracker(ctx context.Context, t *ResourceTracker) context.Context {
+	return context.WithValue(ctx, trackerKey{}, t)
+}
+
+// ResourceTrackerFrom returns the ResourceTracker carried by ctx, or
+// DefaultTracker if ctx carries none.
+func ResourceTrackerFrom(ctx context.Context) *ResourceTracker {
+	if t, ok := ctx.Value(trackerKey{}).(*ResourceTracker); ok && t != nil {
+		return t
+	}
+	return DefaultTracker
+}
+
+// A TempResource describes a temporary resource.
+type TempResource struct {
+	// Kind describes the resource, such as "script" or "home".
+	Kind string
+
+	// Path is the path of the resource.
+	Path string
+
+	// Created is the time the resource was registered.
+	Created time.Time
+}
+
+// Tracked is a resource registered with a ResourceTracker.
+type Tracked struct {
+	TempResource
+
+	t       *ResourceTracker
+	cleanup func() error
+	once    sync.Once
+	err     error
+}
+
+// Track registers the resource at path, which cleanup removes, with t.
+// The caller must arrange for Release or Keep to be called on every path,
+// typically using defer, right after the resource is created.
+func (t *ResourceTracker) Track(kind, path string, cleanup func() error) *Tracked {
+	r := &Tracked{
+		TempResource: TempResource{Kind: kind, Path: path, Created: time.Now()},
+		t:            t,
+		cleanup:      cleanup,
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.live == nil {
+		t.live = make(map[*Tracked]struct{})
+	}
+	t.live[r] = struct{}{}
+	return r
+}
+
+// Release cleans up the resource, and stops tracking it. Release may be
+// called multiple times: the resource is cleaned up once, and subsequent
+// calls return the error of the first. Release is a no-op if r is nil.
+func (r *Tracked) Release() error {
+	if r == nil {
+		return nil
+	}
+	r.once.Do(func() {
+		r.err = r.cleanup()
+		r.untrack()
+	})
+	return r.err
+}
+
+// Keep stops tracking the resource without cleaning it up, such as when
+// it is handed over to the caller, or kept for inspection. Keep is a no-op
+// if r is nil, or if the resource was already released.
+func (r *Tracked) Keep() {
+	if r == nil {
+		return
+	}
+	r.once.Do(r.untrack)
+}
+
+func (r *Tracked) untrack() {
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+	delete(r.t.live, r)
+}
+
+// Live returns the resources tracked by t which were neither released nor
+// kept, oldest first.
+func (t *ResourceTracker) Live() []TempResource {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	live := make([]TempResource, 0, len(t.live))
+	for r := range t.live {
+		live = append(live, r.TempResource)
+	}
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].Created.Before(live[j].Created)
+	})
+	return live
+}
+
+// Cleanup releases the resources tracked by t which were neither released
+// nor kept, such as from a signal handler, or before the program exits,
+// and returns the first error encountered.
+func (t *ResourceTracker) Cleanup() error {
+	t.mu.Lock()
+	live := make([]*Tracked, 0, len(t.live))
+	for r := range t.live {
+		live = append(live, r)
+	}
+	t.mu.Unlock()
+	var first error
+	for _, r := range live {
+		if err := r.Release(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// removeFunc returns a cleanup function which removes path, and which does
+// not fail if path does not exist.
+func removeFunc(path string) func() error {
+	return func() error {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+}
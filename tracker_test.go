@@ -0,0 +1,82 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestResourceTracker(t *testing.T) {
+	tr := new(execx.ResourceTracker)
+	var cleaned []string
+	cleanup := func(name string) func() error {
+		return func() error {
+			cleaned = append(cleaned, name)
+			return nil
+		}
+	}
+	a := tr.Track("test", "a", cleanup("a"))
+	b := tr.Track("test", "b", cleanup("b"))
+	tr.Track("test", "c", func() error { return errors.New("busy") })
+	if got := len(tr.Live()); got != 3 {
+		t.Fatalf("got %d live resources, want 3", got)
+	}
+	a.Release()
+	a.Release()
+	b.Keep()
+	b.Release()
+	live := tr.Live()
+	if len(live) != 1 || live[0].Path != "c" {
+		t.Fatalf("got live resources %v, want c", live)
+	}
+	if err := tr.Cleanup(); err == nil || err.Error() != "busy" {
+		t.Errorf("got %v, want the error of the cleanup", err)
+	}
+	if len(tr.Live()) != 0 {
+		t.Errorf("resources still live after Cleanup")
+	}
+	if len(cleaned) != 1 || cleaned[0] != "a" {
+		t.Errorf("got cleanups %v, want a once", cleaned)
+	}
+}
+
+func TestResourceTrackerRunScript(t *testing.T) {
+	tr := new(execx.ResourceTracker)
+	ctx := execx.WithResourceTracker(context.Background(), tr)
+	if _, err := execx.RunScript(ctx, "#!/bin/sh\nexit 1\n"); err == nil {
+		t.Fatal("script succeeded")
+	}
+	if live := tr.Live(); len(live) != 0 {
+		t.Errorf("got live resources %v after the script ran", live)
+	}
+}
+
+func TestResourceTrackerHome(t *testing.T) {
+	tr := new(execx.ResourceTracker)
+	ctx := execx.WithResourceTracker(context.Background(), tr)
+	res, err := execx.Run(ctx, selfCmd("echo"), execx.IsolatedHome(), execx.WithHomeCleanup(execx.CleanupNever))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(res.Home.Path)
+	if live := tr.Live(); len(live) != 0 {
+		t.Errorf("got live resources %v, want the kept home directory untracked", live)
+	}
+}
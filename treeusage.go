@@ -0,0 +1,219 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// TreeUsage describes the resource usage of a process and of all its
+// descendants, as tracked by WithTreeUsage.
+type TreeUsage struct {
+	// CPU is the CPU time consumed by the process and by all its
+	// descendants, in user and system mode. It includes the CPU time
+	// of descendants which outlived the process, as of the time it
+	// exited.
+	CPU time.Duration
+
+	// OrphanCPU is the part of CPU consumed by descendants which
+	// were not waited for by the process or by its other descendants,
+	// such as daemons, and which is not accounted for by the resource
+	// usage of the process itself.
+	OrphanCPU time.Duration
+
+	// Orphans is the number of descendants which were still running,
+	// or had not been reaped, when the process exited.
+	Orphans int
+
+	// PeakRSS is the largest sum of the resident set sizes of the
+	// processes in the tree sampled at the same time, in bytes.
+	PeakRSS uint64
+
+	// Processes is the number of distinct processes observed in the
+	// tree, including the process itself. Processes which ran for a
+	// shorter time than the sampling interval may not be observed,
+	// although their CPU time is accounted for.
+	Processes int
+}
+
+func (u *TreeUsage) String() string {
+	s := fmt.Sprintf("cpu %v, peak rss %s across %d processes",
+		u.CPU.Round(time.Millisecond), formatBytes(u.PeakRSS), u.Processes)
+	if u.Orphans > 0 {
+		s += fmt.Sprintf(", %d orphans using %v", u.Orphans, u.OrphanCPU.Round(time.Millisecond))
+	}
+	return s
+}
+
+// treeSampleInterval is the interval at which WithTreeUsage samples the
+// process tree.
+const treeSampleInterval = 100 * time.Millisecond
+
+// WithTreeUsage tracks the resource usage of the whole tree of processes
+// rooted at the process, for commands such as make, which do their work
+// in descendants. The resource usage of the process, as reported by
+// ProcessState, includes the CPU time of the descendants it waited for,
+// but neither the CPU time of descendants which outlived it, nor their
+// combined memory footprint.
+//
+// The tree is sampled periodically while the process runs, and once more
+// just before the process is reaped. The aggregate usage is recorded in
+// Result.TreeUsage, and as a *TreeUsage detail named "tree_usage" in
+// errors produced by the command. WithTreeUsage is supported on Linux
+// only, and does nothing on other platforms.
+func WithTreeUsage() Option {
+	return func(cfg *config) {
+		cfg.treeUsage = true
+	}
+}
+
+// procKey identifies a process, such that a reused pid is not mistaken
+// for the process which used it before.
+type procKey struct {
+	pid   int
+	start uint64 // start time, in clock ticks since boot
+}
+
+// procUsage is the resource usage of a process, read from /proc.
+type procUsage struct {
+	ppid  int
+	start uint64
+	cpu   time.Duration // CPU time of the process and of its waited for children
+	rss   uint64
+}
+
+// treeSampler periodically samples the resource usage of a process tree.
+type treeSampler struct {
+	pid int
+
+	mu      sync.Mutex // protects the fields below
+	seen    map[procKey]struct{}
+	peak    uint64
+	orphans int
+	orphCPU time.Duration
+	stopped bool // the process is about to be reaped
+}
+
+// sampleTree samples the tree of processes rooted at the process with the
+// specified pid until exited is closed, recording panics in ie. sampleTree
+// returns nil if process trees cannot be sampled on this platform.
+func sampleTree(pid int, exited <-chan struct{}, ie *internalErrors) *treeSampler {
+	if !treeUsageSupported {
+		return nil
+	}
+	s := &treeSampler{pid: pid, seen: make(map[procKey]struct{})}
+	go func() {
+		defer ie.catch("sample process tree")
+		t := time.NewTicker(treeSampleInterval)
+		defer t.Stop()
+		for {
+			s.sample()
+			select {
+			case <-t.C:
+			case <-exited:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// sample records the processes in the tree, and their combined resident
+// set size.
+func (s *treeSampler) sample() {
+	procs := readProcUsages()
+	children := make(map[int][]int)
+	for pid, u := range procs {
+		children[u.ppid] = append(children[u.ppid], pid)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		// The process may have been reaped while it was being
+		// sampled, and the sample may be bogus.
+		return
+	}
+	root, ok := procs[s.pid]
+	if !ok {
+		return
+	}
+	rss := root.rss
+	var walk func(pid int)
+	walk = func(pid int) {
+		for _, c := range children[pid] {
+			if c == pid {
+				continue
+			}
+			u := procs[c]
+			s.seen[procKey{pid: c, start: u.start}] = struct{}{}
+			rss += u.rss
+			walk(c)
+		}
+	}
+	walk(s.pid)
+	if rss > s.peak {
+		s.peak = rss
+	}
+}
+
+// stop stops sampling, before the process is reaped. If zombie is true,
+// the process has exited, but has not been reaped yet, and stop samples
+// the tree once more, then accounts for the descendants which are still
+// around, since the resource usage of the process does not include them.
+func (s *treeSampler) stop(zombie bool) {
+	if s == nil {
+		return
+	}
+	if zombie {
+		s.sample()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	if !zombie {
+		return
+	}
+	procs := readProcUsages()
+	for k := range s.seen {
+		if u, ok := procs[k.pid]; ok && u.start == k.start {
+			s.orphans++
+			s.orphCPU += u.cpu
+		}
+	}
+}
+
+// result returns the usage of the tree, given the state of the process
+// at the root of the tree, once it has been reaped.
+func (s *treeSampler) result(ps *os.ProcessState) *TreeUsage {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := &TreeUsage{
+		OrphanCPU: s.orphCPU,
+		Orphans:   s.orphans,
+		PeakRSS:   s.peak,
+		Processes: len(s.seen) + 1,
+	}
+	if ps != nil {
+		u.CPU = ps.UserTime() + ps.SystemTime()
+	}
+	u.CPU += s.orphCPU
+	return u
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const treeUsageSupported = true
+
+// readProcUsages reads the resource usage of all processes from /proc,
+// keyed by pid.
+func readProcUsages() map[int]procUsage {
+	d, err := os.Open("/proc")
+	if err != nil {
+		return nil
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return nil
+	}
+	procs := make(map[int]procUsage)
+	for _, name := range names {
+		pid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		if u, ok := readProcUsage(pid); ok {
+			procs[pid] = u
+		}
+	}
+	return procs
+}
+
+// readProcUsage reads the parent PID, start time, CPU time and resident
+// set size of the process with the specified pid from /proc/<pid>/stat.
+func readProcUsage(pid int) (procUsage, bool) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procUsage{}, false
+	}
+	// See readProcStat. The CPU time of waited for children follows
+	// that of the process, and the start time and the resident set
+	// size, in pages, are the 20th and 22nd fields after the name.
+	s := string(b)
+	rp := strings.LastIndexByte(s, ')')
+	if rp < 0 {
+		return procUsage{}, false
+	}
+	fields := strings.Fields(s[rp+1:])
+	if len(fields) < 22 {
+		return procUsage{}, false
+	}
+	var ticks int64
+	for _, f := range fields[11:15] {
+		n, _ := strconv.ParseInt(f, 10, 64)
+		ticks += n
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	start, _ := strconv.ParseUint(fields[19], 10, 64)
+	pages, _ := strconv.ParseUint(fields[21], 10, 64)
+	return procUsage{
+		ppid:  ppid,
+		start: start,
+		cpu:   time.Duration(ticks) * time.Second / clockTicks,
+		rss:   pages * uint64(os.Getpagesize()),
+	}, true
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWithTreeUsage(t *testing.T) {
+	// The busy loop in the background outlives the shell, which waits
+	// for the other one only. It must not hold on to the output of the
+	// shell, which would otherwise never be closed.
+	script := `(while :; do :; done) >/dev/null 2>&1 & echo $!
+i=0; while [ $i -lt 100000 ]; do i=$((i+1)); done
+sleep 0.3`
+	cmd := exec.Command("sh", "-c", script)
+	res, err := execx.Run(context.Background(), cmd, execx.WithTreeUsage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(res.Stdout))); err == nil {
+		defer syscall.Kill(pid, syscall.SIGKILL)
+	}
+	u := res.TreeUsage
+	if u == nil {
+		t.Fatal("tree usage not tracked")
+	}
+	if u.Processes < 2 {
+		t.Errorf("observed %d processes, want at least 2", u.Processes)
+	}
+	if u.Orphans != 1 || u.OrphanCPU <= 0 {
+		t.Errorf("got %d orphans using %v, want 1 orphan using some CPU", u.Orphans, u.OrphanCPU)
+	}
+	own := res.ProcessState.UserTime() + res.ProcessState.SystemTime()
+	if u.CPU != own+u.OrphanCPU {
+		t.Errorf("got CPU %v, want %v + %v", u.CPU, own, u.OrphanCPU)
+	}
+	if u.PeakRSS == 0 {
+		t.Error("peak RSS not sampled")
+	}
+}
+
+func TestWithTreeUsageDetail(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 0.2; exit 3")
+	start := time.Now()
+	_, err := execx.Run(context.Background(), cmd, execx.WithTreeUsage())
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	v, ok := ee.Detail("tree_usage")
+	if !ok {
+		t.Fatal("tree_usage detail missing")
+	}
+	u := v.(*execx.TreeUsage)
+	if u.Orphans != 0 || u.CPU > time.Since(start) {
+		t.Errorf("got bogus tree usage %v", u)
+	}
+}
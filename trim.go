@@ -0,0 +1,162 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Limits applied by Trim.
+const (
+	minTrimmedStderr = 256 // bytes of stderr worth keeping
+	maxTrimmedArg    = 256 // bytes kept of each long argument
+)
+
+// Trim returns a copy of e whose JSON representation, as produced by
+// MarshalJSON, fits in budget bytes, for log pipelines which cap the size
+// of messages. e itself is not modified. If the representation of e fits
+// already, Trim returns e.
+//
+// Fields are trimmed in the following order, until the representation
+// fits:
+//
+//  1. the environment: ChildEnv, ParentEnv and EnvSources are dropped
+//  2. the details gathered by collectors, largest first
+//  3. the hints
+//  4. the standard error, whose middle is replaced by a line noting how
+//     many bytes were omitted, as exec.Cmd.Output does, and which is
+//     dropped if fewer than 256 bytes of it would remain
+//  5. the arguments longer than 256 bytes, which are truncated
+//
+// What was trimmed is recorded as a []string detail named "trimmed". If
+// the representation does not fit even then, Trim returns the copy
+// trimmed as above.
+func (e *ExitError) Trim(budget int) *ExitError {
+	if jsonSize(e) <= budget {
+		return e
+	}
+	c := *e
+	c.fmtCache = nil
+	if e.ExitError != nil {
+		ee := *e.ExitError
+		c.ExitError = &ee
+	}
+	c.Details = append([]Detail(nil), e.Details...)
+	var trimmed []string
+	done := func() *ExitError {
+		c.Details = append(c.Details, Detail{Key: "trimmed", Value: trimmed})
+		return &c
+	}
+	size := func() int {
+		saved := c.Details
+		c.Details = append(c.Details[:len(c.Details):len(c.Details)], Detail{Key: "trimmed", Value: trimmed})
+		n := jsonSize(&c)
+		c.Details = saved
+		return n
+	}
+
+	if c.ChildEnv != nil || c.ParentEnv != nil || c.EnvSources != nil {
+		c.ChildEnv, c.ParentEnv, c.EnvSources = nil, nil, nil
+		trimmed = append(trimmed, "env")
+		if size() <= budget {
+			return done()
+		}
+	}
+	for len(c.Details) > 0 {
+		i := largestDetail(c.Details)
+		trimmed = append(trimmed, "detail "+c.Details[i].Key)
+		c.Details = append(c.Details[:i:i], c.Details[i+1:]...)
+		if size() <= budget {
+			return done()
+		}
+	}
+	if len(c.Hints) > 0 {
+		c.Hints, c.hintMsgs = nil, nil
+		trimmed = append(trimmed, "hints")
+		if size() <= budget {
+			return done()
+		}
+	}
+	if c.ExitError != nil && len(c.ExitError.Stderr) > 0 {
+		stderr := c.ExitError.Stderr
+		trimmed = append(trimmed, "")
+		keep := len(stderr) - (size() - budget)
+		for {
+			if keep < minTrimmedStderr {
+				c.ExitError.Stderr = nil
+				trimmed[len(trimmed)-1] = fmt.Sprintf("stderr (%d bytes)", len(stderr))
+				break
+			}
+			dropped := len(stderr) - keep
+			c.ExitError.Stderr = elideMiddle(stderr, keep)
+			c.StderrDropped = e.StderrDropped + int64(dropped)
+			trimmed[len(trimmed)-1] = fmt.Sprintf("stderr (%d bytes)", dropped)
+			if size() <= budget {
+				return done()
+			}
+			keep /= 2
+		}
+		if size() <= budget {
+			return done()
+		}
+	}
+	c.Args = copyStrings(e.Args)
+	for i, arg := range c.Args {
+		if len(arg) <= maxTrimmedArg {
+			continue
+		}
+		c.Args[i] = arg[:maxTrimmedArg]
+		trimmed = append(trimmed, fmt.Sprintf("argument %d (%d bytes)", i, len(arg)-maxTrimmedArg))
+	}
+	return done()
+}
+
+// elideMiddle returns b, with its middle replaced by a line noting how
+// many bytes were omitted, keeping keep bytes of b.
+func elideMiddle(b []byte, keep int) []byte {
+	head, tail := keep/2, keep-keep/2
+	out := append([]byte(nil), b[:head]...)
+	out = append(out, fmt.Sprintf("\n... omitting %d bytes ...\n", len(b)-keep)...)
+	return append(out, b[len(b)-tail:]...)
+}
+
+// largestDetail returns the index of the detail whose value has the
+// largest JSON representation.
+func largestDetail(details []Detail) int {
+	largest, max := 0, -1
+	for i, d := range details {
+		n := math.MaxInt32
+		if b, err := json.Marshal(d.Value); err == nil {
+			n = len(b)
+		}
+		if n > max {
+			largest, max = i, n
+		}
+	}
+	return largest
+}
+
+// jsonSize returns the size of the JSON representation of e, or a very
+// large size if e cannot be represented as JSON.
+func jsonSize(e *ExitError) int {
+	// Trim modifies the copy in ways the cache does not notice.
+	b, err := e.marshalJSON()
+	if err != nil {
+		return math.MaxInt32
+	}
+	return len(b)
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestExitErrorTrim(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("stderr-flood"))
+	err = execx.WithDetail(err, "big", strings.Repeat("x", 5000))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	full, err := json.Marshal(ee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ee.Trim(len(full)); got != ee {
+		t.Errorf("Trim with a sufficient budget returned a copy")
+	}
+
+	const budget = 4096
+	trimmed := ee.Trim(budget)
+	b, err := json.Marshal(trimmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) > budget {
+		t.Errorf("trimmed to %d bytes, want at most %d", len(b), budget)
+	}
+	if trimmed.ChildEnv != nil || ee.ChildEnv == nil {
+		t.Errorf("environment not dropped from the copy only")
+	}
+	if _, ok := trimmed.Detail("big"); ok {
+		t.Errorf("detail not dropped")
+	}
+	if _, ok := ee.Detail("big"); !ok {
+		t.Errorf("detail dropped from the original error")
+	}
+	if len(trimmed.Stderr) == 0 || len(trimmed.Stderr) >= len(ee.Stderr) {
+		t.Errorf("got %d bytes of stderr, want fewer than %d", len(trimmed.Stderr), len(ee.Stderr))
+	}
+	if !strings.HasPrefix(string(trimmed.Stderr), "begin") || !strings.HasSuffix(string(trimmed.Stderr), "end") {
+		t.Errorf("beginning or end of stderr not kept")
+	}
+	if trimmed.StderrDropped <= ee.StderrDropped {
+		t.Errorf("got %d bytes dropped, want more than %d", trimmed.StderrDropped, ee.StderrDropped)
+	}
+	v, _ := trimmed.Detail("trimmed")
+	notes, _ := v.([]string)
+	if len(notes) < 3 || notes[0] != "env" || notes[1] != "detail big" || !strings.HasPrefix(notes[len(notes)-1], "stderr (") {
+		t.Errorf("trimmed = %q", notes)
+	}
+}
+
+func TestExitErrorTrimArgs(t *testing.T) {
+	long := strings.Repeat("a", 10000)
+	cmd := selfCmd("on")
+	cmd.Args = append(cmd.Args, long)
+	_, err := execx.Run(context.Background(), cmd)
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	trimmed := ee.Trim(1024)
+	if got := trimmed.Args[len(trimmed.Args)-1]; len(got) != 256 {
+		t.Errorf("got %d bytes of the long argument, want 256", len(got))
+	}
+	if got := ee.Args[len(ee.Args)-1]; got != long {
+		t.Errorf("argument of the original error modified")
+	}
+	v, _ := trimmed.Detail("trimmed")
+	notes, _ := v.([]string)
+	want := []string{"env", "stderr (6 bytes)", "argument 1 (9744 bytes)"}
+	if !reflect.DeepEqual(notes, want) {
+		t.Errorf("trimmed = %q, want %q", notes, want)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"acln.ro/execx/errcode"
+)
+
+// umaskShell is the shell used to set the umask of commands.
+var umaskShell = "/bin/sh"
+
+// WithUmask sets the file mode creation mask of the command to mask, such
+// as 0022, rather than letting it inherit the umask of the current process.
+// Since the umask of a child process cannot be set by os/exec, the command
+// runs under a small shell shim, which sets the umask and executes the
+// command in its place, such that the process ID, the exit status and the
+// signals delivered to the command are those of the command itself. The
+// path and arguments of the command are adjusted accordingly, and the
+// shell, /bin/sh, must be allowed by Config.AllowedPrograms. The shim
+// cannot preserve argv[0], so commands configured with both WithUmask and
+// WithArgv0 fail to start, with a *StartError which reports
+// errcode.InvalidArgument.
+//
+// The umask is recorded as a detail named "umask" in errors produced by
+// the command, together with the umask of the current process, if known.
+// WithUmask is not supported on Windows.
+func WithUmask(mask os.FileMode) Option {
+	return func(cfg *config) {
+		cfg.umask = mask & os.ModePerm
+		cfg.umaskSet = true
+	}
+}
+
+// applyUmask runs h.cmd under a shim which sets its umask.
+func (h *Handle) applyUmask() error {
+	cmd := h.cmd
+	if runtime.GOOS == "windows" {
+		return wrapStart(errors.New("execx: WithUmask is not supported on windows"), cmd, h.cfg.collectors)
+	}
+	if h.cfg.argv0 != "" {
+		err := newCodedError("execx: WithUmask cannot preserve the argv[0] set by WithArgv0", errcode.InvalidArgument)
+		return wrapStart(err, cmd, h.cfg.collectors)
+	}
+	shimUmask(cmd, h.cfg.umask)
+	h.programs = append(h.programs, umaskShell)
+	desc := fmt.Sprintf("%04o", uint32(h.cfg.umask))
+	if inherited, ok := processUmask(); ok {
+		desc += fmt.Sprintf(" (inherited %04o)", inherited)
+	}
+	h.cfg.collectors = append(h.cfg.collectors, CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "umask", desc
+	}))
+	return nil
+}
+
+// shimUmask adjusts cmd to run under a shell shim which sets its umask to
+// mask, and executes the command in its place.
+func shimUmask(cmd *exec.Cmd, mask os.FileMode) {
+	args := []string{"sh", "-c", fmt.Sprintf("umask %04o", uint32(mask)) + ` && exec "$0" "$@"`, cmd.Path}
+	if len(cmd.Args) > 1 {
+		args = append(args, cmd.Args[1:]...)
+	}
+	cmd.Path = umaskShell
+	cmd.Args = args
+}
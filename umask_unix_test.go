@@ -0,0 +1,78 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+	"acln.ro/execx/errcode"
+)
+
+func TestWithUmask(t *testing.T) {
+	file := filepath.Join(tempDir(t), "file")
+	cmd := exec.Command("sh", "-c", `umask; touch "$1"; exit 1`, "sh", file)
+	_, err := execx.Run(context.Background(), cmd, execx.WithUmask(0027))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if got := strings.TrimSpace(string(ee.Result.Stdout)); got != "0027" {
+		t.Errorf("child reported umask %q, want 0027", got)
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0640 {
+		t.Errorf("file created with mode %v, want %v", mode, os.FileMode(0640))
+	}
+	v, ok := ee.Detail("umask")
+	if !ok || !strings.HasPrefix(v.(string), "0027") {
+		t.Errorf("got umask detail %v", v)
+	}
+}
+
+func TestWithUmaskArgv0(t *testing.T) {
+	_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithUmask(0027), execx.WithArgv0("renamed"))
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+	if code := errcode.Of(err); code != errcode.InvalidArgument {
+		t.Errorf("code = %q, want %q", code, errcode.InvalidArgument)
+	}
+}
+
+func TestWithUmaskAllowedPrograms(t *testing.T) {
+	storeConfig(t, execx.Config{AllowedPrograms: []string{"true"}})
+	_, err := execx.Run(context.Background(), exec.Command("true"), execx.WithUmask(0027))
+	if !errors.Is(err, execx.ErrNotAllowed) {
+		t.Fatalf("got %v for a shim shell which is not allowed, want ErrNotAllowed", err)
+	}
+	execx.UpdateConfig(func(c *execx.Config) { c.AllowedPrograms = []string{"true", "sh"} })
+	if _, err := execx.Run(context.Background(), exec.Command("true"), execx.WithUmask(0027)); err != nil {
+		t.Fatalf("allowed shim shell: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// WithVerboseRetry re-runs the command once if it fails, with additional
+// flags which increase the verbosity of the tool, and attaches the output
+// of the verbose run to the original *ExitError, as a *VerboseRun detail
+// named "verbose_run". The flags are looked up in flags by the base name
+// of the executable, such as "git" or "terraform", without the ".exe"
+// extension on Windows, as named by the caller, rather than that of a
+// wrapper, such as nice, it runs under.
+// Tools not present in flags are not re-run. The flags are appended to
+// the command line arguments.
+//
+// The verbose run is a Clone of the original command, run using the same
+// options, except for those which supply its input or consume its output,
+// such as WithStdinFS, WithStdoutWriters, WithOutputFS, WithSyslog and
+// WithUnixSocket, and those which account for it, such as WithQuota and
+// budgets: it does not receive the standard input of the original
+// command, its output is only recorded in the detail, it is not charged
+// to budgets or quotas, and it publishes no events. Only commands run by
+// Run are re-run.
+func WithVerboseRetry(flags map[string][]string) Option {
+	return func(cfg *config) {
+		cfg.verboseFlags = flags
+	}
+}
+
+// withoutVerboseRetry disables WithVerboseRetry for the verbose run, as
+// well as wrappers, which the failed command already carries, and the
+// options which would direct the input and output of the verbose run, or
+// account for it, as for the failed command.
+func withoutVerboseRetry(cfg *config) {
+	cfg.verboseFlags = nil
+	cfg.wrappers = nil
+	cfg.taps = nil
+	cfg.stdoutWriters, cfg.stderrWriters = nil, nil
+	cfg.stdinFS, cfg.outputFS = nil, nil
+	cfg.syslog, cfg.journal = nil, ""
+	cfg.endpoints = nil
+	cfg.quota = ""
+	cfg.auxiliary = true
+}
+
+// VerboseRun describes a verbose run of a failed command.
+type VerboseRun struct {
+	// Args holds the command line arguments of the verbose run.
+	Args []string
+
+	// ExitCode is the exit code of the verbose run.
+	ExitCode int
+
+	// Output holds the interleaved standard output and standard error
+	// of the verbose run.
+	Output string
+}
+
+func (v *VerboseRun) String() string {
+	return fmt.Sprintf("%s (exit code %d):\n%s", strings.Join(v.Args, " "), v.ExitCode, v.Output)
+}
+
+// toolName returns the name of the tool cmd runs, by which its verbose
+// flags are looked up.
+func toolName(cmd *exec.Cmd) string {
+	path := cmd.Path
+	if path == "" && len(cmd.Args) > 0 {
+		path = cmd.Args[0]
+	}
+	return strings.TrimSuffix(filepath.Base(path), ".exe")
+}
+
+// verboseRetry re-runs the command which failed with ee verbosely, if
+// flags are configured for tool, and attaches the outcome to ee.
+func verboseRetry(ctx context.Context, ee *ExitError, tool string, opts []Option) {
+	cfg := newConfig(opts)
+	if cfg.verboseFlags == nil {
+		return
+	}
+	flags, ok := cfg.verboseFlags[tool]
+	if !ok {
+		return
+	}
+	cmd := ee.Command()
+	cmd.Args = append(cmd.Args, flags...)
+	out := new(bytes.Buffer)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	opts = append(opts[:len(opts):len(opts)], withoutVerboseRetry)
+	res, err := RunnerFrom(ctx).Run(ctx, cmd, opts...)
+	if _, ok := err.(*StartError); ok || res == nil {
+		return
+	}
+	ee.Details = append(ee.Details, Detail{Key: "verbose_run", Value: &VerboseRun{
+		Args:     cmd.Args,
+		ExitCode: res.ExitCode,
+		Output:   out.String(),
+	}})
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWithVerboseRetry(t *testing.T) {
+	t.Run("Retry", testVerboseRetry)
+	t.Run("UnknownTool", testVerboseRetryUnknownTool)
+	t.Run("Isolated", testVerboseRetryIsolated)
+}
+
+func testVerboseRetry(t *testing.T) {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	flags := map[string][]string{name: {"--debug"}}
+	self := selfCmd("args")
+	self.Args = append(self.Args, "build")
+	_, err := execx.Run(context.Background(), self, execx.WithVerboseRetry(flags))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if string(ee.Stderr) != "build" {
+		t.Errorf("original run: got stderr %q, want %q", ee.Stderr, "build")
+	}
+	vr, ok := ee.Fields()["verbose_run"].(*execx.VerboseRun)
+	if !ok {
+		t.Fatalf("verbose run not recorded: %+v", ee)
+	}
+	if vr.Output != "build --debug" {
+		t.Errorf("verbose run: got output %q, want %q", vr.Output, "build --debug")
+	}
+	if vr.ExitCode != 1 {
+		t.Errorf("verbose run: got exit code %d, want 1", vr.ExitCode)
+	}
+}
+
+func testVerboseRetryUnknownTool(t *testing.T) {
+	flags := map[string][]string{"git": {"-v"}}
+	_, err := execx.Run(context.Background(), selfCmd("args"), execx.WithVerboseRetry(flags))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if _, ok := ee.Fields()["verbose_run"]; ok {
+		t.Error("unknown tool was re-run")
+	}
+}
+
+func testVerboseRetryIsolated(t *testing.T) {
+	if _, err := exec.LookPath("nice"); err != nil {
+		t.Skip("nice not available")
+	}
+	events := make(chan execx.Event, 16)
+	defer execx.Subscribe(events)()
+
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	flags := map[string][]string{name: {"--debug"}}
+	self := selfCmd("args")
+	self.Args = append(self.Args, "build")
+	var stderr bytes.Buffer
+	_, err := execx.Run(context.Background(), self, execx.WithVerboseRetry(flags),
+		execx.WithWrappers(execx.NiceWrapper(0)), execx.WithStderrWriters(&stderr))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if _, ok := ee.Fields()["verbose_run"].(*execx.VerboseRun); !ok {
+		t.Fatalf("verbose run of wrapped tool not recorded: %+v", ee)
+	}
+	if got := stderr.String(); got != "build" {
+		t.Errorf("stderr writer got %q, want only the output of the original run", got)
+	}
+	for n := len(events); n > 0; n-- {
+		if ev := <-events; strings.Contains(fmt.Sprint(ev), "--debug") {
+			t.Errorf("verbose run published a %T event", ev)
+		}
+	}
+}
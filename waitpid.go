@@ -0,0 +1,128 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// pidPollInterval is the interval at which WaitPID checks whether a
+// process exists, on platforms where it cannot be notified of its exit.
+const pidPollInterval = 100 * time.Millisecond
+
+// A ProcessExit describes the exit of a process waited for by WaitPID.
+//
+// The exit status of a process is only available to its parent, so unlike
+// an ExitError, a ProcessExit does not describe the exit status of the
+// process. Path, Args and Dir are captured when WaitPID starts waiting,
+// where the platform allows it, and are otherwise empty.
+type ProcessExit struct {
+	// PID is the process ID of the process.
+	PID int
+
+	// Path is the path of the executable of the process.
+	Path string
+
+	// Args holds command line arguments.
+	Args []string
+
+	// Dir is the working directory of the process.
+	Dir string
+
+	// Adopted is the time WaitPID started waiting for the process.
+	Adopted time.Time
+
+	// Exited is the time WaitPID observed the exit of the process.
+	// When polling, the exit is observed up to 100ms after it occurs.
+	Exited time.Time
+
+	// Method is the method WaitPID used to wait for the process:
+	// "pidfd" on Linux, or "poll" otherwise.
+	Method string
+}
+
+// Cmdline returns the concatenation of filepath.Base(e.Path) and e.Args,
+// separated by spaces. See func Cmdline.
+func (e *ProcessExit) Cmdline() string {
+	return cmdline(e.Path, e.Args)
+}
+
+func (e *ProcessExit) String() string {
+	name := fmt.Sprintf("pid %d", e.PID)
+	if e.Path != "" {
+		name += fmt.Sprintf(" (%s)", e.Cmdline())
+	}
+	return fmt.Sprintf("%s exited within %v of adoption (observed by %s)", name, e.Exited.Sub(e.Adopted).Round(time.Millisecond), e.Method)
+}
+
+// WaitPID waits for the process with the specified pid, which need not
+// have been started by the current process, to exit, for tools which
+// adopt processes started by other means, such as daemons started by a
+// previous instance of the tool. On Linux, WaitPID is notified of the
+// exit using a pidfd. Elsewhere, or if pidfds are not supported by the
+// kernel, WaitPID polls for the existence of the process.
+//
+// If the process does not exist, WaitPID returns an error which wraps
+// os.ErrProcessDone. If ctx is done before the process exits, WaitPID
+// returns ctx.Err().
+//
+// Processes which exit, but are not reaped by their parent, are not
+// reported as exited when polling.
+func WaitPID(ctx context.Context, pid int) (*ProcessExit, error) {
+	clock := ClockFrom(ctx)
+	if pid <= 0 || !processAlive(pid) {
+		return nil, fmt.Errorf("execx: pid %d: %w", pid, os.ErrProcessDone)
+	}
+	return waitPID(ctx, clock, pid)
+}
+
+// waitPID waits for the process with the specified pid, which was found
+// alive, to exit.
+func waitPID(ctx context.Context, clock Clock, pid int) (*ProcessExit, error) {
+	pe := &ProcessExit{PID: pid, Adopted: clock.Now()}
+	describeProcess(pe)
+	ok, err := waitPIDFD(ctx, pid)
+	switch {
+	case err != nil:
+		return nil, err
+	case ok:
+		pe.Method = "pidfd"
+	default:
+		if err := pollExit(ctx, clock, pid); err != nil {
+			return nil, err
+		}
+		pe.Method = "poll"
+	}
+	pe.Exited = clock.Now()
+	return pe, nil
+}
+
+// pollExit waits for the process with the specified pid to cease to
+// exist, by polling.
+func pollExit(ctx context.Context, clock Clock, pid int) error {
+	for processAlive(pid) {
+		t := clock.NewTimer(pidPollInterval)
+		select {
+		case <-t.C():
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"acln.ro/env"
+)
+
+// sysPidfdOpen is the number of the pidfd_open system call, which is the
+// same on all architectures.
+const sysPidfdOpen = 434
+
+// waitPIDFD waits for the process with the specified pid to exit, using
+// a pidfd, which becomes readable when the process exits. It reports
+// false if pidfds are not supported.
+func waitPIDFD(ctx context.Context, pid int) (bool, error) {
+	fd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(pid), 0, 0)
+	if errno == syscall.ESRCH {
+		// The process exited in the meantime.
+		return true, nil
+	}
+	if errno != 0 {
+		return false, nil
+	}
+	if err := syscall.SetNonblock(int(fd), true); err != nil {
+		syscall.Close(int(fd))
+		return false, nil
+	}
+	f := os.NewFile(fd, fmt.Sprintf("pidfd:%d", pid))
+	defer f.Close()
+	if err := f.SetReadDeadline(time.Time{}); err != nil {
+		// The pidfd is not pollable by the runtime.
+		return false, nil
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return false, nil
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.SetReadDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	// The first call waits for the pidfd to become readable, which it
+	// does once the process exits.
+	polled := false
+	err = rc.Read(func(uintptr) bool {
+		done := polled
+		polled = true
+		return done
+	})
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return false, ctx.Err()
+	}
+	return err == nil, nil
+}
+
+// describeProcess fills in the path, the arguments and the working
+// directory of the process described by pe, from /proc.
+func describeProcess(pe *ProcessExit) {
+	proc := fmt.Sprintf("/proc/%d/", pe.PID)
+	pe.Path, _ = os.Readlink(proc + "exe")
+	pe.Dir, _ = os.Readlink(proc + "cwd")
+	// The command line of a process which is in the middle of execve
+	// reads as empty for a short while, so retry a few times.
+	for i := 0; i < 10; i++ {
+		b, err := ioutil.ReadFile(proc + "cmdline")
+		if err != nil {
+			return
+		}
+		if len(b) > 0 {
+			pe.Args = strings.Split(strings.TrimSuffix(string(b), "\x00"), "\x00")
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// processEnv returns the environment of the process with the specified
+// pid, from /proc, or nil if it is not readable.
+func processEnv(pid int) env.Map {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return nil
+	}
+	return env.Parse(strings.Split(strings.TrimSuffix(string(b), "\x00"), "\x00")...)
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWaitPID(t *testing.T) {
+	t.Run("Exit", func(t *testing.T) {
+		cmd := selfCmd("nap")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		// Reap the process as soon as it exits, as its parent would.
+		go cmd.Wait()
+		pe, err := execx.WaitPID(context.Background(), cmd.Process.Pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pe.Exited.Sub(pe.Adopted) < time.Second {
+			t.Errorf("exit observed after %v, want at least 1s", pe.Exited.Sub(pe.Adopted))
+		}
+		if runtime.GOOS == "linux" {
+			if pe.Method != "pidfd" {
+				t.Errorf("got method %q, want pidfd", pe.Method)
+			}
+			if pe.Path == "" || len(pe.Args) != 1 || pe.Args[0] != os.Args[0] {
+				t.Errorf("got path %q, args %q", pe.Path, pe.Args)
+			}
+		}
+	})
+	t.Run("Canceled", func(t *testing.T) {
+		cmd := selfCmd("hang")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer cmd.Wait()
+		defer cmd.Process.Kill()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err := execx.WaitPID(ctx, cmd.Process.Pid)
+		if err != context.DeadlineExceeded {
+			t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+	t.Run("NotExist", func(t *testing.T) {
+		cmd := selfCmd("echo")
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+		_, err := execx.WaitPID(context.Background(), cmd.Process.Pid)
+		if !errors.Is(err, os.ErrProcessDone) {
+			t.Fatalf("got %v, want %v", err, os.ErrProcessDone)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// A WaitStrategy determines how Start waits for processes to exit.
+type WaitStrategy int32
+
+// Wait strategies.
+const (
+	// WaitPerChild waits for each process from a goroutine of its
+	// own, which occupies an operating system thread, blocked in the
+	// wait system call, for as long as the process runs. This is the
+	// default, and the strategy used by os/exec.
+	WaitPerChild WaitStrategy = iota
+
+	// WaitCentral waits for all processes from a single goroutine,
+	// which is woken by SIGCHLD, and checks which processes have
+	// exited, without reaping them. The process is then reaped by
+	// Wait, as usual, from a goroutine started once the process has
+	// exited. WaitCentral reduces the overhead of supervising many
+	// long-running children. It is supported on Linux only. On other
+	// platforms, it behaves like WaitPerChild.
+	WaitCentral
+)
+
+func (s WaitStrategy) String() string {
+	switch s {
+	case WaitPerChild:
+		return "per-child"
+	case WaitCentral:
+		return "central"
+	default:
+		return fmt.Sprintf("WaitStrategy(%d)", int32(s))
+	}
+}
+
+var waitStrategy int32 // WaitStrategy
+
+// SetWaitStrategy sets the strategy Start uses to wait for the processes
+// it starts from then on. SetWaitStrategy is safe to call from multiple
+// goroutines concurrently.
+func SetWaitStrategy(s WaitStrategy) {
+	atomic.StoreInt32(&waitStrategy, int32(s))
+}
+
+// startWaiting arranges for h.wait to be called once the process exits.
+func (h *Handle) startWaiting() {
+	if WaitStrategy(atomic.LoadInt32(&waitStrategy)) == WaitCentral && waitCentrally(h) {
+		return
+	}
+	go h.wait()
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// central holds the processes waited for using WaitCentral, by PID.
+var central struct {
+	sync.Mutex
+	m    map[int]*Handle
+	once sync.Once
+	kick chan struct{}
+}
+
+// waitCentrally registers h with the central waiter, starting it if
+// needed.
+func waitCentrally(h *Handle) bool {
+	central.once.Do(func() {
+		central.m = make(map[int]*Handle)
+		central.kick = make(chan struct{}, 1)
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGCHLD)
+		go func() {
+			for {
+				select {
+				case <-sigc:
+				case <-central.kick:
+				}
+				dispatchExited()
+			}
+		}()
+	})
+	central.Lock()
+	central.m[h.cmd.Process.Pid] = h
+	central.Unlock()
+	// The process may have exited before it was registered, in which
+	// case its SIGCHLD was already handled.
+	select {
+	case central.kick <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// dispatchExited starts waiting for the registered processes which have
+// exited.
+func dispatchExited() {
+	central.Lock()
+	defer central.Unlock()
+	for pid, h := range central.m {
+		wpid, errno := waitidNowait(pPID, pid)
+		if wpid == 0 && errno != syscall.ECHILD {
+			continue
+		}
+		// The process has exited, or was reaped by someone else, in
+		// which case Wait reports the error.
+		delete(central.m, pid)
+		go h.wait()
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWaitCentral(t *testing.T) {
+	execx.SetWaitStrategy(execx.WaitCentral)
+	defer execx.SetWaitStrategy(execx.WaitPerChild)
+
+	t.Run("Exit", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := execx.Run(context.Background(), selfCmd("echo")); err != nil {
+					t.Error(err)
+				}
+				res, err := execx.Run(context.Background(), selfCmd("on"))
+				if ee, ok := err.(*execx.ExitError); !ok || ee.ExitCode() != 1 || res.ExitCode != 1 {
+					t.Errorf("got %v, want exit status 1", err)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+	t.Run("Kill", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err := execx.Run(ctx, selfCmd("hang"))
+		if _, ok := err.(*execx.ExitError); !ok {
+			t.Fatalf("got %v, want *ExitError", err)
+		}
+	})
+}
+
+func BenchmarkWaitStrategy(b *testing.B) {
+	const concurrency = 64
+	for _, s := range []execx.WaitStrategy{execx.WaitPerChild, execx.WaitCentral} {
+		b.Run(s.String(), func(b *testing.B) {
+			execx.SetWaitStrategy(s)
+			defer execx.SetWaitStrategy(execx.WaitPerChild)
+			sem := make(chan struct{}, concurrency)
+			var wg sync.WaitGroup
+			for i := 0; i < b.N; i++ {
+				sem <- struct{}{}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-sem }()
+					if _, err := execx.Run(context.Background(), selfCmd("echo")); err != nil {
+						b.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+// WASIRunner is a Runner which runs WebAssembly modules which target WASI,
+// such as plugins, in a sandboxed WASI runtime, with the argv, environment,
+// standard I/O and exit code semantics of ordinary commands. Failures
+// produce the same *ExitError and *StartError values as other runners.
+//
+// cmd.Path names the module, and cmd.Args holds its arguments, as usual.
+// The module sees only the variables in cmd.Env, and none if cmd.Env is
+// nil, since WASI modules do not inherit the environment of the host. If
+// cmd.Dir is set, it is mounted as the root directory of the module.
+// Otherwise, the module has no access to the file system, other than
+// through Mounts.
+//
+// If the command fails, the path of the module is recorded as a detail
+// named "wasm_module" in the *ExitError.
+type WASIRunner struct {
+	// Runtime holds the command line of the WASI runtime, to which
+	// the flags, the module and its arguments are appended. Flags are
+	// written in the syntax of the wazero command line tool. If Runtime
+	// is empty, "wazero run" is used.
+	Runtime []string
+
+	// Mounts holds additional directories made available to the
+	// module, in the form "host" or "host:guest".
+	Mounts []string
+}
+
+// Run runs the module named by cmd.Path, as per Run.
+func (r *WASIRunner) Run(ctx context.Context, cmd *exec.Cmd, opts ...Option) (*Result, error) {
+	runtime := r.Runtime
+	if len(runtime) == 0 {
+		runtime = []string{"wazero", "run"}
+	}
+	path, err := exec.LookPath(runtime[0])
+	if err != nil {
+		return nil, wrapStart(err, cmd, nil)
+	}
+	module := cmd.Path
+	args := append([]string(nil), runtime...)
+	for _, kv := range cmd.Env {
+		args = append(args, "-env="+kv)
+	}
+	if cmd.Dir != "" {
+		args = append(args, "-mount="+cmd.Dir+":/")
+	}
+	for _, m := range r.Mounts {
+		args = append(args, "-mount="+m)
+	}
+	args = append(args, module)
+	if len(cmd.Args) > 1 {
+		args = append(args, cmd.Args[1:]...)
+	}
+	cmd.Path = path
+	cmd.Args = args
+	cmd.Env = nil
+
+	res, err := Local.Run(ctx, cmd, opts...)
+	var ee *ExitError
+	if errors.As(err, &ee) {
+		ee.Details = append(ee.Details, Detail{Key: "wasm_module", Value: module})
+	}
+	return res, err
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+// fakeWazero installs a fake WASI runtime in PATH, which prints its
+// arguments, and exits with status 3 if the module is named fail.wasm.
+func fakeWazero(t *testing.T) {
+	dir := tempDir(t)
+	writeFile(t, filepath.Join(dir, "wazero"), `#!/bin/sh
+echo "$*"
+case " $* " in
+*"/fail.wasm "*) echo "module failed" >&2; exit 3 ;;
+esac
+`)
+	if err := os.Chmod(filepath.Join(dir, "wazero"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestWASIRunner(t *testing.T) {
+	fakeWazero(t)
+
+	dir := tempDir(t)
+	cmd := exec.Command("/plugins/lint.wasm", "-v", "file.go")
+	cmd.Env = []string{"MODE=strict"}
+	cmd.Dir = dir
+	r := &execx.WASIRunner{Mounts: []string{"/data:/data"}}
+	res, err := r.Run(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "run -env=MODE=strict -mount=" + dir + ":/ -mount=/data:/data /plugins/lint.wasm -v file.go\n"
+	if got := string(res.Stdout); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWASIRunnerFailure(t *testing.T) {
+	fakeWazero(t)
+
+	_, err := new(execx.WASIRunner).Run(context.Background(), exec.Command("/plugins/fail.wasm"))
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	if ee.ExitCode() != 3 || !strings.Contains(string(ee.Result.Stderr), "module failed") {
+		t.Errorf("got exit code %d, stderr %q", ee.ExitCode(), ee.Result.Stderr)
+	}
+	if v, _ := ee.Detail("wasm_module"); v != "/plugins/fail.wasm" {
+		t.Errorf("got module %v, want /plugins/fail.wasm", v)
+	}
+}
+
+func TestWASIRunnerNoRuntime(t *testing.T) {
+	r := &execx.WASIRunner{Runtime: []string{"execx-nonexistent-runtime"}}
+	_, err := r.Run(context.Background(), exec.Command("/plugins/lint.wasm"))
+	if _, ok := err.(*execx.StartError); !ok {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WindowsQuoting is a style of quoting arguments into a Windows command
+// line. On Windows, the arguments of a process are passed to it as a
+// single string, which programs split into arguments themselves. Most
+// programs use the rules of the Microsoft C runtime, but some do not.
+type WindowsQuoting int
+
+// Known quoting styles.
+const (
+	// QuoteMSVC quotes arguments as per the rules of the Microsoft C
+	// runtime, which is what os/exec does by default.
+	QuoteMSVC WindowsQuoting = iota
+
+	// QuoteCmd quotes arguments as per QuoteMSVC, then escapes
+	// cmd.exe metacharacters, such as & and |, using ^, such that they
+	// are passed through to the program cmd.exe /c runs. The program
+	// name itself is not escaped.
+	QuoteCmd
+
+	// QuoteMsiexec quotes arguments of the form PROPERTY=value as
+	// PROPERTY="value", doubling quotes within the value, as msiexec
+	// expects. Other arguments are quoted as per QuoteMSVC.
+	QuoteMsiexec
+)
+
+// String returns the name of q.
+func (q WindowsQuoting) String() string {
+	switch q {
+	case QuoteMSVC:
+		return "msvc"
+	case QuoteCmd:
+		return "cmd"
+	case QuoteMsiexec:
+		return "msiexec"
+	default:
+		return fmt.Sprintf("WindowsQuoting(%d)", int(q))
+	}
+}
+
+// maxWindowsCmdLine is the maximum length of a Windows command line, in
+// UTF-16 code units, including the terminating NUL.
+const maxWindowsCmdLine = 32767
+
+// WindowsCmdLine joins args into a Windows command line, quoting them
+// as per the specified style. It is available on all platforms, so that
+// command lines can be inspected and tested anywhere.
+func WindowsCmdLine(args []string, style WindowsQuoting) string {
+	quoted := make([]string, 0, len(args))
+	for i, arg := range args {
+		switch {
+		case i == 0:
+			quoted = append(quoted, quoteMSVC(arg))
+		case style == QuoteCmd:
+			quoted = append(quoted, escapeCmd(quoteMSVC(arg)))
+		case style == QuoteMsiexec:
+			quoted = append(quoted, quoteMsiexec(arg))
+		default:
+			quoted = append(quoted, quoteMSVC(arg))
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// WithWindowsQuoting quotes the arguments of the command into a command
+// line using the specified style, rather than the default rules os/exec
+// uses, by setting cmd.SysProcAttr.CmdLine. It has no effect on other
+// platforms, where arguments are passed to the process as they are.
+func WithWindowsQuoting(style WindowsQuoting) Option {
+	return func(cfg *config) {
+		cfg.winQuoting = style
+	}
+}
+
+// WithRawCmdLine passes the specified command line to the process
+// verbatim, ignoring cmd.Args, by setting cmd.SysProcAttr.CmdLine. The
+// command line must include the program name. WithRawCmdLine is only
+// supported on Windows: on other platforms, Start returns a *StartError.
+func WithRawCmdLine(cmdline string) Option {
+	return func(cfg *config) {
+		cfg.rawCmdLine = &cmdline
+	}
+}
+
+// quoteMSVC quotes arg as per the rules of the Microsoft C runtime:
+// backslashes are literal, unless they precede a double quote.
+func quoteMSVC(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\v\"") {
+		return arg
+	}
+	var sb strings.Builder
+	sb.WriteByte('"')
+	slashes := 0
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch c {
+		case '\\':
+			slashes++
+		case '"':
+			sb.WriteString(strings.Repeat(`\`, slashes+1))
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		sb.WriteByte(c)
+	}
+	sb.WriteString(strings.Repeat(`\`, slashes))
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// escapeCmd escapes the cmd.exe metacharacters in s using ^.
+func escapeCmd(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(`()%!^"<>&|`, s[i]) >= 0 {
+			sb.WriteByte('^')
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// quoteMsiexec quotes arg as msiexec expects.
+func quoteMsiexec(arg string) string {
+	prop, value, ok := strings.Cut(arg, "=")
+	if !ok || prop == "" || strings.ContainsAny(prop, " \t\"") {
+		return quoteMSVC(arg)
+	}
+	if value != "" && !strings.ContainsAny(value, " \t\n\v\"") {
+		return arg
+	}
+	return prop + `="` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
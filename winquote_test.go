@@ -0,0 +1,81 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWindowsCmdLine(t *testing.T) {
+	tests := []struct {
+		args  []string
+		style execx.WindowsQuoting
+		want  string
+	}{
+		{
+			args: []string{"prog", "plain", "two words", ""},
+			want: `prog plain "two words" ""`,
+		},
+		{
+			args: []string{`C:\Program Files\prog.exe`, `say "hi"`, `C:\dir\`, `C:\dir with space\`},
+			want: `"C:\Program Files\prog.exe" "say \"hi\"" C:\dir\ "C:\dir with space\\"`,
+		},
+		{
+			args: []string{"prog", `a\"b`},
+			want: `prog "a\\\"b"`,
+		},
+		{
+			args:  []string{"cmd.exe", "/c", "echo", "a&b", "50%", "two words"},
+			style: execx.QuoteCmd,
+			want:  `cmd.exe /c echo a^&b 50^% ^"two words^"`,
+		},
+		{
+			args:  []string{"msiexec", "/i", `C:\My Files\app.msi`, "INSTALLDIR=C:\\Program Files\\App", `NOTE=say "hi"`, "QUIET=1"},
+			style: execx.QuoteMsiexec,
+			want:  `msiexec /i "C:\My Files\app.msi" INSTALLDIR="C:\Program Files\App" NOTE="say ""hi""" QUIET=1`,
+		},
+	}
+	for _, tt := range tests {
+		if got := execx.WindowsCmdLine(tt.args, tt.style); got != tt.want {
+			t.Errorf("WindowsCmdLine(%q, %v):\ngot  %s\nwant %s", tt.args, tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestWithRawCmdLine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("raw command lines are supported on Windows")
+	}
+	_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithRawCmdLine("prog /x"))
+	var se *execx.StartError
+	if !errors.As(err, &se) {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+}
+
+func TestWithWindowsQuotingElsewhere(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("quoting takes effect on Windows")
+	}
+	_, err := execx.Run(context.Background(), selfCmd("echo"), execx.WithWindowsQuoting(execx.QuoteCmd))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unicode/utf16"
+)
+
+// applyCmdLine builds the command line of h.cmd, as configured by
+// WithRawCmdLine or WithWindowsQuoting, and records the final command
+// line as a detail named "cmdline" in errors produced by the command.
+func (h *Handle) applyCmdLine() error {
+	cmd := h.cmd
+	switch {
+	case h.cfg.rawCmdLine != nil:
+		setCmdLine(cmd, *h.cfg.rawCmdLine)
+	case h.cfg.winQuoting != QuoteMSVC:
+		setCmdLine(cmd, WindowsCmdLine(cmd.Args, h.cfg.winQuoting))
+	}
+	cmdline := WindowsCmdLine(cmd.Args, QuoteMSVC)
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.CmdLine != "" {
+		cmdline = cmd.SysProcAttr.CmdLine
+	}
+	if n := len(utf16.Encode([]rune(cmdline))); n >= maxWindowsCmdLine {
+		err := fmt.Errorf("execx: command line too long (%d > %d characters)", n, maxWindowsCmdLine-1)
+		return wrapStart(err, cmd, h.cfg.collectors)
+	}
+	h.cfg.collectors = append(h.cfg.collectors, CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "cmdline", cmdline
+	}))
+	return nil
+}
+
+func setCmdLine(cmd *exec.Cmd, cmdline string) {
+	attr := new(syscall.SysProcAttr)
+	if cmd.SysProcAttr != nil {
+		attr = copySysProcAttr(cmd.SysProcAttr)
+	}
+	attr.CmdLine = cmdline
+	cmd.SysProcAttr = attr
+}
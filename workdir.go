@@ -0,0 +1,112 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// recentlyDeleted bounds the age of the last modification of the parent
+// of a missing working directory, for the directory to be suspected of
+// having been deleted by that modification.
+const recentlyDeleted = 24 * time.Hour
+
+// A WorkDirError reports that a command could not be started, because its
+// working directory does not exist, is not a directory, or cannot be
+// entered by the user the command runs as. It is the Err of the
+// *StartError returned by Start, which checks the working directory
+// before starting the process, such that the failure is not mistaken for
+// a missing executable, as the bare ENOENT reported by the kernel often
+// is. It wraps the underlying error, if any.
+type WorkDirError struct {
+	// Dir is the working directory.
+	Dir string
+
+	// Problem describes what is wrong with Dir: "does not exist", "is
+	// not a directory" or "is not accessible".
+	Problem string
+
+	// DeletedAgo is the time since the parent of Dir was last modified,
+	// if Dir does not exist, and the parent was modified recently, in
+	// which case Dir was likely deleted at that time.
+	DeletedAgo time.Duration
+
+	// UID is the user ID the command runs as, if Dir is not accessible,
+	// or -1 if it is not known.
+	UID int
+
+	Err error
+}
+
+func (e *WorkDirError) Error() string {
+	msg := fmt.Sprintf("dir %s %s", e.Dir, e.Problem)
+	switch {
+	case e.DeletedAgo > 0:
+		msg += fmt.Sprintf(" (deleted %s ago?)", roughDuration(e.DeletedAgo))
+	case e.Problem == "is not accessible" && e.UID >= 0:
+		msg += fmt.Sprintf(" by uid %d", e.UID)
+	}
+	return msg
+}
+
+// Unwrap returns e.Err.
+func (e *WorkDirError) Unwrap() error {
+	return e.Err
+}
+
+// checkWorkDir returns a *WorkDirError if h.cmd.Dir cannot be used as the
+// working directory of the process, or nil. Directories under alternate
+// roots are not checked.
+func (h *Handle) checkWorkDir() error {
+	dir := h.cmd.Dir
+	if dir == "" || h.cfg.root != nil {
+		return nil
+	}
+	fi, err := os.Stat(dir)
+	switch {
+	case os.IsNotExist(err):
+		e := &WorkDirError{Dir: dir, Problem: "does not exist", UID: -1, Err: err}
+		if pfi, perr := os.Stat(filepath.Dir(filepath.Clean(dir))); perr == nil && pfi.IsDir() {
+			if ago := h.clock.Now().Sub(pfi.ModTime()); ago > 0 && ago < recentlyDeleted {
+				e.DeletedAgo = ago
+			}
+		}
+		return e
+	case err != nil:
+		// Such as EACCES on a parent. Let the kernel report it.
+		return nil
+	case !fi.IsDir():
+		return &WorkDirError{Dir: dir, Problem: "is not a directory", UID: -1}
+	}
+	if uid, err := searchable(h.cmd, dir); err != nil {
+		return &WorkDirError{Dir: dir, Problem: "is not accessible", UID: uid, Err: err}
+	}
+	return nil
+}
+
+// roughDuration formats d in a single unit, such as "2m" or "3h".
+func roughDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	default:
+		return fmt.Sprintf("%dh", int(d/time.Hour))
+	}
+}
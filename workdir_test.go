@@ -0,0 +1,72 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"acln.ro/execx"
+)
+
+func TestWorkDirPreflight(t *testing.T) {
+	t.Run("Deleted", func(t *testing.T) {
+		dir := filepath.Join(tempDir(t), "build")
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(dir); err != nil {
+			t.Fatal(err)
+		}
+		cmd := selfCmd("echo")
+		cmd.Dir = dir
+		_, err := execx.Run(context.Background(), cmd)
+		var wde *execx.WorkDirError
+		if !errors.As(err, &wde) {
+			t.Fatalf("got %v, want *WorkDirError", err)
+		}
+		if wde.Problem != "does not exist" || !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("got %v, want missing directory", wde)
+		}
+		if msg := wde.Error(); !strings.HasPrefix(msg, "dir "+dir+" does not exist (deleted ") {
+			t.Errorf("got %q, want deletion hint", msg)
+		}
+	})
+	t.Run("NotDirectory", func(t *testing.T) {
+		file := filepath.Join(tempDir(t), "file")
+		if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := selfCmd("echo")
+		cmd.Dir = file
+		_, err := execx.Run(context.Background(), cmd)
+		var wde *execx.WorkDirError
+		if !errors.As(err, &wde) || wde.Problem != "is not a directory" {
+			t.Fatalf("got %v, want *WorkDirError for a file", err)
+		}
+	})
+	t.Run("Exists", func(t *testing.T) {
+		cmd := selfCmd("echo")
+		cmd.Dir = tempDir(t)
+		if _, err := execx.Run(context.Background(), cmd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
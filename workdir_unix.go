@@ -0,0 +1,80 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+//go:build unix
+// +build unix
+
+package execx
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+// xOK is the mode which checks for the search permission, for access(2).
+const xOK = 1
+
+// searchable returns an error if the user cmd runs as cannot enter dir,
+// along with the user ID, or -1 if it is the current user.
+func searchable(cmd *exec.Cmd, dir string) (int, error) {
+	if cmd.SysProcAttr == nil || cmd.SysProcAttr.Credential == nil {
+		return -1, syscall.Access(dir, xOK)
+	}
+	cred := cmd.SysProcAttr.Credential
+	if cred.Uid == 0 {
+		return 0, nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return int(cred.Uid), nil
+	}
+	// The directory and all its parents must be searchable. Only the
+	// permission bits are considered, not ACLs.
+	for p := abs; ; p = filepath.Dir(p) {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return int(cred.Uid), nil
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			return int(cred.Uid), nil
+		}
+		if !canSearch(cred, st) {
+			return int(cred.Uid), &os.PathError{Op: "chdir", Path: p, Err: syscall.EACCES}
+		}
+		if p == filepath.Dir(p) {
+			return int(cred.Uid), nil
+		}
+	}
+}
+
+// canSearch reports whether the user described by cred has the search
+// permission on the directory described by st.
+func canSearch(cred *syscall.Credential, st *syscall.Stat_t) bool {
+	mode := uint32(st.Mode)
+	switch {
+	case st.Uid == cred.Uid:
+		return mode&0100 != 0
+	case st.Gid == cred.Gid:
+		return mode&0010 != 0
+	}
+	for _, g := range cred.Groups {
+		if st.Gid == g {
+			return mode&0010 != 0
+		}
+	}
+	return mode&0001 != 0
+}
@@ -0,0 +1,371 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WorkRequest is a request sent to a persistent worker.
+type WorkRequest struct {
+	Arguments []string `json:"arguments"`
+	RequestID int      `json:"requestId,omitempty"`
+}
+
+// WorkResponse is the response of a persistent worker to a WorkRequest.
+type WorkResponse struct {
+	ExitCode  int    `json:"exitCode"`
+	Output    string `json:"output,omitempty"`
+	RequestID int    `json:"requestId,omitempty"`
+}
+
+// A WorkerPool keeps persistent worker processes alive, for tools with
+// heavy startup costs which can serve many requests over standard input
+// and standard output, such as Bazel persistent workers.
+//
+// Workers speak the JSON flavor of the Bazel persistent worker protocol:
+// each request is a JSON-encoded WorkRequest written to the standard input
+// of the worker, followed by a newline, and each response is a
+// JSON-encoded WorkResponse read from its standard output. Each worker
+// serves one request at a time. Workers are started on demand, and
+// workers which crash are replaced by fresh ones.
+//
+// A WorkerPool is safe for concurrent use by multiple goroutines.
+type WorkerPool struct {
+	cmd  *exec.Cmd
+	opts []Option
+	sem  chan struct{} // limits the number of workers
+	idle chan *worker
+
+	mu      sync.Mutex // protects the fields below
+	workers map[*worker]struct{}
+	nextID  int
+	closed  bool
+}
+
+// NewWorkerPool returns a pool of at most n workers, each of which runs a
+// Clone of cmd, configured by opts.
+func NewWorkerPool(cmd *exec.Cmd, n int, opts ...Option) *WorkerPool {
+	return &WorkerPool{
+		cmd:     Clone(cmd),
+		opts:    opts,
+		sem:     make(chan struct{}, n),
+		idle:    make(chan *worker, n),
+		workers: make(map[*worker]struct{}),
+	}
+}
+
+var errPoolClosed = errors.New("execx: worker pool closed")
+
+// Do sends a request carrying args to an idle worker, and returns its
+// response. If the worker reports a nonzero exit code, or if it crashes
+// while serving the request, Do returns a *WorkError. If ctx is done
+// before the worker responds, the worker is killed, and Do returns
+// ctx.Err().
+func (p *WorkerPool) Do(ctx context.Context, args ...string) (*WorkResponse, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.sem }()
+
+	w, id, err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+	req := &WorkRequest{Arguments: args, RequestID: id}
+	type result struct {
+		resp *WorkResponse
+		err  error
+	}
+	resc := make(chan result, 1)
+	go func() {
+		resp, err := w.do(req)
+		resc <- result{resp, err}
+	}()
+	var res result
+	select {
+	case res = <-resc:
+	case <-ctx.Done():
+		w.kill()
+		<-resc
+		p.discard(w)
+		return nil, ctx.Err()
+	}
+	if res.err != nil {
+		p.discard(w)
+		return nil, p.workError(req, nil, w.crashed(res.err))
+	}
+	p.release(w)
+	if res.resp.ExitCode != 0 {
+		return res.resp, p.workError(req, res.resp, nil)
+	}
+	return res.resp, nil
+}
+
+// acquire returns an idle worker, starting one if necessary, and the ID
+// of the next request.
+func (p *WorkerPool) acquire() (*worker, int, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, 0, errPoolClosed
+	}
+	p.nextID++
+	id := p.nextID
+	p.mu.Unlock()
+
+	for {
+		select {
+		case w := <-p.idle:
+			if w.exited() {
+				p.discard(w)
+				continue
+			}
+			return w, id, nil
+		default:
+		}
+		break
+	}
+	w, err := startWorker(Clone(p.cmd), p.opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		w.close(0)
+		return nil, 0, errPoolClosed
+	}
+	p.workers[w] = struct{}{}
+	return w, id, nil
+}
+
+// release returns w to the pool of idle workers.
+func (p *WorkerPool) release(w *worker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.idle <- w
+}
+
+// discard removes w from the pool.
+func (p *WorkerPool) discard(w *worker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.workers, w)
+}
+
+func (p *WorkerPool) workError(req *WorkRequest, resp *WorkResponse, err error) *WorkError {
+	we := &WorkError{
+		Path:      p.cmd.Path,
+		Args:      p.cmd.Args,
+		Request:   req.Arguments,
+		RequestID: req.RequestID,
+		ExitCode:  -1,
+		Err:       err,
+	}
+	if resp != nil {
+		we.ExitCode = resp.ExitCode
+		we.Output = resp.Output
+	}
+	return we
+}
+
+// Close stops all workers. Workers are asked to exit by closing their
+// standard input, and are killed if they do not exit within the grace
+// period. Requests in progress fail. Close waits for all workers to exit.
+func (p *WorkerPool) Close(grace time.Duration) {
+	p.mu.Lock()
+	p.closed = true
+	workers := p.workers
+	p.workers = nil
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.close(grace)
+		}(w)
+	}
+	wg.Wait()
+}
+
+// WorkError records the failure of a request served by a persistent worker.
+type WorkError struct {
+	// Path is the path of the worker executable.
+	Path string
+
+	// Args holds the command line arguments of the worker.
+	Args []string
+
+	// Request holds the arguments of the request.
+	Request []string
+
+	// RequestID is the ID of the request.
+	RequestID int
+
+	// ExitCode is the exit code reported by the worker for the
+	// request, or -1 if the worker crashed.
+	ExitCode int
+
+	// Output is the output reported by the worker for the request.
+	Output string
+
+	// Err is the error which caused the worker to crash, if it did.
+	// If the worker exited, Err is an *ExitError, which carries its
+	// standard error output.
+	Err error
+}
+
+// Cmdline returns the concatenation of filepath.Base(e.Path) and e.Args,
+// separated by spaces. See func Cmdline.
+func (e *WorkError) Cmdline() string {
+	return cmdline(e.Path, e.Args)
+}
+
+// Unwrap returns e.Err.
+func (e *WorkError) Unwrap() error {
+	return e.Err
+}
+
+func (e *WorkError) Error() string {
+	req := strings.Join(e.Request, " ")
+	if e.Err != nil {
+		return fmt.Sprintf("%s: request %d [%s]: worker crashed: %v", e.Cmdline(), e.RequestID, req, e.Err)
+	}
+	return fmt.Sprintf("%s: request %d [%s]: exit code %d: %s", e.Cmdline(), e.RequestID, req, e.ExitCode, e.Output)
+}
+
+// Fields returns a flat representation of e, suitable for use with
+// structured logging packages.
+func (e *WorkError) Fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"cmdline":    e.Cmdline(),
+		"path":       e.Path,
+		"args":       e.Args,
+		"request":    e.Request,
+		"request_id": e.RequestID,
+		"exit_code":  e.ExitCode,
+	}
+	if e.Output != "" {
+		fields["output"] = e.Output
+	}
+	if e.Err != nil {
+		fields["error"] = e.Err.Error()
+	}
+	return fields
+}
+
+// worker is a persistent worker process.
+type worker struct {
+	h      *Handle
+	stdin  *io.PipeWriter
+	stdout *io.PipeReader
+	enc    *json.Encoder
+	dec    *json.Decoder
+}
+
+func startWorker(cmd *exec.Cmd, opts []Option) (*worker, error) {
+	inr, inw := io.Pipe()
+	outr, outw := io.Pipe()
+	cmd.Stdin = inr
+	cmd.Stdout = outw
+	h, err := Start(context.Background(), cmd, opts...)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		h.Wait()
+		outw.Close()
+	}()
+	return &worker{
+		h:      h,
+		stdin:  inw,
+		stdout: outr,
+		enc:    json.NewEncoder(inw),
+		dec:    json.NewDecoder(bufio.NewReader(outr)),
+	}, nil
+}
+
+// do sends req to the worker, and reads its response.
+func (w *worker) do(req *WorkRequest) (*WorkResponse, error) {
+	if err := w.enc.Encode(req); err != nil {
+		return nil, err
+	}
+	resp := new(WorkResponse)
+	if err := w.dec.Decode(resp); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// crashed kills the worker, which failed with err, waits for it to exit,
+// and returns the error which best describes the failure.
+func (w *worker) crashed(err error) error {
+	w.kill()
+	if _, werr := w.h.Wait(); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// exited reports whether the worker process has exited.
+func (w *worker) exited() bool {
+	select {
+	case <-w.h.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// kill kills the worker, and unblocks pending I/O.
+func (w *worker) kill() {
+	w.h.kill()
+	w.stdin.Close()
+	w.stdout.Close()
+}
+
+// close closes the standard input of the worker, and waits for it to exit.
+// If the worker does not exit within the grace period, it is killed.
+func (w *worker) close(grace time.Duration) {
+	w.stdin.Close()
+	t := w.h.clock.NewTimer(grace)
+	defer t.Stop()
+	select {
+	case <-w.h.Done():
+	case <-t.C():
+		w.kill()
+		<-w.h.Done()
+	}
+}
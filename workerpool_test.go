@@ -0,0 +1,98 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWorkerPool(t *testing.T) {
+	pool := execx.NewWorkerPool(selfCmd("worker"), 2)
+	defer pool.Close(time.Second)
+	ctx := context.Background()
+
+	resp, err := pool.Do(ctx, "hello", "world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, out := splitWorkOutput(t, resp)
+	if out != "hello world" {
+		t.Errorf("got output %q, want %q", out, "hello world")
+	}
+
+	_, err = pool.Do(ctx, "fail")
+	var we *execx.WorkError
+	if !errors.As(err, &we) {
+		t.Fatalf("got %v, want *WorkError", err)
+	}
+	if we.ExitCode != 1 || we.Output != "failed" || we.Err != nil {
+		t.Errorf("got %+v, want per-request failure", we)
+	}
+
+	resp, err = pool.Do(ctx, "again")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := splitWorkOutput(t, resp); got != pid {
+		t.Errorf("worker %s served request, want reused worker %s", got, pid)
+	}
+
+	_, err = pool.Do(ctx, "crash")
+	if !errors.As(err, &we) {
+		t.Fatalf("got %v, want *WorkError", err)
+	}
+	var ee *execx.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("got %v, want crash caused by *ExitError", err)
+	}
+	if string(ee.Stderr) != "crashing" {
+		t.Errorf("got stderr %q, want %q", ee.Stderr, "crashing")
+	}
+
+	resp, err = pool.Do(ctx, "after", "crash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := splitWorkOutput(t, resp); got == pid {
+		t.Errorf("crashed worker %s served request", pid)
+	}
+}
+
+func TestWorkerPoolClosed(t *testing.T) {
+	pool := execx.NewWorkerPool(selfCmd("worker"), 1)
+	if _, err := pool.Do(context.Background(), "hello"); err != nil {
+		t.Fatal(err)
+	}
+	pool.Close(time.Second)
+	if _, err := pool.Do(context.Background(), "hello"); err == nil {
+		t.Fatal("Do succeeded on closed pool")
+	}
+}
+
+func splitWorkOutput(t *testing.T, resp *execx.WorkResponse) (pid, out string) {
+	t.Helper()
+
+	i := strings.Index(resp.Output, ": ")
+	if i < 0 {
+		t.Fatalf("malformed output %q", resp.Output)
+	}
+	return resp.Output[:i], resp.Output[i+2:]
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Wrapper is a runner program which runs commands on behalf of the
+// caller, such as nice or stdbuf, together with its arguments. The
+// command is appended to the arguments of the wrapper.
+type Wrapper struct {
+	// Args holds the name of the runner program, which is resolved
+	// using exec.LookPath, followed by its arguments.
+	Args []string
+}
+
+// String returns the command line prefix w applies, such as "nice -n 19".
+func (w Wrapper) String() string {
+	return strings.Join(w.Args, " ")
+}
+
+// NiceWrapper runs commands under nice, with the specified niceness
+// adjustment.
+func NiceWrapper(n int) Wrapper {
+	return Wrapper{Args: []string{"nice", "-n", strconv.Itoa(n)}}
+}
+
+// StdbufWrapper runs commands under stdbuf, with the specified options,
+// such as "-oL", which makes standard output line buffered.
+func StdbufWrapper(opts ...string) Wrapper {
+	return Wrapper{Args: append([]string{"stdbuf"}, opts...)}
+}
+
+// TimeoutWrapper runs commands under timeout, which sends SIGTERM to the
+// command if it does not complete within d.
+func TimeoutWrapper(d time.Duration) Wrapper {
+	secs := strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+	return Wrapper{Args: []string{"timeout", secs}}
+}
+
+// StraceWrapper runs commands under strace, following child processes,
+// and writing the trace to the specified file.
+func StraceWrapper(file string) Wrapper {
+	return Wrapper{Args: []string{"strace", "-f", "-o", file}}
+}
+
+// WithWrappers runs the command under the specified wrappers, the first
+// of which is outermost. For example,
+//
+//	WithWrappers(NiceWrapper(19), StdbufWrapper("-oL"))
+//
+// runs "nice -n 19 stdbuf -oL cmd args...". The path and arguments of the
+// command are adjusted accordingly before it starts, such that errors
+// describe the real invocation. The wrappers are also recorded as a detail
+// named "wrappers" in errors produced by the command.
+func WithWrappers(ws ...Wrapper) Option {
+	return func(cfg *config) {
+		cfg.wrappers = append(cfg.wrappers, ws...)
+	}
+}
+
+// applyWrappers prefixes h.cmd with the configured wrappers.
+func (h *Handle) applyWrappers() error {
+	cmd := h.cmd
+	var args []string
+	for _, w := range h.cfg.wrappers {
+		args = append(args, w.Args...)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return wrapStart(err, cmd, h.cfg.collectors)
+	}
+	args = append(args, cmd.Path)
+	if len(cmd.Args) > 1 {
+		args = append(args, cmd.Args[1:]...)
+	}
+	cmd.Path = path
+	cmd.Args = args
+	wrappers := make([]string, 0, len(h.cfg.wrappers))
+	for _, w := range h.cfg.wrappers {
+		wrappers = append(wrappers, w.String())
+		if len(w.Args) > 0 {
+			h.programs = append(h.programs, wrapperPath(w.Args[0]))
+		}
+	}
+	h.cfg.collectors = append(h.cfg.collectors, CollectorFunc(func(*exec.Cmd, *os.ProcessState) (string, interface{}) {
+		return "wrappers", wrappers
+	}))
+	return nil
+}
+
+// wrapperPath returns the path of the wrapper program named name, or name
+// itself if it cannot be found.
+func wrapperPath(name string) string {
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+	return name
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Andrei Tudor Călin
+//
+// Permission to use, copy, modify, and/or distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+// ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+// OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package execx_test
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"acln.ro/execx"
+)
+
+func TestWrapperString(t *testing.T) {
+	tests := []struct {
+		w    execx.Wrapper
+		want string
+	}{
+		{execx.NiceWrapper(19), "nice -n 19"},
+		{execx.StdbufWrapper("-oL", "-eL"), "stdbuf -oL -eL"},
+		{execx.TimeoutWrapper(1500 * time.Millisecond), "timeout 1.5s"},
+		{execx.StraceWrapper("trace.out"), "strace -f -o trace.out"},
+	}
+	for _, tt := range tests {
+		if got := tt.w.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestWithWrappers(t *testing.T) {
+	t.Run("Nice", testWithWrappersNice)
+	t.Run("Missing", testWithWrappersMissing)
+}
+
+func testWithWrappersNice(t *testing.T) {
+	if _, err := exec.LookPath("nice"); err != nil {
+		t.Skip("nice not available")
+	}
+	self := selfCmd("on")
+	path := self.Path
+	_, err := execx.Run(context.Background(), self, execx.WithWrappers(execx.NiceWrapper(5)))
+	ee, ok := err.(*execx.ExitError)
+	if !ok {
+		t.Fatalf("got %v, want *ExitError", err)
+	}
+	wantArgs := []string{"nice", "-n", "5", path}
+	if !reflect.DeepEqual(ee.Args[:4], wantArgs) {
+		t.Errorf("got args %q, want prefix %q", ee.Args, wantArgs)
+	}
+	if string(ee.Stderr) != "whoops" {
+		t.Errorf("got stderr %q, want %q", ee.Stderr, "whoops")
+	}
+	wrappers, _ := ee.Fields()["wrappers"].([]string)
+	if !reflect.DeepEqual(wrappers, []string{"nice -n 5"}) {
+		t.Errorf("got wrappers %q", wrappers)
+	}
+}
+
+func testWithWrappersMissing(t *testing.T) {
+	w := execx.Wrapper{Args: []string{"execx-no-such-wrapper"}}
+	_, err := execx.Run(context.Background(), selfCmd("on"), execx.WithWrappers(w))
+	if _, ok := err.(*execx.StartError); !ok {
+		t.Fatalf("got %v, want *StartError", err)
+	}
+}